@@ -0,0 +1,491 @@
+/*
+Revocation of anonymous credentials with an RSA universal accumulator
+(Li, Li, Xue: Universal Accumulators with Efficient Nonmembership Proofs)
+
+Every credential carries a revocation handle known only to its holder. The
+manager accumulates the handles of revoked credentials,
+
+	A = g^(x_1 * x_2 * ... * x_k) mod N,   x_i = HashToPrime(handle_i)
+
+and publishes the value for every epoch in a State signed with its schnorr
+key. A holder whose handle x is not accumulated keeps a non-membership
+witness (a, d):
+
+	A^a = d^x * g mod N
+
+which exists exactly when gcd(x, x_1 * ... * x_k) = 1. Each revocation is
+published as a signed Update, holders bring their witnesses to the next epoch
+from the update alone, without contacting the manager, so the manager doesn't
+learn who is still active.
+
+Showing the handle or the witness would link all shows of a credential,
+ProveNonMembership shows instead that a fresh commitment C = g^x * h^r opens to
+a handle missing from the accumulator, without revealing x, a or d. The
+credential scheme proves that C commits to the handle inside the credential,
+e.g. with an equality-of-discrete-logarithms proof between its own commitment
+and C. Two shows of one credential share nothing but the epoch.
+
+N is generated by the manager (trusted setup), whoever knows its
+factorization can forge witnesses for revoked handles. The manager uses it
+only to issue witnesses quickly, a deployment which doesn't trust the manager
+with it has to run the setup as a multiparty computation.
+*/
+package accumulator
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrModulusSize = errors.New("accumulator: modulus must have at least 1024 bits")
+	ErrRevoked     = errors.New("accumulator: handle is revoked")
+	ErrEpoch       = errors.New("accumulator: update doesn't follow the epoch of the witness")
+	ErrSignature   = errors.New("accumulator: invalid state signature")
+	ErrWitness     = errors.New("accumulator: invalid non-membership witness")
+	ErrParams      = errors.New("accumulator: invalid parameters")
+)
+
+/*
+Size of the primes representing handles
+*/
+const primeBits = 256
+
+/*
+Default modulus size of NewManager
+*/
+const DefaultModulusBits = 2048
+
+/*
+Public parameters: RSA modulus and two quadratic residues, g the base of the
+accumulator, h the blinding base of the commitments
+*/
+type Params struct {
+	N *big.Int
+	G *big.Int
+	H *big.Int
+}
+
+/*
+Accumulator value of an epoch, signed by the manager
+*/
+type State struct {
+	Epoch     uint64
+	Value     *big.Int
+	Signature *schnorr.Signature
+}
+
+/*
+Revocation of one handle, moving the accumulator from Epoch-1 to Epoch
+*/
+type Update struct {
+	Epoch     uint64
+	Prime     *big.Int // HashToPrime of the revoked handle
+	Value     *big.Int // accumulator after the revocation
+	Signature *schnorr.Signature
+}
+
+/*
+Non-membership witness of a handle in the accumulator of Epoch
+*/
+type Witness struct {
+	Epoch uint64
+	A     *big.Int // 0 <= A < x
+	D     *big.Int
+}
+
+/*
+Revocation manager, holds the factorization of N
+*/
+type Manager struct {
+	params *Params
+	order  *big.Int // p'q', order of the quadratic residues
+	sk     *schnorr.SignatureKey
+	pk     *schnorr.PublicKey
+
+	mu      sync.Mutex
+	epoch   uint64
+	value   *big.Int
+	product *big.Int // product of the revoked primes mod order
+	primes  []*big.Int
+	revoked map[string]bool
+}
+
+/*
+Manager with a fresh modulus of DefaultModulusBits bits, signing the states
+with the key pair
+*/
+func NewManager(sk *schnorr.SignatureKey, pk *schnorr.PublicKey) (*Manager, error) {
+	return NewManagerWithBits(sk, pk, DefaultModulusBits)
+}
+
+/*
+Manager with a fresh modulus of the given size. Generating the safe primes
+takes a while for 2048 bits and above.
+*/
+func NewManagerWithBits(sk *schnorr.SignatureKey, pk *schnorr.PublicKey, bits int) (*Manager, error) {
+	if bits < 1024 {
+		return nil, ErrModulusSize
+	}
+	p, p1, err := safePrime(bits / 2)
+	if err != nil {
+		return nil, err
+	}
+	var q, q1 *big.Int
+	for q == nil || q.Cmp(p) == 0 {
+		if q, q1, err = safePrime(bits - bits/2); err != nil {
+			return nil, err
+		}
+	}
+	N := new(big.Int).Mul(p, q)
+	g, err := randomQR(N)
+	if err != nil {
+		return nil, err
+	}
+	h, err := randomQR(N)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		params:  &Params{N: N, G: g, H: h},
+		order:   new(big.Int).Mul(p1, q1),
+		sk:      sk,
+		pk:      pk,
+		value:   new(big.Int).Set(g),
+		product: big.NewInt(1),
+		revoked: make(map[string]bool),
+	}
+	return m, nil
+}
+
+/*
+Public parameters for holders and verifiers
+*/
+func (m *Manager) Params() *Params {
+	return m.params
+}
+
+/*
+Key verifying the states and updates
+*/
+func (m *Manager) PublicKey() *schnorr.PublicKey {
+	return m.pk
+}
+
+/*
+Signed state of the current epoch
+*/
+func (m *Manager) State() (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	signature, err := schnorr.TrySign(stateMessage(m.params, m.epoch, m.value), m.sk)
+	if err != nil {
+		return nil, err
+	}
+	return &State{Epoch: m.epoch, Value: new(big.Int).Set(m.value), Signature: signature}, nil
+}
+
+/*
+Non-membership witness of the handle for the current epoch, given to the
+holder at issuance
+*/
+func (m *Manager) Witness(handle []byte) (*Witness, error) {
+	x := HashToPrime(handle)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.revoked[string(x.Bytes())] {
+		return nil, ErrRevoked
+	}
+	// a = u^-1 mod x, d = g^-b with b = (1 - a*u) / x, computed mod p'q'
+	u := big.NewInt(1)
+	for _, prime := range m.primes {
+		u.Mod(u.Mul(u, prime), x)
+	}
+	a := new(big.Int).ModInverse(u, x)
+	e := new(big.Int).Mul(a, m.product)
+	e.Sub(e, big.NewInt(1))
+	e.Mul(e, new(big.Int).ModInverse(x, m.order))
+	e.Mod(e, m.order)
+	d := new(big.Int).Exp(m.params.G, e, m.params.N)
+
+	return &Witness{Epoch: m.epoch, A: a, D: d}, nil
+}
+
+/*
+Revoke the credential with the handle, the update is published to all holders
+*/
+func (m *Manager) Revoke(handle []byte) (*Update, error) {
+	x := HashToPrime(handle)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.revoked[string(x.Bytes())] {
+		return nil, ErrRevoked
+	}
+	value := new(big.Int).Exp(m.value, x, m.params.N)
+	signature, err := schnorr.TrySign(updateMessage(m.params, m.epoch+1, x, value), m.sk)
+	if err != nil {
+		return nil, err
+	}
+
+	m.epoch++
+	m.value = value
+	m.product.Mod(m.product.Mul(m.product, x), m.order)
+	m.primes = append(m.primes, x)
+	m.revoked[string(x.Bytes())] = true
+	return &Update{Epoch: m.epoch, Prime: x, Value: new(big.Int).Set(value), Signature: signature}, nil
+}
+
+/*
+Check the manager's signature of the state
+*/
+func VerifyState(params *Params, state *State, pk *schnorr.PublicKey) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+	if state == nil || state.Value == nil || state.Signature == nil || !params.element(state.Value) ||
+		!schnorr.VerifySignature(stateMessage(params, state.Epoch, state.Value), state.Signature, pk) {
+		return ErrSignature
+	}
+	return nil
+}
+
+/*
+Holder side - bring the witness of the handle from epoch update.Epoch-1 to
+update.Epoch. previous is the accumulator value the witness was valid for,
+the returned witness is valid for update.Value. Fails with ErrRevoked when the
+update revokes the handle.
+*/
+func UpdateWitness(params *Params, handle []byte, w *Witness, previous *big.Int, update *Update, pk *schnorr.PublicKey) (*Witness, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	if update == nil || update.Prime == nil || update.Value == nil || update.Signature == nil || !params.element(update.Value) ||
+		!schnorr.VerifySignature(updateMessage(params, update.Epoch, update.Prime, update.Value), update.Signature, pk) {
+		return nil, ErrSignature
+	}
+	if w == nil || w.A == nil || w.D == nil || previous == nil {
+		return nil, ErrWitness
+	}
+	if update.Epoch != w.Epoch+1 {
+		return nil, ErrEpoch
+	}
+	x := HashToPrime(handle)
+	if update.Prime.Cmp(x) == 0 {
+		return nil, ErrRevoked
+	}
+
+	// a0*y + r0*x = 1, the new witness is a' = a*a0 mod x, a*a0 = a' + k*x,
+	// d' = d * A^(-a*r0) * A'^(-k)
+	a0, r0 := new(big.Int), new(big.Int)
+	if new(big.Int).GCD(a0, r0, update.Prime, x).Cmp(big.NewInt(1)) != 0 {
+		return nil, ErrWitness
+	}
+	k, a := new(big.Int).DivMod(new(big.Int).Mul(w.A, a0), x, new(big.Int))
+
+	e := new(big.Int).Mul(w.A, r0)
+	d, err := expSigned(previous, e.Neg(e), params.N)
+	if err != nil {
+		return nil, err
+	}
+	t, err := expSigned(update.Value, new(big.Int).Neg(k), params.N)
+	if err != nil {
+		return nil, err
+	}
+	d.Mul(d, w.D)
+	d.Mod(d.Mul(d, t), params.N)
+	return &Witness{Epoch: update.Epoch, A: a, D: d}, nil
+}
+
+/*
+Check the witness of the handle against the state, A^a = d^x * g mod N.
+Reveals the handle to the verifier, shows use ProveNonMembership.
+*/
+func VerifyWitness(params *Params, state *State, handle []byte, w *Witness) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+	if state == nil || state.Value == nil || w == nil || w.A == nil || w.D == nil || w.Epoch != state.Epoch {
+		return ErrWitness
+	}
+	x := HashToPrime(handle)
+	if w.A.Sign() < 0 || w.A.Cmp(x) >= 0 || !params.element(w.D) {
+		return ErrWitness
+	}
+	left := new(big.Int).Exp(state.Value, w.A, params.N)
+	right := new(big.Int).Exp(w.D, x, params.N)
+	right.Mod(right.Mul(right, params.G), params.N)
+	if left.Cmp(right) != 0 {
+		return ErrWitness
+	}
+	return nil
+}
+
+/*
+Deterministic primeBits-bit prime representing the handle
+*/
+func HashToPrime(handle []byte) *big.Int {
+	var counter [4]byte
+	candidate := new(big.Int)
+	for i := uint32(0); ; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		h := sha256.New()
+		h.Write([]byte("schnorr/accumulator/prime"))
+		h.Write(counter[:])
+		h.Write(handle)
+		digest := h.Sum(nil)
+		digest[0] |= 0x80
+		digest[len(digest)-1] |= 1
+		candidate.SetBytes(digest)
+		if candidate.ProbablyPrime(32) {
+			return candidate
+		}
+	}
+}
+
+/*
+Fresh random revocation handle for a credential
+*/
+func NewHandle() ([]byte, error) {
+	handle := make([]byte, 32)
+	if _, err := io.ReadFull(entropy.Reader, handle); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+func (params *Params) validate() error {
+	if params == nil || params.N == nil || params.G == nil || params.H == nil || params.N.BitLen() < 1024 ||
+		!params.element(params.G) || !params.element(params.H) {
+		return ErrParams
+	}
+	return nil
+}
+
+/*
+v is in Z_N^*, different from 1 and -1
+*/
+func (params *Params) element(v *big.Int) bool {
+	if v.Cmp(big.NewInt(1)) <= 0 || v.Cmp(new(big.Int).Sub(params.N, big.NewInt(1))) >= 0 {
+		return false
+	}
+	return new(big.Int).GCD(nil, nil, v, params.N).Cmp(big.NewInt(1)) == 0
+}
+
+func stateMessage(params *Params, epoch uint64, value *big.Int) string {
+	return signedMessage("schnorr/accumulator/state", params, epoch, value)
+}
+
+func updateMessage(params *Params, epoch uint64, prime, value *big.Int) string {
+	return signedMessage("schnorr/accumulator/update", params, epoch, prime, value)
+}
+
+func signedMessage(label string, params *Params, epoch uint64, values ...*big.Int) string {
+	h := sha256.New()
+	h.Write([]byte(label))
+	writeInts(h, params.N, params.G, params.H)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], epoch)
+	h.Write(buf[:])
+	writeInts(h, values...)
+	return string(h.Sum(nil))
+}
+
+/*
+Length-prefixed big-endian encoding of non-negative integers
+*/
+func writeInts(h interface{ Write([]byte) (int, error) }, values ...*big.Int) {
+	var buf [4]byte
+	for _, v := range values {
+		b := v.Bytes()
+		binary.BigEndian.PutUint32(buf[:], uint32(len(b)))
+		h.Write(buf[:])
+		h.Write(b)
+	}
+}
+
+/*
+base^e mod N for a signed exponent
+*/
+func expSigned(base, e, N *big.Int) (*big.Int, error) {
+	if e.Sign() >= 0 {
+		return new(big.Int).Exp(base, e, N), nil
+	}
+	inverse := new(big.Int).ModInverse(base, N)
+	if inverse == nil {
+		return nil, ErrParams
+	}
+	return inverse.Exp(inverse, new(big.Int).Neg(e), N), nil
+}
+
+/*
+Prime p = 2p' + 1 with prime p', returns p and p'
+*/
+func safePrime(bits int) (*big.Int, *big.Int, error) {
+	b := make([]byte, (bits+6)/8)
+	p1 := new(big.Int)
+	for {
+		if _, err := io.ReadFull(entropy.Reader, b); err != nil {
+			return nil, nil, err
+		}
+		// p' of exactly bits-1 bits, top two set so that p keeps the size
+		b[0] &= byte(0xff >> (8*len(b) - bits + 1))
+		p1.SetBytes(b)
+		p1.SetBit(p1, bits-2, 1)
+		p1.SetBit(p1, bits-3, 1)
+		p1.SetBit(p1, 0, 1)
+		if !sieve(p1) || !p1.ProbablyPrime(0) {
+			continue
+		}
+		p := new(big.Int).Lsh(p1, 1)
+		p.Add(p, big.NewInt(1))
+		if p.ProbablyPrime(20) && p1.ProbablyPrime(20) {
+			return p, new(big.Int).Set(p1), nil
+		}
+	}
+}
+
+var smallPrimes = []int64{3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79, 83, 89, 97,
+	101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151, 157, 163, 167, 173, 179, 181, 191, 193, 197, 199, 211}
+
+/*
+Neither p' nor 2p' + 1 has a small factor r: p' mod r is not 0 nor (r-1)/2
+*/
+func sieve(p1 *big.Int) bool {
+	r := new(big.Int)
+	for _, prime := range smallPrimes {
+		m := r.Mod(p1, big.NewInt(prime)).Int64()
+		if m == 0 || m == (prime-1)/2 {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Random quadratic residue, a generator of QR_N with overwhelming probability
+*/
+func randomQR(N *big.Int) (*big.Int, error) {
+	for {
+		r, err := entropy.Scalar(N)
+		if err != nil {
+			return nil, err
+		}
+		r.Exp(r, big.NewInt(2), N)
+		if new(big.Int).GCD(nil, nil, r, N).Cmp(big.NewInt(1)) == 0 && r.Cmp(big.NewInt(1)) != 0 {
+			return r, nil
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package accumulator
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Holders follow the published updates, a revoked holder can't update its
+witness nor prove non-membership, the others keep proving unlinkably
+*/
+func TestRevocation(t *testing.T) {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManagerWithBits(sk, pk, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := m.Params()
+
+	handles := make([][]byte, 3)
+	witnesses := make([]*Witness, 3)
+	for i := range handles {
+		if handles[i], err = NewHandle(); err != nil {
+			t.Fatal(err)
+		}
+		if witnesses[i], err = m.Witness(handles[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state, err := m.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// revoke a credential which holds no witness, then holder 0
+	other, _ := NewHandle()
+	for _, revoked := range [][]byte{other, handles[0]} {
+		update, err := m.Revoke(revoked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range witnesses {
+			if witnesses[i] == nil {
+				continue
+			}
+			w, err := UpdateWitness(params, handles[i], witnesses[i], state.Value, update, pk)
+			if i == 0 && string(revoked) == string(handles[0]) {
+				if err != ErrRevoked {
+					t.Errorf("update revoking the holder: %v", err)
+				}
+				witnesses[0] = nil
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			witnesses[i] = w
+		}
+		if state, err = m.State(); err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyState(params, state, pk); err != nil || state.Value.Cmp(update.Value) != 0 {
+			t.Fatalf("state of epoch %d: %v", state.Epoch, err)
+		}
+	}
+	if _, err := m.Revoke(handles[0]); err != ErrRevoked {
+		t.Errorf("second revocation: %v", err)
+	}
+	if _, err := m.Witness(handles[0]); err != ErrRevoked {
+		t.Errorf("witness of a revoked handle: %v", err)
+	}
+
+	// witnesses issued after the revocations agree with the updated ones
+	fresh, err := m.Witness(handles[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []*Witness{witnesses[1], witnesses[2], fresh} {
+		if w.Epoch != state.Epoch {
+			t.Fatalf("witness of epoch %d, state %d", w.Epoch, state.Epoch)
+		}
+	}
+	if VerifyWitness(params, state, handles[1], witnesses[1]) != nil || VerifyWitness(params, state, handles[1], fresh) != nil ||
+		VerifyWitness(params, state, handles[2], witnesses[2]) != nil {
+		t.Error("witness of an active holder doesn't verify")
+	}
+	if VerifyWitness(params, state, handles[2], witnesses[1]) == nil {
+		t.Error("witness verifies for another handle")
+	}
+
+	proof, r, err := ProveNonMembership(params, state, handles[1], witnesses[1], "session 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyNonMembership(params, state, proof, "session 1"); err != nil {
+		t.Fatal(err)
+	}
+	if exp2(params.G, HashToPrime(handles[1]), params.H, r, params.N).Cmp(proof.C) != 0 {
+		t.Error("opening doesn't match the commitment")
+	}
+	second, _, err := ProveNonMembership(params, state, handles[1], witnesses[1], "session 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.C.Cmp(proof.C) == 0 || second.Cd.Cmp(proof.Cd) == 0 {
+		t.Error("two shows share a commitment")
+	}
+
+	if VerifyNonMembership(params, state, proof, "session 2") == nil {
+		t.Error("proof verifies in another context")
+	}
+	tampered := *proof
+	tampered.Zx = new(big.Int).Add(proof.Zx, big.NewInt(1))
+	if VerifyNonMembership(params, state, &tampered, "session 1") == nil {
+		t.Error("tampered proof verifies")
+	}
+	stale := *state
+	stale.Epoch--
+	if VerifyNonMembership(params, &stale, proof, "session 1") == nil {
+		t.Error("proof verifies for another epoch")
+	}
+
+	// the revoked holder's old witness doesn't verify against the new state
+	if _, _, err := ProveNonMembership(params, state, handles[0], fresh, "session 1"); err == nil {
+		t.Error("revoked holder proves non-membership")
+	}
+}
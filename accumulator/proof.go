@@ -0,0 +1,222 @@
+package accumulator
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/entropy"
+)
+
+var ErrProof = errors.New("accumulator: invalid non-membership proof")
+
+const (
+	challengeBits   = 128
+	statisticalBits = 80
+)
+
+/*
+Zero-knowledge proof that the commitment C = g^x * h^r opens to a handle prime x
+with a witness for the accumulator of Epoch. With C_d = d * h^r2,
+C_r = g^r2 * h^r3, beta = x*r2 and gamma = x*r3 it proves knowledge of
+x, r, a, r2, r3, beta, gamma such that
+
+	C   = g^x * h^r
+	g   = A^a * C_d^-x * h^beta
+	C_r = g^r2 * h^r3
+	1   = C_r^x * g^-beta * h^-gamma
+
+made non-interactive with a Fiat-Shamir challenge over the context. The
+responses are integers, their sizes bound x to primeBits bits.
+*/
+type Proof struct {
+	Epoch uint64
+	C     *big.Int // commitment to the handle prime
+	Cd    *big.Int
+	Cr    *big.Int
+
+	Challenge                        *big.Int
+	Zx, Zr, Za, Zr2, Zr3, Zb, Zgamma *big.Int
+}
+
+/*
+Holder side - prove that the handle is not revoked in the state, the
+commitment is bound to the context (verifier nonce, request). Returns the
+opening r of Proof.C for the credential's proof that C commits to its handle.
+*/
+func ProveNonMembership(params *Params, state *State, handle []byte, w *Witness, context string) (*Proof, *big.Int, error) {
+	if err := VerifyWitness(params, state, handle, w); err != nil {
+		return nil, nil, err
+	}
+	x := HashToPrime(handle)
+	N := params.N
+	randomBits := N.BitLen() + statisticalBits
+
+	var r, r2, r3 *big.Int
+	for _, v := range []**big.Int{&r, &r2, &r3} {
+		var err error
+		if *v, err = randomInt(randomBits); err != nil {
+			return nil, nil, err
+		}
+	}
+	beta := new(big.Int).Mul(x, r2)
+	gamma := new(big.Int).Mul(x, r3)
+
+	proof := &Proof{
+		Epoch: state.Epoch,
+		C:     exp2(params.G, x, params.H, r, N),
+		Cd:    exp2(w.D, big.NewInt(1), params.H, r2, N),
+		Cr:    exp2(params.G, r2, params.H, r3, N),
+	}
+
+	// masks statisticalBits + challengeBits longer than the secrets
+	pad := challengeBits + statisticalBits
+	var rx, rr, ra, rr2, rr3, rb, rgamma *big.Int
+	for _, m := range []struct {
+		v    **big.Int
+		bits int
+	}{
+		{&rx, primeBits + pad}, {&ra, primeBits + pad},
+		{&rr, randomBits + pad}, {&rr2, randomBits + pad}, {&rr3, randomBits + pad},
+		{&rb, primeBits + randomBits + pad}, {&rgamma, primeBits + randomBits + pad},
+	} {
+		var err error
+		if *m.v, err = randomInt(m.bits); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	T1 := exp2(params.G, rx, params.H, rr, N)
+	T2, err := exp3(state.Value, ra, proof.Cd, new(big.Int).Neg(rx), params.H, rb, N)
+	if err != nil {
+		return nil, nil, err
+	}
+	T3 := exp2(params.G, rr2, params.H, rr3, N)
+	T4, err := exp3(proof.Cr, rx, params.G, new(big.Int).Neg(rb), params.H, new(big.Int).Neg(rgamma), N)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := proofChallenge(params, state.Value, proof, T1, T2, T3, T4, context)
+
+	response := func(mask, secret *big.Int) *big.Int {
+		z := new(big.Int).Mul(c, secret)
+		return z.Add(z, mask)
+	}
+	proof.Challenge = c
+	proof.Zx, proof.Zr, proof.Za = response(rx, x), response(rr, r), response(ra, w.A)
+	proof.Zr2, proof.Zr3 = response(rr2, r2), response(rr3, r3)
+	proof.Zb, proof.Zgamma = response(rb, beta), response(rgamma, gamma)
+	return proof, r, nil
+}
+
+/*
+Verifier side - check the proof against the state of its epoch, the state
+itself is checked once with VerifyState
+*/
+func VerifyNonMembership(params *Params, state *State, proof *Proof, context string) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+	if state == nil || state.Value == nil || proof == nil || proof.Epoch != state.Epoch {
+		return ErrProof
+	}
+	for _, v := range []*big.Int{proof.C, proof.Cd, proof.Cr} {
+		if v == nil || !params.element(v) {
+			return ErrProof
+		}
+	}
+	randomBits := params.N.BitLen() + statisticalBits
+	pad := challengeBits + statisticalBits + 1
+	for _, z := range []struct {
+		v    *big.Int
+		bits int
+	}{
+		{proof.Challenge, challengeBits},
+		{proof.Zx, primeBits + pad}, {proof.Za, primeBits + pad},
+		{proof.Zr, randomBits + pad}, {proof.Zr2, randomBits + pad}, {proof.Zr3, randomBits + pad},
+		{proof.Zb, primeBits + randomBits + pad}, {proof.Zgamma, primeBits + randomBits + pad},
+	} {
+		if z.v == nil || z.v.Sign() < 0 || z.v.BitLen() > z.bits {
+			return ErrProof
+		}
+	}
+
+	N := params.N
+	c := proof.Challenge
+	negC := new(big.Int).Neg(c)
+	T1, err := exp3(params.G, proof.Zx, params.H, proof.Zr, proof.C, negC, N)
+	if err != nil {
+		return ErrProof
+	}
+	T2, err := exp3(state.Value, proof.Za, proof.Cd, new(big.Int).Neg(proof.Zx), params.H, proof.Zb, N)
+	if err != nil {
+		return ErrProof
+	}
+	g, err := expSigned(params.G, negC, N)
+	if err != nil {
+		return ErrProof
+	}
+	T2.Mod(T2.Mul(T2, g), N)
+	T3, err := exp3(params.G, proof.Zr2, params.H, proof.Zr3, proof.Cr, negC, N)
+	if err != nil {
+		return ErrProof
+	}
+	T4, err := exp3(proof.Cr, proof.Zx, params.G, new(big.Int).Neg(proof.Zb), params.H, new(big.Int).Neg(proof.Zgamma), N)
+	if err != nil {
+		return ErrProof
+	}
+	if proofChallenge(params, state.Value, proof, T1, T2, T3, T4, context).Cmp(c) != 0 {
+		return ErrProof
+	}
+	return nil
+}
+
+func proofChallenge(params *Params, value *big.Int, proof *Proof, T1, T2, T3, T4 *big.Int, context string) *big.Int {
+	h := sha256.New()
+	h.Write([]byte("schnorr/accumulator/nonmembership"))
+	writeInts(h, params.N, params.G, params.H)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], proof.Epoch)
+	h.Write(buf[:])
+	writeInts(h, value, proof.C, proof.Cd, proof.Cr, T1, T2, T3, T4)
+	h.Write([]byte(context))
+	return new(big.Int).SetBytes(h.Sum(nil)[:challengeBits/8])
+}
+
+/*
+b1^e1 * b2^e2 mod N, e2 non-negative
+*/
+func exp2(b1, e1, b2, e2, N *big.Int) *big.Int {
+	v := new(big.Int).Exp(b1, e1, N)
+	v.Mul(v, new(big.Int).Exp(b2, e2, N))
+	return v.Mod(v, N)
+}
+
+/*
+b1^e1 * b2^e2 * b3^e3 mod N for signed exponents
+*/
+func exp3(b1, e1, b2, e2, b3, e3, N *big.Int) (*big.Int, error) {
+	v := big.NewInt(1)
+	for _, f := range [][2]*big.Int{{b1, e1}, {b2, e2}, {b3, e3}} {
+		t, err := expSigned(f[0], f[1], N)
+		if err != nil {
+			return nil, err
+		}
+		v.Mod(v.Mul(v, t), N)
+	}
+	return v, nil
+}
+
+/*
+Uniform integer of at most bits bits
+*/
+func randomInt(bits int) (*big.Int, error) {
+	b := make([]byte, (bits+7)/8)
+	if _, err := io.ReadFull(entropy.Reader, b); err != nil {
+		return nil, err
+	}
+	b[0] &= byte(0xff >> (8*len(b) - bits))
+	return new(big.Int).SetBytes(b), nil
+}
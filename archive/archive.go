@@ -0,0 +1,333 @@
+/*
+Long-term archival of signed documents with periodic re-signing.
+
+A signature is only as good as its key and group parameters: keys expire and
+parameter sets get deprecated. The archive keeps every document together with
+a chain of signature layers. Before the newest layer stops being trustworthy
+the Renewer adds a layer made with the current archive key, covering the
+document and all previous layers:
+
+	layer_0 = original signature of the document
+	layer_i = Sign(H(document || layer_0 || ... || layer_(i-1) || created_i))
+
+so the original evidence is never replaced, only protected by fresher
+signatures. A chain is valid if every layer verifies and was added before the
+previous layer expired.
+
+Layer creation times are claimed by the archive itself, deployments which need
+third party evidence of the time should timestamp new layers as well.
+*/
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrEmpty       = errors.New("archive: record has no signature")
+	ErrUnknown     = errors.New("archive: unknown record")
+	ErrGap         = errors.New("archive: layer added after the previous layer expired")
+	ErrBadLayer    = errors.New("archive: invalid layer signature")
+	ErrExpiredHead = errors.New("archive: newest layer has expired")
+	ErrArchiveKey  = errors.New("archive: archive key expires within the renewal margin")
+)
+
+/*
+Single signature of the chain
+*/
+type Layer struct {
+	PublicKey []byte    // schnorr.PublicKey.Bytes
+	Signature []byte    // schnorr.Signature.Bytes
+	Created   time.Time // claimed creation time, zero for the original signature
+}
+
+/*
+Archived document with its signature chain, Layers[0] is the original signature of Document
+*/
+type Record struct {
+	ID       string
+	Document []byte
+	Layers   []Layer
+}
+
+/*
+Pluggable persistence of records
+*/
+type Store interface {
+	Put(record *Record) error
+	Get(id string) (*Record, error)
+	List() ([]string, error)
+}
+
+/*
+Store keeping records in memory
+*/
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+func (s *MemoryStore) Put(record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.ID] = record
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok {
+		return nil, ErrUnknown
+	}
+	return record, nil
+}
+
+func (s *MemoryStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.records))
+	for id := range s.records {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+/*
+Decides until when a layer can be trusted: the earlier of the key expiry and
+the deprecation of its parameter set
+*/
+type Policy struct {
+	Deprecated map[uint16]time.Time // parameter set ID -> time after which its signatures aren't trusted
+	Unknown    time.Time            // deprecation of keys with unregistered parameters, zero means never
+}
+
+/*
+Time after which signatures of the key aren't trusted, zero if never
+*/
+func (p *Policy) Expiry(pk *schnorr.PublicKey) time.Time {
+	expiry := pk.NotAfter()
+	deprecated := p.Unknown
+	if id, ok := pk.ParamsID(); ok {
+		deprecated = p.Deprecated[id]
+	}
+	if !deprecated.IsZero() && (expiry.IsZero() || deprecated.Before(expiry)) {
+		expiry = deprecated
+	}
+	return expiry
+}
+
+/*
+New record with the original signature of the document
+*/
+func NewRecord(id string, document []byte, signature *schnorr.Signature, pk *schnorr.PublicKey) *Record {
+	return &Record{ID: id, Document: document, Layers: []Layer{{PublicKey: pk.Bytes(), Signature: signature.Bytes()}}}
+}
+
+/*
+Add a layer signed with the given key at the given time
+*/
+func (r *Record) Resign(sk *schnorr.SignatureKey, pk *schnorr.PublicKey, now time.Time) error {
+	if len(r.Layers) == 0 {
+		return ErrEmpty
+	}
+	now = now.UTC().Truncate(time.Second)
+	signature, err := schnorr.TrySign(r.message(len(r.Layers), now), sk)
+	if err != nil {
+		return err
+	}
+	r.Layers = append(r.Layers, Layer{PublicKey: pk.Bytes(), Signature: signature.Bytes(), Created: now})
+	return nil
+}
+
+/*
+Verify the whole chain at the given time. Keys of the layers are taken from the
+record, callers decide whether they trust the key of the original signature.
+*/
+func (r *Record) Verify(policy *Policy, at time.Time) error {
+	if len(r.Layers) == 0 {
+		return ErrEmpty
+	}
+
+	var previousExpiry time.Time
+	for i, layer := range r.Layers {
+		pk, err := schnorr.ParsePublicKey(layer.PublicKey)
+		if err != nil {
+			return fmt.Errorf("archive: layer %d: %w", i, err)
+		}
+		signature, err := schnorr.ParseSignature(layer.Signature)
+		if err != nil {
+			return fmt.Errorf("archive: layer %d: %w", i, err)
+		}
+
+		message := string(r.Document)
+		if i > 0 {
+			message = r.message(i, layer.Created)
+			if !previousExpiry.IsZero() && layer.Created.After(previousExpiry) {
+				return fmt.Errorf("archive: layer %d: %w", i, ErrGap)
+			}
+		}
+		if !schnorr.VerifySignature(message, signature, pk) {
+			return fmt.Errorf("archive: layer %d: %w", i, ErrBadLayer)
+		}
+		previousExpiry = policy.Expiry(pk)
+	}
+
+	if !previousExpiry.IsZero() && at.After(previousExpiry) {
+		return ErrExpiredHead
+	}
+	return nil
+}
+
+/*
+Expiry of the newest layer, zero if it never expires
+*/
+func (r *Record) Expiry(policy *Policy) (time.Time, error) {
+	if len(r.Layers) == 0 {
+		return time.Time{}, ErrEmpty
+	}
+	pk, err := schnorr.ParsePublicKey(r.Layers[len(r.Layers)-1].PublicKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return policy.Expiry(pk), nil
+}
+
+/*
+Message signed by layer i: H("schnorr/archive" || document || layers 0..i-1 || created)
+*/
+func (r *Record) message(layer int, created time.Time) string {
+	h := sha256.New()
+	write := func(b []byte) {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(b))))
+		h.Write(b)
+	}
+	write([]byte("schnorr/archive"))
+	write(r.Document)
+	for _, l := range r.Layers[:layer] {
+		write(l.PublicKey)
+		write(l.Signature)
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(l.Created.Unix())))
+	}
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(created.Unix())))
+	return string(h.Sum(nil))
+}
+
+/*
+Outcome of a renewal pass
+*/
+type Report struct {
+	Renewed []string
+	Failed  map[string]error // record ID -> error, e.g. chain already broken
+}
+
+/*
+Re-signs records whose newest layer expires within Margin with the current archive key
+*/
+type Renewer struct {
+	Store  Store
+	Policy *Policy
+	Margin time.Duration
+
+	mu  sync.Mutex
+	sk  *schnorr.SignatureKey
+	pk  *schnorr.PublicKey
+	now func() time.Time
+}
+
+func NewRenewer(store Store, policy *Policy, margin time.Duration, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Renewer {
+	return &Renewer{Store: store, Policy: policy, Margin: margin, sk: sk, pk: pk, now: schnorr.Now}
+}
+
+/*
+Replace the archive key, used for layers added from now on
+*/
+func (r *Renewer) SetKey(sk *schnorr.SignatureKey, pk *schnorr.PublicKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sk, r.pk = sk, pk
+}
+
+/*
+Single pass over all records. Records with a broken chain are reported and left
+untouched, re-signing them would only hide the problem.
+*/
+func (r *Renewer) RenewOnce() (*Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids, err := r.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	now := r.now()
+	report := &Report{Failed: make(map[string]error)}
+	for _, id := range ids {
+		record, err := r.Store.Get(id)
+		if err != nil {
+			report.Failed[id] = err
+			continue
+		}
+		expiry, err := record.Expiry(r.Policy)
+		if err != nil {
+			report.Failed[id] = err
+			continue
+		}
+		if expiry.IsZero() || expiry.Sub(now) > r.Margin {
+			continue
+		}
+		if err := record.Verify(r.Policy, now); err != nil {
+			report.Failed[id] = err
+			continue
+		}
+		if keyExpiry := r.Policy.Expiry(r.pk); !keyExpiry.IsZero() && keyExpiry.Sub(now) <= r.Margin {
+			report.Failed[id] = ErrArchiveKey
+			continue
+		}
+		if err := record.Resign(r.sk, r.pk, now); err != nil {
+			report.Failed[id] = err
+			continue
+		}
+		if err := r.Store.Put(record); err != nil {
+			report.Failed[id] = err
+			continue
+		}
+		report.Renewed = append(report.Renewed, id)
+	}
+	return report, nil
+}
+
+/*
+Renew every interval until ctx is done, reports of every pass are passed to emit
+*/
+func (r *Renewer) Run(ctx context.Context, interval time.Duration, emit func(*Report)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := r.RenewOnce()
+		if err != nil {
+			return err
+		}
+		emit(report)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
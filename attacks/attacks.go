@@ -0,0 +1,152 @@
+/*
+Attacks on Schnorr signatures, for EDUCATIONAL USE ONLY.
+
+The package demonstrates why the rules of the protocol matter by breaking
+implementations which ignore them:
+
+	nonce reuse        two signatures with the same nonce reveal the key
+	related nonces     nonces with a known affine relation reveal the key
+	biased nonces      a few signatures with short nonces reveal the key
+	                   through a lattice (hidden number problem)
+	ROS                ℓ concurrent blind signing sessions yield ℓ+1 signatures
+
+The attacks work against the elliptic curve groups of package schnorr
+(schnorr.Secp256k1, schnorr.P256). The key recovery functions take the
+challenges and responses of observed signatures, the Victim type simulates a
+signer with the corresponding flaw. Every Demo* function runs a complete
+attack with fresh keys and prints what happens, the schnorr CLI runs them
+with `schnorr attack <name>`.
+
+None of this is needed to use the library and none of it should be used
+against systems without the permission of their owners.
+*/
+package attacks
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrNotApplicable = errors.New("attacks: samples don't satisfy the attack preconditions")
+	ErrNotRecovered  = errors.New("attacks: key not recovered")
+)
+
+/*
+Observed signature reduced to what the attacks need: the challenge
+c = H(R||m) and the response s = k + c*x mod n
+*/
+type Sample struct {
+	C, S *big.Int
+}
+
+/*
+Sample of a signature of m, computed from public values only
+*/
+func Observe(pk *schnorr.PublicKey, m string, signature *schnorr.Signature) Sample {
+	return Sample{schnorr.Challenge(signature.R, m, pk), signature.S()}
+}
+
+/*
+Signer whose nonces are chosen by the caller, standing in for broken random
+number generators, counters used as nonces and similar implementation flaws
+*/
+type Victim struct {
+	Public *schnorr.PublicKey
+	x      *big.Int
+}
+
+func NewVictim(group schnorr.Group) *Victim {
+	x := randomScalar(group.Order())
+	pk, err := schnorr.NewPublicKey(group, group.ScalarBaseMult(x))
+	if err != nil {
+		panic(err)
+	}
+	return &Victim{pk, x}
+}
+
+/*
+Sign m with the nonce k: R = k*G, s = k + c*x mod n. The signature verifies
+with schnorr.VerifySignature like any other.
+*/
+func (v *Victim) SignWithNonce(m string, k *big.Int) *schnorr.Signature {
+	group := v.Public.Group()
+	R := encode(group, group.ScalarBaseMult(k))
+	c := schnorr.Challenge(R, m, v.Public)
+	s := c.Mul(c, v.x)
+	s.Add(s, k)
+	return signature(R, s.Mod(s, group.Order()))
+}
+
+/*
+Check a candidate private key against the public key
+*/
+func IsPrivateKey(pk *schnorr.PublicKey, x *big.Int) bool {
+	return x != nil && pk.Group().Equal(pk.Group().ScalarBaseMult(x), pk.X)
+}
+
+/*
+Two signatures with the same nonce k:
+
+	s1 - s2 = (c1 - c2) * x   =>   x = (s1 - s2) / (c1 - c2) mod n
+*/
+func RecoverFromNonceReuse(group schnorr.Group, a, b Sample) (*big.Int, error) {
+	return RecoverFromRelatedNonces(group, a, b, big.NewInt(1), new(big.Int))
+}
+
+/*
+Two signatures whose nonces satisfy k_b = factor * k_a + offset:
+
+	s_b - factor*s_a - offset = (c_b - factor*c_a) * x
+*/
+func RecoverFromRelatedNonces(group schnorr.Group, a, b Sample, factor, offset *big.Int) (*big.Int, error) {
+	n := group.Order()
+
+	num := new(big.Int).Mul(factor, a.S)
+	num.Sub(b.S, num)
+	num.Sub(num, offset)
+
+	den := new(big.Int).Mul(factor, a.C)
+	den.Sub(b.C, den)
+	if den.Mod(den, n).Sign() == 0 {
+		return nil, ErrNotApplicable
+	}
+
+	x := num.Mul(num, den.ModInverse(den, n))
+	return x.Mod(x, n), nil
+}
+
+/*
+Encoding of an element the attacks computed, the identity only comes up with
+negligible probability
+*/
+func encode(group schnorr.Group, e schnorr.Element) []byte {
+	b, err := group.Encode(e)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func signature(R []byte, s *big.Int) *schnorr.Signature {
+	signature, err := schnorr.NewSignature(R, s)
+	if err != nil {
+		panic(err)
+	}
+	return signature
+}
+
+func randomScalar(n *big.Int) *big.Int {
+	for {
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			panic(err)
+		}
+		if k.Sign() != 0 {
+			return k
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package attacks
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Runnable demonstrations of the attacks by name, used by `schnorr attack`
+*/
+var Demos = map[string]func(w io.Writer) error{
+	"nonce-reuse":    DemoNonceReuse,
+	"related-nonces": DemoRelatedNonces,
+	"biased-nonces":  DemoBiasedNonces,
+	"ros":            DemoROS,
+}
+
+func DemoNames() []string {
+	names := make([]string, 0, len(Demos))
+	for name := range Demos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+Victim signs two messages with the same nonce
+*/
+func DemoNonceReuse(w io.Writer) error {
+	victim := NewVictim(schnorr.Secp256k1())
+	k := randomScalar(victim.Public.Group().Order())
+
+	m1, m2 := "transfer 10 to alice", "transfer 10 to bob"
+	a := Observe(victim.Public, m1, victim.SignWithNonce(m1, k))
+	b := Observe(victim.Public, m2, victim.SignWithNonce(m2, k))
+	fmt.Fprintf(w, "victim signed %q and %q with the same nonce\n", m1, m2)
+
+	x, err := RecoverFromNonceReuse(victim.Public.Group(), a, b)
+	if err != nil {
+		return err
+	}
+	return report(w, victim.Public, x)
+}
+
+/*
+Victim derives nonces from a linear congruential generator with known constants
+*/
+func DemoRelatedNonces(w io.Writer) error {
+	victim := NewVictim(schnorr.Secp256k1())
+	n := victim.Public.Group().Order()
+	factor, offset := big.NewInt(6364136223846793005), big.NewInt(1442695040888963407)
+
+	k1 := randomScalar(n)
+	k2 := new(big.Int).Mul(k1, factor)
+	k2.Add(k2, offset)
+	k2.Mod(k2, n)
+
+	m1, m2 := "first message", "second message"
+	a := Observe(victim.Public, m1, victim.SignWithNonce(m1, k1))
+	b := Observe(victim.Public, m2, victim.SignWithNonce(m2, k2))
+	fmt.Fprintf(w, "victim signed two messages with nonces k2 = %v*k1 + %v\n", factor, offset)
+
+	x, err := RecoverFromRelatedNonces(victim.Public.Group(), a, b, factor, offset)
+	if err != nil {
+		return err
+	}
+	return report(w, victim.Public, x)
+}
+
+/*
+Victim's nonces have their top 64 bits set to zero
+*/
+func DemoBiasedNonces(w io.Writer) error {
+	const nonceBits, count = 192, 8
+	victim := NewVictim(schnorr.Secp256k1())
+	bound := new(big.Int).Lsh(big.NewInt(1), nonceBits)
+
+	samples := make([]Sample, count)
+	for i := range samples {
+		m := fmt.Sprintf("message %d", i)
+		samples[i] = Observe(victim.Public, m, victim.SignWithNonce(m, randomScalar(bound)))
+	}
+	fmt.Fprintf(w, "victim signed %d messages with %d-bit nonces (%d-bit group order)\n",
+		count, nonceBits, victim.Public.Group().Order().BitLen())
+
+	x, err := RecoverFromBiasedNonces(victim.Public, samples, nonceBits)
+	if err != nil {
+		return err
+	}
+	return report(w, victim.Public, x)
+}
+
+/*
+User runs ℓ concurrent blind sessions and gets ℓ+1 signatures
+*/
+func DemoROS(w io.Writer) error {
+	server := NewBlindServer(schnorr.Secp256k1())
+	forgeries, err := ROSAttack(server, "one signature more than the server issued")
+	if err != nil {
+		return err
+	}
+
+	valid := 0
+	for _, f := range forgeries {
+		if schnorr.VerifySignature(f.Message, f.Signature, server.Public) {
+			valid++
+		}
+	}
+	fmt.Fprintf(w, "server answered %d blind sessions\n", server.Issued)
+	fmt.Fprintf(w, "user holds %d valid signatures, including one of %q\n", valid, forgeries[len(forgeries)-1].Message)
+	if valid <= server.Issued {
+		return ErrNotRecovered
+	}
+	return nil
+}
+
+func report(w io.Writer, pk *schnorr.PublicKey, x *big.Int) error {
+	if !IsPrivateKey(pk, x) {
+		return ErrNotRecovered
+	}
+	fmt.Fprintf(w, "recovered private key %x, it matches the public key\n", x)
+	fmt.Fprintln(w, "the attacker can now sign anything")
+	return nil
+}
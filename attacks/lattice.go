@@ -0,0 +1,183 @@
+package attacks
+
+import (
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Recover the key from signatures whose nonces are shorter than the group order,
+k_i < 2^nonceBits. Each sample gives k_i = s_i - c_i*x mod n, a hidden number
+problem which is solved by finding the short vector (k_1..k_m, x*K/n, K) with
+K = 2^nonceBits in the lattice spanned by (scaled by n to stay in integers)
+
+	n*e_i                      for i = 1..m
+	(-c_1..-c_m, K/n, 0)
+	(s_1..s_m, 0, K)
+
+Roughly m > log2(n) / (log2(n) - nonceBits) samples are needed, a few more make
+the recovery reliable. LLL over exact rationals is slow, keep m below ~20.
+*/
+func RecoverFromBiasedNonces(pk *schnorr.PublicKey, samples []Sample, nonceBits int) (*big.Int, error) {
+	n := pk.Group().Order()
+	m := len(samples)
+	if m < 2 || nonceBits <= 0 || nonceBits >= n.BitLen() {
+		return nil, ErrNotApplicable
+	}
+	K := new(big.Int).Lsh(big.NewInt(1), uint(nonceBits))
+	n2 := new(big.Int).Mul(n, n)
+	Kn := new(big.Int).Mul(K, n)
+
+	basis := make([][]*big.Int, m+2)
+	for i := range basis {
+		basis[i] = make([]*big.Int, m+2)
+		for j := range basis[i] {
+			basis[i][j] = new(big.Int)
+		}
+	}
+	for i, sample := range samples {
+		basis[i][i].Set(n2)
+		t := new(big.Int).Neg(sample.C)
+		basis[m][i].Mul(t.Mod(t, n), n)
+		basis[m+1][i].Mul(sample.S, n)
+	}
+	basis[m][m].Set(K)
+	basis[m+1][m+1].Set(Kn)
+
+	lll(basis)
+
+	// the short vector is (k_i*n, x*K, ±K*n) up to sign
+	negKn := new(big.Int).Neg(Kn)
+	for _, row := range basis {
+		var x *big.Int
+		switch {
+		case row[m+1].Cmp(Kn) == 0:
+			x = new(big.Int).Set(row[m])
+		case row[m+1].Cmp(negKn) == 0:
+			x = new(big.Int).Neg(row[m])
+		default:
+			continue
+		}
+		if new(big.Int).Mod(x, K).Sign() != 0 {
+			continue
+		}
+		x.Div(x, K)
+		if x.Mod(x, n); IsPrivateKey(pk, x) {
+			return x, nil
+		}
+	}
+	return nil, ErrNotRecovered
+}
+
+/*
+Lenstra-Lenstra-Lovász reduction of the rows of b in place (delta = 3/4).
+Gram-Schmidt data is kept in exact rationals, which is simple and fast enough
+for the small dimensions used here.
+*/
+func lll(b [][]*big.Int) {
+	delta := big.NewRat(3, 4)
+	mu, norms := gramSchmidt(b)
+	for k := 1; k < len(b); {
+		for j := k - 1; j >= 0; j-- {
+			q := round(mu[k][j])
+			if q.Sign() == 0 {
+				continue
+			}
+			for i := range b[k] {
+				b[k][i].Sub(b[k][i], new(big.Int).Mul(q, b[j][i]))
+			}
+			qr := new(big.Rat).SetInt(q)
+			for i := 0; i < j; i++ {
+				mu[k][i].Sub(mu[k][i], new(big.Rat).Mul(qr, mu[j][i]))
+			}
+			mu[k][j].Sub(mu[k][j], qr)
+		}
+
+		// Lovász condition |b*_k|² >= (delta - mu²) |b*_{k-1}|²
+		bound := new(big.Rat).Mul(mu[k][k-1], mu[k][k-1])
+		bound.Sub(delta, bound)
+		bound.Mul(bound, norms[k-1])
+		if norms[k].Cmp(bound) >= 0 {
+			k++
+			continue
+		}
+		swap(b, mu, norms, k)
+		if k > 1 {
+			k--
+		}
+	}
+}
+
+/*
+Swap rows k-1 and k and update the Gram-Schmidt data (Cohen, Algorithm 2.6.3)
+*/
+func swap(b [][]*big.Int, mu [][]*big.Rat, norms []*big.Rat, k int) {
+	b[k], b[k-1] = b[k-1], b[k]
+	for j := 0; j < k-1; j++ {
+		mu[k][j], mu[k-1][j] = mu[k-1][j], mu[k][j]
+	}
+
+	m := mu[k][k-1]
+	B := new(big.Rat).Mul(m, m)
+	B.Mul(B, norms[k-1])
+	B.Add(B, norms[k])
+	mu[k][k-1] = new(big.Rat).Mul(m, norms[k-1])
+	mu[k][k-1].Quo(mu[k][k-1], B)
+	norms[k].Mul(norms[k], norms[k-1])
+	norms[k].Quo(norms[k], B)
+	norms[k-1] = B
+
+	for i := k + 1; i < len(b); i++ {
+		t := mu[i][k]
+		mu[i][k] = new(big.Rat).Mul(m, t)
+		mu[i][k].Sub(mu[i][k-1], mu[i][k])
+		mu[i][k-1] = new(big.Rat).Mul(mu[k][k-1], mu[i][k])
+		mu[i][k-1].Add(mu[i][k-1], t)
+	}
+}
+
+/*
+Coefficients mu[i][j] = <b_i, b*_j> / |b*_j|² and squared norms |b*_i|²
+*/
+func gramSchmidt(b [][]*big.Int) ([][]*big.Rat, []*big.Rat) {
+	d := len(b)
+	star := make([][]*big.Rat, d)
+	mu := make([][]*big.Rat, d)
+	norms := make([]*big.Rat, d)
+	for i := range b {
+		star[i] = make([]*big.Rat, len(b[i]))
+		for j, v := range b[i] {
+			star[i][j] = new(big.Rat).SetInt(v)
+		}
+		mu[i] = make([]*big.Rat, d)
+		for j := 0; j < i; j++ {
+			mu[i][j] = dot(b[i], star[j])
+			mu[i][j].Quo(mu[i][j], norms[j])
+			for l := range star[i] {
+				star[i][l].Sub(star[i][l], new(big.Rat).Mul(mu[i][j], star[j][l]))
+			}
+		}
+		norms[i] = new(big.Rat)
+		for _, v := range star[i] {
+			norms[i].Add(norms[i], new(big.Rat).Mul(v, v))
+		}
+	}
+	return mu, norms
+}
+
+func dot(a []*big.Int, b []*big.Rat) *big.Rat {
+	sum := new(big.Rat)
+	for i := range a {
+		sum.Add(sum, new(big.Rat).Mul(new(big.Rat).SetInt(a[i]), b[i]))
+	}
+	return sum
+}
+
+/*
+Nearest integer, halves rounded up
+*/
+func round(r *big.Rat) *big.Int {
+	half := new(big.Rat).Add(r, big.NewRat(1, 2))
+	return new(big.Int).Div(half.Num(), half.Denom())
+}
@@ -0,0 +1,153 @@
+package attacks
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+ROS attack (Benhamouda, Lepoint, Loss, Orrù, Raykova 2020) against blind
+Schnorr signatures with sessions which may run concurrently.
+
+A user who opens ℓ = log2(n) sessions before answering any of them prepares
+two blinded challenges c_i^0, c_i^1 per session and picks the weights
+ρ_i = 2^i / (c_i^1 - c_i^0). Every sum Σ ρ_i c_i^{b_i} equals
+Σ ρ_i c_i^0 + Σ b_i 2^i, so the bits of c* - Σ ρ_i c_i^0 select the challenges
+for which s* = Σ ρ_i s_i is the response of the nonce R* = Σ ρ_i R_i to the
+challenge c* of an extra message. The signer answers ℓ sessions and the user
+ends up with ℓ+1 valid signatures.
+
+Countermeasures: limit or serialize concurrent sessions, or use a protocol
+designed for concurrency (e.g. the two-nonce flow of schnorr.TwoPartyKey).
+*/
+
+var ErrSession = errors.New("attacks: unknown or finished signing session")
+
+/*
+Naive blind signing server: it commits to a nonce per session and answers any
+challenge of the session once, running any number of sessions in parallel
+*/
+type BlindServer struct {
+	Public *schnorr.PublicKey
+	x      *big.Int
+	nonces map[int]*big.Int
+	next   int
+	Issued int // number of answered sessions
+}
+
+func NewBlindServer(group schnorr.Group) *BlindServer {
+	victim := NewVictim(group)
+	return &BlindServer{Public: victim.Public, x: victim.x, nonces: map[int]*big.Int{}}
+}
+
+/*
+Open a session, returns its id and the nonce commitment R = r*G
+*/
+func (s *BlindServer) Commit() (int, schnorr.Element) {
+	r := randomScalar(s.Public.Group().Order())
+	id := s.next
+	s.next++
+	s.nonces[id] = r
+	return id, s.Public.Group().ScalarBaseMult(r)
+}
+
+/*
+Answer the blinded challenge c of the session with s = r + c*x mod n
+*/
+func (s *BlindServer) Respond(id int, c *big.Int) (*big.Int, error) {
+	r, ok := s.nonces[id]
+	if !ok {
+		return nil, ErrSession
+	}
+	delete(s.nonces, id)
+	s.Issued++
+	response := new(big.Int).Mul(c, s.x)
+	response.Add(response, r)
+	return response.Mod(response, s.Public.Group().Order()), nil
+}
+
+/*
+Signature together with its message
+*/
+type Forgery struct {
+	Message   string
+	Signature *schnorr.Signature
+}
+
+/*
+Run the ROS attack against the server: open ℓ = log2(n) sessions at once and
+obtain ℓ+1 valid signatures, the last one of target
+*/
+func ROSAttack(server *BlindServer, target string) ([]Forgery, error) {
+	group := server.Public.Group()
+	n := group.Order()
+	l := n.BitLen()
+
+	ids := make([]int, l)
+	nonces := make([]schnorr.Element, l)
+	for i := range ids {
+		ids[i], nonces[i] = server.Commit()
+	}
+
+	// two blinded candidates per session, R_i^b = R_i + α_i^b * G
+	type candidate struct {
+		message string
+		alpha   *big.Int
+		R       []byte
+		c       *big.Int
+	}
+	candidates := make([][2]candidate, l)
+	rho := make([]*big.Int, l)
+	Rstar := schnorr.Element(nil)
+	offset := new(big.Int)
+	for i := range candidates {
+		for b := range candidates[i] {
+			alpha := randomScalar(n)
+			message := fmt.Sprintf("ros session %d candidate %d", i, b)
+			R := encode(group, group.Add(nonces[i], group.ScalarBaseMult(alpha)))
+			candidates[i][b] = candidate{message, alpha, R, schnorr.Challenge(R, message, server.Public)}
+		}
+
+		// ρ_i = 2^i / (c_i^1 - c_i^0)
+		diff := new(big.Int).Sub(candidates[i][1].c, candidates[i][0].c)
+		if diff.Mod(diff, n).Sign() == 0 {
+			return nil, ErrNotApplicable
+		}
+		rho[i] = new(big.Int).Lsh(big.NewInt(1), uint(i))
+		rho[i].Mul(rho[i], diff.ModInverse(diff, n))
+		rho[i].Mod(rho[i], n)
+
+		offset.Add(offset, new(big.Int).Mul(rho[i], candidates[i][0].c))
+		if term := group.ScalarMult(nonces[i], rho[i]); Rstar == nil {
+			Rstar = term
+		} else {
+			Rstar = group.Add(Rstar, term)
+		}
+	}
+
+	// bits of c* - Σ ρ_i c_i^0 < 2^ℓ select the candidates
+	encodedRstar := encode(group, Rstar)
+	cStar := schnorr.Challenge(encodedRstar, target, server.Public)
+	bits := new(big.Int).Sub(cStar, offset)
+	bits.Mod(bits, n)
+
+	forgeries := make([]Forgery, 0, l+1)
+	sStar := new(big.Int)
+	for i, id := range ids {
+		chosen := candidates[i][bits.Bit(i)]
+		s, err := server.Respond(id, chosen.c)
+		if err != nil {
+			return nil, err
+		}
+		sStar.Add(sStar, new(big.Int).Mul(rho[i], s))
+
+		// unblind the regular signature of the session
+		unblinded := new(big.Int).Add(s, chosen.alpha)
+		forgeries = append(forgeries, Forgery{chosen.message, signature(chosen.R, unblinded.Mod(unblinded, n))})
+	}
+	forgeries = append(forgeries, Forgery{target, signature(encodedRstar, sStar.Mod(sStar, n))})
+	return forgeries, nil
+}
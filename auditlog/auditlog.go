@@ -0,0 +1,446 @@
+/*
+Append-only signed log for audit trails.
+
+Every entry appended to a SignedLog extends a hash chain and a Merkle tree
+(RFC 9162, the tree of Certificate Transparency):
+
+	leaf_i  = SHA256(0x00 || entry_i)
+	node    = SHA256(0x01 || left || right)
+	chain_i = SHA256(0x02 || chain_(i-1) || leaf_i),  chain_0 = 32 zero bytes
+
+Periodically (every sealEvery entries and on Seal) the log signs a tree head
+with the log name, size, Merkle root, chain head and time. Auditors keep the
+heads they have seen and check with proofs, without the other entries, that
+
+  - an entry is in the log at a given position (InclusionProof, VerifyInclusion),
+  - a later head extends an earlier one, i.e. nothing before it was changed
+    or removed (ConsistencyProof, VerifyConsistency).
+
+Auditors with a copy of all entries replay the chain and the tree against
+every signed head (Audit). The log is kept in memory, Entries and Heads
+export it for storage.
+*/
+package auditlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrIndexOutOfRange = errors.New("auditlog: index or size out of range")
+	ErrInvalidProof    = errors.New("auditlog: proof doesn't verify")
+	ErrBadSignature    = errors.New("auditlog: invalid tree head signature")
+	ErrInvalidHead     = errors.New("auditlog: invalid tree head encoding")
+	ErrTampered        = errors.New("auditlog: entries don't match a signed tree head")
+)
+
+/*
+Signed state of the log after Size entries
+*/
+type TreeHead struct {
+	Log       string // name of the log
+	Size      uint64
+	Root      []byte // Merkle tree hash of the first Size entries
+	Chain     []byte // hash chain after Size entries
+	Timestamp time.Time
+	KeyID     string
+	Signature *schnorr.Signature
+}
+
+/*
+Signed message: "schnorr/auditlog" || len(log) || log || size || root || chain || timestamp (unix nanoseconds)
+*/
+func (h *TreeHead) message() string {
+	b := append([]byte("schnorr/auditlog"), binary.BigEndian.AppendUint32(nil, uint32(len(h.Log)))...)
+	b = append(b, h.Log...)
+	b = binary.BigEndian.AppendUint64(b, h.Size)
+	b = append(b, h.Root...)
+	b = append(b, h.Chain...)
+	return string(binary.BigEndian.AppendUint64(b, uint64(h.Timestamp.UnixNano())))
+}
+
+/*
+Check the signature of the head with the log's public key
+*/
+func (h *TreeHead) Verify(pk *schnorr.PublicKey) error {
+	if len(h.Root) != sha256.Size || len(h.Chain) != sha256.Size || h.Signature == nil {
+		return ErrInvalidHead
+	}
+	if h.KeyID != pk.KeyID() || !schnorr.Verify(h.message(), h.Signature, pk) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+/*
+Encoding: the signed message without the domain tag, then len(key ID) || key ID || signature
+*/
+func (h *TreeHead) Bytes() []byte {
+	b := []byte(h.message()[len("schnorr/auditlog"):])
+	b = binary.BigEndian.AppendUint16(b, uint16(len(h.KeyID)))
+	b = append(b, h.KeyID...)
+	return append(b, h.Signature.Bytes()...)
+}
+
+func ParseTreeHead(b []byte) (*TreeHead, error) {
+	if len(b) < 4 {
+		return nil, ErrInvalidHead
+	}
+	n := int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if len(b) < n+8+2*sha256.Size+8+2 {
+		return nil, ErrInvalidHead
+	}
+	h := &TreeHead{Log: string(b[:n])}
+	b = b[n:]
+	h.Size = binary.BigEndian.Uint64(b)
+	h.Root = append([]byte(nil), b[8:8+sha256.Size]...)
+	h.Chain = append([]byte(nil), b[8+sha256.Size:8+2*sha256.Size]...)
+	b = b[8+2*sha256.Size:]
+	h.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(b))).UTC()
+	b = b[8:]
+	k := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+k {
+		return nil, ErrInvalidHead
+	}
+	h.KeyID = string(b[2 : 2+k])
+	signature, err := schnorr.ParseSignature(b[2+k:])
+	if err != nil {
+		return nil, ErrInvalidHead
+	}
+	h.Signature = signature
+	return h, nil
+}
+
+type SignedLog struct {
+	name      string
+	sk        *schnorr.SignatureKey
+	pk        *schnorr.PublicKey
+	sealEvery int
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries [][]byte
+	leaves  [][]byte
+	chain   []byte
+	heads   []*TreeHead
+}
+
+/*
+Empty log signed with the key, a head is sealed automatically every sealEvery
+entries (never for sealEvery <= 0)
+*/
+func NewSignedLog(name string, sk *schnorr.SignatureKey, pk *schnorr.PublicKey, sealEvery int) *SignedLog {
+	return &SignedLog{name: name, sk: sk, pk: pk, sealEvery: sealEvery, now: schnorr.Now, chain: make([]byte, sha256.Size)}
+}
+
+/*
+Append the entry and return its index, the returned head is non-nil when
+the append sealed a new head
+*/
+func (l *SignedLog) Append(entry []byte) (uint64, *TreeHead, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	leaf := leafHash(entry)
+	l.entries = append(l.entries, append([]byte(nil), entry...))
+	l.leaves = append(l.leaves, leaf)
+	l.chain = chainHash(l.chain, leaf)
+	index := uint64(len(l.entries) - 1)
+
+	if l.sealEvery > 0 && len(l.entries)%l.sealEvery == 0 {
+		head, err := l.seal()
+		return index, head, err
+	}
+	return index, nil, nil
+}
+
+/*
+Sign a head for the current size
+*/
+func (l *SignedLog) Seal() (*TreeHead, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seal()
+}
+
+func (l *SignedLog) seal() (*TreeHead, error) {
+	h := &TreeHead{
+		Log:       l.name,
+		Size:      uint64(len(l.leaves)),
+		Root:      merkleRoot(l.leaves),
+		Chain:     append([]byte(nil), l.chain...),
+		Timestamp: l.now().UTC(),
+		KeyID:     l.pk.KeyID(),
+	}
+	signature, err := schnorr.TrySign(h.message(), l.sk)
+	if err != nil {
+		return nil, err
+	}
+	h.Signature = signature
+	l.heads = append(l.heads, h)
+	return h, nil
+}
+
+func (l *SignedLog) Size() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return uint64(len(l.entries))
+}
+
+func (l *SignedLog) Entry(index uint64) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if index >= uint64(len(l.entries)) {
+		return nil, ErrIndexOutOfRange
+	}
+	return append([]byte(nil), l.entries[index]...), nil
+}
+
+/*
+Copy of all entries in order
+*/
+func (l *SignedLog) Entries() [][]byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([][]byte, len(l.entries))
+	for i, e := range l.entries {
+		entries[i] = append([]byte(nil), e...)
+	}
+	return entries
+}
+
+/*
+Sealed heads in order, the latest last
+*/
+func (l *SignedLog) Heads() []*TreeHead {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*TreeHead(nil), l.heads...)
+}
+
+/*
+Audit path of the entry at index in the tree of the first size entries
+*/
+func (l *SignedLog) InclusionProof(index, size uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if index >= size || size > uint64(len(l.leaves)) {
+		return nil, ErrIndexOutOfRange
+	}
+	return inclusionPath(index, l.leaves[:size]), nil
+}
+
+/*
+Proof that the tree of newSize entries extends the tree of oldSize entries
+*/
+func (l *SignedLog) ConsistencyProof(oldSize, newSize uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if oldSize > newSize || newSize > uint64(len(l.leaves)) {
+		return nil, ErrIndexOutOfRange
+	}
+	if oldSize == 0 || oldSize == newSize {
+		return nil, nil
+	}
+	return subproof(oldSize, l.leaves[:newSize], true), nil
+}
+
+/*
+Check that entry is at index of the tree signed by head (RFC 9162, 2.1.3.2)
+*/
+func VerifyInclusion(entry []byte, index uint64, proof [][]byte, head *TreeHead) error {
+	if index >= head.Size {
+		return ErrIndexOutOfRange
+	}
+	fn, sn := index, head.Size-1
+	r := leafHash(entry)
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, head.Root) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+/*
+Check that the tree of newer extends the tree of older (RFC 9162, 2.1.4.2).
+Both heads should have been verified with the log's key.
+*/
+func VerifyConsistency(older, newer *TreeHead, proof [][]byte) error {
+	switch {
+	case older.Log != newer.Log || older.Size > newer.Size:
+		return ErrInvalidProof
+	case older.Size == newer.Size:
+		if len(proof) != 0 || !bytes.Equal(older.Root, newer.Root) {
+			return ErrInvalidProof
+		}
+		return nil
+	case older.Size == 0:
+		return nil
+	}
+
+	if older.Size&(older.Size-1) == 0 {
+		proof = append([][]byte{older.Root}, proof...)
+	}
+	if len(proof) == 0 {
+		return ErrInvalidProof
+	}
+	fn, sn := older.Size-1, newer.Size-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(fr, older.Root) || !bytes.Equal(sr, newer.Root) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+/*
+Replay the complete log: every head has to be signed by pk and match the
+chain and the tree of the entries up to its size
+*/
+func Audit(entries [][]byte, heads []*TreeHead, pk *schnorr.PublicKey) error {
+	leaves := make([][]byte, 0, len(entries))
+	chains := make([][]byte, 0, len(entries)+1)
+	chain := make([]byte, sha256.Size)
+	chains = append(chains, chain)
+	for _, e := range entries {
+		leaf := leafHash(e)
+		leaves = append(leaves, leaf)
+		chain = chainHash(chain, leaf)
+		chains = append(chains, chain)
+	}
+
+	for i, h := range heads {
+		if err := h.Verify(pk); err != nil {
+			return fmt.Errorf("head %d: %w", i, err)
+		}
+		if h.Size > uint64(len(entries)) {
+			return fmt.Errorf("%w: head %d covers %d entries, %d given", ErrTampered, i, h.Size, len(entries))
+		}
+		if !bytes.Equal(h.Chain, chains[h.Size]) || !bytes.Equal(h.Root, merkleRoot(leaves[:h.Size])) {
+			return fmt.Errorf("%w: head %d (size %d)", ErrTampered, i, h.Size)
+		}
+	}
+	return nil
+}
+
+func leafHash(entry []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(entry)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func chainHash(chain, leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{2})
+	h.Write(chain)
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+/*
+MTH of the leaves, SHA256() of nothing for the empty tree
+*/
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	case 1:
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return nodeHash(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+/*
+PATH(m, D[n])
+*/
+func inclusionPath(m uint64, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := uint64(split(len(leaves)))
+	if m < k {
+		return append(inclusionPath(m, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+	return append(inclusionPath(m-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
+
+/*
+SUBPROOF(m, D[n], b)
+*/
+func subproof(m uint64, leaves [][]byte, complete bool) [][]byte {
+	n := uint64(len(leaves))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{merkleRoot(leaves)}
+	}
+	k := uint64(split(len(leaves)))
+	if m <= k {
+		return append(subproof(m, leaves[:k], complete), merkleRoot(leaves[k:]))
+	}
+	return append(subproof(m-k, leaves[k:], false), merkleRoot(leaves[:k]))
+}
+
+/*
+Largest power of two smaller than n, n > 1
+*/
+func split(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
@@ -0,0 +1,232 @@
+package auditlog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Log of n entries sealing a head every 3 entries, with a manual clock
+*/
+func filled(t *testing.T, n int) (*SignedLog, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewSignedLog("audit.example.com", sk, pk, 3)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time {
+		at = at.Add(time.Second)
+		return at
+	}
+	for i := 0; i < n; i++ {
+		index, head, err := l.Append([]byte(fmt.Sprintf("entry %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != uint64(i) || (head != nil) != ((i+1)%3 == 0) {
+			t.Fatalf("append %d: index %d, head %v", i, index, head)
+		}
+	}
+	return l, pk
+}
+
+func TestInclusion(t *testing.T) {
+	l, pk := filled(t, 11)
+	for size := uint64(1); size <= l.Size(); size++ {
+		head := &TreeHead{Size: size, Root: merkleRoot(l.leaves[:size])}
+		for index := uint64(0); index < size; index++ {
+			proof, err := l.InclusionProof(index, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry, err := l.Entry(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyInclusion(entry, index, proof, head); err != nil {
+				t.Fatalf("entry %d of %d: %v", index, size, err)
+			}
+			if err := VerifyInclusion([]byte("forged"), index, proof, head); err != ErrInvalidProof {
+				t.Errorf("forged entry %d of %d: %v", index, size, err)
+			}
+			if size > 1 {
+				if err := VerifyInclusion(entry, (index+1)%size, proof, head); err != ErrInvalidProof {
+					t.Errorf("entry %d of %d at another index: %v", index, size, err)
+				}
+			}
+		}
+	}
+
+	head, err := l.Seal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := head.Verify(pk); err != nil {
+		t.Fatal(err)
+	}
+	proof, err := l.InclusionProof(4, head.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyInclusion([]byte("entry 4"), 4, proof[:len(proof)-1], head); err != ErrInvalidProof {
+		t.Errorf("truncated proof: %v", err)
+	}
+	if err := VerifyInclusion([]byte("entry 4"), 4, append(proof, proof[0]), head); err != ErrInvalidProof {
+		t.Errorf("extended proof: %v", err)
+	}
+	if err := VerifyInclusion([]byte("entry 4"), head.Size, proof, head); err != ErrIndexOutOfRange {
+		t.Errorf("index past the head: %v", err)
+	}
+	if _, err := l.InclusionProof(3, 3); err != ErrIndexOutOfRange {
+		t.Errorf("proof for an index past the size: %v", err)
+	}
+	if _, err := l.InclusionProof(0, 12); err != ErrIndexOutOfRange {
+		t.Errorf("proof for a size past the log: %v", err)
+	}
+	if _, err := l.Entry(11); err != ErrIndexOutOfRange {
+		t.Errorf("entry past the log: %v", err)
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	l, _ := filled(t, 9)
+	head := func(size uint64) *TreeHead {
+		return &TreeHead{Log: "audit.example.com", Size: size, Root: merkleRoot(l.leaves[:size])}
+	}
+	for newSize := uint64(0); newSize <= l.Size(); newSize++ {
+		for oldSize := uint64(0); oldSize <= newSize; oldSize++ {
+			proof, err := l.ConsistencyProof(oldSize, newSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyConsistency(head(oldSize), head(newSize), proof); err != nil {
+				t.Fatalf("%d to %d: %v", oldSize, newSize, err)
+			}
+			if oldSize == 0 || oldSize == newSize {
+				continue
+			}
+			// an older tree with a changed entry isn't extended by the newer one
+			changed := head(oldSize)
+			changed.Root = merkleRoot(append(append([][]byte(nil), l.leaves[:oldSize-1]...), leafHash([]byte("changed"))))
+			if err := VerifyConsistency(changed, head(newSize), proof); err != ErrInvalidProof {
+				t.Errorf("%d to %d with a changed entry: %v", oldSize, newSize, err)
+			}
+			if len(proof) > 0 {
+				if err := VerifyConsistency(head(oldSize), head(newSize), proof[:len(proof)-1]); err != ErrInvalidProof {
+					t.Errorf("%d to %d with a truncated proof: %v", oldSize, newSize, err)
+				}
+			}
+		}
+	}
+
+	if err := VerifyConsistency(head(5), head(4), nil); err != ErrInvalidProof {
+		t.Errorf("shrunk log: %v", err)
+	}
+	other := head(6)
+	other.Log = "other"
+	if err := VerifyConsistency(head(4), other, nil); err != ErrInvalidProof {
+		t.Errorf("heads of different logs: %v", err)
+	}
+	forked := head(4)
+	forked.Root = leafHash([]byte("fork"))
+	if err := VerifyConsistency(head(4), forked, nil); err != ErrInvalidProof {
+		t.Errorf("heads of the same size with different roots: %v", err)
+	}
+	if _, err := l.ConsistencyProof(5, 4); err != ErrIndexOutOfRange {
+		t.Errorf("proof for a shrunk log: %v", err)
+	}
+	if _, err := l.ConsistencyProof(4, 10); err != ErrIndexOutOfRange {
+		t.Errorf("proof past the log: %v", err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	l, pk := filled(t, 10)
+	if _, err := l.Seal(); err != nil {
+		t.Fatal(err)
+	}
+	entries, heads := l.Entries(), l.Heads()
+	if len(heads) != 4 || heads[3].Size != 10 {
+		t.Fatalf("%d heads", len(heads))
+	}
+	if err := Audit(entries, heads, pk); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := l.Entries()
+	changed[4] = []byte("entry 4, rewritten")
+	if err := Audit(changed, heads, pk); !errors.Is(err, ErrTampered) {
+		t.Errorf("changed entry: %v", err)
+	}
+	if err := Audit(entries[:9], heads, pk); !errors.Is(err, ErrTampered) {
+		t.Errorf("removed entry: %v", err)
+	}
+	reordered := l.Entries()
+	reordered[0], reordered[1] = reordered[1], reordered[0]
+	if err := Audit(reordered, heads, pk); !errors.Is(err, ErrTampered) {
+		t.Errorf("reordered entries: %v", err)
+	}
+
+	// a rewritten head no longer carries the log's signature
+	forged := *heads[1]
+	forged.Size = 5
+	if err := Audit(entries, []*TreeHead{&forged}, pk); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("forged head: %v", err)
+	}
+	_, other, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Audit(entries, heads, other); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("heads checked with another key: %v", err)
+	}
+}
+
+func TestTreeHeadEncoding(t *testing.T) {
+	l, pk := filled(t, 3)
+	head := l.Heads()[0]
+	parsed, err := ParseTreeHead(head.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Verify(pk); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Log != head.Log || parsed.Size != 3 || !parsed.Timestamp.Equal(head.Timestamp) || parsed.KeyID != pk.KeyID() {
+		t.Errorf("parsed head %+v", parsed)
+	}
+
+	b := head.Bytes()
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"log name":  append([]byte{0xff, 0xff, 0xff, 0xff}, b[4:]...),
+		"short":     b[:4+len(head.Log)+8+64],
+		"signature": b[:len(b)-1],
+	} {
+		if _, err := ParseTreeHead(bad); err != ErrInvalidHead {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	changed := append([]byte(nil), b...)
+	changed[4+len(head.Log)+7]++ // size
+	tampered, err := ParseTreeHead(changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tampered.Verify(pk); err != ErrBadSignature {
+		t.Errorf("changed size: %v", err)
+	}
+	if err := (&TreeHead{Root: head.Root, Chain: head.Chain[:31], Signature: head.Signature}).Verify(pk); err != ErrInvalidHead {
+		t.Errorf("short chain: %v", err)
+	}
+	if err := (&TreeHead{Root: head.Root, Chain: head.Chain}).Verify(pk); err != ErrInvalidHead {
+		t.Errorf("unsigned head: %v", err)
+	}
+}
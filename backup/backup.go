@@ -0,0 +1,352 @@
+/*
+Single-file backup of keys, wallet coins and key-ring metadata.
+
+A backup file is encrypted with a passphrase and signed as a whole:
+
+	"SCHNBAK" || format version (1 byte) || salt (16 bytes) || PBKDF2 iterations (4 bytes) ||
+	len(signer key) || signer key || len(ciphertext) || nonce || AES-256-GCM(payload) ||
+	len(signature) || Sign("schnorr/backup" || everything before the signature field)
+
+The key is PBKDF2-HMAC-SHA256 of the passphrase, the header before the
+ciphertext is authenticated as additional data. The signature lets a restore
+detect a modified or truncated file before asking for the passphrase and, with
+a trusted signer key, a backup written by somebody else.
+
+The payload is JSON with a schema version (Schema). Newer schemas are rejected
+by older code with ErrUnsupportedSchema, older ones are upgraded on Open, so a
+restore always returns the current Contents.
+*/
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+	"github.com/miki799/schnorr-signature/tokens"
+)
+
+var (
+	ErrInvalidFormat     = errors.New("backup: not a backup file or unsupported format version")
+	ErrBadSignature      = errors.New("backup: invalid signature, the file was modified")
+	ErrUntrustedSigner   = errors.New("backup: signed by an untrusted key")
+	ErrWrongPassphrase   = errors.New("backup: can't decrypt (wrong passphrase?)")
+	ErrUnsupportedSchema = errors.New("backup: written by a newer version, schema not supported")
+)
+
+const (
+	magic         = "SCHNBAK"
+	formatVersion = 1
+
+	// Current schema of the payload
+	Schema = 1
+
+	// PBKDF2 iterations of new backups
+	DefaultIterations = 600000
+	minIterations     = 10000
+	saltLen           = 16
+)
+
+/*
+Everything a backup holds
+*/
+type Contents struct {
+	Schema  int               `json:"schema"`
+	Created time.Time         `json:"created"`
+	Keys    []Key             `json:"keys"`
+	Tokens  []Token           `json:"tokens,omitempty"`
+	KeyRing map[string]string `json:"keyring,omitempty"` // key-ring metadata, e.g. labels and roles of the keys
+}
+
+/*
+Key pair, named like the CLI's key files (name.pem, name.pub.pem)
+*/
+type Key struct {
+	Name    string `json:"name"`
+	Private []byte `json:"private"` // SignatureKey.MarshalPEM
+	Public  []byte `json:"public"`  // PublicKey.MarshalPEM
+}
+
+/*
+Wallet token, Data in the encoding of the tokens package for the kind
+*/
+type Token struct {
+	Kind string `json:"kind"` // "coin" (tokens.Coin.Bytes)
+	Data []byte `json:"data"`
+}
+
+const KindCoin = "coin"
+
+/*
+Add the key pair under the name
+*/
+func (c *Contents) AddKey(name string, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) error {
+	private, err := sk.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	public, err := pk.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	c.Keys = append(c.Keys, Key{name, private, public})
+	return nil
+}
+
+func (c *Contents) AddCoins(coins ...*tokens.Coin) {
+	for _, coin := range coins {
+		c.Tokens = append(c.Tokens, Token{KindCoin, coin.Bytes()})
+	}
+}
+
+/*
+Coins among the tokens
+*/
+func (c *Contents) Coins() ([]*tokens.Coin, error) {
+	var coins []*tokens.Coin
+	for _, t := range c.Tokens {
+		if t.Kind != KindCoin {
+			continue
+		}
+		coin, err := tokens.ParseCoin(t.Data)
+		if err != nil {
+			return nil, err
+		}
+		coins = append(coins, coin)
+	}
+	return coins, nil
+}
+
+/*
+Parse the key pair
+*/
+func (k *Key) Parse() (*schnorr.SignatureKey, *schnorr.PublicKey, error) {
+	sk, pk, err := schnorr.ParseSignatureKeyPEM(k.Private)
+	if err != nil {
+		return nil, nil, fmt.Errorf("backup: key %s: %w", k.Name, err)
+	}
+	public, err := schnorr.ParsePublicKeyPEM(k.Public)
+	if err != nil || !bytes.Equal(public.Bytes(), pk.Bytes()) {
+		return nil, nil, fmt.Errorf("backup: key %s: public key doesn't match the private key", k.Name)
+	}
+	return sk, pk, nil
+}
+
+/*
+Encrypt the contents with the passphrase and sign the file with sk
+*/
+func Seal(c *Contents, passphrase []byte, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) ([]byte, error) {
+	return seal(c, passphrase, sk, pk, DefaultIterations)
+}
+
+func seal(c *Contents, passphrase []byte, sk *schnorr.SignatureKey, pk *schnorr.PublicKey, iterations uint32) ([]byte, error) {
+	payload := *c
+	payload.Schema = Schema
+	if payload.Created.IsZero() {
+		payload.Created = schnorr.Now().UTC()
+	}
+	plaintext, err := json.Marshal(&payload)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(entropy.Reader, salt); err != nil {
+		return nil, err
+	}
+	b := append([]byte(magic), formatVersion)
+	b = append(b, salt...)
+	b = binary.BigEndian.AppendUint32(b, iterations)
+	b = appendField(b, pk.Bytes())
+
+	aead, err := newCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(entropy.Reader, nonce); err != nil {
+		return nil, err
+	}
+	b = appendField(b, aead.Seal(nonce, nonce, plaintext, b))
+
+	signature, err := schnorr.SignBytes(signedMessage(b), sk)
+	if err != nil {
+		return nil, err
+	}
+	return appendField(b, signature.Bytes()), nil
+}
+
+/*
+Signature and signer of a backup file, checked without the passphrase
+*/
+type Header struct {
+	Signer     *schnorr.PublicKey
+	Iterations uint32
+	salt       []byte
+	aad        []byte // header before the ciphertext
+	ciphertext []byte
+}
+
+/*
+Parse the file and check its signature. With a non-nil trusted key the file
+has to be signed by it, otherwise any signer is accepted and the caller should
+check Header.Signer.
+*/
+func Verify(data []byte, trusted *schnorr.PublicKey) (*Header, error) {
+	if len(data) < len(magic)+1+saltLen+4 || string(data[:len(magic)]) != magic || data[len(magic)] != formatVersion {
+		return nil, ErrInvalidFormat
+	}
+	h := &Header{}
+	b := data[len(magic)+1:]
+	h.salt = b[:saltLen]
+	h.Iterations = binary.BigEndian.Uint32(b[saltLen:])
+	b = b[saltLen+4:]
+
+	key, b, ok := readField(b)
+	if !ok || h.Iterations < minIterations {
+		return nil, ErrInvalidFormat
+	}
+	aadLen := len(data) - len(b)
+	if h.ciphertext, b, ok = readField(b); !ok {
+		return nil, ErrInvalidFormat
+	}
+	signedLen := len(data) - len(b)
+	rawSignature, rest, ok := readField(b)
+	if !ok || len(rest) != 0 {
+		return nil, ErrInvalidFormat
+	}
+	if h.Signer, ok = parseKey(key); !ok {
+		return nil, ErrInvalidFormat
+	}
+	signature, err := schnorr.ParseSignature(rawSignature)
+	if err != nil {
+		return nil, ErrInvalidFormat
+	}
+	if !schnorr.VerifyBytes(signedMessage(data[:signedLen]), signature, h.Signer) {
+		return nil, ErrBadSignature
+	}
+	if trusted != nil && !bytes.Equal(trusted.Bytes(), h.Signer.Bytes()) {
+		return nil, ErrUntrustedSigner
+	}
+	h.aad = data[:aadLen]
+	return h, nil
+}
+
+/*
+Verify the file (see Verify), decrypt it and upgrade the contents to the
+current schema
+*/
+func Open(data, passphrase []byte, trusted *schnorr.PublicKey) (*Contents, *Header, error) {
+	h, err := Verify(data, trusted)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newCipher(passphrase, h.salt, h.Iterations)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(h.ciphertext) < aead.NonceSize() {
+		return nil, nil, ErrInvalidFormat
+	}
+	plaintext, err := aead.Open(nil, h.ciphertext[:aead.NonceSize()], h.ciphertext[aead.NonceSize():], h.aad)
+	if err != nil {
+		return nil, nil, ErrWrongPassphrase
+	}
+	c, err := decode(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, h, nil
+}
+
+/*
+Decode the payload of any supported schema
+*/
+func decode(plaintext []byte) (*Contents, error) {
+	var version struct {
+		Schema int `json:"schema"`
+	}
+	if err := json.Unmarshal(plaintext, &version); err != nil {
+		return nil, fmt.Errorf("backup: malformed contents: %w", err)
+	}
+	switch {
+	case version.Schema > Schema:
+		return nil, fmt.Errorf("%w: schema %d, this version reads up to %d", ErrUnsupportedSchema, version.Schema, Schema)
+	case version.Schema < 1:
+		return nil, fmt.Errorf("backup: malformed contents: schema %d", version.Schema)
+	}
+	// schema 1 is the current one, upgrades of older schemas go here
+	c := new(Contents)
+	if err := json.Unmarshal(plaintext, c); err != nil {
+		return nil, fmt.Errorf("backup: malformed contents: %w", err)
+	}
+	return c, nil
+}
+
+func signedMessage(b []byte) []byte {
+	return append([]byte("schnorr/backup"), b...)
+}
+
+func parseKey(b []byte) (*schnorr.PublicKey, bool) {
+	pk, err := schnorr.ParsePublicKey(b)
+	return pk, err == nil
+}
+
+func newCipher(passphrase, salt []byte, iterations uint32) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2(passphrase, salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/*
+PBKDF2-HMAC-SHA256 (RFC 8018)
+*/
+func pbkdf2(password, salt []byte, iterations uint32, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := uint32(1); i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
@@ -0,0 +1,235 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+	"github.com/miki799/schnorr-signature/tokens"
+)
+
+var passphrase = []byte("correct horse battery staple")
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk
+}
+
+/*
+Backup of a key pair and a coin, signed by the returned key, with few PBKDF2
+iterations to keep the tests fast
+*/
+func sealed(t *testing.T) ([]byte, *schnorr.PublicKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk := keys(t)
+	c := &Contents{KeyRing: map[string]string{"alice": "signing"}}
+	if err := c.AddKey("alice", sk, pk); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := schnorr.TrySign(tokens.Message(3, []byte("serial")), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddCoins(&tokens.Coin{Amount: 5, Token: &tokens.Token{Epoch: 3, Serial: []byte("serial"), Signature: signature}})
+
+	signerSK, signerPK := keys(t)
+	data, err := seal(c, passphrase, signerSK, signerPK, minIterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, pk, signerPK
+}
+
+func TestRoundTrip(t *testing.T) {
+	data, pk, signer := sealed(t)
+	c, h, err := Open(data, passphrase, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Signer.Equal(signer) || h.Iterations != minIterations {
+		t.Errorf("header: signer %s, %d iterations", h.Signer.KeyID(), h.Iterations)
+	}
+	if c.Schema != Schema || c.Created.IsZero() || c.KeyRing["alice"] != "signing" || len(c.Keys) != 1 {
+		t.Fatalf("contents %+v", c)
+	}
+	sk, parsed, err := c.Keys[0].Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Equal(pk) || !schnorr.Verify("restored", mustSign(t, sk), pk) {
+		t.Error("restored key doesn't match")
+	}
+	coins, err := c.Coins()
+	if err != nil || len(coins) != 1 || coins[0].Amount != 5 || coins[0].Epoch != 3 {
+		t.Errorf("restored coins: %v", err)
+	}
+
+	// any signer is accepted without a trusted key
+	if _, _, err := Open(data, passphrase, nil); err != nil {
+		t.Errorf("without trusted key: %v", err)
+	}
+}
+
+func mustSign(t *testing.T, sk *schnorr.SignatureKey) *schnorr.Signature {
+	t.Helper()
+	signature, err := schnorr.TrySign("restored", sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func TestWrongPassphraseOrSigner(t *testing.T) {
+	data, pk, signer := sealed(t)
+	if _, _, err := Open(data, []byte("wrong"), signer); err != ErrWrongPassphrase {
+		t.Errorf("wrong passphrase: %v", err)
+	}
+	if _, err := Verify(data, pk); err != ErrUntrustedSigner {
+		t.Errorf("other trusted key: %v", err)
+	}
+	// the signature is checked without the passphrase
+	if h, err := Verify(data, signer); err != nil || !h.Signer.Equal(signer) {
+		t.Errorf("verify: %v", err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	data, _, signer := sealed(t)
+	for _, at := range []int{len(magic) + 1, len(magic) + 1 + saltLen + 4 + 10, len(data) - 100} {
+		changed := append([]byte(nil), data...)
+		changed[at] ^= 1
+		if _, _, err := Open(changed, passphrase, signer); err != ErrBadSignature && err != ErrInvalidFormat {
+			t.Errorf("byte %d changed: %v", at, err)
+		}
+	}
+
+	// re-signed by somebody else after changing the ciphertext
+	h, err := Verify(data, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSK, otherPK := keys(t)
+	resigned := resign(t, data, h, otherSK, otherPK)
+	if _, _, err := Open(resigned, passphrase, signer); err != ErrUntrustedSigner {
+		t.Errorf("re-signed by another key: %v", err)
+	}
+	if _, _, err := Open(resigned, passphrase, nil); err != ErrWrongPassphrase {
+		t.Errorf("ciphertext with another header: %v", err)
+	}
+}
+
+/*
+The file with the signer key replaced and signed by sk
+*/
+func resign(t *testing.T, data []byte, h *Header, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) []byte {
+	t.Helper()
+	b := append([]byte(nil), data[:len(magic)+1+saltLen+4]...)
+	b = appendField(b, pk.Bytes())
+	b = appendField(b, h.ciphertext)
+	signature, err := schnorr.SignBytes(signedMessage(b), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return appendField(b, signature.Bytes())
+}
+
+func TestMalformed(t *testing.T) {
+	data, _, signer := sealed(t)
+	header := len(magic) + 1 + saltLen
+	weak := append([]byte(nil), data...)
+	copy(weak[header:], []byte{0, 0, 0, 1})
+	for name, bad := range map[string][]byte{
+		"empty":          nil,
+		"magic":          append([]byte("SCHNBAX"), data[len(magic):]...),
+		"format version": append(append([]byte(magic), 2), data[len(magic)+1:]...),
+		"truncated":      data[:len(data)-1],
+		"trailing":       append(append([]byte(nil), data...), 0),
+		"header only":    data[:header+4],
+		"iterations":     weak,
+	} {
+		if _, _, err := Open(bad, passphrase, signer); err != ErrInvalidFormat {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	sk, pk := keys(t)
+	payload := func(schema int) []byte {
+		b, err := json.Marshal(map[string]interface{}{"schema": schema, "created": time.Now(), "keys": []Key{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	// a backup of a newer version, written without Seal's schema
+	newer := encrypt(t, payload(Schema+1), sk, pk)
+	if _, _, err := Open(newer, passphrase, pk); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("newer schema: %v", err)
+	}
+	for name, plaintext := range map[string][]byte{
+		"schema 0": payload(0),
+		"not JSON": []byte("{"),
+	} {
+		if _, _, err := Open(encrypt(t, plaintext, sk, pk), passphrase, pk); err == nil || errors.Is(err, ErrUnsupportedSchema) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if c, _, err := Open(encrypt(t, payload(Schema), sk, pk), passphrase, pk); err != nil || c.Schema != Schema {
+		t.Errorf("current schema: %v", err)
+	}
+}
+
+/*
+Backup file of the raw payload
+*/
+func encrypt(t *testing.T, plaintext []byte, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) []byte {
+	t.Helper()
+	salt := bytes.Repeat([]byte{7}, saltLen)
+	b := append([]byte(magic), formatVersion)
+	b = append(b, salt...)
+	b = append(b, 0, 0, 0x27, 0x10) // minIterations
+	b = appendField(b, pk.Bytes())
+	aead, err := newCipher(passphrase, salt, minIterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	b = appendField(b, aead.Seal(nonce, nonce, plaintext, b))
+	signature, err := schnorr.SignBytes(signedMessage(b), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return appendField(b, signature.Bytes())
+}
+
+/*
+PBKDF2-HMAC-SHA256 test vectors (RFC 7914, section 11, and the common SHA-256 set)
+*/
+func TestPBKDF2(t *testing.T) {
+	for _, test := range []struct {
+		password, salt string
+		iterations     uint32
+		keyLen         int
+		key            string
+	}{
+		{"password", "salt", 1, 32, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, 32, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+			"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+	} {
+		key := pbkdf2([]byte(test.password), []byte(test.salt), test.iterations, test.keyLen)
+		if hex.EncodeToString(key) != test.key {
+			t.Errorf("%s/%s/%d: %x", test.password, test.salt, test.iterations, key)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Verification-only API for other languages.
+
+The package wraps package verifier in types gomobile can bind (Java/Kotlin for
+Android, Objective-C/Swift for iOS), so mobile apps verify what Go services
+sign without reimplementing the math:
+
+	gomobile bind -target=android -javapkg=io.github.miki799 ./bindings
+	gomobile bind -target=ios -prefix=SCH ./bindings
+
+The C ABI for Python and other FFI users is built from bindings/cabi (see
+there). Nothing here generates keys or signs.
+
+Keys and signatures are accepted in every encoding of package schnorr: PEM,
+binary (Bytes) and hex (Hex). Messages are the raw bytes given to
+schnorr.SignBytes, files signed with schnorr.SignReader or the CLI's sign
+command are checked with VerifyFile.
+*/
+package bindings
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+var ErrInvalidEncoding = errors.New("bindings: not a PEM, binary or hex encoded key or signature")
+
+const (
+	pemPublicKey = "SCHNORR PUBLIC KEY" // schnorr.PEMPublicKey
+	pemSignature = "SCHNORR SIGNATURE"  // schnorr.PEMSignature
+)
+
+type PublicKey struct {
+	pk *verifier.PublicKey
+}
+
+type Signature struct {
+	signature *verifier.Signature
+}
+
+/*
+Parse a public key written by schnorr.PublicKey.MarshalPEM, Bytes or Hex
+*/
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	if der, ok := pemBlock(data, pemPublicKey); ok {
+		var key struct {
+			Group       []byte
+			X           []byte
+			NotAfter    int64
+			Environment string `asn1:"optional,utf8"`
+		}
+		if rest, err := asn1.Unmarshal(der, &key); err != nil || len(rest) != 0 {
+			return nil, ErrInvalidEncoding
+		}
+		g, rest, err := group.ReadGroup(key.Group)
+		if err != nil || len(rest) != 0 {
+			return nil, ErrInvalidEncoding
+		}
+		X, err := g.Decode(key.X)
+		if err != nil || (key.Environment != "" && verifier.ValidateEnvironment(key.Environment) != nil) {
+			return nil, ErrInvalidEncoding
+		}
+		pk := &verifier.PublicKey{Group: g, X: X, Environment: key.Environment}
+		if key.NotAfter != 0 {
+			pk.NotAfter = time.Unix(key.NotAfter, 0)
+		}
+		return newPublicKey(pk)
+	}
+	for _, b := range decodings(data) {
+		if pk, err := verifier.ParsePublicKey(b); err == nil {
+			return newPublicKey(pk)
+		}
+	}
+	return nil, ErrInvalidEncoding
+}
+
+/*
+Parse a signature written by schnorr.Signature.MarshalPEM, Bytes or Hex
+*/
+func ParseSignature(data []byte) (*Signature, error) {
+	if der, ok := pemBlock(data, pemSignature); ok {
+		var signature struct {
+			R []byte
+			S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(der, &signature); err != nil || len(rest) != 0 ||
+			len(signature.R) == 0 || signature.S.Sign() < 0 {
+			return nil, ErrInvalidEncoding
+		}
+		return &Signature{&verifier.Signature{R: signature.R, S: signature.S}}, nil
+	}
+	for _, b := range decodings(data) {
+		if signature, err := verifier.ParseSignature(b); err == nil {
+			return &Signature{signature}, nil
+		}
+	}
+	return nil, ErrInvalidEncoding
+}
+
+/*
+Key ID as printed by the CLI (schnorr.PublicKey.KeyID)
+*/
+func (pk *PublicKey) KeyID() string {
+	sum := sha256.Sum256(publicKeyBytes(pk.pk))
+	return hex.EncodeToString(sum[:8])
+}
+
+/*
+Unix time of the key expiry, 0 if the key never expires
+*/
+func (pk *PublicKey) NotAfter() int64 {
+	if pk.pk.NotAfter.IsZero() {
+		return 0
+	}
+	return pk.pk.NotAfter.Unix()
+}
+
+func (pk *PublicKey) Expired() bool {
+	return !pk.pk.NotAfter.IsZero() && time.Now().After(pk.pk.NotAfter)
+}
+
+/*
+Verify the signature of message (schnorr.SignBytes), false for expired keys
+*/
+func Verify(message []byte, signature *Signature, pk *PublicKey) bool {
+	if signature == nil || pk == nil {
+		return false
+	}
+	return verifier.VerifyAt(string(message), signature.signature, pk.pk, time.Now())
+}
+
+/*
+Verify the signature of file content (schnorr.SignReader, schnorr sign)
+*/
+func VerifyFile(content []byte, signature *Signature, pk *PublicKey) bool {
+	if signature == nil || pk == nil {
+		return false
+	}
+	digest := sha256.Sum256(content)
+	stream := *pk.pk
+	stream.Context = verifier.StreamContext
+	return verifier.VerifyAt(string(digest[:]), signature.signature, &stream, time.Now())
+}
+
+/*
+Parse and verify in one call, for FFI users which don't keep the parsed
+values; file selects the VerifyFile message encoding
+*/
+func VerifyEncoded(message, signature, publicKey []byte, file bool) (bool, error) {
+	pk, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return false, err
+	}
+	s, err := ParseSignature(signature)
+	if err != nil {
+		return false, err
+	}
+	if file {
+		return VerifyFile(message, s, pk), nil
+	}
+	return Verify(message, s, pk), nil
+}
+
+func newPublicKey(pk *verifier.PublicKey) (*PublicKey, error) {
+	if err := pk.Validate(); err != nil {
+		return nil, err
+	}
+	return &PublicKey{pk}, nil
+}
+
+func pemBlock(data []byte, blockType string) ([]byte, bool) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, false
+	}
+	return block.Bytes, true
+}
+
+/*
+Candidate binary encodings of data: hex decoded if it is hex, else as is
+*/
+func decodings(data []byte) [][]byte {
+	if b, err := hex.DecodeString(string(bytes.TrimSpace(data))); err == nil {
+		return [][]byte{b, data}
+	}
+	return [][]byte{data}
+}
+
+/*
+schnorr.PublicKey.Bytes: group||len(X)||X||notAfter[||len(env)||env]
+*/
+func publicKeyBytes(pk *verifier.PublicKey) []byte {
+	buf, err := group.AppendGroup(nil, pk.Group)
+	if err != nil {
+		return nil
+	}
+	X, err := pk.Group.Encode(pk.X)
+	if err != nil {
+		return nil
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(X)))
+	buf = append(buf, X...)
+	var notAfter int64
+	if !pk.NotAfter.IsZero() {
+		notAfter = pk.NotAfter.Unix()
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(notAfter))
+	if pk.Environment != "" {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(pk.Environment)))
+		buf = append(buf, pk.Environment...)
+	}
+	return buf
+}
@@ -0,0 +1,75 @@
+/*
+C ABI of package bindings, for Python (bindings/python) and other languages
+with a C FFI:
+
+	go build -buildmode=c-shared -o libschnorrverify.so ./bindings/cabi
+
+builds the library and its header libschnorrverify.h. Keys and signatures are
+accepted in every encoding of package schnorr (PEM, binary, hex). The verify
+functions return 1 for a valid signature, 0 for an invalid one and -1 if the
+key or the signature can't be parsed.
+*/
+package main
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/miki799/schnorr-signature/bindings"
+)
+
+func main() {}
+
+/*
+Verify the signature of a message signed with schnorr.SignBytes
+*/
+//export schnorr_verify
+func schnorr_verify(message *C.uint8_t, messageLen C.size_t, signature *C.uint8_t, signatureLen C.size_t, publicKey *C.uint8_t, publicKeyLen C.size_t) C.int {
+	return verify(message, messageLen, signature, signatureLen, publicKey, publicKeyLen, false)
+}
+
+/*
+Verify the signature of a file signed with schnorr.SignReader or the CLI
+*/
+//export schnorr_verify_file
+func schnorr_verify_file(content *C.uint8_t, contentLen C.size_t, signature *C.uint8_t, signatureLen C.size_t, publicKey *C.uint8_t, publicKeyLen C.size_t) C.int {
+	return verify(content, contentLen, signature, signatureLen, publicKey, publicKeyLen, true)
+}
+
+/*
+Write the 16 hex digits of the key ID and a NUL to out (17 bytes), returns 0
+or -1 if the key can't be parsed
+*/
+//export schnorr_key_id
+func schnorr_key_id(publicKey *C.uint8_t, publicKeyLen C.size_t, out *C.char) C.int {
+	pk, err := bindings.ParsePublicKey(goBytes(publicKey, publicKeyLen))
+	if err != nil {
+		return -1
+	}
+	id := append([]byte(pk.KeyID()), 0)
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(out)), len(id)), id)
+	return 0
+}
+
+func verify(message *C.uint8_t, messageLen C.size_t, signature *C.uint8_t, signatureLen C.size_t, publicKey *C.uint8_t, publicKeyLen C.size_t, file bool) C.int {
+	valid, err := bindings.VerifyEncoded(goBytes(message, messageLen), goBytes(signature, signatureLen), goBytes(publicKey, publicKeyLen), file)
+	switch {
+	case err != nil:
+		return -1
+	case valid:
+		return 1
+	}
+	return 0
+}
+
+func goBytes(p *C.uint8_t, n C.size_t) []byte {
+	if p == nil || n == 0 {
+		return nil
+	}
+	return C.GoBytes(unsafe.Pointer(p), C.int(n))
+}
@@ -0,0 +1,58 @@
+"""Verification of schnorr signatures through the C ABI of bindings/cabi.
+
+Build the library first:
+
+    go build -buildmode=c-shared -o libschnorrverify.so ./bindings/cabi
+
+and point SCHNORR_VERIFY_LIB at it (default: next to this file).
+
+    import schnorr_verify
+    ok = schnorr_verify.verify_file(open("artifact", "rb").read(),
+                                    open("artifact.sig", "rb").read(),
+                                    open("release.pub.pem", "rb").read())
+
+Keys and signatures may be PEM, binary or hex, as written by the schnorr CLI.
+"""
+
+import ctypes
+import os
+
+_lib = ctypes.CDLL(os.environ.get(
+    "SCHNORR_VERIFY_LIB",
+    os.path.join(os.path.dirname(os.path.abspath(__file__)), "libschnorrverify.so")))
+
+_args = [ctypes.c_char_p, ctypes.c_size_t] * 3
+for _name in ("schnorr_verify", "schnorr_verify_file"):
+    getattr(_lib, _name).argtypes = _args
+    getattr(_lib, _name).restype = ctypes.c_int
+_lib.schnorr_key_id.argtypes = [ctypes.c_char_p, ctypes.c_size_t, ctypes.c_char_p]
+_lib.schnorr_key_id.restype = ctypes.c_int
+
+
+class EncodingError(ValueError):
+    """The key or the signature can't be parsed."""
+
+
+def _call(fn, message, signature, public_key):
+    result = fn(message, len(message), signature, len(signature), public_key, len(public_key))
+    if result < 0:
+        raise EncodingError("invalid key or signature encoding")
+    return result == 1
+
+
+def verify(message: bytes, signature: bytes, public_key: bytes) -> bool:
+    """Verify the signature of a message signed with schnorr.SignBytes."""
+    return _call(_lib.schnorr_verify, message, signature, public_key)
+
+
+def verify_file(content: bytes, signature: bytes, public_key: bytes) -> bool:
+    """Verify the signature of a file signed with `schnorr sign`."""
+    return _call(_lib.schnorr_verify_file, content, signature, public_key)
+
+
+def key_id(public_key: bytes) -> str:
+    """Key ID of the public key, as printed by the CLI."""
+    out = ctypes.create_string_buffer(17)
+    if _lib.schnorr_key_id(public_key, len(public_key), out) < 0:
+        raise EncodingError("invalid public key encoding")
+    return out.value.decode()
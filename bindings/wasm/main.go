@@ -0,0 +1,123 @@
+//go:build js && wasm
+
+/*
+Passkey authenticator (package passkey) for the browser:
+
+	GOOS=js GOARCH=wasm go build -o passkey.wasm ./bindings/wasm
+
+loaded with the wasm_exec.js of the Go release (misc/wasm, lib/wasm since Go
+1.24). The module defines the global schnorrPasskey:
+
+	const key = schnorrPasskey.generateKey()                          // PEM of a new secp256k1 key
+	const auth = schnorrPasskey.authenticator("example.com", key, 0)  // key and the stored counter
+	const registration = auth.register(challenge, location.origin)    // JSON of passkey.RegistrationResponse
+	const assertion = auth.assert(challenge, location.origin)         // JSON of passkey.AssertionResponse
+	store(key, auth.counter())
+
+Failures are returned as Error values instead of the result. The module
+keeps nothing across page loads, the page persists the key and the counter of
+the last assertion, e.g. in IndexedDB wrapped with a non-extractable WebCrypto
+key.
+*/
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/miki799/schnorr-signature/passkey"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func main() {
+	js.Global().Set("schnorrPasskey", js.ValueOf(map[string]interface{}{
+		"generateKey":   js.FuncOf(generateKey),
+		"authenticator": js.FuncOf(authenticator),
+	}))
+	// the callbacks live as long as the program
+	select {}
+}
+
+/*
+generateKey() - PEM of a new secp256k1 key
+*/
+func generateKey(this js.Value, args []js.Value) interface{} {
+	sk, _, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1)
+	if err != nil {
+		return jsError(err.Error())
+	}
+	encoded, err := sk.MarshalPEM()
+	if err != nil {
+		return jsError(err.Error())
+	}
+	return string(encoded)
+}
+
+/*
+authenticator(rpID, keyPEM, counter) - object with register, assert, counter
+and credentialID
+*/
+func authenticator(this js.Value, args []js.Value) interface{} {
+	if len(args) != 3 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString || args[2].Type() != js.TypeNumber {
+		return jsError("expected authenticator(rpID, keyPEM, counter)")
+	}
+	sk, pk, err := schnorr.ParseSignatureKeyPEM([]byte(args[1].String()))
+	if err != nil {
+		return jsError(err.Error())
+	}
+	counter := args[2].Float()
+	if counter < 0 || counter > float64(^uint32(0)) || counter != float64(uint32(counter)) {
+		return jsError("counter out of range")
+	}
+	a := passkey.NewAuthenticatorWithCounter(args[0].String(), sk, pk, uint32(counter))
+
+	return js.ValueOf(map[string]interface{}{
+		"register": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if !stringArgs(args, 2) {
+				return jsError("expected register(challenge, origin)")
+			}
+			resp, err := a.Register(args[0].String(), args[1].String())
+			return jsonResult(resp, err)
+		}),
+		"assert": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if !stringArgs(args, 2) {
+				return jsError("expected assert(challenge, origin)")
+			}
+			resp, err := a.Assert(args[0].String(), args[1].String())
+			return jsonResult(resp, err)
+		}),
+		"counter": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return float64(a.Counter())
+		}),
+		"credentialID": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return a.CredentialID()
+		}),
+	})
+}
+
+func stringArgs(args []js.Value, n int) bool {
+	if len(args) != n {
+		return false
+	}
+	for _, arg := range args {
+		if arg.Type() != js.TypeString {
+			return false
+		}
+	}
+	return true
+}
+
+func jsonResult(v interface{}, err error) interface{} {
+	if err != nil {
+		return jsError(err.Error())
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return jsError(err.Error())
+	}
+	return string(encoded)
+}
+
+func jsError(message string) js.Value {
+	return js.Global().Get("Error").New(message)
+}
@@ -0,0 +1,101 @@
+package bip340
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+/*
+Official vectors of the BIP (bip-0340/test-vectors.csv):
+
+	index,secret key,public key,aux_rand,message,signature,verification result,comment
+*/
+func TestVectors(t *testing.T) {
+	f, err := os.Open("testdata/test-vectors.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 20 {
+		t.Fatalf("%d rows in the vector file", len(rows))
+	}
+
+	for _, row := range rows[1:] {
+		row := row
+		t.Run(row[0], func(t *testing.T) {
+			secretKey, publicKey, aux := decode(t, row[1]), decode(t, row[2]), decode(t, row[3])
+			msg, signature := decode(t, row[4]), decode(t, row[5])
+			valid := row[6] == "TRUE"
+
+			var pub [32]byte
+			var sig [64]byte
+			copy(pub[:], publicKey)
+			copy(sig[:], signature)
+
+			if secretKey != nil {
+				var priv, auxRand [32]byte
+				copy(priv[:], secretKey)
+				copy(auxRand[:], aux)
+
+				pk, err := PublicKey(priv)
+				if err != nil || pk != pub {
+					t.Errorf("public key %x, %v, want %x", pk, err, pub)
+				}
+				got, err := SignMessageWithAux(msg, priv, auxRand)
+				if err != nil || got != sig {
+					t.Errorf("signature %x, %v, want %x", got, err, sig)
+				}
+			}
+
+			if got := VerifyMessage(msg, sig, pub); got != valid {
+				t.Errorf("verification %v, want %v (%s)", got, valid, row[7])
+			}
+			if len(msg) == 32 {
+				var m [32]byte
+				copy(m[:], msg)
+				if got := Verify(m, sig, pub); got != valid {
+					t.Errorf("Verify %v, want %v (%s)", got, valid, row[7])
+				}
+			}
+		})
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	priv := [32]byte{31: 3}
+	pub, err := PublicKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("message of any length")
+	sig, err := SignMessage(msg, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyMessage(msg, sig, pub) {
+		t.Fatal("signature doesn't verify")
+	}
+	if VerifyMessage(msg[1:], sig, pub) {
+		t.Fatal("signature verifies for another message")
+	}
+	if _, err := PublicKey([32]byte{}); err != ErrInvalidPrivateKey {
+		t.Fatalf("zero private key: %v", err)
+	}
+}
+
+func decode(t *testing.T, s string) []byte {
+	if s == "" {
+		return nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
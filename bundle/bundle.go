@@ -0,0 +1,144 @@
+/*
+Self-contained verification bundles for archival and legal evidence.
+
+A bundle packages a signed message with everything needed to check it later
+on an air-gapped machine: the signature, the public key with its group
+parameters, the registered parameter set ID and an optional endorsement chain
+(package endorse) together with the public keys of the endorsers.
+
+Bundles are JSON documents, binary fields are base64 encoded:
+
+	schnorr verify-bundle [-key id] evidence.json
+
+Verification proves that the bundle is internally consistent. Whether the
+signing key belongs to the claimed signer has to be decided by comparing
+Result.KeyID with a fingerprint obtained out of band.
+*/
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miki799/schnorr-signature/endorse"
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const version = 1
+
+var (
+	ErrVersion      = errors.New("bundle: unsupported version")
+	ErrMalformed    = errors.New("bundle: malformed bundle")
+	ErrParams       = errors.New("bundle: public key doesn't use the declared parameter set")
+	ErrBadSignature = errors.New("bundle: invalid signature")
+)
+
+type Bundle struct {
+	Version      int       `json:"version"`
+	Created      time.Time `json:"created"`
+	Note         string    `json:"note,omitempty"` // free text, e.g. case reference, not covered by any signature
+	Message      []byte    `json:"message"`
+	Signature    []byte    `json:"signature"`               // Signature.Bytes
+	PublicKey    []byte    `json:"public_key"`              // PublicKey.Bytes, carries the group parameters
+	ParamsID     *uint16   `json:"params_id,omitempty"`     // registered parameter set of the key, if any
+	Endorsements []byte    `json:"endorsements,omitempty"`  // endorse.Chain over the message
+	EndorserKeys [][]byte  `json:"endorser_keys,omitempty"` // PublicKey.Bytes of every endorser
+}
+
+/*
+Outcome of a successful verification
+*/
+type Result struct {
+	KeyID     string
+	ParamsID  *uint16
+	Endorsers []endorse.Endorser
+}
+
+func New(message []byte, signature *schnorr.Signature, pk *schnorr.PublicKey) *Bundle {
+	b := &Bundle{
+		Version:   version,
+		Created:   schnorr.Now().UTC(),
+		Message:   message,
+		Signature: signature.Bytes(),
+		PublicKey: pk.Bytes(),
+	}
+	if id, ok := pk.ParamsID(); ok {
+		b.ParamsID = &id
+	}
+	return b
+}
+
+/*
+Attach endorsement chain of the message and public keys of its endorsers
+*/
+func (b *Bundle) Endorse(chain *endorse.Chain, keys ...*schnorr.PublicKey) {
+	b.Endorsements = chain.Marshal()
+	b.EndorserKeys = b.EndorserKeys[:0]
+	for _, pk := range keys {
+		b.EndorserKeys = append(b.EndorserKeys, pk.Bytes())
+	}
+}
+
+func (b *Bundle) Marshal() ([]byte, error) {
+	return json.MarshalIndent(b, "", "  ")
+}
+
+func Unmarshal(data []byte) (*Bundle, error) {
+	b := &Bundle{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, ErrMalformed
+	}
+	if b.Version != version {
+		return nil, ErrVersion
+	}
+	return b, nil
+}
+
+/*
+Check the signature, the parameter set and the endorsement chain using only
+the content of the bundle
+*/
+func (b *Bundle) Verify() (*Result, error) {
+	pk, err := schnorr.ParsePublicKey(b.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: public key: %v", ErrMalformed, err)
+	}
+	signature, err := schnorr.ParseSignature(b.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrMalformed, err)
+	}
+
+	if b.ParamsID != nil {
+		if id, ok := pk.ParamsID(); !ok || id != *b.ParamsID {
+			return nil, ErrParams
+		}
+	}
+	if !schnorr.VerifySignature(string(b.Message), signature, pk) {
+		return nil, ErrBadSignature
+	}
+
+	result := &Result{KeyID: pk.KeyID(), ParamsID: b.ParamsID}
+	if len(b.Endorsements) == 0 {
+		return result, nil
+	}
+
+	chain, err := endorse.Unmarshal(b.Endorsements)
+	if err != nil {
+		return nil, fmt.Errorf("%w: endorsements: %v", ErrMalformed, err)
+	}
+	keys := envelope.KeyMap{}
+	for _, raw := range b.EndorserKeys {
+		endorser, err := schnorr.ParsePublicKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: endorser key: %v", ErrMalformed, err)
+		}
+		keys.Add(endorser)
+	}
+	if result.Endorsers, err = chain.Verify(b.Message, keys); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,201 @@
+/*
+Canonical encodings of structured values for signing.
+
+Signing a struct needs one byte encoding every signer and verifier agrees on;
+encoding/json of a map, a protobuf without deterministic marshalling or a
+hand-written "hash the fields" function silently differ between services.
+Applications register the canonical encoding of each of their types once:
+
+	canonical.Register(Order{}, "acme.v1.Order", canonical.JCS)
+	canonical.Register(&pb.Invoice{}, "acme.v1.Invoice", canonical.CanonicalizerFunc("protobuf",
+		func(v interface{}) ([]byte, error) {
+			return proto.MarshalOptions{Deterministic: true}.Marshal(v.(*pb.Invoice))
+		}))
+
+and sign and verify values with SignValue and VerifyValue, which look the
+encoding up by the Go type of the value. The signed message binds the
+registered type name and the encoding name:
+
+	"schnorr/canonical" || len(type)||type || len(encoding)||encoding || canonical bytes
+
+so a value can't be verified as another type or under another encoding.
+Types without a registration are rejected, there is no fallback encoding.
+*/
+package canonical
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrNotRegistered = errors.New("canonical: no canonical encoding registered for the type")
+	ErrRegistered    = errors.New("canonical: type or name already registered")
+	ErrBadSignature  = errors.New("canonical: invalid signature")
+)
+
+type Canonicalizer interface {
+	Name() string // encoding name bound into signatures, e.g. "jcs"
+	Canonicalize(v interface{}) ([]byte, error)
+}
+
+/*
+Canonicalizer with the given name calling fn
+*/
+func CanonicalizerFunc(name string, fn func(v interface{}) ([]byte, error)) Canonicalizer {
+	return funcCanonicalizer{name, fn}
+}
+
+type funcCanonicalizer struct {
+	name string
+	fn   func(v interface{}) ([]byte, error)
+}
+
+func (c funcCanonicalizer) Name() string {
+	return c.name
+}
+
+func (c funcCanonicalizer) Canonicalize(v interface{}) ([]byte, error) {
+	return c.fn(v)
+}
+
+type registration struct {
+	name          string
+	canonicalizer Canonicalizer
+}
+
+/*
+Canonical encodings by Go type
+*/
+type Registry struct {
+	mu    sync.RWMutex
+	types map[reflect.Type]registration
+	names map[string]reflect.Type
+}
+
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[reflect.Type]registration), names: make(map[string]reflect.Type)}
+}
+
+/*
+Registry of the package level functions
+*/
+var DefaultRegistry = NewRegistry()
+
+/*
+Register the encoding of the type of sample under a name stable across
+services and refactorings (e.g. "acme.v1.Order"). A pointer sample registers
+the pointed-to type, values and pointers of it are encoded alike.
+*/
+func (r *Registry) Register(sample interface{}, name string, c Canonicalizer) error {
+	t := baseType(reflect.TypeOf(sample))
+	if t == nil || name == "" || c == nil {
+		return errors.New("canonical: Register needs a typed sample, a name and a canonicalizer")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.types[t]; ok {
+		return fmt.Errorf("%w: %s", ErrRegistered, t)
+	}
+	if _, ok := r.names[name]; ok {
+		return fmt.Errorf("%w: %s", ErrRegistered, name)
+	}
+	r.types[t] = registration{name, c}
+	r.names[name] = t
+	return nil
+}
+
+/*
+Registered type name and encoding name of the value's type
+*/
+func (r *Registry) Lookup(v interface{}) (typeName, encoding string, err error) {
+	reg, err := r.lookup(v)
+	if err != nil {
+		return "", "", err
+	}
+	return reg.name, reg.canonicalizer.Name(), nil
+}
+
+/*
+Message signed for the value, for signing through other APIs (envelope,
+hsm.KeyBackend and so on)
+*/
+func (r *Registry) Message(v interface{}) (string, error) {
+	reg, err := r.lookup(v)
+	if err != nil {
+		return "", err
+	}
+	b, err := reg.canonicalizer.Canonicalize(v)
+	if err != nil {
+		return "", fmt.Errorf("canonical: %s: %w", reg.name, err)
+	}
+	m := appendField([]byte("schnorr/canonical"), []byte(reg.name))
+	m = appendField(m, []byte(reg.canonicalizer.Name()))
+	return string(append(m, b...)), nil
+}
+
+func (r *Registry) SignValue(v interface{}, sk *schnorr.SignatureKey) (*schnorr.Signature, error) {
+	m, err := r.Message(v)
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.TrySign(m, sk)
+}
+
+func (r *Registry) VerifyValue(v interface{}, signature *schnorr.Signature, pk *schnorr.PublicKey) error {
+	m, err := r.Message(v)
+	if err != nil {
+		return err
+	}
+	if !schnorr.VerifySignature(m, signature, pk) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func (r *Registry) lookup(v interface{}) (registration, error) {
+	t := baseType(reflect.TypeOf(v))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reg, ok := r.types[t]
+	if !ok {
+		return registration{}, fmt.Errorf("%w: %v", ErrNotRegistered, reflect.TypeOf(v))
+	}
+	return reg, nil
+}
+
+func Register(sample interface{}, name string, c Canonicalizer) error {
+	return DefaultRegistry.Register(sample, name, c)
+}
+
+func Message(v interface{}) (string, error) {
+	return DefaultRegistry.Message(v)
+}
+
+/*
+Sign the canonical encoding of v, the type of v has to be registered
+*/
+func SignValue(v interface{}, sk *schnorr.SignatureKey) (*schnorr.Signature, error) {
+	return DefaultRegistry.SignValue(v, sk)
+}
+
+func VerifyValue(v interface{}, signature *schnorr.Signature, pk *schnorr.PublicKey) error {
+	return DefaultRegistry.VerifyValue(v, signature, pk)
+}
+
+func baseType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
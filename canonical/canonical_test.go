@@ -0,0 +1,131 @@
+package canonical
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+type order struct {
+	ID     string   `json:"id"`
+	Amount int      `json:"amount"`
+	Items  []string `json:"items"`
+}
+
+type refund order
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk
+}
+
+func registry(t *testing.T) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	if err := r.Register(&order{}, "acme.v1.Order", JCS); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSignValue(t *testing.T) {
+	r := registry(t)
+	sk, pk := keys(t)
+	o := order{ID: "o-1", Amount: 100, Items: []string{"a", "b"}}
+	signature, err := r.SignValue(o, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// values and pointers are encoded alike
+	if err := r.VerifyValue(&o, signature, pk); err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.Message(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(appendField(appendField([]byte("schnorr/canonical"), []byte("acme.v1.Order")), []byte("jcs"))) +
+		`{"amount":100,"id":"o-1","items":["a","b"]}`
+	if m != want {
+		t.Errorf("message %q", m)
+	}
+	if typeName, encoding, err := r.Lookup(&o); err != nil || typeName != "acme.v1.Order" || encoding != "jcs" {
+		t.Errorf("lookup: %s %s %v", typeName, encoding, err)
+	}
+
+	changed := o
+	changed.Amount = 1000
+	if err := r.VerifyValue(changed, signature, pk); err != ErrBadSignature {
+		t.Errorf("changed value: %v", err)
+	}
+	_, otherPK := keys(t)
+	if err := r.VerifyValue(o, signature, otherPK); err != ErrBadSignature {
+		t.Errorf("another key: %v", err)
+	}
+}
+
+/*
+The same JSON verified as another registered type or under another encoding
+*/
+func TestBinding(t *testing.T) {
+	r := registry(t)
+	sk, pk := keys(t)
+	o := order{ID: "o-1", Amount: 100}
+	signature, err := r.SignValue(o, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(refund{}, "acme.v1.Refund", JCS); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.VerifyValue(refund(o), signature, pk); err != ErrBadSignature {
+		t.Errorf("order verified as a refund: %v", err)
+	}
+
+	other := NewRegistry()
+	jcsCopy := CanonicalizerFunc("jcs-copy", JCS.Canonicalize)
+	if err := other.Register(order{}, "acme.v1.Order", jcsCopy); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.VerifyValue(o, signature, pk); err != ErrBadSignature {
+		t.Errorf("order verified under another encoding: %v", err)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	r := registry(t)
+	sk, _ := keys(t)
+	if _, err := r.SignValue(refund{}, sk); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("unregistered type: %v", err)
+	}
+	if _, err := r.SignValue(map[string]int{}, sk); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("map: %v", err)
+	}
+	if err := r.Register(order{}, "acme.v2.Order", JCS); !errors.Is(err, ErrRegistered) {
+		t.Errorf("type registered twice: %v", err)
+	}
+	if err := r.Register(refund{}, "acme.v1.Order", JCS); !errors.Is(err, ErrRegistered) {
+		t.Errorf("name registered twice: %v", err)
+	}
+	if err := r.Register(nil, "acme.v1.Refund", JCS); err == nil {
+		t.Error("nil sample registered")
+	}
+	if err := r.Register(refund{}, "", JCS); err == nil {
+		t.Error("type registered without a name")
+	}
+
+	failing := errors.New("no encoding")
+	if err := r.Register(refund{}, "acme.v1.Refund", CanonicalizerFunc("failing", func(interface{}) ([]byte, error) {
+		return nil, failing
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SignValue(refund{}, sk); !errors.Is(err, failing) {
+		t.Errorf("failing canonicalizer: %v", err)
+	}
+}
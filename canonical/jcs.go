@@ -0,0 +1,211 @@
+package canonical
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+/*
+JSON Canonicalization Scheme (RFC 8785)
+
+The value is marshalled with encoding/json (so json tags and Marshaler
+implementations apply) and re-serialized canonically: no whitespace, object
+members sorted by the UTF-16 code units of their names, strings with the
+minimal escaping of ECMAScript and numbers in the ECMAScript shortest form.
+Numbers are IEEE 754 doubles, integers beyond 2^53 lose precision as they do
+in every JCS implementation; encode them as strings.
+*/
+var JCS Canonicalizer = jcs{}
+
+type jcs struct{}
+
+func (jcs) Name() string {
+	return "jcs"
+}
+
+func (jcs) Canonicalize(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalizeJSON(raw)
+}
+
+/*
+Canonical form of a JSON text, duplicate object members are rejected
+*/
+func CanonicalizeJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var b bytes.Buffer
+	if err := writeJCS(&b, dec); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err == nil {
+		return nil, errors.New("jcs: data after the JSON value")
+	}
+	return b.Bytes(), nil
+}
+
+func writeJCS(b *bytes.Buffer, dec *json.Decoder) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			b.WriteByte('[')
+			for i := 0; dec.More(); i++ {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				if err := writeJCS(b, dec); err != nil {
+					return err
+				}
+			}
+			b.WriteByte(']')
+			_, err := dec.Token()
+			return err
+		}
+		return writeObject(b, dec)
+	case string:
+		writeString(b, t)
+	case json.Number:
+		f, err := strconv.ParseFloat(string(t), 64)
+		if err != nil || math.IsInf(f, 0) {
+			return fmt.Errorf("jcs: number %s out of range", t)
+		}
+		b.WriteString(formatNumber(f))
+	case bool:
+		b.WriteString(strconv.FormatBool(t))
+	case nil:
+		b.WriteString("null")
+	}
+	return nil
+}
+
+func writeObject(b *bytes.Buffer, dec *json.Decoder) error {
+	members := make(map[string][]byte)
+	var names []string
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name := token.(string)
+		if _, ok := members[name]; ok {
+			return fmt.Errorf("jcs: duplicate member %q", name)
+		}
+		var value bytes.Buffer
+		if err := writeJCS(&value, dec); err != nil {
+			return err
+		}
+		members[name] = value.Bytes()
+		names = append(names, name)
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	sort.Slice(names, func(i, j int) bool { return lessUTF16(names[i], names[j]) })
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeString(b, name)
+		b.WriteByte(':')
+		b.Write(members[name])
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+/*
+ECMAScript Number.prototype.toString of a finite double
+*/
+func formatNumber(f float64) string {
+	if f == 0 {
+		return "0" // also -0
+	}
+	sign := ""
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	// shortest digits d1.d2d3...e±n
+	mantissa, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	n, _ := strconv.Atoi(exp)
+	n++ // position of the decimal point after the first n digits
+	k := len(digits)
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits
+	}
+	e := "e+"
+	if n-1 < 0 {
+		e = "e-"
+	}
+	exponent := strconv.Itoa(abs(n - 1))
+	if k == 1 {
+		return sign + digits + e + exponent
+	}
+	return sign + digits[:1] + "." + digits[1:] + e + exponent
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
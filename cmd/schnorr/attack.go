@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/miki799/schnorr-signature/attacks"
+)
+
+/*
+Run an educational attack demonstration, list them without arguments
+*/
+func runAttack(args []string) error {
+	if len(args) == 0 {
+		fmt.Println("EDUCATIONAL demonstrations of attacks on flawed Schnorr implementations:")
+		for _, name := range attacks.DemoNames() {
+			fmt.Println("  " + name)
+		}
+		return nil
+	}
+	demo, ok := attacks.Demos[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown attack %q", args[0])
+	}
+	fmt.Println("EDUCATIONAL demonstration, all keys are generated for this run")
+	return demo(os.Stdout)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/miki799/schnorr-signature/backup"
+	"github.com/miki799/schnorr-signature/schnorr"
+	"github.com/miki799/schnorr-signature/tokens"
+)
+
+const passphraseEnv = "SCHNORR_BACKUP_PASSPHRASE"
+
+/*
+-meta name=value, repeatable
+*/
+type metaFlag map[string]string
+
+func (m metaFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m metaFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	m[name] = value
+	return nil
+}
+
+/*
+Write the key files, the coins (hex, one per line) and key-ring metadata to an
+encrypted backup signed with -key
+*/
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	keyFile := flags.String("key", "", "private key signing the backup (PEM)")
+	out := flags.String("out", "schnorr.backup", "backup file")
+	passFile := flags.String("pass-file", "", "file with the passphrase, $"+passphraseEnv+" if empty")
+	coinsFile := flags.String("coins", "", "wallet coins to include, hex encoded, one per line")
+	meta := metaFlag{}
+	flags.Var(meta, "meta", "key-ring metadata name=value, repeatable")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sk, pk, err := readSignatureKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readPassphrase(*passFile)
+	if err != nil {
+		return err
+	}
+
+	contents := &backup.Contents{KeyRing: meta}
+	for _, path := range flags.Args() {
+		keySK, keyPK, err := readSignatureKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".pem")
+		if err := contents.AddKey(name, keySK, keyPK); err != nil {
+			return err
+		}
+	}
+	if *coinsFile != "" {
+		coins, err := readCoins(*coinsFile)
+		if err != nil {
+			return err
+		}
+		contents.AddCoins(coins...)
+	}
+
+	data, err := backup.Seal(contents, passphrase, sk, pk)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0o600); err != nil {
+		return err
+	}
+	fmt.Printf("%d keys, %d tokens, %d metadata entries written to %s, signed by %s\n",
+		len(contents.Keys), len(contents.Tokens), len(meta), *out, pk.KeyID())
+	return nil
+}
+
+/*
+Check and decrypt a backup and restore its files into -dir: name.pem and
+name.pub.pem for every key, coins.txt and keyring.json. Existing files are
+kept unless -force is set, -list only prints the contents.
+*/
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	pubFile := flags.String("pub", "", "trusted public key of the backup signer, any signer if empty")
+	dir := flags.String("dir", ".", "directory to restore into")
+	passFile := flags.String("pass-file", "", "file with the passphrase, $"+passphraseEnv+" if empty")
+	list := flags.Bool("list", false, "list the contents without writing files")
+	force := flags.Bool("force", false, "overwrite existing files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected the backup file")
+	}
+	var trusted *schnorr.PublicKey
+	if *pubFile != "" {
+		var err error
+		if trusted, err = readPublicKey(*pubFile); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	header, err := backup.Verify(data, trusted)
+	if err != nil {
+		return err
+	}
+	if trusted == nil {
+		fmt.Fprintf(os.Stderr, "warning: signer %s not checked, use -pub to require a trusted key\n", header.Signer.KeyID())
+	}
+	passphrase, err := readPassphrase(*passFile)
+	if err != nil {
+		return err
+	}
+	contents, _, err := backup.Open(data, passphrase, trusted)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("backup of %s, schema %d, signed by %s\n", contents.Created.Format("2006-01-02 15:04:05 MST"), contents.Schema, header.Signer.KeyID())
+	files := make(map[string][]byte)
+	for _, k := range contents.Keys {
+		_, pk, err := k.Parse()
+		if err != nil {
+			return err
+		}
+		if k.Name != filepath.Base(k.Name) || k.Name == "." || k.Name == ".." {
+			return fmt.Errorf("key name %q isn't a plain file name", k.Name)
+		}
+		fmt.Printf("key      %s  %s\n", k.Name, pk.KeyID())
+		files[k.Name+".pem"] = k.Private
+		files[k.Name+".pub.pem"] = k.Public
+	}
+	coins, err := contents.Coins()
+	if err != nil {
+		return err
+	}
+	if len(coins) > 0 {
+		var b bytes.Buffer
+		var total uint64
+		for _, coin := range coins {
+			fmt.Fprintln(&b, hex.EncodeToString(coin.Bytes()))
+			total += coin.Amount
+		}
+		fmt.Printf("coins    %d, total %d\n", len(coins), total)
+		files["coins.txt"] = b.Bytes()
+	}
+	if len(contents.KeyRing) > 0 {
+		names := make([]string, 0, len(contents.KeyRing))
+		for name := range contents.KeyRing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("keyring  %s = %s\n", name, contents.KeyRing[name])
+		}
+		encoded, err := json.MarshalIndent(contents.KeyRing, "", "  ")
+		if err != nil {
+			return err
+		}
+		files["keyring.json"] = append(encoded, '\n')
+	}
+	if *list {
+		return nil
+	}
+
+	if !*force {
+		for name := range files {
+			if _, err := os.Stat(filepath.Join(*dir, name)); err == nil {
+				return fmt.Errorf("%s exists, use -force to overwrite", filepath.Join(*dir, name))
+			}
+		}
+	}
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		return err
+	}
+	for name, data := range files {
+		mode := os.FileMode(0o600)
+		if strings.HasSuffix(name, ".pub.pem") {
+			mode = 0o644
+		}
+		if err := os.WriteFile(filepath.Join(*dir, name), data, mode); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d files restored to %s\n", len(files), *dir)
+	return nil
+}
+
+func readPassphrase(path string) ([]byte, error) {
+	var passphrase []byte
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		passphrase = bytes.TrimRight(data, "\r\n")
+	} else {
+		passphrase = []byte(os.Getenv(passphraseEnv))
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("missing passphrase, use -pass-file or $%s", passphraseEnv)
+	}
+	return passphrase, nil
+}
+
+func readCoins(path string) ([]*tokens.Coin, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var coins []*tokens.Coin
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		b, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		coin, err := tokens.ParseCoin(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		coins = append(coins, coin)
+	}
+	return coins, scanner.Err()
+}
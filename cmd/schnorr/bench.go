@@ -0,0 +1,428 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/miki799/schnorr-signature/eddsa"
+	"github.com/miki799/schnorr-signature/frost"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Signature scheme measured by the bench command. ristretto255 isn't among them:
+neither the module nor Go's standard library implement the group, so there is
+no backend to measure. setup generates a key pair and
+returns the signing and verification operations bound to it.
+*/
+type benchBackend struct {
+	name  string
+	setup func() (sign func(m []byte) interface{}, verify func(m []byte, signature interface{}) bool, err error)
+}
+
+var benchBackends = []benchBackend{
+	{"schnorr/modp-2048", func() (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+		sk, pk, err := schnorr.TryGenerateKeys()
+		if err != nil {
+			return nil, nil, err
+		}
+		return schnorrOps(sk, pk)
+	}},
+	{"schnorr/modp-3072", modpOps(0x8c00, rfc3526Group15)},
+	{"schnorr/modp-4096", modpOps(0x9000, rfc3526Group16)},
+	{"schnorr/secp256k1", paramsOps(schnorr.ParamsSecp256k1)},
+	{"schnorr/p256", paramsOps(schnorr.ParamsP256)},
+	{"ed25519", func() (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+		signer, pub, err := eddsa.GenerateKey(eddsa.Ed25519, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		sign := func(m []byte) interface{} {
+			signature, err := signer.Sign(m)
+			if err != nil {
+				panic(err)
+			}
+			return signature
+		}
+		verify := func(m []byte, signature interface{}) bool {
+			return eddsa.Verify(pub, m, signature.([]byte), eddsa.Ed25519, "") == nil
+		}
+		return sign, verify, nil
+	}},
+	{"frost/secp256k1 2-of-2", frostOps(frost.Secp256k1SHA256)},
+	{"frost/p256 2-of-2", frostOps(frost.P256SHA256)},
+}
+
+/*
+Measure keygen, sign and verify of every backend and print a comparison table
+*/
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	duration := flags.Duration("time", time.Second, "measuring time per operation")
+	only := flags.String("backend", "", "measure only the backend with this name")
+	hamming := flags.Bool("hamming", false, "measure signing time for private keys of different Hamming weight")
+	pool := flags.Int("pool", 0, "compare pooled and on-demand nonces with this many signing goroutines")
+	latency := flags.Bool("latency", false, "measure verification latency percentiles on one core")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *latency {
+		return benchLatency(*duration)
+	}
+	if *hamming {
+		return benchHamming(*duration)
+	}
+	if *pool > 0 {
+		return benchPool(*duration, *pool)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "backend\tkeygen\tsign\tverify\t")
+
+	message := []byte("schnorr bench message")
+	measured := false
+	for _, backend := range benchBackends {
+		if *only != "" && backend.name != *only {
+			continue
+		}
+		measured = true
+
+		// first setup outside the measurement, one-time preparation of a
+		// backend isn't part of keygen
+		sign, verify, err := backend.setup()
+		if err != nil {
+			return fmt.Errorf("%s: %w", backend.name, err)
+		}
+		keygen := measure(*duration, func() {
+			if sign, verify, err = backend.setup(); err != nil {
+				panic(err)
+			}
+		})
+
+		signature := sign(message)
+		if !verify(message, signature) {
+			return fmt.Errorf("%s: signature doesn't verify", backend.name)
+		}
+		signing := measure(*duration, func() { sign(message) })
+		verification := measure(*duration, func() { verify(message, signature) })
+
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\t\n", backend.name, keygen, signing, verification)
+	}
+	if !measured {
+		return errors.New("unknown backend " + *only)
+	}
+	return w.Flush()
+}
+
+/*
+Signing time of keys from Hamming weight 1 to 255 on secp256k1. The keys are measured in interleaved rounds of the same message, so
+drift of the machine affects all of them alike. With constant-time signing the
+times differ by noise only.
+*/
+func benchHamming(d time.Duration) error {
+	group, err := schnorr.LookupGroup(schnorr.ParamsSecp256k1)
+	if err != nil {
+		return err
+	}
+	weights := []int{1, 32, 64, 128, 192, 255}
+	keys := make([]*schnorr.SignatureKey, len(weights))
+	for i, weight := range weights {
+		// lowest bit and the top weight-1 bits of 255 set
+		x := big.NewInt(1)
+		for bit := 254; bit > 254-(weight-1); bit-- {
+			x.SetBit(x, bit, 1)
+		}
+		if keys[i], _, err = schnorr.NewSignatureKey(group, x); err != nil {
+			return err
+		}
+	}
+
+	const batch = 64
+	message := "schnorr bench message"
+	signature := &schnorr.Signature{}
+	total := make([]time.Duration, len(keys))
+	runs := 0
+	for start := time.Now(); time.Since(start) < d || runs == 0; runs += batch {
+		for i, sk := range keys {
+			t := time.Now()
+			for j := 0; j < batch; j++ {
+				if err := schnorr.SignTo(signature, message, sk); err != nil {
+					return err
+				}
+			}
+			total[i] += time.Since(t)
+		}
+	}
+
+	var mean float64
+	for _, t := range total {
+		mean += float64(t) / float64(len(total))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "weight	sign	vs mean	")
+	for i, t := range total {
+		fmt.Fprintf(w, "%d	%v	%+.1f%%	\n", weights[i], t/time.Duration(runs), 100*(float64(t)-mean)/mean)
+	}
+	return w.Flush()
+}
+
+/*
+Signing throughput of SigningService against TrySign with parallel goroutines
+signing on secp256k1
+*/
+func benchPool(d time.Duration, parallel int) error {
+	sk, _, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1)
+	if err != nil {
+		return err
+	}
+	service := schnorr.NewSigningService(sk, schnorr.SigningServiceOptions{Workers: runtime.GOMAXPROCS(0)})
+	defer service.Close()
+	// start with a full pool, as a server does after warm-up
+	for start := time.Now(); service.Stats().Available < service.Stats().PoolSize && time.Since(start) < d; {
+		time.Sleep(time.Millisecond)
+	}
+
+	modes := []struct {
+		name string
+		sign func(m string) error
+	}{
+		{"on-demand", func(m string) error {
+			_, err := schnorr.TrySign(m, sk)
+			return err
+		}},
+		{"pooled", func(m string) error {
+			_, err := service.Sign(m)
+			return err
+		}},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "nonces\tsignatures/s\tgoroutines\t\n")
+	for _, mode := range modes {
+		var count atomic.Uint64
+		var failed atomic.Value
+		var wg sync.WaitGroup
+		deadline := time.Now().Add(d)
+		start := time.Now()
+		for i := 0; i < parallel; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				m := fmt.Sprintf("schnorr bench message %d", i)
+				for time.Now().Before(deadline) {
+					if err := mode.sign(m); err != nil {
+						failed.Store(err)
+						return
+					}
+					count.Add(1)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if err, ok := failed.Load().(error); ok {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%.0f\t%d\t\n", mode.name, float64(count.Load())/time.Since(start).Seconds(), parallel)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	stats := service.Stats()
+	fmt.Printf("pool: %d/%d available, %d generated (%.0f/s), %d served, %d misses\n",
+		stats.Available, stats.PoolSize, stats.Generated, stats.RefillRate, stats.Served, stats.Misses)
+	return nil
+}
+
+/*
+Latency percentiles of VerifySignature and FastVerifier (uncached and with a
+cache hit) in the registered groups, one verification at a time on a single
+core, as a login handler sees them
+*/
+func benchLatency(d time.Duration) error {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "params\tverify\tp50\tp99\tp99.9\t")
+	for _, params := range []struct {
+		name string
+		id   uint16
+	}{{"secp256k1", schnorr.ParamsSecp256k1}, {"modp-2048", schnorr.ParamsMODP2048}} {
+		sk, pk, err := schnorr.GenerateKeysWithParamsID(params.id)
+		if err != nil {
+			return err
+		}
+		message := "schnorr bench message, 32 bytes"
+		signature, err := schnorr.TrySign(message, sk)
+		if err != nil {
+			return err
+		}
+		fast, err := schnorr.NewFastVerifier(pk, 0)
+		if err != nil {
+			return err
+		}
+		cached, err := schnorr.NewFastVerifier(pk, 1024)
+		if err != nil {
+			return err
+		}
+
+		for _, mode := range []struct {
+			name   string
+			verify func() bool
+		}{
+			{"VerifySignature", func() bool { return schnorr.VerifySignature(message, signature, pk) }},
+			{"FastVerifier", func() bool { return fast.Verify(message, signature) }},
+			{"FastVerifier/cached", func() bool { return cached.Verify(message, signature) }},
+		} {
+			if !mode.verify() {
+				return fmt.Errorf("%s %s: signature doesn't verify", params.name, mode.name)
+			}
+			var samples []time.Duration
+			for start := time.Now(); time.Since(start) < d || len(samples) == 0; {
+				t := time.Now()
+				mode.verify()
+				samples = append(samples, time.Since(t))
+			}
+			sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+			percentile := func(p float64) time.Duration {
+				return samples[int(p*float64(len(samples)-1))].Round(10 * time.Nanosecond)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%v\t\n", params.name, mode.name,
+				percentile(0.5), percentile(0.99), percentile(0.999))
+		}
+	}
+	return w.Flush()
+}
+
+/*
+Average duration of op, run repeatedly for about d (at least once)
+*/
+func measure(d time.Duration, op func()) time.Duration {
+	start := time.Now()
+	n := 0
+	for n == 0 || time.Since(start) < d {
+		op()
+		n++
+	}
+	return (time.Since(start) / time.Duration(n)).Round(100 * time.Nanosecond)
+}
+
+func schnorrOps(sk *schnorr.SignatureKey, pk *schnorr.PublicKey) (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+	sign := func(m []byte) interface{} {
+		return schnorr.Sign(string(m), sk)
+	}
+	verify := func(m []byte, signature interface{}) bool {
+		return schnorr.VerifySignature(string(m), signature.(*schnorr.Signature), pk)
+	}
+	return sign, verify, nil
+}
+
+func paramsOps(id uint16) func() (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+	return func() (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+		sk, pk, err := schnorr.GenerateKeysWithParamsID(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		return schnorrOps(sk, pk)
+	}
+}
+
+/*
+Primes of RFC 3526 groups 15 and 16 (g = 2), the larger siblings of the
+built-in MODP group
+*/
+const (
+	rfc3526Group15 = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+		"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+		"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+		"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33" +
+		"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+		"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864" +
+		"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2" +
+		"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
+	rfc3526Group16 = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+		"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+		"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+		"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33" +
+		"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+		"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864" +
+		"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2" +
+		"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A92108011A723C12A787E6D7" +
+		"88719A10BDBA5B2699C327186AF4E23C1A946834B6150BDA2583E9CA2AD44CE8" +
+		"DBBBC2DB04DE8EF92E8EFC141FBECAA6287C59474E6BC05D99B2964FA090C3A2" +
+		"233BA186515BE7ED1F612970CEE2D7AFB81BDD762170481CD0069127D5B05AA9" +
+		"93B4EA988D8FDDC186FFB7DC90A6C08F4DF435C934063199FFFFFFFFFFFFFFFF"
+)
+
+/*
+Keys in the mod p group with generator 2, registered under id on first use so
+the parameters are validated once and not on every keygen
+*/
+func modpOps(id uint16, p string) func() (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+	var once sync.Once
+	var err error
+	return func() (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+		once.Do(func() {
+			prime, _ := new(big.Int).SetString(p, 16)
+			err = schnorr.RegisterParams(id, schnorr.NewGroupParams(prime, big.NewInt(2)))
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return paramsOps(id)()
+	}
+}
+
+/*
+Both rounds of threshold signing with all participants in the process
+*/
+func frostOps(cs *frost.Ciphersuite) func() (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+	return func() (func([]byte) interface{}, func([]byte, interface{}) bool, error) {
+		packages, groupKey, _, err := cs.TrustedDealerKeygen(nil, 2, 2)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sign := func(m []byte) interface{} {
+			nonces := make([]*frost.Nonces, len(packages))
+			commitments := make([]*frost.Commitment, len(packages))
+			for i, kp := range packages {
+				if nonces[i], commitments[i], err = cs.Commit(kp); err != nil {
+					panic(err)
+				}
+			}
+			shares := make([]*big.Int, len(packages))
+			for i, kp := range packages {
+				if shares[i], err = cs.Sign(kp, nonces[i], m, commitments); err != nil {
+					panic(err)
+				}
+			}
+			signature, err := cs.Aggregate(commitments, m, shares, groupKey)
+			if err != nil {
+				panic(err)
+			}
+			return signature
+		}
+		verify := func(m []byte, signature interface{}) bool {
+			return cs.Verify(m, signature.(*frost.Signature), groupKey)
+		}
+		return sign, verify, nil
+	}
+}
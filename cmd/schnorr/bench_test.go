@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+/*
+Every backend sets up (the RFC 3526 primes pass RegisterParams) and verifies
+its own signatures only
+*/
+func TestBenchBackends(t *testing.T) {
+	message, other := []byte("schnorr bench message"), []byte("other message")
+	for _, backend := range benchBackends {
+		sign, verify, err := backend.setup()
+		if err != nil {
+			t.Errorf("%s: %v", backend.name, err)
+			continue
+		}
+		signature := sign(message)
+		if !verify(message, signature) || verify(other, signature) {
+			t.Errorf("%s: signature verification broken", backend.name)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Protocol message of blind-sign, one JSON object per line, data is the hex
+encoded binary form of the schnorr message (BlindCommitment.Bytes, ...)
+*/
+type blindMessage struct {
+	Type string `json:"type"` // commitment, challenge or response
+	Data string `json:"data"`
+}
+
+/*
+One side of the blind signature protocol. Messages for the other side are
+written to stdout and its messages are read from stdin, so the two sides can
+be connected by copying the lines between terminals or by pipes.
+The user signs the content of -in, the signature verifies with the verify command.
+With -seed and -session the user derives its blinding factors from the seed
+file (see schnorr.NewSeededBlindRequester), so the session can be repeated.
+*/
+func runBlindSign(args []string) error {
+	flags := flag.NewFlagSet("blind-sign", flag.ContinueOnError)
+	role := flags.String("role", "", "signer or user")
+	keyFile := flags.String("key", "", "signer: private key file")
+	pubFile := flags.String("pub", "", "user: signer's public key file")
+	in := flags.String("in", "", "user: file to get signed, stdin can't be used")
+	out := flags.String("out", "", "user: signature file, stdout if empty")
+	seedFile := flags.String("seed", "", "user: blinding seed file (at least 32 bytes), random blinding if empty")
+	session := flags.String("session", "", "user: session ID for -seed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	lines := bufio.NewScanner(os.Stdin)
+	switch *role {
+	case "signer":
+		sk, _, err := readSignatureKey(*keyFile)
+		if err != nil {
+			return err
+		}
+		return blindSigner(schnorr.NewBlindSigner(sk), lines)
+	case "user":
+		pk, err := readPublicKey(*pubFile)
+		if err != nil {
+			return err
+		}
+		if *in == "" {
+			return errors.New("missing -in")
+		}
+		input, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer input.Close()
+		// blind signature of the file as SignReader makes it
+		digest, err := schnorr.StreamDigest(input)
+		if err != nil {
+			return err
+		}
+		m, pk := string(digest[:]), pk.WithContext(schnorr.StreamContext)
+		requester := schnorr.NewBlindRequester(pk)
+		if *seedFile != "" {
+			seed, err := os.ReadFile(*seedFile)
+			if err != nil {
+				return err
+			}
+			if requester, err = schnorr.NewSeededBlindRequester(pk, seed, *session); err != nil {
+				return err
+			}
+		}
+		return blindUser(requester, m, lines, *out)
+	default:
+		return errors.New("-role must be signer or user")
+	}
+}
+
+func blindSigner(signer *schnorr.BlindSigner, lines *bufio.Scanner) error {
+	commitment, err := signer.SignerCommit()
+	if err != nil {
+		return err
+	}
+	if err := sendBlindMessage("commitment", commitment.Bytes()); err != nil {
+		return err
+	}
+
+	data, err := receiveBlindMessage(lines, "challenge")
+	if err != nil {
+		return err
+	}
+	challenge, err := schnorr.ParseBlindChallenge(data)
+	if err != nil {
+		return err
+	}
+	response, err := signer.SignerRespond(challenge)
+	if err != nil {
+		return err
+	}
+	return sendBlindMessage("response", response.Bytes())
+}
+
+func blindUser(requester *schnorr.BlindRequester, m string, lines *bufio.Scanner, out string) error {
+	data, err := receiveBlindMessage(lines, "commitment")
+	if err != nil {
+		return err
+	}
+	commitment, err := schnorr.ParseBlindCommitment(data)
+	if err != nil {
+		return err
+	}
+	challenge, err := requester.RequesterChallenge(commitment, m)
+	if err != nil {
+		return err
+	}
+	if err := sendBlindMessage("challenge", challenge.Bytes()); err != nil {
+		return err
+	}
+
+	if data, err = receiveBlindMessage(lines, "response"); err != nil {
+		return err
+	}
+	response, err := schnorr.ParseBlindResponse(data)
+	if err != nil {
+		return err
+	}
+	signature, err := requester.RequesterFinalize(response)
+	if err != nil {
+		return err
+	}
+	encoded, err := signature.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	return writeOutput(out, encoded)
+}
+
+func sendBlindMessage(kind string, data []byte) error {
+	return json.NewEncoder(os.Stdout).Encode(&blindMessage{kind, hex.EncodeToString(data)})
+}
+
+func receiveBlindMessage(lines *bufio.Scanner, kind string) ([]byte, error) {
+	fmt.Fprintf(os.Stderr, "waiting for the %s message:\n", kind)
+	if !lines.Scan() {
+		if err := lines.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no %s message", kind)
+	}
+	var message blindMessage
+	if err := json.Unmarshal(lines.Bytes(), &message); err != nil {
+		return nil, err
+	}
+	if message.Type != kind {
+		return nil, fmt.Errorf("expected %s message, got %q", kind, message.Type)
+	}
+	return hex.DecodeString(message.Data)
+}
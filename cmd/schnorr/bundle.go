@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/miki799/schnorr-signature/bundle"
+)
+
+/*
+Verify a bundle exported with bundle.Bundle.Marshal, optionally requiring the signing key ID
+*/
+func runVerifyBundle(args []string) error {
+	flags := flag.NewFlagSet("verify-bundle", flag.ContinueOnError)
+	keyID := flags.String("key", "", "require the message to be signed by the key with this ID")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected exactly one bundle file")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := bundle.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	result, err := b.Verify()
+	if err != nil {
+		return err
+	}
+	if *keyID != "" && result.KeyID != *keyID {
+		return fmt.Errorf("signed by key %s, expected %s", result.KeyID, *keyID)
+	}
+
+	fmt.Printf("signature:  valid\n")
+	fmt.Printf("key id:     %s\n", result.KeyID)
+	if result.ParamsID != nil {
+		fmt.Printf("params id:  %d\n", *result.ParamsID)
+	}
+	fmt.Printf("created:    %s\n", b.Created.Format("2006-01-02 15:04:05 MST"))
+	if b.Note != "" {
+		fmt.Printf("note:       %s\n", b.Note)
+	}
+	for _, e := range result.Endorsers {
+		fmt.Printf("endorser %d: %s %q\n", e.Hop, e.KeyID, e.Metadata)
+	}
+	return nil
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+	"github.com/miki799/schnorr-signature/threshold"
+)
+
+/*
+Threshold signing ceremony for operators
+
+The ceremony runs on one (preferably offline) machine the custodians of the
+shares come to. Every round prints fingerprints of its messages to be read
+out and compared with the custodians and waits for the operator to confirm
+it, the ceremony stops at the first round which isn't confirmed:
+
+	schnorr ceremony deal -key k.pem -t 2 -n 3 -dir shares -operator op.pem
+	schnorr ceremony sign -group shares/group.json -in file -out sig.pem -operator op.pem shares/share-1.hex shares/share-3.hex
+
+deal splits the key into n share files (the original key should be destroyed
+afterwards), sign takes the shares of the signing set, runs both rounds of
+package threshold and writes the combined signature. Both write a JSON
+transcript of the rounds signed by the operator key, name.sig next to it.
+Threshold key generation without a dealer (DKG) isn't available, the key is
+always split by deal.
+*/
+
+var errCeremonyAborted = errors.New("ceremony aborted by the operator")
+
+func runCeremony(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected deal or sign")
+	}
+	switch args[0] {
+	case "deal":
+		return runCeremonyDeal(args[1:])
+	case "sign":
+		return runCeremonySign(args[1:])
+	}
+	return fmt.Errorf("unknown ceremony %q, expected deal or sign", args[0])
+}
+
+/*
+Signed record of a ceremony
+*/
+type ceremonyTranscript struct {
+	Ceremony     string          `json:"ceremony"` // "deal" or "sign"
+	Started      time.Time       `json:"started"`
+	Finished     time.Time       `json:"finished"`
+	Operator     string          `json:"operator"`  // key ID of the operator key signing the transcript
+	GroupKey     string          `json:"group_key"` // key ID of the split key
+	Threshold    int             `json:"threshold"`
+	Participants []int           `json:"participants"`
+	Message      string          `json:"message_sha256,omitempty"`
+	Rounds       []ceremonyRound `json:"rounds"`
+	Signature    string          `json:"signature,omitempty"` // hex, combined signature of sign
+}
+
+type ceremonyRound struct {
+	Name      string          `json:"name"`
+	Entries   []ceremonyEntry `json:"entries"`
+	Confirmed time.Time       `json:"confirmed"`
+}
+
+type ceremonyEntry struct {
+	Index       int    `json:"index"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+/*
+Public data of the split key, group.json
+*/
+type groupKeyFile struct {
+	PublicKey string            `json:"public_key"` // hex
+	Threshold int               `json:"threshold"`
+	Shares    map[string]string `json:"shares"` // hex public shares by index
+}
+
+/*
+Operator interaction: fingerprints to stdout, confirmations from stdin
+*/
+type ceremonyOperator struct {
+	in  *bufio.Reader
+	out io.Writer
+	yes bool // confirm every round without asking
+}
+
+/*
+Print the round and wait for the confirmation, the confirmed round is added
+to the transcript
+*/
+func (o *ceremonyOperator) round(t *ceremonyTranscript, name, hint string, entries []ceremonyEntry) error {
+	fmt.Fprintf(o.out, "\n== Round %d: %s\n", len(t.Rounds)+1, name)
+	if hint != "" {
+		fmt.Fprintln(o.out, hint)
+	}
+	for _, e := range entries {
+		fmt.Fprintf(o.out, "  participant %-3d %s\n", e.Index, e.Fingerprint)
+	}
+	if err := o.confirm("Do the fingerprints match?"); err != nil {
+		return err
+	}
+	t.Rounds = append(t.Rounds, ceremonyRound{name, entries, schnorr.Now().UTC()})
+	return nil
+}
+
+func (o *ceremonyOperator) confirm(question string) error {
+	fmt.Fprintf(o.out, "%s [y/N] ", question)
+	if o.yes {
+		fmt.Fprintln(o.out, "y (-yes)")
+		return nil
+	}
+	answer, err := o.in.ReadString('\n')
+	if err != nil && answer == "" {
+		return errCeremonyAborted
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errCeremonyAborted
+}
+
+/*
+Split -key into -n shares with threshold -t, written to dir/share-i.hex with
+the public data in dir/group.json
+*/
+func runCeremonyDeal(args []string) error {
+	flags := flag.NewFlagSet("ceremony deal", flag.ContinueOnError)
+	keyFile := flags.String("key", "", "private key to split (PEM)")
+	t := flags.Int("t", 2, "threshold, shares needed to sign")
+	n := flags.Int("n", 3, "number of shares")
+	dir := flags.String("dir", ".", "directory of the share files")
+	operatorFile := flags.String("operator", "", "operator key signing the transcript (PEM), -key if empty")
+	transcriptFile := flags.String("transcript", "", "transcript file, dir/deal-transcript.json if empty")
+	yes := flags.Bool("yes", false, "confirm every round without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sk, pk, err := readSignatureKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	operatorSK, operatorPK := sk, pk
+	if *operatorFile != "" {
+		if operatorSK, operatorPK, err = readSignatureKey(*operatorFile); err != nil {
+			return err
+		}
+	}
+	if *transcriptFile == "" {
+		*transcriptFile = filepath.Join(*dir, "deal-transcript.json")
+	}
+
+	op := &ceremonyOperator{in: bufio.NewReader(os.Stdin), out: os.Stdout, yes: *yes}
+	transcript := &ceremonyTranscript{
+		Ceremony:  "deal",
+		Started:   schnorr.Now().UTC(),
+		Operator:  operatorPK.KeyID(),
+		GroupKey:  pk.KeyID(),
+		Threshold: *t,
+	}
+	fmt.Fprintf(op.out, "Splitting key %s into %d shares, any %d of them sign\n", pk.KeyID(), *n, *t)
+	fmt.Fprintf(op.out, "Key fingerprint: %s\n", fingerprint(pk.Bytes()))
+	if err := op.confirm("Is this the key to split?"); err != nil {
+		return err
+	}
+
+	shares, group, err := threshold.NewDealer(sk, pk).Split(*t, *n)
+	if err != nil {
+		return err
+	}
+	entries := make([]ceremonyEntry, 0, len(shares))
+	for _, share := range shares {
+		transcript.Participants = append(transcript.Participants, share.Index)
+		entries = append(entries, ceremonyEntry{share.Index, fingerprint(publicShare(group, share.Index))})
+	}
+	err = op.round(transcript, "public shares",
+		"Every custodian writes down the fingerprint of the public share, it identifies the share at signing ceremonies.", entries)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		return err
+	}
+	for _, share := range shares {
+		path := filepath.Join(*dir, fmt.Sprintf("share-%d.hex", share.Index))
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(share.Bytes())+"\n"), 0o600); err != nil {
+			return err
+		}
+		fmt.Fprintf(op.out, "share %d written to %s\n", share.Index, path)
+	}
+	groupFile := filepath.Join(*dir, "group.json")
+	if err := writeGroupKey(groupFile, group); err != nil {
+		return err
+	}
+	fmt.Fprintf(op.out, "group key written to %s\n", groupFile)
+
+	transcript.Finished = schnorr.Now().UTC()
+	return writeTranscript(op.out, *transcriptFile, transcript, operatorSK)
+}
+
+/*
+Sign -in with the shares given as arguments, at least the threshold of them
+*/
+func runCeremonySign(args []string) error {
+	flags := flag.NewFlagSet("ceremony sign", flag.ContinueOnError)
+	groupFile := flags.String("group", "group.json", "group key written by ceremony deal")
+	in := flags.String("in", "", "file to sign")
+	out := flags.String("out", "", "signature file (PEM)")
+	operatorFile := flags.String("operator", "", "operator key signing the transcript (PEM)")
+	transcriptFile := flags.String("transcript", "", "transcript file, out.transcript.json if empty")
+	yes := flags.Bool("yes", false, "confirm every round without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" || *out == "" {
+		return errors.New("missing -in or -out, stdin is used for the confirmations")
+	}
+	operatorSK, operatorPK, err := readSignatureKey(*operatorFile)
+	if err != nil {
+		return err
+	}
+	group, err := readGroupKey(*groupFile)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	// signed like SignReader, the signature is checked with schnorr verify
+	digest := sha256.Sum256(content)
+	message := string(digest[:])
+	signing := &threshold.GroupKey{PublicKey: group.PublicKey.WithContext(schnorr.StreamContext), Threshold: group.Threshold, Shares: group.Shares}
+	if *transcriptFile == "" {
+		*transcriptFile = *out + ".transcript.json"
+	}
+
+	participants := make([]*threshold.Participant, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		share, err := readKeyShare(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if _, ok := group.Shares[share.Index]; !ok || share.Threshold != group.Threshold {
+			return fmt.Errorf("%s: share %d doesn't belong to the group key", path, share.Index)
+		}
+		for _, pt := range participants {
+			if pt.Index() == share.Index {
+				return fmt.Errorf("%s: share %d given twice", path, share.Index)
+			}
+		}
+		participants = append(participants, threshold.NewParticipant(share, signing))
+	}
+	if len(participants) < group.Threshold {
+		return fmt.Errorf("%d shares given, the group key needs %d", len(participants), group.Threshold)
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].Index() < participants[j].Index() })
+
+	op := &ceremonyOperator{in: bufio.NewReader(os.Stdin), out: os.Stdout, yes: *yes}
+	transcript := &ceremonyTranscript{
+		Ceremony:  "sign",
+		Started:   schnorr.Now().UTC(),
+		Operator:  operatorPK.KeyID(),
+		GroupKey:  group.PublicKey.KeyID(),
+		Threshold: group.Threshold,
+		Message:   hex.EncodeToString(digest[:]),
+	}
+	fmt.Fprintf(op.out, "Signing %s (%d bytes) with group key %s\n", *in, len(content), group.PublicKey.KeyID())
+	fmt.Fprintf(op.out, "Message SHA-256:  %s\n", transcript.Message)
+	fmt.Fprintf(op.out, "Key fingerprint:  %s\n", fingerprint(group.PublicKey.Bytes()))
+	if err := op.confirm("Is this the message and the key to sign with?"); err != nil {
+		return err
+	}
+
+	entries := make([]ceremonyEntry, 0, len(participants))
+	for _, pt := range participants {
+		transcript.Participants = append(transcript.Participants, pt.Index())
+		entries = append(entries, ceremonyEntry{pt.Index(), fingerprint(publicShare(group, pt.Index()))})
+	}
+	err = op.round(transcript, "participants",
+		"Every custodian compares the fingerprint of the public share written down at the deal.", entries)
+	if err != nil {
+		return err
+	}
+
+	commitments := make([]*threshold.Commitment, 0, len(participants))
+	entries = make([]ceremonyEntry, 0, len(participants))
+	for _, pt := range participants {
+		c, err := pt.Commit()
+		if err != nil {
+			return err
+		}
+		commitments = append(commitments, c)
+		entries = append(entries, ceremonyEntry{c.Index, fingerprint(c.D, c.E)})
+	}
+	err = op.round(transcript, "nonce commitments",
+		"Read the fingerprints out to the custodians, every signer has to see the same set of commitments.", entries)
+	if err != nil {
+		return err
+	}
+
+	coordinator := threshold.NewCoordinator(signing)
+	shares := make([]*threshold.SignatureShare, 0, len(participants))
+	entries = make([]ceremonyEntry, 0, len(participants))
+	for _, pt := range participants {
+		share, err := pt.Sign(message, commitments)
+		if err != nil {
+			return fmt.Errorf("participant %d: %w", pt.Index(), err)
+		}
+		if err := coordinator.VerifyShare(message, commitments, share); err != nil {
+			return fmt.Errorf("participant %d: %w", pt.Index(), err)
+		}
+		shares = append(shares, share)
+		entries = append(entries, ceremonyEntry{share.Index, fingerprint(share.Z.Bytes())})
+	}
+	err = op.round(transcript, "signature shares",
+		"Every share was checked against the public share of its participant.", entries)
+	if err != nil {
+		return err
+	}
+
+	signature, err := coordinator.Aggregate(message, commitments, shares)
+	if err != nil {
+		return err
+	}
+	encoded, err := signature.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(*out, encoded); err != nil {
+		return err
+	}
+	fmt.Fprintf(op.out, "\nSignature verified against %s, written to %s\n", group.PublicKey.KeyID(), *out)
+
+	transcript.Signature = hex.EncodeToString(signature.Bytes())
+	transcript.Finished = schnorr.Now().UTC()
+	return writeTranscript(op.out, *transcriptFile, transcript, operatorSK)
+}
+
+/*
+Short fingerprint to read out: first 16 bytes of SHA-256 in groups of 4 hex digits
+*/
+func fingerprint(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	sum := hex.EncodeToString(h.Sum(nil)[:16])
+	groups := make([]string, 0, len(sum)/4)
+	for i := 0; i < len(sum); i += 4 {
+		groups = append(groups, sum[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
+
+/*
+Write the transcript and its signature by the operator key to path.sig,
+checked with schnorr verify -in path -sig path.sig
+*/
+func writeTranscript(out io.Writer, path string, t *ceremonyTranscript, sk *schnorr.SignatureKey) error {
+	encoded, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	encoded = append(encoded, '\n')
+	signature, err := schnorr.SignReader(bytes.NewReader(encoded), sk)
+	if err != nil {
+		return err
+	}
+	signaturePEM, err := signature.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, encoded, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".sig", signaturePEM, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "transcript written to %s, signed by %s (%s.sig)\n", path, t.Operator, path)
+	return nil
+}
+
+func writeGroupKey(path string, group *threshold.GroupKey) error {
+	f := groupKeyFile{PublicKey: group.PublicKey.Hex(), Threshold: group.Threshold, Shares: make(map[string]string)}
+	for index := range group.Shares {
+		f.Shares[strconv.Itoa(index)] = hex.EncodeToString(publicShare(group, index))
+	}
+	encoded, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(encoded, '\n'), 0o644)
+}
+
+func readGroupKey(path string) (*threshold.GroupKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f groupKeyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	pk, err := schnorr.ParsePublicKeyHex(f.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	group := &threshold.GroupKey{PublicKey: pk, Threshold: f.Threshold, Shares: make(map[int]schnorr.Element)}
+	for index, y := range f.Shares {
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 1 {
+			return nil, fmt.Errorf("%s: invalid share index %q", path, index)
+		}
+		encoded, err := hex.DecodeString(y)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid public share %d", path, i)
+		}
+		if group.Shares[i], err = pk.Group().Decode(encoded); err != nil {
+			return nil, fmt.Errorf("%s: invalid public share %d", path, i)
+		}
+	}
+	if group.Threshold < 1 || group.Threshold > len(group.Shares) {
+		return nil, fmt.Errorf("%s: %w", path, threshold.ErrInvalidThreshold)
+	}
+	return group, nil
+}
+
+func readKeyShare(path string) (*threshold.KeyShare, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return threshold.ParseKeyShare(b)
+}
+
+/*
+Encoding of the public share Y_i of the participant
+*/
+func publicShare(group *threshold.GroupKey, index int) []byte {
+	encoded, _ := group.PublicKey.Group().Encode(group.Shares[index])
+	return encoded
+}
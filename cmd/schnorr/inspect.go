@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Describe artifact read from the file (or stdin), encoded as PEM, raw bytes, hex
+or base64. Private keys are described by their public key, the secret isn't printed.
+*/
+func runInspect(args []string) error {
+	var data []byte
+	var err error
+	switch len(args) {
+	case 0:
+		data, err = io.ReadAll(os.Stdin)
+	case 1:
+		data, err = os.ReadFile(args[0])
+	default:
+		return errors.New("too many arguments")
+	}
+	if err != nil {
+		return err
+	}
+
+	d, err := inspect(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Print(d)
+	return err
+}
+
+func inspect(data []byte) (*schnorr.Description, error) {
+	for _, candidate := range decodings(data) {
+		d, err := envelope.Describe(candidate.data)
+		if err != nil {
+			d, err = schnorr.Describe(candidate.data)
+		}
+		if err == nil {
+			if candidate.kind != "" {
+				d.Kind = candidate.kind
+			}
+			d.Add("input encoding", candidate.encoding)
+			return d, nil
+		}
+	}
+	return nil, schnorr.ErrUnknownArtifact
+}
+
+type decoding struct {
+	encoding string
+	data     []byte
+	kind     string // replaces the kind of the description if set
+}
+
+/*
+Possible interpretations of the input, text encodings first
+*/
+func decodings(data []byte) []decoding {
+	if block, _ := pem.Decode(data); block != nil {
+		return []decoding{pemDecoding(block)}
+	}
+
+	var candidates []decoding
+	text := bytes.TrimSpace(data)
+	if b, err := hex.DecodeString(string(text)); err == nil {
+		candidates = append(candidates, decoding{"hex", b, ""})
+	}
+	if b, err := base64.StdEncoding.DecodeString(string(text)); err == nil {
+		candidates = append(candidates, decoding{"base64", b, ""})
+	}
+	if b, err := base64.RawURLEncoding.DecodeString(string(text)); err == nil {
+		candidates = append(candidates, decoding{"base64url", b, ""})
+	}
+	return append(candidates, decoding{"binary", data, ""})
+}
+
+/*
+Keys and signatures in PEM hold DER, converted to the binary encodings
+schnorr.Describe parses
+*/
+func pemDecoding(block *pem.Block) decoding {
+	encoding := "PEM " + block.Type
+	switch block.Type {
+	case schnorr.PEMPublicKey:
+		if pk, err := schnorr.ParsePublicKeyDER(block.Bytes); err == nil {
+			return decoding{encoding, pk.Bytes(), ""}
+		}
+	case schnorr.PEMPrivateKey:
+		if sk, pk, err := schnorr.ParseSignatureKeyDER(block.Bytes); err == nil {
+			sk.Zeroize()
+			return decoding{encoding, pk.Bytes(), "private key (public key shown)"}
+		}
+	case schnorr.PEMSignature:
+		if signature, err := schnorr.ParseSignatureDER(block.Bytes); err == nil {
+			return decoding{encoding, signature.Bytes(), ""}
+		}
+	}
+	return decoding{encoding, block.Bytes, ""}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Files written by keygen and sign are described by inspect as they are, in PEM
+*/
+func TestKeygenInspect(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "key")
+	if err := runKeygen([]string{"-out", base, "-params", "4"}); err != nil {
+		t.Fatal(err)
+	}
+	sk, pk, err := readSignatureKey(base + ".pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := schnorr.TrySign("message", sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signaturePEM, err := signature.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "message.sig"), signaturePEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		file, kind, encoding string
+	}{
+		{"key.pub.pem", "public key", "PEM " + schnorr.PEMPublicKey},
+		{"key.pem", "private key (public key shown)", "PEM " + schnorr.PEMPrivateKey},
+		{"message.sig", "signature", "PEM " + schnorr.PEMSignature},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := inspect(data)
+		if err != nil {
+			t.Fatalf("%s: %v", test.file, err)
+		}
+		if d.Kind != test.kind || !strings.Contains(d.String(), test.encoding) {
+			t.Errorf("%s described as\n%s", test.file, d)
+		}
+		if test.kind != "signature" && !strings.Contains(d.String(), pk.KeyID()) {
+			t.Errorf("%s: key ID missing from\n%s", test.file, d)
+		}
+	}
+
+	// the hex form keeps working
+	d, err := inspect([]byte(hex.EncodeToString(pk.Bytes())))
+	if err != nil || d.Kind != "public key" {
+		t.Fatalf("hex public key: %v", err)
+	}
+
+	if _, err := inspect([]byte("-----BEGIN SCHNORR PUBLIC KEY-----\nAAAA\n-----END SCHNORR PUBLIC KEY-----\n")); err != schnorr.ErrUnknownArtifact {
+		t.Errorf("malformed PEM: %v", err)
+	}
+}
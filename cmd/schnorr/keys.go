@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Generate a key pair, written as PEM to name.pem (private) and name.pub.pem (public)
+*/
+func runKeygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	out := flags.String("out", "schnorr", "base name of the key files")
+	params := flags.Uint("params", uint(schnorr.ParamsMODP2048), "registered group ID: 2 MODP-2048, 3 secp256k1, 4 P-256")
+	env := flags.String("env", "", "environment tag bound into the signatures of the key, e.g. prod or staging")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *params > 0xffff {
+		return schnorr.ErrUnknownParams
+	}
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(uint16(*params))
+	if err != nil {
+		return err
+	}
+	if *env != "" {
+		if sk, pk, err = schnorr.TagEnvironment(sk, *env); err != nil {
+			return err
+		}
+	}
+
+	private, err := sk.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	public, err := pk.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out+".pem", private, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out+".pub.pem", public, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("key id: %s\n", pk.KeyID())
+	return nil
+}
+
+/*
+Sign the content of a file (stdin without -in), the signature is written as PEM
+*/
+func runSign(args []string) error {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	keyFile := flags.String("key", "", "private key file (PEM)")
+	in := flags.String("in", "", "file to sign, stdin if empty")
+	out := flags.String("out", "", "signature file, stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sk, _, err := readSignatureKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	input, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	signature, err := schnorr.SignReader(input, sk)
+	if err != nil {
+		return err
+	}
+	encoded, err := signature.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, encoded)
+}
+
+/*
+Verify the signature of a file (stdin without -in), fails if it isn't valid.
+With -debug the verification report is printed, see schnorr.VerifySignatureDetailed.
+*/
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	pubFile := flags.String("pub", "", "public key file (PEM or hex)")
+	in := flags.String("in", "", "signed file, stdin if empty")
+	sigFile := flags.String("sig", "", "signature file (PEM or hex)")
+	debug := flags.Bool("debug", false, "print the values of the verification equation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	pk, err := readPublicKey(*pubFile)
+	if err != nil {
+		return err
+	}
+	signature, err := readSignature(*sigFile)
+	if err != nil {
+		return err
+	}
+
+	input, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	if *debug {
+		digest, err := schnorr.StreamDigest(input)
+		if err != nil {
+			return err
+		}
+		schnorr.SetVerifyDebug(true)
+		report := schnorr.VerifySignatureDetailed(string(digest[:]), signature, pk.WithContext(schnorr.StreamContext))
+		fmt.Println(report)
+		if !report.Valid {
+			return errors.New("signature is invalid")
+		}
+		return nil
+	}
+	ok, err := schnorr.VerifyReader(input, signature, pk)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("signature is invalid")
+	}
+	fmt.Printf("signature valid, key id %s\n", pk.KeyID())
+	return nil
+}
+
+func readSignatureKey(path string) (*schnorr.SignatureKey, *schnorr.PublicKey, error) {
+	if path == "" {
+		return nil, nil, errors.New("missing -key")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sk, pk, err := schnorr.ParseSignatureKeyPEM(data); err == nil {
+		return sk, pk, nil
+	}
+	return schnorr.ParseSignatureKeyHex(string(bytes.TrimSpace(data)))
+}
+
+func readPublicKey(path string) (*schnorr.PublicKey, error) {
+	if path == "" {
+		return nil, errors.New("missing -pub")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if pk, err := schnorr.ParsePublicKeyPEM(data); err == nil {
+		return pk, nil
+	}
+	return schnorr.ParsePublicKeyHex(string(bytes.TrimSpace(data)))
+}
+
+func readSignature(path string) (*schnorr.Signature, error) {
+	if path == "" {
+		return nil, errors.New("missing -sig")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if signature, err := schnorr.ParseSignaturePEM(data); err == nil {
+		return signature, nil
+	}
+	return schnorr.ParseSignatureHex(string(bytes.TrimSpace(data)))
+}
+
+func openInput(path string) (*os.File, error) {
+	if path == "" {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
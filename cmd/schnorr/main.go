@@ -0,0 +1,85 @@
+/*
+Command line tool for the schnorr package.
+
+Usage:
+
+	schnorr <command> [arguments]
+
+Commands:
+
+	inspect [file]                    describe serialized key, signature, envelope or blind session token
+	bench [-time d] [-backend name]   compare keygen/sign/verify speed of the available backends (-hamming: signing time by key weight, -pool n: nonce pool, -latency: verification percentiles)
+	verify-bundle [-key id] file      verify offline verification bundle
+	attack [name]                     run educational attack demonstration, list them without name
+	tutorial [-bits n] [-trace json]  interactive walkthrough of signing, verification and blind signing
+	keygen [-out name] [-params id]   generate key pair, written to name.pem and name.pub.pem (-env tag: environment tag)
+	sign -key k.pem [-in f] [-out s]  sign file (stdin), PEM signature to -out (stdout)
+	verify -pub p.pem [-in f] -sig s  verify signature of file (stdin)
+	blind-sign -role signer|user ...  one side of the blind signature protocol, JSON messages on stdin/stdout
+	migrate [-w] [path ...]           list (-w: rewrite) uses of deprecated identifiers of the schnorr package
+	self-release -key k.pem [-out d]  cross-compile, hash and sign the CLI's release artifacts (-targets, -version)
+	verify-release -pub p.pem file    verify signed release manifest and the artifacts next to it
+	backup -key k.pem [-out f] keys   encrypted, signed backup of key files, wallet coins (-coins) and key-ring metadata (-meta)
+	restore [-pub p.pem] [-dir d] f   verify, decrypt and restore a backup (-list: only show the contents)
+	ceremony deal|sign [flags] ...    guided threshold key split and signing with out-of-band checks and a signed transcript
+	recovery <step> [flags] ...       social recovery: split (owner), recover (owner), approve (guardian), finalize (owner)
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	run   func(args []string) error
+	usage string
+}
+
+var commands = map[string]command{
+	"inspect":        {runInspect, "inspect [file]"},
+	"bench":          {runBench, "bench [-time d] [-backend name] [-hamming] [-pool n] [-latency]"},
+	"verify-bundle":  {runVerifyBundle, "verify-bundle [-key id] file"},
+	"attack":         {runAttack, "attack [name]"},
+	"tutorial":       {runTutorial, "tutorial [-bits n] [-trace json]"},
+	"keygen":         {runKeygen, "keygen [-out name] [-params id] [-env tag]"},
+	"sign":           {runSign, "sign -key k.pem [-in file] [-out sig]"},
+	"verify":         {runVerify, "verify -pub pub.pem [-in file] -sig sig [-debug]"},
+	"blind-sign":     {runBlindSign, "blind-sign -role signer -key k.pem | -role user -pub pub.pem -in file [-out sig]"},
+	"migrate":        {runMigrate, "migrate [-w] [path ...]"},
+	"self-release":   {runSelfRelease, "self-release -key k.pem [-out dir] [-version v] [-targets os/arch,...]"},
+	"verify-release": {runVerifyRelease, "verify-release -pub pub.pem [-all] manifest.json"},
+	"backup":         {runBackup, "backup -key k.pem [-out file] [-pass-file f] [-coins file] [-meta name=value] key.pem ..."},
+	"restore":        {runRestore, "restore [-pub pub.pem] [-dir dir] [-pass-file f] [-list] [-force] file"},
+	"ceremony":       {runCeremony, "ceremony deal -key k.pem [-t 2] [-n 3] [-dir d] [-operator op.pem] | sign -group group.json -in file -out sig -operator op.pem share ..."},
+	"recovery":       {runRecovery, "recovery split -key k.pem [-t 2] [-n 3] [-dir d] | recover -pub pub.pem [-out request.json] | approve -request request.json -share share.hex -key guardian.pem [-out approval.json] | finalize -request request.json -guardian g.pub.pem ... -out k.pem approval.json ..."},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "schnorr %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: schnorr <command> [arguments]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  schnorr "+commands[name].usage)
+	}
+	os.Exit(2)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const schnorrImportPath = "github.com/miki799/schnorr-signature/schnorr"
+
+/*
+List (or with -w rewrite) uses of the deprecated identifiers of the schnorr
+package in Go files, see schnorr.Deprecations. A path ending in /... is walked
+recursively.
+*/
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	write := flags.Bool("w", false, "rewrite the files in place")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := goFiles(paths)
+	if err != nil {
+		return err
+	}
+	manual := 0
+	for _, name := range files {
+		n, err := migrateFile(name, *write)
+		if err != nil {
+			return err
+		}
+		manual += n
+	}
+	if manual > 0 {
+		return fmt.Errorf("%d uses need to be migrated by hand", manual)
+	}
+	return nil
+}
+
+func goFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		recursive := strings.HasSuffix(path, "/...")
+		if recursive {
+			path = strings.TrimSuffix(path, "/...")
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				base := d.Name()
+				if name != path && (!recursive || base == "vendor" || base == "testdata" || strings.HasPrefix(base, ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(name, ".go") {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+type rewrite struct {
+	pos        token.Position
+	start, end int // byte offsets of the replaced expression
+	text       string
+}
+
+/*
+Report the deprecated uses in the file and rewrite them if write is set,
+returns the number of uses that can't be rewritten
+*/
+func migrateFile(name string, write bool) (int, error) {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	out, manual, err := migrateSource(name, src, schnorr.Deprecations())
+	if err != nil || !write || out == nil {
+		return manual, err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return manual, err
+	}
+	return manual, os.WriteFile(name, out, info.Mode())
+}
+
+/*
+Source with the deprecated uses rewritten, nil if there are none, and the
+number of uses that can't be rewritten. Deprecated calls in the arguments of
+a deprecated call are rewritten too.
+*/
+func migrateSource(name string, src []byte, deprecations []schnorr.Deprecation) ([]byte, int, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+	if err != nil {
+		return nil, 0, err
+	}
+	pkg := importName(file)
+	if pkg == "" {
+		return nil, 0, nil
+	}
+
+	deprecated := make(map[string]ast.Expr)
+	for _, d := range deprecations {
+		replacement, err := parser.ParseExpr(d.Replacement)
+		if err != nil {
+			return nil, 0, fmt.Errorf("replacement of %s: %w", d.Name, err)
+		}
+		deprecated[d.Name] = replacement
+	}
+
+	// uses in source order, enclosing calls before the calls in their arguments
+	type use struct {
+		node     ast.Node
+		sel      *ast.SelectorExpr
+		call     *ast.CallExpr
+		template ast.Expr
+	}
+	var uses []use
+	manual := 0
+	matched := make(map[*ast.SelectorExpr]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		var call *ast.CallExpr
+		sel, ok := n.(*ast.SelectorExpr)
+		if c, isCall := n.(*ast.CallExpr); isCall {
+			call = c
+			sel, ok = c.Fun.(*ast.SelectorExpr)
+		}
+		if !ok || matched[sel] {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Name != pkg || x.Obj != nil {
+			return true
+		}
+		template, ok := deprecated[sel.Sel.Name]
+		if !ok {
+			return true
+		}
+		// the selector of the call is visited next, it is part of this use
+		matched[sel] = true
+		_, templateCall := template.(*ast.CallExpr)
+		if templateCall && call == nil {
+			fmt.Printf("%s: %s.%s used as a value, migrate by hand\n", fset.Position(n.Pos()), pkg, sel.Sel.Name)
+			manual++
+			return true
+		}
+		if !templateCall {
+			// identifier replacement, the call (if any) keeps its arguments
+			// and they are visited as any other expression
+			n, call = sel, nil
+		}
+		uses = append(uses, use{n, sel, call, template})
+		return true
+	})
+
+	// innermost first, so the arguments of a call are rewritten before it
+	var rewrites []rewrite
+	for i := len(uses) - 1; i >= 0; i-- {
+		u := uses[i]
+		pos := fset.Position(u.node.Pos())
+		text, err := instantiate(u.template, pkg, u.call, func(arg ast.Expr) string {
+			return apply(src, fset.Position(arg.Pos()).Offset, fset.Position(arg.End()).Offset, rewrites)
+		})
+		if err != nil {
+			fmt.Printf("%s: %s.%s: %v, migrate by hand\n", pos, pkg, u.sel.Sel.Name, err)
+			manual++
+			continue
+		}
+		start, end := pos.Offset, fset.Position(u.node.End()).Offset
+		rewrites = append(rewrites, rewrite{pos, start, end, text})
+	}
+	sort.Slice(rewrites, func(i, j int) bool { return rewrites[i].start < rewrites[j].start })
+	for _, r := range rewrites {
+		fmt.Printf("%s: %s -> %s\n", r.pos, src[r.start:r.end], r.text)
+	}
+
+	if len(rewrites) == 0 {
+		return nil, manual, nil
+	}
+	out, err := format.Source([]byte(apply(src, 0, len(src), rewrites)))
+	if err != nil {
+		return nil, manual, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, manual, nil
+}
+
+/*
+src[start:end] with the outermost rewrites inside it applied, their text
+already contains the rewrites nested in them
+*/
+func apply(src []byte, start, end int, rewrites []rewrite) string {
+	var inside []rewrite
+	for _, r := range rewrites {
+		if r.start >= start && r.end <= end {
+			inside = append(inside, r)
+		}
+	}
+	sort.Slice(inside, func(i, j int) bool {
+		if inside[i].start != inside[j].start {
+			return inside[i].start < inside[j].start
+		}
+		return inside[i].end > inside[j].end
+	})
+
+	var out []byte
+	last := start
+	for _, r := range inside {
+		if r.start < last {
+			// nested in the previous rewrite
+			continue
+		}
+		out = append(out, src[last:r.start]...)
+		out = append(out, r.text...)
+		last = r.end
+	}
+	return string(append(out, src[last:end]...))
+}
+
+/*
+Local name of the schnorr package in the file, empty if it isn't imported
+(or imported for side effects or with a dot)
+*/
+func importName(file *ast.File) string {
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != schnorrImportPath {
+			continue
+		}
+		if spec.Name == nil {
+			return "schnorr"
+		}
+		if spec.Name.Name == "_" || spec.Name.Name == "." {
+			return ""
+		}
+		return spec.Name.Name
+	}
+	return ""
+}
+
+/*
+Source of the replacement expression: placeholders _1, _2, ... replaced by the
+source of the arguments of the call (see argument) and exported names
+qualified with the package name
+*/
+func instantiate(template ast.Expr, pkg string, call *ast.CallExpr, argument func(ast.Expr) string) (string, error) {
+	if call != nil && call.Ellipsis.IsValid() {
+		return "", fmt.Errorf("variadic call")
+	}
+	// the template is parsed again for every use, so it can be modified
+	expr, err := parser.ParseExpr(exprString(template))
+	if err != nil {
+		return "", err
+	}
+
+	// names that aren't package level identifiers: selected fields and
+	// methods and the keys of composite literals
+	skip := make(map[*ast.Ident]bool)
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			skip[n.Sel] = true
+		case *ast.KeyValueExpr:
+			if key, ok := n.Key.(*ast.Ident); ok {
+				skip[key] = true
+			}
+		}
+		return true
+	})
+
+	ast.Inspect(expr, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || skip[ident] {
+			return true
+		}
+		if strings.HasPrefix(ident.Name, "_") {
+			i, convErr := strconv.Atoi(ident.Name[1:])
+			if convErr != nil || call == nil || i < 1 || i > len(call.Args) {
+				err = fmt.Errorf("no argument for %s", ident.Name)
+				return false
+			}
+			ident.Name = argument(call.Args[i-1])
+		} else if ast.IsExported(ident.Name) {
+			ident.Name = pkg + "." + ident.Name
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	return exprString(expr), nil
+}
+
+func exprString(expr ast.Expr) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, token.NewFileSet(), expr)
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const migrateInput = `package app
+
+import s "github.com/miki799/schnorr-signature/schnorr"
+
+func f(sk *s.SignatureKey) {
+	s.Old(s.Old("a", s.Old("b", nil)), mix(s.Old("c", nil)))
+	s.Renamed(s.Old("d", nil))
+	g := s.Old
+	_ = g
+}
+`
+
+const migrateOutput = `package app
+
+import s "github.com/miki799/schnorr-signature/schnorr"
+
+func f(sk *s.SignatureKey) {
+	s.New(mix(s.New(nil, "c")), s.New(s.New(nil, "b"), "a"))
+	s.Current(s.New(nil, "d"))
+	g := s.Old
+	_ = g
+}
+`
+
+/*
+Deprecated calls nested in the arguments of deprecated calls are rewritten,
+inside out
+*/
+func TestMigrateNested(t *testing.T) {
+	deprecations := []schnorr.Deprecation{
+		{Name: "Old", Replacement: "New(_2, _1)"},
+		{Name: "Renamed", Replacement: "Current"},
+	}
+	out, manual, err := migrateSource("app.go", []byte(migrateInput), deprecations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != migrateOutput {
+		t.Errorf("rewritten to\n%s", out)
+	}
+	// s.Old used as a value
+	if manual != 1 {
+		t.Errorf("%d uses to migrate by hand", manual)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.go")
+	src := `package app
+
+import "github.com/miki799/schnorr-signature/schnorr"
+
+func f(sk *schnorr.SignatureKey) {
+	schnorr.SignWithAux("m", sk, []byte("aux"))
+}
+`
+	if err := os.WriteFile(name, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if manual, err := migrateFile(name, true); err != nil || manual != 0 {
+		t.Fatalf("migrate: %d, %v", manual, err)
+	}
+	out, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package app
+
+import "github.com/miki799/schnorr-signature/schnorr"
+
+func f(sk *schnorr.SignatureKey) {
+	schnorr.SignWithOptions("m", sk, &schnorr.SignOptions{Aux: []byte("aux")})
+}
+`
+	if string(out) != want {
+		t.Errorf("rewritten to\n%s", out)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Social recovery of a key (see schnorr.SplitKey) for both roles
+
+The owner splits the key and hands one share file to every guardian over an
+encrypted channel. To recover, the owner starts a request, every guardian
+checks it out of band (the owner's identity, the key ID) and approves it with
+the share and the guardian key, and the owner combines t approvals into the
+recovered key:
+
+	owner:    schnorr recovery split -key k.pem -t 2 -n 3 -dir shares
+	owner:    schnorr recovery recover -pub k.pub.pem -out request.json
+	guardian: schnorr recovery approve -request request.json -share recovery-share-1.hex -key guardian.pem -out approval-1.json
+	owner:    schnorr recovery finalize -request request.json -guardian g1.pub.pem -guardian g2.pub.pem -out k.pem approval-1.json approval-2.json
+
+Approvals are bound to the request ID and the guardian key, finalize ignores
+approvals of other requests or of keys not given with -guardian.
+*/
+
+func runRecovery(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected split, recover, approve or finalize")
+	}
+	switch args[0] {
+	case "split":
+		return runRecoverySplit(args[1:])
+	case "recover":
+		return runRecoveryRecover(args[1:])
+	case "approve":
+		return runRecoveryApprove(args[1:])
+	case "finalize":
+		return runRecoveryFinalize(args[1:])
+	}
+	return fmt.Errorf("unknown recovery step %q, expected split, recover, approve or finalize", args[0])
+}
+
+/*
+Recovery request of the owner, request.json
+*/
+type recoveryRequestFile struct {
+	RequestID  string `json:"request_id"`
+	OwnerKey   string `json:"owner_key"` // hex public key
+	OwnerKeyID string `json:"owner_key_id"`
+}
+
+/*
+Guardian approval, approval.json
+*/
+type recoveryApprovalFile struct {
+	RequestID     string `json:"request_id"`
+	GuardianKeyID string `json:"guardian_key_id"`
+	Share         string `json:"share"`     // hex, schnorr.RecoveryShare.Bytes
+	Signature     string `json:"signature"` // hex, schnorr.Signature.Bytes
+}
+
+/*
+-guardian pub.pem, repeatable
+*/
+type guardianFlag []string
+
+func (g *guardianFlag) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *guardianFlag) Set(s string) error {
+	*g = append(*g, s)
+	return nil
+}
+
+/*
+Split -key into -n recovery shares with threshold -t, written to
+dir/recovery-share-i.hex
+*/
+func runRecoverySplit(args []string) error {
+	flags := flag.NewFlagSet("recovery split", flag.ContinueOnError)
+	keyFile := flags.String("key", "", "private key to split (PEM)")
+	t := flags.Int("t", 2, "threshold, approvals needed to recover")
+	n := flags.Int("n", 3, "number of shares, one per guardian")
+	dir := flags.String("dir", ".", "directory of the share files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sk, pk, err := readSignatureKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	shares, err := schnorr.SplitKey(sk, pk, *t, *n)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		return err
+	}
+	for _, share := range shares {
+		encoded := share.Bytes()
+		if encoded == nil {
+			return schnorr.ErrInvalidEncoding
+		}
+		path := filepath.Join(*dir, fmt.Sprintf("recovery-share-%d.hex", share.Index))
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(encoded)+"\n"), 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("share %d written to %s\n", share.Index, path)
+	}
+	fmt.Printf("key %s split into %d shares, any %d guardians recover it\n", pk.KeyID(), *n, *t)
+	return nil
+}
+
+/*
+Start the recovery of the key -pub: a request with a fresh ID for the guardians
+*/
+func runRecoveryRecover(args []string) error {
+	flags := flag.NewFlagSet("recovery recover", flag.ContinueOnError)
+	pubFile := flags.String("pub", "", "public key of the key to recover (PEM)")
+	out := flags.String("out", "", "request file (JSON), stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	pk, err := readPublicKey(*pubFile)
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(&recoveryRequestFile{hex.EncodeToString(id), pk.Hex(), pk.KeyID()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(*out, append(encoded, '\n')); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "recovery request %x of key %s, send it to the guardians\n", id, pk.KeyID())
+	return nil
+}
+
+/*
+Guardian: approve the request with the share and the guardian key
+*/
+func runRecoveryApprove(args []string) error {
+	flags := flag.NewFlagSet("recovery approve", flag.ContinueOnError)
+	requestFile := flags.String("request", "", "request file of recovery recover")
+	shareFile := flags.String("share", "", "recovery share of the guardian")
+	keyFile := flags.String("key", "", "guardian key (PEM)")
+	out := flags.String("out", "", "approval file (JSON), stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	request, _, err := readRecoveryRequest(*requestFile)
+	if err != nil {
+		return err
+	}
+	share, err := readRecoveryShare(*shareFile)
+	if err != nil {
+		return err
+	}
+	if share.OwnerKeyID != request.OwnerKeyID {
+		return fmt.Errorf("share of key %s, the request recovers key %s", share.OwnerKeyID, request.OwnerKeyID)
+	}
+	sk, pk, err := readSignatureKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	approval, err := schnorr.ApproveRecovery(request.RequestID, share, sk, pk)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(&recoveryApprovalFile{
+		RequestID:     approval.RequestID,
+		GuardianKeyID: approval.GuardianKeyID,
+		Share:         hex.EncodeToString(share.Bytes()),
+		Signature:     hex.EncodeToString(approval.Signature.Bytes()),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(append(encoded, '\n'))
+	} else {
+		// the approval carries the share
+		err = os.WriteFile(*out, append(encoded, '\n'), 0o600)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "share %d of key %s released for request %s, signed by guardian %s\n",
+		share.Index, request.OwnerKeyID, request.RequestID, pk.KeyID())
+	return nil
+}
+
+/*
+Owner: recover the key from the approvals given as arguments
+*/
+func runRecoveryFinalize(args []string) error {
+	flags := flag.NewFlagSet("recovery finalize", flag.ContinueOnError)
+	requestFile := flags.String("request", "", "request file of recovery recover")
+	out := flags.String("out", "", "recovered private key (PEM)")
+	var guardianFiles guardianFlag
+	flags.Var(&guardianFiles, "guardian", "public key of a guardian (PEM), repeatable")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("missing -out")
+	}
+	request, owner, err := readRecoveryRequest(*requestFile)
+	if err != nil {
+		return err
+	}
+	guardians := make(map[string]*schnorr.PublicKey)
+	for _, path := range guardianFiles {
+		pk, err := readPublicKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		guardians[pk.KeyID()] = pk
+	}
+
+	approvals := make([]*schnorr.RecoveryApproval, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		approval, err := readRecoveryApproval(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		approvals = append(approvals, approval)
+	}
+	sk, err := schnorr.RecoverKey(request.RequestID, owner, guardians, approvals)
+	if err != nil {
+		return err
+	}
+	encoded, err := sk.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, encoded, 0o600); err != nil {
+		return err
+	}
+	fmt.Printf("key %s recovered, written to %s\n", owner.KeyID(), *out)
+	return nil
+}
+
+func readRecoveryRequest(path string) (*recoveryRequestFile, *schnorr.PublicKey, error) {
+	if path == "" {
+		return nil, nil, errors.New("missing -request")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var request recoveryRequestFile
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	owner, err := schnorr.ParsePublicKeyHex(request.OwnerKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if request.RequestID == "" || owner.KeyID() != request.OwnerKeyID {
+		return nil, nil, fmt.Errorf("%s: invalid recovery request", path)
+	}
+	return &request, owner, nil
+}
+
+func readRecoveryShare(path string) (*schnorr.RecoveryShare, error) {
+	if path == "" {
+		return nil, errors.New("missing -share")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.ParseRecoveryShare(b)
+}
+
+func readRecoveryApproval(path string) (*schnorr.RecoveryApproval, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f recoveryApprovalFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	share, err := hex.DecodeString(f.Share)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := schnorr.ParseSignatureHex(f.Signature)
+	if err != nil {
+		return nil, err
+	}
+	approval := &schnorr.RecoveryApproval{RequestID: f.RequestID, GuardianKeyID: f.GuardianKeyID, Signature: signature}
+	if approval.Share, err = schnorr.ParseRecoveryShare(share); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
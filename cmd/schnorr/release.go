@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const cliPackage = "github.com/miki799/schnorr-signature/cmd/schnorr"
+
+const defaultTargets = "linux/amd64,linux/arm64,darwin/amd64,darwin/arm64,windows/amd64"
+
+/*
+Release manifest: the artifacts with their SHA-256 digests, signed as a whole.
+The signature is written next to it (manifest.json.sig) and can be checked with
+`schnorr verify` too, verify-release also checks the artifacts.
+*/
+type releaseManifest struct {
+	Version   string            `json:"version"`
+	KeyID     string            `json:"key_id"`
+	PublicKey string            `json:"public_key"` // hex, PublicKey.Bytes
+	Created   time.Time         `json:"created"`
+	GoVersion string            `json:"go_version"`
+	Artifacts []releaseArtifact `json:"artifacts"`
+}
+
+type releaseArtifact struct {
+	Name   string `json:"name"` // file name, relative to the manifest
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+/*
+Cross-compile the CLI for the targets, hash the binaries and sign the manifest
+*/
+func runSelfRelease(args []string) error {
+	flags := flag.NewFlagSet("self-release", flag.ContinueOnError)
+	keyFile := flags.String("key", "", "private key file (PEM)")
+	out := flags.String("out", "dist", "output directory")
+	version := flags.String("version", "dev", "release version, part of the artifact names")
+	targets := flags.String("targets", defaultTargets, "comma separated GOOS/GOARCH pairs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sk, pk, err := readSignatureKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	goVersion, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return fmt.Errorf("go toolchain: %w", err)
+	}
+
+	manifest := &releaseManifest{
+		Version:   *version,
+		KeyID:     pk.KeyID(),
+		PublicKey: hex.EncodeToString(pk.Bytes()),
+		Created:   time.Now().UTC(),
+		GoVersion: strings.TrimSpace(string(goVersion)),
+	}
+	for _, target := range strings.Split(*targets, ",") {
+		goos, goarch, ok := strings.Cut(strings.TrimSpace(target), "/")
+		if !ok {
+			return fmt.Errorf("invalid target %q, expected GOOS/GOARCH", target)
+		}
+		name := fmt.Sprintf("schnorr_%s_%s_%s", *version, goos, goarch)
+		if goos == "windows" {
+			name += ".exe"
+		}
+
+		fmt.Fprintf(os.Stderr, "building %s\n", name)
+		build := exec.Command("go", "build", "-trimpath", "-ldflags", "-s -w", "-o", filepath.Join(*out, name), cliPackage)
+		build.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+		build.Stdout, build.Stderr = os.Stderr, os.Stderr
+		if err := build.Run(); err != nil {
+			return fmt.Errorf("building %s: %w", target, err)
+		}
+
+		size, digest, err := hashFile(filepath.Join(*out, name))
+		if err != nil {
+			return err
+		}
+		manifest.Artifacts = append(manifest.Artifacts, releaseArtifact{name, goos, goarch, size, digest})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	signature, err := schnorr.SignReader(bytes.NewReader(data), sk)
+	if err != nil {
+		return err
+	}
+	encoded, err := signature.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(*out, "manifest.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".sig", encoded, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("%d artifacts, manifest %s signed by %s\n", len(manifest.Artifacts), path, manifest.KeyID)
+	return nil
+}
+
+/*
+Check the manifest signature with the trusted public key and the digests of
+the artifacts next to it, artifacts missing from the directory are reported
+unless -all is set, which requires every one of them
+*/
+func runVerifyRelease(args []string) error {
+	flags := flag.NewFlagSet("verify-release", flag.ContinueOnError)
+	pubFile := flags.String("pub", "", "trusted public key file (PEM or hex)")
+	all := flags.Bool("all", false, "fail if an artifact of the manifest is missing")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected the manifest file")
+	}
+	path := flags.Arg(0)
+	pk, err := readPublicKey(*pubFile)
+	if err != nil {
+		return err
+	}
+	signature, err := readSignature(path + ".sig")
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if ok, err := schnorr.VerifyReader(bytes.NewReader(data), signature, pk); err != nil || !ok {
+		return errors.New("manifest signature is not valid")
+	}
+
+	var manifest releaseManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	for _, a := range manifest.Artifacts {
+		if a.Name != filepath.Base(a.Name) {
+			return fmt.Errorf("artifact name %q isn't a plain file name", a.Name)
+		}
+		size, digest, err := hashFile(filepath.Join(dir, a.Name))
+		switch {
+		case errors.Is(err, os.ErrNotExist) && !*all:
+			fmt.Printf("missing  %s\n", a.Name)
+		case err != nil:
+			return err
+		case size != a.Size || digest != a.SHA256:
+			return fmt.Errorf("%s doesn't match the manifest", a.Name)
+		default:
+			fmt.Printf("ok       %s\n", a.Name)
+		}
+	}
+	fmt.Printf("release %s signed by %s\n", manifest.Version, pk.KeyID())
+	return nil
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
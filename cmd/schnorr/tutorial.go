@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/miki799/schnorr-signature/internal/tutorial"
+)
+
+/*
+Interactive walkthrough of keygen, signing, verification and blind signing.
+With -trace json the intermediate values are written to stdout as JSON lines
+and the walkthrough text goes to stderr.
+*/
+func runTutorial(args []string) error {
+	flags := flag.NewFlagSet("tutorial", flag.ContinueOnError)
+	bits := flags.Int("bits", 64, "size of the group prime, small values keep the numbers readable")
+	trace := flags.String("trace", "", "write the protocol trace to stdout in the format (json)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	switch *trace {
+	case "":
+		return tutorial.Run(os.Stdin, os.Stdout, *bits)
+	case "json":
+		return tutorial.RunTraced(os.Stdin, os.Stderr, os.Stdout, *bits)
+	default:
+		return fmt.Errorf("unknown trace format %q", *trace)
+	}
+}
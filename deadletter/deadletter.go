@@ -0,0 +1,265 @@
+/*
+Consumer-side verification of signed queue messages with dead-letter routing.
+
+A consumer passes every message through a verifier (envelope for NATS, MQTT
+and other pubsub transports, kafkasign headers for Kafka). Messages which
+verify go to the next handler, the others go to a dead-letter handler with a
+structured Failure instead of being dropped or processed:
+
+	c := &deadletter.KafkaConsumer{
+		Keys:       keys,
+		Next:       process,
+		DeadLetter: deadletter.KafkaDeadLetter(produce, "orders.dlq"),
+	}
+	err := c.Handle(msg) // commit the offset only if err == nil
+
+Handle returns an error only if the message was neither processed nor
+dead-lettered (the next or the dead-letter handler failed), so the consumer
+can retry it instead of losing it.
+*/
+package deadletter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/kafkasign"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Why a message failed verification
+*/
+type Reason string
+
+const (
+	ReasonUnsigned     Reason = "unsigned"      // no signature
+	ReasonMalformed    Reason = "malformed"     // signature or envelope can't be parsed
+	ReasonUnknownKey   Reason = "unknown_key"   // key ID not known to the resolver
+	ReasonBadSignature Reason = "bad_signature" // signature doesn't verify
+	ReasonExpired      Reason = "expired"       // signing key has expired
+	ReasonPolicy       Reason = "policy"        // algorithm suite not accepted, required header not signed
+	ReasonOther        Reason = "other"
+)
+
+/*
+Reason of a verification error of the envelope, kafkasign or schnorr packages
+*/
+func Classify(err error) Reason {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, kafkasign.ErrUnsigned):
+		return ReasonUnsigned
+	case errors.Is(err, envelope.ErrMalformed), errors.Is(err, envelope.ErrVersion), errors.Is(err, schnorr.ErrInvalidEncoding),
+		errors.Is(err, kafkasign.ErrHeaderName):
+		return ReasonMalformed
+	case errors.Is(err, envelope.ErrUnknownKey), errors.Is(err, kafkasign.ErrUnknownKey), errors.Is(err, errUnresolved):
+		return ReasonUnknownKey
+	case errors.Is(err, envelope.ErrBadSignature), errors.Is(err, kafkasign.ErrBadSignature):
+		return ReasonBadSignature
+	case errors.Is(err, envelope.ErrKeyExpired), errors.Is(err, kafkasign.ErrKeyExpired), errors.Is(err, schnorr.ErrKeyExpired):
+		return ReasonExpired
+	case errors.Is(err, envelope.ErrSuiteNotAccepted), errors.Is(err, envelope.ErrUnsupportedSuite), errors.Is(err, kafkasign.ErrMissingHeader):
+		return ReasonPolicy
+	}
+	return ReasonOther
+}
+
+/*
+Message which failed verification, with the original content
+*/
+type Failure struct {
+	Reason  Reason             `json:"reason"`
+	Error   string             `json:"error"`
+	Topic   string             `json:"topic"`
+	KeyID   string             `json:"key_id,omitempty"` // claimed signer, if readable
+	Time    time.Time          `json:"time"`
+	Key     []byte             `json:"key,omitempty"` // Kafka record key
+	Value   []byte             `json:"value"`
+	Headers []kafkasign.Header `json:"headers,omitempty"`
+	Err     error              `json:"-"`
+}
+
+/*
+Receives messages which failed verification, an error means the message
+couldn't be stored and shouldn't be acknowledged
+*/
+type Handler func(f *Failure) error
+
+/*
+Counts of the verified and dead-lettered messages
+*/
+type Stats struct {
+	mu       sync.Mutex
+	verified uint64
+	failed   map[Reason]uint64
+}
+
+func (s *Stats) Verified() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.verified
+}
+
+/*
+Dead-lettered messages by reason
+*/
+func (s *Stats) Failed() map[Reason]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := make(map[Reason]uint64, len(s.failed))
+	for r, n := range s.failed {
+		failed[r] = n
+	}
+	return failed
+}
+
+func (s *Stats) count(r Reason) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r == "" {
+		s.verified++
+		return
+	}
+	if s.failed == nil {
+		s.failed = make(map[Reason]uint64)
+	}
+	s.failed[r]++
+}
+
+var errNoDeadLetter = errors.New("deadletter: message failed verification and no dead-letter handler is set")
+
+/*
+Consumer of messages in signed envelopes (pubsub.SignedPublisher), the topic
+is the additional data of the envelope
+*/
+type EnvelopeConsumer struct {
+	Keys       envelope.KeyResolver
+	Next       func(topic, keyID string, payload []byte) error
+	DeadLetter Handler
+	Stats      Stats
+}
+
+func (c *EnvelopeConsumer) Handle(topic string, data []byte) error {
+	e, err := envelope.Unmarshal(data)
+	if err == nil {
+		err = e.Verify([]byte(topic), resolver{c.Keys})
+	}
+	if err != nil {
+		f := &Failure{Topic: topic, Value: data}
+		if e != nil {
+			f.KeyID = e.KeyID
+		}
+		return reject(&c.Stats, c.DeadLetter, f, err)
+	}
+	c.Stats.count("")
+	return c.Next(topic, e.KeyID, e.Payload)
+}
+
+/*
+Handler for pubsub.VerifyingHandler style clients, errors of Handle go to
+onError (which may be nil)
+*/
+func (c *EnvelopeConsumer) Handler(onError func(topic string, data []byte, err error)) func(topic string, data []byte) {
+	return func(topic string, data []byte) {
+		if err := c.Handle(topic, data); err != nil && onError != nil {
+			onError(topic, data, err)
+		}
+	}
+}
+
+/*
+Consumer of Kafka records signed by kafkasign.ProducerInterceptor
+*/
+type KafkaConsumer struct {
+	Keys       kafkasign.KeyResolver
+	Required   []string // headers the signature has to cover, see kafkasign.NewConsumerInterceptor
+	Next       func(msg *kafkasign.Message, keyID string) error
+	DeadLetter Handler
+	Stats      Stats
+}
+
+func (c *KafkaConsumer) Handle(msg *kafkasign.Message) error {
+	keyID, err := kafkasign.NewConsumerInterceptor(resolver{c.Keys}, c.Required...).OnConsume(msg)
+	if err != nil {
+		f := &Failure{
+			Topic:   msg.Topic,
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: append([]kafkasign.Header(nil), msg.Headers...),
+		}
+		for _, h := range msg.Headers {
+			if h.Key == kafkasign.KeyIDHeader {
+				f.KeyID = string(h.Value)
+			}
+		}
+		return reject(&c.Stats, c.DeadLetter, f, err)
+	}
+	c.Stats.count("")
+	return c.Next(msg, keyID)
+}
+
+/*
+Names of the headers KafkaDeadLetter adds to dead-lettered records
+*/
+const (
+	ReasonHeader        = "schnorr-dlq-reason"
+	ErrorHeader         = "schnorr-dlq-error"
+	OriginalTopicHeader = "schnorr-dlq-topic"
+	FailedAtHeader      = "schnorr-dlq-time"
+)
+
+/*
+Dead-letter handler producing the original record to the topic, with the
+failure in the headers
+*/
+func KafkaDeadLetter(produce func(msg *kafkasign.Message) error, topic string) Handler {
+	return func(f *Failure) error {
+		msg := &kafkasign.Message{
+			Topic: topic,
+			Key:   f.Key,
+			Value: f.Value,
+			Headers: append(append([]kafkasign.Header(nil), f.Headers...),
+				kafkasign.Header{Key: ReasonHeader, Value: []byte(f.Reason)},
+				kafkasign.Header{Key: ErrorHeader, Value: []byte(f.Error)},
+				kafkasign.Header{Key: OriginalTopicHeader, Value: []byte(f.Topic)},
+				kafkasign.Header{Key: FailedAtHeader, Value: []byte(f.Time.Format(time.RFC3339Nano))},
+			),
+		}
+		return produce(msg)
+	}
+}
+
+func reject(stats *Stats, deadLetter Handler, f *Failure, err error) error {
+	f.Reason, f.Error, f.Err, f.Time = Classify(err), err.Error(), err, schnorr.Now().UTC()
+	stats.count(f.Reason)
+	if deadLetter == nil {
+		return fmt.Errorf("%w: %v", errNoDeadLetter, err)
+	}
+	if dlErr := deadLetter(f); dlErr != nil {
+		return fmt.Errorf("deadletter: %s message of %s not stored: %w", f.Reason, f.Topic, dlErr)
+	}
+	return nil
+}
+
+var errUnresolved = errors.New("deadletter: key can't be resolved")
+
+/*
+Marks errors of the key resolver, custom resolvers don't have to return
+envelope.ErrUnknownKey
+*/
+type resolver struct {
+	keys envelope.KeyResolver // same interface as kafkasign.KeyResolver
+}
+
+func (r resolver) PublicKey(keyID string) (*schnorr.PublicKey, error) {
+	pk, err := r.keys.PublicKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnresolved, err)
+	}
+	return pk, nil
+}
@@ -0,0 +1,258 @@
+/*
+Dead-man's switch releasing escrowed material (pre-generated signature, key share)
+when its owner stops sending signed heartbeats.
+
+The owner is considered alive for Interval after the last valid heartbeat.
+During the following Grace period notifier gets warnings, after it the
+escrowed payload is released exactly once.
+*/
+package deadman
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrUnknownSwitch = errors.New("deadman: unknown switch")
+	ErrBadHeartbeat  = errors.New("deadman: invalid heartbeat signature")
+	ErrStale         = errors.New("deadman: heartbeat sequence number not increasing")
+	ErrFuture        = errors.New("deadman: heartbeat timestamp is in the future")
+	ErrReleased      = errors.New("deadman: switch already released")
+)
+
+/*
+Maximum accepted difference between heartbeat timestamp and the local clock
+*/
+const maxClockSkew = 5 * time.Minute
+
+/*
+Persistent state of a single switch
+*/
+type State struct {
+	ID       string
+	Owner    []byte // owner's public key, schnorr.PublicKey.Bytes()
+	Payload  []byte // escrowed material released after the owner goes silent
+	Interval time.Duration
+	Grace    time.Duration
+	LastSeen time.Time
+	LastSeq  uint64
+	Warned   bool
+	Released bool
+}
+
+/*
+Pluggable persistence of switches
+*/
+type Storage interface {
+	Load(id string) (*State, error)
+	Save(s *State) error
+	List() ([]string, error)
+}
+
+/*
+Notification hooks, e.g. e-mail to the owner and to the beneficiaries
+*/
+type Notifier interface {
+	// Owner missed the heartbeat, payload is released at deadline
+	Warn(id string, deadline time.Time)
+	// Payload was released
+	Released(id string, payload []byte)
+}
+
+/*
+Signed proof of life
+*/
+type Heartbeat struct {
+	SwitchID  string
+	Seq       uint64
+	Time      time.Time
+	Signature *schnorr.Signature
+}
+
+/*
+Owner side - create heartbeat for the switch
+*/
+func NewHeartbeat(switchID string, seq uint64, now time.Time, sk *schnorr.SignatureKey) (*Heartbeat, error) {
+	hb := &Heartbeat{SwitchID: switchID, Seq: seq, Time: now}
+	signature, err := schnorr.TrySign(hb.message(), sk)
+	if err != nil {
+		return nil, err
+	}
+	hb.Signature = signature
+	return hb, nil
+}
+
+func (hb *Heartbeat) message() string {
+	h := sha256.New()
+	h.Write([]byte("schnorr/deadman/heartbeat"))
+
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(hb.SwitchID)))
+	buf = append(buf, hb.SwitchID...)
+	buf = binary.BigEndian.AppendUint64(buf, hb.Seq)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(hb.Time.Unix()))
+	h.Write(buf)
+
+	return string(h.Sum(nil))
+}
+
+/*
+Service keeping track of the switches
+*/
+type Service struct {
+	storage  Storage
+	notifier Notifier
+	now      func() time.Time
+
+	mu sync.Mutex
+}
+
+func NewService(storage Storage, notifier Notifier) *Service {
+	return &Service{storage: storage, notifier: notifier, now: schnorr.Now}
+}
+
+/*
+Arm new switch
+*/
+func (s *Service) Arm(id string, owner *schnorr.PublicKey, payload []byte, interval, grace time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.storage.Save(&State{
+		ID:       id,
+		Owner:    owner.Bytes(),
+		Payload:  payload,
+		Interval: interval,
+		Grace:    grace,
+		LastSeen: s.now(),
+	})
+}
+
+/*
+Accept heartbeat of the owner, postponing the release
+*/
+func (s *Service) Heartbeat(hb *Heartbeat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := s.storage.Load(hb.SwitchID)
+	if err != nil {
+		return err
+	}
+	if st.Released {
+		return ErrReleased
+	}
+
+	owner, err := schnorr.ParsePublicKey(st.Owner)
+	if err != nil {
+		return err
+	}
+	if !schnorr.VerifySignature(hb.message(), hb.Signature, owner) {
+		return ErrBadHeartbeat
+	}
+	if hb.Seq <= st.LastSeq {
+		return ErrStale
+	}
+	now := s.now()
+	if hb.Time.After(now.Add(maxClockSkew)) {
+		return ErrFuture
+	}
+
+	st.LastSeq = hb.Seq
+	st.LastSeen = now
+	st.Warned = false
+	return s.storage.Save(st)
+}
+
+/*
+Check all switches, warn about missed heartbeats and release expired ones.
+Should be called periodically, e.g. from a time.Ticker loop.
+*/
+func (s *Service) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.storage.List()
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	for _, id := range ids {
+		st, err := s.storage.Load(id)
+		if err != nil {
+			return err
+		}
+		if st.Released {
+			continue
+		}
+
+		warnAt := st.LastSeen.Add(st.Interval)
+		releaseAt := warnAt.Add(st.Grace)
+
+		switch {
+		case !now.Before(releaseAt):
+			st.Released = true
+			if err := s.storage.Save(st); err != nil {
+				return err
+			}
+			s.notifier.Released(id, st.Payload)
+		case !now.Before(warnAt) && !st.Warned:
+			st.Warned = true
+			if err := s.storage.Save(st); err != nil {
+				return err
+			}
+			s.notifier.Warn(id, releaseAt)
+		}
+	}
+
+	return nil
+}
+
+/*
+In-memory Storage
+*/
+type MemoryStorage struct {
+	mu       sync.Mutex
+	switches map[string]State
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{switches: make(map[string]State)}
+}
+
+func (m *MemoryStorage) Load(id string) (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.switches[id]
+	if !ok {
+		return nil, ErrUnknownSwitch
+	}
+	return &st, nil
+}
+
+func (m *MemoryStorage) Save(s *State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.switches[s.ID] = *s
+	return nil
+}
+
+func (m *MemoryStorage) List() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, len(m.switches))
+	for id := range m.switches {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,482 @@
+/*
+Enrolling a new device with a key (or key shares) held on an existing device.
+
+The new device (Joiner) shows a QR code, the existing device (Sender) scans
+it, the user compares a short authentication string on both screens and the
+key is sent end-to-end encrypted:
+
+	joiner:  Invitation = device name, device key, X25519 share e_J, 16 byte secret   (QR code, URI)
+	sender:  Offer      = X25519 share e_S, sender key, Sign_S(transcript), MAC(transcript)
+	both:    SAS        = 6 digits derived from ECDH(e_J, e_S), the secret and the transcript
+	sender:  Transfer   = AES-GCM of the items after the user confirmed the SAS on the sender
+	joiner:  Receipt    = Sign_J(transcript, digest of the items) after the user confirmed it there
+
+The invitation travels over the camera, so the sender knows it talks to the
+device on the screen. The MAC under the QR secret and the SAS, which depends
+on both X25519 shares, tell the joiner that the offer comes from the device
+which scanned the code, even if somebody filmed the QR code. The sender's
+signature names the key being synced, the receipt signed with the device key
+of the invitation tells the sender that the device stored the items, e.g. to
+add it to a list of enrolled devices.
+
+Items are opaque labelled blobs, the caller serializes keys and shares
+(SignatureKey.Bytes, RecoveryShare encodings and so on).
+*/
+package devicesync
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrInvalidInvitation = errors.New("devicesync: invalid invitation")
+	ErrInvalidMessage    = errors.New("devicesync: invalid message")
+	ErrAuthentication    = errors.New("devicesync: offer doesn't authenticate")
+	ErrNotConfirmed      = errors.New("devicesync: short authentication string not confirmed")
+	ErrState             = errors.New("devicesync: message out of order")
+	ErrBadReceipt        = errors.New("devicesync: invalid receipt")
+)
+
+const (
+	uriScheme     = "schnorr-sync:"
+	invitationVer = 1
+	secretLen     = 16
+)
+
+/*
+Labelled secret sent to the new device
+*/
+type Item struct {
+	Label string
+	Data  []byte
+}
+
+/*
+Content of the QR code shown by the new device
+*/
+type Invitation struct {
+	Device    string             // name of the new device, shown on the sender
+	DeviceKey *schnorr.PublicKey // key the joiner signs the receipt with
+	Ephemeral []byte             // X25519 public key
+	Secret    []byte             // random, known only to devices which saw the QR code
+}
+
+/*
+Encoding: version || len(device) || device || len(key) || key || len(ephemeral) || ephemeral || len(secret) || secret
+*/
+func (inv *Invitation) Bytes() []byte {
+	b := appendField([]byte{invitationVer}, []byte(inv.Device))
+	b = appendField(b, inv.DeviceKey.Bytes())
+	b = appendField(b, inv.Ephemeral)
+	return appendField(b, inv.Secret)
+}
+
+/*
+Invitation as "schnorr-sync:" || base64url(Bytes), for the QR code
+*/
+func (inv *Invitation) URI() string {
+	return uriScheme + base64.RawURLEncoding.EncodeToString(inv.Bytes())
+}
+
+func ParseInvitation(b []byte) (*Invitation, error) {
+	if len(b) == 0 || b[0] != invitationVer {
+		return nil, ErrInvalidInvitation
+	}
+	fields, ok := readFields(b[1:], 4)
+	if !ok || len(fields[3]) != secretLen {
+		return nil, ErrInvalidInvitation
+	}
+	pk, err := schnorr.ParsePublicKey(fields[1])
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+	if _, err := ecdh.X25519().NewPublicKey(fields[2]); err != nil {
+		return nil, ErrInvalidInvitation
+	}
+	return &Invitation{string(fields[0]), pk, fields[2], fields[3]}, nil
+}
+
+func ParseInvitationURI(uri string) (*Invitation, error) {
+	encoded, ok := strings.CutPrefix(uri, uriScheme)
+	if !ok {
+		return nil, ErrInvalidInvitation
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+	return ParseInvitation(b)
+}
+
+/*
+Receipt of the new device for the items it received
+*/
+type Receipt struct {
+	Device    string
+	Digest    []byte // SHA-256 of the encoded items
+	Signature *schnorr.Signature
+}
+
+/*
+Keys both sides derive after the offer
+*/
+type channel struct {
+	transcript []byte // SHA-256 of invitation, sender share and sender key
+	confirm    []byte // MAC key of the offer
+	transfer   []byte // AES-256-GCM key of the transfer
+	sas        string
+}
+
+func deriveChannel(inv *Invitation, senderShare, senderKey, shared []byte) *channel {
+	h := sha256.New()
+	h.Write([]byte("schnorr/devicesync"))
+	h.Write(appendField(nil, inv.Bytes()))
+	h.Write(appendField(nil, senderShare))
+	h.Write(appendField(nil, senderKey))
+	transcript := h.Sum(nil)
+
+	prk := hmacSum(inv.Secret, []byte("schnorr/devicesync"), shared)
+	sas := binary.BigEndian.Uint32(hmacSum(prk, []byte("sas"), transcript))
+	return &channel{
+		transcript: transcript,
+		confirm:    hmacSum(prk, []byte("confirm"), transcript),
+		transfer:   hmacSum(prk, []byte("transfer"), transcript),
+		sas:        fmt.Sprintf("%06d", sas%1000000),
+	}
+}
+
+/*
+New device
+*/
+type Joiner struct {
+	sk         *schnorr.SignatureKey
+	invitation *Invitation
+	ephemeral  *ecdh.PrivateKey
+
+	mu        sync.Mutex
+	ch        *channel
+	sender    *schnorr.PublicKey
+	confirmed bool
+	done      bool
+}
+
+/*
+Joiner with a fresh invitation, sk signs the receipt and pk goes into the invitation
+*/
+func NewJoiner(device string, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) (*Joiner, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(entropy.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret := make([]byte, secretLen)
+	if _, err := io.ReadFull(entropy.Reader, secret); err != nil {
+		return nil, err
+	}
+	inv := &Invitation{device, pk, ephemeral.PublicKey().Bytes(), secret}
+	return &Joiner{sk: sk, invitation: inv, ephemeral: ephemeral}, nil
+}
+
+func (j *Joiner) Invitation() *Invitation {
+	return j.invitation
+}
+
+/*
+Check the offer of the sender and return the SAS to show and the key being
+synced. The user has to compare the SAS with the sender's before Confirm.
+*/
+func (j *Joiner) Accept(offer []byte) (string, *schnorr.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.ch != nil {
+		return "", nil, ErrState
+	}
+	fields, ok := readFields(offer, 4)
+	if !ok {
+		return "", nil, ErrInvalidMessage
+	}
+	share, err := ecdh.X25519().NewPublicKey(fields[0])
+	if err != nil {
+		return "", nil, ErrInvalidMessage
+	}
+	sender, err := schnorr.ParsePublicKey(fields[1])
+	if err != nil {
+		return "", nil, ErrInvalidMessage
+	}
+	signature, err := schnorr.ParseSignature(fields[2])
+	if err != nil {
+		return "", nil, ErrInvalidMessage
+	}
+	shared, err := j.ephemeral.ECDH(share)
+	if err != nil {
+		return "", nil, ErrInvalidMessage
+	}
+
+	ch := deriveChannel(j.invitation, fields[0], fields[1], shared)
+	if !hmac.Equal(fields[3], hmacSum(ch.confirm, []byte("offer"))) {
+		return "", nil, ErrAuthentication
+	}
+	if !schnorr.VerifyBytes(offerMessage(ch.transcript), signature, sender) {
+		return "", nil, ErrAuthentication
+	}
+	j.ch, j.sender = ch, sender
+	return ch.sas, sender, nil
+}
+
+/*
+The user confirmed that both devices show the same SAS
+*/
+func (j *Joiner) Confirm() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.confirmed = j.ch != nil
+}
+
+/*
+Decrypt the transfer and sign the receipt for the sender
+*/
+func (j *Joiner) Receive(transfer []byte) ([]Item, []byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.ch == nil || j.done {
+		return nil, nil, ErrState
+	}
+	if !j.confirmed {
+		return nil, nil, ErrNotConfirmed
+	}
+	aead, err := newCipher(j.ch.transfer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(transfer) < aead.NonceSize() {
+		return nil, nil, ErrInvalidMessage
+	}
+	plaintext, err := aead.Open(nil, transfer[:aead.NonceSize()], transfer[aead.NonceSize():], j.ch.transcript)
+	if err != nil {
+		return nil, nil, ErrInvalidMessage
+	}
+	items, err := parseItems(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digest := sha256.Sum256(plaintext)
+	signature, err := schnorr.SignBytes(receiptMessage(j.ch.transcript, j.invitation.Device, digest[:]), j.sk)
+	if err != nil {
+		return nil, nil, err
+	}
+	j.done = true
+	receipt := appendField(appendField(nil, []byte(j.invitation.Device)), digest[:])
+	return items, appendField(receipt, signature.Bytes()), nil
+}
+
+/*
+Existing device holding the key
+*/
+type Sender struct {
+	sk         *schnorr.SignatureKey
+	pk         *schnorr.PublicKey
+	invitation *Invitation
+
+	mu        sync.Mutex
+	ch        *channel
+	confirmed bool
+	digest    []byte // of the sent items
+}
+
+/*
+Sender for the scanned invitation, sk is the key being synced or another key
+identifying the account
+*/
+func NewSender(inv *Invitation, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Sender {
+	return &Sender{sk: sk, pk: pk, invitation: inv}
+}
+
+/*
+Offer for the joiner and the SAS to show
+*/
+func (s *Sender) Offer() ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch != nil {
+		return nil, "", ErrState
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(entropy.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	joinerShare, err := ecdh.X25519().NewPublicKey(s.invitation.Ephemeral)
+	if err != nil {
+		return nil, "", ErrInvalidInvitation
+	}
+	shared, err := ephemeral.ECDH(joinerShare)
+	if err != nil {
+		return nil, "", ErrInvalidInvitation
+	}
+
+	share, key := ephemeral.PublicKey().Bytes(), s.pk.Bytes()
+	ch := deriveChannel(s.invitation, share, key, shared)
+	signature, err := schnorr.SignBytes(offerMessage(ch.transcript), s.sk)
+	if err != nil {
+		return nil, "", err
+	}
+	s.ch = ch
+	offer := appendField(appendField(nil, share), key)
+	offer = appendField(offer, signature.Bytes())
+	return appendField(offer, hmacSum(ch.confirm, []byte("offer"))), ch.sas, nil
+}
+
+/*
+The user confirmed that both devices show the same SAS
+*/
+func (s *Sender) Confirm() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.confirmed = s.ch != nil
+}
+
+/*
+Encrypt the items for the joiner
+*/
+func (s *Sender) Send(items []Item) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil || s.digest != nil {
+		return nil, ErrState
+	}
+	if !s.confirmed {
+		return nil, ErrNotConfirmed
+	}
+	aead, err := newCipher(s.ch.transfer)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(entropy.Reader, nonce); err != nil {
+		return nil, err
+	}
+	plaintext := encodeItems(items)
+	digest := sha256.Sum256(plaintext)
+	s.digest = digest[:]
+	return aead.Seal(nonce, nonce, plaintext, s.ch.transcript), nil
+}
+
+/*
+Check the joiner's receipt for the items sent
+*/
+func (s *Sender) VerifyReceipt(b []byte) (*Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.digest == nil {
+		return nil, ErrState
+	}
+	fields, ok := readFields(b, 3)
+	if !ok {
+		return nil, ErrBadReceipt
+	}
+	signature, err := schnorr.ParseSignature(fields[2])
+	if err != nil {
+		return nil, ErrBadReceipt
+	}
+	r := &Receipt{string(fields[0]), fields[1], signature}
+	if r.Device != s.invitation.Device || !hmac.Equal(r.Digest, s.digest) {
+		return nil, ErrBadReceipt
+	}
+	if !schnorr.VerifyBytes(receiptMessage(s.ch.transcript, r.Device, r.Digest), signature, s.invitation.DeviceKey) {
+		return nil, ErrBadReceipt
+	}
+	return r, nil
+}
+
+func offerMessage(transcript []byte) []byte {
+	return append([]byte("schnorr/devicesync/offer"), transcript...)
+}
+
+func receiptMessage(transcript []byte, device string, digest []byte) []byte {
+	b := append([]byte("schnorr/devicesync/receipt"), transcript...)
+	b = appendField(b, []byte(device))
+	return append(b, digest...)
+}
+
+/*
+Items: count (4 bytes) || for every item: len(label) || label || len(data) || data
+*/
+func encodeItems(items []Item) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(items)))
+	for _, item := range items {
+		b = appendField(appendField(b, []byte(item.Label)), item.Data)
+	}
+	return b
+}
+
+func parseItems(b []byte) ([]Item, error) {
+	if len(b) < 4 {
+		return nil, ErrInvalidMessage
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)/8) {
+		return nil, ErrInvalidMessage
+	}
+	fields, ok := readFields(b[4:], 2*int(n))
+	if !ok {
+		return nil, ErrInvalidMessage
+	}
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = Item{string(fields[2*i]), fields[2*i+1]}
+	}
+	return items, nil
+}
+
+func newCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func hmacSum(key []byte, parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+/*
+Exactly n length prefixed fields
+*/
+func readFields(b []byte, n int) ([][]byte, bool) {
+	fields := make([][]byte, n)
+	for i := range fields {
+		if len(b) < 4 {
+			return nil, false
+		}
+		size := binary.BigEndian.Uint32(b)
+		if uint64(len(b)-4) < uint64(size) {
+			return nil, false
+		}
+		fields[i] = append([]byte(nil), b[4:4+size]...)
+		b = b[4+size:]
+	}
+	return fields, len(b) == 0
+}
@@ -0,0 +1,296 @@
+package devicesync
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk
+}
+
+/*
+Joiner and a sender which scanned its QR code
+*/
+func pair(t *testing.T) (*Joiner, *Sender, *schnorr.PublicKey) {
+	t.Helper()
+	deviceSK, devicePK := keys(t)
+	j, err := NewJoiner("alice's phone", deviceSK, devicePK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := ParseInvitationURI(j.Invitation().URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, pk := keys(t)
+	return j, NewSender(inv, sk, pk), pk
+}
+
+var items = []Item{{"signature key", []byte("encoded key")}, {"recovery share 2", []byte("share")}, {"empty", nil}}
+
+func TestSync(t *testing.T) {
+	j, s, pk := pair(t)
+	offer, senderSAS, err := s.Offer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joinerSAS, sender, err := j.Accept(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joinerSAS != senderSAS || len(joinerSAS) != 6 || !sender.Equal(pk) {
+		t.Fatalf("SAS %s and %s, sender %s", joinerSAS, senderSAS, sender.KeyID())
+	}
+
+	if _, err := s.Send(items); err != ErrNotConfirmed {
+		t.Errorf("send before the SAS was confirmed: %v", err)
+	}
+	s.Confirm()
+	transfer, err := s.Send(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := j.Receive(transfer); err != ErrNotConfirmed {
+		t.Errorf("receive before the SAS was confirmed: %v", err)
+	}
+	j.Confirm()
+	received, receipt, err := j.Receive(transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != len(items) {
+		t.Fatalf("%d items received", len(received))
+	}
+	for i, item := range received {
+		if item.Label != items[i].Label || !bytes.Equal(item.Data, items[i].Data) {
+			t.Errorf("item %d: %q", i, item.Label)
+		}
+	}
+	r, err := s.VerifyReceipt(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Device != "alice's phone" {
+		t.Errorf("receipt of %q", r.Device)
+	}
+
+	if _, _, err := j.Receive(transfer); err != ErrState {
+		t.Errorf("second transfer: %v", err)
+	}
+	if _, err := s.Send(items); err != ErrState {
+		t.Errorf("second send: %v", err)
+	}
+	if _, _, err := s.Offer(); err != ErrState {
+		t.Errorf("second offer: %v", err)
+	}
+	if _, _, err := j.Accept(offer); err != ErrState {
+		t.Errorf("second offer accepted: %v", err)
+	}
+}
+
+func TestState(t *testing.T) {
+	j, s, _ := pair(t)
+	j.Confirm()
+	s.Confirm()
+	if _, _, err := j.Receive(nil); err != ErrState {
+		t.Errorf("transfer before the offer: %v", err)
+	}
+	if _, err := s.Send(items); err != ErrState {
+		t.Errorf("send before the offer: %v", err)
+	}
+	if _, err := s.VerifyReceipt(nil); err != ErrState {
+		t.Errorf("receipt before the transfer: %v", err)
+	}
+
+	// confirming before the offer doesn't count
+	offer, _, err := s.Offer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Send(items); err != ErrNotConfirmed {
+		t.Errorf("send confirmed before the offer: %v", err)
+	}
+	if _, _, err := j.Accept(offer); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := j.Receive(nil); err != ErrNotConfirmed {
+		t.Errorf("receive confirmed before the offer: %v", err)
+	}
+}
+
+/*
+An attacker who didn't scan the QR code, or only filmed it, can't stand in for the sender
+*/
+func TestForgedOffer(t *testing.T) {
+	j, _, _ := pair(t)
+	sk, pk := keys(t)
+
+	guessed := *j.Invitation()
+	guessed.Secret = make([]byte, secretLen)
+	offer, _, err := NewSender(&guessed, sk, pk).Offer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := j.Accept(offer); err != ErrAuthentication {
+		t.Errorf("offer without the QR secret: %v", err)
+	}
+
+	// filmed the code: the MAC verifies, but the SAS differs from the genuine sender's
+	_, genuine, _ := pair(t)
+	filmed, attackerSAS, err := NewSender(j.Invitation(), sk, pk).Offer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genuine.invitation = j.Invitation()
+	_, genuineSAS, err := genuine.Offer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joinerSAS, _, err := j.Accept(filmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joinerSAS != attackerSAS || joinerSAS == genuineSAS {
+		t.Errorf("SAS joiner %s, attacker %s, genuine sender %s", joinerSAS, attackerSAS, genuineSAS)
+	}
+}
+
+func TestTamperedOffer(t *testing.T) {
+	j, s, _ := pair(t)
+	offer, _, err := s.Offer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, _ := readFields(offer, 4)
+
+	_, other := keys(t)
+	otherKey := appendField(appendField(nil, fields[0]), other.Bytes())
+	otherKey = appendField(appendField(otherKey, fields[2]), fields[3])
+	mac := append([]byte(nil), fields[3]...)
+	mac[0] ^= 1
+	badMAC := appendField(appendField(appendField(appendField(nil, fields[0]), fields[1]), fields[2]), mac)
+	for name, bad := range map[string][]byte{
+		"other sender key": otherKey,
+		"changed MAC":      badMAC,
+	} {
+		if _, _, err := j.Accept(bad); err != ErrAuthentication {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	lowOrder := appendField(appendField(appendField(appendField(nil, make([]byte, 32)), fields[1]), fields[2]), fields[3])
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": offer[:len(offer)-1],
+		"trailing":  append(append([]byte(nil), offer...), 0),
+		"low order": lowOrder,
+	} {
+		if _, _, err := j.Accept(bad); err != ErrInvalidMessage {
+			t.Errorf("%s offer: %v", name, err)
+		}
+	}
+	// the genuine offer is still accepted after the rejected ones
+	if _, _, err := j.Accept(offer); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTamperedTransfer(t *testing.T) {
+	j, s, _ := pair(t)
+	offer, _, err := s.Offer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := j.Accept(offer); err != nil {
+		t.Fatal(err)
+	}
+	s.Confirm()
+	j.Confirm()
+	transfer, err := s.Send(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := append([]byte(nil), transfer...)
+	changed[len(changed)-1] ^= 1
+	for name, bad := range map[string][]byte{
+		"changed":   changed,
+		"truncated": transfer[:8],
+	} {
+		if _, _, err := j.Receive(bad); err != ErrInvalidMessage {
+			t.Errorf("%s transfer: %v", name, err)
+		}
+	}
+
+	_, receipt, err := j.Receive(transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, _ := readFields(receipt, 3)
+	otherDevice := appendField(appendField(appendField(nil, []byte("mallory's phone")), fields[1]), fields[2])
+	digest := append([]byte(nil), fields[1]...)
+	digest[0] ^= 1
+	otherDigest := appendField(appendField(appendField(nil, fields[0]), digest), fields[2])
+
+	// signed by another device key than the invitation's
+	otherSK, _ := keys(t)
+	signature, err := schnorr.SignBytes(receiptMessage(s.ch.transcript, "alice's phone", fields[1]), otherSK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner := appendField(appendField(appendField(nil, fields[0]), fields[1]), signature.Bytes())
+	for name, bad := range map[string][]byte{
+		"other device":      otherDevice,
+		"other digest":      otherDigest,
+		"other device key":  otherSigner,
+		"truncated receipt": receipt[:len(receipt)-1],
+	} {
+		if _, err := s.VerifyReceipt(bad); err != ErrBadReceipt {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := s.VerifyReceipt(receipt); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInvitation(t *testing.T) {
+	j, _, _ := pair(t)
+	inv := j.Invitation()
+	parsed, err := ParseInvitation(inv.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Device != inv.Device || !parsed.DeviceKey.Equal(inv.DeviceKey) || !bytes.Equal(parsed.Secret, inv.Secret) {
+		t.Errorf("parsed invitation %+v", parsed)
+	}
+
+	b := inv.Bytes()
+	shortSecret := *inv
+	shortSecret.Secret = inv.Secret[:8]
+	badShare := *inv
+	badShare.Ephemeral = inv.Ephemeral[:31]
+	for name, bad := range map[string][]byte{
+		"empty":        nil,
+		"version":      append([]byte{2}, b[1:]...),
+		"truncated":    b[:len(b)-1],
+		"trailing":     append(append([]byte(nil), b...), 0),
+		"short secret": shortSecret.Bytes(),
+		"bad share":    badShare.Bytes(),
+	} {
+		if _, err := ParseInvitation(bad); err != ErrInvalidInvitation {
+			t.Errorf("%s invitation: %v", name, err)
+		}
+	}
+	for _, uri := range []string{"", "https://example.com", uriScheme + "!!", uriScheme} {
+		if _, err := ParseInvitationURI(uri); err != ErrInvalidInvitation {
+			t.Errorf("URI %q: %v", uri, err)
+		}
+	}
+}
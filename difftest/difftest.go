@@ -0,0 +1,244 @@
+/*
+Differential harness cross-checking signature scheme implementations.
+
+A Scheme is checked against published test vectors (BIP-340 CSV format)
+and against a reference implementation, either another Scheme in the same
+process or an external binary driven through ExecReference. Every difference
+in public keys, signatures or verification results is reported as a Divergence.
+
+BIP340 and EdDSA adapt the bip340 and eddsa packages, the official BIP-340 and
+RFC 8032 vectors they are checked against are in testdata.
+*/
+package difftest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+/*
+Implementation under test. All values use the scheme's standard byte encodings,
+e.g. 32-byte secret keys, x-only public keys and 64-byte signatures for BIP-340.
+*/
+type Scheme interface {
+	Name() string
+	PublicKey(secretKey []byte) ([]byte, error)
+	// Deterministic signing given the auxiliary randomness (ignored by schemes without it)
+	Sign(secretKey, message, auxRand []byte) ([]byte, error)
+	Verify(publicKey, message, signature []byte) bool
+}
+
+/*
+Single test vector, fields which are not set by the vector are nil
+*/
+type Vector struct {
+	Index     int
+	SecretKey []byte
+	PublicKey []byte
+	AuxRand   []byte
+	Message   []byte
+	Signature []byte
+	Valid     bool
+	Comment   string
+}
+
+/*
+Difference between the implementation and the expected value
+*/
+type Divergence struct {
+	Scheme string
+	Vector int // vector index, or -1 for randomized comparisons
+	What   string
+	Got    []byte
+	Want   []byte
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s vector %d: %s: got %x, want %x", d.Scheme, d.Vector, d.What, d.Got, d.Want)
+}
+
+/*
+Load vectors in the format of the official BIP-340 test-vectors.csv:
+
+	index,secret key,public key,aux_rand,message,signature,verification result,comment
+*/
+func LoadBIP340Vectors(r io.Reader) ([]Vector, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("difftest: empty vector file")
+	}
+
+	var vectors []Vector
+	for _, row := range rows[1:] {
+		if len(row) < 7 {
+			return nil, fmt.Errorf("difftest: vector row has %d columns", len(row))
+		}
+
+		v := Vector{Valid: strings.EqualFold(row[6], "TRUE")}
+		if v.Index, err = strconv.Atoi(row[0]); err != nil {
+			return nil, err
+		}
+		fields := []*[]byte{&v.SecretKey, &v.PublicKey, &v.AuxRand, &v.Message, &v.Signature}
+		for i, field := range fields {
+			if *field, err = hex.DecodeString(row[i+1]); err != nil {
+				return nil, fmt.Errorf("difftest: vector %d: %w", v.Index, err)
+			}
+		}
+		// verification-only vectors have no secret key
+		if len(v.SecretKey) == 0 {
+			v.SecretKey = nil
+		}
+		if len(row) > 7 {
+			v.Comment = row[7]
+		}
+
+		vectors = append(vectors, v)
+	}
+
+	return vectors, nil
+}
+
+/*
+Run the scheme against the vectors
+*/
+func CheckVectors(s Scheme, vectors []Vector) []Divergence {
+	var divergences []Divergence
+	report := func(v Vector, what string, got, want []byte) {
+		divergences = append(divergences, Divergence{s.Name(), v.Index, what, got, want})
+	}
+
+	for _, v := range vectors {
+		if v.SecretKey != nil {
+			pk, err := s.PublicKey(v.SecretKey)
+			if err != nil {
+				report(v, "public key: "+err.Error(), nil, v.PublicKey)
+			} else if !bytes.Equal(pk, v.PublicKey) {
+				report(v, "public key", pk, v.PublicKey)
+			}
+
+			signature, err := s.Sign(v.SecretKey, v.Message, v.AuxRand)
+			if err != nil {
+				report(v, "sign: "+err.Error(), nil, v.Signature)
+			} else if !bytes.Equal(signature, v.Signature) {
+				report(v, "signature", signature, v.Signature)
+			}
+		}
+
+		if got := s.Verify(v.PublicKey, v.Message, v.Signature); got != v.Valid {
+			report(v, fmt.Sprintf("verification result %v", got), v.Signature, nil)
+		}
+	}
+
+	return divergences
+}
+
+/*
+Compare two implementations on n random inputs: public keys and signatures
+have to be identical and each implementation has to accept the other's signatures.
+*/
+func Compare(impl, reference Scheme, n int) ([]Divergence, error) {
+	var divergences []Divergence
+	report := func(what string, got, want []byte) {
+		divergences = append(divergences, Divergence{impl.Name(), -1, what, got, want})
+	}
+
+	for i := 0; i < n; i++ {
+		secretKey, message, auxRand := make([]byte, 32), make([]byte, 32), make([]byte, 32)
+		for _, b := range [][]byte{secretKey, message, auxRand} {
+			if _, err := rand.Read(b); err != nil {
+				return nil, err
+			}
+		}
+
+		refPK, err := reference.PublicKey(secretKey)
+		if err != nil {
+			// secret key out of range for the scheme, try another one
+			continue
+		}
+		pk, err := impl.PublicKey(secretKey)
+		if err != nil || !bytes.Equal(pk, refPK) {
+			report("public key", pk, refPK)
+			continue
+		}
+
+		refSig, err := reference.Sign(secretKey, message, auxRand)
+		if err != nil {
+			return nil, err
+		}
+		signature, err := impl.Sign(secretKey, message, auxRand)
+		if err != nil || !bytes.Equal(signature, refSig) {
+			report("signature", signature, refSig)
+		}
+		if !impl.Verify(refPK, message, refSig) {
+			report("rejects reference signature", refSig, nil)
+		}
+		if signature != nil && !reference.Verify(pk, message, signature) {
+			report("reference rejects signature", signature, nil)
+		}
+	}
+
+	return divergences, nil
+}
+
+/*
+Reference implementation run as an external process. The binary is called as
+
+	<path> <args...> pubkey <secret key>
+	<path> <args...> sign <secret key> <message> <aux rand>
+	<path> <args...> verify <public key> <message> <signature>
+
+with hex encoded arguments and has to print hex encoded result (or true/false for verify).
+*/
+type ExecReference struct {
+	Path string
+	Args []string
+}
+
+func (e *ExecReference) Name() string {
+	return e.Path
+}
+
+func (e *ExecReference) PublicKey(secretKey []byte) ([]byte, error) {
+	out, err := e.run("pubkey", secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(out)
+}
+
+func (e *ExecReference) Sign(secretKey, message, auxRand []byte) ([]byte, error) {
+	out, err := e.run("sign", secretKey, message, auxRand)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(out)
+}
+
+func (e *ExecReference) Verify(publicKey, message, signature []byte) bool {
+	out, err := e.run("verify", publicKey, message, signature)
+	return err == nil && strings.EqualFold(out, "true")
+}
+
+func (e *ExecReference) run(command string, args ...[]byte) (string, error) {
+	argv := append(append([]string(nil), e.Args...), command)
+	for _, arg := range args {
+		argv = append(argv, hex.EncodeToString(arg))
+	}
+
+	out, err := exec.Command(e.Path, argv...).Output()
+	if err != nil {
+		return "", fmt.Errorf("difftest: %s %s: %w", e.Path, command, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
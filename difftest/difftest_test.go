@@ -0,0 +1,172 @@
+package difftest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/eddsa"
+)
+
+/*
+Official vectors in testdata, in the column layout of the BIP-340 file:
+bip-0340/test-vectors.csv and the Ed25519, Ed25519ctx and Ed25519ph
+examples of RFC 8032 section 7
+*/
+var vectorFiles = []struct {
+	file   string
+	scheme Scheme
+}{
+	{"testdata/bip340-vectors.csv", BIP340},
+	{"testdata/ed25519-vectors.csv", EdDSA(eddsa.Ed25519, "")},
+	{"testdata/ed25519ctx-vectors.csv", EdDSA(eddsa.Ed25519ctx, "foo")},
+	{"testdata/ed25519ph-vectors.csv", EdDSA(eddsa.Ed25519ph, "")},
+}
+
+func TestVectors(t *testing.T) {
+	for _, f := range vectorFiles {
+		f := f
+		t.Run(f.scheme.Name(), func(t *testing.T) {
+			vectors := load(t, f.file)
+			for _, d := range CheckVectors(f.scheme, vectors) {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+/*
+Every valid vector with a flipped bit in the signature or the message has to
+be rejected
+*/
+func TestTamperedVectors(t *testing.T) {
+	for _, f := range vectorFiles {
+		var tampered []Vector
+		for _, v := range load(t, f.file) {
+			if !v.Valid {
+				continue
+			}
+			sig := append([]byte(nil), v.Signature...)
+			sig[len(sig)-1] ^= 1
+			msg := append(append([]byte(nil), v.Message...), 0)
+			tampered = append(tampered,
+				Vector{Index: v.Index, PublicKey: v.PublicKey, Message: v.Message, Signature: sig},
+				Vector{Index: v.Index, PublicKey: v.PublicKey, Message: msg, Signature: v.Signature})
+		}
+		for _, d := range CheckVectors(f.scheme, tampered) {
+			t.Error(d)
+		}
+	}
+}
+
+/*
+The test binary serves as the external reference: with DIFFTEST_REFERENCE set
+it runs the BIP340 adapter for the command line of ExecReference
+*/
+func TestMain(m *testing.M) {
+	if os.Getenv("DIFFTEST_REFERENCE") != "" {
+		os.Exit(reference(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func reference(args []string) int {
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return 2
+	}
+	command, hexArgs := args[1], args[2:]
+	var in [][]byte
+	for _, a := range hexArgs {
+		b, err := hex.DecodeString(a)
+		if err != nil {
+			return 2
+		}
+		in = append(in, b)
+	}
+
+	switch {
+	case command == "pubkey" && len(in) == 1:
+		pk, err := BIP340.PublicKey(in[0])
+		if err != nil {
+			return 1
+		}
+		fmt.Println(hex.EncodeToString(pk))
+	case command == "sign" && len(in) == 3:
+		sig, err := BIP340.Sign(in[0], in[1], in[2])
+		if err != nil {
+			return 1
+		}
+		fmt.Println(hex.EncodeToString(sig))
+	case command == "verify" && len(in) == 3:
+		fmt.Println(BIP340.Verify(in[0], in[1], in[2]))
+	default:
+		return 2
+	}
+	return 0
+}
+
+func TestExecReference(t *testing.T) {
+	t.Setenv("DIFFTEST_REFERENCE", "1")
+	ref := &ExecReference{Path: os.Args[0], Args: []string{"--"}}
+
+	divergences, err := Compare(BIP340, ref, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range divergences {
+		t.Error(d)
+	}
+
+	for _, d := range CheckVectors(ref, load(t, "testdata/bip340-vectors.csv")[:6]) {
+		t.Error(d)
+	}
+}
+
+/*
+Scheme whose signatures differ from the reference
+*/
+type broken struct {
+	Scheme
+}
+
+func (b broken) Sign(secretKey, message, auxRand []byte) ([]byte, error) {
+	sig, err := b.Scheme.Sign(secretKey, message, auxRand)
+	if err == nil {
+		sig[len(sig)-1] ^= 1
+	}
+	return sig, err
+}
+
+func TestCompareReportsDivergences(t *testing.T) {
+	divergences, err := Compare(broken{BIP340}, BIP340, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(divergences) == 0 {
+		t.Fatal("broken signatures not reported")
+	}
+	if len(CheckVectors(broken{EdDSA(eddsa.Ed25519, "")}, load(t, "testdata/ed25519-vectors.csv"))) == 0 {
+		t.Fatal("broken signatures not reported")
+	}
+}
+
+func load(t *testing.T, file string) []Vector {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	vectors, err := LoadBIP340Vectors(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatalf("no vectors in %s", file)
+	}
+	return vectors
+}
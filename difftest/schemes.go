@@ -0,0 +1,99 @@
+package difftest
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	"github.com/miki799/schnorr-signature/bip340"
+	"github.com/miki799/schnorr-signature/eddsa"
+)
+
+var errKeyLength = errors.New("difftest: invalid key length")
+
+/*
+Package bip340: 32-byte secret keys, x-only public keys and 64-byte
+signatures, messages of any length
+*/
+var BIP340 Scheme = bip340Scheme{}
+
+type bip340Scheme struct{}
+
+func (bip340Scheme) Name() string {
+	return "bip340"
+}
+
+func (bip340Scheme) PublicKey(secretKey []byte) ([]byte, error) {
+	var priv [32]byte
+	if len(secretKey) != len(priv) {
+		return nil, errKeyLength
+	}
+	copy(priv[:], secretKey)
+	pub, err := bip340.PublicKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pub[:], nil
+}
+
+func (bip340Scheme) Sign(secretKey, message, auxRand []byte) ([]byte, error) {
+	var priv, aux [32]byte
+	if len(secretKey) != len(priv) || len(auxRand) != len(aux) {
+		return nil, errKeyLength
+	}
+	copy(priv[:], secretKey)
+	copy(aux[:], auxRand)
+	sig, err := bip340.SignMessageWithAux(message, priv, aux)
+	if err != nil {
+		return nil, err
+	}
+	return sig[:], nil
+}
+
+func (bip340Scheme) Verify(publicKey, message, signature []byte) bool {
+	var pub [32]byte
+	var sig [64]byte
+	if len(publicKey) != len(pub) || len(signature) != len(sig) {
+		return false
+	}
+	copy(pub[:], publicKey)
+	copy(sig[:], signature)
+	return bip340.VerifyMessage(message, sig, pub)
+}
+
+/*
+RFC 8032 variant of package eddsa. Secret keys are the 32-byte seeds, the
+auxiliary randomness is ignored (signing is deterministic).
+*/
+func EdDSA(variant eddsa.Variant, context string) Scheme {
+	return &eddsaScheme{variant, context}
+}
+
+type eddsaScheme struct {
+	variant eddsa.Variant
+	context string
+}
+
+func (s *eddsaScheme) Name() string {
+	return s.variant.String()
+}
+
+func (s *eddsaScheme) PublicKey(secretKey []byte) ([]byte, error) {
+	if len(secretKey) != ed25519.SeedSize {
+		return nil, errKeyLength
+	}
+	return ed25519.NewKeyFromSeed(secretKey).Public().(ed25519.PublicKey), nil
+}
+
+func (s *eddsaScheme) Sign(secretKey, message, _ []byte) ([]byte, error) {
+	if len(secretKey) != ed25519.SeedSize {
+		return nil, errKeyLength
+	}
+	return eddsa.NewSigner(ed25519.NewKeyFromSeed(secretKey), s.variant, s.context).Sign(message)
+}
+
+func (s *eddsaScheme) Verify(publicKey, message, signature []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return eddsa.Verify(publicKey, message, signature, s.variant, s.context) == nil
+}
@@ -0,0 +1,153 @@
+/*
+Ed25519 signing mode with the RFC 8032 variants
+
+	Ed25519     pure, the message is signed as is
+	Ed25519ctx  pure with a context string (1 to 255 bytes) bound to the signature
+	Ed25519ph   the SHA-512 digest of the message is signed, with an optional context
+
+Signatures are produced and checked by crypto/ed25519, so they interoperate
+with any RFC 8032 implementation. The variants are domain separated: a
+signature made with one of them doesn't verify with the others.
+*/
+package eddsa
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+
+	"github.com/miki799/schnorr-signature/entropy"
+)
+
+var (
+	ErrInvalidSignature = errors.New("eddsa: invalid signature")
+	ErrContext          = errors.New("eddsa: context is too long or missing")
+	ErrVariant          = errors.New("eddsa: unknown variant")
+)
+
+type Variant int
+
+const (
+	Ed25519 Variant = iota
+	Ed25519ctx
+	Ed25519ph
+)
+
+func (v Variant) String() string {
+	switch v {
+	case Ed25519:
+		return "Ed25519"
+	case Ed25519ctx:
+		return "Ed25519ctx"
+	case Ed25519ph:
+		return "Ed25519ph"
+	}
+	return fmt.Sprintf("Variant(%d)", int(v))
+}
+
+type Signer struct {
+	Variant Variant
+	Context string // required for Ed25519ctx, optional for Ed25519ph, empty for Ed25519
+
+	key ed25519.PrivateKey
+}
+
+func GenerateKey(variant Variant, context string) (*Signer, ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(entropy.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Signer{variant, context, priv}, pub, nil
+}
+
+func NewSigner(key ed25519.PrivateKey, variant Variant, context string) *Signer {
+	return &Signer{variant, context, key}
+}
+
+func (s *Signer) Public() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+/*
+Sign message, for Ed25519ph the message is hashed with SHA-512 first
+*/
+func (s *Signer) Sign(message []byte) ([]byte, error) {
+	if s.Variant == Ed25519ph {
+		digest := sha512.Sum512(message)
+		return s.SignDigest(digest)
+	}
+	opts, err := options(s.Variant, s.Context)
+	if err != nil {
+		return nil, err
+	}
+	return s.key.Sign(nil, message, opts)
+}
+
+/*
+Ed25519ph only: sign the SHA-512 digest computed by the caller, e.g. of a streamed file
+*/
+func (s *Signer) SignDigest(digest [sha512.Size]byte) ([]byte, error) {
+	if s.Variant != Ed25519ph {
+		return nil, ErrVariant
+	}
+	opts, err := options(s.Variant, s.Context)
+	if err != nil {
+		return nil, err
+	}
+	return s.key.Sign(nil, digest[:], opts)
+}
+
+/*
+Verify signature of message made with the given variant and context
+*/
+func Verify(pub ed25519.PublicKey, message, signature []byte, variant Variant, context string) error {
+	if variant == Ed25519ph {
+		digest := sha512.Sum512(message)
+		return VerifyDigest(pub, digest, signature, context)
+	}
+	opts, err := options(variant, context)
+	if err != nil {
+		return err
+	}
+	if len(pub) != ed25519.PublicKeySize || ed25519.VerifyWithOptions(pub, message, signature, opts) != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+/*
+Verify Ed25519ph signature of the SHA-512 digest
+*/
+func VerifyDigest(pub ed25519.PublicKey, digest [sha512.Size]byte, signature []byte, context string) error {
+	opts, err := options(Ed25519ph, context)
+	if err != nil {
+		return err
+	}
+	if len(pub) != ed25519.PublicKeySize || ed25519.VerifyWithOptions(pub, digest[:], signature, opts) != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func options(variant Variant, context string) (*ed25519.Options, error) {
+	if len(context) > 255 {
+		return nil, ErrContext
+	}
+	switch variant {
+	case Ed25519:
+		if context != "" {
+			return nil, ErrContext
+		}
+		return &ed25519.Options{}, nil
+	case Ed25519ctx:
+		if context == "" {
+			return nil, ErrContext
+		}
+		return &ed25519.Options{Context: context}, nil
+	case Ed25519ph:
+		return &ed25519.Options{Hash: crypto.SHA512, Context: context}, nil
+	}
+	return nil, ErrVariant
+}
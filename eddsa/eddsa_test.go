@@ -0,0 +1,178 @@
+package eddsa
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+/*
+RFC 8032 section 7.2, Ed25519ctx with the context "foo"
+*/
+func TestVector(t *testing.T) {
+	seed := decode(t, "0305334e381af78f141cb666f6199f57bc3495335a256a95bd2a55bf546663f6")
+	pub := decode(t, "dfc9425e4f968f7f0c29f0259cf5f9aed6851c2bb4ad8bfb860cfee0ab248292")
+	message := decode(t, "f726936d19c800494e3fdaff20b276a8")
+	expected := decode(t, "55a4cc2f70a54e04288c5f4cd1e45a7bb520b36292911876cada7323198dd87a"+
+		"8b36950b95130022907a7fb7c4e9b2d5f6cca685a587b4b21f4b888e4e7edb0d")
+
+	s := NewSigner(ed25519.NewKeyFromSeed(seed), Ed25519ctx, "foo")
+	if !s.Public().Equal(ed25519.PublicKey(pub)) {
+		t.Fatalf("public key %x", s.Public())
+	}
+	signature, err := s.Sign(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(signature) != hex.EncodeToString(expected) {
+		t.Fatalf("signature %x", signature)
+	}
+	if err := Verify(pub, message, expected, Ed25519ctx, "foo"); err != nil {
+		t.Error(err)
+	}
+	if err := Verify(pub, message, expected, Ed25519ctx, "bar"); err != ErrInvalidSignature {
+		t.Errorf("signature under another context: %v", err)
+	}
+}
+
+func TestVariants(t *testing.T) {
+	message := []byte("release v1.2.3")
+	for _, test := range []struct {
+		variant Variant
+		context string
+	}{
+		{Ed25519, ""},
+		{Ed25519ctx, "firmware"},
+		{Ed25519ph, ""},
+		{Ed25519ph, "firmware"},
+	} {
+		s, pub, err := GenerateKey(test.variant, test.context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := s.Sign(message)
+		if err != nil {
+			t.Fatalf("%s: %v", test.variant, err)
+		}
+		if err := Verify(pub, message, signature, test.variant, test.context); err != nil {
+			t.Errorf("%s %q: %v", test.variant, test.context, err)
+		}
+
+		// domain separation: no other variant or context accepts the signature
+		for _, other := range []struct {
+			variant Variant
+			context string
+		}{{Ed25519, ""}, {Ed25519ctx, "firmware"}, {Ed25519ctx, "other"}, {Ed25519ph, ""}, {Ed25519ph, "firmware"}} {
+			if other == test {
+				continue
+			}
+			if err := Verify(pub, message, signature, other.variant, other.context); err != ErrInvalidSignature {
+				t.Errorf("%s %q signature checked as %s %q: %v", test.variant, test.context, other.variant, other.context, err)
+			}
+		}
+
+		if err := Verify(pub, []byte("release v1.2.4"), signature, test.variant, test.context); err != ErrInvalidSignature {
+			t.Errorf("%s: other message: %v", test.variant, err)
+		}
+		signature[0] ^= 1
+		if err := Verify(pub, message, signature, test.variant, test.context); err != ErrInvalidSignature {
+			t.Errorf("%s: changed signature: %v", test.variant, err)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	s, pub, err := GenerateKey(Ed25519ph, "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte(strings.Repeat("large file ", 1000))
+	digest := sha512.Sum512(message)
+	signature, err := s.SignDigest(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(pub, message, signature, Ed25519ph, "files"); err != nil {
+		t.Errorf("digest signature checked against the message: %v", err)
+	}
+	if err := VerifyDigest(pub, digest, signature, "files"); err != nil {
+		t.Error(err)
+	}
+	digest[0] ^= 1
+	if err := VerifyDigest(pub, digest, signature, "files"); err != ErrInvalidSignature {
+		t.Errorf("other digest: %v", err)
+	}
+
+	pure, _, err := GenerateKey(Ed25519, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pure.SignDigest(digest); err != ErrVariant {
+		t.Errorf("digest signed with Ed25519: %v", err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	s, pub, err := GenerateKey(Ed25519, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("message")
+	signature, err := s.Sign(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": signature[:63],
+		"trailing":  append(append([]byte(nil), signature...), 0),
+	} {
+		if err := Verify(pub, message, bad, Ed25519, ""); err != ErrInvalidSignature {
+			t.Errorf("%s signature: %v", name, err)
+		}
+	}
+	for name, bad := range map[string]ed25519.PublicKey{
+		"empty":     nil,
+		"truncated": pub[:31],
+	} {
+		if err := Verify(bad, message, signature, Ed25519, ""); err != ErrInvalidSignature {
+			t.Errorf("%s public key: %v", name, err)
+		}
+		if err := VerifyDigest(bad, sha512.Sum512(message), signature, ""); err != ErrInvalidSignature {
+			t.Errorf("%s public key of a digest signature: %v", name, err)
+		}
+	}
+
+	for _, test := range []struct {
+		variant Variant
+		context string
+		err     error
+	}{
+		{Ed25519, "context", ErrContext},
+		{Ed25519ctx, "", ErrContext},
+		{Ed25519ctx, strings.Repeat("c", 256), ErrContext},
+		{Ed25519ph, strings.Repeat("c", 256), ErrContext},
+		{Variant(7), "", ErrVariant},
+	} {
+		if _, err := NewSigner(s.key, test.variant, test.context).Sign(message); err != test.err {
+			t.Errorf("signing as %s with a context of %d bytes: %v", test.variant, len(test.context), err)
+		}
+		if err := Verify(pub, message, signature, test.variant, test.context); err != test.err {
+			t.Errorf("verifying as %s with a context of %d bytes: %v", test.variant, len(test.context), err)
+		}
+	}
+	if Variant(7).String() != "Variant(7)" {
+		t.Errorf("unknown variant named %s", Variant(7))
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Endorsement chains for supply-chain provenance.
+
+Every hop signs the previous signature together with its own metadata, the
+first hop signs the artifact digest instead:
+
+	sig_0 = Sign(H(artifact digest || metadata_0))
+	sig_i = Sign(H(sig_(i-1) || metadata_i))
+
+so endorsements can't be removed, reordered or moved to another artifact.
+*/
+package endorse
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrEmpty     = errors.New("endorse: chain has no endorsements")
+	ErrArtifact  = errors.New("endorse: artifact doesn't match the chain")
+	ErrMalformed = errors.New("endorse: malformed chain")
+)
+
+/*
+Single hop of the chain
+*/
+type Link struct {
+	KeyID     string
+	Metadata  []byte // e.g. processing step description, timestamp
+	Signature *schnorr.Signature
+}
+
+type Chain struct {
+	Digest [32]byte // SHA256 of the artifact
+	Links  []Link
+}
+
+/*
+Endorser reported by the chain verification
+*/
+type Endorser struct {
+	Hop      int
+	KeyID    string
+	Metadata []byte
+}
+
+/*
+Error of the chain verification pointing to the broken hop
+*/
+type HopError struct {
+	Hop int
+	Err error
+}
+
+func (e *HopError) Error() string {
+	return fmt.Sprintf("endorse: hop %d: %v", e.Hop, e.Err)
+}
+
+func (e *HopError) Unwrap() error {
+	return e.Err
+}
+
+func NewChain(artifact []byte) *Chain {
+	return &Chain{Digest: sha256.Sum256(artifact)}
+}
+
+/*
+Append endorsement signed with the given key
+*/
+func (c *Chain) Endorse(metadata []byte, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) error {
+	signature, err := schnorr.TrySign(c.message(len(c.Links), metadata), sk)
+	if err != nil {
+		return err
+	}
+	c.Links = append(c.Links, Link{KeyID: pk.KeyID(), Metadata: metadata, Signature: signature})
+	return nil
+}
+
+/*
+Verify the chain against the artifact and return all endorsers in order
+*/
+func (c *Chain) Verify(artifact []byte, keys envelope.KeyResolver) ([]Endorser, error) {
+	if sha256.Sum256(artifact) != c.Digest {
+		return nil, ErrArtifact
+	}
+	return c.VerifyLinks(keys)
+}
+
+/*
+Verify signatures of the chain without the artifact itself
+*/
+func (c *Chain) VerifyLinks(keys envelope.KeyResolver) ([]Endorser, error) {
+	if len(c.Links) == 0 {
+		return nil, ErrEmpty
+	}
+
+	endorsers := make([]Endorser, 0, len(c.Links))
+	for i, link := range c.Links {
+		pk, err := keys.PublicKey(link.KeyID)
+		if err != nil {
+			return endorsers, &HopError{i, err}
+		}
+		if !schnorr.VerifySignature(c.message(i, link.Metadata), link.Signature, pk) {
+			return endorsers, &HopError{i, envelope.ErrBadSignature}
+		}
+		endorsers = append(endorsers, Endorser{i, link.KeyID, link.Metadata})
+	}
+
+	return endorsers, nil
+}
+
+/*
+Message signed by hop i
+*/
+func (c *Chain) message(hop int, metadata []byte) string {
+	h := sha256.New()
+	h.Write([]byte("schnorr/endorse"))
+	if hop == 0 {
+		h.Write(c.Digest[:])
+	} else {
+		h.Write(lengthPrefixed(c.Links[hop-1].Signature.Bytes()))
+	}
+	h.Write(lengthPrefixed(metadata))
+	return string(h.Sum(nil))
+}
+
+/*
+Encoding: digest || count || (keyID || metadata || signature)* with length prefixed fields
+*/
+func (c *Chain) Marshal() []byte {
+	buf := append([]byte(nil), c.Digest[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(c.Links)))
+	for _, link := range c.Links {
+		buf = append(buf, lengthPrefixed([]byte(link.KeyID))...)
+		buf = append(buf, lengthPrefixed(link.Metadata)...)
+		buf = append(buf, lengthPrefixed(link.Signature.Bytes())...)
+	}
+	return buf
+}
+
+func Unmarshal(b []byte) (*Chain, error) {
+	if len(b) < 36 {
+		return nil, ErrMalformed
+	}
+	c := &Chain{}
+	copy(c.Digest[:], b)
+	count := binary.BigEndian.Uint32(b[32:])
+	b = b[36:]
+
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.BigEndian.Uint32(b)
+		if uint64(len(b)-4) < uint64(n) {
+			return nil, false
+		}
+		field := b[4 : 4+n]
+		b = b[4+n:]
+		return field, true
+	}
+
+	for i := uint32(0); i < count; i++ {
+		keyID, ok1 := next()
+		metadata, ok2 := next()
+		rawSignature, ok3 := next()
+		if !ok1 || !ok2 || !ok3 {
+			return nil, ErrMalformed
+		}
+		signature, err := schnorr.ParseSignature(rawSignature)
+		if err != nil {
+			return nil, err
+		}
+		c.Links = append(c.Links, Link{string(keyID), metadata, signature})
+	}
+	if len(b) != 0 {
+		return nil, ErrMalformed
+	}
+
+	return c, nil
+}
+
+func lengthPrefixed(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+}
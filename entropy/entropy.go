@@ -0,0 +1,224 @@
+/*
+Entropy source of the module and its health tests.
+
+All randomness used by the packages of this module (keys, nonces, blinding
+factors, salts, commitments) is read from Reader, which reads the source set
+with SetSource, crypto/rand.Reader by default. On machines with questionable
+entropy the source can be wrapped in HealthTestedReader, which runs
+continuous health tests from NIST SP 800-90B (section 4.4) on every output
+byte:
+
+  - repetition count test - detects a source stuck on a single value,
+  - adaptive proportion test - detects a single value becoming too frequent.
+
+After the first failure the reader stays failed and every read returns
+ErrHealth, so no key or nonce is ever generated from a bad source:
+
+	h, err := entropy.NewHealthTestedReader(rand.Reader)
+	entropy.SetSource(h)
+
+The package depends only on the standard library, so the protocol packages
+(frost, bip340, ...) use it without depending on package schnorr.
+*/
+package entropy
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sync"
+)
+
+var ErrHealth = errors.New("entropy: source failed health test")
+
+var source = struct {
+	sync.RWMutex
+	r io.Reader
+}{r: rand.Reader}
+
+/*
+Reader of the configured source, shared by the packages of the module
+*/
+var Reader io.Reader = sourceReader{}
+
+type sourceReader struct{}
+
+func (sourceReader) Read(p []byte) (int, error) {
+	return Source().Read(p)
+}
+
+/*
+Set the source of randomness used by the module
+*/
+func SetSource(r io.Reader) {
+	source.Lock()
+	defer source.Unlock()
+	source.r = r
+}
+
+/*
+Configured source of randomness, see SetSource
+*/
+func Source() io.Reader {
+	source.RLock()
+	defer source.RUnlock()
+	return source.r
+}
+
+/*
+Failure of the health tests of the configured source, nil while it passes them
+or if it isn't health tested. Code which doesn't read the source (e.g.
+deterministic signing) checks it to refuse work on a machine with broken
+entropy.
+*/
+func Health() error {
+	if h, ok := Source().(interface{ Err() error }); ok {
+		return h.Err()
+	}
+	return nil
+}
+
+/*
+Uniform random number from [1, n), the error of the source if it fails
+*/
+func Scalar(n *big.Int) (*big.Int, error) {
+	for {
+		k, err := rand.Int(Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		if k.Sign() != 0 {
+			return k, nil
+		}
+	}
+}
+
+const (
+	// assessed min-entropy of a single output byte of the source
+	healthEntropyPerByte = 7.0
+	// false positive probability of the tests, 2^-healthAlphaExp
+	healthAlphaExp = 40
+	// window of the adaptive proportion test for non-binary samples
+	aptWindow = 512
+	// number of samples tested at startup
+	startupSamples = 1024
+)
+
+var (
+	// C = 1 + ceil(-log2(alpha) / H)
+	rctCutoff = 1 + int(math.Ceil(healthAlphaExp/healthEntropyPerByte))
+	aptCutoff = adaptiveProportionCutoff(aptWindow, math.Exp2(-healthEntropyPerByte), math.Exp2(-healthAlphaExp))
+)
+
+/*
+Reader running continuous health tests on the wrapped source
+*/
+type HealthTestedReader struct {
+	src io.Reader
+
+	mu     sync.Mutex
+	failed error
+
+	// repetition count test
+	last  byte
+	count int
+
+	// adaptive proportion test
+	aptFirst byte
+	aptCount int
+	aptSeen  int
+}
+
+/*
+Wrap the source and run the startup tests on it
+*/
+func NewHealthTestedReader(src io.Reader) (*HealthTestedReader, error) {
+	h := &HealthTestedReader{src: src}
+	startup := make([]byte, startupSamples)
+	if _, err := io.ReadFull(h, startup); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+/*
+Failure of the health tests, nil if the source is healthy
+*/
+func (h *HealthTestedReader) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failed
+}
+
+func (h *HealthTestedReader) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.failed != nil {
+		return 0, h.failed
+	}
+
+	n, err := h.src.Read(p)
+	for _, b := range p[:n] {
+		if failure := h.test(b); failure != "" {
+			h.failed = fmt.Errorf("%w: %s", ErrHealth, failure)
+			// don't hand out any of the suspicious bytes
+			for i := range p[:n] {
+				p[i] = 0
+			}
+			return 0, h.failed
+		}
+	}
+	return n, err
+}
+
+func (h *HealthTestedReader) test(b byte) string {
+	if h.count > 0 && b == h.last {
+		h.count++
+		if h.count >= rctCutoff {
+			return "repetition count test"
+		}
+	} else {
+		h.last, h.count = b, 1
+	}
+
+	if h.aptSeen == 0 {
+		h.aptFirst, h.aptCount = b, 1
+	} else if b == h.aptFirst {
+		h.aptCount++
+		if h.aptCount >= aptCutoff {
+			return "adaptive proportion test"
+		}
+	}
+	h.aptSeen++
+	if h.aptSeen == aptWindow {
+		h.aptSeen = 0
+	}
+
+	return ""
+}
+
+/*
+Smallest c such that P(B >= c) <= alpha, where B ~ 1 + Binomial(window - 1, p)
+(the first sample of the window always counts)
+*/
+func adaptiveProportionCutoff(window int, p, alpha float64) int {
+	n := window - 1
+	logP, logQ := math.Log(p), math.Log1p(-p)
+
+	// tail[k] = P(Binomial(n, p) >= k), summed from the top
+	tail := 0.0
+	for k := n; k >= 0; k-- {
+		lgN, _ := math.Lgamma(float64(n + 1))
+		lgK, _ := math.Lgamma(float64(k + 1))
+		lgNK, _ := math.Lgamma(float64(n - k + 1))
+		tail += math.Exp(lgN - lgK - lgNK + float64(k)*logP + float64(n-k)*logQ)
+		if tail > alpha {
+			return k + 2
+		}
+	}
+	return 1
+}
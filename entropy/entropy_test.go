@@ -0,0 +1,63 @@
+package entropy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+)
+
+func TestHealthTests(t *testing.T) {
+	h, err := NewHealthTestedReader(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(h, make([]byte, 1<<16)); err != nil || h.Err() != nil {
+		t.Fatalf("healthy source failed: %v", err)
+	}
+
+	// stuck source fails the startup tests
+	if _, err := NewHealthTestedReader(bytes.NewReader(make([]byte, startupSamples))); !errors.Is(err, ErrHealth) {
+		t.Fatalf("stuck source: %v", err)
+	}
+
+	// a value becoming too frequent fails the adaptive proportion test
+	biased := make([]byte, 4*aptWindow)
+	if _, err := rand.Read(biased); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(biased); i += 2 {
+		biased[i] = 7
+	}
+	if _, err := NewHealthTestedReader(bytes.NewReader(biased)); !errors.Is(err, ErrHealth) {
+		t.Fatalf("biased source: %v", err)
+	}
+}
+
+/*
+Reader and Scalar read the configured source, a failed health test reaches
+every user of the module
+*/
+func TestSetSource(t *testing.T) {
+	defer SetSource(rand.Reader)
+
+	h, err := NewHealthTestedReader(io.MultiReader(io.LimitReader(rand.Reader, startupSamples+64), bytes.NewReader(make([]byte, 64))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSource(h)
+	if _, err := Scalar(big.NewInt(1 << 62)); err != nil || Health() != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(Reader, make([]byte, 128)); !errors.Is(err, ErrHealth) {
+		t.Fatalf("read of the stuck source: %v", err)
+	}
+	if !errors.Is(Health(), ErrHealth) {
+		t.Fatal("Health of the failed source")
+	}
+	if _, err := Scalar(big.NewInt(1 << 62)); !errors.Is(err, ErrHealth) {
+		t.Fatalf("scalar from the failed source: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package envelope
+
+import (
+	"crypto/sha256"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Signature of an additional party (e.g. notary) over the primary signature of the envelope
+*/
+type Countersignature struct {
+	KeyID     string
+	Signature *schnorr.Signature
+}
+
+/*
+Result of the envelope verification with separately reported signers
+*/
+type Verification struct {
+	Primary        string           // key ID of the primary signer
+	Countersigners []string         // key IDs of valid countersignatures, in envelope order
+	Invalid        map[string]error // key IDs of countersignatures which failed verification
+}
+
+/*
+Attach countersignature. The primary signature and payload stay untouched,
+so verifiers unaware of countersignatures still accept the envelope.
+The envelope is left unchanged if signing fails, and ErrTooLarge is returned
+for a countersignature the envelope encoding can't hold.
+*/
+func (e *SignedEnvelope) Countersign(sk *schnorr.SignatureKey, pk *schnorr.PublicKey) error {
+	if len(e.Countersignatures) >= maxCountersignatures {
+		return ErrTooLarge
+	}
+	keyID := pk.KeyID()
+	m, err := e.countersignMessage(keyID)
+	if err != nil {
+		return err
+	}
+	signature, err := schnorr.TrySign(m, sk)
+	if err != nil {
+		return err
+	}
+	e.Countersignatures = append(e.Countersignatures, Countersignature{KeyID: keyID, Signature: signature})
+	return nil
+}
+
+/*
+Verify the primary signature and all countersignatures.
+Error is returned only if the primary signature is invalid, countersignature
+failures are reported in Verification.Invalid.
+*/
+func (e *SignedEnvelope) VerifyAll(aad []byte, keys KeyResolver) (*Verification, error) {
+	if err := e.Verify(aad, keys); err != nil {
+		return nil, err
+	}
+
+	v := &Verification{Primary: e.KeyID, Invalid: make(map[string]error)}
+	for _, cs := range e.Countersignatures {
+		pk, err := keys.PublicKey(cs.KeyID)
+		if err != nil {
+			v.Invalid[cs.KeyID] = err
+			continue
+		}
+		m, err := e.countersignMessage(cs.KeyID)
+		if err != nil {
+			v.Invalid[cs.KeyID] = err
+			continue
+		}
+		if !schnorr.VerifySignature(m, cs.Signature, pk) {
+			v.Invalid[cs.KeyID] = ErrBadSignature
+			continue
+		}
+		v.Countersigners = append(v.Countersigners, cs.KeyID)
+	}
+
+	return v, nil
+}
+
+/*
+H(domain||countersigner keyID||primary keyID||primary signature)
+The primary signature already covers the payload and additional data.
+*/
+func (e *SignedEnvelope) countersignMessage(keyID string) (string, error) {
+	if len(keyID) > 0xff {
+		return "", ErrTooLarge
+	}
+	primary, err := appendSignature(nil, e.KeyID, e.signatureBytes())
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte("schnorr/envelope/countersign"))
+	h.Write(append([]byte{byte(len(keyID))}, keyID...))
+	h.Write(primary)
+	return string(h.Sum(nil)), nil
+}
@@ -0,0 +1,30 @@
+package envelope
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Describe serialized envelope, see schnorr.Describe
+*/
+func Describe(b []byte) (*schnorr.Description, error) {
+	e, err := Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &schnorr.Description{Kind: "signed envelope"}
+	d.Add("version", b[0])
+	d.Add("suite", e.Suite)
+	d.Add("signer", e.KeyID)
+	d.Add("payload", fmt.Sprintf("%d bytes", len(e.Payload)))
+	for _, cs := range e.Countersignatures {
+		d.Add("countersigner", cs.KeyID)
+	}
+	canonical, err := e.Marshal()
+	d.Add("canonical", err == nil && bytes.Equal(canonical, b))
+	return d, nil
+}
@@ -0,0 +1,298 @@
+package envelope
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Encoding versions, envelopes without algorithm suite and countersignatures
+are always encoded with version 1, suite envelopes always with version 3
+*/
+const (
+	version              = 1
+	versionCountersigned = 2
+	versionSuite         = 3
+
+	maxCountersignatures = 0xff // counted in one byte
+)
+
+var (
+	ErrMalformed    = errors.New("envelope: malformed envelope")
+	ErrVersion      = errors.New("envelope: unsupported version")
+	ErrUnknownKey   = errors.New("envelope: unknown key id")
+	ErrBadSignature = errors.New("envelope: invalid signature")
+	ErrKeyExpired   = errors.New("envelope: signing key has expired")
+	ErrTooLarge     = errors.New("envelope: key id, signature or countersignature list too long to encode")
+)
+
+/*
+Payload together with the signature of its producer.
+
+Encoding:
+
+	version (1 byte) || len(keyID) (1 byte) || keyID || len(sig) (2 bytes) || sig || payload
+
+so the overhead is fixed by the key ID and signature size, no matter how big the payload is.
+Countersigned envelopes (version 2) carry countersignatures between the signature and the payload:
+
+	... || sig || count (1 byte) || (len(keyID) || keyID || len(sig) || sig)* || payload
+
+Envelopes with an algorithm suite (version 3, see Suite) carry the suite ID after
+the version and always include the countersignature count:
+
+	version || suite (2 bytes) || len(keyID) || keyID || len(sig) || sig || count || ... || payload
+*/
+type SignedEnvelope struct {
+	KeyID             string
+	Suite             Suite // SuiteLegacy for version 1 and 2 envelopes
+	Payload           []byte
+	Signature         *schnorr.Signature
+	RawSignature      []byte // signature of the suites of other schemes (see multi.go), Signature is nil
+	Countersignatures []Countersignature
+}
+
+/*
+Source of public keys used when opening envelopes
+*/
+type KeyResolver interface {
+	PublicKey(keyID string) (*schnorr.PublicKey, error)
+}
+
+/*
+KeyResolver backed by a static map of key IDs
+*/
+type KeyMap map[string]*schnorr.PublicKey
+
+func (m KeyMap) PublicKey(keyID string) (*schnorr.PublicKey, error) {
+	pk, ok := m[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return pk, nil
+}
+
+/*
+Adds KeyMap entry for the given public key
+*/
+func (m KeyMap) Add(pk *schnorr.PublicKey) {
+	m[pk.KeyID()] = pk
+}
+
+/*
+Signs the payload. aad is additional data bound into the signature but not
+carried by the envelope (e.g. topic name), the same aad has to be passed to Verify.
+Fails with schnorr.ErrKeyExpired if the signing key has expired.
+*/
+func Seal(payload, aad []byte, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) (*SignedEnvelope, error) {
+	keyID := pk.KeyID()
+	signature, err := schnorr.TrySign(message(SuiteLegacy, keyID, payload, aad), sk)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedEnvelope{KeyID: keyID, Payload: payload, Signature: signature}, nil
+}
+
+/*
+Checks the envelope signature with the key resolved from its key ID.
+Envelopes of other schemes are rejected with ErrUnsupportedSuite, see VerifyAny,
+suites not accepted by the process wide policy (SetSuitePolicy) with
+ErrSuiteNotAccepted and keys expired at the process clock, give or take the
+skew of schnorr.SetFreshnessPolicy, with ErrKeyExpired.
+*/
+func (e *SignedEnvelope) Verify(aad []byte, keys KeyResolver) error {
+	pk, err := keys.PublicKey(e.KeyID)
+	if err != nil {
+		return err
+	}
+	if !e.Suite.supported() {
+		return ErrUnsupportedSuite
+	}
+	if err := checkSuitePolicy(e); err != nil {
+		return err
+	}
+	if pk.ExpiredNow() {
+		return ErrKeyExpired
+	}
+	if !schnorr.VerifySignature(message(e.Suite, e.KeyID, e.Payload, aad), e.Signature, pk) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+/*
+Binary encoding, ErrTooLarge for key IDs over 255 bytes, signatures over
+65535 bytes or more than 255 countersignatures, which the format can't hold
+*/
+func (e *SignedEnvelope) Marshal() ([]byte, error) {
+	if len(e.Countersignatures) > maxCountersignatures {
+		return nil, ErrTooLarge
+	}
+	if !e.Suite.raw() && e.Signature == nil {
+		return nil, ErrMalformed
+	}
+	var buf []byte
+	switch {
+	case e.Suite != SuiteLegacy:
+		buf = binary.BigEndian.AppendUint16([]byte{versionSuite}, uint16(e.Suite))
+	case len(e.Countersignatures) > 0:
+		buf = []byte{versionCountersigned}
+	default:
+		buf = []byte{version}
+	}
+
+	buf, err := appendSignature(buf, e.KeyID, e.signatureBytes())
+	if err != nil {
+		return nil, err
+	}
+	if buf[0] != version {
+		buf = append(buf, byte(len(e.Countersignatures)))
+		for _, cs := range e.Countersignatures {
+			if cs.Signature == nil {
+				return nil, ErrMalformed
+			}
+			if buf, err = appendSignature(buf, cs.KeyID, cs.Signature.Bytes()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return append(buf, e.Payload...), nil
+}
+
+func Unmarshal(b []byte) (*SignedEnvelope, error) {
+	if len(b) < 1 {
+		return nil, ErrMalformed
+	}
+	v := b[0]
+	b = b[1:]
+	if v != version && v != versionCountersigned && v != versionSuite {
+		return nil, ErrVersion
+	}
+
+	e := &SignedEnvelope{}
+	if v == versionSuite {
+		if len(b) < 2 {
+			return nil, ErrMalformed
+		}
+		e.Suite = Suite(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if e.Suite == SuiteLegacy {
+			return nil, ErrMalformed
+		}
+	}
+
+	var err error
+	if e.Suite.raw() {
+		e.KeyID, e.RawSignature, b, err = readRawSignature(b)
+	} else {
+		e.KeyID, e.Signature, b, err = readSignature(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v != version {
+		if len(b) < 1 {
+			return nil, ErrMalformed
+		}
+		count := int(b[0])
+		b = b[1:]
+		for i := 0; i < count; i++ {
+			var cs Countersignature
+			cs.KeyID, cs.Signature, b, err = readSignature(b)
+			if err != nil {
+				return nil, err
+			}
+			e.Countersignatures = append(e.Countersignatures, cs)
+		}
+	}
+
+	e.Payload = b
+	return e, nil
+}
+
+/*
+len(keyID) (1 byte) || keyID || len(sig) (2 bytes) || sig
+*/
+func appendSignature(buf []byte, keyID string, raw []byte) ([]byte, error) {
+	if len(keyID) > 0xff || len(raw) > 0xffff {
+		return nil, ErrTooLarge
+	}
+	buf = append(buf, byte(len(keyID)))
+	buf = append(buf, keyID...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(raw)))
+	return append(buf, raw...), nil
+}
+
+func readSignature(b []byte) (string, *schnorr.Signature, []byte, error) {
+	keyID, raw, b, err := readRawSignature(b)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	signature, err := schnorr.ParseSignature(raw)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return keyID, signature, b, nil
+}
+
+func readRawSignature(b []byte) (string, []byte, []byte, error) {
+	if len(b) < 1 {
+		return "", nil, nil, ErrMalformed
+	}
+	n := int(b[0])
+	b = b[1:]
+	if len(b) < n+2 {
+		return "", nil, nil, ErrMalformed
+	}
+	keyID := string(b[:n])
+	b = b[n:]
+
+	n = int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < n {
+		return "", nil, nil, ErrMalformed
+	}
+	return keyID, b[:n], b[n:], nil
+}
+
+/*
+Unmarshal and verify envelope in one step
+*/
+func Open(b, aad []byte, keys KeyResolver) (*SignedEnvelope, error) {
+	e, err := Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Verify(aad, keys); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+/*
+H(len(keyID)||keyID||len(aad)||aad||payload), prefixed with the suite ID
+for non-legacy suites, so the suite can't be changed without invalidating the signature
+*/
+func message(suite Suite, keyID string, payload, aad []byte) string {
+	h := sha256.New()
+	var l [4]byte
+
+	if suite != SuiteLegacy {
+		h.Write([]byte("schnorr/envelope/suite"))
+		h.Write(binary.BigEndian.AppendUint16(nil, uint16(suite)))
+	}
+
+	binary.BigEndian.PutUint32(l[:], uint32(len(keyID)))
+	h.Write(l[:])
+	h.Write([]byte(keyID))
+	binary.BigEndian.PutUint32(l[:], uint32(len(aad)))
+	h.Write(l[:])
+	h.Write(aad)
+	h.Write(payload)
+
+	return string(h.Sum(nil))
+}
@@ -0,0 +1,145 @@
+package envelope
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey, KeyMap) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := KeyMap{}
+	m.Add(pk)
+	return sk, pk, m
+}
+
+func TestRoundTrip(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	notarySK, notaryPK, _ := keys(t)
+	resolver.Add(notaryPK)
+
+	sealed, err := Seal([]byte("payload"), []byte("aad"), sk, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sealed.Countersign(notarySK, notaryPK); err != nil {
+		t.Fatal(err)
+	}
+	b, err := sealed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := Open(b, []byte("aad"), resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.KeyID != pk.KeyID() || !bytes.Equal(opened.Payload, []byte("payload")) {
+		t.Fatalf("opened %+v", opened)
+	}
+	v, err := opened.VerifyAll([]byte("aad"), resolver)
+	if err != nil || len(v.Countersigners) != 1 || v.Countersigners[0] != notaryPK.KeyID() || len(v.Invalid) != 0 {
+		t.Fatalf("countersignatures: %+v, %v", v, err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	sealed, err := Seal([]byte("payload"), []byte("aad"), sk, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := sealed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(b, []byte("other aad"), resolver); err != ErrBadSignature {
+		t.Errorf("other additional data: %v", err)
+	}
+	changed := append([]byte(nil), b...)
+	changed[len(changed)-1] ^= 1
+	if _, err := Open(changed, []byte("aad"), resolver); err != ErrBadSignature {
+		t.Errorf("changed payload: %v", err)
+	}
+	if _, err := Open(b, []byte("aad"), KeyMap{}); err != ErrUnknownKey {
+		t.Errorf("unknown signer: %v", err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	sk, pk, _ := keys(t)
+	sealed, err := Seal([]byte("payload"), nil, sk, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := sealed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unmarshal(nil); err != ErrMalformed {
+		t.Errorf("empty envelope: %v", err)
+	}
+	if _, err := Unmarshal([]byte{9}); err != ErrVersion {
+		t.Errorf("unknown version: %v", err)
+	}
+	// cut inside the key ID and inside the signature
+	for _, n := range []int{2, 1 + 1 + len(pk.KeyID()) + 3} {
+		if _, err := Unmarshal(b[:n]); err == nil {
+			t.Errorf("envelope cut to %d bytes accepted", n)
+		}
+	}
+	// countersigned version without the count
+	if _, err := Unmarshal(append([]byte{versionCountersigned}, b[1:len(b)-len("payload")]...)); err != ErrMalformed {
+		t.Errorf("missing countersignature count: %v", err)
+	}
+}
+
+/*
+Lengths the one and two byte length fields can't hold are rejected instead
+of wrapping around
+*/
+func TestMarshalLimits(t *testing.T) {
+	sk, pk, _ := keys(t)
+	sealed, err := Seal([]byte("payload"), nil, sk, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	long := *sealed
+	long.KeyID = strings.Repeat("k", 256)
+	if _, err := long.Marshal(); err != ErrTooLarge {
+		t.Errorf("256 byte key ID: %v", err)
+	}
+
+	counted := *sealed
+	cs := Countersignature{KeyID: pk.KeyID(), Signature: sealed.Signature}
+	for i := 0; i < maxCountersignatures; i++ {
+		counted.Countersignatures = append(counted.Countersignatures, cs)
+	}
+	b, err := counted.Marshal()
+	if err != nil {
+		t.Fatalf("%d countersignatures: %v", maxCountersignatures, err)
+	}
+	if decoded, err := Unmarshal(b); err != nil || len(decoded.Countersignatures) != maxCountersignatures {
+		t.Fatalf("decoded %d countersignatures: %v", len(decoded.Countersignatures), err)
+	}
+	if err := counted.Countersign(sk, pk); err != ErrTooLarge {
+		t.Errorf("countersignature over the limit: %v", err)
+	}
+	counted.Countersignatures = append(counted.Countersignatures, cs)
+	if _, err := counted.Marshal(); err != ErrTooLarge {
+		t.Errorf("%d countersignatures: %v", len(counted.Countersignatures), err)
+	}
+
+	countersigned := *sealed
+	countersigned.Countersignatures = []Countersignature{{KeyID: strings.Repeat("k", 256), Signature: sealed.Signature}}
+	if _, err := countersigned.Marshal(); err != ErrTooLarge {
+		t.Errorf("256 byte countersigner key ID: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package envelope
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Envelopes of other signature schemes
+
+Besides the signatures of SealWithSuite, envelopes can carry Schnorr
+signatures of keys on the elliptic curves (schnorr.Secp256k1, schnorr.P256)
+under a suite naming the curve, and Ed25519 signatures. Their suite ID names the scheme, so VerifyAny and OpenAny pick the
+verifier from the envelope itself and callers with mixed artifacts need a
+single code path:
+
+	keys := envelope.AnyKeyMap{}
+	keys.Add(schnorrPublicKey)   // *schnorr.PublicKey of any group
+	keys.Add(ed25519PublicKey)   // ed25519.PublicKey
+	e, err := envelope.OpenAny(b, aad, keys)
+
+The signature of these suites is kept in RawSignature in the encoding of its
+scheme (Signature.Bytes, 64 Ed25519 bytes). The key ID is derived by KeyIDOf,
+for *schnorr.PublicKey it's the usual PublicKey.KeyID.
+*/
+
+const (
+	SuiteSecp256k1 Suite = 0x0002 // schnorr signatures of secp256k1 keys
+	SuiteP256      Suite = 0x0003 // schnorr signatures of P-256 keys
+	SuiteEd25519   Suite = 0x0004 // Ed25519 (RFC 8032), pure
+)
+
+var ErrKeyType = errors.New("envelope: key type doesn't match the algorithm suite")
+
+/*
+Source of public keys of any supported scheme: *schnorr.PublicKey or
+ed25519.PublicKey
+*/
+type AnyKeyResolver interface {
+	AnyPublicKey(keyID string) (crypto.PublicKey, error)
+}
+
+/*
+AnyKeyResolver backed by a static map of key IDs
+*/
+type AnyKeyMap map[string]crypto.PublicKey
+
+func (m AnyKeyMap) AnyPublicKey(keyID string) (crypto.PublicKey, error) {
+	pk, ok := m[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return pk, nil
+}
+
+/*
+Adds AnyKeyMap entry for the given public key
+*/
+func (m AnyKeyMap) Add(pk crypto.PublicKey) error {
+	keyID, err := KeyIDOf(pk)
+	if err != nil {
+		return err
+	}
+	m[keyID] = pk
+	return nil
+}
+
+/*
+KeyMap keys for VerifyAny
+*/
+func (m KeyMap) AnyPublicKey(keyID string) (crypto.PublicKey, error) {
+	return m.PublicKey(keyID)
+}
+
+/*
+Key ID of a public key of any supported scheme, the first 8 bytes of the
+SHA-256 of its encoding, hex encoded
+*/
+func KeyIDOf(pk crypto.PublicKey) (string, error) {
+	var b []byte
+	switch pk := pk.(type) {
+	case *schnorr.PublicKey:
+		return pk.KeyID(), nil
+	case ed25519.PublicKey:
+		if len(pk) != ed25519.PublicKeySize {
+			return "", ErrKeyType
+		}
+		b = pk
+	default:
+		return "", ErrKeyType
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+/*
+Seal with a schnorr signature in an elliptic curve group, the suite is given by the group
+*/
+func SealGroup(payload, aad []byte, sk *schnorr.SignatureKey) (*SignedEnvelope, error) {
+	suite, err := groupSuite(sk.Group())
+	if err != nil {
+		return nil, err
+	}
+	pk, err := sk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := schnorr.TrySign(message(suite, pk.KeyID(), payload, aad), sk)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedEnvelope{KeyID: pk.KeyID(), Suite: suite, Payload: payload, RawSignature: signature.Bytes()}, nil
+}
+
+/*
+Seal with an Ed25519 signature
+*/
+func SealEd25519(payload, aad []byte, key ed25519.PrivateKey) (*SignedEnvelope, error) {
+	keyID, err := KeyIDOf(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	raw := ed25519.Sign(key, []byte(message(SuiteEd25519, keyID, payload, aad)))
+	return &SignedEnvelope{KeyID: keyID, Suite: SuiteEd25519, Payload: payload, RawSignature: raw}, nil
+}
+
+/*
+Checks the envelope signature with the verifier of its suite and the key
+resolved from its key ID, the suite has to be accepted by the process wide
+policy (SetSuitePolicy)
+*/
+func (e *SignedEnvelope) VerifyAny(aad []byte, keys AnyKeyResolver) error {
+	key, err := keys.AnyPublicKey(e.KeyID)
+	if err != nil {
+		return err
+	}
+	if err := checkSuitePolicy(e); err != nil {
+		return err
+	}
+	m := message(e.Suite, e.KeyID, e.Payload, aad)
+
+	switch e.Suite {
+	case SuiteLegacy, SuiteSchnorrSHA256:
+		pk, ok := key.(*schnorr.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrKeyType, e.Suite)
+		}
+		if pk.ExpiredNow() {
+			return ErrKeyExpired
+		}
+		if e.Signature == nil || !schnorr.VerifySignature(m, e.Signature, pk) {
+			return ErrBadSignature
+		}
+	case SuiteSecp256k1, SuiteP256:
+		pk, ok := key.(*schnorr.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrKeyType, e.Suite)
+		}
+		if suite, err := groupSuite(pk.Group()); err != nil || suite != e.Suite {
+			return fmt.Errorf("%w: %s", ErrKeyType, e.Suite)
+		}
+		if pk.ExpiredNow() {
+			return ErrKeyExpired
+		}
+		signature, err := schnorr.ParseSignature(e.RawSignature)
+		if err != nil || !schnorr.VerifySignature(m, signature, pk) {
+			return ErrBadSignature
+		}
+	case SuiteEd25519:
+		pk, ok := key.(ed25519.PublicKey)
+		if !ok || len(pk) != ed25519.PublicKeySize {
+			return fmt.Errorf("%w: %s", ErrKeyType, e.Suite)
+		}
+		if !ed25519.Verify(pk, []byte(m), e.RawSignature) {
+			return ErrBadSignature
+		}
+	default:
+		return ErrUnsupportedSuite
+	}
+	return nil
+}
+
+/*
+Unmarshal and verify envelope of any suite in one step
+*/
+func OpenAny(b, aad []byte, keys AnyKeyResolver) (*SignedEnvelope, error) {
+	e, err := Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.VerifyAny(aad, keys); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+/*
+Suites whose signature is kept in RawSignature
+*/
+func (s Suite) raw() bool {
+	return s == SuiteSecp256k1 || s == SuiteP256 || s == SuiteEd25519
+}
+
+func (e *SignedEnvelope) signatureBytes() []byte {
+	if e.Suite.raw() {
+		return e.RawSignature
+	}
+	return e.Signature.Bytes()
+}
+
+func groupSuite(group schnorr.Group) (Suite, error) {
+	switch group {
+	case schnorr.Secp256k1():
+		return SuiteSecp256k1, nil
+	case schnorr.P256():
+		return SuiteP256, nil
+	}
+	return 0, ErrUnsupportedSuite
+}
@@ -0,0 +1,102 @@
+package envelope
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrPolicyNotSatisfied = errors.New("envelope: signer policy not satisfied")
+
+/*
+Boolean/threshold combination of signers required on an envelope, e.g.
+
+	AllOf(Signer(ceo), AtLeast(2, Signer(cfo), Signer(cto), Signer(legal)))
+*/
+type VerifierPolicy interface {
+	satisfied(signers map[string]bool) bool
+	String() string
+}
+
+type signerPolicy string
+
+/*
+Policy satisfied when the key signed the envelope (as primary signer or countersigner)
+*/
+func Signer(keyID string) VerifierPolicy {
+	return signerPolicy(keyID)
+}
+
+func (p signerPolicy) satisfied(signers map[string]bool) bool {
+	return signers[string(p)]
+}
+
+func (p signerPolicy) String() string {
+	return string(p)
+}
+
+type thresholdPolicy struct {
+	k        int
+	policies []VerifierPolicy
+}
+
+/*
+Policy satisfied when at least k of the given policies are satisfied
+*/
+func AtLeast(k int, policies ...VerifierPolicy) VerifierPolicy {
+	return &thresholdPolicy{k, policies}
+}
+
+/*
+Policy satisfied when all of the given policies are satisfied
+*/
+func AllOf(policies ...VerifierPolicy) VerifierPolicy {
+	return &thresholdPolicy{len(policies), policies}
+}
+
+/*
+Policy satisfied when any of the given policies is satisfied
+*/
+func AnyOf(policies ...VerifierPolicy) VerifierPolicy {
+	return &thresholdPolicy{1, policies}
+}
+
+func (p *thresholdPolicy) satisfied(signers map[string]bool) bool {
+	count := 0
+	for _, policy := range p.policies {
+		if policy.satisfied(signers) {
+			count++
+		}
+	}
+	return count >= p.k
+}
+
+func (p *thresholdPolicy) String() string {
+	parts := make([]string, len(p.policies))
+	for i, policy := range p.policies {
+		parts[i] = policy.String()
+	}
+	return fmt.Sprintf("%d-of(%s)", p.k, strings.Join(parts, ", "))
+}
+
+/*
+Verify all signatures of the envelope and check that valid signers satisfy the policy.
+Invalid countersignatures don't fail the verification on their own,
+they just don't count towards the policy.
+*/
+func VerifyPolicy(e *SignedEnvelope, aad []byte, keys KeyResolver, policy VerifierPolicy) (*Verification, error) {
+	v, err := e.VerifyAll(aad, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := map[string]bool{v.Primary: true}
+	for _, keyID := range v.Countersigners {
+		signers[keyID] = true
+	}
+
+	if !policy.satisfied(signers) {
+		return v, fmt.Errorf("%w: %s", ErrPolicyNotSatisfied, policy)
+	}
+	return v, nil
+}
@@ -0,0 +1,229 @@
+package envelope
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Algorithm suites
+
+Every envelope names the algorithm suite (signature scheme, group and hash)
+its signature was made with, so new schemes can be rolled out next to the old
+ones. Envelopes from before suites were introduced (version 1 and 2) belong to
+SuiteLegacy and keep their original encoding, so existing verifiers still accept
+envelopes sealed with Seal.
+
+Downgrade protection:
+
+  - the suite ID is covered by the signature, so it can't be replaced by
+    an older suite (or the envelope re-encoded as legacy) without invalidating it,
+  - SuitePolicy accepts only the configured suites and, once a key has been
+    upgraded, rejects envelopes of that key made with older suites.
+
+A SuitePolicy is checked either by the verifier using it (SuitePolicy.Verify,
+SuitePolicy.VerifyAny) or for the whole process by SetSuitePolicy, e.g. to
+forbid the finite field suites and require challenges binding the public key
+everywhere:
+
+	envelope.SetSuitePolicy(&envelope.SuitePolicy{
+		Accepted:           envelope.AllSuites(),
+		Denied:             []envelope.Suite{envelope.SuiteLegacy, envelope.SuiteSchnorrSHA256},
+		RequireKeyPrefixed: true,
+	})
+
+Suite IDs are assigned in increasing order, a higher ID is never weaker than a lower one.
+*/
+type Suite uint16
+
+const (
+	SuiteLegacy        Suite = 0x0000 // version 1 and 2 envelopes
+	SuiteSchnorrSHA256 Suite = 0x0001 // current schnorr package, challenge over SHA-256
+)
+
+var (
+	ErrUnsupportedSuite = errors.New("envelope: unsupported algorithm suite")
+	ErrSuiteNotAccepted = errors.New("envelope: algorithm suite not accepted")
+	ErrNoCommonSuite    = errors.New("envelope: no common algorithm suite")
+)
+
+/*
+Suites supported by SealWithSuite, in order of preference. The suites of
+other schemes (see multi.go) are sealed by SealGroup and SealEd25519.
+*/
+func SupportedSuites() []Suite {
+	return []Suite{SuiteSchnorrSHA256, SuiteLegacy}
+}
+
+func (s Suite) supported() bool {
+	return s == SuiteLegacy || s == SuiteSchnorrSHA256
+}
+
+/*
+Every suite verified by VerifyAny
+*/
+func AllSuites() []Suite {
+	return []Suite{SuiteLegacy, SuiteSchnorrSHA256, SuiteSecp256k1, SuiteP256, SuiteEd25519}
+}
+
+/*
+Whether the challenge of the suite's signatures hashes the signer's public key,
+which the finite field suites (challenge H(R||m)) don't
+*/
+func (s Suite) KeyPrefixed() bool {
+	return s == SuiteSecp256k1 || s == SuiteP256 || s == SuiteEd25519
+}
+
+func (s Suite) String() string {
+	switch s {
+	case SuiteLegacy:
+		return "legacy"
+	case SuiteSchnorrSHA256:
+		return "schnorr-sha256"
+	case SuiteSecp256k1:
+		return "schnorr-secp256k1"
+	case SuiteP256:
+		return "schnorr-p256"
+	case SuiteEd25519:
+		return "ed25519"
+	}
+	return fmt.Sprintf("unknown(0x%04x)", uint16(s))
+}
+
+/*
+Seal with an explicit algorithm suite, the envelope is encoded with version 3
+unless the suite is SuiteLegacy
+*/
+func SealWithSuite(suite Suite, payload, aad []byte, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) (*SignedEnvelope, error) {
+	if !suite.supported() {
+		return nil, ErrUnsupportedSuite
+	}
+	keyID := pk.KeyID()
+	signature, err := schnorr.TrySign(message(suite, keyID, payload, aad), sk)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedEnvelope{KeyID: keyID, Suite: suite, Payload: payload, Signature: signature}, nil
+}
+
+/*
+Pick the suite to seal with: the first suite of local (in order of preference)
+which is supported by both sides
+*/
+func Negotiate(local, peer []Suite) (Suite, error) {
+	for _, s := range local {
+		if !s.supported() {
+			continue
+		}
+		for _, p := range peer {
+			if s == p {
+				return s, nil
+			}
+		}
+	}
+	return 0, ErrNoCommonSuite
+}
+
+/*
+Suites a verifier accepts
+*/
+type SuitePolicy struct {
+	Accepted           []Suite          // accepted suites, SuiteLegacy has to be listed to accept version 1 and 2 envelopes
+	Denied             []Suite          // rejected suites, even if listed in Accepted
+	RequireKeyPrefixed bool             // accept only suites whose challenge binds the public key (Suite.KeyPrefixed)
+	Pinned             map[string]Suite // minimum suite per key ID, for keys which have been upgraded
+}
+
+var suitePolicy = struct {
+	sync.RWMutex
+	policy *SuitePolicy
+}{}
+
+/*
+Check every envelope verified in the process against the policy: Verify,
+VerifyAny, VerifyAll and the functions built on them reject envelopes whose
+suite it doesn't accept. The policy is copied, nil removes it. Only the suite
+of the primary signature is checked, countersignatures are always finite field
+signatures.
+*/
+func SetSuitePolicy(p *SuitePolicy) {
+	if p != nil {
+		p = &SuitePolicy{
+			Accepted:           append([]Suite(nil), p.Accepted...),
+			Denied:             append([]Suite(nil), p.Denied...),
+			RequireKeyPrefixed: p.RequireKeyPrefixed,
+			Pinned:             make(map[string]Suite, len(p.Pinned)),
+		}
+		for keyID, s := range p.Pinned {
+			p.Pinned[keyID] = s
+		}
+	}
+	suitePolicy.Lock()
+	defer suitePolicy.Unlock()
+	suitePolicy.policy = p
+}
+
+/*
+Check the envelope suite against the process wide policy, if there is one
+*/
+func checkSuitePolicy(e *SignedEnvelope) error {
+	suitePolicy.RLock()
+	defer suitePolicy.RUnlock()
+	if suitePolicy.policy == nil {
+		return nil
+	}
+	return suitePolicy.policy.check(e)
+}
+
+/*
+Check the envelope suite against the policy and verify the envelope
+*/
+func (p *SuitePolicy) Verify(e *SignedEnvelope, aad []byte, keys KeyResolver) error {
+	if err := p.check(e); err != nil {
+		return err
+	}
+	return e.Verify(aad, keys)
+}
+
+/*
+Same as Verify for envelopes of any suite, see SignedEnvelope.VerifyAny
+*/
+func (p *SuitePolicy) VerifyAny(e *SignedEnvelope, aad []byte, keys AnyKeyResolver) error {
+	if err := p.check(e); err != nil {
+		return err
+	}
+	return e.VerifyAny(aad, keys)
+}
+
+func (p *SuitePolicy) check(e *SignedEnvelope) error {
+	accepted := false
+	for _, s := range p.Accepted {
+		accepted = accepted || s == e.Suite
+	}
+	for _, s := range p.Denied {
+		accepted = accepted && s != e.Suite
+	}
+	if !accepted {
+		return fmt.Errorf("%w: %s", ErrSuiteNotAccepted, e.Suite)
+	}
+	if p.RequireKeyPrefixed && !e.Suite.KeyPrefixed() {
+		return fmt.Errorf("%w: %s, challenge doesn't bind the public key", ErrSuiteNotAccepted, e.Suite)
+	}
+	if minimum, ok := p.Pinned[e.KeyID]; ok && e.Suite < minimum {
+		return fmt.Errorf("%w: %s, key %s requires at least %s", ErrSuiteNotAccepted, e.Suite, e.KeyID, minimum)
+	}
+	return nil
+}
+
+/*
+Require suite of at least s for the key from now on
+*/
+func (p *SuitePolicy) Pin(keyID string, s Suite) {
+	if p.Pinned == nil {
+		p.Pinned = make(map[string]Suite)
+	}
+	p.Pinned[keyID] = s
+}
@@ -0,0 +1,364 @@
+/*
+Signed snapshots and deltas of event streams.
+
+Instead of signing every event, a Recorder hash-chains the events of a stream
+and signs checkpoints:
+
+	event chain  c_0 = 32 zero bytes, c_i = SHA256(0x00 || c_(i-1) || len(e_i) || e_i)
+	checkpoint   stream, sequence number, kind, version (events so far),
+	             c_version, state hash (snapshots), hash of the previous checkpoint
+
+A snapshot additionally commits to the hash of the application state after
+version events, a delta only to the events since the previous checkpoint. Each
+checkpoint names the previous one, so the checkpoints of a stream form a chain
+starting at its first snapshot.
+
+To restore state, a reader loads the latest snapshot it trusts and replays the
+events after it: VerifyChain checks all checkpoint signatures at once
+(schnorr.VerifyBatch) together with their links, VerifyEvents checks a run of
+events between two checkpoints by hashing, without any signature per event.
+*/
+package eventsource
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrBadSignature     = errors.New("eventsource: invalid checkpoint signature")
+	ErrBrokenChain      = errors.New("eventsource: checkpoints don't form a chain")
+	ErrEventsMismatch   = errors.New("eventsource: events don't match the checkpoints")
+	ErrNoSnapshot       = errors.New("eventsource: chain doesn't start with a snapshot")
+	ErrInvalidEncoding  = errors.New("eventsource: invalid checkpoint encoding")
+	ErrNothingToSign    = errors.New("eventsource: no events since the last checkpoint")
+	ErrInvalidStateHash = errors.New("eventsource: snapshot state hash must be 32 bytes")
+)
+
+type Kind byte
+
+const (
+	Snapshot Kind = 1
+	Delta    Kind = 2
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Snapshot:
+		return "snapshot"
+	case Delta:
+		return "delta"
+	}
+	return fmt.Sprintf("Kind(%d)", byte(k))
+}
+
+/*
+Signed checkpoint of a stream
+*/
+type Checkpoint struct {
+	Stream    string
+	Seq       uint64 // 0 for the first checkpoint of the stream
+	Kind      Kind
+	Version   uint64 // number of events covered
+	Chain     []byte // event chain after Version events
+	State     []byte // state hash, snapshots only
+	Prev      []byte // Hash of the previous checkpoint, empty for Seq 0
+	KeyID     string
+	Signature *schnorr.Signature
+}
+
+/*
+Signed message: "schnorr/eventsource" || fields of Bytes up to the key ID
+*/
+func (c *Checkpoint) message() []byte {
+	return append([]byte("schnorr/eventsource"), c.body()...)
+}
+
+func (c *Checkpoint) body() []byte {
+	b := appendField(nil, []byte(c.Stream))
+	b = binary.BigEndian.AppendUint64(b, c.Seq)
+	b = append(b, byte(c.Kind))
+	b = binary.BigEndian.AppendUint64(b, c.Version)
+	b = appendField(b, c.Chain)
+	b = appendField(b, c.State)
+	return appendField(b, c.Prev)
+}
+
+/*
+Hash of the signed checkpoint, referenced by the next checkpoint
+*/
+func (c *Checkpoint) Hash() []byte {
+	h := sha256.Sum256(c.Bytes())
+	return h[:]
+}
+
+func (c *Checkpoint) Verify(pk *schnorr.PublicKey) error {
+	if c.Signature == nil || c.KeyID != pk.KeyID() || !schnorr.VerifyBytes(c.message(), c.Signature, pk) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+/*
+Encoding: fields of the signed message, then len(key ID) || key ID || signature
+*/
+func (c *Checkpoint) Bytes() []byte {
+	b := appendField(c.body(), []byte(c.KeyID))
+	return append(b, c.Signature.Bytes()...)
+}
+
+func ParseCheckpoint(b []byte) (*Checkpoint, error) {
+	c := new(Checkpoint)
+	stream, b, ok := readField(b)
+	if !ok || len(b) < 17 {
+		return nil, ErrInvalidEncoding
+	}
+	c.Stream = string(stream)
+	c.Seq = binary.BigEndian.Uint64(b)
+	c.Kind = Kind(b[8])
+	c.Version = binary.BigEndian.Uint64(b[9:])
+	b = b[17:]
+	var keyID []byte
+	if c.Chain, b, ok = readField(b); !ok {
+		return nil, ErrInvalidEncoding
+	}
+	if c.State, b, ok = readField(b); !ok {
+		return nil, ErrInvalidEncoding
+	}
+	if c.Prev, b, ok = readField(b); !ok {
+		return nil, ErrInvalidEncoding
+	}
+	if keyID, b, ok = readField(b); !ok {
+		return nil, ErrInvalidEncoding
+	}
+	c.KeyID = string(keyID)
+	signature, err := schnorr.ParseSignature(b)
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	c.Signature = signature
+	return c, nil
+}
+
+/*
+Writer side of a stream: chains the appended events and signs checkpoints
+*/
+type Recorder struct {
+	stream string
+	sk     *schnorr.SignatureKey
+	pk     *schnorr.PublicKey
+
+	mu      sync.Mutex
+	version uint64
+	chain   []byte
+	last    *Checkpoint
+}
+
+func NewRecorder(stream string, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Recorder {
+	return &Recorder{stream: stream, sk: sk, pk: pk, chain: make([]byte, sha256.Size)}
+}
+
+/*
+Continue the stream after a verified checkpoint, e.g. after a restart
+*/
+func ResumeRecorder(last *Checkpoint, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Recorder {
+	return &Recorder{
+		stream:  last.Stream,
+		sk:      sk,
+		pk:      pk,
+		version: last.Version,
+		chain:   append([]byte(nil), last.Chain...),
+		last:    last,
+	}
+}
+
+/*
+Add the event to the chain and return its version (1 for the first event)
+*/
+func (r *Recorder) Append(event []byte) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chain = chainEvent(r.chain, event)
+	r.version++
+	return r.version
+}
+
+/*
+Sign a snapshot of the state after the events appended so far. The first
+checkpoint of a stream has to be a snapshot, of the empty state if nothing
+happened yet.
+*/
+func (r *Recorder) Snapshot(stateHash []byte) (*Checkpoint, error) {
+	if len(stateHash) != sha256.Size {
+		return nil, ErrInvalidStateHash
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.checkpoint(Snapshot, stateHash)
+}
+
+/*
+Sign a delta over the events since the previous checkpoint
+*/
+func (r *Recorder) Delta() (*Checkpoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		return nil, ErrNoSnapshot
+	}
+	if r.version == r.last.Version {
+		return nil, ErrNothingToSign
+	}
+	return r.checkpoint(Delta, nil)
+}
+
+func (r *Recorder) checkpoint(kind Kind, state []byte) (*Checkpoint, error) {
+	c := &Checkpoint{
+		Stream:  r.stream,
+		Kind:    kind,
+		Version: r.version,
+		Chain:   append([]byte(nil), r.chain...),
+		State:   append([]byte(nil), state...),
+		KeyID:   r.pk.KeyID(),
+	}
+	if r.last != nil {
+		c.Seq = r.last.Seq + 1
+		c.Prev = r.last.Hash()
+	}
+	signature, err := schnorr.SignBytes(c.message(), r.sk)
+	if err != nil {
+		return nil, err
+	}
+	c.Signature = signature
+	r.last = c
+	return c, nil
+}
+
+/*
+Latest signed checkpoint, nil before the first one
+*/
+func (r *Recorder) Last() *Checkpoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+/*
+Check a run of consecutive checkpoints of one stream: all signatures in one
+batch, the links between them and that versions don't go back. The first
+checkpoint has to be a snapshot, it's the trust anchor of the replay.
+*/
+func VerifyChain(checkpoints []*Checkpoint, pk *schnorr.PublicKey) error {
+	if len(checkpoints) == 0 || checkpoints[0].Kind != Snapshot {
+		return ErrNoSnapshot
+	}
+	messages := make([][]byte, len(checkpoints))
+	signatures := make([]*schnorr.Signature, len(checkpoints))
+	pubs := make([]*schnorr.PublicKey, len(checkpoints))
+	for i, c := range checkpoints {
+		if c.KeyID != pk.KeyID() || c.Signature == nil {
+			return fmt.Errorf("%w: checkpoint %d", ErrBadSignature, c.Seq)
+		}
+		if c.Kind == Snapshot && len(c.State) != sha256.Size || c.Kind != Snapshot && c.Kind != Delta {
+			return fmt.Errorf("%w: checkpoint %d", ErrInvalidEncoding, c.Seq)
+		}
+		if i > 0 {
+			prev := checkpoints[i-1]
+			if c.Stream != prev.Stream || c.Seq != prev.Seq+1 || c.Version < prev.Version || !bytes.Equal(c.Prev, prev.Hash()) {
+				return fmt.Errorf("%w: checkpoint %d after %d", ErrBrokenChain, c.Seq, prev.Seq)
+			}
+		}
+		messages[i], signatures[i], pubs[i] = c.message(), c.Signature, pk
+	}
+	if !schnorr.VerifyBatch(messages, signatures, pubs) {
+		// find the culprit for the error message
+		for _, c := range checkpoints {
+			if c.Verify(pk) != nil {
+				return fmt.Errorf("%w: checkpoint %d", ErrBadSignature, c.Seq)
+			}
+		}
+		return ErrBadSignature
+	}
+	return nil
+}
+
+/*
+Check that events are exactly the events between the checkpoints from and to
+(consecutive or not) of a verified chain
+*/
+func VerifyEvents(from *Checkpoint, events [][]byte, to *Checkpoint) error {
+	if from.Stream != to.Stream || to.Version < from.Version || to.Version-from.Version != uint64(len(events)) {
+		return fmt.Errorf("%w: %d events between versions %d and %d", ErrEventsMismatch, len(events), from.Version, to.Version)
+	}
+	chain := from.Chain
+	for _, e := range events {
+		chain = chainEvent(chain, e)
+	}
+	if !bytes.Equal(chain, to.Chain) {
+		return ErrEventsMismatch
+	}
+	return nil
+}
+
+/*
+Verify the chain of checkpoints and replay the events after its first
+snapshot through apply, checking each run of events against the next
+checkpoint before it is applied. events[i] has version
+checkpoints[0].Version+i+1, events after the last checkpoint aren't covered
+and are rejected.
+*/
+func Replay(checkpoints []*Checkpoint, events [][]byte, pk *schnorr.PublicKey, apply func(version uint64, event []byte) error) error {
+	if err := VerifyChain(checkpoints, pk); err != nil {
+		return err
+	}
+	last := checkpoints[len(checkpoints)-1]
+	if uint64(len(events)) != last.Version-checkpoints[0].Version {
+		return fmt.Errorf("%w: %d events, checkpoints cover %d", ErrEventsMismatch, len(events), last.Version-checkpoints[0].Version)
+	}
+
+	base := checkpoints[0].Version
+	for i := 1; i < len(checkpoints); i++ {
+		from, to := checkpoints[i-1], checkpoints[i]
+		run := events[from.Version-base : to.Version-base]
+		if err := VerifyEvents(from, run, to); err != nil {
+			return fmt.Errorf("checkpoint %d: %w", to.Seq, err)
+		}
+		for j, e := range run {
+			if err := apply(from.Version+uint64(j)+1, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func chainEvent(chain, event []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(chain)
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(event))))
+	h.Write(event)
+	return h.Sum(nil)
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, false
+	}
+	return append([]byte(nil), b[4:4+n]...), b[4+n:], true
+}
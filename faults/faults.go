@@ -0,0 +1,270 @@
+/*
+Fault injection for testing code around the multi-party protocols.
+
+The protocol packages (threshold, frost, musig, the cluster signing of
+schnorr) leave moving their messages to the application. An Injector sits at
+that boundary: the application passes every message it is about to send
+through the injector, which drops, corrupts, delays or garbles it when a rule
+matches. Tests then check that the retry and abort handling does the right
+thing, e.g. that a corrupted share is caught by Coordinator.VerifyShare and
+the session is restarted without the participant:
+
+	in := faults.New(faults.Rule{Protocol: faults.Threshold, Round: faults.RoundSign, Participant: 2, Fault: faults.Corrupt})
+	share, err := pt.Sign(m, commitments)
+	share, err = in.SignatureShare(share) // Z of participant 2 is now wrong
+
+A nil *Injector injects nothing, so production code can keep the calls.
+*/
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+	"github.com/miki799/schnorr-signature/threshold"
+)
+
+/*
+ErrDropped is returned for a dropped message, in place of the error of the
+transport which lost it
+*/
+var ErrDropped = errors.New("faults: message dropped")
+
+/*
+Protocol names of the fault points
+*/
+const (
+	Threshold = "threshold"
+	FROST     = "frost"
+	MuSig     = "musig"
+	Cluster   = "cluster"
+)
+
+/*
+Rounds of the fault points: nonce commitments and signature shares
+*/
+const (
+	RoundCommit = "commit"
+	RoundReveal = "reveal" // cluster signing only
+	RoundSign   = "sign"
+)
+
+type Fault int
+
+const (
+	None    Fault = iota
+	Drop          // the message is lost
+	Corrupt       // the message arrives with a wrong value
+	Delay         // the message arrives after Rule.Delay
+	Malform       // the message can't be decoded
+)
+
+func (f Fault) String() string {
+	switch f {
+	case None:
+		return "none"
+	case Drop:
+		return "drop"
+	case Corrupt:
+		return "corrupt"
+	case Delay:
+		return "delay"
+	case Malform:
+		return "malform"
+	}
+	return fmt.Sprintf("Fault(%d)", int(f))
+}
+
+/*
+Message to be faulted, empty Protocol and Round and zero Participant match
+any message
+*/
+type Rule struct {
+	Protocol    string
+	Round       string
+	Participant int // index or identifier of the sending participant
+	Fault       Fault
+	Delay       time.Duration // for Delay
+	Skip        int           // matching messages passed through before the first fault
+	Times       int           // number of faults, 0 for every matching message
+}
+
+/*
+Injected fault, see Injector.Events
+*/
+type Event struct {
+	Protocol    string
+	Round       string
+	Participant int
+	Fault       Fault
+	Time        time.Time
+}
+
+type Injector struct {
+	mu     sync.Mutex
+	rules  []*ruleState
+	events []Event
+}
+
+type ruleState struct {
+	Rule
+	seen, fired int
+}
+
+func New(rules ...Rule) *Injector {
+	in := &Injector{}
+	for _, r := range rules {
+		in.Add(r)
+	}
+	return in
+}
+
+func (in *Injector) Add(r Rule) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = append(in.rules, &ruleState{Rule: r})
+}
+
+/*
+Remove all rules, the events are kept
+*/
+func (in *Injector) Reset() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = nil
+}
+
+func (in *Injector) Events() []Event {
+	if in == nil {
+		return nil
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return append([]Event(nil), in.events...)
+}
+
+/*
+Fault of the message, the first matching rule which still fires wins.
+Delay is returned for the caller to wait, the helpers below wait themselves.
+*/
+func (in *Injector) Decide(protocol, round string, participant int) (Fault, time.Duration) {
+	if in == nil {
+		return None, 0
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, r := range in.rules {
+		if (r.Protocol != "" && r.Protocol != protocol) || (r.Round != "" && r.Round != round) ||
+			(r.Participant != 0 && r.Participant != participant) {
+			continue
+		}
+		r.seen++
+		if r.seen <= r.Skip || (r.Times > 0 && r.fired >= r.Times) {
+			continue
+		}
+		r.fired++
+		in.events = append(in.events, Event{protocol, round, participant, r.Fault, schnorr.Now()})
+		return r.Fault, r.Delay
+	}
+	return None, 0
+}
+
+/*
+Encoded message (e.g. musig.PublicNonce.Bytes, frost serialized shares):
+Corrupt flips the lowest bit of the last byte, Malform truncates it
+*/
+func (in *Injector) Message(protocol, round string, participant int, b []byte) ([]byte, error) {
+	fault, delay := in.Decide(protocol, round, participant)
+	switch fault {
+	case Drop:
+		return nil, ErrDropped
+	case Delay:
+		time.Sleep(delay)
+	case Corrupt:
+		if len(b) > 0 {
+			b = append([]byte(nil), b...)
+			b[len(b)-1] ^= 1
+		}
+	case Malform:
+		b = b[:len(b)/2]
+	}
+	return b, nil
+}
+
+/*
+Scalar message, e.g. a musig or frost partial signature: Corrupt adds one,
+Malform makes it negative (out of range for every protocol)
+*/
+func (in *Injector) Scalar(protocol, round string, participant int, s *big.Int) (*big.Int, error) {
+	fault, delay := in.Decide(protocol, round, participant)
+	switch fault {
+	case Drop:
+		return nil, ErrDropped
+	case Delay:
+		time.Sleep(delay)
+	case Corrupt:
+		return new(big.Int).Add(s, big.NewInt(1)), nil
+	case Malform:
+		return big.NewInt(-1), nil
+	}
+	return s, nil
+}
+
+/*
+Round 1 message of package threshold: Corrupt swaps in E_i for D_i (a valid
+element, but the wrong one), Malform truncates D_i
+*/
+func (in *Injector) Commitment(c *threshold.Commitment) (*threshold.Commitment, error) {
+	fault, delay := in.Decide(Threshold, RoundCommit, c.Index)
+	switch fault {
+	case Drop:
+		return nil, ErrDropped
+	case Delay:
+		time.Sleep(delay)
+	case Corrupt:
+		return &threshold.Commitment{Index: c.Index, D: c.E, E: c.E}, nil
+	case Malform:
+		return &threshold.Commitment{Index: c.Index, D: c.D[:len(c.D)/2], E: c.E}, nil
+	}
+	return c, nil
+}
+
+/*
+Round 2 message of package threshold
+*/
+func (in *Injector) SignatureShare(share *threshold.SignatureShare) (*threshold.SignatureShare, error) {
+	z, err := in.Scalar(Threshold, RoundSign, share.Index, share.Z)
+	if err != nil {
+		return nil, err
+	}
+	if z == share.Z {
+		return share, nil
+	}
+	return &threshold.SignatureShare{Index: share.Index, Z: z}, nil
+}
+
+/*
+Round 1 message of the cluster signing of package schnorr
+*/
+func (in *Injector) NonceCommitment(c *schnorr.NonceCommitment) (*schnorr.NonceCommitment, error) {
+	b, err := in.Message(Cluster, RoundCommit, int(c.Index), c.Commitment)
+	if err != nil {
+		return nil, err
+	}
+	return &schnorr.NonceCommitment{Index: c.Index, Commitment: b}, nil
+}
+
+/*
+Round 2 message of the cluster signing of package schnorr
+*/
+func (in *Injector) NonceReveal(r *schnorr.NonceReveal) (*schnorr.NonceReveal, error) {
+	R, err := in.Message(Cluster, RoundReveal, int(r.Index), r.R)
+	if err != nil {
+		return nil, err
+	}
+	return &schnorr.NonceReveal{Index: r.Index, R: R}, nil
+}
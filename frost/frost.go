@@ -0,0 +1,467 @@
+/*
+FROST threshold Schnorr signatures (RFC 9591) in the RFC ciphersuites
+
+	FROST(secp256k1, SHA-256)  contextString "FROST-secp256k1-SHA256-v1"
+	FROST(P-256, SHA-256)      contextString "FROST-P256-SHA256-v1"
+
+Keys are split by a trusted dealer (TrustedDealerKeygen, RFC appendix C). Signing
+takes two rounds: every participant publishes a Commitment to two fresh nonces,
+then produces a signature share over the message and the commitment list chosen
+by the coordinator, who verifies the shares and aggregates them.
+
+The RFC test vectors fix the randomness of nonce generation, CommitWithRandomness
+takes it explicitly so the vectors can be replayed.
+
+ristretto255 and Ed25519 ciphersuites aren't implemented, Go's standard library
+doesn't expose the edwards25519 group.
+*/
+package frost
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/internal/ec"
+)
+
+var (
+	ErrInvalidThreshold  = errors.New("frost: threshold must satisfy 2 <= min <= max")
+	ErrInvalidScalar     = errors.New("frost: invalid scalar encoding")
+	ErrInvalidElement    = errors.New("frost: invalid element encoding")
+	ErrCommitmentList    = errors.New("frost: invalid commitment list")
+	ErrInvalidShare      = errors.New("frost: invalid signature share")
+	ErrInvalidSignature  = errors.New("frost: invalid signature")
+	ErrNonceReuse        = errors.New("frost: nonces were already used")
+	ErrUnknownIdentifier = errors.New("frost: participant is not in the commitment list")
+)
+
+/*
+Group element, the identity has nil coordinates
+*/
+type Point = ec.Point
+
+type Ciphersuite struct {
+	contextString string
+	curve         *ec.Curve
+}
+
+var (
+	Secp256k1SHA256 = &Ciphersuite{"FROST-secp256k1-SHA256-v1", ec.Secp256k1()}
+	P256SHA256      = &Ciphersuite{"FROST-P256-SHA256-v1", ec.P256()}
+)
+
+func (cs *Ciphersuite) ID() string {
+	return cs.contextString
+}
+
+/*
+Order of the group
+*/
+func (cs *Ciphersuite) Order() *big.Int {
+	return new(big.Int).Set(cs.curve.N)
+}
+
+/*
+Long-lived key material of a single participant
+*/
+type KeyPackage struct {
+	Identifier     *big.Int // non-zero scalar, 1..max for the trusted dealer
+	SigningShare   *big.Int // sk_i
+	VerifyingShare *Point   // PK_i = G * sk_i
+	VerifyingKey   *Point   // group public key
+	MinSigners     int
+}
+
+/*
+Secret nonces of a single signing session, used at most once
+*/
+type Nonces struct {
+	hiding, binding *big.Int
+}
+
+/*
+Public commitment to the nonces of a participant
+*/
+type Commitment struct {
+	Identifier *big.Int
+	Hiding     *Point
+	Binding    *Point
+}
+
+type Signature struct {
+	R *Point
+	Z *big.Int
+}
+
+/*
+Split secret (random if nil) into maxSigners shares, any minSigners of them can sign.
+Returns the key packages, the group public key and the VSS commitment.
+*/
+func (cs *Ciphersuite) TrustedDealerKeygen(secret *big.Int, maxSigners, minSigners int) ([]*KeyPackage, *Point, []*Point, error) {
+	if minSigners < 2 || minSigners > maxSigners {
+		return nil, nil, nil, ErrInvalidThreshold
+	}
+	if secret == nil {
+		var err error
+		if secret, err = entropy.Scalar(cs.curve.N); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	coefficients := []*big.Int{new(big.Int).Mod(secret, cs.curve.N)}
+	for i := 1; i < minSigners; i++ {
+		a, err := entropy.Scalar(cs.curve.N)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		coefficients = append(coefficients, a)
+	}
+
+	commitment := make([]*Point, len(coefficients))
+	for i, a := range coefficients {
+		commitment[i] = cs.curve.ScalarBaseMult(a)
+	}
+	groupKey := commitment[0]
+
+	packages := make([]*KeyPackage, maxSigners)
+	for i := range packages {
+		id := big.NewInt(int64(i + 1))
+		share := cs.evalPolynomial(coefficients, id)
+		packages[i] = &KeyPackage{id, share, cs.curve.ScalarBaseMult(share), groupKey, minSigners}
+	}
+	return packages, groupKey, commitment, nil
+}
+
+/*
+Check the share against the dealer's VSS commitment (vss_verify)
+*/
+func (cs *Ciphersuite) VerifyKeyPackage(kp *KeyPackage, commitment []*Point) bool {
+	expected := &Point{}
+	power := big.NewInt(1)
+	for _, c := range commitment {
+		expected = cs.curve.Add(expected, cs.curve.ScalarMult(c, power))
+		power = new(big.Int).Mul(power, kp.Identifier)
+		power.Mod(power, cs.curve.N)
+	}
+	return cs.curve.ScalarBaseMult(kp.SigningShare).Equal(expected) &&
+		expected.Equal(kp.VerifyingShare) && len(commitment) > 0 && commitment[0].Equal(kp.VerifyingKey)
+}
+
+/*
+Round 1 - generate nonces and the commitment to publish
+*/
+func (cs *Ciphersuite) Commit(kp *KeyPackage) (*Nonces, *Commitment, error) {
+	hidingRandom, bindingRandom := make([]byte, 32), make([]byte, 32)
+	if _, err := io.ReadFull(entropy.Reader, hidingRandom); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(entropy.Reader, bindingRandom); err != nil {
+		return nil, nil, err
+	}
+	nonces, commitment := cs.CommitWithRandomness(kp, hidingRandom, bindingRandom)
+	return nonces, commitment, nil
+}
+
+/*
+Round 1 with caller supplied randomness, for test vectors only
+*/
+func (cs *Ciphersuite) CommitWithRandomness(kp *KeyPackage, hidingRandom, bindingRandom []byte) (*Nonces, *Commitment) {
+	nonces := &Nonces{cs.nonceGenerate(kp.SigningShare, hidingRandom), cs.nonceGenerate(kp.SigningShare, bindingRandom)}
+	return nonces, &Commitment{
+		Identifier: new(big.Int).Set(kp.Identifier),
+		Hiding:     cs.curve.ScalarBaseMult(nonces.hiding),
+		Binding:    cs.curve.ScalarBaseMult(nonces.binding),
+	}
+}
+
+/*
+Round 2 - signature share over msg. The nonces are erased, they can't be used again.
+*/
+func (cs *Ciphersuite) Sign(kp *KeyPackage, nonces *Nonces, msg []byte, commitments []*Commitment) (*big.Int, error) {
+	hiding, binding := nonces.hiding, nonces.binding
+	nonces.hiding, nonces.binding = nil, nil
+	if hiding == nil {
+		return nil, ErrNonceReuse
+	}
+
+	commitments, err := cs.sortCommitments(commitments)
+	if err != nil {
+		return nil, err
+	}
+	own := findCommitment(commitments, kp.Identifier)
+	if own == nil {
+		return nil, ErrUnknownIdentifier
+	}
+	if !own.Hiding.Equal(cs.curve.ScalarBaseMult(hiding)) || !own.Binding.Equal(cs.curve.ScalarBaseMult(binding)) {
+		return nil, ErrCommitmentList
+	}
+
+	bindingFactors := cs.bindingFactors(kp.VerifyingKey, commitments, msg)
+	R := cs.groupCommitment(commitments, bindingFactors)
+	lambda := cs.interpolatingValue(commitments, kp.Identifier)
+	c := cs.challenge(R, kp.VerifyingKey, msg)
+
+	// z_i = hiding + binding * rho_i + lambda_i * sk_i * c
+	z := new(big.Int).Mul(binding, bindingFactors[kp.Identifier.String()])
+	z.Add(z, hiding)
+	lambda.Mul(lambda, kp.SigningShare)
+	lambda.Mul(lambda, c)
+	z.Add(z, lambda)
+	return z.Mod(z, cs.curve.N), nil
+}
+
+/*
+Coordinator - check the signature share of a single participant
+*/
+func (cs *Ciphersuite) VerifySignatureShare(identifier *big.Int, verifyingShare *Point, share *big.Int,
+	commitments []*Commitment, groupKey *Point, msg []byte) error {
+	commitments, err := cs.sortCommitments(commitments)
+	if err != nil {
+		return err
+	}
+	own := findCommitment(commitments, identifier)
+	if own == nil {
+		return ErrUnknownIdentifier
+	}
+
+	bindingFactors := cs.bindingFactors(groupKey, commitments, msg)
+	R := cs.groupCommitment(commitments, bindingFactors)
+	c := cs.challenge(R, groupKey, msg)
+	lambda := cs.interpolatingValue(commitments, identifier)
+
+	// G * z_i == D_i + E_i * rho_i + PK_i * (c * lambda_i)
+	commShare := cs.curve.Add(own.Hiding, cs.curve.ScalarMult(own.Binding, bindingFactors[identifier.String()]))
+	right := cs.curve.Add(commShare, cs.curve.ScalarMult(verifyingShare, lambda.Mul(lambda, c)))
+	if !cs.curve.ScalarBaseMult(share).Equal(right) {
+		return ErrInvalidShare
+	}
+	return nil
+}
+
+/*
+Coordinator - aggregate signature shares, in the order of commitments
+*/
+func (cs *Ciphersuite) Aggregate(commitments []*Commitment, msg []byte, shares []*big.Int, groupKey *Point) (*Signature, error) {
+	if len(shares) != len(commitments) {
+		return nil, ErrCommitmentList
+	}
+	sorted, err := cs.sortCommitments(commitments)
+	if err != nil {
+		return nil, err
+	}
+
+	z := new(big.Int)
+	for _, share := range shares {
+		z.Add(z, share)
+	}
+	signature := &Signature{cs.groupCommitment(sorted, cs.bindingFactors(groupKey, sorted, msg)), z.Mod(z, cs.curve.N)}
+	if !cs.Verify(msg, signature, groupKey) {
+		return nil, ErrInvalidSignature
+	}
+	return signature, nil
+}
+
+/*
+Single-party verification of the aggregate signature: G * z == R + PK * c
+*/
+func (cs *Ciphersuite) Verify(msg []byte, signature *Signature, groupKey *Point) bool {
+	if signature.R.IsIdentity() || groupKey.IsIdentity() || signature.Z.Sign() < 0 || signature.Z.Cmp(cs.curve.N) >= 0 {
+		return false
+	}
+	c := cs.challenge(signature.R, groupKey, msg)
+	right := cs.curve.Add(signature.R, cs.curve.ScalarMult(groupKey, c))
+	return cs.curve.ScalarBaseMult(signature.Z).Equal(right)
+}
+
+/*
+Encoding: SerializeElement(R) || SerializeScalar(z)
+*/
+func (cs *Ciphersuite) SerializeSignature(signature *Signature) ([]byte, error) {
+	R, err := cs.SerializeElement(signature.R)
+	if err != nil {
+		return nil, err
+	}
+	return append(R, cs.SerializeScalar(signature.Z)...), nil
+}
+
+func (cs *Ciphersuite) DeserializeSignature(b []byte) (*Signature, error) {
+	elementLen := 1 + cs.curve.ByteLen()
+	if len(b) != elementLen+cs.curve.ByteLen() {
+		return nil, ErrInvalidSignature
+	}
+	R, err := cs.DeserializeElement(b[:elementLen])
+	if err != nil {
+		return nil, err
+	}
+	z, err := cs.DeserializeScalar(b[elementLen:])
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{R, z}, nil
+}
+
+/*
+Compressed SEC1 encoding, the identity can't be serialized
+*/
+func (cs *Ciphersuite) SerializeElement(p *Point) ([]byte, error) {
+	return cs.curve.MarshalCompressed(p)
+}
+
+func (cs *Ciphersuite) DeserializeElement(b []byte) (*Point, error) {
+	p, err := cs.curve.UnmarshalCompressed(b)
+	if err != nil {
+		return nil, ErrInvalidElement
+	}
+	return p, nil
+}
+
+/*
+Fixed width big-endian encoding
+*/
+func (cs *Ciphersuite) SerializeScalar(s *big.Int) []byte {
+	return new(big.Int).Mod(s, cs.curve.N).FillBytes(make([]byte, cs.curve.ByteLen()))
+}
+
+func (cs *Ciphersuite) DeserializeScalar(b []byte) (*big.Int, error) {
+	s := new(big.Int).SetBytes(b)
+	if len(b) != cs.curve.ByteLen() || s.Cmp(cs.curve.N) >= 0 {
+		return nil, ErrInvalidScalar
+	}
+	return s, nil
+}
+
+/*
+Commitment list sorted by identifier, identifiers have to be unique and non-zero
+*/
+func (cs *Ciphersuite) sortCommitments(commitments []*Commitment) ([]*Commitment, error) {
+	sorted := append([]*Commitment(nil), commitments...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Identifier.Cmp(sorted[j].Identifier) < 0 })
+	for i, c := range sorted {
+		if c.Identifier.Sign() <= 0 || c.Identifier.Cmp(cs.curve.N) >= 0 ||
+			(i > 0 && sorted[i-1].Identifier.Cmp(c.Identifier) == 0) ||
+			c.Hiding.IsIdentity() || c.Binding.IsIdentity() {
+			return nil, ErrCommitmentList
+		}
+	}
+	return sorted, nil
+}
+
+func findCommitment(commitments []*Commitment, identifier *big.Int) *Commitment {
+	for _, c := range commitments {
+		if c.Identifier.Cmp(identifier) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+/*
+encode_group_commitment_list
+*/
+func (cs *Ciphersuite) encodeCommitments(commitments []*Commitment) []byte {
+	var buf []byte
+	for _, c := range commitments {
+		hiding, _ := cs.SerializeElement(c.Hiding)
+		binding, _ := cs.SerializeElement(c.Binding)
+		buf = append(append(append(buf, cs.SerializeScalar(c.Identifier)...), hiding...), binding...)
+	}
+	return buf
+}
+
+/*
+compute_binding_factors, keyed by identifier
+*/
+func (cs *Ciphersuite) bindingFactors(groupKey *Point, commitments []*Commitment, msg []byte) map[string]*big.Int {
+	groupKeyEnc, _ := cs.SerializeElement(groupKey)
+	msgHash := cs.h4(msg)
+	commitmentHash := cs.h5(cs.encodeCommitments(commitments))
+	prefix := append(append(groupKeyEnc, msgHash...), commitmentHash...)
+
+	factors := make(map[string]*big.Int, len(commitments))
+	for _, c := range commitments {
+		input := append(append([]byte(nil), prefix...), cs.SerializeScalar(c.Identifier)...)
+		factors[c.Identifier.String()] = cs.h1(input)
+	}
+	return factors
+}
+
+/*
+compute_group_commitment: sum(D_i + E_i * rho_i)
+*/
+func (cs *Ciphersuite) groupCommitment(commitments []*Commitment, bindingFactors map[string]*big.Int) *Point {
+	R := &Point{}
+	for _, c := range commitments {
+		R = cs.curve.Add(R, c.Hiding)
+		R = cs.curve.Add(R, cs.curve.ScalarMult(c.Binding, bindingFactors[c.Identifier.String()]))
+	}
+	return R
+}
+
+/*
+derive_interpolating_value
+*/
+func (cs *Ciphersuite) interpolatingValue(commitments []*Commitment, identifier *big.Int) *big.Int {
+	num, den := big.NewInt(1), big.NewInt(1)
+	for _, c := range commitments {
+		if c.Identifier.Cmp(identifier) == 0 {
+			continue
+		}
+		num.Mul(num, c.Identifier)
+		num.Mod(num, cs.curve.N)
+		den.Mul(den, new(big.Int).Sub(c.Identifier, identifier))
+		den.Mod(den, cs.curve.N)
+	}
+	return num.Mul(num, den.ModInverse(den, cs.curve.N)).Mod(num, cs.curve.N)
+}
+
+/*
+compute_challenge: H2(SerializeElement(R) || SerializeElement(PK) || msg)
+*/
+func (cs *Ciphersuite) challenge(R, groupKey *Point, msg []byte) *big.Int {
+	Renc, _ := cs.SerializeElement(R)
+	PKenc, _ := cs.SerializeElement(groupKey)
+	return cs.h2(append(append(Renc, PKenc...), msg...))
+}
+
+/*
+nonce_generate: H3(random_bytes || SerializeScalar(secret))
+*/
+func (cs *Ciphersuite) nonceGenerate(secret *big.Int, random []byte) *big.Int {
+	return cs.h3(append(append([]byte(nil), random...), cs.SerializeScalar(secret)...))
+}
+
+func (cs *Ciphersuite) h1(m []byte) *big.Int {
+	return cs.curve.HashToScalar(m, []byte(cs.contextString+"rho"))
+}
+
+func (cs *Ciphersuite) h2(m []byte) *big.Int {
+	return cs.curve.HashToScalar(m, []byte(cs.contextString+"chal"))
+}
+
+func (cs *Ciphersuite) h3(m []byte) *big.Int {
+	return cs.curve.HashToScalar(m, []byte(cs.contextString+"nonce"))
+}
+
+func (cs *Ciphersuite) h4(m []byte) []byte {
+	sum := sha256.Sum256(append([]byte(cs.contextString+"msg"), m...))
+	return sum[:]
+}
+
+func (cs *Ciphersuite) h5(m []byte) []byte {
+	sum := sha256.Sum256(append([]byte(cs.contextString+"com"), m...))
+	return sum[:]
+}
+
+func (cs *Ciphersuite) evalPolynomial(coefficients []*big.Int, x *big.Int) *big.Int {
+	y := new(big.Int)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y.Mul(y, x)
+		y.Add(y, coefficients[i])
+		y.Mod(y, cs.curve.N)
+	}
+	return y
+}
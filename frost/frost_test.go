@@ -0,0 +1,233 @@
+package frost
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+/*
+Participant of an RFC 9591 appendix E vector, empty fields aren't checked
+*/
+type vectorSigner struct {
+	identifier        int64
+	hidingRandomness  string
+	bindingRandomness string
+	hidingNonce       string
+	bindingNonce      string
+	hidingCommitment  string
+	bindingCommitment string
+	sigShare          string
+}
+
+type vector struct {
+	cs          *Ciphersuite
+	groupSecret string
+	groupKey    string
+	message     string
+	coefficient string // share_polynomial_coefficients[1]
+	shares      []string
+	signers     []vectorSigner // the participant list
+	sig         string
+}
+
+var vectors = map[string]vector{
+	// RFC 9591 appendix E.4, FROST(P-256, SHA-256)
+	"P256": {
+		cs:          P256SHA256,
+		groupSecret: "8ba9bba2e0fd8c4767154d35a0b7562244a4aaf6f36c8fb8735fa48b301bd8de",
+		groupKey:    "023a309ad94e9fe8a7ba45dfc58f38bf091959d3c99cfbd02b4dc00585ec45ab70",
+		message:     "74657374",
+		coefficient: "80f25e6c0709353e46bfbe882a11bdbb1f8097e46340eb8673b7e14556e6c3a4",
+		shares: []string{
+			"0c9c1a0fe806c184add50bbdcac913dda73e482daf95dcb9f35dbb0d8a9f7731",
+			"8d8e787bef0ff6c2f494ca45f4dad198c6bee01212d6c84067159c52e1863ad5",
+			"0e80d6e8f6192c003b5488ce1eec8f5429587d48cf001541e713b2d53c09d928",
+		},
+		signers: []vectorSigner{
+			{
+				identifier:        1,
+				hidingRandomness:  "ec4c891c85fee802a9d757a67d1252e7f4e5efb8a538991ac18fbd0e06fb6fd3",
+				bindingRandomness: "9334e29d09061223f69a09421715a347e4e6deba77444c8f42b0c833f80f4ef9",
+				hidingNonce:       "9f0542a5ba879a58f255c09f06da7102ef6a2dec6279700c656d58394d8facd4",
+				bindingNonce:      "6513dfe7429aa2fc972c69bb495b27118c45bbc6e654bb9dc9be55385b55c0d7",
+				hidingCommitment:  "0213b3e6298bf8ad46fd5e9389519a8665d63d98f4ec6a1fcca434e809d2d8070e",
+				bindingCommitment: "02188ff1390bf69374d7b272e454b1878ef10a6b6ea3ff36f114b300b4dbd5233b",
+				sigShare:          "400308eaed7a2ddee02a265abe6a1cfe04d946ee8720768899619cfabe7a3aeb",
+			},
+			{
+				identifier:        3,
+				hidingRandomness:  "c0451c5a0a5480d6c1f860e5db7d655233dca2669fd90ff048454b8ce983367b",
+				bindingRandomness: "2ba5f7793ae700e40e78937a82f407dd35e847e33d1e607b5c7eb6ed2a8ed799",
+				hidingNonce:       "f73444a8972bcda9e506bbca3d2b1c083c10facdf4bb5d47fef7c2dc1d9f2a0d",
+				bindingNonce:      "44c6a29075d6e7e4f8b97796205f9e22062e7835141470afe9417fd317c1c303",
+				hidingCommitment:  "033ac9a5fe4a8b57316ba1c34e8a6de453033b750e8984924a984eb67a11e73a3f",
+				bindingCommitment: "03a7a2480ee16199262e648aea3acab628a53e9b8c1945078f2ddfbdc98b7df369",
+				sigShare:          "561da3c179edbb0502d941bb3e3ace3c37d122aaa46fb54499f15f3a3331de44",
+			},
+		},
+		sig: "026d8d434874f87bdb7bc0dfd239b2c00639044f9dcb195e9a04426f70bfa4b70d9620acac6767e8e3e3036815fca4eb3a3caa69992b902bcd3352fc34f1ac192f",
+	},
+	// RFC 9591 appendix E.5, FROST(secp256k1, SHA-256): key generation and
+	// the round one outputs of participant 1. The round two values aren't
+	// checked, participant 3 commits with its own randomness and the
+	// signature only has to verify.
+	"secp256k1": {
+		cs:          Secp256k1SHA256,
+		groupSecret: "0d004150d27c3bf2a42f312683d35fac7394b1e9e318249c1bfe7f0795a83114",
+		groupKey:    "02f37c34b66ced1fb51c34a90bdae006901f10625cc06c4f64663b0eae87d87b4f",
+		message:     "74657374",
+		coefficient: "fbf85eadae3058ea14f19148bb72b45e4399c0b16028acaf0395c9b03c823579",
+		shares: []string{
+			"08f89ffe80ac94dcb920c26f3f46140bfc7f95b493f8310f5fc1ea2b01f4254c",
+			"04f0feac2edcedc6ce1253b7fab8c86b856a797f44d83d82a385554e6e401984",
+			"00e95d59dd0d46b0e303e500b62b7ccb0e555d49f5b849f5e748c071da8c0dbc",
+		},
+		signers: []vectorSigner{
+			{
+				identifier:        1,
+				hidingRandomness:  "7ea5ed09af19f6ff21040c07ec2d2adbd35b759da5a401d4c99dd26b82391cb2",
+				bindingRandomness: "47acab018f116020c10cb9b9abdc7ac10aae1b48ca6e36dc15acb6ec9be5cdc5",
+				hidingNonce:       "841d3a6450d7580b4da83c8e618414d0f024391f2aeb511d7579224420aa81f0",
+				bindingNonce:      "8d2624f532af631377f33cf44b5ac5f849067cae2eacb88680a31e77c79b5a80",
+				hidingCommitment:  "03c699af97d26bb4d3f05232ec5e1938c12f1e6ae97643c8f8f11c9820303f1904",
+				bindingCommitment: "02fa2aaccd51b948c9dc1a325d77226e98a5a3fe65fe9ba213761a60123040a45e",
+			},
+			{
+				identifier:        3,
+				hidingRandomness:  "0303030303030303030303030303030303030303030303030303030303030303",
+				bindingRandomness: "0404040404040404040404040404040404040404040404040404040404040404",
+			},
+		},
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for name, v := range vectors {
+		v := v
+		t.Run(name, func(t *testing.T) {
+			cs := v.cs
+			msg := decode(t, v.message)
+			secret := new(big.Int).SetBytes(decode(t, v.groupSecret))
+			coefficients := []*big.Int{secret, new(big.Int).SetBytes(decode(t, v.coefficient))}
+
+			groupKey := cs.curve.ScalarBaseMult(secret)
+			checkElement(t, cs, "group public key", groupKey, v.groupKey)
+
+			packages := make(map[int64]*KeyPackage)
+			for i, want := range v.shares {
+				id := big.NewInt(int64(i + 1))
+				share := cs.evalPolynomial(coefficients, id)
+				checkScalar(t, cs, "share", share, want)
+				packages[id.Int64()] = &KeyPackage{id, share, cs.curve.ScalarBaseMult(share), groupKey, len(coefficients)}
+			}
+
+			var commitments []*Commitment
+			nonces := make(map[int64]*Nonces)
+			for _, s := range v.signers {
+				n, c := cs.CommitWithRandomness(packages[s.identifier], decode(t, s.hidingRandomness), decode(t, s.bindingRandomness))
+				checkScalar(t, cs, "hiding nonce", n.hiding, s.hidingNonce)
+				checkScalar(t, cs, "binding nonce", n.binding, s.bindingNonce)
+				checkElement(t, cs, "hiding commitment", c.Hiding, s.hidingCommitment)
+				checkElement(t, cs, "binding commitment", c.Binding, s.bindingCommitment)
+				nonces[s.identifier] = n
+				commitments = append(commitments, c)
+			}
+
+			var shares []*big.Int
+			for _, s := range v.signers {
+				kp := packages[s.identifier]
+				share, err := cs.Sign(kp, nonces[s.identifier], msg, commitments)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkScalar(t, cs, "signature share", share, s.sigShare)
+				if err := cs.VerifySignatureShare(kp.Identifier, kp.VerifyingShare, share, commitments, groupKey, msg); err != nil {
+					t.Errorf("share of participant %d: %v", s.identifier, err)
+				}
+				shares = append(shares, share)
+			}
+
+			signature, err := cs.Aggregate(commitments, msg, shares, groupKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := cs.SerializeSignature(signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.sig != "" && !bytes.Equal(encoded, decode(t, v.sig)) {
+				t.Errorf("signature %x, want %s", encoded, v.sig)
+			}
+			if !cs.Verify(msg, signature, groupKey) || cs.Verify([]byte("tset"), signature, groupKey) {
+				t.Error("signature verification")
+			}
+		})
+	}
+}
+
+func TestNonceReuse(t *testing.T) {
+	cs := Secp256k1SHA256
+	packages, groupKey, commitment, err := cs.TrustedDealerKeygen(nil, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kp := range packages {
+		if !cs.VerifyKeyPackage(kp, commitment) {
+			t.Fatalf("key package %v doesn't match the commitment", kp.Identifier)
+		}
+	}
+
+	n1, c1, err := cs.Commit(packages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2, c2, err := cs.Commit(packages[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("message")
+	commitments := []*Commitment{c1, c2}
+	z1, err := cs.Sign(packages[0], n1, msg, commitments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Sign(packages[0], n1, msg, commitments); err != ErrNonceReuse {
+		t.Fatalf("second signature with the same nonces: %v", err)
+	}
+	z2, err := cs.Sign(packages[1], n2, msg, commitments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Aggregate(commitments, msg, []*big.Int{z1, z2}, groupKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkScalar(t *testing.T, cs *Ciphersuite, what string, s *big.Int, want string) {
+	t.Helper()
+	if want != "" && hex.EncodeToString(cs.SerializeScalar(s)) != want {
+		t.Errorf("%s %x, want %s", what, cs.SerializeScalar(s), want)
+	}
+}
+
+func checkElement(t *testing.T, cs *Ciphersuite, what string, p *Point, want string) {
+	t.Helper()
+	encoded, err := cs.SerializeElement(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != "" && hex.EncodeToString(encoded) != want {
+		t.Errorf("%s %x, want %s", what, encoded, want)
+	}
+}
+
+func decode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,270 @@
+package hsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Key attestation
+
+Backends generating keys inside hardware (HSM, TPM, enclave) can prove it with
+an attestation: a statement about the key signed by the device and chained to
+its manufacturer. Backends implementing Attester return the statement in the
+backend's own format, AttestedPublicKey binds it to the public key in a single
+encoding relying parties can store and pass around:
+
+	version (1) || len(pk) || pk || len(format) || format || len(blob) || blob
+
+with 4 byte lengths and pk in the PublicKey.Bytes encoding. VerifyAttestation
+checks the blob with the verifier of its format, which has to confirm that the
+blob attests exactly this key. Verifiers carry the roots the relying party
+trusts, formats without a verifier are rejected.
+
+SoftHSM attests its keys in FormatSoftHSM with a device key generated when the
+token is initialized, SoftHSM.AttestationKey is the root to trust. A SoftHSM
+attestation proves only that the key was generated by that token file, which
+isn't hardware.
+*/
+
+const FormatSoftHSM = "softhsm"
+
+// AAD of the sealed device key, user labels are authenticated the same way
+const attestationKeyLabel = "softhsm/attestation-key"
+
+const attestedKeyVersion = 1
+
+var (
+	ErrUnknownAttestationFormat = errors.New("hsm: no verifier for the attestation format")
+	ErrInvalidAttestation       = errors.New("hsm: invalid key attestation")
+	ErrInvalidAttestedKey       = errors.New("hsm: invalid attested public key encoding")
+)
+
+/*
+Backend which can attest the keys it generated
+*/
+type Attester interface {
+	Attest(label string) (*Attestation, error)
+}
+
+/*
+Attestation statement of a backend
+*/
+type Attestation struct {
+	Format string // e.g. FormatSoftHSM, names the verifier
+	Blob   []byte // statement in the backend's format
+}
+
+/*
+Checks attestation blobs of one format
+*/
+type AttestationVerifier interface {
+	// Error unless the blob attests that pk was generated inside a trusted backend
+	VerifyAttestation(pk *schnorr.PublicKey, blob []byte) error
+}
+
+/*
+Public key with the attestation of the backend holding its private key
+*/
+type AttestedPublicKey struct {
+	Key         *schnorr.PublicKey
+	Attestation *Attestation
+}
+
+/*
+Public key of the label with its attestation, the backend has to implement Attester
+*/
+func AttestedKey(backend KeyBackend, label string) (*AttestedPublicKey, error) {
+	attester, ok := backend.(Attester)
+	if !ok {
+		return nil, fmt.Errorf("%w: backend doesn't attest keys", ErrUnknownAttestationFormat)
+	}
+	pk, err := backend.PublicKey(label)
+	if err != nil {
+		return nil, err
+	}
+	a, err := attester.Attest(label)
+	if err != nil {
+		return nil, err
+	}
+	return &AttestedPublicKey{pk, a}, nil
+}
+
+/*
+Check the attestation of the key with the verifier of its format
+*/
+func VerifyAttestation(apk *AttestedPublicKey, verifiers map[string]AttestationVerifier) error {
+	if apk == nil || apk.Key == nil || apk.Attestation == nil {
+		return ErrInvalidAttestation
+	}
+	v, ok := verifiers[apk.Attestation.Format]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownAttestationFormat, apk.Attestation.Format)
+	}
+	return v.VerifyAttestation(apk.Key, apk.Attestation.Blob)
+}
+
+func (apk *AttestedPublicKey) Bytes() []byte {
+	b := []byte{attestedKeyVersion}
+	b = appendField(b, apk.Key.Bytes())
+	b = appendField(b, []byte(apk.Attestation.Format))
+	return appendField(b, apk.Attestation.Blob)
+}
+
+func ParseAttestedPublicKey(b []byte) (*AttestedPublicKey, error) {
+	if len(b) < 1 || b[0] != attestedKeyVersion {
+		return nil, ErrInvalidAttestedKey
+	}
+	fields, err := readFields(b[1:], 3)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := schnorr.ParsePublicKey(fields[0])
+	if err != nil {
+		return nil, ErrInvalidAttestedKey
+	}
+	return &AttestedPublicKey{pk, &Attestation{string(fields[1]), fields[2]}}, nil
+}
+
+/*
+SoftHSM attestation: the device key signs
+
+	"schnorr/softhsm/attestation" || len(label) || label || created (8 byte unix seconds) || pk
+
+the blob is len(device key ID) || device key ID || len(label) || label || created || signature
+*/
+func (h *SoftHSM) Attest(label string) (*Attestation, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.operation("attest")
+
+	_, pk, err := h.loadKey(label)
+	if err != nil {
+		return nil, err
+	}
+	device, devicePub, err := h.attestationKey()
+	if err != nil {
+		return nil, err
+	}
+	created := h.state.Created[label].Unix()
+	signature, err := schnorr.TrySign(softHSMStatement(label, created, pk), device)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := appendField(nil, []byte(devicePub.KeyID()))
+	blob = appendField(blob, []byte(label))
+	blob = binary.BigEndian.AppendUint64(blob, uint64(created))
+	blob = append(blob, signature.Bytes()...)
+	return &Attestation{FormatSoftHSM, blob}, h.save()
+}
+
+/*
+Device key of the token, the root relying parties trust for its attestations
+*/
+func (h *SoftHSM) AttestationKey() (*schnorr.PublicKey, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, pk, err := h.attestationKey()
+	if err != nil {
+		return nil, err
+	}
+	return pk, h.save()
+}
+
+/*
+Verifier of FormatSoftHSM attestations made by the given device keys
+*/
+type SoftHSMAttestationVerifier struct {
+	Devices []*schnorr.PublicKey // trusted device keys (SoftHSM.AttestationKey)
+}
+
+func (v *SoftHSMAttestationVerifier) VerifyAttestation(pk *schnorr.PublicKey, blob []byte) error {
+	keyID, rest, err := readField(blob)
+	if err != nil {
+		return ErrInvalidAttestation
+	}
+	label, rest, err := readField(rest)
+	if err != nil || len(rest) < 8 {
+		return ErrInvalidAttestation
+	}
+	created := int64(binary.BigEndian.Uint64(rest))
+	signature, err := schnorr.ParseSignature(rest[8:])
+	if err != nil {
+		return ErrInvalidAttestation
+	}
+
+	for _, device := range v.Devices {
+		if device.KeyID() != string(keyID) {
+			continue
+		}
+		if !schnorr.Verify(softHSMStatement(string(label), created, pk), signature, device) {
+			return ErrInvalidAttestation
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: untrusted device key %s", ErrInvalidAttestation, keyID)
+}
+
+/*
+Device key, generated on first use in tokens created before attestation
+*/
+func (h *SoftHSM) attestationKey() (*schnorr.SignatureKey, *schnorr.PublicKey, error) {
+	if h.state.AttestationKey == nil {
+		scalar, err := randomScalar()
+		if err != nil {
+			return nil, nil, err
+		}
+		if h.state.AttestationKey, err = h.seal(attestationKeyLabel, scalar); err != nil {
+			return nil, nil, err
+		}
+	}
+	scalar, err := h.open(attestationKeyLabel, h.state.AttestationKey)
+	if err != nil {
+		return nil, nil, ErrCorrupted
+	}
+	return importScalar(scalar)
+}
+
+func softHSMStatement(label string, created int64, pk *schnorr.PublicKey) string {
+	b := appendField([]byte("schnorr/softhsm/attestation"), []byte(label))
+	b = binary.BigEndian.AppendUint64(b, uint64(created))
+	return string(append(b, pk.Bytes()...))
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, ErrInvalidAttestedKey
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, ErrInvalidAttestedKey
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
+
+/*
+Exactly count fields and nothing else
+*/
+func readFields(b []byte, count int) ([][]byte, error) {
+	fields := make([][]byte, count)
+	var err error
+	for i := range fields {
+		if fields[i], b, err = readField(b); err != nil {
+			return nil, err
+		}
+	}
+	if len(b) != 0 {
+		return nil, ErrInvalidAttestedKey
+	}
+	return fields, nil
+}
@@ -0,0 +1,97 @@
+package hsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func TestAttestation(t *testing.T) {
+	h, _ := token(t)
+	if _, err := h.GenerateKey("signing"); err != nil {
+		t.Fatal(err)
+	}
+	device, err := h.AttestationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers := map[string]AttestationVerifier{FormatSoftHSM: &SoftHSMAttestationVerifier{[]*schnorr.PublicKey{device}}}
+
+	apk, err := AttestedKey(h, "signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseAttestedPublicKey(apk.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAttestation(parsed, verifiers); err != nil {
+		t.Fatal(err)
+	}
+
+	// the attestation of one key doesn't vouch for another
+	other, _ := token(t)
+	otherPK, err := other.GenerateKey("signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := &AttestedPublicKey{otherPK, apk.Attestation}
+	if err := VerifyAttestation(swapped, verifiers); err != ErrInvalidAttestation {
+		t.Errorf("attestation of another key: %v", err)
+	}
+	foreign, err := AttestedKey(other, "signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAttestation(foreign, verifiers); !errors.Is(err, ErrInvalidAttestation) {
+		t.Errorf("key of an untrusted token: %v", err)
+	}
+	if err := VerifyAttestation(apk, nil); !errors.Is(err, ErrUnknownAttestationFormat) {
+		t.Errorf("format without verifier: %v", err)
+	}
+	if err := VerifyAttestation(&AttestedPublicKey{Key: apk.Key}, verifiers); err != ErrInvalidAttestation {
+		t.Errorf("missing attestation: %v", err)
+	}
+
+	blob := append([]byte(nil), apk.Attestation.Blob...)
+	blob[len(blob)-1] ^= 1
+	for name, bad := range map[string][]byte{
+		"changed":   blob,
+		"truncated": apk.Attestation.Blob[:6],
+		"empty":     nil,
+	} {
+		tampered := &AttestedPublicKey{apk.Key, &Attestation{FormatSoftHSM, bad}}
+		if err := VerifyAttestation(tampered, verifiers); err != ErrInvalidAttestation {
+			t.Errorf("%s blob: %v", name, err)
+		}
+	}
+
+	b := apk.Bytes()
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"version":   append([]byte{2}, b[1:]...),
+		"truncated": b[:len(b)-1],
+		"trailing":  append(append([]byte(nil), b...), 0),
+		"key":       append([]byte{attestedKeyVersion, 0, 0, 0, 1, 0}, b[len(b)-8:]...),
+	} {
+		if _, err := ParseAttestedPublicKey(bad); err != ErrInvalidAttestedKey {
+			t.Errorf("%s encoding: %v", name, err)
+		}
+	}
+	if _, err := h.Attest("missing"); err != ErrKeyNotFound {
+		t.Errorf("attestation of a missing key: %v", err)
+	}
+}
+
+/*
+Backend without attestation support
+*/
+type plainBackend struct{ KeyBackend }
+
+func TestAttestedKeyUnsupported(t *testing.T) {
+	h, _ := token(t)
+	if _, err := AttestedKey(plainBackend{h}, "signing"); !errors.Is(err, ErrUnknownAttestationFormat) {
+		t.Errorf("backend without attestation: %v", err)
+	}
+}
@@ -0,0 +1,405 @@
+/*
+Key backends keeping signature keys out of the application.
+
+KeyBackend is the interface of hardware security modules and similar key
+stores: keys are referenced by labels and never leave the backend, the
+application only gets public keys and signatures. Backends implementing
+Attester also prove that their keys were generated inside them (attestation.go).
+
+SoftHSM emulates an HSM in a single file for development and testing of HSM
+code paths without hardware: keys are encrypted under a PIN, wrong PINs lock
+the token after MaxPINAttempts, operations are counted and can be delayed to
+mimic the latency of a real device. It is NOT a secure key store.
+
+Every key has a persistent use counter and an optional quota (SetQuota), see
+usage.go.
+*/
+package hsm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrKeyNotFound  = errors.New("hsm: no key with the given label")
+	ErrKeyExists    = errors.New("hsm: key with the given label already exists")
+	ErrPINIncorrect = errors.New("hsm: incorrect PIN")
+	ErrPINLocked    = errors.New("hsm: token is locked after too many incorrect PINs")
+	ErrCorrupted    = errors.New("hsm: token file is corrupted")
+	ErrQuotaReached = errors.New("hsm: key has reached its signing quota")
+)
+
+type KeyBackend interface {
+	GenerateKey(label string) (*schnorr.PublicKey, error)
+	PublicKey(label string) (*schnorr.PublicKey, error)
+	Sign(label string, message string) (*schnorr.Signature, error)
+	DeleteKey(label string) error
+	Labels() ([]string, error)
+}
+
+/*
+Number of incorrect PINs after which the token is locked
+*/
+const MaxPINAttempts = 3
+
+const pinIterations = 100000
+
+/*
+Artificial latency of every operation: Latency plus uniformly random [0, Jitter)
+*/
+type Options struct {
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// Called for every signature before it is returned, e.g. to append the
+	// record to an audit log; an error withholds the signature and the use
+	// isn't counted
+	Audit func(rec *UsageRecord) error
+}
+
+type SoftHSM struct {
+	path string
+	opts Options
+
+	mu    sync.Mutex
+	key   cipher.AEAD // derived from the PIN
+	state *tokenFile
+}
+
+/*
+Persistent state of the token
+*/
+type tokenFile struct {
+	Salt           []byte               `json:"salt"`
+	Check          []byte               `json:"check"` // encrypted constant, verifies the PIN
+	FailedAttempts int                  `json:"failed_attempts"`
+	Keys           map[string][]byte    `json:"keys"` // label -> nonce || encrypted scalar
+	Counters       map[string]uint64    `json:"counters"`
+	Created        map[string]time.Time `json:"created"`
+	Uses           map[string]uint64    `json:"uses,omitempty"`            // signatures made by label
+	Quotas         map[string]uint64    `json:"quotas,omitempty"`          // maximum signatures by label, none if missing
+	AttestationKey []byte               `json:"attestation_key,omitempty"` // nonce || encrypted device scalar, see attestation.go
+}
+
+var pinCheck = []byte("schnorr/softhsm/pin-check")
+
+/*
+Open the token stored at path with the PIN, a new token is initialized with the PIN if the file doesn't exist
+*/
+func OpenSoftHSM(path, pin string, opts Options) (*SoftHSM, error) {
+	h := &SoftHSM{path: path, opts: opts}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, h.initialize(pin)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.state = &tokenFile{}
+	if err := json.Unmarshal(data, h.state); err != nil || len(h.state.Check) < 12 {
+		return nil, ErrCorrupted
+	}
+	if h.state.FailedAttempts >= MaxPINAttempts {
+		return nil, ErrPINLocked
+	}
+	// tokens written before the use counters
+	if h.state.Uses == nil {
+		h.state.Uses = make(map[string]uint64)
+	}
+	if h.state.Quotas == nil {
+		h.state.Quotas = make(map[string]uint64)
+	}
+
+	if h.key, err = pinCipher(pin, h.state.Salt); err != nil {
+		return nil, err
+	}
+	if _, err := h.open("", h.state.Check); err != nil {
+		h.state.FailedAttempts++
+		if err := h.save(); err != nil {
+			return nil, err
+		}
+		if h.state.FailedAttempts >= MaxPINAttempts {
+			return nil, ErrPINLocked
+		}
+		return nil, ErrPINIncorrect
+	}
+	if h.state.FailedAttempts != 0 {
+		h.state.FailedAttempts = 0
+		if err := h.save(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (h *SoftHSM) initialize(pin string) error {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(entropy.Reader, salt); err != nil {
+		return err
+	}
+	var err error
+	if h.key, err = pinCipher(pin, salt); err != nil {
+		return err
+	}
+	h.state = &tokenFile{
+		Salt:     salt,
+		Keys:     make(map[string][]byte),
+		Counters: make(map[string]uint64),
+		Created:  make(map[string]time.Time),
+		Uses:     make(map[string]uint64),
+		Quotas:   make(map[string]uint64),
+	}
+	if h.state.Check, err = h.seal("", pinCheck); err != nil {
+		return err
+	}
+	if _, _, err := h.attestationKey(); err != nil {
+		return err
+	}
+	return h.save()
+}
+
+func (h *SoftHSM) GenerateKey(label string) (*schnorr.PublicKey, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.operation("generate")
+
+	if _, ok := h.state.Keys[label]; ok {
+		return nil, ErrKeyExists
+	}
+
+	scalar, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	_, pk, err := importScalar(scalar)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.state.Keys[label], err = h.seal(label, scalar); err != nil {
+		return nil, err
+	}
+	h.state.Created[label] = schnorr.Now().UTC()
+	delete(h.state.Uses, label)
+	delete(h.state.Quotas, label)
+	return pk, h.save()
+}
+
+func (h *SoftHSM) PublicKey(label string) (*schnorr.PublicKey, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.operation("public-key")
+
+	_, pk, err := h.loadKey(label)
+	if err != nil {
+		return nil, err
+	}
+	return pk, h.save()
+}
+
+/*
+Sign with the key, fails with ErrQuotaReached once the key has made its quota
+of signatures. The signature is returned only after its use is counted in the
+token file (and passed to Options.Audit).
+*/
+func (h *SoftHSM) Sign(label string, message string) (*schnorr.Signature, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.operation("sign")
+
+	sk, pk, err := h.loadKey(label)
+	if err != nil {
+		return nil, err
+	}
+	if quota, ok := h.state.Quotas[label]; ok && h.state.Uses[label] >= quota {
+		return nil, ErrQuotaReached
+	}
+	signature, err := schnorr.TrySign(message, sk)
+	if err != nil {
+		return nil, err
+	}
+
+	h.state.Uses[label]++
+	if err := h.audit(label, pk, message); err != nil {
+		h.state.Uses[label]--
+		return nil, err
+	}
+	if err := h.save(); err != nil {
+		h.state.Uses[label]--
+		return nil, err
+	}
+	return signature, nil
+}
+
+func (h *SoftHSM) DeleteKey(label string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.operation("delete")
+
+	if _, ok := h.state.Keys[label]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(h.state.Keys, label)
+	delete(h.state.Created, label)
+	delete(h.state.Uses, label)
+	delete(h.state.Quotas, label)
+	return h.save()
+}
+
+func (h *SoftHSM) Labels() ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	labels := make([]string, 0, len(h.state.Keys))
+	for label := range h.state.Keys {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+/*
+Number of performed operations by type ("generate", "public-key", "sign", "delete", "attest"),
+persisted across sessions
+*/
+func (h *SoftHSM) Counters() map[string]uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counters := make(map[string]uint64, len(h.state.Counters))
+	for op, n := range h.state.Counters {
+		counters[op] = n
+	}
+	return counters
+}
+
+/*
+Count the operation and wait for the configured latency
+*/
+func (h *SoftHSM) operation(name string) {
+	h.state.Counters[name]++
+
+	delay := h.opts.Latency
+	if h.opts.Jitter > 0 {
+		jitter, err := rand.Int(entropy.Reader, big.NewInt(int64(h.opts.Jitter)))
+		if err == nil {
+			delay += time.Duration(jitter.Int64())
+		}
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+func (h *SoftHSM) loadKey(label string) (*schnorr.SignatureKey, *schnorr.PublicKey, error) {
+	sealed, ok := h.state.Keys[label]
+	if !ok {
+		return nil, nil, ErrKeyNotFound
+	}
+	scalar, err := h.open(label, sealed)
+	if err != nil {
+		return nil, nil, ErrCorrupted
+	}
+	return importScalar(scalar)
+}
+
+/*
+32 byte scalar below the secp256k1 order, as accepted by schnorr.ImportPrivateKey
+*/
+func randomScalar() ([]byte, error) {
+	n, _ := new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	x, err := entropy.Scalar(n)
+	if err != nil {
+		return nil, err
+	}
+	return x.FillBytes(make([]byte, 32)), nil
+}
+
+func importScalar(scalar []byte) (*schnorr.SignatureKey, *schnorr.PublicKey, error) {
+	return schnorr.ImportPrivateKey(hex.EncodeToString(scalar))
+}
+
+/*
+Encrypt with the PIN key, the label is authenticated
+*/
+func (h *SoftHSM) seal(label string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, h.key.NonceSize())
+	if _, err := io.ReadFull(entropy.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return h.key.Seal(nonce, nonce, plaintext, []byte(label)), nil
+}
+
+func (h *SoftHSM) open(label string, sealed []byte) ([]byte, error) {
+	if len(sealed) < h.key.NonceSize() {
+		return nil, ErrCorrupted
+	}
+	nonce, ciphertext := sealed[:h.key.NonceSize()], sealed[h.key.NonceSize():]
+	return h.key.Open(nil, nonce, ciphertext, []byte(label))
+}
+
+/*
+Write the token atomically: temporary file renamed over the original
+*/
+func (h *SoftHSM) save() error {
+	data, err := json.MarshalIndent(h.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+/*
+AES-256-GCM key derived from the PIN with PBKDF2-HMAC-SHA256 (RFC 8018)
+*/
+func pinCipher(pin string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2([]byte(pin), salt, pinIterations))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/*
+Single block of PBKDF2 output, enough for a 256-bit key
+*/
+func pbkdf2(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := mac.Sum(nil)
+
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
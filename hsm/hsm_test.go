@@ -0,0 +1,168 @@
+package hsm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const pin = "1234"
+
+func token(t *testing.T) (*SoftHSM, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token.json")
+	h, err := OpenSoftHSM(path, pin, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, path
+}
+
+var _ KeyBackend = (*SoftHSM)(nil)
+
+func TestKeys(t *testing.T) {
+	h, path := token(t)
+	pk, err := h.GenerateKey("signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.GenerateKey("signing"); err != ErrKeyExists {
+		t.Errorf("second key under the label: %v", err)
+	}
+	if _, err := h.GenerateKey("other"); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := h.Sign("signing", "message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !schnorr.VerifySignature("message", signature, pk) {
+		t.Error("signature doesn't verify")
+	}
+
+	// the keys survive reopening the token
+	reopened, err := OpenSoftHSM(path, pin, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err := reopened.PublicKey("signing")
+	if err != nil || !same.Equal(pk) {
+		t.Fatalf("public key after reopening: %v", err)
+	}
+	if labels, _ := reopened.Labels(); len(labels) != 2 || labels[0] != "other" || labels[1] != "signing" {
+		t.Errorf("labels %v", labels)
+	}
+	if err := reopened.DeleteKey("signing"); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		reopened.DeleteKey("signing"),
+		func() error { _, err := reopened.Sign("signing", "message"); return err }(),
+		func() error { _, err := reopened.PublicKey("signing"); return err }(),
+	} {
+		if err != ErrKeyNotFound {
+			t.Errorf("deleted key: %v", err)
+		}
+	}
+	// failed operations count too
+	if c := reopened.Counters(); c["generate"] != 3 || c["sign"] != 2 || c["delete"] != 2 {
+		t.Errorf("counters %v", c)
+	}
+}
+
+func TestPIN(t *testing.T) {
+	h, path := token(t)
+	if _, err := h.GenerateKey("signing"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < MaxPINAttempts; i++ {
+		if _, err := OpenSoftHSM(path, "0000", Options{}); err != ErrPINIncorrect {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	// the correct PIN resets the attempts
+	if _, err := OpenSoftHSM(path, pin, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < MaxPINAttempts; i++ {
+		if _, err := OpenSoftHSM(path, "0000", Options{}); err != ErrPINIncorrect {
+			t.Fatalf("attempt %d after reset: %v", i, err)
+		}
+	}
+	if _, err := OpenSoftHSM(path, "0000", Options{}); err != ErrPINLocked {
+		t.Errorf("last attempt: %v", err)
+	}
+	if _, err := OpenSoftHSM(path, pin, Options{}); err != ErrPINLocked {
+		t.Errorf("correct PIN on a locked token: %v", err)
+	}
+}
+
+/*
+Edits of the token file are detected instead of yielding other keys
+*/
+func TestTamperedToken(t *testing.T) {
+	h, path := token(t)
+	if _, err := h.GenerateKey("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.GenerateKey("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	edit := func(change func(state *tokenFile)) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var state tokenFile
+		if err := json.Unmarshal(data, &state); err != nil {
+			t.Fatal(err)
+		}
+		change(&state)
+		if data, err = json.Marshal(&state); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the sealed key of label b stored under label a
+	edit(func(state *tokenFile) { state.Keys["a"] = state.Keys["b"] })
+	h, err := OpenSoftHSM(path, pin, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Sign("a", "message"); err != ErrCorrupted {
+		t.Errorf("key moved to another label: %v", err)
+	}
+	edit(func(state *tokenFile) { state.Keys["b"][len(state.Keys["b"])-1] ^= 1 })
+	if h, err = OpenSoftHSM(path, pin, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.PublicKey("b"); err != ErrCorrupted {
+		t.Errorf("changed key: %v", err)
+	}
+	edit(func(state *tokenFile) { state.Keys["b"] = state.Keys["b"][:4] })
+	if h, err = OpenSoftHSM(path, pin, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.PublicKey("b"); err != ErrCorrupted {
+		t.Errorf("truncated key: %v", err)
+	}
+
+	edit(func(state *tokenFile) { state.Check = state.Check[:8] })
+	if _, err := OpenSoftHSM(path, pin, Options{}); err != ErrCorrupted {
+		t.Errorf("truncated PIN check: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSoftHSM(path, pin, Options{}); err != ErrCorrupted {
+		t.Errorf("malformed token file: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package hsm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Key-usage accounting
+
+For high-assurance keys every signature has to be accounted for. SoftHSM
+counts the signatures of every key in the token file, the counter is saved
+before the signature leaves Sign, so a crash can lose a signature but never a
+count. A key with a quota (SetQuota) refuses to sign once the counter reaches
+it. Usage and Usages are the management view of the counters; Options.Audit
+receives a UsageRecord for every signature, e.g. for an auditlog.SignedLog:
+
+	opts.Audit = func(rec *hsm.UsageRecord) error {
+		_, _, err := log.Append(rec.Bytes())
+		return err
+	}
+*/
+
+/*
+Use counter and quota of a key
+*/
+type KeyUsage struct {
+	Label   string    `json:"label"`
+	Uses    uint64    `json:"uses"`            // signatures made with the key
+	Quota   uint64    `json:"quota,omitempty"` // maximum number of signatures, if Limited
+	Limited bool      `json:"limited"`
+	Created time.Time `json:"created"`
+}
+
+/*
+Signatures the key can still make, false if it has no quota
+*/
+func (u *KeyUsage) Remaining() (uint64, bool) {
+	if !u.Limited {
+		return 0, false
+	}
+	if u.Uses >= u.Quota {
+		return 0, true
+	}
+	return u.Quota - u.Uses, true
+}
+
+/*
+One use of a key, passed to Options.Audit
+*/
+type UsageRecord struct {
+	Label   string    `json:"label"`
+	KeyID   string    `json:"key_id"`
+	Use     uint64    `json:"use"` // counter value after this signature, the first signature is 1
+	Quota   uint64    `json:"quota,omitempty"`
+	Limited bool      `json:"limited"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message_sha256"` // hex
+}
+
+/*
+JSON encoding, used as an audit log entry
+*/
+func (r *UsageRecord) Bytes() []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
+
+func (h *SoftHSM) Usage(label string) (*KeyUsage, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.state.Keys[label]; !ok {
+		return nil, ErrKeyNotFound
+	}
+	return h.usage(label), nil
+}
+
+/*
+Usage of all keys, sorted by label
+*/
+func (h *SoftHSM) Usages() []*KeyUsage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	usages := make([]*KeyUsage, 0, len(h.state.Keys))
+	for label := range h.state.Keys {
+		usages = append(usages, h.usage(label))
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Label < usages[j].Label })
+	return usages
+}
+
+/*
+Limit the key to quota signatures in total, counting the ones already made.
+A quota at or below the current counter stops the key from signing.
+*/
+func (h *SoftHSM) SetQuota(label string, quota uint64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.state.Keys[label]; !ok {
+		return ErrKeyNotFound
+	}
+	h.state.Quotas[label] = quota
+	return h.save()
+}
+
+/*
+Remove the quota of the key, the counter keeps counting
+*/
+func (h *SoftHSM) ClearQuota(label string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.state.Keys[label]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(h.state.Quotas, label)
+	return h.save()
+}
+
+func (h *SoftHSM) usage(label string) *KeyUsage {
+	quota, limited := h.state.Quotas[label]
+	return &KeyUsage{
+		Label:   label,
+		Uses:    h.state.Uses[label],
+		Quota:   quota,
+		Limited: limited,
+		Created: h.state.Created[label],
+	}
+}
+
+/*
+Pass the counted use to Options.Audit
+*/
+func (h *SoftHSM) audit(label string, pk *schnorr.PublicKey, message string) error {
+	if h.opts.Audit == nil {
+		return nil
+	}
+	quota, limited := h.state.Quotas[label]
+	digest := sha256.Sum256([]byte(message))
+	return h.opts.Audit(&UsageRecord{
+		Label:   label,
+		KeyID:   pk.KeyID(),
+		Use:     h.state.Uses[label],
+		Quota:   quota,
+		Limited: limited,
+		Time:    schnorr.Now().UTC(),
+		Message: hex.EncodeToString(digest[:]),
+	})
+}
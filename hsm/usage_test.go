@@ -0,0 +1,109 @@
+package hsm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	h, path := token(t)
+	if _, err := h.GenerateKey("signing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Sign("signing", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetQuota("signing", 3); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := h.Sign("signing", "message"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.Sign("signing", "message"); err != ErrQuotaReached {
+		t.Errorf("signature past the quota: %v", err)
+	}
+
+	// counters and quotas are persistent
+	reopened, err := OpenSoftHSM(path, pin, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := reopened.Usage("signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining, limited := u.Remaining(); u.Uses != 3 || !limited || remaining != 0 {
+		t.Errorf("usage %+v", u)
+	}
+	if err := reopened.ClearQuota("signing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Sign("signing", "message"); err != nil {
+		t.Errorf("signature without quota: %v", err)
+	}
+	if u, _ := reopened.Usage("signing"); u.Uses != 4 || u.Limited {
+		t.Errorf("usage after clearing the quota %+v", u)
+	}
+
+	// a regenerated label starts over
+	if err := reopened.DeleteKey("signing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.GenerateKey("signing"); err != nil {
+		t.Fatal(err)
+	}
+	if usages := reopened.Usages(); len(usages) != 1 || usages[0].Uses != 0 || usages[0].Limited {
+		t.Errorf("usages of the new key %+v", usages[0])
+	}
+	for _, err := range []error{reopened.SetQuota("missing", 1), reopened.ClearQuota("missing"), func() error { _, err := reopened.Usage("missing"); return err }()} {
+		if err != ErrKeyNotFound {
+			t.Errorf("missing key: %v", err)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	h, path := token(t)
+	pk, err := h.GenerateKey("signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetQuota("signing", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []*UsageRecord
+	failure := errors.New("audit log unavailable")
+	var fail bool
+	audited, err := OpenSoftHSM(path, pin, Options{Audit: func(rec *UsageRecord) error {
+		if fail {
+			return failure
+		}
+		records = append(records, rec)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := audited.Sign("signing", "message"); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("message"))
+	if len(records) != 1 || records[0].Use != 1 || records[0].KeyID != pk.KeyID() || records[0].Quota != 10 ||
+		records[0].Message != hex.EncodeToString(digest[:]) {
+		t.Fatalf("records %+v", records)
+	}
+
+	// no signature and no count without the audit record
+	fail = true
+	if signature, err := audited.Sign("signing", "message"); err != failure || signature != nil {
+		t.Errorf("signature without audit record: %v", err)
+	}
+	if u, _ := audited.Usage("signing"); u.Uses != 1 {
+		t.Errorf("%d uses counted", u.Uses)
+	}
+}
@@ -0,0 +1,44 @@
+/*
+echo middleware authenticating requests with httpauth.
+
+The package is a module of its own, so httpauth and the rest of the module
+don't depend on echo:
+
+	auth := httpauth.HTTPSignature(httpsig.NewVerifier(keys, "@method", "@path", "content-digest"))
+	e.Use(echoauth.Require(auth))
+
+	e.POST("/orders", func(c echo.Context) error {
+		id, _ := echoauth.Identity(c)
+		...
+	})
+*/
+package echoauth
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/miki799/schnorr-signature/httpauth"
+)
+
+/*
+Middleware rejecting unauthenticated requests with echo.ErrUnauthorized
+*/
+func Require(auth httpauth.Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r, err := httpauth.Verify(auth, c.Request())
+			if err != nil {
+				return echo.ErrUnauthorized
+			}
+			c.SetRequest(r)
+			return next(c)
+		}
+	}
+}
+
+/*
+Identity attached to the request by Require
+*/
+func Identity(c echo.Context) (*httpauth.Identity, bool) {
+	return httpauth.FromContext(c.Request().Context())
+}
@@ -0,0 +1,45 @@
+/*
+gin middleware authenticating requests with httpauth.
+
+The package is a module of its own, so httpauth and the rest of the module
+don't depend on gin:
+
+	auth := httpauth.HTTPSignature(httpsig.NewVerifier(keys, "@method", "@path", "content-digest"))
+	router.Use(ginauth.Require(auth))
+
+	router.POST("/orders", func(c *gin.Context) {
+		id, _ := ginauth.Identity(c)
+		...
+	})
+*/
+package ginauth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/miki799/schnorr-signature/httpauth"
+)
+
+/*
+Middleware aborting unauthenticated requests with 401 Unauthorized
+*/
+func Require(auth httpauth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, err := httpauth.Verify(auth, c.Request)
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Request = r
+		c.Next()
+	}
+}
+
+/*
+Identity attached to the request by Require
+*/
+func Identity(c *gin.Context) (*httpauth.Identity, bool) {
+	return httpauth.FromContext(c.Request.Context())
+}
@@ -0,0 +1,68 @@
+package ginauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/httpauth"
+	"github.com/miki799/schnorr-signature/httpsig"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func TestRequire(t *testing.T) {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := envelope.KeyMap{}
+	keys.Add(pk)
+	auth := httpauth.HTTPSignature(httpsig.NewVerifier(keys, "@method", "@path", "content-digest"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Require(auth))
+	router.POST("/orders", func(c *gin.Context) {
+		id, ok := Identity(c)
+		body, _ := io.ReadAll(c.Request.Body)
+		if !ok || id.KeyID != pk.KeyID() || string(body) != "order" {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	signed := func(body string) *http.Request {
+		r := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		r.Header.Set("Content-Digest", httpsig.ContentDigest([]byte(body)))
+		if err := httpsig.NewSigner(sk, pk, "@method", "@path", "content-digest").SignRequest(r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	for _, test := range []struct {
+		name    string
+		request *http.Request
+		status  int
+	}{
+		{"signed", signed("order"), http.StatusNoContent},
+		{"unsigned", httptest.NewRequest("POST", "/orders", strings.NewReader("order")), http.StatusUnauthorized},
+		{"tampered", func() *http.Request {
+			r := signed("order")
+			r.URL.Path = "/orders/1"
+			return r
+		}(), http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, test.request)
+		if w.Code != test.status {
+			t.Errorf("%s request: status %d", test.name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Authentication of inbound HTTP requests signed with Schnorr keys.
+
+Requests are accepted either with an HTTP message signature (RFC 9421, package
+httpsig) or with the body wrapped in a signed envelope (package envelope). The
+ID of the key which signed the request is attached to the request context:
+
+	auth := httpauth.HTTPSignature(httpsig.NewVerifier(keys, "@method", "@path", "content-digest"))
+	http.Handle("/orders", httpauth.Require(auth)(orders))
+
+	func orders(w http.ResponseWriter, r *http.Request) {
+		id, _ := httpauth.FromContext(r.Context())
+		...
+	}
+
+Require returns a plain net/http middleware, so it can be passed to chi's
+Router.Use directly. Middleware for gin and echo is in the modules
+httpauth/ginauth and httpauth/echoauth, which keep this module free of the
+framework dependencies:
+
+	router.Use(ginauth.Require(auth))
+	e.Use(echoauth.Require(auth))
+
+Verify is the framework independent entry point for wiring other routers.
+*/
+package httpauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/httpsig"
+	"github.com/miki799/schnorr-signature/schnorr"
+	"github.com/miki799/schnorr-signature/session"
+	"github.com/miki799/schnorr-signature/signedurl"
+)
+
+/*
+Default limit of request bodies read by the authenticators
+*/
+const DefaultMaxBody = 1 << 20
+
+var (
+	ErrBodyTooLarge  = errors.New("httpauth: request body is too large")
+	ErrDigest        = errors.New("httpauth: body doesn't match the Content-Digest header")
+	ErrNoEnvelope    = errors.New("httpauth: request has no body")
+	ErrUnknownScheme = errors.New("httpauth: no authenticator accepted the request")
+)
+
+/*
+Authentication schemes
+*/
+const (
+	SchemeHTTPSignature = "httpsig"
+	SchemeEnvelope      = "envelope"
+	SchemeSignedURL     = "signedurl"
+	SchemeSession       = "session"
+)
+
+/*
+Authenticated signer of the request
+*/
+type Identity struct {
+	KeyID   string
+	Scheme  string // SchemeHTTPSignature, SchemeEnvelope, SchemeSignedURL or SchemeSession
+	Subject string // subject of the session token, "" for the other schemes
+}
+
+/*
+Checks the request and returns the identity of its signer. Authenticators may
+replace the request body, e.g. with the payload of the envelope.
+*/
+type Authenticator func(r *http.Request) (*Identity, error)
+
+type contextKey struct{}
+
+/*
+Identity attached to the context by Verify or the middleware
+*/
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok
+}
+
+/*
+Context carrying the identity, for handlers tested without the middleware
+*/
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+/*
+Authenticate the request, returns shallow copy of it with the identity in the context
+*/
+func Verify(auth Authenticator, r *http.Request) (*http.Request, error) {
+	id, err := auth(r)
+	if err != nil {
+		return nil, err
+	}
+	return r.WithContext(NewContext(r.Context(), id)), nil
+}
+
+/*
+net/http middleware rejecting unauthenticated requests
+*/
+type Middleware struct {
+	Authenticator Authenticator
+	OnError       func(w http.ResponseWriter, r *http.Request, err error) // 401 Unauthorized if nil
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated, err := Verify(m.Authenticator, r)
+		if err != nil {
+			if m.OnError != nil {
+				m.OnError(w, r, err)
+			} else {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			}
+			return
+		}
+		next.ServeHTTP(w, authenticated)
+	})
+}
+
+/*
+Middleware with the default error handling, in the func(http.Handler) http.Handler
+form accepted by chi and most net/http routers
+*/
+func Require(auth Authenticator) func(http.Handler) http.Handler {
+	return (&Middleware{Authenticator: auth}).Handler
+}
+
+/*
+Requests signed according to RFC 9421. When the request carries a Content-Digest
+header, the body (up to DefaultMaxBody bytes) is checked against it, so cover
+"content-digest" in the verifier's required components to protect the body.
+*/
+func HTTPSignature(v *httpsig.Verifier) Authenticator {
+	return func(r *http.Request) (*Identity, error) {
+		keyID, err := v.VerifyRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		if digest := r.Header.Get("Content-Digest"); digest != "" {
+			body, err := readBody(r, DefaultMaxBody)
+			if err != nil {
+				return nil, err
+			}
+			if httpsig.ContentDigest(body) != digest {
+				return nil, ErrDigest
+			}
+			setBody(r, body)
+		}
+		return &Identity{KeyID: keyID, Scheme: SchemeHTTPSignature}, nil
+	}
+}
+
+/*
+Requests with the body sealed in an envelope bound to the method and request
+URI (see EnvelopeAAD). The body seen by the handler is the envelope payload.
+*/
+func Envelope(keys envelope.KeyResolver) Authenticator {
+	return func(r *http.Request) (*Identity, error) {
+		body, err := readBody(r, DefaultMaxBody)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) == 0 {
+			return nil, ErrNoEnvelope
+		}
+		e, err := envelope.Open(body, EnvelopeAAD(r.Method, r.URL.RequestURI()), keys)
+		if err != nil {
+			return nil, err
+		}
+		setBody(r, e.Payload)
+		return &Identity{KeyID: e.KeyID, Scheme: SchemeEnvelope}, nil
+	}
+}
+
+/*
+Requests to a signed capability URL (package signedurl), bound to the method,
+host and, if the link says so, the client IP of the request
+*/
+func SignedURL(v *signedurl.Verifier) Authenticator {
+	return func(r *http.Request) (*Identity, error) {
+		capability, err := v.VerifyRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		return &Identity{KeyID: capability.KeyID, Scheme: SchemeSignedURL}, nil
+	}
+}
+
+/*
+Requests with a session token (package session) as bearer token of the
+Authorization header. KeyID is the ID of the epoch key which signed the token.
+*/
+func Session(v *session.Verifier) Authenticator {
+	return func(r *http.Request) (*Identity, error) {
+		claims, err := v.VerifyRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		return &Identity{KeyID: v.KeyID(claims.Epoch), Scheme: SchemeSession, Subject: claims.Subject}, nil
+	}
+}
+
+/*
+First of the authenticators accepting the request. Authenticators are tried in
+order while they fail with ErrNoSignature (of httpsig or signedurl),
+session.ErrNoToken or ErrNoEnvelope, any other error rejects the request.
+*/
+func Any(auths ...Authenticator) Authenticator {
+	return func(r *http.Request) (*Identity, error) {
+		for _, auth := range auths {
+			id, err := auth(r)
+			if errors.Is(err, httpsig.ErrNoSignature) || errors.Is(err, signedurl.ErrNoSignature) ||
+				errors.Is(err, session.ErrNoToken) || errors.Is(err, ErrNoEnvelope) {
+				continue
+			}
+			return id, err
+		}
+		return nil, ErrUnknownScheme
+	}
+}
+
+/*
+Additional data of request envelopes: method || " " || request URI
+*/
+func EnvelopeAAD(method, requestURI string) []byte {
+	return []byte(method + " " + requestURI)
+}
+
+/*
+Client side of Envelope: request with the payload sealed for the method and URL
+*/
+func NewEnvelopeRequest(method, url string, payload []byte, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) (*http.Request, error) {
+	r, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := envelope.Seal(payload, EnvelopeAAD(method, r.URL.RequestURI()), sk, pk)
+	if err != nil {
+		return nil, err
+	}
+	body, err := sealed.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	setBody(r, body)
+	r.Header.Set("Content-Type", "application/octet-stream")
+	return r, nil
+}
+
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+func setBody(r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	if r.Header != nil && r.Header.Get("Content-Length") != "" {
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+}
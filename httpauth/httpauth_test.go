@@ -0,0 +1,120 @@
+package httpauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/httpsig"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey, envelope.KeyMap) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := envelope.KeyMap{}
+	resolver.Add(pk)
+	return sk, pk, resolver
+}
+
+/*
+Handler answering with the scheme and the body it received
+*/
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	id, ok := FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	io.WriteString(w, id.Scheme+" "+id.KeyID+" "+string(body))
+})
+
+func serve(auth Authenticator, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	Require(auth)(echoHandler).ServeHTTP(w, r)
+	return w
+}
+
+func TestHTTPSignature(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	auth := HTTPSignature(httpsig.NewVerifier(resolver, "@method", "@path", "content-digest"))
+	signer := httpsig.NewSigner(sk, pk, "@method", "@path", "content-digest")
+	signed := func(body string) *http.Request {
+		r := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		r.Header.Set("Content-Digest", httpsig.ContentDigest([]byte(body)))
+		if err := signer.SignRequest(r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	w := serve(auth, signed("order"))
+	if w.Code != http.StatusOK || w.Body.String() != SchemeHTTPSignature+" "+pk.KeyID()+" order" {
+		t.Fatalf("signed request: %d %q", w.Code, w.Body)
+	}
+
+	r := signed("order")
+	r.Body = io.NopCloser(strings.NewReader("other"))
+	if w := serve(auth, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("changed body: %d", w.Code)
+	}
+	if w := serve(auth, httptest.NewRequest("POST", "/orders", nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned request: %d", w.Code)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	auth := Envelope(resolver)
+
+	r, err := NewEnvelopeRequest("POST", "http://example.com/orders?id=1", []byte("order"), sk, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(auth, r)
+	if w.Code != http.StatusOK || w.Body.String() != SchemeEnvelope+" "+pk.KeyID()+" order" {
+		t.Fatalf("sealed request: %d %q", w.Code, w.Body)
+	}
+
+	// the envelope is bound to the method and the request URI
+	r, err = NewEnvelopeRequest("POST", "http://example.com/orders?id=1", []byte("order"), sk, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.URL.RawQuery = "id=2"
+	if w := serve(auth, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("envelope for another URI: %d", w.Code)
+	}
+}
+
+func TestAny(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	auth := Any(HTTPSignature(httpsig.NewVerifier(resolver, "@method")), Envelope(resolver))
+
+	r, err := NewEnvelopeRequest("PUT", "http://example.com/", []byte("data"), sk, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(auth, r); w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), SchemeEnvelope) {
+		t.Errorf("envelope after a missing signature: %d %q", w.Code, w.Body)
+	}
+
+	if _, err := Verify(auth, httptest.NewRequest("GET", "/", nil)); err != ErrUnknownScheme {
+		t.Errorf("request without credentials: %v", err)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	_, _, resolver := keys(t)
+	r := httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", DefaultMaxBody+1)))
+	if _, err := Verify(Envelope(resolver), r); err != ErrBodyTooLarge {
+		t.Errorf("large body: %v", err)
+	}
+}
@@ -0,0 +1,592 @@
+/*
+HTTP Message Signatures (RFC 9421) with Schnorr keys.
+
+Only the subset of the structured field syntax produced by the package is parsed:
+inner list of quoted component names separated by single spaces, followed by
+the created, keyid and alg parameters, each exactly once. Anything else,
+including text between the inner list and the first parameter, is rejected.
+Component names are lowercase (RFC 9421 section 2.1): derived components of
+the list below and header field names, which are compared in lowercase.
+*/
+package httpsig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/region"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Value of the alg signature parameter
+*/
+const Algorithm = "schnorr-sha256"
+
+var (
+	ErrNoSignature        = errors.New("httpsig: no signature with the given label")
+	ErrMalformed          = errors.New("httpsig: malformed signature header")
+	ErrUnknownComponent   = errors.New("httpsig: unknown component")
+	ErrMissingComponent   = errors.New("httpsig: required component is not signed")
+	ErrAlgorithm          = errors.New("httpsig: unsupported algorithm")
+	ErrExpired            = errors.New("httpsig: signature is too old")
+	ErrInvalidSignature   = errors.New("httpsig: invalid signature")
+	ErrResponseNotAllowed = errors.New("httpsig: component can't be used with responses")
+	ErrDuplicateComponent = errors.New("httpsig: component is covered twice")
+	ErrComponentName      = errors.New("httpsig: component name isn't a lowercase field name or derived component")
+	ErrFuture             = errors.New("httpsig: signature is created in the future")
+	ErrDigest             = errors.New("httpsig: body doesn't match the Content-Digest header")
+	ErrBodyTooLarge       = errors.New("httpsig: body is too large for the Content-Digest check")
+)
+
+/*
+Limit of bodies read for the Content-Digest check
+*/
+const DefaultMaxBody = 1 << 20
+
+/*
+Tolerated clock difference for signatures created in the future, unless the
+MaxSkew of schnorr.SetFreshnessPolicy is larger
+*/
+const maxClockSkew = time.Minute
+
+/*
+Signs requests and responses, adding Signature-Input and Signature headers
+*/
+type Signer struct {
+	Label      string   // dictionary key of the signature, "sig1" if empty
+	Components []string // covered components, e.g. "@method", "@path", "content-digest"
+
+	keyID string
+	sk    *schnorr.SignatureKey
+	now   func() time.Time
+}
+
+func NewSigner(sk *schnorr.SignatureKey, pk *schnorr.PublicKey, components ...string) *Signer {
+	return &Signer{Components: components, keyID: pk.KeyID(), sk: sk, now: schnorr.Now}
+}
+
+func (s *Signer) SignRequest(r *http.Request) error {
+	return s.sign(request{r}, r.Header)
+}
+
+func (s *Signer) SignResponse(resp *http.Response) error {
+	return s.sign(response{resp}, resp.Header)
+}
+
+func (s *Signer) sign(msg message, header http.Header) error {
+	label := s.Label
+	if label == "" {
+		label = "sig1"
+	}
+	if err := checkComponents(s.Components); err != nil {
+		return err
+	}
+
+	params := &signatureParams{
+		components: s.Components,
+		created:    s.now().Unix(),
+		keyID:      s.keyID,
+		alg:        Algorithm,
+	}
+
+	base, err := appendSignatureBase(nil, msg, params.components, params.String())
+	if err != nil {
+		return err
+	}
+
+	signature, err := schnorr.TrySign(string(base), s.sk)
+	if err != nil {
+		return err
+	}
+	header.Add("Signature-Input", label+"="+params.String())
+	header.Add("Signature", label+"=:"+base64.StdEncoding.EncodeToString(signature.Bytes())+":")
+
+	return nil
+}
+
+/*
+Verifies signatures of inbound requests and responses
+*/
+type Verifier struct {
+	Label    string        // label of the checked signature, "sig1" if empty
+	Required []string      // components which have to be covered by the signature, compared in lowercase
+	MaxAge   time.Duration // maximum age of the signature plus the skew of schnorr.SetFreshnessPolicy, 0 means no limit
+	MaxBody  int64         // limit of the body read for covered "content-digest", DefaultMaxBody if 0
+	Regions  bool          // take temporary values of every request from a region.Region
+
+	keys envelope.KeyResolver
+	now  func() time.Time
+}
+
+func NewVerifier(keys envelope.KeyResolver, required ...string) *Verifier {
+	return &Verifier{Required: required, keys: keys, now: schnorr.Now}
+}
+
+/*
+Returns ID of the key which signed the request. When "content-digest" is
+covered, the body is read (up to MaxBody bytes) and checked against the
+header, the handler reads it again from r.Body.
+*/
+func (v *Verifier) VerifyRequest(r *http.Request) (string, error) {
+	return v.verify(request{r}, r.Header)
+}
+
+/*
+Returns ID of the key which signed the response
+*/
+func (v *Verifier) VerifyResponse(resp *http.Response) (string, error) {
+	return v.verify(response{resp}, resp.Header)
+}
+
+func (v *Verifier) verify(msg message, header http.Header) (string, error) {
+	label := v.Label
+	if label == "" {
+		label = "sig1"
+	}
+
+	rawParams, ok := dictionaryMember(header.Values("Signature-Input"), label)
+	if !ok {
+		return "", ErrNoSignature
+	}
+	rawSignature, ok := dictionaryMember(header.Values("Signature"), label)
+	if !ok {
+		return "", ErrNoSignature
+	}
+
+	params, err := parseSignatureParams(rawParams)
+	if err != nil {
+		return "", err
+	}
+	if params.alg != Algorithm {
+		return "", ErrAlgorithm
+	}
+	for _, required := range v.Required {
+		if !contains(params.components, strings.ToLower(required)) {
+			return "", fmt.Errorf("%w: %s", ErrMissingComponent, required)
+		}
+	}
+	skew := schnorr.CurrentFreshnessPolicy().MaxSkew
+	created, now := time.Unix(params.created, 0), v.now()
+	if v.MaxAge > 0 && now.Sub(created) > v.MaxAge+skew {
+		return "", ErrExpired
+	}
+	if skew < maxClockSkew {
+		skew = maxClockSkew
+	}
+	if created.After(now.Add(skew)) {
+		return "", ErrFuture
+	}
+
+	if len(rawSignature) < 2 || rawSignature[0] != ':' || rawSignature[len(rawSignature)-1] != ':' {
+		return "", ErrMalformed
+	}
+	encoded := rawSignature[1 : len(rawSignature)-1]
+
+	var rg *region.Region
+	var signature *schnorr.Signature
+	var base []byte
+	if v.Regions {
+		rg = region.Get()
+		defer rg.Release()
+
+		b := rg.Bytes(base64.StdEncoding.DecodedLen(len(encoded)))
+		n, err := base64.StdEncoding.Decode(b, []byte(encoded))
+		if err != nil {
+			return "", ErrMalformed
+		}
+		if signature, err = rg.ParseSignature(b[:n]); err != nil {
+			return "", ErrMalformed
+		}
+		base = rg.Buffer(len(rawParams) + 64*len(params.components))
+	} else {
+		b, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", ErrMalformed
+		}
+		if signature, err = schnorr.ParseSignature(b); err != nil {
+			return "", ErrMalformed
+		}
+	}
+
+	pk, err := v.keys.PublicKey(params.keyID)
+	if err != nil {
+		return "", err
+	}
+
+	// parameters are covered exactly as they were sent
+	base, err = appendSignatureBase(base, msg, params.components, rawParams)
+	if err != nil {
+		return "", err
+	}
+	signed := string(base)
+	if rg != nil {
+		// the signature base is only read during verification, so it can stay in the region
+		signed = rg.String(base)
+	}
+	if !schnorr.VerifySignature(signed, signature, pk) {
+		return "", ErrInvalidSignature
+	}
+
+	// the covered header is only worth something if the body matches it
+	if contains(params.components, "content-digest") {
+		if err := v.checkDigest(msg); err != nil {
+			return "", err
+		}
+	}
+	return params.keyID, nil
+}
+
+/*
+Compare the sha-256 member of the Content-Digest header with the body, which
+is put back for the next reader
+*/
+func (v *Verifier) checkDigest(msg message) error {
+	want, ok := dictionaryMember(msg.header().Values("Content-Digest"), "sha-256")
+	if !ok {
+		return ErrDigest
+	}
+	limit := v.MaxBody
+	if limit <= 0 {
+		limit = DefaultMaxBody
+	}
+
+	body := msg.body()
+	var b []byte
+	if *body != nil && *body != http.NoBody {
+		var err error
+		b, err = io.ReadAll(io.LimitReader(*body, limit+1))
+		(*body).Close()
+		if err != nil {
+			return err
+		}
+		if int64(len(b)) > limit {
+			return ErrBodyTooLarge
+		}
+		*body = io.NopCloser(bytes.NewReader(b))
+	}
+	sum := sha256.Sum256(b)
+	if strings.TrimSpace(want) != ":"+base64.StdEncoding.EncodeToString(sum[:])+":" {
+		return ErrDigest
+	}
+	return nil
+}
+
+/*
+Value of the Content-Digest header (RFC 9530) for the given body.
+Add "content-digest" to the covered components to protect the message body.
+*/
+func ContentDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+type signatureParams struct {
+	components []string
+	created    int64
+	keyID      string
+	alg        string
+}
+
+/*
+Serialized as inner list with parameters, e.g.
+
+	("@method" "@path");created=1618884473;keyid="test-key";alg="schnorr-sha256"
+*/
+func (p *signatureParams) String() string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, c := range p.components {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.Quote(c))
+	}
+	b.WriteByte(')')
+	fmt.Fprintf(&b, ";created=%d;keyid=%s;alg=%s", p.created, strconv.Quote(p.keyID), strconv.Quote(p.alg))
+	return b.String()
+}
+
+func parseSignatureParams(s string) (*signatureParams, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, ErrMalformed
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, ErrMalformed
+	}
+
+	p := &signatureParams{}
+	if end > 1 {
+		for _, item := range strings.Split(s[1:end], " ") {
+			c, err := unquote(item)
+			if err != nil {
+				return nil, ErrMalformed
+			}
+			p.components = append(p.components, c)
+		}
+	}
+	if err := checkComponents(p.components); err != nil {
+		return nil, err
+	}
+
+	// ;created=...;keyid="...";alg="..." in any order, nothing before the first ';'
+	rest := s[end+1:]
+	if !strings.HasPrefix(rest, ";") {
+		return nil, ErrMalformed
+	}
+	seen := make(map[string]bool, 3)
+	for _, param := range strings.Split(rest[1:], ";") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok || seen[key] {
+			return nil, ErrMalformed
+		}
+		seen[key] = true
+		var err error
+		switch key {
+		case "created":
+			p.created, err = strconv.ParseInt(value, 10, 64)
+		case "keyid":
+			p.keyID, err = unquote(value)
+		case "alg":
+			p.alg, err = unquote(value)
+		default:
+			return nil, ErrMalformed
+		}
+		if err != nil {
+			return nil, ErrMalformed
+		}
+	}
+	if len(seen) != 3 {
+		return nil, ErrMalformed
+	}
+
+	return p, nil
+}
+
+/*
+Structured field string, double quoted
+*/
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", ErrMalformed
+	}
+	return strconv.Unquote(s)
+}
+
+/*
+Signature base as defined in RFC 9421 section 2.5
+*/
+func appendSignatureBase(b []byte, msg message, components []string, params string) ([]byte, error) {
+	for _, c := range components {
+		value, err := componentValue(msg, c)
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(strconv.AppendQuote(b, c), ": "...), value...)
+		b = append(b, '\n')
+	}
+	b = append(strconv.AppendQuote(b, "@signature-params"), ": "...)
+	return append(b, params...), nil
+}
+
+/*
+Components of a signature must be unique (RFC 9421 section 2.5) and named in
+lowercase: a derived component or a header field name (token characters)
+*/
+func checkComponents(components []string) error {
+	seen := make(map[string]bool, len(components))
+	for _, c := range components {
+		if !validComponent(c) {
+			return fmt.Errorf("%w: %q", ErrComponentName, c)
+		}
+		if seen[c] {
+			return fmt.Errorf("%w: %s", ErrDuplicateComponent, c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+var derivedComponents = []string{"@method", "@scheme", "@authority", "@target-uri", "@request-target", "@path", "@query", "@status"}
+
+func validComponent(c string) bool {
+	if strings.HasPrefix(c, "@") {
+		return contains(derivedComponents, c)
+	}
+	if c == "" {
+		return false
+	}
+	for i := 0; i < len(c); i++ {
+		b := c[i]
+		switch {
+		case 'a' <= b && b <= 'z', '0' <= b && b <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", b) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+/*
+HTTP message independent of its direction
+*/
+type message interface {
+	derived(name string) (string, error)
+	header() http.Header
+	body() *io.ReadCloser
+}
+
+func componentValue(msg message, name string) (string, error) {
+	if strings.HasPrefix(name, "@") {
+		return msg.derived(name)
+	}
+
+	values := msg.header().Values(name)
+	if len(values) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrUnknownComponent, name)
+	}
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+type request struct {
+	r *http.Request
+}
+
+func (r request) header() http.Header {
+	return r.r.Header
+}
+
+func (r request) body() *io.ReadCloser {
+	return &r.r.Body
+}
+
+func (r request) derived(name string) (string, error) {
+	u := r.r.URL
+	switch name {
+	case "@method":
+		return r.r.Method, nil
+	case "@scheme":
+		return r.scheme(), nil
+	case "@authority":
+		return strings.ToLower(r.authority()), nil
+	case "@target-uri":
+		target := r.scheme() + "://" + strings.ToLower(r.authority()) + r.path()
+		if u.RawQuery != "" {
+			target += "?" + u.RawQuery
+		}
+		return target, nil
+	case "@request-target":
+		return u.RequestURI(), nil
+	case "@path":
+		return r.path(), nil
+	case "@query":
+		return "?" + u.RawQuery, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownComponent, name)
+}
+
+func (r request) scheme() string {
+	if r.r.URL.Scheme != "" {
+		return r.r.URL.Scheme
+	}
+	if r.r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func (r request) authority() string {
+	if r.r.Host != "" {
+		return r.r.Host
+	}
+	return r.r.URL.Host
+}
+
+func (r request) path() string {
+	if p := r.r.URL.EscapedPath(); p != "" {
+		return p
+	}
+	return "/"
+}
+
+type response struct {
+	r *http.Response
+}
+
+func (r response) header() http.Header {
+	return r.r.Header
+}
+
+func (r response) body() *io.ReadCloser {
+	return &r.r.Body
+}
+
+func (r response) derived(name string) (string, error) {
+	if name == "@status" {
+		return strconv.Itoa(r.r.StatusCode), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrResponseNotAllowed, name)
+}
+
+/*
+Find member of the structured dictionary header, e.g. sig1 in "sig1=:abc:, sig2=:def:"
+*/
+func dictionaryMember(values []string, label string) (string, bool) {
+	for _, value := range values {
+		for _, member := range splitMembers(value) {
+			key, v, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if ok && key == label {
+				return v, true
+			}
+		}
+	}
+	return "", false
+}
+
+/*
+Split dictionary on commas which are not inside quoted strings
+*/
+func splitMembers(s string) []string {
+	var members []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				members = append(members, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(members, s[start:])
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package httpsig
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey, envelope.KeyMap) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := envelope.KeyMap{}
+	resolver.Add(pk)
+	return sk, pk, resolver
+}
+
+func signedRequest(t *testing.T, signer *Signer, body string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest("POST", "https://example.com/orders?id=7", strings.NewReader(body))
+	r.Header.Set("Content-Digest", ContentDigest([]byte(body)))
+	if err := signer.SignRequest(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	signer := NewSigner(sk, pk, "@method", "@target-uri", "content-digest")
+	verifier := NewVerifier(resolver, "@method", "content-digest")
+	verifier.MaxAge = time.Minute
+
+	r := signedRequest(t, signer, "order")
+	keyID, err := verifier.VerifyRequest(r)
+	if err != nil || keyID != pk.KeyID() {
+		t.Fatalf("request: %q, %v", keyID, err)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != "order" {
+		t.Errorf("body after verification: %q", body)
+	}
+
+	resp := &http.Response{StatusCode: 201, Header: http.Header{}, Body: http.NoBody}
+	responder := NewSigner(sk, pk, "@status")
+	if err := responder.SignResponse(resp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(resolver, "@status").VerifyResponse(resp); err != nil {
+		t.Fatalf("response: %v", err)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	signer := NewSigner(sk, pk, "@method", "@path", "content-digest")
+	verifier := NewVerifier(resolver)
+
+	r := signedRequest(t, signer, "order")
+	r.Method = "PUT"
+	if _, err := verifier.VerifyRequest(r); err != ErrInvalidSignature {
+		t.Errorf("changed method: %v", err)
+	}
+
+	r = signedRequest(t, signer, "order")
+	r.Body = io.NopCloser(strings.NewReader("other order"))
+	if _, err := verifier.VerifyRequest(r); err != ErrDigest {
+		t.Errorf("changed body: %v", err)
+	}
+
+	r = signedRequest(t, signer, "order")
+	signature := r.Header.Get("Signature")
+	flipped := []byte(signature)
+	flipped[len(flipped)-3] ^= 1
+	r.Header.Set("Signature", string(flipped))
+	if _, err := verifier.VerifyRequest(r); err == nil {
+		t.Error("changed signature accepted")
+	}
+}
+
+/*
+Component names are lowercase, "Content-Digest" can't stand in for the
+covered digest and bypass the body check or the required components
+*/
+func TestComponentCase(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	if err := NewSigner(sk, pk, "@method", "Content-Digest").SignRequest(httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrComponentName) {
+		t.Fatalf("uppercase component signed: %v", err)
+	}
+
+	// signature input crafted with the uppercase name, signed over the right base
+	r := httptest.NewRequest("POST", "https://example.com/", strings.NewReader("forged"))
+	r.Header.Set("Content-Digest", ContentDigest([]byte("order")))
+	params := `("@method" "Content-Digest");created=` + strconv.FormatInt(schnorr.Now().Unix(), 10) + `;keyid="` + pk.KeyID() + `";alg="` + Algorithm + `"`
+	base := `"@method": POST` + "\n" + `"Content-Digest": ` + ContentDigest([]byte("order")) + "\n" + `"@signature-params": ` + params
+	signature, err := schnorr.TrySign(base, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Signature-Input", "sig1="+params)
+	r.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(signature.Bytes())+":")
+
+	for _, v := range []*Verifier{NewVerifier(resolver), NewVerifier(resolver, "content-digest"), NewVerifier(resolver, "Content-Digest")} {
+		if _, err := v.VerifyRequest(r); !errors.Is(err, ErrComponentName) {
+			t.Errorf("required %v: %v", v.Required, err)
+		}
+	}
+}
+
+func TestParseSignatureParams(t *testing.T) {
+	valid := `("@method" "content-digest");created=1700000000;keyid="k";alg="schnorr-sha256"`
+	p, err := parseSignatureParams(valid)
+	if err != nil || p.String() != valid {
+		t.Fatalf("%v: %v", p, err)
+	}
+
+	for _, s := range []string{
+		``,
+		`"@method";created=1;keyid="k";alg="a"`,
+		`("@method";created=1;keyid="k";alg="a"`,
+		`("@method")junk;created=1;keyid="k";alg="a"`,
+		`("@method") ;created=1;keyid="k";alg="a"`,
+		`("@method")created=1;keyid="k";alg="a"`,
+		`("@method"  "@path");created=1;keyid="k";alg="a"`,
+		"(`@method`);created=1;keyid=\"k\";alg=\"a\"",
+		`(@method);created=1;keyid="k";alg="a"`,
+		`("@method");created=1;keyid="k"`,
+		`("@method");created=1;keyid="k";alg="a";alg="b"`,
+		`("@method");created=1;keyid="k";alg="a";expires=2`,
+		`("@method");created=x;keyid="k";alg="a"`,
+		`("@method");created=1;keyid=k;alg="a"`,
+		`("@method");created=1;keyid="k";alg="a";`,
+	} {
+		if _, err := parseSignatureParams(s); err != ErrMalformed {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+
+	for _, s := range []string{
+		`("@Method");created=1;keyid="k";alg="a"`,
+		`("@unknown");created=1;keyid="k";alg="a"`,
+		`("content/digest");created=1;keyid="k";alg="a"`,
+		`("");created=1;keyid="k";alg="a"`,
+	} {
+		if _, err := parseSignatureParams(s); !errors.Is(err, ErrComponentName) {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	if _, err := parseSignatureParams(`("@path" "@path");created=1;keyid="k";alg="a"`); !errors.Is(err, ErrDuplicateComponent) {
+		t.Errorf("duplicate component: %v", err)
+	}
+}
+
+func TestMalformedHeaders(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	verifier := NewVerifier(resolver)
+
+	r := signedRequest(t, NewSigner(sk, pk, "@method"), "")
+	input := r.Header.Get("Signature-Input")
+	for name, value := range map[string]string{
+		"Signature":       "sig1=abc",
+		"Signature-Input": strings.Replace(input, ")", ") x", 1),
+	} {
+		r := signedRequest(t, NewSigner(sk, pk, "@method"), "")
+		r.Header.Set(name, value)
+		if _, err := verifier.VerifyRequest(r); err != ErrMalformed {
+			t.Errorf("%s %q: %v", name, value, err)
+		}
+	}
+
+	r.Header.Del("Signature")
+	if _, err := verifier.VerifyRequest(r); err != ErrNoSignature {
+		t.Errorf("no signature: %v", err)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	signer := NewSigner(sk, pk, "@method")
+	verifier := NewVerifier(resolver)
+	verifier.MaxAge = time.Minute
+
+	start := time.Now()
+	signer.now = func() time.Time { return start }
+	verifier.now = func() time.Time { return start.Add(time.Hour) }
+	if _, err := verifier.VerifyRequest(signedRequest(t, signer, "")); err != ErrExpired {
+		t.Errorf("old signature: %v", err)
+	}
+	verifier.now = func() time.Time { return start.Add(-time.Hour) }
+	if _, err := verifier.VerifyRequest(signedRequest(t, signer, "")); err != ErrFuture {
+		t.Errorf("signature from the future: %v", err)
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	verifier := NewVerifier(resolver)
+	verifier.MaxBody = 4
+	r := signedRequest(t, NewSigner(sk, pk, "@method", "content-digest"), "too large")
+	if _, err := verifier.VerifyRequest(r); err != ErrBodyTooLarge {
+		t.Errorf("large body: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+/*
+End-to-end tests of the protocol packages over real sockets.
+
+The package has no code of its own. Its tests start every role as an
+httptest server on the loopback interface: a signing service behind httpauth,
+a blind token issuer with a redeeming verifier, and threshold participants
+driven by a coordinator. The clients talk to them through a transport which
+consults a faults.Injector for every request, so rules of the injector become
+network conditions:
+
+	faults.Rule{Protocol: faults.Threshold, Participant: 2, Fault: faults.Drop}             // participant 2 is partitioned
+	faults.Rule{Protocol: faults.Threshold, Fault: faults.Delay, Delay: 20 * time.Millisecond} // latency on every link
+
+A delay longer than the client timeout behaves as a partition. The suite runs
+with go test ./integration, -race included, and is what release candidates
+are validated with.
+*/
+package integration
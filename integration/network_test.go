@@ -0,0 +1,168 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/faults"
+)
+
+/*
+Timeout of every client request, longer delays act as partitions
+*/
+const requestTimeout = 500 * time.Millisecond
+
+/*
+Simulated network: servers registered under a protocol and participant, the
+injector decides the fate of every request sent to them. The round of the
+fault point is the last element of the request path.
+*/
+type network struct {
+	in *faults.Injector
+
+	mu        sync.Mutex
+	nodes     map[string]node // by host:port
+	transport *http.Transport
+}
+
+type node struct {
+	protocol    string
+	participant int
+}
+
+func newNetwork(t *testing.T) *network {
+	n := &network{in: faults.New(), nodes: make(map[string]node), transport: &http.Transport{}}
+	t.Cleanup(n.transport.CloseIdleConnections)
+	return n
+}
+
+/*
+Start the handler as a server of the protocol
+*/
+func (n *network) serve(t *testing.T, protocol string, participant int, handler http.Handler) *httptest.Server {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nodes[server.Listener.Addr().String()] = node{protocol, participant}
+	return server
+}
+
+func (n *network) client() *http.Client {
+	return &http.Client{Transport: n, Timeout: requestTimeout}
+}
+
+func (n *network) RoundTrip(r *http.Request) (*http.Response, error) {
+	n.mu.Lock()
+	nd, ok := n.nodes[r.URL.Host]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no server at %s", r.URL.Host)
+	}
+
+	fault, delay := n.in.Decide(nd.protocol, path.Base(r.URL.Path), nd.participant)
+	switch fault {
+	case faults.Drop:
+		return nil, faults.ErrDropped
+	case faults.Delay:
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+	return n.transport.RoundTrip(r)
+}
+
+/*
+POST in as JSON, decode the JSON answer into out
+*/
+func postJSON(ctx context.Context, client *http.Client, url string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	return do(client, r, out)
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return do(client, r, out)
+}
+
+/*
+Send the request, non-2xx answers become *statusError
+*/
+func do(client *http.Client, r *http.Request, out interface{}) error {
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return &statusError{resp.StatusCode, string(bytes.TrimSpace(body))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.code, e.message)
+}
+
+/*
+Answer with the JSON of v, or with the error as 400 Bad Request
+*/
+func writeJSON(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+/*
+Decode the JSON body of a POST request, false after answering the error
+*/
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
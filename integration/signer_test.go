@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/faults"
+	"github.com/miki799/schnorr-signature/httpauth"
+	"github.com/miki799/schnorr-signature/httpsig"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Protocol of the signing daemon's fault points, round sign
+*/
+const protocolSigner = "signer"
+
+/*
+Signing daemon: POST /sign signs the body with the service key, for clients
+authenticated with an HTTP message signature over the body
+*/
+func signerHandler(service *schnorr.SigningService, clients envelope.KeyMap) http.Handler {
+	auth := httpauth.HTTPSignature(httpsig.NewVerifier(clients, "@method", "@path", "content-digest"))
+	return httpauth.Require(auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		signature, err := service.Sign(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, hex.EncodeToString(signature.Bytes()), nil)
+	}))
+}
+
+/*
+Signed request of the client to the signing daemon
+*/
+func signRequestTo(ctx context.Context, url string, body []byte, signer *httpsig.Signer) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/sign", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Digest", httpsig.ContentDigest(body))
+	if signer != nil {
+		if err := signer.SignRequest(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func TestSigningServiceOverNetwork(t *testing.T) {
+	serviceKey, servicePK, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := schnorr.NewSigningService(serviceKey, schnorr.SigningServiceOptions{PoolSize: 8, Workers: 1})
+	defer service.Close()
+	clientKey, clientPK, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := envelope.KeyMap{}
+	clients.Add(clientPK)
+
+	net := newNetwork(t)
+	client := net.client()
+	url := net.serve(t, protocolSigner, 0, signerHandler(service, clients)).URL
+	signer := httpsig.NewSigner(clientKey, clientPK, "@method", "@path", "content-digest")
+	ctx := context.Background()
+
+	net.in.Add(faults.Rule{Protocol: protocolSigner, Fault: faults.Delay, Delay: 5 * time.Millisecond})
+	body := []byte("artifact sha256:4f1c")
+	r, err := signRequestTo(ctx, url, body, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded string
+	if err := do(client, r, &encoded); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := schnorr.ParseSignatureHex(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !schnorr.VerifySignature(string(body), signature, servicePK) {
+		t.Fatal("signature of the daemon doesn't verify")
+	}
+
+	// unsigned and tampered requests are refused
+	var status *statusError
+	if r, err = signRequestTo(ctx, url, body, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := do(client, r, nil); !errors.As(err, &status) || status.code != http.StatusUnauthorized {
+		t.Errorf("unsigned request: %v", err)
+	}
+	if r, err = signRequestTo(ctx, url, body, signer); err != nil {
+		t.Fatal(err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader([]byte("artifact sha256:0000")))
+	r.ContentLength = int64(len("artifact sha256:0000"))
+	if err := do(client, r, nil); !errors.As(err, &status) || status.code != http.StatusUnauthorized {
+		t.Errorf("request with a replaced body: %v", err)
+	}
+
+	// a daemon slower than the client's timeout looks unreachable
+	net.in.Reset()
+	net.in.Add(faults.Rule{Protocol: protocolSigner, Fault: faults.Delay, Delay: 2 * requestTimeout, Times: 1})
+	if r, err = signRequestTo(ctx, url, body, signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := do(client, r, nil); err == nil {
+		t.Error("request outlived the client timeout")
+	}
+	if r, err = signRequestTo(ctx, url, body, signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := do(client, r, &encoded); err != nil {
+		t.Fatalf("retry after the timeout: %v", err)
+	}
+}
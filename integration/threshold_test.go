@@ -0,0 +1,269 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/faults"
+	"github.com/miki799/schnorr-signature/schnorr"
+	"github.com/miki799/schnorr-signature/threshold"
+)
+
+/*
+Participant daemon: POST /commit for round 1, POST /sign for round 2.
+Shares pass through byzantine before they are sent, nil for honest
+participants.
+*/
+type participantServer struct {
+	mu        sync.Mutex
+	pt        *threshold.Participant
+	byzantine *faults.Injector
+}
+
+type signRequest struct {
+	Message     string                  `json:"message"`
+	Commitments []*threshold.Commitment `json:"commitments"`
+}
+
+func (s *participantServer) setByzantine(in *faults.Injector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byzantine = in
+}
+
+func (s *participantServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/commit":
+		var empty struct{}
+		if readJSON(w, r, &empty) {
+			commitment, err := s.pt.Commit()
+			writeJSON(w, commitment, err)
+		}
+	case "/sign":
+		var req signRequest
+		if readJSON(w, r, &req) {
+			share, err := s.pt.Sign(req.Message, req.Commitments)
+			if err == nil {
+				share, err = s.byzantine.SignatureShare(share)
+			}
+			writeJSON(w, share, err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+/*
+Coordinator client: collects commitments of the reachable participants, signs
+with the first t of them and drops participants failing round 2 or sending
+invalid shares from the next attempt
+*/
+type coordinator struct {
+	client       *http.Client
+	key          *threshold.GroupKey
+	participants map[int]string // URL by index
+	attempts     int
+}
+
+func (co *coordinator) sign(ctx context.Context, m string) (*schnorr.Signature, error) {
+	excluded := make(map[int]bool)
+	var lastErr error
+	for attempt := 0; attempt < co.attempts; attempt++ {
+		signature, failed, err := co.session(ctx, m, excluded)
+		if err == nil {
+			return signature, nil
+		}
+		lastErr = err
+		if len(failed) == 0 {
+			break
+		}
+		for _, index := range failed {
+			excluded[index] = true
+		}
+	}
+	return nil, lastErr
+}
+
+/*
+One signing session, returns the participants to exclude on failure
+*/
+func (co *coordinator) session(ctx context.Context, m string, excluded map[int]bool) (*schnorr.Signature, []int, error) {
+	type result struct {
+		index      int
+		commitment *threshold.Commitment
+		share      *threshold.SignatureShare
+		err        error
+	}
+
+	// round 1: everybody not excluded
+	results := make(chan result, len(co.participants))
+	var wg sync.WaitGroup
+	for index, url := range co.participants {
+		if excluded[index] {
+			continue
+		}
+		wg.Add(1)
+		go func(index int, url string) {
+			defer wg.Done()
+			var commitment threshold.Commitment
+			err := postJSON(ctx, co.client, url+"/commit", struct{}{}, &commitment)
+			results <- result{index: index, commitment: &commitment, err: err}
+		}(index, url)
+	}
+	wg.Wait()
+	close(results)
+
+	var commitments []*threshold.Commitment
+	for res := range results {
+		if res.err == nil && res.commitment.Index == res.index {
+			commitments = append(commitments, res.commitment)
+		}
+	}
+	if len(commitments) < co.key.Threshold {
+		return nil, nil, fmt.Errorf("only %d of %d participants reachable, threshold %d", len(commitments), len(co.participants), co.key.Threshold)
+	}
+	sort.Slice(commitments, func(i, j int) bool { return commitments[i].Index < commitments[j].Index })
+	commitments = commitments[:co.key.Threshold]
+
+	// round 2: the signing set
+	results = make(chan result, len(commitments))
+	for _, c := range commitments {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			var share threshold.SignatureShare
+			err := postJSON(ctx, co.client, co.participants[index]+"/sign", &signRequest{m, commitments}, &share)
+			results <- result{index: index, share: &share, err: err}
+		}(c.Index)
+	}
+	wg.Wait()
+	close(results)
+
+	combiner := threshold.NewCoordinator(co.key)
+	var shares []*threshold.SignatureShare
+	var failed []int
+	for res := range results {
+		if res.err != nil || res.share.Index != res.index || combiner.VerifyShare(m, commitments, res.share) != nil {
+			failed = append(failed, res.index)
+			continue
+		}
+		shares = append(shares, res.share)
+	}
+	if len(failed) > 0 {
+		sort.Ints(failed)
+		return nil, failed, fmt.Errorf("participants %v failed round 2", failed)
+	}
+	signature, err := combiner.Aggregate(m, commitments, shares)
+	return signature, nil, err
+}
+
+/*
+Key split k-of-n, one daemon per participant
+*/
+func startParticipants(t *testing.T, net *network, k, n int) (*coordinator, *schnorr.PublicKey, map[int]*participantServer) {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, key, err := threshold.NewDealer(sk, pk).Split(k, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := &coordinator{client: net.client(), key: key, participants: make(map[int]string), attempts: 3}
+	servers := make(map[int]*participantServer)
+	for _, share := range shares {
+		if err := key.CheckShare(share); err != nil {
+			t.Fatal(err)
+		}
+		server := &participantServer{pt: threshold.NewParticipant(share, key)}
+		servers[share.Index] = server
+		co.participants[share.Index] = net.serve(t, faults.Threshold, share.Index, server).URL
+	}
+	return co, pk, servers
+}
+
+func TestThresholdSigningOverNetwork(t *testing.T) {
+	net := newNetwork(t)
+	co, pk, servers := startParticipants(t, net, 3, 5)
+	ctx := context.Background()
+
+	// latency on every link
+	net.in.Add(faults.Rule{Protocol: faults.Threshold, Fault: faults.Delay, Delay: 5 * time.Millisecond, Times: 20})
+	signature, err := co.sign(ctx, "release v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !schnorr.VerifySignature("release v1.0.0", signature, pk) {
+		t.Fatal("signature over the network doesn't verify")
+	}
+
+	// two participants partitioned, one too slow for the timeout: t = 3 remain
+	net.in.Reset()
+	net.in.Add(faults.Rule{Protocol: faults.Threshold, Participant: 1, Fault: faults.Drop})
+	net.in.Add(faults.Rule{Protocol: faults.Threshold, Participant: 4, Fault: faults.Drop})
+	net.in.Add(faults.Rule{Protocol: faults.Threshold, Participant: 5, Fault: faults.Delay, Delay: 2 * requestTimeout})
+	if _, err := co.sign(ctx, "partitioned"); err == nil {
+		t.Fatal("signed with 2 of 5 participants reachable")
+	}
+	net.in.Reset()
+	net.in.Add(faults.Rule{Protocol: faults.Threshold, Participant: 1, Fault: faults.Drop})
+	net.in.Add(faults.Rule{Protocol: faults.Threshold, Participant: 4, Fault: faults.Drop})
+	if signature, err = co.sign(ctx, "minority partitioned"); err != nil || !schnorr.VerifySignature("minority partitioned", signature, pk) {
+		t.Fatalf("signing with a partitioned minority: %v", err)
+	}
+
+	// participant 2 lost between the rounds, the session restarts without it
+	net.in.Reset()
+	net.in.Add(faults.Rule{Protocol: faults.Threshold, Round: faults.RoundSign, Participant: 2, Fault: faults.Drop})
+	if signature, err = co.sign(ctx, "lost in round 2"); err != nil || !schnorr.VerifySignature("lost in round 2", signature, pk) {
+		t.Fatalf("signing after a participant failed round 2: %v", err)
+	}
+
+	// a byzantine participant's share is caught by the coordinator
+	net.in.Reset()
+	servers[3].setByzantine(faults.New(faults.Rule{Fault: faults.Corrupt}))
+	if signature, err = co.sign(ctx, "byzantine"); err != nil || !schnorr.VerifySignature("byzantine", signature, pk) {
+		t.Fatalf("signing with a byzantine participant: %v", err)
+	}
+}
+
+/*
+Concurrent sessions through one coordinator, each participant daemon serves
+them in parallel
+*/
+func TestConcurrentThresholdSessions(t *testing.T) {
+	net := newNetwork(t)
+	co, pk, _ := startParticipants(t, net, 2, 3)
+	net.in.Add(faults.Rule{Protocol: faults.Threshold, Fault: faults.Delay, Delay: time.Millisecond})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := fmt.Sprintf("session %d", i)
+			signature, err := co.sign(context.Background(), m)
+			if err == nil && !schnorr.VerifySignature(m, signature, pk) {
+				err = errors.New("signature doesn't verify")
+			}
+			if err != nil {
+				errs <- fmt.Errorf("%s: %w", m, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
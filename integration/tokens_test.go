@@ -0,0 +1,321 @@
+package integration
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/faults"
+	"github.com/miki799/schnorr-signature/schnorr"
+	"github.com/miki799/schnorr-signature/tokens"
+)
+
+/*
+Protocol of the issuer's fault points, rounds schedule, commit and respond
+*/
+const protocolIssuer = "issuer"
+
+/*
+Blind issuer daemon: GET /schedule, POST /commit opens a session, POST /respond
+answers its challenge once
+*/
+type issuerServer struct {
+	issuer *tokens.Issuer
+	mux    *http.ServeMux
+
+	mu       sync.Mutex
+	sessions map[string]*schnorr.BlindSigner
+}
+
+type commitResponse struct {
+	Session    string `json:"session"`
+	Epoch      uint64 `json:"epoch"`
+	Commitment string `json:"commitment"` // hex of schnorr.BlindCommitment.Bytes
+}
+
+type respondRequest struct {
+	Session   string `json:"session"`
+	Challenge string `json:"challenge"` // hex of schnorr.BlindChallenge.Bytes
+}
+
+type respondResponse struct {
+	Response string `json:"response"` // hex of schnorr.BlindResponse.Bytes
+}
+
+func newIssuerServer(issuer *tokens.Issuer) *issuerServer {
+	s := &issuerServer{issuer: issuer, mux: http.NewServeMux(), sessions: make(map[string]*schnorr.BlindSigner)}
+	s.mux.Handle("/schedule", issuer.ScheduleHandler())
+	s.mux.HandleFunc("/commit", s.commit)
+	s.mux.HandleFunc("/respond", s.respond)
+	return s
+}
+
+func (s *issuerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *issuerServer) commit(w http.ResponseWriter, r *http.Request) {
+	var empty struct{}
+	if !readJSON(w, r, &empty) {
+		return
+	}
+	epoch, signer, err := s.issuer.Signer()
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(entropy.Reader, id); err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	commitment, err := signer.SignerCommit()
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.sessions[hex.EncodeToString(id)] = signer
+	s.mu.Unlock()
+	writeJSON(w, &commitResponse{hex.EncodeToString(id), epoch, hex.EncodeToString(commitment.Bytes())}, nil)
+}
+
+func (s *issuerServer) respond(w http.ResponseWriter, r *http.Request) {
+	var req respondRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	s.mu.Lock()
+	signer, ok := s.sessions[req.Session]
+	delete(s.sessions, req.Session)
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	b, err := hex.DecodeString(req.Challenge)
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	challenge, err := schnorr.ParseBlindChallenge(b)
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	response, err := signer.SignerRespond(challenge)
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	writeJSON(w, &respondResponse{hex.EncodeToString(response.Bytes())}, nil)
+}
+
+/*
+Redeeming daemon: POST /redeem, loads the epoch keys from the issuer's
+schedule when a token of an unknown epoch arrives
+*/
+type verifierServer struct {
+	verifier  *tokens.Verifier
+	client    *http.Client
+	issuerURL string
+}
+
+type redeemRequest struct {
+	Token string `json:"token"` // hex of tokens.Token.Bytes
+}
+
+func (s *verifierServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req redeemRequest
+	if r.URL.Path != "/redeem" {
+		http.NotFound(w, r)
+		return
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	b, err := hex.DecodeString(req.Token)
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	token, err := tokens.ParseToken(b)
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+
+	err = s.verifier.Redeem(token)
+	if errors.Is(err, tokens.ErrUnknownEpoch) {
+		var doc tokens.EpochSchedule
+		if err := getJSON(r.Context(), s.client, s.issuerURL+"/schedule", &doc); err != nil {
+			http.Error(w, "issuer unreachable: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err := s.verifier.SetSchedule(&doc); err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		err = s.verifier.Redeem(token)
+	}
+	switch {
+	case errors.Is(err, tokens.ErrTokenSpent):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		writeJSON(w, nil, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+/*
+Client side of the issuance: key of the current epoch from the schedule, one
+blind session for a random serial
+*/
+func issueToken(ctx context.Context, client *http.Client, issuerURL string) (*tokens.Token, error) {
+	var doc tokens.EpochSchedule
+	if err := getJSON(ctx, client, issuerURL+"/schedule", &doc); err != nil {
+		return nil, err
+	}
+	var commit commitResponse
+	if err := postJSON(ctx, client, issuerURL+"/commit", struct{}{}, &commit); err != nil {
+		return nil, err
+	}
+	var pk *schnorr.PublicKey
+	for _, info := range doc.Epochs {
+		if info.Epoch == commit.Epoch {
+			b, err := hex.DecodeString(info.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			if pk, err = schnorr.ParsePublicKey(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if pk == nil {
+		return nil, tokens.ErrUnknownEpoch
+	}
+
+	b, err := hex.DecodeString(commit.Commitment)
+	if err != nil {
+		return nil, err
+	}
+	commitment, err := schnorr.ParseBlindCommitment(b)
+	if err != nil {
+		return nil, err
+	}
+	serial := make([]byte, 16)
+	if _, err := io.ReadFull(entropy.Reader, serial); err != nil {
+		return nil, err
+	}
+	requester := schnorr.NewBlindRequester(pk)
+	challenge, err := requester.RequesterChallenge(commitment, tokens.Message(commit.Epoch, serial))
+	if err != nil {
+		return nil, err
+	}
+
+	var respond respondResponse
+	if err := postJSON(ctx, client, issuerURL+"/respond", &respondRequest{commit.Session, hex.EncodeToString(challenge.Bytes())}, &respond); err != nil {
+		return nil, err
+	}
+	if b, err = hex.DecodeString(respond.Response); err != nil {
+		return nil, err
+	}
+	response, err := schnorr.ParseBlindResponse(b)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := requester.RequesterFinalize(response)
+	if err != nil {
+		return nil, err
+	}
+	return &tokens.Token{Epoch: commit.Epoch, Serial: serial, Signature: signature}, nil
+}
+
+func redeem(ctx context.Context, client *http.Client, verifierURL string, token *tokens.Token) error {
+	return postJSON(ctx, client, verifierURL+"/redeem", &redeemRequest{hex.EncodeToString(token.Bytes())}, nil)
+}
+
+func TestBlindIssuanceOverNetwork(t *testing.T) {
+	schedule := tokens.Schedule{Start: schnorr.Now().Add(-time.Minute), Period: time.Hour, Window: 2}
+	issuer, err := tokens.NewIssuer(schedule, schnorr.ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := tokens.NewVerifier(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	net := newNetwork(t)
+	client := net.client()
+	issuerURL := net.serve(t, protocolIssuer, 0, newIssuerServer(issuer)).URL
+	verifierURL := net.serve(t, "verifier", 0, &verifierServer{verifier, client, issuerURL}).URL
+	ctx := context.Background()
+
+	net.in.Add(faults.Rule{Protocol: protocolIssuer, Fault: faults.Delay, Delay: 5 * time.Millisecond})
+	token, err := issueToken(ctx, client, issuerURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the verifier can't reach the issuer for the epoch keys yet
+	net.in.Reset()
+	net.in.Add(faults.Rule{Protocol: protocolIssuer, Round: "schedule", Fault: faults.Drop, Times: 1})
+	var status *statusError
+	if err := redeem(ctx, client, verifierURL, token); !errors.As(err, &status) || status.code != http.StatusServiceUnavailable {
+		t.Fatalf("redeem with the issuer partitioned: %v", err)
+	}
+	if err := redeem(ctx, client, verifierURL, token); err != nil {
+		t.Fatalf("redeem after the partition healed: %v", err)
+	}
+	if err := redeem(ctx, client, verifierURL, token); !errors.As(err, &status) || status.code != http.StatusConflict {
+		t.Fatalf("second redemption: %v", err)
+	}
+
+	// the response is lost, the session is gone: the client starts a new one
+	net.in.Add(faults.Rule{Protocol: protocolIssuer, Round: "respond", Fault: faults.Drop, Times: 1})
+	if _, err := issueToken(ctx, client, issuerURL); !errors.Is(err, faults.ErrDropped) {
+		t.Fatalf("issuance with the response dropped: %v", err)
+	}
+	if token, err = issueToken(ctx, client, issuerURL); err != nil {
+		t.Fatal(err)
+	}
+	if err := redeem(ctx, client, verifierURL, token); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent clients
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := issueToken(ctx, client, issuerURL)
+			if err == nil {
+				err = redeem(ctx, client, verifierURL, token)
+			}
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if spent := verifier.Spent(); spent != 10 {
+		t.Errorf("%d tokens spent, want 10", spent)
+	}
+}
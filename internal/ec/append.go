@@ -0,0 +1,97 @@
+package ec
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+/*
+Compressed encodings computed into caller buffers
+
+The signing and verification hot path encodes the points it computes (R = k*G
+when signing, s*G - c*X when verifying) without allocating: the points stay in
+the projective field arithmetic of ct.go, on the stack, and only the encoding
+is appended to the caller's buffer. Scalars are at most 33 bytes wide, which
+covers every curve over a 256-bit field.
+*/
+
+const maxScalarLen = 33
+
+/*
+dst || MarshalCompressed(p)
+*/
+func (c *Curve) AppendCompressed(dst []byte, p *Point) ([]byte, error) {
+	if p.IsIdentity() {
+		return dst, ErrIdentity
+	}
+	n := len(dst)
+	dst = append(dst, make([]byte, 1+c.ByteLen())...)
+	dst[n] = 2 | byte(p.Y.Bit(0))
+	p.X.FillBytes(dst[n+1:])
+	return dst, nil
+}
+
+/*
+dst || MarshalCompressed(k*G), constant time with respect to k
+*/
+func (c *Curve) AppendScalarBaseMult(dst []byte, k *big.Int) ([]byte, error) {
+	ar := c.arithmetic()
+	var buf [maxScalarLen]byte
+	kb := c.scalarBytesTo(buf[:ar.width], k)
+	r := ar.scalarMult(&ar.base, kb)
+	wipe(kb)
+	return ar.appendCompressed(dst, &r)
+}
+
+/*
+dst || MarshalCompressed(s*G + e*p) with Straus' method over the generator's
+table and one for p. Variable time, for public points and scalars only
+(signature verification).
+*/
+func (c *Curve) AppendDoubleScalarMult(dst []byte, s *big.Int, p *Point, e *big.Int) ([]byte, error) {
+	ar := c.arithmetic()
+	var table [16]projective
+	ar.table(&table, ar.projective(p))
+	var sBuf, eBuf [maxScalarLen]byte
+	sb := c.scalarBytesTo(sBuf[:ar.width], s)
+	eb := c.scalarBytesTo(eBuf[:ar.width], e)
+
+	acc := ar.identity()
+	for j := range sb {
+		for _, shift := range [2]uint{4, 0} {
+			for d := 0; d < 4; d++ {
+				ar.double(&acc, &acc)
+			}
+			if w := sb[j] >> shift & 15; w != 0 {
+				ar.add(&acc, &acc, &ar.base[w])
+			}
+			if w := eb[j] >> shift & 15; w != 0 {
+				ar.add(&acc, &acc, &table[w])
+			}
+		}
+	}
+	return ar.appendCompressed(dst, &acc)
+}
+
+/*
+dst || compressed encoding of q, from the field elements
+*/
+func (ar *arithmetic) appendCompressed(dst []byte, q *projective) ([]byte, error) {
+	if q.Z.isZero() == 1 {
+		return dst, ErrIdentity
+	}
+	f := ar.f
+	var zInv, x, y fe
+	f.inv(&zInv, &q.Z)
+	f.mul(&x, &q.X, &zInv)
+	f.mul(&y, &q.Y, &zInv)
+	// out of the Montgomery form
+	f.mul(&x, &x, &fe{1})
+	f.mul(&y, &y, &fe{1})
+
+	dst = append(dst, 2|byte(y[0]&1))
+	for i := len(x) - 1; i >= 0; i-- {
+		dst = binary.BigEndian.AppendUint64(dst, x[i])
+	}
+	return dst, nil
+}
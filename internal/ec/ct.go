@@ -0,0 +1,245 @@
+package ec
+
+import (
+	"math/big"
+)
+
+/*
+Constant-time scalar multiplication
+
+Points are in homogeneous projective coordinates (X:Y:Z) with the identity
+(0:1:0), added with the complete formulas of Renes, Costello and Batina
+("Complete addition formulas for prime order elliptic curves", 2016,
+algorithm 1), which are exception free: the same sequence of field operations
+adds distinct points, doubles and handles the identity. The doublings of the
+scalar multiplication use the complete doubling formulas of the same paper. The scalar is
+processed in fixed 4-bit windows over the full width of the order with a
+masked table lookup, so neither the branches nor the memory accesses depend
+on its bits.
+*/
+type projective struct {
+	X, Y, Z fe
+}
+
+/*
+Field and curve constants in Montgomery form, computed once per curve
+*/
+type arithmetic struct {
+	f     *field
+	a, b3 fe             // a and 3b
+	base  [16]projective // 0*G .. 15*G
+	width int            // bytes of the scalars
+}
+
+func newArithmetic(c *Curve) *arithmetic {
+	ar := &arithmetic{f: newField(c.P), width: (c.N.BitLen() + 7) / 8}
+	ar.f.toMont(&ar.a, new(big.Int).Mod(c.A, c.P))
+	b3 := new(big.Int).Mul(c.B, big.NewInt(3))
+	ar.f.toMont(&ar.b3, b3.Mod(b3, c.P))
+	ar.table(&ar.base, ar.projective(c.Generator()))
+	return ar
+}
+
+func (ar *arithmetic) identity() projective {
+	return projective{Y: ar.f.one}
+}
+
+func (ar *arithmetic) projective(p *Point) projective {
+	if p.IsIdentity() {
+		return ar.identity()
+	}
+	var q projective
+	ar.f.toMont(&q.X, p.X)
+	ar.f.toMont(&q.Y, p.Y)
+	q.Z = ar.f.one
+	return q
+}
+
+func (ar *arithmetic) affine(q *projective) *Point {
+	if q.Z.isZero() == 1 {
+		return &Point{}
+	}
+	f := ar.f
+	var zInv, x, y fe
+	f.inv(&zInv, &q.Z)
+	f.mul(&x, &q.X, &zInv)
+	f.mul(&y, &q.Y, &zInv)
+	return &Point{f.fromMont(&x), f.fromMont(&y)}
+}
+
+/*
+r = p + q, complete for every pair of points (RCB16 algorithm 1)
+*/
+func (ar *arithmetic) add(r, p, q *projective) {
+	f := ar.f
+	var t0, t1, t2, t3, t4, t5, X3, Y3, Z3 fe
+
+	f.mul(&t0, &p.X, &q.X)
+	f.mul(&t1, &p.Y, &q.Y)
+	f.mul(&t2, &p.Z, &q.Z)
+	f.add(&t3, &p.X, &p.Y)
+	f.add(&t4, &q.X, &q.Y)
+	f.mul(&t3, &t3, &t4)
+	f.add(&t4, &t0, &t1)
+	f.sub(&t3, &t3, &t4)
+	f.add(&t4, &p.X, &p.Z)
+	f.add(&t5, &q.X, &q.Z)
+	f.mul(&t4, &t4, &t5)
+	f.add(&t5, &t0, &t2)
+	f.sub(&t4, &t4, &t5)
+	f.add(&t5, &p.Y, &p.Z)
+	f.add(&X3, &q.Y, &q.Z)
+	f.mul(&t5, &t5, &X3)
+	f.add(&X3, &t1, &t2)
+	f.sub(&t5, &t5, &X3)
+	f.mul(&Z3, &ar.a, &t4)
+	f.mul(&X3, &ar.b3, &t2)
+	f.add(&Z3, &X3, &Z3)
+	f.sub(&X3, &t1, &Z3)
+	f.add(&Z3, &t1, &Z3)
+	f.mul(&Y3, &X3, &Z3)
+	f.add(&t1, &t0, &t0)
+	f.add(&t1, &t1, &t0)
+	f.mul(&t2, &ar.a, &t2)
+	f.mul(&t4, &ar.b3, &t4)
+	f.add(&t1, &t1, &t2)
+	f.sub(&t2, &t0, &t2)
+	f.mul(&t2, &ar.a, &t2)
+	f.add(&t4, &t4, &t2)
+	f.mul(&t0, &t1, &t4)
+	f.add(&Y3, &Y3, &t0)
+	f.mul(&t0, &t5, &t4)
+	f.mul(&X3, &t3, &X3)
+	f.sub(&X3, &X3, &t0)
+	f.mul(&t0, &t3, &t1)
+	f.mul(&Z3, &t5, &Z3)
+	f.add(&Z3, &Z3, &t0)
+
+	r.X, r.Y, r.Z = X3, Y3, Z3
+}
+
+/*
+r = 2p, complete for every point (RCB16 algorithm 3, algorithm 9 for a = 0),
+cheaper than add(r, p, p)
+*/
+func (ar *arithmetic) double(r, p *projective) {
+	f := ar.f
+	var t0, t1, t2, t3, X3, Y3, Z3 fe
+
+	if ar.a.isZero() == 1 {
+		f.mul(&t0, &p.Y, &p.Y)
+		f.add(&Z3, &t0, &t0)
+		f.add(&Z3, &Z3, &Z3)
+		f.add(&Z3, &Z3, &Z3)
+		f.mul(&t1, &p.Y, &p.Z)
+		f.mul(&t2, &p.Z, &p.Z)
+		f.mul(&t2, &ar.b3, &t2)
+		f.mul(&X3, &t2, &Z3)
+		f.add(&Y3, &t0, &t2)
+		f.mul(&Z3, &t1, &Z3)
+		f.add(&t1, &t2, &t2)
+		f.add(&t2, &t1, &t2)
+		f.sub(&t0, &t0, &t2)
+		f.mul(&Y3, &t0, &Y3)
+		f.add(&Y3, &X3, &Y3)
+		f.mul(&t1, &p.X, &p.Y)
+		f.mul(&X3, &t0, &t1)
+		f.add(&X3, &X3, &X3)
+
+		r.X, r.Y, r.Z = X3, Y3, Z3
+		return
+	}
+
+	f.mul(&t0, &p.X, &p.X)
+	f.mul(&t1, &p.Y, &p.Y)
+	f.mul(&t2, &p.Z, &p.Z)
+	f.mul(&t3, &p.X, &p.Y)
+	f.add(&t3, &t3, &t3)
+	f.mul(&Z3, &p.X, &p.Z)
+	f.add(&Z3, &Z3, &Z3)
+	f.mul(&X3, &ar.a, &Z3)
+	f.mul(&Y3, &ar.b3, &t2)
+	f.add(&Y3, &X3, &Y3)
+	f.sub(&X3, &t1, &Y3)
+	f.add(&Y3, &t1, &Y3)
+	f.mul(&Y3, &X3, &Y3)
+	f.mul(&X3, &t3, &X3)
+	f.mul(&Z3, &ar.b3, &Z3)
+	f.mul(&t2, &ar.a, &t2)
+	f.sub(&t3, &t0, &t2)
+	f.mul(&t3, &ar.a, &t3)
+	f.add(&t3, &t3, &Z3)
+	f.add(&Z3, &t0, &t0)
+	f.add(&t0, &Z3, &t0)
+	f.add(&t0, &t0, &t2)
+	f.mul(&t0, &t0, &t3)
+	f.add(&Y3, &Y3, &t0)
+	f.mul(&t2, &p.Y, &p.Z)
+	f.add(&t2, &t2, &t2)
+	f.mul(&t0, &t2, &t3)
+	f.sub(&X3, &X3, &t0)
+	f.mul(&Z3, &t2, &t1)
+	f.add(&Z3, &Z3, &Z3)
+	f.add(&Z3, &Z3, &Z3)
+
+	r.X, r.Y, r.Z = X3, Y3, Z3
+}
+
+/*
+table[i] = i * p
+*/
+func (ar *arithmetic) table(table *[16]projective, p projective) {
+	table[0] = ar.identity()
+	table[1] = p
+	for i := 2; i < len(table); i++ {
+		ar.add(&table[i], &table[i-1], &p)
+	}
+}
+
+/*
+k * table[1], k is the big endian scalar of the full width
+*/
+func (ar *arithmetic) scalarMult(table *[16]projective, k []byte) projective {
+	acc := ar.identity()
+	var sel projective
+	for _, b := range k {
+		for _, w := range [2]byte{b >> 4, b & 15} {
+			for i := 0; i < 4; i++ {
+				ar.double(&acc, &acc)
+			}
+			sel = projective{}
+			for i := range table {
+				d := uint64(byte(i) ^ w)
+				mask := ((d | -d) >> 63) - 1
+				sel.X.selectIf(mask, &table[i].X)
+				sel.Y.selectIf(mask, &table[i].Y)
+				sel.Z.selectIf(mask, &table[i].Z)
+			}
+			ar.add(&acc, &acc, &sel)
+		}
+	}
+	return acc
+}
+
+/*
+Fixed-width big endian encoding of k mod N, negative scalars included
+*/
+func (c *Curve) scalarBytes(k *big.Int, width int) []byte {
+	return c.scalarBytesTo(make([]byte, width), k)
+}
+
+/*
+scalarBytes into buf of the width
+*/
+func (c *Curve) scalarBytesTo(buf []byte, k *big.Int) []byte {
+	if k.Sign() < 0 || k.Cmp(c.N) >= 0 {
+		k = new(big.Int).Mod(k, c.N)
+	}
+	return k.FillBytes(buf)
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
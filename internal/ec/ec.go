@@ -0,0 +1,368 @@
+/*
+Short Weierstrass elliptic curves y^2 = x^3 + ax + b over prime fields.
+
+Scalar multiplication is constant time with respect to the scalar (see ct.go),
+point addition, encoding and decoding use math/big and Jacobian coordinates
+and are meant for public points only.
+*/
+package ec
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrInvalidPoint = errors.New("ec: invalid point encoding")
+	ErrIdentity     = errors.New("ec: identity point can't be encoded")
+)
+
+type Curve struct {
+	Name   string
+	P      *big.Int // field prime
+	N      *big.Int // order of the base point
+	A, B   *big.Int // curve coefficients
+	Gx, Gy *big.Int // base point
+
+	ar *arithmetic // constant-time arithmetic, set up by init for the built-in curves
+}
+
+/*
+Affine point, the identity (point at infinity) has nil coordinates
+*/
+type Point struct {
+	X, Y *big.Int
+}
+
+func (p *Point) IsIdentity() bool {
+	return p.X == nil
+}
+
+func (p *Point) Equal(q *Point) bool {
+	if p.IsIdentity() || q.IsIdentity() {
+		return p.IsIdentity() == q.IsIdentity()
+	}
+	return p.X.Cmp(q.X) == 0 && p.Y.Cmp(q.Y) == 0
+}
+
+func hexInt(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("ec: invalid constant " + s)
+	}
+	return n
+}
+
+var secp256k1 = &Curve{
+	Name: "secp256k1",
+	P:    hexInt("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F"),
+	N:    hexInt("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141"),
+	A:    big.NewInt(0),
+	B:    big.NewInt(7),
+	Gx:   hexInt("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798"),
+	Gy:   hexInt("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8"),
+}
+
+var p256 = &Curve{
+	Name: "P-256",
+	P:    hexInt("FFFFFFFF00000001000000000000000000000000FFFFFFFFFFFFFFFFFFFFFFFF"),
+	N:    hexInt("FFFFFFFF00000000FFFFFFFFFFFFFFFFBCE6FAADA7179E84F3B9CAC2FC632551"),
+	A:    hexInt("FFFFFFFF00000001000000000000000000000000FFFFFFFFFFFFFFFFFFFFFFFC"),
+	B:    hexInt("5AC635D8AA3A93E7B3EBBD55769886BC651D06B0CC53B0F63BCE3C3E27D2604B"),
+	Gx:   hexInt("6B17D1F2E12C4247F8BCE6E563A440F277037D812DEB33A0F4A13945D898C296"),
+	Gy:   hexInt("4FE342E2FE1A7F9B8EE7EB4A7C0F9E162BCE33576B315ECECBB6406837BF51F5"),
+}
+
+func init() {
+	for _, c := range []*Curve{secp256k1, p256} {
+		c.ar = newArithmetic(c)
+	}
+}
+
+func (c *Curve) arithmetic() *arithmetic {
+	if c.ar != nil {
+		return c.ar
+	}
+	return newArithmetic(c)
+}
+
+func Secp256k1() *Curve {
+	return secp256k1
+}
+
+func P256() *Curve {
+	return p256
+}
+
+/*
+Size of the encoded field elements and scalars in bytes
+*/
+func (c *Curve) ByteLen() int {
+	return (c.P.BitLen() + 7) / 8
+}
+
+func (c *Curve) Generator() *Point {
+	return &Point{new(big.Int).Set(c.Gx), new(big.Int).Set(c.Gy)}
+}
+
+func (c *Curve) IsOnCurve(p *Point) bool {
+	if p.IsIdentity() {
+		return true
+	}
+	if p.X.Sign() < 0 || p.X.Cmp(c.P) >= 0 || p.Y.Sign() < 0 || p.Y.Cmp(c.P) >= 0 {
+		return false
+	}
+	left := new(big.Int).Mul(p.Y, p.Y)
+	return left.Mod(left, c.P).Cmp(c.rhs(p.X)) == 0
+}
+
+/*
+x^3 + ax + b
+*/
+func (c *Curve) rhs(x *big.Int) *big.Int {
+	y2 := new(big.Int).Mul(x, x)
+	y2.Add(y2, c.A)
+	y2.Mul(y2, x)
+	y2.Add(y2, c.B)
+	return y2.Mod(y2, c.P)
+}
+
+func (c *Curve) Add(p, q *Point) *Point {
+	return c.affine(c.add(c.jacobian(p), c.jacobian(q)))
+}
+
+func (c *Curve) Neg(p *Point) *Point {
+	if p.IsIdentity() {
+		return &Point{}
+	}
+	y := new(big.Int).Sub(c.P, p.Y)
+	return &Point{new(big.Int).Set(p.X), y.Mod(y, c.P)}
+}
+
+/*
+k * p in constant time, k is reduced modulo the group order
+*/
+func (c *Curve) ScalarMult(p *Point, k *big.Int) *Point {
+	ar := c.arithmetic()
+	var table [16]projective
+	ar.table(&table, ar.projective(p))
+	return c.scalarMult(ar, &table, k)
+}
+
+func (c *Curve) ScalarBaseMult(k *big.Int) *Point {
+	ar := c.arithmetic()
+	return c.scalarMult(ar, &ar.base, k)
+}
+
+func (c *Curve) scalarMult(ar *arithmetic, table *[16]projective, k *big.Int) *Point {
+	kb := c.scalarBytes(k, ar.width)
+	defer wipe(kb)
+	r := ar.scalarMult(table, kb)
+	return ar.affine(&r)
+}
+
+/*
+Compressed SEC1 encoding: 0x02/0x03 (parity of y) || x
+*/
+func (c *Curve) MarshalCompressed(p *Point) ([]byte, error) {
+	if p.IsIdentity() {
+		return nil, ErrIdentity
+	}
+	b := make([]byte, 1+c.ByteLen())
+	b[0] = 2 | byte(p.Y.Bit(0))
+	p.X.FillBytes(b[1:])
+	return b, nil
+}
+
+func (c *Curve) UnmarshalCompressed(b []byte) (*Point, error) {
+	if len(b) != 1+c.ByteLen() || (b[0] != 2 && b[0] != 3) {
+		return nil, ErrInvalidPoint
+	}
+	x := new(big.Int).SetBytes(b[1:])
+	p, err := c.LiftX(x)
+	if err != nil {
+		return nil, err
+	}
+	if p.Y.Bit(0) != uint(b[0]&1) {
+		p.Y.Sub(c.P, p.Y)
+	}
+	return p, nil
+}
+
+/*
+Uncompressed SEC1 encoding: 0x04 || x || y
+*/
+func (c *Curve) Marshal(p *Point) ([]byte, error) {
+	if p.IsIdentity() {
+		return nil, ErrIdentity
+	}
+	size := c.ByteLen()
+	b := make([]byte, 1+2*size)
+	b[0] = 4
+	p.X.FillBytes(b[1 : 1+size])
+	p.Y.FillBytes(b[1+size:])
+	return b, nil
+}
+
+func (c *Curve) Unmarshal(b []byte) (*Point, error) {
+	size := c.ByteLen()
+	if len(b) != 1+2*size || b[0] != 4 {
+		return nil, ErrInvalidPoint
+	}
+	p := &Point{new(big.Int).SetBytes(b[1 : 1+size]), new(big.Int).SetBytes(b[1+size:])}
+	if !c.IsOnCurve(p) {
+		return nil, ErrInvalidPoint
+	}
+	return p, nil
+}
+
+/*
+Point with the given x coordinate and even y
+*/
+func (c *Curve) LiftX(x *big.Int) (*Point, error) {
+	if x.Sign() < 0 || x.Cmp(c.P) >= 0 {
+		return nil, ErrInvalidPoint
+	}
+	y := new(big.Int).ModSqrt(c.rhs(x), c.P)
+	if y == nil {
+		return nil, ErrInvalidPoint
+	}
+	if y.Bit(0) == 1 {
+		y.Sub(c.P, y)
+	}
+	return &Point{new(big.Int).Set(x), y}, nil
+}
+
+/*
+Point (X/Z^2, Y/Z^3), the identity has Z = 0
+*/
+type jacobianPoint struct {
+	X, Y, Z *big.Int
+}
+
+func (j jacobianPoint) isIdentity() bool {
+	return j.Z == nil || j.Z.Sign() == 0
+}
+
+func (c *Curve) jacobian(p *Point) jacobianPoint {
+	if p.IsIdentity() {
+		return jacobianPoint{}
+	}
+	return jacobianPoint{new(big.Int).Set(p.X), new(big.Int).Set(p.Y), big.NewInt(1)}
+}
+
+func (c *Curve) affine(j jacobianPoint) *Point {
+	if j.isIdentity() {
+		return &Point{}
+	}
+	zInv := new(big.Int).ModInverse(j.Z, c.P)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	x := new(big.Int).Mul(j.X, zInv2)
+	y := new(big.Int).Mul(j.Y, zInv2.Mul(zInv2, zInv))
+	return &Point{x.Mod(x, c.P), y.Mod(y, c.P)}
+}
+
+/*
+dbl-2007-bl from the Explicit-Formulas Database
+*/
+func (c *Curve) double(p jacobianPoint) jacobianPoint {
+	if p.isIdentity() || p.Y.Sign() == 0 {
+		return jacobianPoint{}
+	}
+	mod := func(n *big.Int) *big.Int { return n.Mod(n, c.P) }
+
+	XX := mod(new(big.Int).Mul(p.X, p.X))
+	YY := mod(new(big.Int).Mul(p.Y, p.Y))
+	YYYY := mod(new(big.Int).Mul(YY, YY))
+	ZZ := mod(new(big.Int).Mul(p.Z, p.Z))
+
+	// S = 2*((X1+YY)^2-XX-YYYY)
+	S := new(big.Int).Add(p.X, YY)
+	S.Mul(S, S)
+	S.Sub(S, XX)
+	S.Sub(S, YYYY)
+	S = mod(S.Lsh(S, 1))
+
+	// M = 3*XX+a*ZZ^2
+	M := new(big.Int).Mul(XX, big.NewInt(3))
+	if c.A.Sign() != 0 {
+		aZZ := new(big.Int).Mul(ZZ, ZZ)
+		M.Add(M, aZZ.Mul(aZZ, c.A))
+	}
+	M = mod(M)
+
+	// X3 = M^2-2*S
+	X3 := new(big.Int).Mul(M, M)
+	X3 = mod(X3.Sub(X3, new(big.Int).Lsh(S, 1)))
+
+	// Y3 = M*(S-X3)-8*YYYY
+	Y3 := new(big.Int).Sub(S, X3)
+	Y3.Mul(Y3, M)
+	Y3 = mod(Y3.Sub(Y3, new(big.Int).Lsh(YYYY, 3)))
+
+	// Z3 = (Y1+Z1)^2-YY-ZZ
+	Z3 := new(big.Int).Add(p.Y, p.Z)
+	Z3.Mul(Z3, Z3)
+	Z3.Sub(Z3, YY)
+	Z3 = mod(Z3.Sub(Z3, ZZ))
+
+	return jacobianPoint{X3, Y3, Z3}
+}
+
+/*
+add-2007-bl from the Explicit-Formulas Database
+*/
+func (c *Curve) add(p, q jacobianPoint) jacobianPoint {
+	if p.isIdentity() {
+		return q
+	}
+	if q.isIdentity() {
+		return p
+	}
+	mod := func(n *big.Int) *big.Int { return n.Mod(n, c.P) }
+
+	Z1Z1 := mod(new(big.Int).Mul(p.Z, p.Z))
+	Z2Z2 := mod(new(big.Int).Mul(q.Z, q.Z))
+	U1 := mod(new(big.Int).Mul(p.X, Z2Z2))
+	U2 := mod(new(big.Int).Mul(q.X, Z1Z1))
+	S1 := new(big.Int).Mul(p.Y, q.Z)
+	S1 = mod(S1.Mul(S1, Z2Z2))
+	S2 := new(big.Int).Mul(q.Y, p.Z)
+	S2 = mod(S2.Mul(S2, Z1Z1))
+
+	H := mod(new(big.Int).Sub(U2, U1))
+	r := mod(new(big.Int).Sub(S2, S1))
+	if H.Sign() == 0 {
+		if r.Sign() == 0 {
+			return c.double(p)
+		}
+		return jacobianPoint{}
+	}
+	r.Lsh(r, 1)
+
+	// I = (2*H)^2, J = H*I, V = U1*I
+	I := new(big.Int).Lsh(H, 1)
+	I = mod(I.Mul(I, I))
+	J := mod(new(big.Int).Mul(H, I))
+	V := mod(new(big.Int).Mul(U1, I))
+
+	// X3 = r^2-J-2*V
+	X3 := new(big.Int).Mul(r, r)
+	X3.Sub(X3, J)
+	X3 = mod(X3.Sub(X3, new(big.Int).Lsh(V, 1)))
+
+	// Y3 = r*(V-X3)-2*S1*J
+	Y3 := new(big.Int).Sub(V, X3)
+	Y3.Mul(Y3, r)
+	S1J := new(big.Int).Mul(S1, J)
+	Y3 = mod(Y3.Sub(Y3, S1J.Lsh(S1J, 1)))
+
+	// Z3 = ((Z1+Z2)^2-Z1Z1-Z2Z2)*H
+	Z3 := new(big.Int).Add(p.Z, q.Z)
+	Z3.Mul(Z3, Z3)
+	Z3.Sub(Z3, Z1Z1)
+	Z3.Sub(Z3, Z2Z2)
+	Z3 = mod(Z3.Mul(Z3, H))
+
+	return jacobianPoint{X3, Y3, Z3}
+}
@@ -0,0 +1,180 @@
+package ec
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+/*
+Constant-time arithmetic in the prime field of a curve
+
+Field elements are 4 little-endian 64-bit limbs in Montgomery form
+(a*R mod P, R = 2^256), multiplication is CIOS Montgomery multiplication and
+additions end in a masked conditional subtraction, so loop counts and memory
+accesses don't depend on the values. Both built-in curves have 256-bit primes.
+*/
+type fe [4]uint64
+
+type field struct {
+	p    fe
+	minv uint64 // -p^-1 mod 2^64
+	r2   fe     // R^2 mod p
+	one  fe     // R mod p, 1 in Montgomery form
+	exp  []byte // p - 2 big endian, Fermat inversion
+}
+
+func newField(p *big.Int) *field {
+	f := &field{}
+	limbs(&f.p, p)
+
+	// Newton iteration for p0^-1 mod 2^64 (p0 odd), 6 steps double to 64 bits
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - f.p[0]*inv
+	}
+	f.minv = -inv
+
+	R := new(big.Int).Lsh(big.NewInt(1), 256)
+	limbs(&f.one, new(big.Int).Mod(R, p))
+	limbs(&f.r2, R.Mul(R, R).Mod(R, p))
+	f.exp = new(big.Int).Sub(p, big.NewInt(2)).Bytes()
+	return f
+}
+
+/*
+Limbs of 0 <= x < 2^256, through the fixed-length big-endian encoding
+*/
+func limbs(z *fe, x *big.Int) {
+	var buf [32]byte
+	x.FillBytes(buf[:])
+	for i := range z {
+		var w uint64
+		for _, b := range buf[8*(3-i) : 8*(4-i)] {
+			w = w<<8 | uint64(b)
+		}
+		z[i] = w
+	}
+}
+
+func (f *field) toMont(z *fe, x *big.Int) {
+	limbs(z, x)
+	f.mul(z, z, &f.r2)
+}
+
+func (f *field) fromMont(x *fe) *big.Int {
+	var z fe
+	f.mul(&z, x, &fe{1})
+	var buf [32]byte
+	for i, w := range z {
+		for j := 0; j < 8; j++ {
+			buf[8*(3-i)+7-j] = byte(w >> (8 * j))
+		}
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+/*
+a*b + c + d as (hi, lo)
+*/
+func madd(a, b, c, d uint64) (uint64, uint64) {
+	hi, lo := bits.Mul64(a, b)
+	var carry uint64
+	lo, carry = bits.Add64(lo, c, 0)
+	hi += carry
+	lo, carry = bits.Add64(lo, d, 0)
+	hi += carry
+	return hi, lo
+}
+
+/*
+z = x*y*R^-1 mod p, z may alias x or y
+*/
+func (f *field) mul(z, x, y *fe) {
+	var t [6]uint64
+	for i := 0; i < 4; i++ {
+		var C, carry uint64
+		for j := 0; j < 4; j++ {
+			C, t[j] = madd(x[j], y[i], t[j], C)
+		}
+		t[4], carry = bits.Add64(t[4], C, 0)
+		t[5] = carry
+
+		q := t[0] * f.minv
+		C, _ = madd(q, f.p[0], t[0], 0)
+		for j := 1; j < 4; j++ {
+			C, t[j-1] = madd(q, f.p[j], t[j], C)
+		}
+		t[3], carry = bits.Add64(t[4], C, 0)
+		t[4] = t[5] + carry
+	}
+	f.reduce(z, &fe{t[0], t[1], t[2], t[3]}, t[4])
+}
+
+/*
+z = (hi*2^256 + lo) mod p for values below 2p, by masked subtraction
+*/
+func (f *field) reduce(z, lo *fe, hi uint64) {
+	var d fe
+	var borrow uint64
+	for j := range lo {
+		d[j], borrow = bits.Sub64(lo[j], f.p[j], borrow)
+	}
+	// take the difference on a carry out (hi = 1) or without borrow
+	mask := -(hi | (borrow ^ 1))
+	for j := range lo {
+		z[j] = d[j]&mask | lo[j]&^mask
+	}
+}
+
+func (f *field) add(z, x, y *fe) {
+	var s fe
+	var carry uint64
+	for j := range s {
+		s[j], carry = bits.Add64(x[j], y[j], carry)
+	}
+	f.reduce(z, &s, carry)
+}
+
+func (f *field) sub(z, x, y *fe) {
+	var d fe
+	var borrow uint64
+	for j := range d {
+		d[j], borrow = bits.Sub64(x[j], y[j], borrow)
+	}
+	// add p back on a borrow
+	mask := -borrow
+	var carry uint64
+	for j := range d {
+		z[j], carry = bits.Add64(d[j], f.p[j]&mask, carry)
+	}
+}
+
+/*
+z = x^(p-2) = x^-1 (0 for x = 0), the exponent is public
+*/
+func (f *field) inv(z, x *fe) {
+	acc := f.one
+	for _, b := range f.exp {
+		for i := 7; i >= 0; i-- {
+			f.mul(&acc, &acc, &acc)
+			if b>>uint(i)&1 == 1 {
+				f.mul(&acc, &acc, x)
+			}
+		}
+	}
+	*z = acc
+}
+
+func (z *fe) isZero() uint64 {
+	acc := z[0] | z[1] | z[2] | z[3]
+	return ((acc | -acc) >> 63) ^ 1
+}
+
+/*
+z = x if mask is all ones, unchanged if mask is 0
+*/
+func (z *fe) selectIf(mask uint64, x *fe) {
+	for j := range z {
+		z[j] = z[j]&^mask | x[j]&mask
+	}
+}
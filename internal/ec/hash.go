@@ -0,0 +1,17 @@
+package ec
+
+import (
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/xmd"
+)
+
+/*
+hash_to_field (RFC 9380 section 5.2) into integers modulo the group order,
+with L = ceil((bitlen(N) + 128) / 8) bytes per element
+*/
+func (c *Curve) HashToScalar(msg, dst []byte) *big.Int {
+	L := (c.N.BitLen() + 128 + 7) / 8
+	e := new(big.Int).SetBytes(xmd.Expand(msg, dst, L))
+	return e.Mod(e, c.N)
+}
@@ -0,0 +1,41 @@
+package ec
+
+import (
+	"math/big"
+)
+
+/*
+sum(k_i * p_i) with Straus' method: the scalars share the doublings and every
+point adds multiples from its own 4-bit window table, so n points cost one
+scalar multiplication's doublings plus about 15 + bitlen(k_i)/4 additions each.
+Zero windows are skipped, the time depends on the scalars - for public points
+and scalars only (batch verification). len(scalars) has to be len(points).
+*/
+func (c *Curve) MultiScalarMult(points []*Point, scalars []*big.Int) *Point {
+	ar := c.arithmetic()
+	tables := make([][16]projective, len(points))
+	digits := make([][]byte, len(points))
+	for i, p := range points {
+		ar.table(&tables[i], ar.projective(p))
+		digits[i] = c.scalarBytes(scalars[i], ar.width)
+	}
+
+	acc := ar.identity()
+	started := false
+	for j := 0; j < ar.width; j++ {
+		for _, shift := range [2]uint{4, 0} {
+			if started {
+				for d := 0; d < 4; d++ {
+					ar.double(&acc, &acc)
+				}
+			}
+			for i := range tables {
+				if w := digits[i][j] >> shift & 15; w != 0 {
+					ar.add(&acc, &acc, &tables[i][w])
+					started = true
+				}
+			}
+		}
+	}
+	return ar.affine(&acc)
+}
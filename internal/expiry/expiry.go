@@ -0,0 +1,69 @@
+/*
+Time-ordered queue of expiring keys for the replay caches of the module.
+
+The caches keep a map of the keys they have seen and push every key here with
+its expiry. Pruning pops the expired keys from the front of a min-heap, so it
+costs O(log n) per expired key instead of a sweep over the whole map on every
+insertion.
+*/
+package expiry
+
+import (
+	"container/heap"
+	"time"
+)
+
+/*
+Keys ordered by expiry, the zero value is an empty queue. Not safe for
+concurrent use, the caches call it under their own lock.
+*/
+type Queue struct {
+	entries entries
+}
+
+type entry struct {
+	key     string
+	expires time.Time
+}
+
+/*
+Add the key expiring at expires. A key pushed twice is popped twice.
+*/
+func (q *Queue) Push(key string, expires time.Time) {
+	heap.Push(&q.entries, entry{key, expires})
+}
+
+/*
+Pop every key which expired before now, in the order of expiry. The caller
+removes the key from its map, after checking that the key wasn't renewed.
+*/
+func (q *Queue) Expire(now time.Time, expired func(key string)) {
+	for len(q.entries) > 0 && now.After(q.entries[0].expires) {
+		expired(heap.Pop(&q.entries).(entry).key)
+	}
+}
+
+func (q *Queue) Len() int {
+	return len(q.entries)
+}
+
+/*
+heap.Interface, the earliest expiry first
+*/
+type entries []entry
+
+func (e entries) Len() int           { return len(e) }
+func (e entries) Less(i, j int) bool { return e[i].expires.Before(e[j].expires) }
+func (e entries) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+func (e *entries) Push(x interface{}) {
+	*e = append(*e, x.(entry))
+}
+
+func (e *entries) Pop() interface{} {
+	old := *e
+	last := old[len(old)-1]
+	old[len(old)-1] = entry{}
+	*e = old[:len(old)-1]
+	return last
+}
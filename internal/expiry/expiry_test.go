@@ -0,0 +1,27 @@
+package expiry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpire(t *testing.T) {
+	var q Queue
+	start := time.Unix(1700000000, 0)
+	// pushed out of order
+	for _, i := range []int{3, 1, 4, 0, 2} {
+		q.Push(fmt.Sprint(i), start.Add(time.Duration(i)*time.Second))
+	}
+
+	var expired []string
+	q.Expire(start.Add(2*time.Second), func(key string) { expired = append(expired, key) })
+	if fmt.Sprint(expired) != "[0 1]" || q.Len() != 3 {
+		t.Fatalf("expired %v, %d left", expired, q.Len())
+	}
+	expired = nil
+	q.Expire(start.Add(time.Hour), func(key string) { expired = append(expired, key) })
+	if fmt.Sprint(expired) != "[2 3 4]" || q.Len() != 0 {
+		t.Fatalf("expired %v, %d left", expired, q.Len())
+	}
+}
@@ -0,0 +1,93 @@
+//go:build !schnorr_minimal || schnorr_secp256k1 || schnorr_p256
+
+package group
+
+import (
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/ec"
+	"github.com/miki799/schnorr-signature/internal/xmd"
+)
+
+/*
+Group of an elliptic curve, elements are encoded as compressed SEC1 points
+*/
+type Curve struct {
+	curve *ec.Curve
+}
+
+/*
+The underlying curve, for protocols which need its coordinates (e.g. BIP-340)
+*/
+func (g *Curve) Curve() *ec.Curve {
+	return g.curve
+}
+
+func (g *Curve) Name() string {
+	return g.curve.Name
+}
+
+func (g *Curve) Order() *big.Int {
+	return g.curve.N
+}
+
+func (g *Curve) ScalarBaseMult(k *big.Int) Element {
+	return g.curve.ScalarBaseMult(k)
+}
+
+func (g *Curve) ScalarMult(e Element, k *big.Int) Element {
+	return g.curve.ScalarMult(e.(*ec.Point), k)
+}
+
+/*
+Straus' method (ec.Curve.MultiScalarMult), variable time
+*/
+func (g *Curve) MultiScalarMult(elements []Element, scalars []*big.Int) Element {
+	points := make([]*ec.Point, len(elements))
+	for i, e := range elements {
+		points[i] = e.(*ec.Point)
+	}
+	return g.curve.MultiScalarMult(points, scalars)
+}
+
+func (g *Curve) Add(a, b Element) Element {
+	return g.curve.Add(a.(*ec.Point), b.(*ec.Point))
+}
+
+func (g *Curve) Equal(a, b Element) bool {
+	return a.(*ec.Point).Equal(b.(*ec.Point))
+}
+
+func (g *Curve) Encode(e Element) ([]byte, error) {
+	return g.curve.MarshalCompressed(e.(*ec.Point))
+}
+
+func (g *Curve) AppendEncode(dst []byte, e Element) ([]byte, error) {
+	return g.curve.AppendCompressed(dst, e.(*ec.Point))
+}
+
+func (g *Curve) AppendScalarBaseMult(dst []byte, k *big.Int) ([]byte, error) {
+	return g.curve.AppendScalarBaseMult(dst, k)
+}
+
+func (g *Curve) AppendDoubleScalarMult(dst []byte, s *big.Int, X Element, e *big.Int) ([]byte, error) {
+	return g.curve.AppendDoubleScalarMult(dst, s, X.(*ec.Point), e)
+}
+
+func (g *Curve) Decode(b []byte) (Element, error) {
+	p, err := g.curve.UnmarshalCompressed(b)
+	if err != nil {
+		return nil, ErrInvalidElement
+	}
+	return p, nil
+}
+
+func (g *Curve) hash(dst, msg []byte) Element {
+	c := g.curve
+	for counter := byte(0); ; counter++ {
+		x := new(big.Int).SetBytes(xmd.Expand(append([]byte{counter}, msg...), dst, c.ByteLen()+16))
+		if p, err := c.LiftX(x.Mod(x, c.P)); err == nil {
+			return p
+		}
+	}
+}
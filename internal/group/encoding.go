@@ -0,0 +1,157 @@
+package group
+
+import (
+	"encoding/binary"
+	"math/big"
+	"sync/atomic"
+)
+
+/*
+Identifiers of the groups in key encodings. A mod p group not built in is
+encoded with its parameters: Explicit || len(p) || p || len(g) || g (2 byte
+lengths). 0x0001 belonged to parameters of the withdrawn additive scheme and
+is never reused.
+*/
+const (
+	Explicit    uint16 = 0x0000
+	IDMODP2048  uint16 = 0x0002
+	IDSecp256k1 uint16 = 0x0003
+	IDP256      uint16 = 0x0004
+)
+
+/*
+Largest modulus of explicit groups accepted by ReadGroup. Decoding an element
+tests its membership with an exponentiation modulo p, whose cost grows with
+the cube of the size of p.
+*/
+const MaxExplicitBits = 4096
+
+/*
+Explicit groups are accepted only after AllowExplicit(true), keys and
+messages from untrusted sources have to name a built-in group
+*/
+var explicitGroups atomic.Bool
+
+func AllowExplicit(allow bool) {
+	explicitGroups.Store(allow)
+}
+
+var (
+	// RFC 3526, 2048-bit MODP group, p = 2q + 1, g = 2 generates the subgroup of order q
+	modp2048 = newModP("modp-2048", hexInt(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+			"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+			"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05"+
+			"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB"+
+			"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+			"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718"+
+			"3995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF"), big.NewInt(2))
+)
+
+/*
+Built-in groups by ID. The curves are added by their files (secp256k1.go,
+p256.go) in init, so builds with the schnorr_minimal tag and without the tags
+of the curves don't link the curve arithmetic.
+*/
+var builtin = map[uint16]Group{IDMODP2048: modp2048}
+
+func hexInt(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("group: invalid constant " + s)
+	}
+	return n
+}
+
+/*
+RFC 3526 group 14
+*/
+func MODP2048() *ModP {
+	return modp2048
+}
+
+/*
+Built-in group with the ID
+*/
+func Builtin(id uint16) (Group, bool) {
+	g, ok := builtin[id]
+	return g, ok
+}
+
+/*
+ID of the built-in group, false for other groups
+*/
+func BuiltinID(g Group) (uint16, bool) {
+	for id, builtin := range builtin {
+		if Same(builtin, g) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+/*
+ID of a built-in group, or Explicit followed by the parameters of any other
+mod p group. Curves other than the built-in ones can't be encoded.
+*/
+func AppendGroup(buf []byte, g Group) ([]byte, error) {
+	if id, ok := BuiltinID(g); ok {
+		return binary.BigEndian.AppendUint16(buf, id), nil
+	}
+	m, ok := g.(*ModP)
+	if !ok {
+		return nil, ErrUnknownGroup
+	}
+	buf = binary.BigEndian.AppendUint16(buf, Explicit)
+	for _, n := range []*big.Int{m.p, m.g} {
+		b := n.Bytes()
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(b)))
+		buf = append(buf, b...)
+	}
+	return buf, nil
+}
+
+/*
+Read the group encoded with AppendGroup, returns the remaining bytes.
+Explicit groups fail with ErrExplicitGroup unless allowed (see AllowExplicit),
+and with ErrGroupTooLarge above MaxExplicitBits. Their structure isn't
+validated.
+*/
+func ReadGroup(b []byte) (Group, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, ErrInvalidElement
+	}
+	id := binary.BigEndian.Uint16(b)
+	b = b[2:]
+	if id != Explicit {
+		g, ok := Builtin(id)
+		if !ok {
+			return nil, nil, ErrUnknownGroup
+		}
+		return g, b, nil
+	}
+	if !explicitGroups.Load() {
+		return nil, nil, ErrExplicitGroup
+	}
+
+	var ints [2]*big.Int
+	for i := range ints {
+		if len(b) < 2 {
+			return nil, nil, ErrInvalidElement
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+n {
+			return nil, nil, ErrInvalidElement
+		}
+		if n > MaxExplicitBits/8 {
+			return nil, nil, ErrGroupTooLarge
+		}
+		ints[i], b = new(big.Int).SetBytes(b[2:2+n]), b[2+n:]
+	}
+	p, g := ints[0], ints[1]
+	if p.BitLen() < 2 || p.Bit(0) == 0 || g.Cmp(one) <= 0 || g.Cmp(p) >= 0 {
+		return nil, nil, ErrInvalidElement
+	}
+	return NewModP(p, g), b, nil
+}
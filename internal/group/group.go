@@ -0,0 +1,130 @@
+/*
+Prime order groups the signature scheme works in.
+
+Two kinds of groups are provided: elliptic curve groups (secp256k1, P-256)
+and the subgroup of prime order q of the integers modulo a safe prime
+p = 2q + 1. Both are written additively: Add is the group operation (point
+addition, multiplication modulo p) and ScalarMult its repetition (scalar
+multiplication, exponentiation modulo p), so the scheme and the protocols
+built on it are written once for every group. The discrete logarithm is hard
+in all of them, for the mod p groups only with p of at least 2048 bits.
+
+The package is shared by the schnorr package (keys, signing, protocols) and
+the verifier package, which can't import schnorr.
+*/
+package group
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrInvalidElement = errors.New("schnorr: invalid group element encoding")
+	ErrUnknownGroup   = errors.New("schnorr: unknown group")
+	ErrExplicitGroup  = errors.New("schnorr: explicit group parameters not accepted")
+	ErrGroupTooLarge  = errors.New("schnorr: explicit group modulus too large")
+)
+
+/*
+Element of a Group, the concrete type is chosen by the group (*ec.Point for
+the curves, *big.Int for the mod p groups)
+*/
+type Element interface{}
+
+type Group interface {
+	Name() string
+	Order() *big.Int
+	ScalarBaseMult(k *big.Int) Element
+	ScalarMult(e Element, k *big.Int) Element
+	Add(a, b Element) Element
+	Equal(a, b Element) bool
+	// Canonical encoding, Decode rejects the identity and everything Encode doesn't produce
+	Encode(e Element) ([]byte, error)
+	Decode(b []byte) (Element, error)
+}
+
+/*
+Byte length of the scalars of the group
+*/
+func ScalarLen(g Group) int {
+	return (g.Order().BitLen() + 7) / 8
+}
+
+/*
+-e, computed as (q - 1) * e
+*/
+func Neg(g Group, e Element) Element {
+	return g.ScalarMult(e, new(big.Int).Sub(g.Order(), big.NewInt(1)))
+}
+
+/*
+a - b
+*/
+func Sub(g Group, a, b Element) Element {
+	return g.Add(a, Neg(g, b))
+}
+
+/*
+Groups which compute and encode the elements of the signing and verification
+hot path into caller buffers instead of allocating them. The schnorr package
+and verifier.Verify use it when the group has it, the built-in groups do.
+*/
+type Appender interface {
+	// dst || Encode(e)
+	AppendEncode(dst []byte, e Element) ([]byte, error)
+	// dst || Encode(k*G), constant time with respect to k
+	AppendScalarBaseMult(dst []byte, k *big.Int) ([]byte, error)
+	// dst || Encode(s*G + e*X), variable time, for public values only
+	AppendDoubleScalarMult(dst []byte, s *big.Int, X Element, e *big.Int) ([]byte, error)
+}
+
+/*
+Groups with a multi-scalar multiplication faster than adding up ScalarMults.
+Variable time, for public elements and scalars only.
+*/
+type MultiScalarMulter interface {
+	MultiScalarMult(elements []Element, scalars []*big.Int) Element
+}
+
+/*
+sum(k_i * e_i), with the group's MultiScalarMult if it has one, nil for no
+elements. len(scalars) has to be len(elements).
+*/
+func MultiScalarMult(g Group, elements []Element, scalars []*big.Int) Element {
+	if m, ok := g.(MultiScalarMulter); ok && len(elements) > 0 {
+		return m.MultiScalarMult(elements, scalars)
+	}
+	var sum Element
+	for i, e := range elements {
+		term := g.ScalarMult(e, scalars[i])
+		if sum == nil {
+			sum = term
+		} else {
+			sum = g.Add(sum, term)
+		}
+	}
+	return sum
+}
+
+/*
+Same groups: the same instance or groups with the same name and equal
+generators (e.g. a mod p group decoded from a key and the registered one)
+*/
+func Same(a, b Group) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	if a.Name() != b.Name() || a.Order().Cmp(b.Order()) != 0 {
+		return false
+	}
+	ga, err := a.Encode(a.ScalarBaseMult(big.NewInt(1)))
+	if err != nil {
+		return false
+	}
+	gb, err := b.Encode(b.ScalarBaseMult(big.NewInt(1)))
+	return err == nil && string(ga) == string(gb)
+}
@@ -0,0 +1,35 @@
+package group
+
+import (
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/xmd"
+)
+
+/*
+Element of the group derived from the message, nobody knows its discrete
+logarithm to the generator (as needed e.g. for the second generator of a
+Pedersen commitment or the info element of partially blind signatures).
+
+Mod p groups square a wide hash (squares modulo a safe prime are exactly the
+subgroup of order q), curves hash to the x coordinate until it lifts to a
+point (try and increment, both curves have cofactor 1). dst separates the
+uses of the function. nil for groups of other types.
+*/
+func HashToElement(g Group, dst, msg []byte) Element {
+	if h, ok := g.(interface{ hash(dst, msg []byte) Element }); ok {
+		return h.hash(dst, msg)
+	}
+	return nil
+}
+
+func (m *ModP) hash(dst, msg []byte) Element {
+	for counter := byte(0); ; counter++ {
+		e := new(big.Int).SetBytes(xmd.Expand(append([]byte{counter}, msg...), dst, m.size+16))
+		e.Mod(e, m.p)
+		e.Exp(e, big.NewInt(2), m.p)
+		if e.Cmp(one) > 0 {
+			return e
+		}
+	}
+}
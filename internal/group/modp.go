@@ -0,0 +1,227 @@
+package group
+
+import (
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+/*
+Subgroup of prime order q = (p - 1) / 2 of the integers modulo the safe prime
+p, generated by g. Elements are *big.Int in (1, p) with e^q = 1 mod p, the
+identity is 1. Elements are encoded big endian with the byte length of p.
+
+The structure (p = 2q + 1 with p and q prime, g of order q) isn't checked by
+NewModP, it takes primality tests and is done once by the owner of the
+parameters (schnorr.GroupParams.Validate). Decode checks the membership of
+every decoded element.
+Exponentiation is constant time with respect to the exponent, multiplication,
+encoding and the membership test use math/big and are meant for public values.
+*/
+type ModP struct {
+	name    string
+	p, q, g *big.Int
+	size    int
+}
+
+var one = big.NewInt(1)
+
+/*
+Group of the parameters, named "modp-2048" for RFC 3526 group 14 and "modp"
+for any other parameters
+*/
+func NewModP(p, g *big.Int) *ModP {
+	if p.Cmp(modp2048.p) == 0 && g.Cmp(modp2048.g) == 0 {
+		return modp2048
+	}
+	return newModP("modp", p, g)
+}
+
+func newModP(name string, p, g *big.Int) *ModP {
+	p, g = new(big.Int).Set(p), new(big.Int).Set(g)
+	return &ModP{name: name, p: p, q: new(big.Int).Rsh(p, 1), g: g, size: (p.BitLen() + 7) / 8}
+}
+
+func (m *ModP) Name() string {
+	return m.name
+}
+
+/*
+q, must not be modified
+*/
+func (m *ModP) Order() *big.Int {
+	return m.q
+}
+
+func (m *ModP) P() *big.Int {
+	return new(big.Int).Set(m.p)
+}
+
+func (m *ModP) G() *big.Int {
+	return new(big.Int).Set(m.g)
+}
+
+func (m *ModP) Q() *big.Int {
+	return new(big.Int).Set(m.q)
+}
+
+/*
+g^k mod p
+*/
+func (m *ModP) ScalarBaseMult(k *big.Int) Element {
+	return m.exp(m.g, k)
+}
+
+/*
+e^k mod p
+*/
+func (m *ModP) ScalarMult(e Element, k *big.Int) Element {
+	x, ok := e.(*big.Int)
+	if !ok {
+		return new(big.Int)
+	}
+	return m.exp(x, k)
+}
+
+/*
+Constant time with respect to the exponent (modp.Scratch.Exp)
+*/
+func (m *ModP) exp(x, k *big.Int) *big.Int {
+	// exponents live in Z_q, negative ones included
+	if k.Sign() < 0 || k.Cmp(m.q) >= 0 {
+		k = new(big.Int).Mod(k, m.q)
+	}
+	if x.Sign() < 0 || x.Cmp(m.p) >= 0 {
+		x = new(big.Int).Mod(x, m.p)
+	}
+	sc := modp.Get()
+	defer modp.Put(sc)
+	return sc.Exp(new(big.Int), x, k, m.p)
+}
+
+/*
+prod(e_i^k_i) mod p with Straus' method (modp.Scratch.MultiExp), variable time
+*/
+func (m *ModP) MultiScalarMult(elements []Element, scalars []*big.Int) Element {
+	xs := make([]*big.Int, len(elements))
+	ks := make([]*big.Int, len(scalars))
+	for i, e := range elements {
+		x, ok := e.(*big.Int)
+		if !ok {
+			return new(big.Int)
+		}
+		if x.Sign() < 0 || x.Cmp(m.p) >= 0 {
+			x = new(big.Int).Mod(x, m.p)
+		}
+		k := scalars[i]
+		if k.Sign() < 0 || k.Cmp(m.q) >= 0 {
+			k = new(big.Int).Mod(k, m.q)
+		}
+		xs[i], ks[i] = x, k
+	}
+	sc := modp.Get()
+	defer modp.Put(sc)
+	return sc.MultiExp(new(big.Int), xs, ks, m.p)
+}
+
+/*
+a * b mod p
+*/
+func (m *ModP) Add(a, b Element) Element {
+	x, ok1 := a.(*big.Int)
+	y, ok2 := b.(*big.Int)
+	if !ok1 || !ok2 {
+		return new(big.Int)
+	}
+	z := new(big.Int).Mul(x, y)
+	return z.Mod(z, m.p)
+}
+
+func (m *ModP) Equal(a, b Element) bool {
+	x, ok1 := a.(*big.Int)
+	y, ok2 := b.(*big.Int)
+	return ok1 && ok2 && x.Cmp(y) == 0
+}
+
+/*
+Fixed length big endian encoding, the identity (and non-elements such as the
+zero returned for foreign element types) can't be encoded
+*/
+func (m *ModP) Encode(e Element) ([]byte, error) {
+	x, ok := e.(*big.Int)
+	if !ok || x.Cmp(one) <= 0 || x.Cmp(m.p) >= 0 {
+		return nil, ErrInvalidElement
+	}
+	return m.appendElement(nil, x), nil
+}
+
+func (m *ModP) AppendEncode(dst []byte, e Element) ([]byte, error) {
+	x, ok := e.(*big.Int)
+	if !ok || x.Cmp(one) <= 0 || x.Cmp(m.p) >= 0 {
+		return dst, ErrInvalidElement
+	}
+	return m.appendElement(dst, x), nil
+}
+
+/*
+dst || Encode(g^k), constant time with respect to k (modp.Scratch.Exp)
+*/
+func (m *ModP) AppendScalarBaseMult(dst []byte, k *big.Int) ([]byte, error) {
+	if k.Sign() < 0 || k.Cmp(m.q) >= 0 {
+		k = new(big.Int).Mod(k, m.q)
+	}
+	sc := modp.Get()
+	defer modp.Put(sc)
+	return m.AppendEncode(dst, sc.Exp(&sc.C, m.g, k, m.p))
+}
+
+/*
+dst || Encode(g^s * X^e) (modp.Scratch.Exp2), variable time
+*/
+func (m *ModP) AppendDoubleScalarMult(dst []byte, s *big.Int, X Element, e *big.Int) ([]byte, error) {
+	x, ok := X.(*big.Int)
+	if !ok || x.Sign() < 0 || x.Cmp(m.p) >= 0 {
+		return dst, ErrInvalidElement
+	}
+	if s.Sign() < 0 || s.Cmp(m.q) >= 0 {
+		s = new(big.Int).Mod(s, m.q)
+	}
+	if e.Sign() < 0 || e.Cmp(m.q) >= 0 {
+		e = new(big.Int).Mod(e, m.q)
+	}
+	sc := modp.Get()
+	defer modp.Put(sc)
+	return m.AppendEncode(dst, sc.Exp2(&sc.C, m.g, s, x, e, m.p))
+}
+
+func (m *ModP) appendElement(dst []byte, x *big.Int) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, m.size)...)
+	x.FillBytes(dst[n:])
+	return dst
+}
+
+/*
+Element of the encoding, rejects everything outside of (1, p) and outside of
+the subgroup of order q
+*/
+func (m *ModP) Decode(b []byte) (Element, error) {
+	if len(b) != m.size {
+		return nil, ErrInvalidElement
+	}
+	x := new(big.Int).SetBytes(b)
+	if !m.Contains(x) {
+		return nil, ErrInvalidElement
+	}
+	return x, nil
+}
+
+/*
+1 < x < p and x^q = 1 mod p
+*/
+func (m *ModP) Contains(x *big.Int) bool {
+	if x == nil || x.Cmp(one) <= 0 || x.Cmp(m.p) >= 0 {
+		return false
+	}
+	return new(big.Int).Exp(x, m.q, m.p).Cmp(one) == 0
+}
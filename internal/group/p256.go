@@ -0,0 +1,15 @@
+//go:build !schnorr_minimal || schnorr_p256
+
+package group
+
+import "github.com/miki799/schnorr-signature/internal/ec"
+
+var p256 = &Curve{ec.P256()}
+
+func init() {
+	builtin[IDP256] = p256
+}
+
+func P256() *Curve {
+	return p256
+}
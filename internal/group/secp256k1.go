@@ -0,0 +1,15 @@
+//go:build !schnorr_minimal || schnorr_secp256k1
+
+package group
+
+import "github.com/miki799/schnorr-signature/internal/ec"
+
+var secp256k1 = &Curve{ec.Secp256k1()}
+
+func init() {
+	builtin[IDSecp256k1] = secp256k1
+}
+
+func Secp256k1() *Curve {
+	return secp256k1
+}
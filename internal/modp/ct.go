@@ -0,0 +1,487 @@
+package modp
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+/*
+Constant-time arithmetic modulo q for secret scalars
+
+math/big takes time depending on the values (normalized lengths, early exits),
+so secret scalars (private key, nonce) are handled as fixed-width little-endian
+64-bit limbs instead: n = ceil(bitlen(q) / 64) limbs, Montgomery multiplication
+(CIOS) and additions with masked final subtraction. Loop counts and memory
+accesses depend on n only. Values cross into math/big where they are public
+(s), at the API boundary (FillBytes of the key) and for the nonce, which the
+group multiplies the generator with.
+*/
+
+/*
+Montgomery constants of the last used modulus, R = 2^(64n)
+*/
+type montgomery struct {
+	p    big.Int
+	n    int
+	m    []uint64 // modulus limbs
+	minv uint64   // -m^-1 mod 2^64
+	r2   []uint64 // R^2 mod p
+	rmod []uint64 // R mod p
+	one  []uint64
+	diff []uint64 // difference buffer of reduce
+}
+
+/*
+Limb buffers of a single operation, n limbs each (t has n+2)
+*/
+type limbs struct {
+	x, r, c, g, s, u, v, w []uint64
+	t                      []uint64
+}
+
+func (sc *Scratch) setModulus(p *big.Int) *montgomery {
+	mt := &sc.mont
+	if !sc.setMontgomery(mt, p) {
+		return mt
+	}
+	n := mt.n
+	l := &sc.limbs
+	for _, buf := range []*[]uint64{&l.x, &l.r, &l.c, &l.g, &l.s, &l.u, &l.v, &l.w} {
+		*buf = make([]uint64, n)
+	}
+	l.t = make([]uint64, n+2)
+	return mt
+}
+
+/*
+Montgomery constants of p, false if mt already has them
+*/
+func (sc *Scratch) setMontgomery(mt *montgomery, p *big.Int) bool {
+	if mt.n != 0 && mt.p.Cmp(p) == 0 {
+		return false
+	}
+	mt.p.Set(p)
+	mt.n = (p.BitLen() + 63) / 64
+	n := mt.n
+	mt.m = make([]uint64, n)
+	sc.toLimbs(mt.m, p, n)
+
+	// Newton iteration for m0^-1 mod 2^64 (m0 odd), 6 steps double to 64 bits
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - mt.m[0]*inv
+	}
+	mt.minv = -inv
+
+	R := new(big.Int).Lsh(big.NewInt(1), uint(64*n))
+	mt.rmod = make([]uint64, n)
+	sc.toLimbs(mt.rmod, new(big.Int).Mod(R, p), n)
+	mt.r2 = make([]uint64, n)
+	sc.toLimbs(mt.r2, R.Mul(R, R).Mod(R, p), n)
+	mt.one = make([]uint64, n)
+	mt.one[0] = 1
+	mt.diff = make([]uint64, n)
+	return true
+}
+
+/*
+Limbs of 0 <= x < 2^(64n), through the fixed-length big-endian encoding
+*/
+func (sc *Scratch) toLimbs(dst []uint64, x *big.Int, n int) {
+	if cap(sc.Buf) < 8*n {
+		sc.Buf = make([]byte, 8*n)
+	}
+	buf := x.FillBytes(sc.Buf[:8*n])
+	sc.bytesToLimbs(dst, buf)
+	wipeBytes(buf)
+}
+
+/*
+Limbs of the big-endian buf of exactly 8*len(dst) bytes
+*/
+func (sc *Scratch) bytesToLimbs(dst []uint64, buf []byte) {
+	n := len(dst)
+	for i := 0; i < n; i++ {
+		var w uint64
+		for _, b := range buf[8*(n-1-i) : 8*(n-i)] {
+			w = w<<8 | uint64(b)
+		}
+		dst[i] = w
+	}
+}
+
+/*
+x = value of the limbs, through the fixed-length big-endian encoding
+*/
+func (sc *Scratch) fromLimbs(x *big.Int, src []uint64) *big.Int {
+	n := len(src)
+	if cap(sc.Buf) < 8*n {
+		sc.Buf = make([]byte, 8*n)
+	}
+	buf := sc.Buf[:8*n]
+	for i, w := range src {
+		for j := 0; j < 8; j++ {
+			buf[8*(n-1-i)+7-j] = byte(w >> (8 * j))
+		}
+	}
+	return x.SetBytes(buf)
+}
+
+/*
+a*b + c + d as (hi, lo)
+*/
+func madd(a, b, c, d uint64) (uint64, uint64) {
+	hi, lo := bits.Mul64(a, b)
+	var carry uint64
+	lo, carry = bits.Add64(lo, c, 0)
+	hi += carry
+	lo, carry = bits.Add64(lo, d, 0)
+	hi += carry
+	return hi, lo
+}
+
+/*
+dst = a*b*R^-1 mod p for a*b < p*R, dst may alias a or b
+*/
+func (mt *montgomery) mul(dst, a, b, t []uint64) {
+	n, m := mt.n, mt.m
+	for i := range t {
+		t[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		var C, carry uint64
+		for j := 0; j < n; j++ {
+			C, t[j] = madd(a[j], b[i], t[j], C)
+		}
+		t[n], carry = bits.Add64(t[n], C, 0)
+		t[n+1] = carry
+
+		q := t[0] * mt.minv
+		C, _ = madd(q, m[0], t[0], 0)
+		for j := 1; j < n; j++ {
+			C, t[j-1] = madd(q, m[j], t[j], C)
+		}
+		t[n-1], carry = bits.Add64(t[n], C, 0)
+		t[n] = t[n+1] + carry
+	}
+	mt.reduce(dst, t[:n], t[n])
+}
+
+/*
+dst = (hi*2^(64n) + lo) mod p for values below 2p, by masked subtraction
+*/
+func (mt *montgomery) reduce(dst, lo []uint64, hi uint64) {
+	var borrow uint64
+	for j := range lo {
+		mt.diff[j], borrow = bits.Sub64(lo[j], mt.m[j], borrow)
+	}
+	// take the difference on a carry out (hi = 1) or without borrow
+	mask := -(hi | (borrow ^ 1))
+	for j := range lo {
+		dst[j] = mt.diff[j]&mask | lo[j]&^mask
+	}
+}
+
+/*
+dst = a*b mod p for a*b < p*R
+*/
+func (mt *montgomery) mulMod(dst, a, b, t []uint64) {
+	mt.mul(dst, a, b, t)
+	mt.mul(dst, dst, mt.r2, t)
+}
+
+/*
+dst = a + b mod p for a, b < p
+*/
+func (mt *montgomery) addMod(dst, a, b []uint64) {
+	var carry uint64
+	for j := range a {
+		dst[j], carry = bits.Add64(a[j], b[j], carry)
+	}
+	mt.reduce(dst, dst, carry)
+}
+
+/*
+dst = OS2IP(buf) mod p for a big-endian buf of any length, Horner's scheme
+over n-limb blocks: acc = acc*R + block mod p
+*/
+func (sc *Scratch) reduceBytes(dst []uint64, buf []byte) {
+	mt, l := &sc.mont, &sc.limbs
+	n := mt.n
+	for i := range dst {
+		dst[i] = 0
+	}
+	// the first block takes the remainder of the length
+	first := len(buf) % (8 * n)
+	if first == 0 {
+		first = 8 * n
+	}
+	block := sc.blockBuf(n)
+	for start, end := 0, first; start < len(buf); start, end = end, end+8*n {
+		for i := range block {
+			block[i] = 0
+		}
+		copy(block[8*n-(end-start):], buf[start:end])
+		sc.bytesToLimbs(l.w, block)
+
+		// block mod p = (block * 1 * R^-1) * R^2 * R^-1, block < R
+		mt.mulMod(l.w, l.w, mt.one, l.t)
+		mt.mulMod(dst, dst, mt.rmod, l.t)
+		mt.addMod(dst, dst, l.w)
+	}
+	wipeBytes(block)
+	wipeLimbs(l.w)
+}
+
+func (sc *Scratch) blockBuf(n int) []byte {
+	if cap(sc.block) < 8*n {
+		sc.block = make([]byte, 8*n)
+	}
+	return sc.block[:8*n]
+}
+
+func isZero(a []uint64) bool {
+	var acc uint64
+	for _, w := range a {
+		acc |= w
+	}
+	return acc == 0
+}
+
+func wipeLimbs(a []uint64) {
+	for i := range a {
+		a[i] = 0
+	}
+}
+
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+/*
+Overwrite the words of x (up to their capacity) and set it to zero
+*/
+func Wipe(x *big.Int) {
+	words := x.Bits()
+	words = words[:cap(words)]
+	for i := range words {
+		words[i] = 0
+	}
+	x.SetInt64(0)
+}
+
+/*
+Nonce of Nonce, with the reduction modulo q in constant-time arithmetic.
+The nonce is stored into r, the key-derived intermediate values are wiped.
+q has to be odd.
+*/
+func (sc *Scratch) NonceTo(r, x *big.Int, aux []byte, m []byte, q *big.Int) {
+	sc.setModulus(q)
+	l := &sc.limbs
+
+	sc.prepareNonce(x, aux, m, q)
+	for counter := uint32(0); ; {
+		counter = sc.nonceWide(counter, q)
+		sc.reduceBytes(l.r, sc.wide)
+		if !isZero(l.r) {
+			break
+		}
+	}
+	sc.wipeNonce()
+
+	sc.fromLimbs(r, l.r)
+	wipeLimbs(l.r)
+	wipeBytes(sc.Buf[:cap(sc.Buf)])
+}
+
+/*
+Response s = r + c*x mod q of the signature, in constant-time arithmetic
+with respect to the private key x and the nonce r, 0 <= r, c, x < q and q odd.
+The secret intermediate values are wiped before returning.
+*/
+func (sc *Scratch) Response(s, r, c, x, q *big.Int) {
+	mt := sc.setModulus(q)
+	l := &sc.limbs
+	sc.toLimbs(l.r, r, mt.n)
+	sc.toLimbs(l.x, x, mt.n)
+	sc.toLimbs(l.c, c, mt.n)
+
+	mt.mulMod(l.v, l.c, l.x, l.t)
+	mt.addMod(l.s, l.r, l.v)
+	sc.fromLimbs(s, l.s)
+
+	for _, buf := range [][]uint64{l.x, l.r, l.v, l.s, l.t} {
+		wipeLimbs(buf)
+	}
+	wipeBytes(sc.Buf[:cap(sc.Buf)])
+}
+
+/*
+Buffers of Exp, with their own Montgomery constants: the group modulus p and
+the order q alternate in every signature
+*/
+type expContext struct {
+	mont           montgomery
+	x, acc, sel, t []uint64
+	table, table2  [16][]uint64 // table2 of the second base of Exp2
+}
+
+/*
+Exp buffers with the Montgomery constants of p, allocated when p changes
+*/
+func (sc *Scratch) expContext(p *big.Int) *expContext {
+	e := &sc.exp
+	if sc.setMontgomery(&e.mont, p) {
+		n := e.mont.n
+		for _, buf := range []*[]uint64{&e.x, &e.acc, &e.sel} {
+			*buf = make([]uint64, n)
+		}
+		for i := range e.table {
+			e.table[i] = make([]uint64, n)
+			e.table2[i] = make([]uint64, n)
+		}
+		e.t = make([]uint64, n+2)
+	}
+	return e
+}
+
+/*
+table[i] = x^i in Montgomery form, 0 <= x < p
+*/
+func (sc *Scratch) expTable(e *expContext, table *[16][]uint64, x *big.Int) {
+	mt := &e.mont
+	sc.toLimbs(e.x, x, mt.n)
+	mt.mul(e.x, e.x, mt.r2, e.t)
+	copy(table[0], mt.rmod)
+	for i := 1; i < len(table); i++ {
+		mt.mul(table[i], table[i-1], e.x, e.t)
+	}
+}
+
+/*
+z = x^k mod p in constant-time arithmetic with respect to the exponent k,
+0 <= x < p, 0 <= k < p and p odd. The exponent is processed in fixed 4-bit
+windows over the width of p with a masked table lookup, so the sequence of
+multiplications and the memory accesses depend on the width only.
+*/
+func (sc *Scratch) Exp(z, x, k, p *big.Int) *big.Int {
+	e := sc.expContext(p)
+	mt := &e.mont
+	n := mt.n
+	sc.expTable(e, &e.table, x)
+
+	kb := k.FillBytes(sc.blockBuf(n))
+	copy(e.acc, mt.rmod)
+	for _, b := range kb {
+		for _, w := range [2]byte{b >> 4, b & 15} {
+			for i := 0; i < 4; i++ {
+				mt.mul(e.acc, e.acc, e.acc, e.t)
+			}
+			wipeLimbs(e.sel)
+			for i, entry := range e.table {
+				d := uint64(byte(i) ^ w)
+				mask := ((d | -d) >> 63) - 1
+				for j := range e.sel {
+					e.sel[j] |= entry[j] & mask
+				}
+			}
+			mt.mul(e.acc, e.acc, e.sel, e.t)
+		}
+	}
+	mt.mul(e.acc, e.acc, mt.one, e.t)
+	sc.fromLimbs(z, e.acc)
+
+	wipeBytes(kb)
+	for _, buf := range [][]uint64{e.acc, e.sel, e.t} {
+		wipeLimbs(buf)
+	}
+	return z
+}
+
+/*
+z = x^k * y^l mod p with Straus' method (see MultiExp) in the buffers of Exp,
+0 <= x, y < p, k, l >= 0 and p odd. Variable time, for public values only
+(signature verification). Doesn't allocate once the Scratch has the buffers
+for p.
+*/
+func (sc *Scratch) Exp2(z, x, k, y, l, p *big.Int) *big.Int {
+	e := sc.expContext(p)
+	mt := &e.mont
+	sc.expTable(e, &e.table, x)
+	sc.expTable(e, &e.table2, y)
+
+	width := k.BitLen()
+	if l.BitLen() > width {
+		width = l.BitLen()
+	}
+	copy(e.acc, mt.rmod)
+	for bit := (width+3)/4*4 - 4; bit >= 0; bit -= 4 {
+		for i := 0; i < 4; i++ {
+			mt.mul(e.acc, e.acc, e.acc, e.t)
+		}
+		if w := window(k, bit); w != 0 {
+			mt.mul(e.acc, e.acc, e.table[w], e.t)
+		}
+		if w := window(l, bit); w != 0 {
+			mt.mul(e.acc, e.acc, e.table2[w], e.t)
+		}
+	}
+	mt.mul(e.acc, e.acc, mt.one, e.t)
+	return sc.fromLimbs(z, e.acc)
+}
+
+/*
+Bits bit to bit+3 of k
+*/
+func window(k *big.Int, bit int) uint {
+	return k.Bit(bit) | k.Bit(bit+1)<<1 | k.Bit(bit+2)<<2 | k.Bit(bit+3)<<3
+}
+
+/*
+z = prod(x_i^k_i) mod p with Straus' method: the exponents share the
+squarings and every base multiplies in powers from its own 4-bit window
+table. 0 <= x_i < p, k_i >= 0 and p odd. Zero windows are skipped and the
+loop follows the longest exponent, the time depends on the exponents - for
+public values only (batch verification).
+*/
+func (sc *Scratch) MultiExp(z *big.Int, xs, ks []*big.Int, p *big.Int) *big.Int {
+	var mt montgomery
+	sc.setMontgomery(&mt, p)
+	n := mt.n
+	t := make([]uint64, n+2)
+
+	// tables[i][w] = x_i^w in Montgomery form, w >= 1
+	tables := make([][16][]uint64, len(xs))
+	for i, x := range xs {
+		table := &tables[i]
+		table[1] = make([]uint64, n)
+		sc.toLimbs(table[1], x, n)
+		mt.mul(table[1], table[1], mt.r2, t)
+		for w := 2; w < len(table); w++ {
+			table[w] = make([]uint64, n)
+			mt.mul(table[w], table[w-1], table[1], t)
+		}
+	}
+
+	width := 0
+	for _, k := range ks {
+		if k.BitLen() > width {
+			width = k.BitLen()
+		}
+	}
+	acc := append([]uint64(nil), mt.rmod...)
+	for bit := (width+3)/4*4 - 4; bit >= 0; bit -= 4 {
+		for i := 0; i < 4; i++ {
+			mt.mul(acc, acc, acc, t)
+		}
+		for i, k := range ks {
+			if w := window(k, bit); w != 0 {
+				mt.mul(acc, acc, tables[i][w], t)
+			}
+		}
+	}
+	mt.mul(acc, acc, mt.one, t)
+	return sc.fromLimbs(z, acc)
+}
@@ -0,0 +1,160 @@
+/*
+Allocation-free arithmetic modulo the group order q for the signing and
+verification hot path.
+
+Temporary values live in a Scratch taken from a pool, so the scalar part of
+signing and verification doesn't allocate: reductions use Barrett's method
+(multiplications and shifts only, math/big division allocates internally) with
+the constant cached for the last used modulus, and the challenge input is
+built in reused buffers. Group operations are done by the groups (internal/group).
+*/
+package modp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"sync"
+)
+
+/*
+Temporary values of a single operation, A, B, C and Buf are free for the caller.
+Values returned by Scratch methods stay valid until the next method call.
+*/
+type Scratch struct {
+	A, B, C big.Int
+	Buf     []byte
+	Input   []byte // nonce input built by the caller, see Nonce
+
+	c, q, r, t big.Int
+	barrett    barrett
+	input      []byte
+	wide       []byte
+
+	// constant-time signing, see ct.go
+	mont  montgomery
+	limbs limbs
+	opad  [hmacBlock]byte
+	block []byte
+	exp   expContext
+}
+
+var pool = sync.Pool{New: func() interface{} { return new(Scratch) }}
+
+func Get() *Scratch {
+	return pool.Get().(*Scratch)
+}
+
+func Put(sc *Scratch) {
+	pool.Put(sc)
+}
+
+/*
+Barrett reduction constant mu = floor(4^k / p), k = bitlen(p)
+*/
+type barrett struct {
+	p  big.Int
+	mu big.Int
+	k  uint
+}
+
+/*
+x mod m in place, x has to be non-negative
+*/
+func (sc *Scratch) Mod(x, m *big.Int) *big.Int {
+	b := &sc.barrett
+	if b.p.Cmp(m) != 0 {
+		b.set(m)
+	}
+	return sc.reduce(x, b)
+}
+
+func (b *barrett) set(m *big.Int) {
+	b.p.Set(m)
+	b.k = uint(m.BitLen())
+	b.mu.Lsh(big.NewInt(1), 2*b.k)
+	b.mu.Quo(&b.mu, m)
+}
+
+/*
+Modulus with its precomputed Barrett constant, for callers reducing modulo the
+same value across many operations (e.g. verifying with one key), so neither
+the comparison with nor the recomputation of the Scratch's cached constant is paid
+*/
+type Modulus struct {
+	b barrett
+}
+
+func NewModulus(m *big.Int) *Modulus {
+	mod := &Modulus{}
+	mod.b.set(m)
+	return mod
+}
+
+func (mod *Modulus) Int() *big.Int {
+	return &mod.b.p
+}
+
+/*
+x mod m in place, see Mod
+*/
+func (sc *Scratch) ModBy(x *big.Int, mod *Modulus) *big.Int {
+	return sc.reduce(x, &mod.b)
+}
+
+func (sc *Scratch) reduce(x *big.Int, b *barrett) *big.Int {
+	m := &b.p
+	if x.Sign() < 0 || uint(x.BitLen()) > 2*b.k {
+		// outside of the Barrett range, e.g. non-canonical input
+		sc.q.QuoRem(x, m, &sc.r)
+		x.Set(&sc.r)
+		if x.Sign() < 0 {
+			x.Add(x, m)
+		}
+		return x
+	}
+
+	// q = ((x >> (k-1)) * mu) >> (k+1),  x - q*m < 3m
+	sc.t.Rsh(x, b.k-1)
+	sc.q.Mul(&sc.t, &b.mu)
+	sc.q.Rsh(&sc.q, b.k+1)
+	sc.t.Mul(&sc.q, m)
+	x.Sub(x, &sc.t)
+	for x.Cmp(m) >= 0 {
+		x.Sub(x, m)
+	}
+	return x
+}
+
+/*
+Fiat-Shamir challenge, see verifier.TaggedChallenge for the construction,
+"" is the untagged challenge of verifier.Challenge
+*/
+func (sc *Scratch) Challenge(tag string, R []byte, m string, q *big.Int) *big.Int {
+	return sc.Mod(sc.challengeWide(tag, R, m, q), q)
+}
+
+/*
+Challenge reduced modulo a precomputed modulus
+*/
+func (sc *Scratch) ChallengeBy(tag string, R []byte, m string, q *Modulus) *big.Int {
+	return sc.ModBy(sc.challengeWide(tag, R, m, &q.b.p), q)
+}
+
+func (sc *Scratch) challengeWide(tag string, R []byte, m string, q *big.Int) *big.Int {
+	// 4 bytes for the counter, followed by [len(tag) || tag ||] R || m
+	sc.input = append(sc.input[:0], 0, 0, 0, 0)
+	if tag != "" {
+		sc.input = append(binary.BigEndian.AppendUint16(sc.input, uint16(len(tag))), tag...)
+	}
+	sc.input = append(append(sc.input, R...), m...)
+
+	sc.wide = sc.wide[:0]
+	for i := uint32(0); len(sc.wide)*8 < q.BitLen()+128; i++ {
+		binary.BigEndian.PutUint32(sc.input, i)
+		digest := sha256.Sum256(sc.input)
+		sc.wide = append(sc.wide, digest[:]...)
+	}
+
+	return sc.c.SetBytes(sc.wide)
+}
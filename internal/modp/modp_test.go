@@ -0,0 +1,104 @@
+package modp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+var (
+	// secp256k1 group order and RFC 3526 group 14 prime
+	q, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	p, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3BE39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+)
+
+func TestArithmetic(t *testing.T) {
+	sc := Get()
+	defer Put(sc)
+
+	x, _ := new(big.Int).SetString("c90fdaa22168c234c4c6628b80dc1cd129024e088a67cc74020bbea63b139b22514a08798e3404ddef9519b3cd3a431b302b0a6df25f14", 16)
+	if got, want := sc.Mod(new(big.Int).Set(x), q), new(big.Int).Mod(x, q); got.Cmp(want) != 0 {
+		t.Errorf("Mod %x, want %x", got, want)
+	}
+	if got, want := sc.ModBy(new(big.Int).Set(x), NewModulus(q)), new(big.Int).Mod(x, q); got.Cmp(want) != 0 {
+		t.Errorf("ModBy %x, want %x", got, want)
+	}
+
+	k := new(big.Int).Rsh(p, 3)
+	if got, want := sc.Exp(new(big.Int), big.NewInt(2), k, p), new(big.Int).Exp(big.NewInt(2), k, p); got.Cmp(want) != 0 {
+		t.Errorf("Exp %x, want %x", got, want)
+	}
+
+	// x^k * 3^(k/5) * 5^7 mod p, zero exponents and bases above the exponent width included
+	xs := []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(5), big.NewInt(7)}
+	ks := []*big.Int{k, new(big.Int).Div(k, big.NewInt(5)), big.NewInt(7), new(big.Int)}
+	want := big.NewInt(1)
+	for i := range xs {
+		want.Mul(want, new(big.Int).Exp(xs[i], ks[i], p)).Mod(want, p)
+	}
+	if got := sc.MultiExp(new(big.Int), xs, ks, p); got.Cmp(want) != 0 {
+		t.Errorf("MultiExp %x, want %x", got, want)
+	}
+
+	// s = r + c*x mod q
+	r, c, s := big.NewInt(7), big.NewInt(11), new(big.Int)
+	want = new(big.Int).Mul(c, x)
+	want.Add(want, r).Mod(want, q)
+	if sc.Response(s, r, c, new(big.Int).Mod(x, q), q); s.Cmp(want) != 0 {
+		t.Errorf("Response %x, want %x", s, want)
+	}
+
+	// first block of the challenge is SHA256(0x00000000 || R || m)
+	R := []byte{2, 3}
+	digest := sha256.Sum256([]byte("\x00\x00\x00\x00\x02\x03m"))
+	sc.challengeWide("", R, "m", q)
+	if len(sc.wide)*8 < q.BitLen()+128 || !bytes.Equal(sc.wide[:sha256.Size], digest[:]) {
+		t.Errorf("challenge input %x", sc.wide)
+	}
+
+	// the tag goes first: SHA256(0x00000000 || len(tag) || tag || R || m)
+	digest = sha256.Sum256([]byte("\x00\x00\x00\x00\x00\x03tag\x02\x03m"))
+	sc.challengeWide("tag", R, "m", q)
+	if !bytes.Equal(sc.wide[:sha256.Size], digest[:]) {
+		t.Errorf("tagged challenge input %x", sc.wide)
+	}
+}
+
+/*
+The scalar arithmetic of signing and verification doesn't allocate once the
+Scratch has its buffers
+*/
+func TestAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("pool drops values under the race detector")
+	}
+	R := make([]byte, 33)
+	x, r, s, z := big.NewInt(12345), new(big.Int), new(big.Int), new(big.Int)
+	k := new(big.Int).Rsh(p, 2)
+	mod := NewModulus(q)
+
+	for name, op := range map[string]func(){
+		"signing": func() {
+			sc := Get()
+			sc.NonceTo(r, x, []byte("aux"), []byte("message"), q)
+			sc.Response(s, r, sc.Challenge("", R, "message", q), x, q)
+			Put(sc)
+		},
+		"challenge": func() {
+			sc := Get()
+			sc.ChallengeBy("schnorr/tag", R, "message", mod)
+			Put(sc)
+		},
+		"exponentiation": func() {
+			sc := Get()
+			sc.Exp(z, big.NewInt(2), k, p)
+			Put(sc)
+		},
+	} {
+		op()
+		if allocs := testing.AllocsPerRun(20, op); allocs != 0 {
+			t.Errorf("%s: %v allocations", name, allocs)
+		}
+	}
+}
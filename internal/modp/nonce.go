@@ -0,0 +1,86 @@
+package modp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+)
+
+const hmacBlock = 64
+
+/*
+Deterministic nonce in [1, q) derived from the private key x, the message and
+optional auxiliary randomness, in the spirit of RFC 6979 and BIP-340:
+
+	K    = SHA256(I2OSP(x, len(q)))
+	r    = OS2IP(HMAC(K, 0x00000000 || SHA256(aux) || m) || HMAC(K, 0x00000001 || ...) || ...) mod q
+
+with at least bitlen(q) + 128 bits of HMAC output, so r is (computationally)
+uniform. Counter values continue if r happens to be zero. HMAC-SHA256 is
+computed on the scratch buffers, so the derivation doesn't allocate.
+*/
+func (sc *Scratch) Nonce(x *big.Int, aux []byte, m []byte, q *big.Int) *big.Int {
+	sc.prepareNonce(x, aux, m, q)
+	defer sc.wipeNonce()
+	for counter := uint32(0); ; {
+		counter = sc.nonceWide(counter, q)
+		if r := sc.Mod(sc.c.SetBytes(sc.wide), q); r.Sign() != 0 {
+			return r
+		}
+	}
+}
+
+/*
+HMAC pads keyed with K and the input ipad || counter || SHA256(aux) || m
+*/
+func (sc *Scratch) prepareNonce(x *big.Int, aux []byte, m []byte, q *big.Int) {
+	// hashed key, so keys of any size fit the HMAC block
+	n := (q.BitLen() + 7) / 8
+	if cap(sc.Buf) < n {
+		sc.Buf = make([]byte, n)
+	}
+	key := sha256.Sum256(x.FillBytes(sc.Buf[:n]))
+	wipeBytes(sc.Buf[:n])
+
+	var ipad [hmacBlock]byte
+	for i := range ipad {
+		ipad[i], sc.opad[i] = 0x36, 0x5c
+	}
+	for i, b := range key {
+		ipad[i] ^= b
+		sc.opad[i] ^= b
+	}
+	wipeBytes(key[:])
+
+	auxDigest := sha256.Sum256(aux)
+	sc.input = append(append(append(append(sc.input[:0], ipad[:]...), 0, 0, 0, 0), auxDigest[:]...), m...)
+	wipeBytes(ipad[:])
+}
+
+/*
+sc.wide = HMAC output blocks from counter on, returns the next counter
+*/
+func (sc *Scratch) nonceWide(counter uint32, q *big.Int) uint32 {
+	var outer [hmacBlock + sha256.Size]byte
+	copy(outer[:], sc.opad[:])
+	sc.wide = sc.wide[:0]
+	for len(sc.wide)*8 < q.BitLen()+128 {
+		binary.BigEndian.PutUint32(sc.input[hmacBlock:], counter)
+		counter++
+		inner := sha256.Sum256(sc.input)
+		copy(outer[hmacBlock:], inner[:])
+		digest := sha256.Sum256(outer[:])
+		sc.wide = append(sc.wide, digest[:]...)
+	}
+	wipeBytes(outer[:])
+	return counter
+}
+
+/*
+Scrub the key-derived pads and the HMAC output
+*/
+func (sc *Scratch) wipeNonce() {
+	wipeBytes(sc.input[:cap(sc.input)])
+	wipeBytes(sc.wide[:cap(sc.wide)])
+	wipeBytes(sc.opad[:])
+}
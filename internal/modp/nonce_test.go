@@ -0,0 +1,50 @@
+package modp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"testing"
+)
+
+/*
+Nonce and NonceTo against the construction written out with crypto/hmac
+*/
+func TestNonce(t *testing.T) {
+	x, _ := new(big.Int).SetString("0d004150d27c3bf2a42f312683d35fac7394b1e9e318249c1bfe7f0795a83114", 16)
+	for _, modulus := range []*big.Int{q, new(big.Int).Rsh(p, 1)} {
+		for _, aux := range [][]byte{nil, []byte("aux randomness")} {
+			want := referenceNonce(x, aux, "message", modulus)
+
+			sc := Get()
+			if got := sc.Nonce(x, aux, []byte("message"), modulus); got.Cmp(want) != 0 {
+				t.Errorf("Nonce %x, want %x", got, want)
+			}
+			r := new(big.Int)
+			if sc.NonceTo(r, x, aux, []byte("message"), modulus); r.Cmp(want) != 0 {
+				t.Errorf("NonceTo %x, want %x", r, want)
+			}
+			if other := sc.Nonce(x, aux, []byte("another message"), modulus); other.Cmp(want) == 0 {
+				t.Error("same nonce for another message")
+			}
+			Put(sc)
+		}
+	}
+}
+
+func referenceNonce(x *big.Int, aux []byte, m string, q *big.Int) *big.Int {
+	key := sha256.Sum256(x.FillBytes(make([]byte, (q.BitLen()+7)/8)))
+	auxDigest := sha256.Sum256(aux)
+
+	var wide []byte
+	for counter := uint32(0); len(wide)*8 < q.BitLen()+128; counter++ {
+		mac := hmac.New(sha256.New, key[:])
+		mac.Write(binary.BigEndian.AppendUint32(nil, counter))
+		mac.Write(auxDigest[:])
+		mac.Write([]byte(m))
+		wide = mac.Sum(wide)
+	}
+	r := new(big.Int).SetBytes(wide)
+	return r.Mod(r, q)
+}
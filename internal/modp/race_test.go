@@ -0,0 +1,6 @@
+//go:build race
+
+package modp
+
+// the race detector drops pooled values at random, pooled paths allocate
+const raceEnabled = true
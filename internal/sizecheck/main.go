@@ -0,0 +1,27 @@
+/*
+Smallest program using the schnorr package: signs and verifies one message in
+MODP-2048. CI builds it with the schnorr_minimal tag to check that the
+minimal build leaves the optional subsystems and the curves out.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func main() {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsMODP2048)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	signature, err := schnorr.TrySign("size check", sk)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(schnorr.VerifySignature("size check", signature, pk))
+}
@@ -0,0 +1,408 @@
+/*
+Interactive walkthrough of the Schnorr signature scheme used by the schnorr CLI
+(`schnorr tutorial`) and the demo program in the repository root.
+
+The tutorial computes every step itself with math/big, so all intermediate
+values, including the secret ones, can be shown. It checks its results with
+the verifier package, which is what the schnorr package verifies with. RunTraced
+additionally records every value as a machine-readable trace. Input
+is read line by line, an empty line (or the end of the input) picks the
+default, so the tutorial can also be run non-interactively.
+*/
+package tutorial
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+var ErrBits = errors.New("tutorial: group size must be between 16 and 1024 bits")
+
+/*
+Intermediate value of the protocol in the trace, one JSON object per line.
+Numbers are decimal strings, secret marks values only their owner may know
+(private key, nonces, blinding factors).
+*/
+type Event struct {
+	Seq    int    `json:"seq"`
+	Step   string `json:"step"` // group, keygen, sign, verify, tamper, blind
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+type tutorial struct {
+	in  *bufio.Scanner
+	out io.Writer
+	err error // first write error
+
+	trace *json.Encoder // nil if not tracing
+	step  string
+	seq   int
+
+	p, q, g *big.Int // group
+	modp    *group.ModP
+	x, X    *big.Int // key pair
+}
+
+/*
+Run the tutorial in a group with a random safe prime of the given size,
+small sizes (e.g. 64 bits) keep the numbers readable
+*/
+func Run(in io.Reader, out io.Writer, bits int) error {
+	return RunTraced(in, out, nil, bits)
+}
+
+/*
+Run the tutorial and write every intermediate value to trace as a JSON Event
+per line, e.g. for visualizations or checking other implementations
+*/
+func RunTraced(in io.Reader, out, trace io.Writer, bits int) error {
+	if bits < 16 || bits > 1024 {
+		return ErrBits
+	}
+	t := &tutorial{in: bufio.NewScanner(in), out: out}
+	if trace != nil {
+		t.trace = json.NewEncoder(trace)
+	}
+
+	t.group(bits)
+	t.keys()
+	m, signature := t.sign()
+	t.verify(m, signature)
+	t.tamper(m, signature)
+	m, signature = t.blind()
+	t.tamper(m, signature)
+
+	t.say("That's all. The schnorr package implements these steps, see Sign,")
+	t.say("VerifySignature, BlindSigner and BlindRequester.")
+	if t.err != nil {
+		return t.err
+	}
+	return t.in.Err()
+}
+
+func (t *tutorial) group(bits int) {
+	t.section("group", "1. The group")
+	t.p, t.q = safePrime(bits)
+	t.g = big.NewInt(4)
+	t.modp = group.NewModP(t.p, t.g)
+
+	t.say("All computations happen modulo a safe prime p = 2q + 1 (q prime too), in the")
+	t.say("group of the squares modulo p with multiplication. It has q elements and")
+	t.say("g = 4 = 2^2 generates it, every element is g^k mod p for some k < q.")
+	t.value("p", t.p)
+	t.value("q", t.q)
+	t.value("g", t.g)
+	t.say("Computing k from g^k (the discrete logarithm) is hard when p is large.")
+	t.say("The schnorr package uses a 2048-bit p or elliptic curve groups.")
+	t.pause()
+}
+
+func (t *tutorial) keys() {
+	t.section("keygen", "2. Key generation")
+	t.x = t.random()
+	t.X = t.exp(t.g, t.x)
+
+	t.say("The private key x is a random number below q, the public key is X = g^x mod p.")
+	t.secret("x", t.x)
+	t.value("X", t.X)
+	t.pause()
+}
+
+func (t *tutorial) sign() (string, *verifier.Signature) {
+	t.section("sign", "3. Signing")
+	m := t.ask("Message to sign", "hello")
+	t.record("m", m, false)
+
+	r := t.random()
+	R := t.exp(t.g, r)
+	c := t.challenge(R, m)
+	s := t.scalar(new(big.Int).Add(r, new(big.Int).Mul(c, t.x)))
+
+	t.say("The signer picks a fresh random nonce r and commits to it with R = g^r mod p.")
+	t.secret("r", r)
+	t.value("R", R)
+	t.say("The challenge binds the commitment to the message: c = H(R||m) mod q.")
+	t.value("c", c)
+	t.say("The response mixes the nonce with the private key: s = r + c*x mod q.")
+	t.value("s", s)
+	t.say("The signature is the pair (R, s). r must never be reused or revealed,")
+	t.say("otherwise x = (s - r) / c mod q can be computed.")
+	t.pause()
+	return m, t.signature(R, s)
+}
+
+func (t *tutorial) verify(m string, signature *verifier.Signature) {
+	t.section("verify", "4. Verification")
+	t.say("The verifier knows m, (R, s) and X. It recomputes c = H(R||m) and checks")
+	t.say("g^s == R * X^c mod p, which holds because g^s = g^(r + c*x) = g^r * (g^x)^c = R * X^c.")
+	t.check(m, signature, t.X)
+	t.pause()
+}
+
+/*
+Let the user change one of the inputs of the verification and explain the result
+*/
+func (t *tutorial) tamper(m string, signature *verifier.Signature) {
+	t.section("tamper", "Tampering")
+	for {
+		t.say("Change one of the inputs and verify again:")
+		t.say("  m - message, R - nonce commitment, s - response, X - public key")
+		choice := strings.ToLower(t.ask("What to change (empty to continue)", ""))
+
+		forged := &verifier.Signature{R: signature.R, S: signature.S}
+		R := new(big.Int).SetBytes(signature.R)
+		fm, fX := m, t.X
+		var why string
+		switch choice {
+		case "":
+			return
+		case "m":
+			fm = t.ask("New message", m+"!")
+			t.record("m", fm, false)
+			why = "c = H(R||m) changed with the message, so R * X^c moved while g^s stayed.\n" +
+				"Making them equal again requires s = r + c*x, i.e. knowing x."
+		case "r":
+			R = t.askInt("New R", t.next(R, t.p))
+			forged.R = R.FillBytes(make([]byte, len(signature.R)))
+			t.record("R", R.String(), false)
+			why = "R enters both the right side and the hash, so c changed as well.\n" +
+				"Any R works only with the matching s, which again requires x."
+		case "s":
+			forged.S = t.askInt("New s", t.next(signature.S, t.q))
+			t.record("s", forged.S.String(), false)
+			why = "g^s changed while R * X^c didn't. Only s = r + c*x mod q satisfies the equation."
+		case "x":
+			fX = t.askInt("New X", t.next(t.X, t.p))
+			t.record("X", fX.String(), false)
+			why = "The signature proves knowledge of log_g(X) for the original X only,\n" +
+				"so it doesn't verify under any other public key."
+		default:
+			t.say("Unknown choice %q.", choice)
+			continue
+		}
+		if !t.check(fm, forged, fX) {
+			t.say(why)
+		} else {
+			t.say("The change didn't alter the verified values (e.g. the same number was entered).")
+		}
+		t.pause()
+	}
+}
+
+func (t *tutorial) blind() (string, *verifier.Signature) {
+	t.section("blind", "5. Blind signing")
+	t.say("A blind signature is issued by the signer without seeing the message,")
+	t.say("and the signer can't later recognize the signature it helped to create.")
+	m := t.ask("Message the user wants signed", "vote: yes")
+	t.record("m", m, false)
+
+	t.say("\nSigner -> User: commitment to a fresh nonce, R = g^r.")
+	r := t.random()
+	R := t.exp(t.g, r)
+	t.secret("r", r)
+	t.value("R", R)
+
+	t.say("\nUser: picks blinding factors a, b and blinds the commitment,")
+	t.say("R' = R * g^a * X^b, c' = H(R'||m), c = c' + b. Only c is sent to the signer.")
+	a, b := t.random(), t.random()
+	RP := t.mul(t.mul(R, t.exp(t.g, a)), t.exp(t.X, b))
+	cp := t.challenge(RP, m)
+	c := t.scalar(new(big.Int).Add(cp, b))
+	t.secret("a", a)
+	t.secret("b", b)
+	t.value("R'", RP)
+	t.value("c'", cp)
+	t.value("c", c)
+	t.pause()
+
+	t.say("\nSigner -> User: s = r + c*x mod q, as in ordinary signing.")
+	s := t.scalar(new(big.Int).Add(r, new(big.Int).Mul(c, t.x)))
+	t.value("s", s)
+
+	t.say("\nUser: checks g^s == R * X^c and unblinds, s' = s + a. The signature is (R', s'):")
+	t.say("g^s' = R * X^c * g^a = R' * X^-b * X^(c' + b) = R' * X^c'.")
+	sp := t.scalar(new(big.Int).Add(s, a))
+	t.value("s'", sp)
+	signature := t.signature(RP, sp)
+	t.check(m, signature, t.X)
+	t.say("The signer saw R, c and s only, none of which appears in (R', s') or m.")
+	t.pause()
+	return m, signature
+}
+
+/*
+Verify, showing both sides of the equation
+*/
+func (t *tutorial) check(m string, signature *verifier.Signature, X *big.Int) bool {
+	R := new(big.Int).SetBytes(signature.R)
+	c := t.challenge(R, m)
+
+	t.value("c", c)
+	t.value("g^s", t.exp(t.g, signature.S))
+	t.value("R*X^c", t.mul(R, t.exp(X, c)))
+	ok := verifier.Verify(m, signature, &verifier.PublicKey{Group: t.modp, X: X})
+	t.record("valid", fmt.Sprint(ok), false)
+	if ok {
+		t.say("=> signature is VALID")
+	} else {
+		t.say("=> signature is INVALID")
+	}
+	return ok
+}
+
+/*
+Random safe prime p = 2q + 1 of the given size
+*/
+func safePrime(bits int) (p, q *big.Int) {
+	for {
+		q, err := rand.Prime(rand.Reader, bits-1)
+		if err != nil {
+			panic(err)
+		}
+		p := new(big.Int).Lsh(q, 1)
+		p.Add(p, big.NewInt(1))
+		if p.BitLen() == bits && p.ProbablyPrime(20) {
+			return p, q
+		}
+	}
+}
+
+/*
+Random exponent from [1, q)
+*/
+func (t *tutorial) random() *big.Int {
+	for {
+		k, err := rand.Int(rand.Reader, t.q)
+		if err != nil {
+			panic(err)
+		}
+		if k.Sign() != 0 {
+			return k
+		}
+	}
+}
+
+/*
+a * b mod p
+*/
+func (t *tutorial) mul(a, b *big.Int) *big.Int {
+	r := new(big.Int).Mul(a, b)
+	return r.Mod(r, t.p)
+}
+
+/*
+a^k mod p
+*/
+func (t *tutorial) exp(a, k *big.Int) *big.Int {
+	return new(big.Int).Exp(a, k, t.p)
+}
+
+/*
+k mod q
+*/
+func (t *tutorial) scalar(k *big.Int) *big.Int {
+	return k.Mod(k, t.q)
+}
+
+/*
+c = H(R||m) mod q, R in the encoding the verifier hashes
+*/
+func (t *tutorial) challenge(R *big.Int, m string) *big.Int {
+	return verifier.Challenge(t.encode(R), m, t.q)
+}
+
+func (t *tutorial) signature(R, s *big.Int) *verifier.Signature {
+	return &verifier.Signature{R: t.encode(R), S: s}
+}
+
+/*
+Big endian with the byte length of p
+*/
+func (t *tutorial) encode(v *big.Int) []byte {
+	return v.FillBytes(make([]byte, (t.p.BitLen()+7)/8))
+}
+
+/*
+v + 1 mod n, the default of the tampered values
+*/
+func (t *tutorial) next(v, n *big.Int) *big.Int {
+	r := new(big.Int).Add(v, big.NewInt(1))
+	return r.Mod(r, n)
+}
+
+func (t *tutorial) section(step, title string) {
+	t.step = step
+	t.say("\n== %s ==\n", title)
+}
+
+func (t *tutorial) say(format string, args ...interface{}) {
+	if t.err == nil {
+		_, t.err = fmt.Fprintf(t.out, format+"\n", args...)
+	}
+}
+
+func (t *tutorial) value(name string, v *big.Int) {
+	t.say("  %-12s = %v", name, v)
+	t.record(name, v.String(), false)
+}
+
+func (t *tutorial) secret(name string, v *big.Int) {
+	t.say("  %-12s = %v   (secret)", name, v)
+	t.record(name, v.String(), true)
+}
+
+/*
+Emit the trace event, if tracing
+*/
+func (t *tutorial) record(name, value string, secret bool) {
+	if t.trace == nil || t.err != nil {
+		return
+	}
+	t.seq++
+	t.err = t.trace.Encode(&Event{t.seq, t.step, name, value, secret})
+}
+
+/*
+Read a line, def on empty input or at the end of the input
+*/
+func (t *tutorial) ask(prompt, def string) string {
+	if def != "" {
+		prompt += " [" + def + "]"
+	}
+	if t.err == nil {
+		_, t.err = fmt.Fprint(t.out, prompt+": ")
+	}
+	if !t.in.Scan() {
+		t.say("")
+		return def
+	}
+	if line := strings.TrimSpace(t.in.Text()); line != "" {
+		return line
+	}
+	return def
+}
+
+func (t *tutorial) askInt(prompt string, def *big.Int) *big.Int {
+	for {
+		v, ok := new(big.Int).SetString(t.ask(prompt, def.String()), 10)
+		if ok && v.Sign() >= 0 && v.Cmp(t.p) < 0 {
+			return v
+		}
+		t.say("Enter a number between 0 and p-1.")
+	}
+}
+
+func (t *tutorial) pause() {
+	t.ask("\n[Enter] to continue", "")
+}
@@ -0,0 +1,48 @@
+/*
+expand_message_xmd of RFC 9380, shared by the hashes to curve scalars and to
+group elements so the mod p groups don't depend on the curve package
+*/
+package xmd
+
+import "crypto/sha256"
+
+/*
+expand_message_xmd with SHA-256 (RFC 9380 section 5.3.1)
+*/
+func Expand(msg, dst []byte, n int) []byte {
+	const bLen, sLen = sha256.Size, sha256.BlockSize
+
+	ell := (n + bLen - 1) / bLen
+	if ell > 255 || n > 65535 || len(dst) > 255 {
+		panic("xmd: expand_message_xmd length out of range")
+	}
+	dstPrime := append(append([]byte(nil), dst...), byte(len(dst)))
+
+	h := sha256.New()
+	h.Write(make([]byte, sLen))
+	h.Write(msg)
+	h.Write([]byte{byte(n >> 8), byte(n), 0})
+	h.Write(dstPrime)
+	b0 := h.Sum(nil)
+
+	h.Reset()
+	h.Write(b0)
+	h.Write([]byte{1})
+	h.Write(dstPrime)
+	bi := h.Sum(nil)
+
+	uniform := append(make([]byte, 0, ell*bLen), bi...)
+	for i := 2; i <= ell; i++ {
+		x := make([]byte, bLen)
+		for j := range x {
+			x[j] = b0[j] ^ bi[j]
+		}
+		h.Reset()
+		h.Write(x)
+		h.Write([]byte{byte(i)})
+		h.Write(dstPrime)
+		bi = h.Sum(nil)
+		uniform = append(uniform, bi...)
+	}
+	return uniform[:n]
+}
@@ -0,0 +1,346 @@
+/*
+J-PAKE password-authenticated key exchange over elliptic curves (RFC 8236).
+
+Two parties sharing a low-entropy password agree on a strong session key in
+two rounds, every exponent is accompanied by an RFC 8235 Schnorr NIZK proof
+(package nizk):
+
+	Round 1:  G1 = G*x1, G2 = G*x2, ZKP{x1}, ZKP{x2}                  (peer: G3, G4)
+	Round 2:  A = (G1+G3+G4)*(x2*s), ZKP{x2*s}                         (peer: B)
+	Key:      K = (B - G4*(x2*s)) * x2
+
+Both parties compute the same K only if they used the same password s. The
+explicit key confirmation of RFC 8236 section 5 (HMAC over the identities and
+round 1 values, NIST SP 800-56A) detects a wrong password before the session
+key is used:
+
+	alice, _ := jpake.New(jpake.P256(), "alice", "bob", password)
+	r1, _ := alice.Round1()           // send r1, receive the peer's round 1 as peer1
+	r2, _ := alice.Round2(peer1)      // send r2, receive peer2
+	err := alice.Finish(peer2)
+	tag, _ := alice.ConfirmationTag() // send tag, receive peerTag
+	err = alice.Confirm(peerTag)
+	key, _ := alice.SessionKey()
+*/
+package jpake
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/nizk"
+)
+
+var (
+	ErrSameIdentity = errors.New("jpake: both parties use the same identity")
+	ErrState        = errors.New("jpake: protocol step out of order")
+	ErrInvalidPeer  = errors.New("jpake: invalid message from the peer")
+	ErrConfirmation = errors.New("jpake: key confirmation failed (wrong password?)")
+	ErrEncoding     = errors.New("jpake: invalid message encoding")
+)
+
+type Curve = nizk.Curve
+
+type Point = nizk.Point
+
+func P256() *Curve {
+	return nizk.P256()
+}
+
+func Secp256k1() *Curve {
+	return nizk.Secp256k1()
+}
+
+type Round1 struct {
+	G1, G2     *Point
+	ZKP1, ZKP2 *nizk.ECProof
+}
+
+type Round2 struct {
+	A   *Point
+	ZKP *nizk.ECProof
+}
+
+/*
+Party of the exchange, used for a single session
+*/
+type Participant struct {
+	curve          *Curve
+	id, peerID     string
+	s              *big.Int // password mapped to [1, n)
+	x1, x2         *big.Int
+	g1, g2, g3, g4 *Point
+
+	kcKey, sessionKey []byte
+	confirmed         bool
+}
+
+func New(curve *Curve, id, peerID string, password []byte) (*Participant, error) {
+	if id == peerID {
+		return nil, ErrSameIdentity
+	}
+	return &Participant{curve: curve, id: id, peerID: peerID, s: passwordScalar(curve, password)}, nil
+}
+
+/*
+Round 1 - two ephemeral public values with proofs
+*/
+func (p *Participant) Round1() (*Round1, error) {
+	if p.x1 != nil {
+		return nil, ErrState
+	}
+	x1, err := entropy.Scalar(p.curve.N)
+	if err != nil {
+		return nil, err
+	}
+	x2, err := entropy.Scalar(p.curve.N)
+	if err != nil {
+		return nil, err
+	}
+	p.x1, p.x2 = x1, x2
+	p.g1, p.g2 = p.curve.ScalarBaseMult(p.x1), p.curve.ScalarBaseMult(p.x2)
+
+	zkp1, err := nizk.ProveEC(p.curve, p.x1, p.g1, p.id, "")
+	if err != nil {
+		return nil, err
+	}
+	zkp2, err := nizk.ProveEC(p.curve, p.x2, p.g2, p.id, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Round1{p.g1, p.g2, zkp1, zkp2}, nil
+}
+
+/*
+Round 2 - check the peer's round 1 and send A = (G1+G3+G4)*(x2*s)
+*/
+func (p *Participant) Round2(peer *Round1) (*Round2, error) {
+	if p.x1 == nil || p.g3 != nil {
+		return nil, ErrState
+	}
+	if peer == nil || peer.G1 == nil || peer.G2 == nil || peer.G2.IsIdentity() ||
+		nizk.VerifyEC(p.curve, peer.G1, peer.ZKP1, p.peerID, "") != nil ||
+		nizk.VerifyEC(p.curve, peer.G2, peer.ZKP2, p.peerID, "") != nil {
+		return nil, ErrInvalidPeer
+	}
+	p.g3, p.g4 = peer.G1, peer.G2
+
+	gen := p.curve.Add(p.curve.Add(p.g1, p.g3), p.g4)
+	if gen.IsIdentity() {
+		return nil, ErrInvalidPeer
+	}
+	x2s := p.x2s()
+	A := p.curve.ScalarMult(gen, x2s)
+	zkp, err := nizk.ProveECWithGenerator(p.curve, gen, x2s, A, p.id, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Round2{A, zkp}, nil
+}
+
+/*
+Check the peer's round 2 and compute the shared key material
+*/
+func (p *Participant) Finish(peer *Round2) error {
+	if p.g3 == nil || p.kcKey != nil {
+		return ErrState
+	}
+	gen := p.curve.Add(p.curve.Add(p.g1, p.g2), p.g3)
+	if peer == nil || peer.A == nil || nizk.VerifyECWithGenerator(p.curve, gen, peer.A, peer.ZKP, p.peerID, "") != nil {
+		return ErrInvalidPeer
+	}
+
+	// K = (B - G4*(x2*s)) * x2
+	K := p.curve.Add(peer.A, p.curve.Neg(p.curve.ScalarMult(p.g4, p.x2s())))
+	K = p.curve.ScalarMult(K, p.x2)
+	if K.IsIdentity() {
+		return ErrInvalidPeer
+	}
+
+	keyingMaterial := sha256.Sum256(K.X.FillBytes(make([]byte, p.curve.ByteLen())))
+	p.kcKey = derive(keyingMaterial[:], "JPAKE_KC")
+	p.sessionKey = derive(keyingMaterial[:], "JPAKE_SESSION")
+	p.x1, p.x2 = nil, nil
+	return nil
+}
+
+/*
+Key confirmation tag to send to the peer:
+HMAC(k', "KC_1_U" || id || peerID || G1 || G2 || G3 || G4)
+*/
+func (p *Participant) ConfirmationTag() ([]byte, error) {
+	if p.kcKey == nil {
+		return nil, ErrState
+	}
+	return p.tag(p.id, p.peerID, p.g1, p.g2, p.g3, p.g4)
+}
+
+/*
+Check the peer's confirmation tag
+*/
+func (p *Participant) Confirm(tag []byte) error {
+	if p.kcKey == nil {
+		return ErrState
+	}
+	expected, err := p.tag(p.peerID, p.id, p.g3, p.g4, p.g1, p.g2)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(tag, expected) {
+		return ErrConfirmation
+	}
+	p.confirmed = true
+	return nil
+}
+
+/*
+Session key, available after the peer's confirmation tag was checked
+*/
+func (p *Participant) SessionKey() ([]byte, error) {
+	if !p.confirmed {
+		return nil, ErrState
+	}
+	return append([]byte(nil), p.sessionKey...), nil
+}
+
+func (p *Participant) x2s() *big.Int {
+	x2s := new(big.Int).Mul(p.x2, p.s)
+	return x2s.Mod(x2s, p.curve.N)
+}
+
+func (p *Participant) tag(sender, receiver string, points ...*Point) ([]byte, error) {
+	mac := hmac.New(sha256.New, p.kcKey)
+	writeItem := func(b []byte) {
+		mac.Write(binary.BigEndian.AppendUint32(nil, uint32(len(b))))
+		mac.Write(b)
+	}
+	writeItem([]byte("KC_1_U"))
+	writeItem([]byte(sender))
+	writeItem([]byte(receiver))
+	for _, point := range points {
+		b, err := p.curve.Marshal(point)
+		if err != nil {
+			return nil, err
+		}
+		writeItem(b)
+	}
+	return mac.Sum(nil), nil
+}
+
+/*
+Encoding of round 1: G1 || G2 || ZKP1 || ZKP2, every item with 4-byte length prefix
+*/
+func MarshalRound1(curve *Curve, r *Round1) ([]byte, error) {
+	var items [][]byte
+	for _, point := range []*Point{r.G1, r.G2} {
+		b, err := curve.Marshal(point)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, b)
+	}
+	for _, proof := range []*nizk.ECProof{r.ZKP1, r.ZKP2} {
+		b, err := nizk.MarshalECProof(curve, proof)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, b)
+	}
+	return joinItems(items), nil
+}
+
+func UnmarshalRound1(curve *Curve, b []byte) (*Round1, error) {
+	items, err := splitItems(b, 4)
+	if err != nil {
+		return nil, err
+	}
+	r := &Round1{}
+	if r.G1, err = curve.Unmarshal(items[0]); err != nil {
+		return nil, ErrEncoding
+	}
+	if r.G2, err = curve.Unmarshal(items[1]); err != nil {
+		return nil, ErrEncoding
+	}
+	if r.ZKP1, err = nizk.UnmarshalECProof(curve, items[2]); err != nil {
+		return nil, ErrEncoding
+	}
+	if r.ZKP2, err = nizk.UnmarshalECProof(curve, items[3]); err != nil {
+		return nil, ErrEncoding
+	}
+	return r, nil
+}
+
+/*
+Encoding of round 2: A || ZKP, every item with 4-byte length prefix
+*/
+func MarshalRound2(curve *Curve, r *Round2) ([]byte, error) {
+	A, err := curve.Marshal(r.A)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := nizk.MarshalECProof(curve, r.ZKP)
+	if err != nil {
+		return nil, err
+	}
+	return joinItems([][]byte{A, proof}), nil
+}
+
+func UnmarshalRound2(curve *Curve, b []byte) (*Round2, error) {
+	items, err := splitItems(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	r := &Round2{}
+	if r.A, err = curve.Unmarshal(items[0]); err != nil {
+		return nil, ErrEncoding
+	}
+	if r.ZKP, err = nizk.UnmarshalECProof(curve, items[1]); err != nil {
+		return nil, ErrEncoding
+	}
+	return r, nil
+}
+
+func joinItems(items [][]byte) []byte {
+	var b []byte
+	for _, item := range items {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(item)))
+		b = append(b, item...)
+	}
+	return b
+}
+
+func splitItems(b []byte, count int) ([][]byte, error) {
+	items := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if len(b) < 4 || uint64(len(b)-4) < uint64(binary.BigEndian.Uint32(b)) {
+			return nil, ErrEncoding
+		}
+		n := binary.BigEndian.Uint32(b)
+		items = append(items, b[4:4+n])
+		b = b[4+n:]
+	}
+	if len(b) != 0 {
+		return nil, ErrEncoding
+	}
+	return items, nil
+}
+
+/*
+s = SHA256(password) mod n, never zero
+*/
+func passwordScalar(curve *Curve, password []byte) *big.Int {
+	sum := sha256.Sum256(append([]byte("jpake/password"), password...))
+	s := new(big.Int).SetBytes(sum[:])
+	s.Mod(s, new(big.Int).Sub(curve.N, big.NewInt(1)))
+	return s.Add(s, big.NewInt(1))
+}
+
+func derive(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
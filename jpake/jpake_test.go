@@ -0,0 +1,293 @@
+package jpake
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func pair(t *testing.T, curve *Curve, alicePassword, bobPassword string) (*Participant, *Participant) {
+	t.Helper()
+	alice, err := New(curve, "alice", "bob", []byte(alicePassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := New(curve, "bob", "alice", []byte(bobPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alice, bob
+}
+
+/*
+Both rounds over the wire encoding, up to the key material
+*/
+func exchange(t *testing.T, curve *Curve, alice, bob *Participant) {
+	t.Helper()
+	a1, err := alice.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := bob.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1, b1 = resend1(t, curve, a1), resend1(t, curve, b1)
+	a2, err := alice.Round2(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := bob.Round2(a1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Finish(resend2(t, curve, b2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Finish(resend2(t, curve, a2)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func resend1(t *testing.T, curve *Curve, r *Round1) *Round1 {
+	t.Helper()
+	b, err := MarshalRound1(curve, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = UnmarshalRound1(curve, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func resend2(t *testing.T, curve *Curve, r *Round2) *Round2 {
+	t.Helper()
+	b, err := MarshalRound2(curve, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = UnmarshalRound2(curve, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func confirm(alice, bob *Participant) (error, error) {
+	aliceTag, err := alice.ConfirmationTag()
+	if err != nil {
+		return err, err
+	}
+	bobTag, err := bob.ConfirmationTag()
+	if err != nil {
+		return err, err
+	}
+	return alice.Confirm(bobTag), bob.Confirm(aliceTag)
+}
+
+func TestExchange(t *testing.T) {
+	for _, curve := range []*Curve{P256(), Secp256k1()} {
+		alice, bob := pair(t, curve, "correct horse", "correct horse")
+		exchange(t, curve, alice, bob)
+		if _, err := alice.SessionKey(); err != ErrState {
+			t.Errorf("session key before confirmation: %v", err)
+		}
+		if aliceErr, bobErr := confirm(alice, bob); aliceErr != nil || bobErr != nil {
+			t.Fatalf("confirmation: %v, %v", aliceErr, bobErr)
+		}
+		aliceKey, err := alice.SessionKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bobKey, err := bob.SessionKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(aliceKey, bobKey) || len(aliceKey) != 32 {
+			t.Errorf("session keys differ: %x, %x", aliceKey, bobKey)
+		}
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	alice, bob := pair(t, P256(), "correct horse", "battery staple")
+	exchange(t, P256(), alice, bob)
+	if aliceErr, bobErr := confirm(alice, bob); aliceErr != ErrConfirmation || bobErr != ErrConfirmation {
+		t.Errorf("confirmation with different passwords: %v, %v", aliceErr, bobErr)
+	}
+	if _, err := alice.SessionKey(); err != ErrState {
+		t.Errorf("session key after a failed confirmation: %v", err)
+	}
+}
+
+func TestState(t *testing.T) {
+	if _, err := New(P256(), "alice", "alice", []byte("pw")); err != ErrSameIdentity {
+		t.Errorf("same identities: %v", err)
+	}
+	alice, bob := pair(t, P256(), "pw", "pw")
+	if _, err := alice.Round2(nil); err != ErrState {
+		t.Errorf("round 2 before round 1: %v", err)
+	}
+	if err := alice.Finish(nil); err != ErrState {
+		t.Errorf("finish before round 2: %v", err)
+	}
+	if _, err := alice.ConfirmationTag(); err != ErrState {
+		t.Errorf("tag before finish: %v", err)
+	}
+	if err := alice.Confirm(nil); err != ErrState {
+		t.Errorf("confirmation before finish: %v", err)
+	}
+	a1, err := alice.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Round1(); err != ErrState {
+		t.Errorf("second round 1: %v", err)
+	}
+	b1, err := bob.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Round2(b1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Round2(b1); err != ErrState {
+		t.Errorf("second round 2: %v", err)
+	}
+	// bob refuses his own round 1 played back under alice's identity
+	if _, err := bob.Round2(b1); err != ErrInvalidPeer {
+		t.Errorf("reflected round 1: %v", err)
+	}
+	if _, err := bob.Round2(a1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidPeer(t *testing.T) {
+	curve := P256()
+	alice, bob := pair(t, curve, "pw", "pw")
+	if _, err := alice.Round1(); err != nil {
+		t.Fatal(err)
+	}
+	b1, err := bob.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, bad := range map[string]*Round1{
+		"nil":            nil,
+		"swapped proofs": {b1.G1, b1.G2, b1.ZKP2, b1.ZKP1},
+		"identity G2":    {b1.G1, &Point{}, b1.ZKP1, b1.ZKP2},
+		"missing G1":     {nil, b1.G2, b1.ZKP1, b1.ZKP2},
+		"other G1":       {curve.ScalarBaseMult(big.NewInt(3)), b1.G2, b1.ZKP1, b1.ZKP2},
+	} {
+		if _, err := alice.Round2(bad); err != ErrInvalidPeer {
+			t.Errorf("%s round 1: %v", name, err)
+		}
+	}
+
+	// a rejected message leaves the session usable with the genuine one
+	if _, err := alice.Round2(b1); err != nil {
+		t.Fatal(err)
+	}
+
+	// round 1 proven under another identity
+	mallory, err := New(curve, "mallory", "bob", []byte("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, err := mallory.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Round2(m1); err != ErrInvalidPeer {
+		t.Errorf("round 1 of another identity: %v", err)
+	}
+}
+
+func TestInvalidRound2(t *testing.T) {
+	curve := P256()
+	alice, bob := pair(t, curve, "pw", "pw")
+	a1, err := alice.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := bob.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := alice.Round2(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := bob.Round2(a1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, bad := range map[string]*Round2{
+		"nil":         nil,
+		"missing A":   {nil, b2.ZKP},
+		"reflected":   a2,
+		"other A":     {curve.ScalarBaseMult(big.NewInt(3)), b2.ZKP},
+		"missing ZKP": {b2.A, nil},
+	} {
+		if err := alice.Finish(bad); err != ErrInvalidPeer {
+			t.Errorf("%s round 2: %v", name, err)
+		}
+	}
+	if err := alice.Finish(b2); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Finish(b2); err != ErrState {
+		t.Errorf("second finish: %v", err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	curve := P256()
+	alice, bob := pair(t, curve, "pw", "pw")
+	a1, err := alice.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := bob.Round1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := alice.Round2(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1, err := MarshalRound1(curve, a1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := MarshalRound2(curve, a2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offCurve := append([]byte(nil), r1...)
+	offCurve[4+1] ^= 1
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": r1[:len(r1)-1],
+		"trailing":  append(append([]byte(nil), r1...), 0),
+		"length":    append([]byte{0xff, 0xff, 0xff, 0xff}, r1[4:]...),
+		"point":     offCurve,
+		"round 2":   r2,
+	} {
+		if _, err := UnmarshalRound1(curve, bad); err != ErrEncoding {
+			t.Errorf("%s round 1: %v", name, err)
+		}
+	}
+	for name, bad := range map[string][]byte{
+		"truncated": r2[:len(r2)-1],
+		"round 1":   r1,
+	} {
+		if _, err := UnmarshalRound2(curve, bad); err != ErrEncoding {
+			t.Errorf("%s round 2: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package kafkasign
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Names of the headers added to signed messages
+*/
+const (
+	KeyIDHeader         = "schnorr-key-id"
+	SignatureHeader     = "schnorr-signature"
+	SignedHeadersHeader = "schnorr-signed-headers" // comma separated names of the covered headers
+)
+
+var (
+	ErrUnsigned      = errors.New("kafkasign: message is not signed")
+	ErrUnknownKey    = errors.New("kafkasign: unknown key id")
+	ErrBadSignature  = errors.New("kafkasign: invalid message signature")
+	ErrKeyExpired    = errors.New("kafkasign: signing key has expired")
+	ErrHeaderName    = errors.New("kafkasign: invalid list of signed headers")
+	ErrMissingHeader = errors.New("kafkasign: required header is not signed")
+)
+
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+/*
+Client independent view of the Kafka record.
+Interceptors of the concrete client (sarama, franz-go, confluent-kafka-go)
+should copy their record into Message, call OnSend/OnConsume and copy the
+headers back.
+*/
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers []Header
+}
+
+/*
+Source of public keys used on the consumer side
+*/
+type KeyResolver interface {
+	PublicKey(keyID string) (*schnorr.PublicKey, error)
+}
+
+/*
+KeyResolver backed by a static map of key IDs
+*/
+type KeyMap map[string]*schnorr.PublicKey
+
+func (m KeyMap) PublicKey(keyID string) (*schnorr.PublicKey, error) {
+	pk, ok := m[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return pk, nil
+}
+
+/*
+Adds KeyMap entry for the given public key
+*/
+func (m KeyMap) Add(pk *schnorr.PublicKey) {
+	m[pk.KeyID()] = pk
+}
+
+/*
+Signs messages before they are produced
+*/
+type ProducerInterceptor struct {
+	keyID   string
+	sk      *schnorr.SignatureKey
+	headers []string
+}
+
+/*
+Interceptor covering topic, key, value and the named headers. Other headers,
+e.g. tracing headers added by the client or headers of a dead-letter queue,
+are not signed and may be added or changed without breaking the signature.
+*/
+func NewProducerInterceptor(sk *schnorr.SignatureKey, pk *schnorr.PublicKey, headers ...string) *ProducerInterceptor {
+	return &ProducerInterceptor{pk.KeyID(), sk, headers}
+}
+
+/*
+Replaces signature headers of the message with fresh ones covering topic,
+key, value and every value of the interceptor's headers. The list of the
+covered headers travels in SignedHeadersHeader.
+*/
+func (p *ProducerInterceptor) OnSend(msg *Message) error {
+	if err := checkHeaderNames(p.headers); err != nil {
+		return err
+	}
+	headers := msg.Headers
+	msg.Headers = stripSignature(msg.Headers)
+	msg.Headers = append(msg.Headers,
+		Header{KeyIDHeader, []byte(p.keyID)},
+		Header{SignedHeadersHeader, []byte(strings.Join(p.headers, ","))})
+
+	signature, err := schnorr.TrySign(digest(msg, []byte(p.keyID), p.headers), p.sk)
+	if err != nil {
+		msg.Headers = headers
+		return err
+	}
+	msg.Headers = append(msg.Headers, Header{SignatureHeader, signature.Bytes()})
+	return nil
+}
+
+/*
+Verifies messages after they are consumed
+*/
+type ConsumerInterceptor struct {
+	Required []string // headers which have to be covered by the signature
+
+	keys KeyResolver
+}
+
+func NewConsumerInterceptor(keys KeyResolver, required ...string) *ConsumerInterceptor {
+	return &ConsumerInterceptor{Required: required, keys: keys}
+}
+
+/*
+Checks signature of the consumed message.
+Returns ID of the key which signed the message. Keys expired at the process
+clock (see schnorr.SetClock) are rejected with ErrKeyExpired.
+*/
+func (c *ConsumerInterceptor) OnConsume(msg *Message) (string, error) {
+	keyID, ok := header(msg.Headers, KeyIDHeader)
+	if !ok {
+		return "", ErrUnsigned
+	}
+	rawSignature, ok := header(msg.Headers, SignatureHeader)
+	if !ok {
+		return "", ErrUnsigned
+	}
+	list, ok := header(msg.Headers, SignedHeadersHeader)
+	if !ok {
+		return "", ErrUnsigned
+	}
+	var covered []string
+	if len(list) > 0 {
+		covered = strings.Split(string(list), ",")
+	}
+	if err := checkHeaderNames(covered); err != nil {
+		return "", err
+	}
+	for _, required := range c.Required {
+		if !contains(covered, required) {
+			return "", fmt.Errorf("%w: %s", ErrMissingHeader, required)
+		}
+	}
+
+	pk, err := c.keys.PublicKey(string(keyID))
+	if err != nil {
+		return "", fmt.Errorf("kafkasign: key %q: %w", keyID, err)
+	}
+
+	if pk.ExpiredNow() {
+		return "", ErrKeyExpired
+	}
+
+	signature, err := schnorr.ParseSignature(rawSignature)
+	if err != nil {
+		return "", err
+	}
+
+	if !schnorr.VerifySignature(digest(msg, keyID, covered), signature, pk) {
+		return "", ErrBadSignature
+	}
+
+	return string(keyID), nil
+}
+
+/*
+H(topic||key||value||keyID||list||covered headers) with every field length
+prefixed, every covered header as name||count||values
+*/
+func digest(msg *Message, keyID []byte, covered []string) string {
+	h := sha256.New()
+	write := func(b []byte) {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+		h.Write(l[:])
+		h.Write(b)
+	}
+
+	write([]byte(msg.Topic))
+	write(msg.Key)
+	write(msg.Value)
+	write(keyID)
+	write([]byte(strings.Join(covered, ",")))
+	for _, name := range covered {
+		var values [][]byte
+		for _, hdr := range msg.Headers {
+			if hdr.Key == name {
+				values = append(values, hdr.Value)
+			}
+		}
+		write([]byte(name))
+		var count [4]byte
+		binary.BigEndian.PutUint32(count[:], uint32(len(values)))
+		h.Write(count[:])
+		for _, v := range values {
+			write(v)
+		}
+	}
+
+	return string(h.Sum(nil))
+}
+
+/*
+Covered names are unique, non-empty, without commas and not the signature
+headers themselves
+*/
+func checkHeaderNames(names []string) error {
+	for i, name := range names {
+		if name == "" || strings.Contains(name, ",") || contains(names[:i], name) ||
+			name == KeyIDHeader || name == SignatureHeader || name == SignedHeadersHeader {
+			return fmt.Errorf("%w: %q", ErrHeaderName, name)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func header(headers []Header, key string) ([]byte, bool) {
+	for _, hdr := range headers {
+		if hdr.Key == key {
+			return hdr.Value, true
+		}
+	}
+	return nil, false
+}
+
+/*
+Copy of headers without the signature headers, the caller's slice is kept
+as it is so OnSend can restore it
+*/
+func stripSignature(headers []Header) []Header {
+	kept := make([]Header, 0, len(headers)+3)
+	for _, hdr := range headers {
+		if hdr.Key != KeyIDHeader && hdr.Key != SignatureHeader && hdr.Key != SignedHeadersHeader {
+			kept = append(kept, hdr)
+		}
+	}
+	return kept
+}
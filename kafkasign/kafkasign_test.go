@@ -0,0 +1,201 @@
+package kafkasign
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey, KeyMap) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := KeyMap{}
+	m.Add(pk)
+	return sk, pk, m
+}
+
+func message() *Message {
+	return &Message{
+		Topic: "orders",
+		Key:   []byte("order-1"),
+		Value: []byte(`{"amount":10}`),
+		Headers: []Header{
+			{"tenant", []byte("acme")},
+			{"traceparent", []byte("00-1")},
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	producer := NewProducerInterceptor(sk, pk, "tenant")
+	consumer := NewConsumerInterceptor(resolver, "tenant")
+
+	msg := message()
+	if err := producer.OnSend(msg); err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := consumer.OnConsume(msg)
+	if err != nil || keyID != pk.KeyID() {
+		t.Fatalf("%q, %v", keyID, err)
+	}
+
+	// uncovered headers may change, signing again replaces the signature
+	msg.Headers = append(msg.Headers, Header{"retry", []byte("1")})
+	msg.Headers[1].Value = []byte("00-2")
+	if _, err := consumer.OnConsume(msg); err != nil {
+		t.Errorf("changed uncovered headers: %v", err)
+	}
+	if err := producer.OnSend(msg); err != nil {
+		t.Fatal(err)
+	}
+	signatures := 0
+	for _, h := range msg.Headers {
+		if h.Key == SignatureHeader {
+			signatures++
+		}
+	}
+	if _, err := consumer.OnConsume(msg); err != nil || signatures != 1 {
+		t.Errorf("signed again: %d signatures, %v", signatures, err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	producer := NewProducerInterceptor(sk, pk, "tenant")
+	consumer := NewConsumerInterceptor(resolver)
+
+	for name, tamper := range map[string]func(*Message){
+		"topic":          func(m *Message) { m.Topic = "refunds" },
+		"key":            func(m *Message) { m.Key = []byte("order-2") },
+		"value":          func(m *Message) { m.Value = []byte(`{"amount":1000}`) },
+		"covered header": func(m *Message) { m.Headers[0].Value = []byte("evil") },
+		"second value":   func(m *Message) { m.Headers = append(m.Headers, Header{"tenant", []byte("evil")}) },
+		"header list": func(m *Message) {
+			for i := range m.Headers {
+				if m.Headers[i].Key == SignedHeadersHeader {
+					m.Headers[i].Value = nil
+				}
+			}
+		},
+	} {
+		msg := message()
+		if err := producer.OnSend(msg); err != nil {
+			t.Fatal(err)
+		}
+		tamper(msg)
+		if _, err := consumer.OnConsume(msg); err != ErrBadSignature {
+			t.Errorf("changed %s: %v", name, err)
+		}
+	}
+
+	// the signer's key ID replaced by another key's
+	_, other, _ := keys(t)
+	resolver.Add(other)
+	msg := message()
+	if err := producer.OnSend(msg); err != nil {
+		t.Fatal(err)
+	}
+	for i := range msg.Headers {
+		if msg.Headers[i].Key == KeyIDHeader {
+			msg.Headers[i].Value = []byte(other.KeyID())
+		}
+	}
+	if _, err := consumer.OnConsume(msg); err != ErrBadSignature {
+		t.Errorf("other key ID: %v", err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	sk, pk, resolver := keys(t)
+	producer := NewProducerInterceptor(sk, pk, "tenant")
+
+	if _, err := NewConsumerInterceptor(resolver).OnConsume(message()); err != ErrUnsigned {
+		t.Errorf("unsigned message: %v", err)
+	}
+	if _, err := NewConsumerInterceptor(resolver, "region").OnConsume(signed(t, producer)); !errors.Is(err, ErrMissingHeader) {
+		t.Errorf("required header not covered: %v", err)
+	}
+	if _, err := NewConsumerInterceptor(KeyMap{}).OnConsume(signed(t, producer)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown key: %v", err)
+	}
+
+	for name, value := range map[string][]byte{
+		SignatureHeader:     []byte("garbage"),
+		SignedHeadersHeader: []byte("tenant,,tenant"),
+	} {
+		msg := signed(t, producer)
+		for i := range msg.Headers {
+			if msg.Headers[i].Key == name {
+				msg.Headers[i].Value = value
+			}
+		}
+		if _, err := NewConsumerInterceptor(resolver).OnConsume(msg); err == nil {
+			t.Errorf("malformed %s accepted", name)
+		}
+	}
+
+	for _, names := range [][]string{{""}, {"a,b"}, {"tenant", "tenant"}, {SignatureHeader}} {
+		if err := NewProducerInterceptor(sk, pk, names...).OnSend(message()); !errors.Is(err, ErrHeaderName) {
+			t.Errorf("covered headers %q: %v", names, err)
+		}
+	}
+}
+
+func signed(t *testing.T, p *ProducerInterceptor) *Message {
+	t.Helper()
+	msg := message()
+	if err := p.OnSend(msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+/*
+A message signed with an expired key is rejected, and a failed signature
+leaves the message as it was
+*/
+func TestExpiry(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	clock := schnorr.NewManualClock(start)
+	schnorr.SetClock(clock)
+	t.Cleanup(func() { schnorr.SetClock(nil) })
+
+	sk, pk, err := schnorr.TryGenerateKeysWithExpiry(start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := KeyMap{}
+	resolver.Add(pk)
+	producer := NewProducerInterceptor(sk, pk, "tenant")
+	msg := signed(t, producer)
+
+	clock.Advance(2 * time.Hour)
+	if _, err := NewConsumerInterceptor(resolver).OnConsume(msg); err != ErrKeyExpired {
+		t.Errorf("expired key: %v", err)
+	}
+
+	// a header added after the signature headers, e.g. by a retry
+	msg.Headers = append(msg.Headers, Header{"retry", []byte("1")})
+	before := make([]Header, len(msg.Headers))
+	for i, h := range msg.Headers {
+		before[i] = Header{h.Key, append([]byte(nil), h.Value...)}
+	}
+	if err := producer.OnSend(msg); err != schnorr.ErrKeyExpired {
+		t.Fatalf("signing with an expired key: %v", err)
+	}
+	if len(msg.Headers) != len(before) {
+		t.Fatalf("headers changed to %v", msg.Headers)
+	}
+	for i, h := range msg.Headers {
+		if h.Key != before[i].Key || !bytes.Equal(h.Value, before[i].Value) {
+			t.Fatalf("headers changed to %v", msg.Headers)
+		}
+	}
+}
@@ -0,0 +1,533 @@
+/*
+Attenuable authorization tokens (macaroons) rooted in a Schnorr key.
+
+A service mints a token for an identifier with its signature key. Anybody
+holding the token can restrict it further by appending caveats, nobody can
+remove them, so a token can be handed on with less authority than its holder
+has (delegation). The chain of caveats is bound by HMAC:
+
+	tag_0 = HMAC(root, ID),  root = SHA256("schnorr/macaroon/root" || Sign("schnorr/macaroon/root" || ID))
+	tag_i = HMAC(tag_(i-1), caveat_i)
+
+and the token carries only the last tag. The root is the service's Schnorr
+signature of the identifier, which is deterministic (see schnorr.Sign), so the
+service recomputes it on verification instead of storing root keys, and only
+the key holder can mint or verify tokens.
+
+First-party caveats are predicates checked by the verifying service:
+
+	m, _ := macaroon.Mint(sk, "https://api.example.com", id)
+	m.AddFirstPartyCaveat(macaroon.ExpiresAt(time.Now().Add(time.Hour)))
+	m.AddFirstPartyCaveat(macaroon.Audience("billing"))
+	m.AddFirstPartyCaveat(macaroon.Actions("read"))
+
+	v := &macaroon.Verifier{Key: sk}
+	err := v.Verify(m, macaroon.Request{Audience: "billing", Action: "read"}, nil)
+
+A third-party caveat requires a discharge token from another service (e.g. an
+identity provider) which checks its own predicate. The caveat carries a fresh
+caveat key encrypted to the third party's X25519 key and, encrypted under the
+current tag, for the verifier. The third party mints the discharge with
+Discharge, the holder binds it to the token (Bind) so it can't be reused with
+another one, and presents both.
+
+Caveat keys are encrypted to the third party with an ephemeral-static X25519
+KEM and AES-256-GCM:
+
+	E = e*B,  k = HMAC(X25519(e, P), "schnorr/macaroon/kem" || E || P)
+	ID = E || AES-GCM_k(len(caveat key) || caveat key || predicate)
+
+P is the public key of the third party. The third party's encryption key is a
+separate key, signature keys never decrypt.
+*/
+package macaroon
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const (
+	version  = 1
+	tagSize  = sha256.Size
+	rootTag  = "schnorr/macaroon/root"
+	thirdAAD = "schnorr/macaroon/third-party"
+	kemTag   = "schnorr/macaroon/kem"
+	kemLen   = 32 // X25519 public keys
+)
+
+var (
+	ErrInvalidMacaroon    = errors.New("macaroon: invalid encoding")
+	ErrInvalidTag         = errors.New("macaroon: tag doesn't verify")
+	ErrCaveatNotSatisfied = errors.New("macaroon: caveat not satisfied")
+	ErrMissingDischarge   = errors.New("macaroon: no discharge for third-party caveat")
+	ErrInvalidCaveatID    = errors.New("macaroon: invalid third-party caveat ID")
+)
+
+/*
+Condition on the use of the token
+*/
+type Caveat struct {
+	Predicate string // first-party predicate, empty for third-party caveats
+
+	// third-party caveats only
+	Location       string // hint where the discharge is obtained
+	ID             []byte // caveat key and predicate encrypted to the third party
+	VerificationID []byte // caveat key encrypted under the preceding tag
+}
+
+func (c *Caveat) ThirdParty() bool {
+	return c.ID != nil
+}
+
+type Macaroon struct {
+	Location string // hint where the token is used, not authenticated
+	ID       []byte
+	Caveats  []Caveat
+	Tag      []byte
+}
+
+/*
+Token for the identifier, id should be unique per token (e.g. random with
+a prefix naming the key) and not secret
+*/
+func Mint(sk *schnorr.SignatureKey, location string, id []byte) (*Macaroon, error) {
+	root, err := rootKey(sk, id)
+	if err != nil {
+		return nil, err
+	}
+	return newMacaroon(root, location, id), nil
+}
+
+func newMacaroon(root []byte, location string, id []byte) *Macaroon {
+	return &Macaroon{
+		Location: location,
+		ID:       append([]byte(nil), id...),
+		Tag:      chain(root, id),
+	}
+}
+
+/*
+Restrict the token with a first-party predicate, see ExpiresAt, Audience and Actions
+*/
+func (m *Macaroon) AddFirstPartyCaveat(predicate string) {
+	m.Caveats = append(m.Caveats, Caveat{Predicate: predicate})
+	m.Tag = chain(m.Tag, firstPartyInput(predicate))
+}
+
+/*
+Require a discharge of the third party at location, which checks the predicate
+*/
+func (m *Macaroon) AddThirdPartyCaveat(location string, thirdParty *ecdh.PublicKey, predicate string) error {
+	if thirdParty == nil || thirdParty.Curve() != ecdh.X25519() {
+		return ErrInvalidCaveatID
+	}
+	caveatKey := make([]byte, tagSize)
+	if _, err := io.ReadFull(entropy.Reader, caveatKey); err != nil {
+		return err
+	}
+	id, err := encryptCaveat(thirdParty, append(appendField(nil, caveatKey), predicate...))
+	if err != nil {
+		return err
+	}
+	vid, err := seal(m.Tag, caveatKey)
+	if err != nil {
+		return err
+	}
+
+	c := Caveat{Location: location, ID: id, VerificationID: vid}
+	m.Caveats = append(m.Caveats, c)
+	m.Tag = chain(m.Tag, thirdPartyInput(c.VerificationID, c.ID))
+	return nil
+}
+
+/*
+Copy of the token, attenuating the copy leaves the original unchanged
+*/
+func (m *Macaroon) Clone() *Macaroon {
+	c := *m
+	c.ID = append([]byte(nil), m.ID...)
+	c.Caveats = append([]Caveat(nil), m.Caveats...)
+	c.Tag = append([]byte(nil), m.Tag...)
+	return &c
+}
+
+/*
+Discharge token for a third-party caveat ID, made by the third party with its
+X25519 key after check accepted the predicate. The third party may add caveats
+to it, e.g. a short expiry.
+*/
+func Discharge(key *ecdh.PrivateKey, location string, caveatID []byte, check func(predicate string) error) (*Macaroon, error) {
+	plaintext, err := decryptCaveat(key, caveatID)
+	if err != nil {
+		return nil, ErrInvalidCaveatID
+	}
+	caveatKey, predicate, err := readField(plaintext)
+	if err != nil || len(caveatKey) != tagSize {
+		return nil, ErrInvalidCaveatID
+	}
+	if err := check(string(predicate)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCaveatNotSatisfied, err)
+	}
+	return newMacaroon(caveatKey, location, caveatID), nil
+}
+
+/*
+Discharge bound to the token, as presented together with it
+*/
+func (m *Macaroon) Bind(discharge *Macaroon) *Macaroon {
+	d := discharge.Clone()
+	d.Tag = bind(m.Tag, discharge.Tag)
+	return d
+}
+
+/*
+Context of a request the token is presented with
+*/
+type Request struct {
+	Audience string    // service the token is presented to
+	Action   string    // requested action
+	Time     time.Time // time of the request, zero for the Verifier's clock
+}
+
+type Verifier struct {
+	Key *schnorr.SignatureKey // key the tokens were minted with
+	// Checks the first-party predicates not understood by the Verifier,
+	// nil rejects them
+	Check func(predicate string, r Request) error
+	Now   func() time.Time // defaults to schnorr.Now
+}
+
+/*
+Verify the token and its bound discharges for the request: the tags have to
+match and every caveat, including those of the discharges, has to be satisfied
+*/
+func (v *Verifier) Verify(m *Macaroon, r Request, discharges []*Macaroon) error {
+	if r.Time.IsZero() {
+		now := schnorr.Now
+		if v.Now != nil {
+			now = v.Now
+		}
+		r.Time = now()
+	}
+	root, err := rootKey(v.Key, m.ID)
+	if err != nil {
+		return err
+	}
+	used := make([]bool, len(discharges))
+	return v.verify(m, root, m.Tag, r, discharges, used, true)
+}
+
+func (v *Verifier) verify(m *Macaroon, root, topTag []byte, r Request, discharges []*Macaroon, used []bool, top bool) error {
+	tag := chain(root, m.ID)
+	for _, c := range m.Caveats {
+		if !c.ThirdParty() {
+			if err := v.checkPredicate(c.Predicate, r); err != nil {
+				return err
+			}
+			tag = chain(tag, firstPartyInput(c.Predicate))
+			continue
+		}
+
+		caveatKey, err := open(tag, c.VerificationID)
+		if err != nil {
+			return ErrInvalidTag
+		}
+		i := findDischarge(discharges, used, c.ID)
+		if i < 0 {
+			return fmt.Errorf("%w: %s", ErrMissingDischarge, c.Location)
+		}
+		used[i] = true
+		if err := v.verify(discharges[i], caveatKey, topTag, r, discharges, used, false); err != nil {
+			return err
+		}
+		tag = chain(tag, thirdPartyInput(c.VerificationID, c.ID))
+	}
+
+	if !top {
+		tag = bind(topTag, tag)
+	}
+	if !hmac.Equal(tag, m.Tag) {
+		return ErrInvalidTag
+	}
+	return nil
+}
+
+func findDischarge(discharges []*Macaroon, used []bool, id []byte) int {
+	for i, d := range discharges {
+		if !used[i] && string(d.ID) == string(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+Built-in predicates: "time < RFC 3339 time", "audience = name" and
+"action in a,b,c", others are passed to Verifier.Check
+*/
+func (v *Verifier) checkPredicate(predicate string, r Request) error {
+	switch {
+	case strings.HasPrefix(predicate, "time < "):
+		t, err := time.Parse(time.RFC3339, strings.TrimPrefix(predicate, "time < "))
+		if err != nil || !r.Time.Before(t) {
+			return fmt.Errorf("%w: %s", ErrCaveatNotSatisfied, predicate)
+		}
+	case strings.HasPrefix(predicate, "audience = "):
+		if strings.TrimPrefix(predicate, "audience = ") != r.Audience {
+			return fmt.Errorf("%w: %s", ErrCaveatNotSatisfied, predicate)
+		}
+	case strings.HasPrefix(predicate, "action in "):
+		for _, a := range strings.Split(strings.TrimPrefix(predicate, "action in "), ",") {
+			if a == r.Action {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrCaveatNotSatisfied, predicate)
+	case v.Check != nil:
+		if err := v.Check(predicate, r); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrCaveatNotSatisfied, predicate, err)
+		}
+	default:
+		return fmt.Errorf("%w: unknown predicate %q", ErrCaveatNotSatisfied, predicate)
+	}
+	return nil
+}
+
+/*
+Token valid only before t
+*/
+func ExpiresAt(t time.Time) string {
+	return "time < " + t.UTC().Format(time.RFC3339)
+}
+
+/*
+Token accepted only by the named service
+*/
+func Audience(name string) string {
+	return "audience = " + name
+}
+
+/*
+Token valid only for the listed actions
+*/
+func Actions(actions ...string) string {
+	return "action in " + strings.Join(actions, ",")
+}
+
+/*
+Encoding: version || len(location) || location || len(ID) || ID || count (2 bytes) ||
+caveats || tag, every caveat is predicate, location, ID and verification ID,
+each prefixed by its 4 byte length
+*/
+func (m *Macaroon) Bytes() []byte {
+	b := appendField([]byte{version}, []byte(m.Location))
+	b = appendField(b, m.ID)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(m.Caveats)))
+	for _, c := range m.Caveats {
+		b = appendField(b, []byte(c.Predicate))
+		b = appendField(b, []byte(c.Location))
+		b = appendField(b, c.ID)
+		b = appendField(b, c.VerificationID)
+	}
+	return append(b, m.Tag...)
+}
+
+func Parse(b []byte) (*Macaroon, error) {
+	if len(b) < 1 || b[0] != version {
+		return nil, ErrInvalidMacaroon
+	}
+	location, rest, err := readField(b[1:])
+	if err != nil {
+		return nil, err
+	}
+	m := &Macaroon{Location: string(location)}
+	if m.ID, rest, err = readField(rest); err != nil {
+		return nil, err
+	}
+	if len(rest) < 2 {
+		return nil, ErrInvalidMacaroon
+	}
+	count := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	for i := 0; i < count; i++ {
+		var fields [4][]byte
+		for j := range fields {
+			if fields[j], rest, err = readField(rest); err != nil {
+				return nil, err
+			}
+		}
+		c := Caveat{Predicate: string(fields[0]), Location: string(fields[1])}
+		if len(fields[2]) > 0 {
+			if len(fields[0]) > 0 || len(fields[3]) == 0 {
+				return nil, ErrInvalidMacaroon
+			}
+			c.ID, c.VerificationID = fields[2], fields[3]
+		}
+		m.Caveats = append(m.Caveats, c)
+	}
+	if len(rest) != tagSize {
+		return nil, ErrInvalidMacaroon
+	}
+	m.Tag = rest
+	return m, nil
+}
+
+/*
+Root key of the token, derived from the deterministic signature of its ID
+*/
+func rootKey(sk *schnorr.SignatureKey, id []byte) ([]byte, error) {
+	signature, err := schnorr.TrySign(rootTag+string(id), sk)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write([]byte(rootTag))
+	h.Write(signature.Bytes())
+	return h.Sum(nil), nil
+}
+
+/*
+Caveat ID for the third party: ephemeral X25519 key || AES-GCM ciphertext,
+the key derived from the shared secret is used once, so the nonce is zero
+*/
+func encryptCaveat(thirdParty *ecdh.PublicKey, plaintext []byte) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(entropy.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(thirdParty)
+	if err != nil {
+		return nil, err
+	}
+	E := ephemeral.PublicKey().Bytes()
+	aead, err := tagCipher(kemKey(shared, E, thirdParty.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Seal(E, nonce, plaintext, []byte(thirdAAD)), nil
+}
+
+func decryptCaveat(key *ecdh.PrivateKey, id []byte) ([]byte, error) {
+	if key == nil || key.Curve() != ecdh.X25519() || len(id) < kemLen {
+		return nil, ErrInvalidCaveatID
+	}
+	E, err := ecdh.X25519().NewPublicKey(id[:kemLen])
+	if err != nil {
+		return nil, ErrInvalidCaveatID
+	}
+	// low order E gives an error instead of an all-zero secret
+	shared, err := key.ECDH(E)
+	if err != nil {
+		return nil, ErrInvalidCaveatID
+	}
+	aead, err := tagCipher(kemKey(shared, id[:kemLen], key.PublicKey().Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	plaintext, err := aead.Open(nil, nonce, id[kemLen:], []byte(thirdAAD))
+	if err != nil {
+		return nil, ErrInvalidCaveatID
+	}
+	return plaintext, nil
+}
+
+/*
+k = HMAC(shared, "schnorr/macaroon/kem" || E || P)
+*/
+func kemKey(shared, E, P []byte) []byte {
+	mac := hmac.New(sha256.New, shared)
+	mac.Write([]byte(kemTag))
+	mac.Write(E)
+	mac.Write(P)
+	return mac.Sum(nil)
+}
+
+func chain(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func firstPartyInput(predicate string) []byte {
+	return append([]byte{0}, predicate...)
+}
+
+func thirdPartyInput(vid, cid []byte) []byte {
+	return appendField(appendField([]byte{1}, vid), cid)
+}
+
+/*
+Tag of a discharge bound to the token with tag topTag
+*/
+func bind(topTag, dischargeTag []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("schnorr/macaroon/bind"))
+	h.Write(topTag)
+	h.Write(dischargeTag)
+	return h.Sum(nil)
+}
+
+/*
+AES-256-GCM under the tag: nonce || ciphertext
+*/
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := tagCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(entropy.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	aead, err := tagCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidMacaroon
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func tagCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, ErrInvalidMacaroon
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, ErrInvalidMacaroon
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
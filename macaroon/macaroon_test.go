@@ -0,0 +1,229 @@
+package macaroon
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func mint(t *testing.T) (*schnorr.SignatureKey, *Macaroon, *Verifier) {
+	t.Helper()
+	sk, _, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Mint(sk, "https://api.example.com", []byte("key-1/token-42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, m, &Verifier{Key: sk, Now: func() time.Time { return now }}
+}
+
+var billingRead = Request{Audience: "billing", Action: "read"}
+
+func TestFirstPartyCaveats(t *testing.T) {
+	_, m, v := mint(t)
+	if err := v.Verify(m, billingRead, nil); err != nil {
+		t.Fatalf("token without caveats: %v", err)
+	}
+
+	m.AddFirstPartyCaveat(ExpiresAt(now.Add(time.Hour)))
+	m.AddFirstPartyCaveat(Audience("billing"))
+	m.AddFirstPartyCaveat(Actions("read", "list"))
+	parsed, err := Parse(m.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []*Macaroon{m, parsed} {
+		if err := v.Verify(token, billingRead, nil); err != nil {
+			t.Errorf("attenuated token: %v", err)
+		}
+	}
+
+	for name, r := range map[string]Request{
+		"other audience": {Audience: "shipping", Action: "read"},
+		"other action":   {Audience: "billing", Action: "delete"},
+		"expired":        {Audience: "billing", Action: "read", Time: now.Add(2 * time.Hour)},
+	} {
+		if err := v.Verify(m, r, nil); !errors.Is(err, ErrCaveatNotSatisfied) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// a delegated copy is restricted further, the original keeps its rights
+	delegated := m.Clone()
+	delegated.AddFirstPartyCaveat(Actions("list"))
+	if err := v.Verify(delegated, billingRead, nil); !errors.Is(err, ErrCaveatNotSatisfied) {
+		t.Errorf("delegated token used beyond its caveats: %v", err)
+	}
+	if err := v.Verify(m, billingRead, nil); err != nil {
+		t.Errorf("original after delegation: %v", err)
+	}
+}
+
+func TestCustomPredicates(t *testing.T) {
+	_, m, v := mint(t)
+	m.AddFirstPartyCaveat("tenant = acme")
+	if err := v.Verify(m, billingRead, nil); !errors.Is(err, ErrCaveatNotSatisfied) {
+		t.Errorf("unknown predicate without Check: %v", err)
+	}
+	v.Check = func(predicate string, r Request) error {
+		if predicate != "tenant = acme" {
+			return errors.New("wrong tenant")
+		}
+		return nil
+	}
+	if err := v.Verify(m, billingRead, nil); err != nil {
+		t.Errorf("predicate accepted by Check: %v", err)
+	}
+	m.AddFirstPartyCaveat("tenant = other")
+	if err := v.Verify(m, billingRead, nil); !errors.Is(err, ErrCaveatNotSatisfied) {
+		t.Errorf("predicate rejected by Check: %v", err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	_, m, v := mint(t)
+	m.AddFirstPartyCaveat(Actions("read"))
+	m.AddFirstPartyCaveat(Audience("billing"))
+
+	removed := m.Clone()
+	removed.Caveats = removed.Caveats[:1]
+	changed := m.Clone()
+	changed.Caveats[0].Predicate = Actions("read", "delete")
+	otherID := m.Clone()
+	otherID.ID = []byte("key-1/token-43")
+	tag := m.Clone()
+	tag.Tag[0] ^= 1
+	for name, bad := range map[string]*Macaroon{
+		"removed caveat": removed,
+		"changed caveat": changed,
+		"other ID":       otherID,
+		"changed tag":    tag,
+	} {
+		if err := v.Verify(bad, billingRead, nil); err != ErrInvalidTag {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// minted by another key
+	_, _, other := mint(t)
+	if err := other.Verify(m, billingRead, nil); err != ErrInvalidTag {
+		t.Errorf("token of another key: %v", err)
+	}
+}
+
+func TestThirdPartyCaveats(t *testing.T) {
+	_, m, v := mint(t)
+	idp, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddThirdPartyCaveat("https://idp.example.com", idp.PublicKey(), "user = alice"); err != nil {
+		t.Fatal(err)
+	}
+	m.AddFirstPartyCaveat(Audience("billing"))
+	m, err = Parse(m.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	caveat := m.Caveats[0]
+	if !caveat.ThirdParty() || caveat.Location != "https://idp.example.com" {
+		t.Fatalf("caveat %+v", caveat)
+	}
+
+	var checked string
+	discharge, err := Discharge(idp, "https://idp.example.com", caveat.ID, func(predicate string) error {
+		checked = predicate
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != "user = alice" {
+		t.Errorf("third party checked %q", checked)
+	}
+	discharge.AddFirstPartyCaveat(ExpiresAt(now.Add(time.Minute)))
+
+	if err := v.Verify(m, billingRead, nil); !errors.Is(err, ErrMissingDischarge) {
+		t.Errorf("without discharge: %v", err)
+	}
+	if err := v.Verify(m, billingRead, []*Macaroon{discharge}); err != ErrInvalidTag {
+		t.Errorf("unbound discharge: %v", err)
+	}
+	bound := m.Bind(discharge)
+	if err := v.Verify(m, billingRead, []*Macaroon{bound}); err != nil {
+		t.Errorf("bound discharge: %v", err)
+	}
+	if err := v.Verify(m, Request{Audience: "billing", Time: now.Add(2 * time.Minute)}, []*Macaroon{bound}); !errors.Is(err, ErrCaveatNotSatisfied) {
+		t.Errorf("expired discharge: %v", err)
+	}
+
+	// a discharge bound to another token of the holder doesn't transfer
+	attenuated := m.Clone()
+	attenuated.AddFirstPartyCaveat(Actions("read"))
+	if err := v.Verify(attenuated, billingRead, []*Macaroon{bound}); err != ErrInvalidTag {
+		t.Errorf("discharge bound to another token: %v", err)
+	}
+	if err := v.Verify(attenuated, billingRead, []*Macaroon{attenuated.Bind(discharge)}); err != nil {
+		t.Errorf("discharge rebound by the holder: %v", err)
+	}
+
+	// the third party refuses, or gets somebody else's caveat
+	if _, err := Discharge(idp, "", caveat.ID, func(string) error { return errors.New("not alice") }); !errors.Is(err, ErrCaveatNotSatisfied) {
+		t.Errorf("refused discharge: %v", err)
+	}
+	other, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accept := func(string) error { return nil }
+	if _, err := Discharge(other, "", caveat.ID, accept); err != ErrInvalidCaveatID {
+		t.Errorf("caveat of another third party: %v", err)
+	}
+	for name, id := range map[string][]byte{
+		"empty":     nil,
+		"truncated": caveat.ID[:kemLen+4],
+		"changed":   append(append([]byte(nil), caveat.ID[:len(caveat.ID)-1]...), caveat.ID[len(caveat.ID)-1]^1),
+		"low order": append(make([]byte, kemLen), caveat.ID[kemLen:]...),
+	} {
+		if _, err := Discharge(idp, "", id, accept); err != ErrInvalidCaveatID {
+			t.Errorf("%s caveat ID: %v", name, err)
+		}
+	}
+	p256, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddThirdPartyCaveat("", p256.PublicKey(), "user = alice"); err != ErrInvalidCaveatID {
+		t.Errorf("third party key of another curve: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	_, m, _ := mint(t)
+	m.AddFirstPartyCaveat(Audience("billing"))
+	b := m.Bytes()
+
+	thirdParty := &Macaroon{ID: []byte("id"), Caveats: []Caveat{{Predicate: "p", ID: []byte("cid"), VerificationID: []byte("vid")}}, Tag: m.Tag}
+	noVID := &Macaroon{ID: []byte("id"), Caveats: []Caveat{{ID: []byte("cid")}}, Tag: m.Tag}
+	for name, bad := range map[string][]byte{
+		"empty":                  nil,
+		"version":                append([]byte{2}, b[1:]...),
+		"truncated":              b[:len(b)-1],
+		"trailing":               append(append([]byte(nil), b...), 0),
+		"field length":           append([]byte{version, 0xff, 0xff, 0xff, 0xff}, b[5:]...),
+		"predicate and ID":       thirdParty.Bytes(),
+		"ID without verifier ID": noVID.Bytes(),
+	} {
+		if _, err := Parse(bad); err != ErrInvalidMacaroon {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -1,39 +1,65 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 
+	"github.com/miki799/schnorr-signature/internal/tutorial"
 	"github.com/miki799/schnorr-signature/schnorr"
 )
 
+/*
+Demo of the Schnorr and blind Schnorr signatures, the same walkthrough as
+`schnorr tutorial` with a 256-bit group. With --trace json the intermediate
+values are written to stdout as JSON lines and the text goes to stderr.
+With --protocol the library's blind signature protocol runs once instead,
+its steps are printed by a console Reporter.
+*/
 func main() {
+	trace := flag.String("trace", "", "write the protocol trace to stdout in the format (json)")
+	protocol := flag.Bool("protocol", false, "run the library's blind signature protocol and report its steps")
+	flag.Parse()
 
-	/*
-		Schnorr signature
-	*/
-
-	fmt.Println("### Schnorr signature ###")
-
-	message := "hello"
-	fmt.Println("Message to sign: ", message)
-
-	signatureKey, publicKey := schnorr.GenerateKeys()
-	signature := schnorr.Sign(message, signatureKey)
-
-	fmt.Println("Created signature:", signature.String())
+	var err error
+	switch {
+	case *protocol:
+		err = runProtocol("hello")
+	case *trace == "":
+		err = tutorial.Run(os.Stdin, os.Stdout, 256)
+	case *trace == "json":
+		err = tutorial.RunTraced(os.Stdin, os.Stderr, os.Stdout, 256)
+	default:
+		err = fmt.Errorf("unknown trace format %q", *trace)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	isSignatureValid := schnorr.VerifySignature(message, signature, publicKey)
+/*
+Reporter printing every protocol step to stdout
+*/
+type consoleReporter struct{}
 
-	if isSignatureValid {
-		fmt.Println("Signature is valid. Schnorr signature alghoritm is working!")
-	} else {
-		fmt.Println("Signature is invalid. Schnorr singature alghoritm is not working!")
-		return
+func (consoleReporter) Report(event string, kv ...interface{}) {
+	fmt.Printf("%-16s", event)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fmt.Printf(" %v=%v", kv[i], kv[i+1])
 	}
+	fmt.Println()
+}
 
-	/*
-		Schnorr blind signature
-	*/
+func runProtocol(message string) error {
+	schnorr.SetReporter(consoleReporter{})
+	defer schnorr.SetReporter(nil)
 
-	schnorr.BlindSignatureProcess(message, signatureKey, publicKey)
+	sk, pk := schnorr.GenerateKeys()
+	signature, err := schnorr.BlindSignatureProcess(message, sk, pk)
+	if err != nil {
+		return err
+	}
+	fmt.Println("signature valid:", schnorr.VerifySignature(message, signature, pk))
+	return nil
 }
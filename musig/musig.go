@@ -0,0 +1,422 @@
+/*
+MuSig2 multi-signatures in the prime order groups of package schnorr
+
+n co-signers holding schnorr.SignatureKeys of the same group produce a
+single signature which verifies with schnorr.VerifySignature against their
+aggregated public key, nobody can tell it apart from an ordinary signature.
+
+Key aggregation weights every key with a coefficient bound to the whole key
+list, which stops a co-signer from choosing its key as a function of the
+others (rogue key attack):
+
+	L   = H(X_1 || ... || X_n)
+	a_i = H_agg(L || X_i)
+	X~  = sum(a_i * X_i)
+
+Signing takes two rounds. Round 1 (NewSession) exchanges two nonce
+commitments per signer and may happen before the message is known, round 2
+(PartialSign) exchanges the partial signatures:
+
+	R_1 = sum(R_1,i), R_2 = sum(R_2,i)
+	b   = H_non(X~ || R_1 || R_2 || m)
+	R   = R_1 + b*R_2,  c = H(R || m)  (schnorr.Challenge)
+	s_i = k_1,i + b*k_2,i + c*a_i*x_i
+	s   = sum(s_i)
+
+The binding factor b makes the protocol secure with concurrent sessions (the
+single-nonce variant is broken by the ROS attack, see package attacks).
+Session nonces are erased after the partial signature, a session signs once.
+*/
+package musig
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strconv"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrNoKeys           = errors.New("musig: no public keys")
+	ErrDuplicateKey     = errors.New("musig: public key listed twice")
+	ErrUnknownKey       = errors.New("musig: key isn't one of the aggregated keys")
+	ErrNonces           = errors.New("musig: nonce list doesn't match the aggregated keys")
+	ErrNonceReuse       = errors.New("musig: session nonces were already used")
+	ErrInvalidPartial   = errors.New("musig: invalid partial signature")
+	ErrInvalidSignature = errors.New("musig: combined signature doesn't verify")
+	ErrInvalidElement   = errors.New("musig: invalid group element")
+)
+
+/*
+Aggregated public key together with the ordered key list it was computed from
+*/
+type AggregateKey struct {
+	Public       *schnorr.PublicKey
+	Keys         []*schnorr.PublicKey
+	coefficients []*big.Int
+}
+
+/*
+Round 1 message: commitments to the two nonces of a signer
+*/
+type PublicNonce struct {
+	R1, R2 schnorr.Element
+}
+
+/*
+State of a co-signer in one signing session
+*/
+type Session struct {
+	x      *big.Int // private key of the co-signer
+	agg    *AggregateKey
+	index  int
+	m      string
+	k1, k2 *big.Int // secret nonces, nil after PartialSign
+	Nonce  *PublicNonce
+}
+
+/*
+Aggregate the keys in the given order, all co-signers must use the same order
+*/
+func AggregateKeys(keys []*schnorr.PublicKey) (*AggregateKey, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	group := keys[0].Group()
+
+	encoded := make([][]byte, len(keys))
+	seen := make(map[string]bool, len(keys))
+	h := sha512.New()
+	h.Write([]byte("musig/keylist"))
+	for i, key := range keys {
+		if key.Validate() != nil {
+			return nil, ErrInvalidElement
+		}
+		if key.Group().Name() != group.Name() {
+			return nil, schnorr.ErrGroupMismatch
+		}
+		b, err := group.Encode(key.X)
+		if err != nil {
+			return nil, ErrInvalidElement
+		}
+		if seen[string(b)] {
+			return nil, ErrDuplicateKey
+		}
+		seen[string(b)] = true
+		encoded[i] = b
+		h.Write(b)
+	}
+	L := h.Sum(nil)
+
+	agg := &AggregateKey{Keys: keys, coefficients: make([]*big.Int, len(keys))}
+	var X schnorr.Element
+	for i, key := range keys {
+		agg.coefficients[i] = hashToScalar(group, "musig/agg", L, encoded[i])
+		term := group.ScalarMult(key.X, agg.coefficients[i])
+		if X == nil {
+			X = term
+		} else {
+			X = group.Add(X, term)
+		}
+	}
+	if _, err := group.Encode(X); err != nil {
+		return nil, ErrInvalidElement
+	}
+	pk, err := schnorr.NewPublicKey(group, X)
+	if err != nil {
+		return nil, ErrInvalidElement
+	}
+	agg.Public = pk
+	return agg, nil
+}
+
+/*
+Coefficient a_i of the key at the index in the key list
+*/
+func (agg *AggregateKey) Coefficient(index int) *big.Int {
+	return new(big.Int).Set(agg.coefficients[index])
+}
+
+/*
+Round 1 - start signing m as one of the aggregated keys, publish session.Nonce
+*/
+func NewSession(agg *AggregateKey, sk *schnorr.SignatureKey, m string) (*Session, error) {
+	pk, err := sk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	index := agg.index(pk)
+	if index < 0 {
+		return nil, ErrUnknownKey
+	}
+	group := agg.Public.Group()
+	k1, err := randomScalar(group.Order())
+	if err != nil {
+		return nil, err
+	}
+	k2, err := randomScalar(group.Order())
+	if err != nil {
+		return nil, err
+	}
+	return newSession(agg, sk, index, m, k1, k2), nil
+}
+
+/*
+Round 1 with the nonces of a pair taken from a schnorr.NonceBatch, whose
+public nonces the co-signers received ahead of time (see PublicNonceFromPair).
+The pair hands out its nonces once, a second session with it fails with
+schnorr.ErrNonceUsed.
+*/
+func NewSessionWithNonces(agg *AggregateKey, sk *schnorr.SignatureKey, m string, pair *schnorr.SecretNoncePair) (*Session, error) {
+	pk, err := sk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	index := agg.index(pk)
+	if index < 0 {
+		return nil, ErrUnknownKey
+	}
+	if pair.Group().Name() != agg.Public.Group().Name() {
+		return nil, schnorr.ErrGroupMismatch
+	}
+	k1, k2, err := pair.Nonces()
+	if err != nil {
+		return nil, err
+	}
+	if k1.Sign() == 0 || k2.Sign() == 0 {
+		// probability 2/q, the public nonce has no encoding
+		return nil, ErrInvalidElement
+	}
+	return newSession(agg, sk, index, m, k1, k2), nil
+}
+
+func newSession(agg *AggregateKey, sk *schnorr.SignatureKey, index int, m string, k1, k2 *big.Int) *Session {
+	group := agg.Public.Group()
+	return &Session{
+		x:     sk.Secret(),
+		agg:   agg,
+		index: index,
+		m:     m,
+		k1:    k1,
+		k2:    k2,
+		Nonce: &PublicNonce{group.ScalarBaseMult(k1), group.ScalarBaseMult(k2)},
+	}
+}
+
+/*
+Round 2 - partial signature s_i over the nonces of all co-signers, in the
+order of the key list. The session nonces are erased.
+*/
+func (s *Session) PartialSign(nonces []*PublicNonce) (*big.Int, error) {
+	k1, k2 := s.k1, s.k2
+	s.k1, s.k2 = nil, nil
+	if k1 == nil {
+		return nil, ErrNonceReuse
+	}
+	_, b, c, err := s.agg.context(s.m, nonces)
+	if err != nil {
+		return nil, err
+	}
+	group := s.agg.Public.Group()
+	if own := nonces[s.index]; !group.Equal(own.R1, s.Nonce.R1) || !group.Equal(own.R2, s.Nonce.R2) {
+		return nil, ErrNonces
+	}
+
+	// s_i = k_1 + b*k_2 + c*a_i*x_i mod n
+	partial := new(big.Int).Mul(c, s.agg.coefficients[s.index])
+	partial.Mul(partial, s.x)
+	partial.Add(partial, k1)
+	partial.Add(partial, b.Mul(b, k2))
+	return partial.Mod(partial, group.Order()), nil
+}
+
+/*
+Check the partial signature of the co-signer at the index:
+s_i*G == R_1,i + b*R_2,i + c*a_i*X_i
+*/
+func (agg *AggregateKey) VerifyPartial(m string, nonces []*PublicNonce, index int, partial *big.Int) error {
+	group := agg.Public.Group()
+	if index < 0 || index >= len(agg.Keys) || partial == nil || partial.Sign() < 0 || partial.Cmp(group.Order()) >= 0 {
+		return ErrInvalidPartial
+	}
+	_, b, c, err := agg.context(m, nonces)
+	if err != nil {
+		return err
+	}
+
+	e := c.Mul(c, agg.coefficients[index])
+	expected := group.Add(nonces[index].R1, group.ScalarMult(nonces[index].R2, b))
+	expected = group.Add(expected, group.ScalarMult(agg.Keys[index].X, e.Mod(e, group.Order())))
+	if !group.Equal(group.ScalarBaseMult(partial), expected) {
+		return ErrInvalidPartial
+	}
+	return nil
+}
+
+/*
+Combine the partial signatures of all co-signers into the signature (R, s),
+partials are checked with VerifyPartial so a failure names the culprit
+*/
+func (agg *AggregateKey) CombinePartials(m string, nonces []*PublicNonce, partials []*big.Int) (*schnorr.Signature, error) {
+	if len(partials) != len(agg.Keys) {
+		return nil, ErrInvalidPartial
+	}
+	R, _, _, err := agg.context(m, nonces)
+	if err != nil {
+		return nil, err
+	}
+
+	n := agg.Public.Group().Order()
+	s := new(big.Int)
+	for i, partial := range partials {
+		if err := agg.VerifyPartial(m, nonces, i, partial); err != nil {
+			return nil, &PartialError{i, err}
+		}
+		s.Add(s, partial)
+	}
+	signature, err := schnorr.NewSignature(R, s.Mod(s, n))
+	if err != nil || !schnorr.VerifySignature(m, signature, agg.Public) {
+		return nil, ErrInvalidSignature
+	}
+	return signature, nil
+}
+
+/*
+Invalid partial signature of the co-signer at Index
+*/
+type PartialError struct {
+	Index int
+	Err   error
+}
+
+func (e *PartialError) Error() string {
+	return "musig: co-signer " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+/*
+Aggregated nonce R (encoded), binding factor b and challenge c of the session
+*/
+func (agg *AggregateKey) context(m string, nonces []*PublicNonce) ([]byte, *big.Int, *big.Int, error) {
+	group := agg.Public.Group()
+	if len(nonces) != len(agg.Keys) {
+		return nil, nil, nil, ErrNonces
+	}
+	var R1, R2 schnorr.Element
+	for i, nonce := range nonces {
+		if nonce == nil || !valid(group, nonce.R1) || !valid(group, nonce.R2) {
+			return nil, nil, nil, ErrNonces
+		}
+		if i == 0 {
+			R1, R2 = nonce.R1, nonce.R2
+		} else {
+			R1, R2 = group.Add(R1, nonce.R1), group.Add(R2, nonce.R2)
+		}
+	}
+
+	var encoded []byte
+	for _, e := range []schnorr.Element{agg.Public.X, R1, R2} {
+		// sums may be the identity, which has no encoding
+		b, err := group.Encode(e)
+		if err != nil {
+			return nil, nil, nil, ErrNonces
+		}
+		encoded = append(encoded, b...)
+	}
+	b := hashToScalar(group, "musig/noncecoef", encoded, []byte(m))
+
+	R, err := group.Encode(group.Add(R1, group.ScalarMult(R2, b)))
+	if err != nil {
+		return nil, nil, nil, ErrNonces
+	}
+	return R, b, schnorr.Challenge(R, m, agg.Public), nil
+}
+
+func (agg *AggregateKey) index(pk *schnorr.PublicKey) int {
+	for i, key := range agg.Keys {
+		if key.Equal(pk) {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+Encoding: Encode(R1) || Encode(R2), both of the same length
+*/
+func (nonce *PublicNonce) Bytes(group schnorr.Group) ([]byte, error) {
+	r1, err := group.Encode(nonce.R1)
+	if err != nil {
+		return nil, err
+	}
+	r2, err := group.Encode(nonce.R2)
+	if err != nil {
+		return nil, err
+	}
+	return append(r1, r2...), nil
+}
+
+/*
+Round 1 message of a co-signer from the public nonce pair it published with
+its schnorr.NonceBatch
+*/
+func PublicNonceFromPair(group schnorr.Group, pair schnorr.PublicNoncePair) (*PublicNonce, error) {
+	R1, err := group.Decode(pair.R1)
+	if err != nil {
+		return nil, err
+	}
+	R2, err := group.Decode(pair.R2)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicNonce{R1, R2}, nil
+}
+
+func ParsePublicNonce(group schnorr.Group, b []byte) (*PublicNonce, error) {
+	if len(b) == 0 || len(b)%2 != 0 {
+		return nil, ErrInvalidElement
+	}
+	R1, err := group.Decode(b[:len(b)/2])
+	if err != nil {
+		return nil, err
+	}
+	R2, err := group.Decode(b[len(b)/2:])
+	if err != nil {
+		return nil, err
+	}
+	return &PublicNonce{R1, R2}, nil
+}
+
+/*
+SHA-512(len(tag)||tag||data...) mod n
+*/
+func hashToScalar(group schnorr.Group, tag string, data ...[]byte) *big.Int {
+	h := sha512.New()
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(tag))))
+	h.Write([]byte(tag))
+	for _, d := range data {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(d))))
+		h.Write(d)
+	}
+	k := new(big.Int).SetBytes(h.Sum(nil))
+	return k.Mod(k, group.Order())
+}
+
+func valid(group schnorr.Group, e schnorr.Element) bool {
+	if e == nil {
+		return false
+	}
+	_, err := group.Encode(e)
+	return err == nil
+}
+
+func randomScalar(n *big.Int) (*big.Int, error) {
+	return entropy.Scalar(n)
+}
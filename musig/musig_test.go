@@ -0,0 +1,199 @@
+package musig
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func cosigners(t *testing.T, n int) ([]*schnorr.SignatureKey, *AggregateKey) {
+	t.Helper()
+	keys := make([]*schnorr.SignatureKey, n)
+	public := make([]*schnorr.PublicKey, n)
+	for i := range keys {
+		sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i], public[i] = sk, pk
+	}
+	agg, err := AggregateKeys(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys, agg
+}
+
+func sign(t *testing.T, agg *AggregateKey, sessions []*Session, m string) *schnorr.Signature {
+	t.Helper()
+	nonces := make([]*PublicNonce, len(sessions))
+	for i, session := range sessions {
+		nonces[i] = session.Nonce
+	}
+	partials := make([]*big.Int, len(sessions))
+	for i, session := range sessions {
+		partial, err := session.PartialSign(nonces)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials[i] = partial
+	}
+	signature, err := agg.CombinePartials(m, nonces, partials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func TestMuSig(t *testing.T) {
+	keys, agg := cosigners(t, 3)
+	const m = "transfer 10 coins"
+	sessions := make([]*Session, len(keys))
+	for i, sk := range keys {
+		session, err := NewSession(agg, sk, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[i] = session
+	}
+	signature := sign(t, agg, sessions, m)
+	if !schnorr.VerifySignature(m, signature, agg.Public) {
+		t.Error("signature doesn't verify")
+	}
+	if schnorr.VerifySignature(m+"!", signature, agg.Public) {
+		t.Error("signature verifies for another message")
+	}
+
+	nonces := []*PublicNonce{sessions[0].Nonce, sessions[1].Nonce, sessions[2].Nonce}
+	if _, err := sessions[0].PartialSign(nonces); err != ErrNonceReuse {
+		t.Errorf("second partial signature: %v", err)
+	}
+}
+
+/*
+Nonces published ahead of time with a schnorr.NonceBatch, every pair signs once
+*/
+func TestSessionWithNonces(t *testing.T) {
+	keys, agg := cosigners(t, 2)
+	batches := make([]*schnorr.NonceBatch, len(keys))
+	for i, sk := range keys {
+		batch, err := schnorr.NewNonceBatch(sk, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches[i] = batch
+	}
+
+	// the co-signers' view of the published nonces matches the session
+	published, err := PublicNonceFromPair(agg.Public.Group(), batches[1].PublicNonces()[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const m = "pay 5 coins"
+	sessions := make([]*Session, len(keys))
+	for i, sk := range keys {
+		pair, err := batches[i].Take(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sessions[i], err = NewSessionWithNonces(agg, sk, m, pair); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewSessionWithNonces(agg, sk, m, pair); !errors.Is(err, schnorr.ErrNonceUsed) {
+			t.Errorf("second session with the same pair: %v", err)
+		}
+	}
+	group := agg.Public.Group()
+	if !group.Equal(published.R1, sessions[1].Nonce.R1) || !group.Equal(published.R2, sessions[1].Nonce.R2) {
+		t.Error("session nonces differ from the published pair")
+	}
+
+	signature := sign(t, agg, sessions, m)
+	if !schnorr.VerifySignature(m, signature, agg.Public) {
+		t.Error("signature doesn't verify")
+	}
+	for _, batch := range batches {
+		if _, err := batch.Take(2); err != schnorr.ErrNonceUsed {
+			t.Errorf("pair taken twice: %v", err)
+		}
+		if batch.Remaining() != 3 {
+			t.Errorf("%d pairs remaining", batch.Remaining())
+		}
+	}
+
+	other, _, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := schnorr.NewNonceBatch(other, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := batch.Take(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSessionWithNonces(agg, keys[0], m, pair); err != schnorr.ErrGroupMismatch {
+		t.Errorf("pair of another group: %v", err)
+	}
+}
+
+func TestPartialTamper(t *testing.T) {
+	keys, agg := cosigners(t, 2)
+	const m = "message"
+	nonces := make([]*PublicNonce, len(keys))
+	sessions := make([]*Session, len(keys))
+	for i, sk := range keys {
+		session, err := NewSession(agg, sk, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[i], nonces[i] = session, session.Nonce
+	}
+	partials := make([]*big.Int, len(keys))
+	for i, session := range sessions {
+		partial, err := session.PartialSign(nonces)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials[i] = partial
+	}
+
+	partials[1] = new(big.Int).Add(partials[1], big.NewInt(1))
+	_, err := agg.CombinePartials(m, nonces, partials)
+	var partialErr *PartialError
+	if !errors.As(err, &partialErr) || partialErr.Index != 1 {
+		t.Errorf("tampered partial: %v", err)
+	}
+	if _, err := agg.CombinePartials(m, nonces[:1], partials); err == nil {
+		t.Error("combined with a missing nonce")
+	}
+}
+
+func TestParsePublicNonce(t *testing.T) {
+	keys, agg := cosigners(t, 1)
+	session, err := NewSession(agg, keys[0], "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := agg.Public.Group()
+	encoded, err := session.Nonce.Bytes(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := ParsePublicNonce(group, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !group.Equal(nonce.R1, session.Nonce.R1) || !group.Equal(nonce.R2, session.Nonce.R2) {
+		t.Error("nonce changed in the round trip")
+	}
+	for _, b := range [][]byte{nil, encoded[:1], encoded[:len(encoded)-1], make([]byte, len(encoded))} {
+		if _, err := ParsePublicNonce(group, b); err == nil {
+			t.Errorf("parsed %x", b)
+		}
+	}
+}
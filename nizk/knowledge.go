@@ -0,0 +1,221 @@
+package nizk
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Proof of knowledge of the private key of package schnorr keys
+
+Schnorr identification proves that the prover knows x for the public key
+X = g^x of the group of the key without signing anything:
+
+	prover:   T = g^t                      (commitment)
+	verifier: random c                     (challenge)
+	prover:   s = t + c*x mod q            (response)
+	verifier: g^s == T * X^c
+
+ProveKnowledge is its non-interactive (Fiat-Shamir) variant with
+c = H("schnorr-knowledge" || pk || T || context), pk being the encoded public
+key including its group. The context (e.g. registration ID and server name)
+binds a proof to its use, a proof replayed in another context doesn't verify.
+Unlike a signature over a server-chosen message, nothing the verifier chooses
+gets signed with the key.
+*/
+
+var ErrIdentificationState = errors.New("nizk: identification message out of order")
+
+const knowledgeTag = "schnorr-knowledge"
+
+type KnowledgeProof struct {
+	T []byte   // encoding of the commitment T = g^t
+	S *big.Int // response s = t + c*x mod q
+}
+
+/*
+Prove knowledge of the private key, bound to the context
+*/
+func ProveKnowledge(sk *schnorr.SignatureKey, context string) (*KnowledgeProof, error) {
+	pk, err := sk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	t, T, err := commit(pk.Group())
+	if err != nil {
+		return nil, err
+	}
+	c := knowledgeChallenge(pk, T, context)
+	return &KnowledgeProof{T, response(t, c, sk.Secret(), pk.Group().Order())}, nil
+}
+
+func VerifyKnowledge(proof *KnowledgeProof, pk *schnorr.PublicKey, context string) error {
+	if err := validateKey(pk); err != nil {
+		return err
+	}
+	if proof == nil || proof.S == nil || proof.S.Sign() < 0 || proof.S.Cmp(pk.Group().Order()) >= 0 {
+		return ErrInvalidProof
+	}
+	return checkResponse(pk, proof.T, knowledgeChallenge(pk, proof.T, context), proof.S)
+}
+
+/*
+Encoding: T || s, T in the encoding of the group, s of the byte length of q
+*/
+func (proof *KnowledgeProof) Bytes(pk *schnorr.PublicKey) []byte {
+	return append(append([]byte(nil), proof.T...), proof.S.FillBytes(make([]byte, group.ScalarLen(pk.Group())))...)
+}
+
+func ParseKnowledgeProof(pk *schnorr.PublicKey, b []byte) (*KnowledgeProof, error) {
+	size := group.ScalarLen(pk.Group())
+	if len(b) <= size {
+		return nil, ErrInvalidEncoding
+	}
+	T := append([]byte(nil), b[:len(b)-size]...)
+	if _, err := pk.Group().Decode(T); err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return &KnowledgeProof{T, new(big.Int).SetBytes(b[len(b)-size:])}, nil
+}
+
+/*
+Prover of the interactive identification, one run per prover
+*/
+type IdentificationProver struct {
+	sk *schnorr.SignatureKey
+	t  *big.Int // nonce, nil after the response
+	T  []byte
+}
+
+/*
+Verifier of the interactive identification, one run per verifier
+*/
+type IdentificationVerifier struct {
+	pk *schnorr.PublicKey
+	T  []byte
+	c  *big.Int
+}
+
+func NewIdentificationProver(sk *schnorr.SignatureKey) (*IdentificationProver, error) {
+	pk, err := sk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	t, T, err := commit(pk.Group())
+	if err != nil {
+		return nil, err
+	}
+	return &IdentificationProver{sk, t, T}, nil
+}
+
+/*
+Encoded commitment T, sent to the verifier first
+*/
+func (pr *IdentificationProver) Commitment() []byte {
+	return append([]byte(nil), pr.T...)
+}
+
+/*
+Response to the verifier's challenge. The prover answers once, a second
+challenge for the same nonce would reveal the key.
+*/
+func (pr *IdentificationProver) Respond(c *big.Int) (*big.Int, error) {
+	q := pr.sk.Group().Order()
+	if pr.t == nil {
+		return nil, ErrIdentificationState
+	}
+	if c == nil || c.Sign() < 0 || c.Cmp(q) >= 0 {
+		return nil, ErrInvalidProof
+	}
+	s := response(pr.t, c, pr.sk.Secret(), q)
+	pr.t = nil
+	return s, nil
+}
+
+func NewIdentificationVerifier(pk *schnorr.PublicKey, commitment []byte) (*IdentificationVerifier, error) {
+	if err := validateKey(pk); err != nil {
+		return nil, err
+	}
+	if _, err := pk.Group().Decode(commitment); err != nil {
+		return nil, ErrInvalidProof
+	}
+	return &IdentificationVerifier{pk: pk, T: append([]byte(nil), commitment...)}, nil
+}
+
+/*
+Random challenge, chosen once per run
+*/
+func (v *IdentificationVerifier) Challenge() (*big.Int, error) {
+	if v.c == nil {
+		c, err := entropy.Scalar(v.pk.Group().Order())
+		if err != nil {
+			return nil, err
+		}
+		v.c = c
+	}
+	return new(big.Int).Set(v.c), nil
+}
+
+func (v *IdentificationVerifier) Verify(s *big.Int) error {
+	if v.c == nil {
+		return ErrIdentificationState
+	}
+	if s == nil || s.Sign() < 0 || s.Cmp(v.pk.Group().Order()) >= 0 {
+		return ErrInvalidProof
+	}
+	return checkResponse(v.pk, v.T, v.c, s)
+}
+
+/*
+Nonce t and the encoded commitment T = g^t
+*/
+func commit(g schnorr.Group) (*big.Int, []byte, error) {
+	t, err := entropy.Scalar(g.Order())
+	if err != nil {
+		return nil, nil, err
+	}
+	T, err := g.Encode(g.ScalarBaseMult(t))
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, T, nil
+}
+
+/*
+g^s == T * X^c
+*/
+func checkResponse(pk *schnorr.PublicKey, encodedT []byte, c, s *big.Int) error {
+	g := pk.Group()
+	T, err := g.Decode(encodedT)
+	if err != nil {
+		return ErrInvalidProof
+	}
+	if !g.Equal(g.ScalarBaseMult(s), g.Add(T, g.ScalarMult(pk.X, c))) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+/*
+s = t + c*x mod q
+*/
+func response(t, c, x, q *big.Int) *big.Int {
+	s := new(big.Int).Mul(c, x)
+	s.Add(s, t)
+	return s.Mod(s, q)
+}
+
+func knowledgeChallenge(pk *schnorr.PublicKey, T []byte, context string) *big.Int {
+	return hashItems(pk.Group().Order(), []byte(knowledgeTag), pk.Bytes(), T, []byte(context))
+}
+
+func validateKey(pk *schnorr.PublicKey) error {
+	if pk == nil || pk.Validate() != nil {
+		return ErrInvalidPublicValue
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+/*
+Schnorr non-interactive zero-knowledge proofs (RFC 8235).
+
+The prover shows knowledge of a for the public value A = g^a (finite field) or
+A = G * a (elliptic curve) without revealing it:
+
+	V = g^v,  c = H(g || V || A || UserID || OtherInfo),  r = v - a*c mod q
+	verifier: V == g^r * A^c mod p
+
+	V = G * v,  c = H(G || V || A || UserID || OtherInfo),  r = v - a*c mod n
+	verifier: V == G * r + A * c
+
+Following section 2.2 (finite field) and 3.2 (elliptic curve) of the RFC, every
+item of the hash input is prefixed with its 4-byte big-endian length. Finite
+field elements are encoded as big-endian integers of the byte length of p, curve
+points as uncompressed SEC1 points and identities as UTF-8 strings. The hash is SHA-256.
+*/
+package nizk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/internal/ec"
+)
+
+var (
+	ErrInvalidPublicValue = errors.New("nizk: public value is not a valid group element")
+	ErrInvalidProof       = errors.New("nizk: invalid proof")
+	ErrInvalidEncoding    = errors.New("nizk: invalid proof encoding")
+)
+
+/*
+Elliptic curve point, the identity has nil coordinates
+*/
+type Point = ec.Point
+
+type Curve = ec.Curve
+
+func Secp256k1() *Curve {
+	return ec.Secp256k1()
+}
+
+func P256() *Curve {
+	return ec.P256()
+}
+
+/*
+Prime order q subgroup of Z_p^* generated by g
+*/
+type Group struct {
+	P, Q, G *big.Int
+}
+
+/*
+2048-bit MODP group (RFC 3526, group 14): p = 2q + 1, g = 2 generates the subgroup of order q
+*/
+var MODP2048 = func() *Group {
+	p, _ := new(big.Int).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+			"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+			"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05"+
+			"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB"+
+			"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+			"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718"+
+			"3995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+	return &Group{p, new(big.Int).Rsh(p, 1), big.NewInt(2)}
+}()
+
+/*
+Finite field proof
+*/
+type Proof struct {
+	V *big.Int
+	R *big.Int
+}
+
+/*
+Elliptic curve proof
+*/
+type ECProof struct {
+	V *Point
+	R *big.Int
+}
+
+/*
+Public value A = g^a
+*/
+func (grp *Group) PublicValue(a *big.Int) *big.Int {
+	return new(big.Int).Exp(grp.G, a, grp.P)
+}
+
+/*
+Check that A is an element of the subgroup (section 2.3)
+*/
+func (grp *Group) ValidatePublicValue(A *big.Int) error {
+	if A == nil || A.Cmp(big.NewInt(1)) <= 0 || A.Cmp(grp.P) >= 0 ||
+		new(big.Int).Exp(A, grp.Q, grp.P).Cmp(big.NewInt(1)) != 0 {
+		return ErrInvalidPublicValue
+	}
+	return nil
+}
+
+/*
+Prove knowledge of a for A = g^a
+*/
+func (grp *Group) Prove(a, A *big.Int, userID, otherInfo string) (*Proof, error) {
+	v, err := entropy.Scalar(grp.Q)
+	if err != nil {
+		return nil, err
+	}
+	V := new(big.Int).Exp(grp.G, v, grp.P)
+	c := grp.challenge(V, A, userID, otherInfo)
+
+	// r = v - a*c mod q
+	r := c.Mul(c, a)
+	r.Sub(v, r)
+	return &Proof{V, r.Mod(r, grp.Q)}, nil
+}
+
+func (grp *Group) Verify(A *big.Int, proof *Proof, userID, otherInfo string) error {
+	if err := grp.ValidatePublicValue(A); err != nil {
+		return err
+	}
+	if proof == nil || proof.V == nil || proof.R == nil || proof.V.Sign() <= 0 || proof.V.Cmp(grp.P) >= 0 ||
+		proof.R.Sign() < 0 || proof.R.Cmp(grp.Q) >= 0 {
+		return ErrInvalidProof
+	}
+
+	c := grp.challenge(proof.V, A, userID, otherInfo)
+	expected := new(big.Int).Exp(grp.G, proof.R, grp.P)
+	expected.Mul(expected, new(big.Int).Exp(A, c, grp.P))
+	if expected.Mod(expected, grp.P).Cmp(proof.V) != 0 {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+/*
+Encoding: V || r, both of the byte length of p
+*/
+func (grp *Group) MarshalProof(proof *Proof) []byte {
+	size := (grp.P.BitLen() + 7) / 8
+	b := make([]byte, 2*size)
+	proof.V.FillBytes(b[:size])
+	proof.R.FillBytes(b[size:])
+	return b
+}
+
+func (grp *Group) UnmarshalProof(b []byte) (*Proof, error) {
+	size := (grp.P.BitLen() + 7) / 8
+	if len(b) != 2*size {
+		return nil, ErrInvalidEncoding
+	}
+	return &Proof{new(big.Int).SetBytes(b[:size]), new(big.Int).SetBytes(b[size:])}, nil
+}
+
+/*
+c = H(g || V || A || UserID || OtherInfo)
+*/
+func (grp *Group) challenge(V, A *big.Int, userID, otherInfo string) *big.Int {
+	size := (grp.P.BitLen() + 7) / 8
+	return hashItems(grp.Q,
+		grp.G.FillBytes(make([]byte, size)),
+		V.FillBytes(make([]byte, size)),
+		A.FillBytes(make([]byte, size)),
+		[]byte(userID),
+		[]byte(otherInfo))
+}
+
+/*
+Prove knowledge of a for A = G * a
+*/
+func ProveEC(curve *Curve, a *big.Int, A *Point, userID, otherInfo string) (*ECProof, error) {
+	return ProveECWithGenerator(curve, curve.Generator(), a, A, userID, otherInfo)
+}
+
+/*
+Prove knowledge of a for A = gen * a, used by protocols proving against a derived
+generator (e.g. the second round of J-PAKE)
+*/
+func ProveECWithGenerator(curve *Curve, gen *Point, a *big.Int, A *Point, userID, otherInfo string) (*ECProof, error) {
+	v, err := entropy.Scalar(curve.N)
+	if err != nil {
+		return nil, err
+	}
+	V := curve.ScalarMult(gen, v)
+	c, err := ecChallenge(curve, gen, V, A, userID, otherInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	// r = v - a*c mod n
+	r := c.Mul(c, a)
+	r.Sub(v, r)
+	return &ECProof{V, r.Mod(r, curve.N)}, nil
+}
+
+/*
+Verify the proof, A has to be a point of the curve other than the identity (section 3.3)
+*/
+func VerifyEC(curve *Curve, A *Point, proof *ECProof, userID, otherInfo string) error {
+	return VerifyECWithGenerator(curve, curve.Generator(), A, proof, userID, otherInfo)
+}
+
+func VerifyECWithGenerator(curve *Curve, gen, A *Point, proof *ECProof, userID, otherInfo string) error {
+	if gen.IsIdentity() || !curve.IsOnCurve(gen) || A.IsIdentity() || !curve.IsOnCurve(A) {
+		return ErrInvalidPublicValue
+	}
+	if proof == nil || proof.V == nil || proof.R == nil || proof.V.IsIdentity() || !curve.IsOnCurve(proof.V) ||
+		proof.R.Sign() < 0 || proof.R.Cmp(curve.N) >= 0 {
+		return ErrInvalidProof
+	}
+
+	c, err := ecChallenge(curve, gen, proof.V, A, userID, otherInfo)
+	if err != nil {
+		return ErrInvalidProof
+	}
+	expected := curve.Add(curve.ScalarMult(gen, proof.R), curve.ScalarMult(A, c))
+	if !expected.Equal(proof.V) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+/*
+Encoding: uncompressed V || r of the byte length of n
+*/
+func MarshalECProof(curve *Curve, proof *ECProof) ([]byte, error) {
+	V, err := curve.Marshal(proof.V)
+	if err != nil {
+		return nil, err
+	}
+	return append(V, proof.R.FillBytes(make([]byte, (curve.N.BitLen()+7)/8))...), nil
+}
+
+func UnmarshalECProof(curve *Curve, b []byte) (*ECProof, error) {
+	pointLen := 1 + 2*curve.ByteLen()
+	if len(b) != pointLen+(curve.N.BitLen()+7)/8 {
+		return nil, ErrInvalidEncoding
+	}
+	V, err := curve.Unmarshal(b[:pointLen])
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return &ECProof{V, new(big.Int).SetBytes(b[pointLen:])}, nil
+}
+
+/*
+c = H(G || V || A || UserID || OtherInfo)
+*/
+func ecChallenge(curve *Curve, gen, V, A *Point, userID, otherInfo string) (*big.Int, error) {
+	items := make([][]byte, 0, 5)
+	for _, p := range []*Point{gen, V, A} {
+		b, err := curve.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, b)
+	}
+	return hashItems(curve.N, append(items, []byte(userID), []byte(otherInfo))...), nil
+}
+
+/*
+SHA-256 of length prefixed items, reduced modulo the group order
+*/
+func hashItems(order *big.Int, items ...[]byte) *big.Int {
+	h := sha256.New()
+	for _, item := range items {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(item))))
+		h.Write(item)
+	}
+	c := new(big.Int).SetBytes(h.Sum(nil))
+	return c.Mod(c, order)
+}
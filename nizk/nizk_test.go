@@ -0,0 +1,265 @@
+package nizk
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func TestFiniteField(t *testing.T) {
+	grp := MODP2048
+	a, err := entropy.Scalar(grp.Q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	A := grp.PublicValue(a)
+	proof, err := grp.Prove(a, A, "alice", "session 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := grp.Verify(A, proof, "alice", "session 1"); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := grp.UnmarshalProof(grp.MarshalProof(proof))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := grp.Verify(A, parsed, "alice", "session 1"); err != nil {
+		t.Errorf("parsed proof: %v", err)
+	}
+
+	if err := grp.Verify(A, proof, "bob", "session 1"); err != ErrInvalidProof {
+		t.Errorf("proof of another user: %v", err)
+	}
+	if err := grp.Verify(A, proof, "alice", "session 2"); err != ErrInvalidProof {
+		t.Errorf("proof in another context: %v", err)
+	}
+	if err := grp.Verify(grp.PublicValue(big.NewInt(7)), proof, "alice", "session 1"); err != ErrInvalidProof {
+		t.Errorf("proof for another value: %v", err)
+	}
+	tampered := &Proof{proof.V, new(big.Int).Add(proof.R, big.NewInt(1))}
+	if err := grp.Verify(A, tampered, "alice", "session 1"); err != ErrInvalidProof {
+		t.Errorf("changed response: %v", err)
+	}
+
+	for name, bad := range map[string]*Proof{
+		"nil":        nil,
+		"missing V":  {nil, proof.R},
+		"zero V":     {new(big.Int), proof.R},
+		"V above p":  {grp.P, proof.R},
+		"r above q":  {proof.V, grp.Q},
+		"negative r": {proof.V, big.NewInt(-1)},
+		"missing r":  {proof.V, nil},
+	} {
+		if err := grp.Verify(A, bad, "alice", "session 1"); err != ErrInvalidProof {
+			t.Errorf("%s proof: %v", name, err)
+		}
+	}
+	// p-1 has order 2, outside the subgroup
+	for _, bad := range []*big.Int{nil, big.NewInt(1), grp.P, new(big.Int).Sub(grp.P, big.NewInt(1))} {
+		if err := grp.Verify(bad, proof, "alice", "session 1"); err != ErrInvalidPublicValue {
+			t.Errorf("public value %v: %v", bad, err)
+		}
+	}
+	if _, err := grp.UnmarshalProof(grp.MarshalProof(proof)[1:]); err != ErrInvalidEncoding {
+		t.Errorf("truncated proof: %v", err)
+	}
+}
+
+func TestEllipticCurve(t *testing.T) {
+	for _, curve := range []*Curve{P256(), Secp256k1()} {
+		a, err := entropy.Scalar(curve.N)
+		if err != nil {
+			t.Fatal(err)
+		}
+		A := curve.ScalarBaseMult(a)
+		proof, err := ProveEC(curve, a, A, "alice", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyEC(curve, A, proof, "alice", ""); err != nil {
+			t.Fatal(err)
+		}
+		b, err := MarshalECProof(curve, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := UnmarshalECProof(curve, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyEC(curve, A, parsed, "alice", ""); err != nil {
+			t.Errorf("parsed proof: %v", err)
+		}
+
+		// a proof against another generator doesn't verify against G
+		gen := curve.ScalarBaseMult(big.NewInt(5))
+		other, err := ProveECWithGenerator(curve, gen, a, curve.ScalarMult(gen, a), "alice", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyECWithGenerator(curve, gen, curve.ScalarMult(gen, a), other, "alice", ""); err != nil {
+			t.Errorf("proof against a derived generator: %v", err)
+		}
+		if err := VerifyEC(curve, curve.ScalarMult(gen, a), other, "alice", ""); err != ErrInvalidProof {
+			t.Errorf("proof against another generator: %v", err)
+		}
+
+		if err := VerifyEC(curve, A, proof, "bob", ""); err != ErrInvalidProof {
+			t.Errorf("proof of another user: %v", err)
+		}
+		if err := VerifyEC(curve, A, &ECProof{proof.V, new(big.Int).Sub(curve.N, proof.R)}, "alice", ""); err != ErrInvalidProof {
+			t.Errorf("changed response: %v", err)
+		}
+		offCurve := &Point{X: new(big.Int).Set(A.X), Y: new(big.Int).Add(A.Y, big.NewInt(1))}
+		for name, bad := range map[string]*ECProof{
+			"nil":         nil,
+			"identity V":  {&Point{}, proof.R},
+			"V off curve": {offCurve, proof.R},
+			"r above n":   {proof.V, curve.N},
+			"missing r":   {proof.V, nil},
+		} {
+			if err := VerifyEC(curve, A, bad, "alice", ""); err != ErrInvalidProof {
+				t.Errorf("%s proof: %v", name, err)
+			}
+		}
+		if err := VerifyEC(curve, &Point{}, proof, "alice", ""); err != ErrInvalidPublicValue {
+			t.Errorf("identity public value: %v", err)
+		}
+		if err := VerifyEC(curve, offCurve, proof, "alice", ""); err != ErrInvalidPublicValue {
+			t.Errorf("public value off the curve: %v", err)
+		}
+		b[1] ^= 1
+		if _, err := UnmarshalECProof(curve, b); err != ErrInvalidEncoding {
+			t.Errorf("point off the curve: %v", err)
+		}
+		if _, err := UnmarshalECProof(curve, b[:len(b)-1]); err != ErrInvalidEncoding {
+			t.Errorf("truncated proof: %v", err)
+		}
+	}
+}
+
+func TestKnowledge(t *testing.T) {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := ProveKnowledge(sk, "registration 42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyKnowledge(proof, pk, "registration 42"); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseKnowledgeProof(pk, proof.Bytes(pk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyKnowledge(parsed, pk, "registration 42"); err != nil {
+		t.Errorf("parsed proof: %v", err)
+	}
+
+	_, other, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyKnowledge(proof, pk, "registration 43"); err != ErrInvalidProof {
+		t.Errorf("proof replayed in another context: %v", err)
+	}
+	if err := VerifyKnowledge(proof, other, "registration 42"); err != ErrInvalidProof {
+		t.Errorf("proof for another key: %v", err)
+	}
+	q := pk.Group().Order()
+	for name, bad := range map[string]*KnowledgeProof{
+		"nil":         nil,
+		"changed s":   {proof.T, new(big.Int).Mod(new(big.Int).Add(proof.S, big.NewInt(1)), q)},
+		"s above q":   {proof.T, q},
+		"missing s":   {proof.T, nil},
+		"malformed T": {[]byte{4, 1}, proof.S},
+	} {
+		if err := VerifyKnowledge(bad, pk, "registration 42"); err != ErrInvalidProof {
+			t.Errorf("%s proof: %v", name, err)
+		}
+	}
+	if err := VerifyKnowledge(proof, nil, "registration 42"); err != ErrInvalidPublicValue {
+		t.Errorf("missing key: %v", err)
+	}
+	b := proof.Bytes(pk)
+	if _, err := ParseKnowledgeProof(pk, b[len(b)-32:]); err != ErrInvalidEncoding {
+		t.Errorf("proof without commitment: %v", err)
+	}
+	if _, err := ParseKnowledgeProof(pk, b[1:]); err != ErrInvalidEncoding {
+		t.Errorf("truncated commitment: %v", err)
+	}
+}
+
+func TestIdentification(t *testing.T) {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prover, err := NewIdentificationProver(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewIdentificationVerifier(pk, prover.Commitment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(big.NewInt(1)); err != ErrIdentificationState {
+		t.Errorf("response before the challenge: %v", err)
+	}
+	c, err := verifier.Challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := prover.Respond(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prover.Respond(c); err != ErrIdentificationState {
+		t.Errorf("second response: %v", err)
+	}
+	if err := verifier.Verify(new(big.Int).Mod(new(big.Int).Add(s, big.NewInt(1)), pk.Group().Order())); err != ErrInvalidProof {
+		t.Errorf("changed response: %v", err)
+	}
+
+	// a prover without the key can't answer for it
+	otherSK, _, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	impostor, err := NewIdentificationProver(otherSK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err = NewIdentificationVerifier(pk, impostor.Commitment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = verifier.Challenge(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = impostor.Respond(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(s); err != ErrInvalidProof {
+		t.Errorf("response of another key: %v", err)
+	}
+
+	if _, err := NewIdentificationVerifier(pk, []byte{2}); err != ErrInvalidProof {
+		t.Errorf("malformed commitment: %v", err)
+	}
+	prover, err = NewIdentificationProver(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prover.Respond(pk.Group().Order()); err != ErrInvalidProof {
+		t.Errorf("challenge out of range: %v", err)
+	}
+}
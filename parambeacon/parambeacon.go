@@ -0,0 +1,351 @@
+/*
+Beacon publishing signed, versioned group parameter sets.
+
+Organizations verifying each other's signatures have to use the same group
+parameters. A Publisher serves named parameter sets over HTTP, every version
+signed with the publisher's key and accompanied by the transcript of its seeded
+generation (schnorr.GenerateParamsFromSeed):
+
+	GET /               index of the sets and their latest versions
+	GET /{name}         latest version of the set
+	GET /{name}/{n}     version n of the set
+
+A Client trusts only the publisher key given to it. It checks the signature,
+replays the generation transcript, so even the publisher can't serve
+parameters with a trapdoor, and never accepts an older version of a set than
+it has seen before (rollback protection). Register adds a fetched set to the
+schnorr parameter registry:
+
+	c := &parambeacon.Client{URL: "https://params.example.org", Publisher: pk}
+	set, err := c.Register(ctx, 0x8100, "org-2048", 0)
+*/
+package parambeacon
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrUnknownSet    = errors.New("parambeacon: unknown parameter set")
+	ErrBadSignature  = errors.New("parambeacon: invalid publisher signature")
+	ErrTranscript    = errors.New("parambeacon: parameters don't match their generation transcript")
+	ErrRollback      = errors.New("parambeacon: version older than a version seen before")
+	ErrInvalidName   = errors.New("parambeacon: invalid parameter set name")
+	ErrSetMismatch   = errors.New("parambeacon: response is not the requested parameter set")
+	ErrMalformedJSON = errors.New("parambeacon: malformed parameter set")
+)
+
+/*
+Published version of a parameter set
+*/
+type ParamSet struct {
+	Name       string
+	Version    uint32 // 1 for the first version of the name
+	Published  time.Time
+	Params     *schnorr.GroupParams
+	Transcript *schnorr.ParamsTranscript
+	KeyID      string // publisher key
+	Signature  *schnorr.Signature
+}
+
+/*
+Signed message: "schnorr/parambeacon" || len(name) || name || version (4 bytes) ||
+published (8 byte unix seconds) || len(params) || params || len(transcript) || transcript
+*/
+func (s *ParamSet) message() string {
+	b := appendField([]byte("schnorr/parambeacon"), []byte(s.Name))
+	b = binary.BigEndian.AppendUint32(b, s.Version)
+	b = binary.BigEndian.AppendUint64(b, uint64(s.Published.Unix()))
+	b = appendField(b, s.Params.Bytes())
+	return string(appendField(b, s.Transcript.Bytes()))
+}
+
+/*
+Check the publisher signature and replay the generation transcript
+*/
+func (s *ParamSet) Verify(publisher *schnorr.PublicKey) error {
+	if s.Params == nil || s.Transcript == nil || s.Signature == nil {
+		return ErrMalformedJSON
+	}
+	if s.KeyID != publisher.KeyID() || !schnorr.Verify(s.message(), s.Signature, publisher) {
+		return ErrBadSignature
+	}
+	params, err := s.Transcript.Verify()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTranscript, err)
+	}
+	if params.P().Cmp(s.Params.P()) != 0 || params.G().Cmp(s.Params.G()) != 0 {
+		return ErrTranscript
+	}
+	return nil
+}
+
+type Publisher struct {
+	sk  *schnorr.SignatureKey
+	pk  *schnorr.PublicKey
+	now func() time.Time
+
+	mu   sync.Mutex
+	sets map[string][]*ParamSet // versions in order
+}
+
+func NewPublisher(sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Publisher {
+	return &Publisher{sk: sk, pk: pk, now: schnorr.Now, sets: make(map[string][]*ParamSet)}
+}
+
+/*
+Publish the parameters generated by the transcript as the next version of the
+named set. Names are path segments: letters, digits, '-', '_' and '.'.
+*/
+func (p *Publisher) Publish(name string, t *schnorr.ParamsTranscript) (*ParamSet, error) {
+	if !validName(name) {
+		return nil, ErrInvalidName
+	}
+	params, err := t.Verify()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTranscript, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := &ParamSet{
+		Name:       name,
+		Version:    uint32(len(p.sets[name]) + 1),
+		Published:  p.now().UTC().Truncate(time.Second),
+		Params:     params,
+		Transcript: t,
+		KeyID:      p.pk.KeyID(),
+	}
+	if s.Signature, err = schnorr.TrySign(s.message(), p.sk); err != nil {
+		return nil, err
+	}
+	p.sets[name] = append(p.sets[name], s)
+	return s, nil
+}
+
+/*
+Version of the set, 0 for the latest
+*/
+func (p *Publisher) Lookup(name string, version uint32) (*ParamSet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	versions := p.sets[name]
+	if version == 0 {
+		version = uint32(len(versions))
+	}
+	if version == 0 || version > uint32(len(versions)) {
+		return nil, ErrUnknownSet
+	}
+	return versions[version-1], nil
+}
+
+/*
+Latest version of every set
+*/
+func (p *Publisher) Index() map[string]uint32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	index := make(map[string]uint32, len(p.sets))
+	for name, versions := range p.sets {
+		index[name] = uint32(len(versions))
+	}
+	return index
+}
+
+/*
+HTTP handler of the beacon, see the package documentation for the paths
+*/
+func (p *Publisher) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		path := strings.Trim(r.URL.Path, "/")
+		if path == "" {
+			writeJSON(w, p.Index())
+			return
+		}
+
+		name, v, _ := strings.Cut(path, "/")
+		var version uint64
+		if v != "" {
+			var err error
+			if version, err = strconv.ParseUint(v, 10, 32); err != nil || version == 0 {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		s, err := p.Lookup(name, uint32(version))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, s)
+	})
+}
+
+type Client struct {
+	URL        string             // beacon URL
+	Publisher  *schnorr.PublicKey // trusted publisher key
+	HTTPClient *http.Client       // http.DefaultClient if nil
+
+	mu   sync.Mutex
+	seen map[string]uint32 // highest verified version per set
+}
+
+/*
+Fetch and verify a version of the named set, 0 for the latest
+*/
+func (c *Client) Fetch(ctx context.Context, name string, version uint32) (*ParamSet, error) {
+	if !validName(name) {
+		return nil, ErrInvalidName
+	}
+	u := strings.TrimSuffix(c.URL, "/") + "/" + url.PathEscape(name)
+	if version != 0 {
+		u += "/" + strconv.FormatUint(uint64(version), 10)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrUnknownSet
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("parambeacon: %s: %s", u, resp.Status)
+	}
+
+	s := new(ParamSet)
+	if err := json.NewDecoder(resp.Body).Decode(s); err != nil {
+		return nil, err
+	}
+	if s.Name != name || (version != 0 && s.Version != version) {
+		return nil, ErrSetMismatch
+	}
+	if err := s.Verify(c.Publisher); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]uint32)
+	}
+	if version == 0 && s.Version < c.seen[name] {
+		return nil, fmt.Errorf("%w: %s version %d, seen %d", ErrRollback, name, s.Version, c.seen[name])
+	}
+	if s.Version > c.seen[name] {
+		c.seen[name] = s.Version
+	}
+	return s, nil
+}
+
+/*
+Fetch the set and register its parameters under the ID (schnorr.RegisterParams)
+*/
+func (c *Client) Register(ctx context.Context, id uint16, name string, version uint32) (*ParamSet, error) {
+	s, err := c.Fetch(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := schnorr.RegisterParams(id, s.Params); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/*
+JSON form of a ParamSet, binary values hex encoded
+*/
+type paramSetJSON struct {
+	Name       string    `json:"name"`
+	Version    uint32    `json:"version"`
+	Published  time.Time `json:"published"`
+	Params     string    `json:"params"`     // GroupParams.Bytes
+	Transcript string    `json:"transcript"` // ParamsTranscript.Bytes
+	KeyID      string    `json:"key_id"`
+	Signature  string    `json:"signature"` // Signature.Bytes
+}
+
+func (s *ParamSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(paramSetJSON{
+		Name:       s.Name,
+		Version:    s.Version,
+		Published:  s.Published,
+		Params:     hex.EncodeToString(s.Params.Bytes()),
+		Transcript: hex.EncodeToString(s.Transcript.Bytes()),
+		KeyID:      s.KeyID,
+		Signature:  hex.EncodeToString(s.Signature.Bytes()),
+	})
+}
+
+func (s *ParamSet) UnmarshalJSON(b []byte) error {
+	var j paramSetJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	params, err1 := hex.DecodeString(j.Params)
+	transcript, err2 := hex.DecodeString(j.Transcript)
+	signature, err3 := hex.DecodeString(j.Signature)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return ErrMalformedJSON
+	}
+
+	*s = ParamSet{Name: j.Name, Version: j.Version, Published: j.Published, KeyID: j.KeyID}
+	if s.Params, err1 = schnorr.ParseGroupParams(params); err1 != nil {
+		return ErrMalformedJSON
+	}
+	if s.Transcript, err1 = schnorr.ParseParamsTranscript(transcript); err1 != nil {
+		return ErrMalformedJSON
+	}
+	if s.Signature, err1 = schnorr.ParseSignature(signature); err1 != nil {
+		return ErrMalformedJSON
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, doc interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func validName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
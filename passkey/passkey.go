@@ -0,0 +1,413 @@
+/*
+WebAuthn-like registration and assertion ceremonies backed by Schnorr keys.
+
+Server side issues one-time challenges, binds responses to the expected origin
+and tracks signature counters of every credential to detect cloned authenticators.
+Authenticator is the client side of the protocol, compiled to WASM for the
+browser by bindings/wasm.
+*/
+package passkey
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/internal/expiry"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Values of the ClientData type field
+*/
+const (
+	TypeCreate = "passkey.create"
+	TypeGet    = "passkey.get"
+)
+
+const challengeTTL = 2 * time.Minute
+
+var (
+	ErrUnknownChallenge  = errors.New("passkey: unknown or expired challenge")
+	ErrClientData        = errors.New("passkey: client data doesn't match the ceremony")
+	ErrOrigin            = errors.New("passkey: origin mismatch")
+	ErrUnknownCredential = errors.New("passkey: unknown credential")
+	ErrCredentialExists  = errors.New("passkey: credential already registered")
+	ErrBadSignature      = errors.New("passkey: invalid signature")
+	ErrCounter           = errors.New("passkey: signature counter didn't increase, authenticator may be cloned")
+)
+
+/*
+Data collected by the client and signed by the authenticator
+*/
+type ClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"` // base64url encoded challenge
+	Origin    string `json:"origin"`
+}
+
+/*
+Registered credential
+*/
+type Credential struct {
+	ID        string
+	UserID    string
+	PublicKey *schnorr.PublicKey
+	Counter   uint32
+}
+
+/*
+Persistence of registered credentials
+*/
+type CredentialStore interface {
+	Get(credentialID string) (*Credential, error)
+	// Store the credential unless one with its ID exists, atomically.
+	// Reports whether the credential was stored.
+	Insert(c *Credential) (bool, error)
+	// Set the counter of the credential to new if it is still old, atomically.
+	// Reports whether the counter was set.
+	SwapCounter(credentialID string, old, new uint32) (bool, error)
+}
+
+/*
+Response of the authenticator to the registration challenge
+*/
+type RegistrationResponse struct {
+	ClientDataJSON []byte
+	PublicKey      []byte // schnorr.PublicKey.Bytes()
+	Signature      []byte // self-attestation over authenticator data and client data hash
+}
+
+/*
+Response of the authenticator to the login challenge
+*/
+type AssertionResponse struct {
+	CredentialID   string
+	ClientDataJSON []byte
+	Counter        uint32
+	Signature      []byte
+}
+
+type challenge struct {
+	userID  string
+	kind    string
+	expires time.Time
+}
+
+/*
+Relying party server
+*/
+type Server struct {
+	rpID   string // relying party identifier, e.g. "example.com"
+	origin string // expected origin, e.g. "https://example.com"
+	store  CredentialStore
+	now    func() time.Time
+
+	mu         sync.Mutex
+	challenges map[string]*challenge
+	queue      expiry.Queue // issued challenges by expiry
+}
+
+func NewServer(rpID, origin string, store CredentialStore) *Server {
+	return &Server{
+		rpID:       rpID,
+		origin:     origin,
+		store:      store,
+		now:        schnorr.Now,
+		challenges: make(map[string]*challenge),
+	}
+}
+
+/*
+Issue challenge for the registration of a new credential of the user, fails
+if the random source does
+*/
+func (s *Server) BeginRegistration(userID string) (string, error) {
+	return s.issue(userID, TypeCreate)
+}
+
+/*
+Checks registration response and stores the new credential.
+Credential ID is the key ID of the registered public key.
+*/
+func (s *Server) FinishRegistration(userID string, resp *RegistrationResponse) (*Credential, error) {
+	if err := s.checkClientData(resp.ClientDataJSON, userID, TypeCreate); err != nil {
+		return nil, err
+	}
+
+	pk, err := schnorr.ParsePublicKey(resp.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !verify(s.rpID, 0, resp.ClientDataJSON, resp.Signature, pk) {
+		return nil, ErrBadSignature
+	}
+
+	// insert only if absent, two registrations racing with the same key
+	// can't both pass
+	c := &Credential{ID: pk.KeyID(), UserID: userID, PublicKey: pk}
+	inserted, err := s.store.Insert(c)
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		return nil, ErrCredentialExists
+	}
+
+	return c, nil
+}
+
+/*
+Issue challenge for the login of the user, fails if the random source does
+*/
+func (s *Server) BeginLogin(userID string) (string, error) {
+	return s.issue(userID, TypeGet)
+}
+
+/*
+Checks assertion of the authenticator and updates its signature counter
+*/
+func (s *Server) FinishLogin(userID string, resp *AssertionResponse) (*Credential, error) {
+	if err := s.checkClientData(resp.ClientDataJSON, userID, TypeGet); err != nil {
+		return nil, err
+	}
+
+	c, err := s.store.Get(resp.CredentialID)
+	if err != nil {
+		return nil, ErrUnknownCredential
+	}
+	if c.UserID != userID {
+		return nil, ErrUnknownCredential
+	}
+
+	if !verify(s.rpID, resp.Counter, resp.ClientDataJSON, resp.Signature, c.PublicKey) {
+		return nil, ErrBadSignature
+	}
+
+	// compare and set, two logins racing with the same counter can't both pass
+	for {
+		if resp.Counter <= c.Counter {
+			return nil, ErrCounter
+		}
+		swapped, err := s.store.SwapCounter(c.ID, c.Counter, resp.Counter)
+		if err != nil {
+			return nil, err
+		}
+		if swapped {
+			c.Counter = resp.Counter
+			return c, nil
+		}
+		if c, err = s.store.Get(c.ID); err != nil {
+			return nil, ErrUnknownCredential
+		}
+	}
+}
+
+func (s *Server) issue(userID, kind string) (string, error) {
+	var b [32]byte
+	if _, err := io.ReadFull(entropy.Reader, b[:]); err != nil {
+		return "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(b[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.queue.Expire(now, func(v string) {
+		// consumed challenges are already gone
+		if c, ok := s.challenges[v]; ok && now.After(c.expires) {
+			delete(s.challenges, v)
+		}
+	})
+	c := &challenge{userID, kind, now.Add(challengeTTL)}
+	s.challenges[value] = c
+	s.queue.Push(value, c.expires)
+
+	return value, nil
+}
+
+/*
+Parse client data and consume the challenge it refers to.
+Challenge is removed even if the other checks fail, so it can't be retried.
+*/
+func (s *Server) checkClientData(clientDataJSON []byte, userID, kind string) error {
+	var cd ClientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return ErrClientData
+	}
+
+	s.mu.Lock()
+	c, ok := s.challenges[cd.Challenge]
+	delete(s.challenges, cd.Challenge)
+	s.mu.Unlock()
+
+	if !ok || s.now().After(c.expires) || c.userID != userID {
+		return ErrUnknownChallenge
+	}
+	if cd.Type != kind || c.kind != kind {
+		return ErrClientData
+	}
+	if cd.Origin != s.origin {
+		return ErrOrigin
+	}
+
+	return nil
+}
+
+/*
+In-memory CredentialStore
+*/
+type MemoryStore struct {
+	mu          sync.Mutex
+	credentials map[string]Credential
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{credentials: make(map[string]Credential)}
+}
+
+func (m *MemoryStore) Get(credentialID string) (*Credential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.credentials[credentialID]
+	if !ok {
+		return nil, ErrUnknownCredential
+	}
+	return &c, nil
+}
+
+func (m *MemoryStore) Insert(c *Credential) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.credentials[c.ID]; ok {
+		return false, nil
+	}
+	m.credentials[c.ID] = *c
+	return true, nil
+}
+
+func (m *MemoryStore) SwapCounter(credentialID string, old, new uint32) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.credentials[credentialID]
+	if !ok {
+		return false, ErrUnknownCredential
+	}
+	if c.Counter != old {
+		return false, nil
+	}
+	c.Counter = new
+	m.credentials[credentialID] = c
+	return true, nil
+}
+
+/*
+Client side authenticator holding a single credential
+*/
+type Authenticator struct {
+	rpID    string
+	sk      *schnorr.SignatureKey
+	pk      *schnorr.PublicKey
+	counter uint32
+}
+
+func NewAuthenticator(rpID string, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Authenticator {
+	return &Authenticator{rpID: rpID, sk: sk, pk: pk}
+}
+
+/*
+Authenticator continuing from the counter of its last assertion, for clients
+which persist the key and the counter between sessions
+*/
+func NewAuthenticatorWithCounter(rpID string, sk *schnorr.SignatureKey, pk *schnorr.PublicKey, counter uint32) *Authenticator {
+	return &Authenticator{rpID: rpID, sk: sk, pk: pk, counter: counter}
+}
+
+/*
+Counter of the last assertion, to be persisted with the key
+*/
+func (a *Authenticator) Counter() uint32 {
+	return a.counter
+}
+
+func (a *Authenticator) CredentialID() string {
+	return a.pk.KeyID()
+}
+
+/*
+Answer registration challenge received from the server
+*/
+func (a *Authenticator) Register(challenge, origin string) (*RegistrationResponse, error) {
+	clientData := clientDataJSON(TypeCreate, challenge, origin)
+	signature, err := sign(a.rpID, 0, clientData, a.sk)
+	if err != nil {
+		return nil, err
+	}
+	return &RegistrationResponse{
+		ClientDataJSON: clientData,
+		PublicKey:      a.pk.Bytes(),
+		Signature:      signature,
+	}, nil
+}
+
+/*
+Answer login challenge received from the server
+*/
+func (a *Authenticator) Assert(challenge, origin string) (*AssertionResponse, error) {
+	clientData := clientDataJSON(TypeGet, challenge, origin)
+	signature, err := sign(a.rpID, a.counter+1, clientData, a.sk)
+	if err != nil {
+		return nil, err
+	}
+	a.counter++
+	return &AssertionResponse{
+		CredentialID:   a.CredentialID(),
+		ClientDataJSON: clientData,
+		Counter:        a.counter,
+		Signature:      signature,
+	}, nil
+}
+
+func clientDataJSON(kind, challenge, origin string) []byte {
+	// marshaling strings can't fail
+	b, _ := json.Marshal(ClientData{kind, challenge, origin})
+	return b
+}
+
+/*
+Signed data: H(rpID)||counter||H(clientDataJSON)
+*/
+func signedData(rpID string, counter uint32, clientDataJSON []byte) string {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	data := append(rpIDHash[:], 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[32:], counter)
+	return string(append(data, clientDataHash[:]...))
+}
+
+func sign(rpID string, counter uint32, clientDataJSON []byte, sk *schnorr.SignatureKey) ([]byte, error) {
+	signature, err := schnorr.TrySign(signedData(rpID, counter, clientDataJSON), sk)
+	if err != nil {
+		return nil, err
+	}
+	return signature.Bytes(), nil
+}
+
+func verify(rpID string, counter uint32, clientDataJSON, rawSignature []byte, pk *schnorr.PublicKey) bool {
+	signature, err := schnorr.ParseSignature(rawSignature)
+	if err != nil {
+		return false
+	}
+	return schnorr.VerifySignature(signedData(rpID, counter, clientDataJSON), signature, pk)
+}
@@ -0,0 +1,242 @@
+package passkey
+
+import (
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const (
+	rpID   = "example.com"
+	origin = "https://example.com"
+)
+
+func authenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthenticator(rpID, sk, pk)
+}
+
+func register(t *testing.T, s *Server, a *Authenticator, user string) *Credential {
+	t.Helper()
+	challenge, err := s.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Register(challenge, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.FinishRegistration(user, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func assert(t *testing.T, s *Server, a *Authenticator, user string) *AssertionResponse {
+	t.Helper()
+	challenge, err := s.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Assert(challenge, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCeremonies(t *testing.T) {
+	s := NewServer(rpID, origin, NewMemoryStore())
+	a := authenticator(t)
+	c := register(t, s, a, "alice")
+	if c.ID != a.CredentialID() {
+		t.Fatalf("credential %s, authenticator %s", c.ID, a.CredentialID())
+	}
+
+	for i := uint32(1); i <= 2; i++ {
+		c, err := s.FinishLogin("alice", assert(t, s, a, "alice"))
+		if err != nil || c.Counter != i {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+	if _, err := s.FinishLogin("bob", assert(t, s, a, "bob")); err != ErrUnknownCredential {
+		t.Errorf("login of another user: %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := NewServer(rpID, origin, NewMemoryStore())
+	a := authenticator(t)
+	register(t, s, a, "alice")
+
+	resp := assert(t, s, a, "alice")
+	if _, err := s.FinishLogin("alice", resp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishLogin("alice", resp); err != ErrUnknownChallenge {
+		t.Errorf("replayed assertion: %v", err)
+	}
+
+	// a registration response can't be replayed either, nor answer a login
+	challenge, err := s.BeginRegistration("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration, err := authenticator(t).Register(challenge, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishRegistration("alice", registration); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishRegistration("alice", registration); err != ErrUnknownChallenge {
+		t.Errorf("replayed registration: %v", err)
+	}
+}
+
+func TestCounterRollback(t *testing.T) {
+	store := NewMemoryStore()
+	s := NewServer(rpID, origin, store)
+	a := authenticator(t)
+	register(t, s, a, "alice")
+	for i := 0; i < 3; i++ {
+		if _, err := s.FinishLogin("alice", assert(t, s, a, "alice")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a clone of the authenticator made before the last logins
+	sk, pk := a.sk, a.pk
+	clone := NewAuthenticatorWithCounter(rpID, sk, pk, 1)
+	if _, err := s.FinishLogin("alice", assert(t, s, clone, "alice")); err != ErrCounter {
+		t.Errorf("rolled back counter: %v", err)
+	}
+	if c, _ := store.Get(a.CredentialID()); c.Counter != 3 {
+		t.Errorf("counter changed to %d", c.Counter)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	s := NewServer(rpID, origin, NewMemoryStore())
+	a := authenticator(t)
+
+	challenge, err := s.BeginRegistration("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Register(challenge, "https://example.com.evil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishRegistration("alice", resp); err != ErrOrigin {
+		t.Errorf("registration from another origin: %v", err)
+	}
+
+	register(t, s, a, "alice")
+	challenge, err = s.BeginLogin("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion, err := a.Assert(challenge, "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishLogin("alice", assertion); err != ErrOrigin {
+		t.Errorf("login from another origin: %v", err)
+	}
+}
+
+func TestTamperedSignature(t *testing.T) {
+	s := NewServer(rpID, origin, NewMemoryStore())
+	a := authenticator(t)
+	register(t, s, a, "alice")
+
+	resp := assert(t, s, a, "alice")
+	resp.Counter++
+	if _, err := s.FinishLogin("alice", resp); err != ErrBadSignature {
+		t.Errorf("changed counter: %v", err)
+	}
+	resp = assert(t, s, a, "alice")
+	resp.Signature = resp.Signature[:len(resp.Signature)-1]
+	if _, err := s.FinishLogin("alice", resp); err != ErrBadSignature {
+		t.Errorf("truncated signature: %v", err)
+	}
+	resp = assert(t, s, a, "alice")
+	resp.ClientDataJSON = []byte("{")
+	if _, err := s.FinishLogin("alice", resp); err != ErrClientData {
+		t.Errorf("malformed client data: %v", err)
+	}
+}
+
+/*
+Registrations of the same key racing each other, exactly one stores it
+*/
+func TestConcurrentRegistration(t *testing.T) {
+	s := NewServer(rpID, origin, NewMemoryStore())
+	a := authenticator(t)
+
+	const n = 8
+	responses := make([]*RegistrationResponse, n)
+	for i := range responses {
+		challenge, err := s.BeginRegistration("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if responses[i], err = a.Register(challenge, origin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.FinishRegistration("alice", responses[i])
+		}(i)
+	}
+	wg.Wait()
+
+	registered := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			registered++
+		case ErrCredentialExists:
+		default:
+			t.Error(err)
+		}
+	}
+	if registered != 1 {
+		t.Errorf("credential registered %d times", registered)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("random source failed")
+}
+
+func TestEntropyFailure(t *testing.T) {
+	s := NewServer(rpID, origin, NewMemoryStore())
+	entropy.SetSource(failingReader{})
+	t.Cleanup(func() { entropy.SetSource(rand.Reader) })
+
+	if _, err := s.BeginRegistration("alice"); err == nil {
+		t.Error("registration challenge without randomness")
+	}
+	if _, err := s.BeginLogin("alice"); err == nil {
+		t.Error("login challenge without randomness")
+	}
+}
@@ -0,0 +1,462 @@
+/*
+Device provisioning for manufacturing.
+
+A fleet operator keeps an offline root key and certifies a factory
+intermediate key for each production line with IssueIntermediate. At the
+line, Factory generates a key for every device, hands the private key to the
+caller to inject into the device and attests the public key with the
+intermediate, which gives the provisioning record:
+
+	serial, device public key, time of provisioning, intermediate certificate, attestation
+
+Records are encoded with Bytes and shipped with the device or uploaded to the
+fleet backend. When a device connects the first time, the fleet Verifier
+checks the chain (root -> intermediate -> device key) and that the device
+holds the private key of the record by a signature of a fresh challenge:
+
+	v := provision.NewVerifier(root)
+	nonce, err := v.Challenge()
+	proof, err := provision.ProveConnect(record.Serial, nonce, deviceKey) // on the device
+	device, err := v.FirstConnect(record, nonce, proof)
+
+Signed messages:
+
+	intermediate: "schnorr/provision/intermediate" || len(name)||name || len(pk)||pk || notBefore || notAfter
+	attestation:  "schnorr/provision/device" || len(serial)||serial || len(pk)||pk || provisioned || len(intermediate pk)||intermediate pk
+	connect:      "schnorr/provision/connect" || len(serial)||serial || len(nonce)||nonce
+
+with 4 byte lengths, keys in the PublicKey.Bytes encoding and times as 8 byte
+unix seconds. The validity of the intermediate limits when it can provision
+devices; devices provisioned inside it stay valid after it expires.
+*/
+package provision
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrUntrustedRoot  = errors.New("provision: intermediate isn't issued by a trusted root")
+	ErrIntermediate   = errors.New("provision: invalid intermediate certificate")
+	ErrRevoked        = errors.New("provision: intermediate has been revoked")
+	ErrAttestation    = errors.New("provision: invalid device attestation")
+	ErrProof          = errors.New("provision: device doesn't hold the key of the record")
+	ErrSerialConflict = errors.New("provision: serial is enrolled with another key")
+	ErrMalformed      = errors.New("provision: malformed encoding")
+)
+
+const (
+	intermediateDomain = "schnorr/provision/intermediate"
+	deviceDomain       = "schnorr/provision/device"
+	connectDomain      = "schnorr/provision/connect"
+
+	encodingVersion   = 1
+	nonceSize         = 32
+	challengeLifetime = 5 * time.Minute
+)
+
+/*
+Factory intermediate key certified by the root
+*/
+type Intermediate struct {
+	Name      string // e.g. production line, "plant-3/line-1"
+	Key       *schnorr.PublicKey
+	NotBefore time.Time // provisioning window of the intermediate
+	NotAfter  time.Time
+	Signature *schnorr.Signature // by the root
+}
+
+/*
+Certify the factory intermediate key with the root key
+*/
+func IssueIntermediate(root *schnorr.SignatureKey, name string, key *schnorr.PublicKey, notBefore, notAfter time.Time) (*Intermediate, error) {
+	if name == "" || key == nil || !notBefore.Before(notAfter) {
+		return nil, ErrIntermediate
+	}
+	c := &Intermediate{Name: name, Key: key, NotBefore: notBefore.Truncate(time.Second), NotAfter: notAfter.Truncate(time.Second)}
+	signature, err := schnorr.TrySign(c.message(), root)
+	if err != nil {
+		return nil, err
+	}
+	c.Signature = signature
+	return c, nil
+}
+
+func (c *Intermediate) message() string {
+	m := appendField([]byte(intermediateDomain), []byte(c.Name))
+	m = appendField(m, c.Key.Bytes())
+	m = binary.BigEndian.AppendUint64(m, uint64(c.NotBefore.Unix()))
+	return string(binary.BigEndian.AppendUint64(m, uint64(c.NotAfter.Unix())))
+}
+
+/*
+Provisioning record of a device
+*/
+type Record struct {
+	Serial       string
+	Key          *schnorr.PublicKey // device key
+	Provisioned  time.Time
+	Intermediate *Intermediate
+	Attestation  *schnorr.Signature // by the intermediate
+}
+
+func (r *Record) message() string {
+	m := appendField([]byte(deviceDomain), []byte(r.Serial))
+	m = appendField(m, r.Key.Bytes())
+	m = binary.BigEndian.AppendUint64(m, uint64(r.Provisioned.Unix()))
+	return string(appendField(m, r.Intermediate.Key.Bytes()))
+}
+
+/*
+Options of NewFactory, zero values select the defaults
+*/
+type FactoryOptions struct {
+	// Source of the device keys, e.g. a schnorr.KeygenService for a group per
+	// device; default keys in the registered 256-bit group
+	Keygen func() (*schnorr.SignatureKey, *schnorr.PublicKey, error)
+	// Called with every record before it's returned, e.g. to upload it to the
+	// fleet backend; an error fails the provisioning of the device
+	OnRecord func(*Record) error
+}
+
+/*
+Provisioning station holding the intermediate key
+*/
+type Factory struct {
+	key  *schnorr.SignatureKey
+	cert *Intermediate
+	opts FactoryOptions
+}
+
+/*
+Factory attesting with key, the private key of cert.Key
+*/
+func NewFactory(key *schnorr.SignatureKey, cert *Intermediate, opts FactoryOptions) (*Factory, error) {
+	pk, err := key.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil || cert.Key == nil || pk.KeyID() != cert.Key.KeyID() {
+		return nil, fmt.Errorf("%w: certificate isn't for the factory key", ErrIntermediate)
+	}
+	if opts.Keygen == nil {
+		opts.Keygen = func() (*schnorr.SignatureKey, *schnorr.PublicKey, error) {
+			return schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+		}
+	}
+	return &Factory{key, cert, opts}, nil
+}
+
+/*
+Generate the key of the device and attest it. The private key is returned for
+injection into the device; zeroize it once it's written.
+*/
+func (f *Factory) Provision(serial string) (*Record, *schnorr.SignatureKey, error) {
+	sk, pk, err := f.opts.Keygen()
+	if err != nil {
+		return nil, nil, err
+	}
+	record, err := f.Attest(serial, pk)
+	if err != nil {
+		sk.Zeroize()
+		return nil, nil, err
+	}
+	return record, sk, nil
+}
+
+/*
+Attest a key generated by the device itself, the private key never leaves it
+*/
+func (f *Factory) Attest(serial string, pk *schnorr.PublicKey) (*Record, error) {
+	now := schnorr.Now().Truncate(time.Second)
+	if serial == "" || pk == nil {
+		return nil, ErrAttestation
+	}
+	if now.Before(f.cert.NotBefore) || now.After(f.cert.NotAfter) {
+		return nil, fmt.Errorf("%w: outside of the provisioning window", ErrIntermediate)
+	}
+	r := &Record{Serial: serial, Key: pk, Provisioned: now, Intermediate: f.cert}
+	attestation, err := schnorr.TrySign(r.message(), f.key)
+	if err != nil {
+		return nil, err
+	}
+	r.Attestation = attestation
+	if f.opts.OnRecord != nil {
+		if err := f.opts.OnRecord(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+/*
+Signature of the device over the connect challenge
+*/
+func ProveConnect(serial string, nonce []byte, sk *schnorr.SignatureKey) (*schnorr.Signature, error) {
+	return schnorr.TrySign(connectMessage(serial, nonce), sk)
+}
+
+func connectMessage(serial string, nonce []byte) string {
+	return string(appendField(appendField([]byte(connectDomain), []byte(serial)), nonce))
+}
+
+/*
+Device accepted by the fleet
+*/
+type Device struct {
+	Serial       string
+	Key          *schnorr.PublicKey
+	Provisioned  time.Time
+	Intermediate string // name of the intermediate which attested the key
+}
+
+/*
+Fleet-side verifier of provisioning records
+*/
+type Verifier struct {
+	mu       sync.Mutex
+	roots    map[string]*schnorr.PublicKey // by key ID
+	revoked  map[string]bool               // intermediate key IDs
+	enrolled map[string]string             // serial -> device key ID
+	pending  map[string]time.Time          // outstanding challenges and their expiry
+}
+
+func NewVerifier(roots ...*schnorr.PublicKey) *Verifier {
+	v := &Verifier{
+		roots:    make(map[string]*schnorr.PublicKey),
+		revoked:  make(map[string]bool),
+		enrolled: make(map[string]string),
+		pending:  make(map[string]time.Time),
+	}
+	for _, root := range roots {
+		v.roots[root.KeyID()] = root
+	}
+	return v
+}
+
+/*
+Reject records attested by the intermediate key, e.g. of a compromised line.
+Devices already enrolled stay enrolled.
+*/
+func (v *Verifier) Revoke(intermediateKeyID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.revoked[intermediateKeyID] = true
+}
+
+/*
+Check the chain of the record: the intermediate is certified by a trusted
+root and not revoked, the device was provisioned inside its window and the
+attestation of the device key is valid
+*/
+func (v *Verifier) Verify(r *Record) error {
+	if r == nil || r.Key == nil || r.Intermediate == nil || r.Intermediate.Key == nil ||
+		r.Intermediate.Signature == nil || r.Attestation == nil {
+		return ErrMalformed
+	}
+	c := r.Intermediate
+	v.mu.Lock()
+	revoked := v.revoked[c.Key.KeyID()]
+	roots := make([]*schnorr.PublicKey, 0, len(v.roots))
+	for _, root := range v.roots {
+		roots = append(roots, root)
+	}
+	v.mu.Unlock()
+
+	trusted := false
+	for _, root := range roots {
+		if schnorr.VerifySignatureAt(c.message(), c.Signature, root, c.NotBefore) {
+			trusted = true
+			break
+		}
+	}
+	switch {
+	case !trusted:
+		return ErrUntrustedRoot
+	case revoked:
+		return ErrRevoked
+	case r.Provisioned.Before(c.NotBefore) || r.Provisioned.After(c.NotAfter):
+		return fmt.Errorf("%w: provisioned outside of the intermediate's window", ErrAttestation)
+	case r.Provisioned.After(schnorr.Now()):
+		return fmt.Errorf("%w: provisioned in the future", ErrAttestation)
+	case !schnorr.VerifySignature(r.message(), r.Attestation, c.Key):
+		return ErrAttestation
+	}
+	return nil
+}
+
+/*
+Fresh challenge for a connecting device, valid for one FirstConnect within
+five minutes
+*/
+func (v *Verifier) Challenge() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(entropy.Reader, nonce); err != nil {
+		return nil, err
+	}
+	now := schnorr.Now()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for pending, expiry := range v.pending {
+		if now.After(expiry) {
+			delete(v.pending, pending)
+		}
+	}
+	v.pending[string(nonce)] = now.Add(challengeLifetime)
+	return nonce, nil
+}
+
+/*
+Verify the record and the device's proof of possession over a challenge
+issued by Challenge, and enroll the device. A device connecting again with
+the same record is accepted, another key under an enrolled serial isn't.
+*/
+func (v *Verifier) FirstConnect(r *Record, nonce []byte, proof *schnorr.Signature) (*Device, error) {
+	v.mu.Lock()
+	expiry, issued := v.pending[string(nonce)]
+	delete(v.pending, string(nonce))
+	v.mu.Unlock()
+	if !issued || schnorr.Now().After(expiry) {
+		return nil, fmt.Errorf("%w: unknown or used challenge", ErrProof)
+	}
+
+	if err := v.Verify(r); err != nil {
+		return nil, err
+	}
+	if !schnorr.VerifySignature(connectMessage(r.Serial, nonce), proof, r.Key) {
+		return nil, ErrProof
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keyID := r.Key.KeyID()
+	if enrolled, ok := v.enrolled[r.Serial]; ok && enrolled != keyID {
+		return nil, ErrSerialConflict
+	}
+	v.enrolled[r.Serial] = keyID
+	return &Device{r.Serial, r.Key, r.Provisioned, r.Intermediate.Name}, nil
+}
+
+/*
+Encoding: version (1) || len(name) || name || len(pk) || pk || notBefore || notAfter || len(signature) || signature
+*/
+func (c *Intermediate) Bytes() []byte {
+	b := appendField([]byte{encodingVersion}, []byte(c.Name))
+	b = appendField(b, c.Key.Bytes())
+	b = binary.BigEndian.AppendUint64(b, uint64(c.NotBefore.Unix()))
+	b = binary.BigEndian.AppendUint64(b, uint64(c.NotAfter.Unix()))
+	return appendField(b, c.Signature.Bytes())
+}
+
+func ParseIntermediate(b []byte) (*Intermediate, error) {
+	if len(b) < 1 || b[0] != encodingVersion {
+		return nil, ErrMalformed
+	}
+	name, b, err := readField(b[1:])
+	if err != nil {
+		return nil, err
+	}
+	key, b, err := readField(b)
+	if err != nil || len(b) < 16 {
+		return nil, ErrMalformed
+	}
+	notBefore, notAfter := unixTime(b), unixTime(b[8:])
+	signature, err := readLast(b[16:])
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Intermediate{Name: string(name), NotBefore: notBefore, NotAfter: notAfter}
+	if c.Key, err = schnorr.ParsePublicKey(key); err != nil {
+		return nil, ErrMalformed
+	}
+	if c.Signature, err = schnorr.ParseSignature(signature); err != nil {
+		return nil, ErrMalformed
+	}
+	return c, nil
+}
+
+/*
+Encoding: version (1) || len(serial) || serial || len(pk) || pk || provisioned || len(intermediate) || intermediate || len(attestation) || attestation
+*/
+func (r *Record) Bytes() []byte {
+	b := appendField([]byte{encodingVersion}, []byte(r.Serial))
+	b = appendField(b, r.Key.Bytes())
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Provisioned.Unix()))
+	b = appendField(b, r.Intermediate.Bytes())
+	return appendField(b, r.Attestation.Bytes())
+}
+
+func ParseRecord(b []byte) (*Record, error) {
+	if len(b) < 1 || b[0] != encodingVersion {
+		return nil, ErrMalformed
+	}
+	serial, b, err := readField(b[1:])
+	if err != nil {
+		return nil, err
+	}
+	key, b, err := readField(b)
+	if err != nil || len(b) < 8 {
+		return nil, ErrMalformed
+	}
+	provisioned := unixTime(b)
+	intermediate, b, err := readField(b[8:])
+	if err != nil {
+		return nil, err
+	}
+	attestation, err := readLast(b)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Record{Serial: string(serial), Provisioned: provisioned}
+	if r.Key, err = schnorr.ParsePublicKey(key); err != nil {
+		return nil, ErrMalformed
+	}
+	if r.Intermediate, err = ParseIntermediate(intermediate); err != nil {
+		return nil, err
+	}
+	if r.Attestation, err = schnorr.ParseSignature(attestation); err != nil {
+		return nil, ErrMalformed
+	}
+	return r, nil
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, ErrMalformed
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, ErrMalformed
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
+
+/*
+Last field, nothing may follow it
+*/
+func readLast(b []byte) ([]byte, error) {
+	field, rest, err := readField(b)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrMalformed
+	}
+	return field, nil
+}
+
+func unixTime(b []byte) time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint64(b)), 0)
+}
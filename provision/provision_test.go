@@ -0,0 +1,284 @@
+package provision
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var start = time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk
+}
+
+/*
+Root, a factory certified for a month and a verifier trusting the root, at
+start on a manual clock
+*/
+func setup(t *testing.T) (*Factory, *Verifier, *schnorr.ManualClock, *schnorr.SignatureKey) {
+	t.Helper()
+	clock := schnorr.NewManualClock(start)
+	schnorr.SetClock(clock)
+	t.Cleanup(func() { schnorr.SetClock(nil) })
+
+	rootSK, rootPK := keys(t)
+	lineSK, linePK := keys(t)
+	cert, err := IssueIntermediate(rootSK, "plant-3/line-1", linePK, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFactory(lineSK, cert, FactoryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, NewVerifier(rootPK), clock, rootSK
+}
+
+func connect(t *testing.T, v *Verifier, r *Record, sk *schnorr.SignatureKey) (*Device, error) {
+	t.Helper()
+	nonce, err := v.Challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := ProveConnect(r.Serial, nonce, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.FirstConnect(r, nonce, proof)
+}
+
+func TestProvisioning(t *testing.T) {
+	f, v, clock, _ := setup(t)
+	var uploaded []*Record
+	f.opts.OnRecord = func(r *Record) error {
+		uploaded = append(uploaded, r)
+		return nil
+	}
+	r, sk, err := f.Provision("SN-0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != 1 || uploaded[0] != r {
+		t.Errorf("%d records uploaded", len(uploaded))
+	}
+
+	// the device connects after the intermediate expired
+	clock.Advance(60 * 24 * time.Hour)
+	parsed, err := ParseRecord(r.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := connect(t, v, parsed, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Serial != "SN-0001" || !d.Key.Equal(r.Key) || d.Intermediate != "plant-3/line-1" || !d.Provisioned.Equal(start) {
+		t.Errorf("device %+v", d)
+	}
+	if _, err := connect(t, v, r, sk); err != nil {
+		t.Errorf("connecting again: %v", err)
+	}
+
+	// a key generated by the device itself
+	clock.Set(start.Add(time.Hour))
+	deviceSK, devicePK := keys(t)
+	r, err = f.Attest("SN-0002", devicePK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connect(t, v, r, deviceSK); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	f, v, clock, rootSK := setup(t)
+	r, _, err := f.Provision("SN-0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an intermediate certified by another root
+	otherRoot, _ := keys(t)
+	forged := *r
+	forgedCert := *r.Intermediate
+	if forged.Intermediate, err = IssueIntermediate(otherRoot, forgedCert.Name, forgedCert.Key, forgedCert.NotBefore, forgedCert.NotAfter); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(&forged); err != ErrUntrustedRoot {
+		t.Errorf("intermediate of another root: %v", err)
+	}
+	widened := *r
+	widenedCert := *r.Intermediate
+	widenedCert.NotAfter = widenedCert.NotAfter.AddDate(1, 0, 0)
+	widened.Intermediate = &widenedCert
+	if err := v.Verify(&widened); err != ErrUntrustedRoot {
+		t.Errorf("widened window: %v", err)
+	}
+
+	// a record changed after the attestation
+	_, otherPK := keys(t)
+	for name, change := range map[string]func(*Record){
+		"serial":      func(r *Record) { r.Serial = "SN-0002" },
+		"key":         func(r *Record) { r.Key = otherPK },
+		"provisioned": func(r *Record) { r.Provisioned = r.Provisioned.Add(time.Hour) },
+	} {
+		changed := *r
+		change(&changed)
+		if err := v.Verify(&changed); !errors.Is(err, ErrAttestation) {
+			t.Errorf("changed %s: %v", name, err)
+		}
+	}
+	if err := v.Verify(&Record{Serial: "SN-0001", Key: r.Key}); err != ErrMalformed {
+		t.Errorf("record without chain: %v", err)
+	}
+
+	// provisioning outside of the window of the intermediate
+	early, err := IssueIntermediate(rootSK, "plant-3/line-2", f.cert.Key, start.Add(time.Hour), start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backdated := *r
+	backdated.Intermediate = early
+	backdated.Attestation, err = schnorr.TrySign(backdated.message(), f.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(&backdated); !errors.Is(err, ErrAttestation) {
+		t.Errorf("provisioned before the window: %v", err)
+	}
+	clock.Advance(40 * 24 * time.Hour)
+	if _, err := f.Attest("SN-0003", otherPK); !errors.Is(err, ErrIntermediate) {
+		t.Errorf("attestation after the window: %v", err)
+	}
+
+	v.Revoke(f.cert.Key.KeyID())
+	if err := v.Verify(r); err != ErrRevoked {
+		t.Errorf("revoked intermediate: %v", err)
+	}
+}
+
+func TestFirstConnect(t *testing.T) {
+	f, v, clock, _ := setup(t)
+	r, sk, err := f.Provision("SN-0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := v.Challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a clone without the private key, or a proof for another serial
+	cloneSK, _ := keys(t)
+	proof, err := ProveConnect(r.Serial, nonce, cloneSK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.FirstConnect(r, nonce, proof); err != ErrProof {
+		t.Errorf("proof of another key: %v", err)
+	}
+	if nonce, err = v.Challenge(); err != nil {
+		t.Fatal(err)
+	}
+	if proof, err = ProveConnect("SN-0002", nonce, sk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.FirstConnect(r, nonce, proof); err != ErrProof {
+		t.Errorf("proof for another serial: %v", err)
+	}
+
+	// challenges are used once and expire
+	if nonce, err = v.Challenge(); err != nil {
+		t.Fatal(err)
+	}
+	if proof, err = ProveConnect(r.Serial, nonce, sk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.FirstConnect(r, nonce, proof); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.FirstConnect(r, nonce, proof); !errors.Is(err, ErrProof) {
+		t.Errorf("replayed challenge: %v", err)
+	}
+	if nonce, err = v.Challenge(); err != nil {
+		t.Fatal(err)
+	}
+	if proof, err = ProveConnect(r.Serial, nonce, sk); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(challengeLifetime + time.Second)
+	if _, err := v.FirstConnect(r, nonce, proof); !errors.Is(err, ErrProof) {
+		t.Errorf("expired challenge: %v", err)
+	}
+	if _, err := v.FirstConnect(r, make([]byte, nonceSize), proof); !errors.Is(err, ErrProof) {
+		t.Errorf("challenge never issued: %v", err)
+	}
+
+	// the line provisions a second key under the enrolled serial
+	clock.Set(start.Add(time.Hour))
+	duplicate, duplicateSK, err := f.Provision("SN-0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connect(t, v, duplicate, duplicateSK); err != ErrSerialConflict {
+		t.Errorf("second key under the serial: %v", err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	f, _, _, _ := setup(t)
+	r, _, err := f.Provision("SN-0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseIntermediate(f.cert.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Name != f.cert.Name || !cert.NotAfter.Equal(f.cert.NotAfter) || !cert.Key.Equal(f.cert.Key) {
+		t.Errorf("parsed intermediate %+v", cert)
+	}
+
+	b := r.Bytes()
+	for name, bad := range map[string][]byte{
+		"empty":        nil,
+		"version":      append([]byte{2}, b[1:]...),
+		"truncated":    b[:len(b)-1],
+		"trailing":     append(append([]byte(nil), b...), 0),
+		"serial":       append([]byte{encodingVersion, 0xff, 0xff, 0xff, 0xff}, b[5:]...),
+		"intermediate": append(appendField(appendField(appendField([]byte{encodingVersion}, []byte(r.Serial)), r.Key.Bytes()), make([]byte, 8)), appendField(appendField(nil, []byte{9}), r.Attestation.Bytes())...),
+	} {
+		if _, err := ParseRecord(bad); err != ErrMalformed {
+			t.Errorf("%s record: %v", name, err)
+		}
+	}
+	c := f.cert.Bytes()
+	for name, bad := range map[string][]byte{
+		"truncated": c[:len(c)-1],
+		"times":     c[:1+4+len(f.cert.Name)+4+len(f.cert.Key.Bytes())+15],
+	} {
+		if _, err := ParseIntermediate(bad); err != ErrMalformed {
+			t.Errorf("%s intermediate: %v", name, err)
+		}
+	}
+
+	_, otherPK := keys(t)
+	if _, err := NewFactory(f.key, &Intermediate{Name: "x", Key: otherPK}, FactoryOptions{}); !errors.Is(err, ErrIntermediate) {
+		t.Errorf("factory with the certificate of another key: %v", err)
+	}
+	if _, err := IssueIntermediate(f.key, "x", otherPK, start, start); err != ErrIntermediate {
+		t.Errorf("empty window: %v", err)
+	}
+	if _, err := f.Attest("", otherPK); err != ErrAttestation {
+		t.Errorf("empty serial: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package pubsub
+
+import (
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Publish function of the messaging client, e.g.
+
+	nc.Publish                                      // NATS
+	func(t string, p []byte) error {               // MQTT (paho)
+		return client.Publish(t, 1, false, p).Error()
+	}
+*/
+type PublishFunc func(subject string, data []byte) error
+
+/*
+Handler receiving raw messages from the messaging client
+*/
+type Handler func(subject string, data []byte)
+
+/*
+Handler receiving verified payloads together with the ID of the signer key
+*/
+type VerifiedHandler func(subject, keyID string, payload []byte)
+
+/*
+Called for every message which failed verification
+*/
+type ErrorHandler func(subject string, data []byte, err error)
+
+/*
+Wraps publish function, so every payload is sent in a signed envelope.
+Subject is bound into the signature, so a message can't be replayed on another subject.
+*/
+func SignedPublisher(publish PublishFunc, sk *schnorr.SignatureKey, pk *schnorr.PublicKey) PublishFunc {
+	return func(subject string, payload []byte) error {
+		sealed, err := envelope.Seal(payload, []byte(subject), sk, pk)
+		if err != nil {
+			return err
+		}
+		data, err := sealed.Marshal()
+		if err != nil {
+			return err
+		}
+		return publish(subject, data)
+	}
+}
+
+/*
+Wraps message handler, so only messages with valid signatures are passed to next.
+Invalid messages are reported to onError (which may be nil).
+*/
+func VerifyingHandler(keys envelope.KeyResolver, next VerifiedHandler, onError ErrorHandler) Handler {
+	return func(subject string, data []byte) {
+		e, err := envelope.Open(data, []byte(subject), keys)
+		if err != nil {
+			if onError != nil {
+				onError(subject, data, err)
+			}
+			return
+		}
+		next(subject, e.KeyID, e.Payload)
+	}
+}
@@ -0,0 +1,115 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+In-process broker delivering every message to the handler, as NATS or MQTT
+do after a publish
+*/
+type broker struct {
+	handler  Handler
+	rejected []error
+}
+
+func setup(t *testing.T) (PublishFunc, *broker, *[]string) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := envelope.KeyMap{}
+	keys.Add(pk)
+
+	b := &broker{}
+	var received []string
+	b.handler = VerifyingHandler(keys, func(subject, keyID string, payload []byte) {
+		if keyID != pk.KeyID() {
+			t.Errorf("message of key %q", keyID)
+		}
+		received = append(received, subject+" "+string(payload))
+	}, func(subject string, data []byte, err error) {
+		b.rejected = append(b.rejected, err)
+	})
+	publish := SignedPublisher(func(subject string, data []byte) error {
+		b.handler(subject, data)
+		return nil
+	}, sk, pk)
+	return publish, b, &received
+}
+
+func TestRoundTrip(t *testing.T) {
+	publish, b, received := setup(t)
+	for _, subject := range []string{"orders.created", "orders.paid"} {
+		if err := publish(subject, []byte("order-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*received) != 2 || (*received)[1] != "orders.paid order-1" || len(b.rejected) != 0 {
+		t.Fatalf("received %q, rejected %v", *received, b.rejected)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	var captured []byte
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish := SignedPublisher(func(_ string, data []byte) error {
+		captured = data
+		return nil
+	}, sk, pk)
+	if err := publish("orders.created", []byte("order-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, b, received := setup(t)
+	keys := envelope.KeyMap{}
+	keys.Add(pk)
+	var rejected []error
+	handler := VerifyingHandler(keys, func(subject, _ string, payload []byte) {
+		*received = append(*received, subject)
+	}, func(_ string, _ []byte, err error) {
+		rejected = append(rejected, err)
+	})
+
+	// replayed on another subject
+	handler("orders.refunded", captured)
+	changed := append([]byte(nil), captured...)
+	changed[len(changed)-1] ^= 1
+	handler("orders.created", changed)
+	// a message of an unknown key
+	b.handler("orders.created", captured)
+
+	if len(*received) != 0 || len(rejected) != 2 || len(b.rejected) != 1 {
+		t.Fatalf("received %q, rejected %v and %v", *received, rejected, b.rejected)
+	}
+	for _, err := range rejected {
+		if err != envelope.ErrBadSignature {
+			t.Errorf("tampered message: %v", err)
+		}
+	}
+	if b.rejected[0] != envelope.ErrUnknownKey {
+		t.Errorf("message of an unknown key: %v", b.rejected[0])
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	_, b, received := setup(t)
+	for _, data := range [][]byte{nil, {9, 9}, {1, 200}} {
+		b.handler("orders.created", data)
+	}
+	if len(*received) != 0 || len(b.rejected) != 3 {
+		t.Fatalf("received %q, rejected %v", *received, b.rejected)
+	}
+
+	// without an error handler malformed messages are dropped silently
+	VerifyingHandler(envelope.KeyMap{}, func(string, string, []byte) {
+		t.Error("malformed message delivered")
+	}, nil)("orders.created", []byte{1})
+}
@@ -0,0 +1,427 @@
+package records
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrIncomplete      = errors.New("records: records are still being signed")
+	ErrInvalidManifest = errors.New("records: invalid manifest encoding")
+	ErrBadManifest     = errors.New("records: invalid manifest signature")
+	ErrCount           = errors.New("records: dataset size differs from the manifest")
+	ErrRoot            = errors.New("records: records don't match the manifest's Merkle root")
+)
+
+/*
+Signed record produced by the Signer
+*/
+type SignedRecord struct {
+	Index     uint64             // position of the record in the dataset
+	Signature *schnorr.Signature // signature over H(fileID||index||record)
+}
+
+/*
+Streaming record signer.
+Every record is signed separately, but the signed message is chained to the
+dataset context (file ID and row index), so records can't be moved between
+files or reordered inside a single file without invalidating signatures.
+Records dropped from the end or appended are caught with the Manifest, which
+signs the record count and the Merkle root over all record messages.
+*/
+type Signer struct {
+	fileID string
+	sk     *schnorr.SignatureKey
+	next   atomic.Uint64
+
+	mu   sync.Mutex
+	tree tree
+	// leaves of records signed ahead of an unfinished one, by index
+	pending map[uint64][]byte
+}
+
+/*
+Create signer for the dataset identified by fileID
+*/
+func NewSigner(fileID string, sk *schnorr.SignatureKey) *Signer {
+	return &Signer{fileID: fileID, sk: sk}
+}
+
+/*
+Sign next record of the dataset
+*/
+func (s *Signer) Sign(record []byte) (*SignedRecord, error) {
+	index := s.next.Add(1) - 1
+
+	m := Message(s.fileID, index, record)
+	signature, err := schnorr.TrySign(m, s.sk)
+	if err != nil {
+		return nil, err
+	}
+	s.addLeaf(index, leafHash(m))
+	return &SignedRecord{index, signature}, nil
+}
+
+/*
+Add the leaf of the record to the tree, in index order
+*/
+func (s *Signer) addLeaf(index uint64, leaf []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if index != s.tree.size {
+		if s.pending == nil {
+			s.pending = make(map[uint64][]byte)
+		}
+		s.pending[index] = leaf
+		return
+	}
+	s.tree.add(leaf)
+	for {
+		next, ok := s.pending[s.tree.size]
+		if !ok {
+			return
+		}
+		delete(s.pending, s.tree.size)
+		s.tree.add(next)
+	}
+}
+
+/*
+Signed manifest of the records signed so far. Fails with ErrIncomplete while
+a Sign call is in progress or failed (its index has no record).
+*/
+func (s *Signer) Manifest() (*Manifest, error) {
+	s.mu.Lock()
+	count, root := s.tree.size, s.tree.root()
+	s.mu.Unlock()
+	if count != s.next.Load() {
+		return nil, ErrIncomplete
+	}
+
+	m := &Manifest{FileID: s.fileID, Count: count, Root: root}
+	signature, err := schnorr.TrySign(m.message(), s.sk)
+	if err != nil {
+		return nil, err
+	}
+	m.Signature = signature
+	return m, nil
+}
+
+/*
+Number of records signed so far
+*/
+func (s *Signer) Count() uint64 {
+	return s.next.Load()
+}
+
+/*
+Read all rows from the CSV reader and sign them one by one.
+emit is called for every row together with its signature, so the whole
+dataset never has to be kept in memory.
+*/
+func (s *Signer) SignCSV(r *csv.Reader, emit func(row []string, signed *SignedRecord) error) error {
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		signed, err := s.Sign(EncodeRow(row))
+		if err != nil {
+			return err
+		}
+		if err := emit(row, signed); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+Verify signature of a single record
+*/
+func Verify(fileID string, index uint64, record []byte, signature *schnorr.Signature, publicKey *schnorr.PublicKey) bool {
+	return schnorr.VerifySignature(Message(fileID, index, record), signature, publicKey)
+}
+
+/*
+Signed summary of the dataset: number of records and the Merkle tree hash
+(RFC 6962) over the record messages, leaf_i = SHA256(0x00 || Message(fileID, i, record_i))
+*/
+type Manifest struct {
+	FileID    string
+	Count     uint64
+	Root      []byte
+	Signature *schnorr.Signature
+}
+
+/*
+Signed message: "schnorr/records/manifest" || len(fileID) || fileID || count || root
+*/
+func (m *Manifest) message() string {
+	b := append([]byte("schnorr/records/manifest"), binary.BigEndian.AppendUint32(nil, uint32(len(m.FileID)))...)
+	b = append(b, m.FileID...)
+	b = binary.BigEndian.AppendUint64(b, m.Count)
+	return string(append(b, m.Root...))
+}
+
+/*
+Check the signature of the manifest
+*/
+func (m *Manifest) Verify(publicKey *schnorr.PublicKey) error {
+	if m == nil || len(m.Root) != sha256.Size || m.Signature == nil {
+		return ErrInvalidManifest
+	}
+	if !schnorr.VerifySignature(m.message(), m.Signature, publicKey) {
+		return ErrBadManifest
+	}
+	return nil
+}
+
+/*
+Encoding: the signed message without the domain tag, then the signature
+*/
+func (m *Manifest) Bytes() []byte {
+	b := []byte(m.message()[len("schnorr/records/manifest"):])
+	return append(b, m.Signature.Bytes()...)
+}
+
+func ParseManifest(b []byte) (*Manifest, error) {
+	if len(b) < 4 {
+		return nil, ErrInvalidManifest
+	}
+	n := int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if len(b) < n+8+sha256.Size {
+		return nil, ErrInvalidManifest
+	}
+	m := &Manifest{FileID: string(b[:n])}
+	b = b[n:]
+	m.Count = binary.BigEndian.Uint64(b)
+	m.Root = append([]byte(nil), b[8:8+sha256.Size]...)
+	signature, err := schnorr.ParseSignature(b[8+sha256.Size:])
+	if err != nil {
+		return nil, ErrInvalidManifest
+	}
+	m.Signature = signature
+	return m, nil
+}
+
+/*
+Random access to the signed dataset, used by the sampling verifier
+*/
+type Source interface {
+	Len() uint64
+	Record(index uint64) (record []byte, signature *schnorr.Signature, err error)
+}
+
+/*
+Result of the sample verification
+*/
+type Report struct {
+	Checked []uint64 // indexes of verified records
+	Failed  []uint64 // indexes of records with invalid signature
+}
+
+/*
+Returns true if all sampled records were valid
+*/
+func (r *Report) OK() bool {
+	return len(r.Failed) == 0
+}
+
+/*
+Verify n randomly chosen records of the dataset.
+If n is greater or equal to the dataset size every record is verified.
+*/
+func VerifySample(fileID string, src Source, publicKey *schnorr.PublicKey, n uint64) (*Report, error) {
+	indexes, err := sample(src.Len(), n)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	for _, i := range indexes {
+		record, signature, err := src.Record(i)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Checked = append(report.Checked, i)
+		if !Verify(fileID, i, record, signature, publicKey) {
+			report.Failed = append(report.Failed, i)
+		}
+	}
+
+	return report, nil
+}
+
+/*
+VerifySample for a dataset with a manifest: the manifest is checked and the
+dataset has to have its record count, so truncated or extended datasets fail
+with ErrCount even when no sampled record is affected
+*/
+func VerifySampleManifest(src Source, manifest *Manifest, publicKey *schnorr.PublicKey, n uint64) (*Report, error) {
+	if err := manifest.Verify(publicKey); err != nil {
+		return nil, err
+	}
+	if src.Len() != manifest.Count {
+		return nil, ErrCount
+	}
+	return VerifySample(manifest.FileID, src, publicKey, n)
+}
+
+/*
+Check every record of the dataset against the manifest's Merkle root, without
+verifying the record signatures one by one
+*/
+func VerifyDataset(src Source, manifest *Manifest, publicKey *schnorr.PublicKey) error {
+	if err := manifest.Verify(publicKey); err != nil {
+		return err
+	}
+	if src.Len() != manifest.Count {
+		return ErrCount
+	}
+	var t tree
+	for i := uint64(0); i < manifest.Count; i++ {
+		record, _, err := src.Record(i)
+		if err != nil {
+			return err
+		}
+		t.add(leafHash(Message(manifest.FileID, i, record)))
+	}
+	if !bytes.Equal(t.root(), manifest.Root) {
+		return ErrRoot
+	}
+	return nil
+}
+
+/*
+Canonical encoding of a CSV row - every field is length prefixed,
+so ("a,b", "c") and ("a", "b,c") give different messages.
+*/
+func EncodeRow(row []string) []byte {
+	var buf []byte
+	for _, field := range row {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(len(field)))
+		buf = append(buf, field...)
+	}
+	return buf
+}
+
+/*
+Message which is signed for the record: H(len(fileID)||fileID||index||record)
+*/
+func Message(fileID string, index uint64, record []byte) string {
+	h := sha256.New()
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(len(fileID)))
+	h.Write(buf[:])
+	h.Write([]byte(fileID))
+	binary.BigEndian.PutUint64(buf[:], index)
+	h.Write(buf[:])
+	h.Write(record)
+
+	return string(h.Sum(nil))
+}
+
+/*
+Pick n distinct indexes from [0, size) (partial Fisher-Yates shuffle)
+*/
+func sample(size, n uint64) ([]uint64, error) {
+	if n >= size {
+		all := make([]uint64, size)
+		for i := range all {
+			all[i] = uint64(i)
+		}
+		return all, nil
+	}
+
+	// only swapped positions are remembered, so large datasets are cheap
+	swapped := make(map[uint64]uint64)
+	at := func(i uint64) uint64 {
+		if v, ok := swapped[i]; ok {
+			return v
+		}
+		return i
+	}
+
+	indexes := make([]uint64, 0, n)
+	for i := uint64(0); i < n; i++ {
+		j, err := rand.Int(entropy.Reader, new(big.Int).SetUint64(size-i))
+		if err != nil {
+			return nil, err
+		}
+		k := i + j.Uint64()
+
+		indexes = append(indexes, at(k))
+		swapped[k] = at(i)
+	}
+
+	return indexes, nil
+}
+
+/*
+Merkle tree built from a stream of leaves, keeping only the roots of the
+perfect subtrees (at most log2(size) of them, largest first)
+*/
+type tree struct {
+	size  uint64
+	roots [][]byte
+}
+
+func (t *tree) add(leaf []byte) {
+	t.roots = append(t.roots, leaf)
+	t.size++
+	// a subtree is complete for every trailing one bit of the new size
+	for n := t.size; n&1 == 0; n >>= 1 {
+		last := len(t.roots) - 1
+		t.roots = append(t.roots[:last-1], nodeHash(t.roots[last-1], t.roots[last]))
+	}
+}
+
+/*
+MTH of the leaves: the subtrees combined right to left, SHA256() of nothing
+for the empty tree
+*/
+func (t *tree) root() []byte {
+	if len(t.roots) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	root := t.roots[len(t.roots)-1]
+	for i := len(t.roots) - 2; i >= 0; i-- {
+		root = nodeHash(t.roots[i], root)
+	}
+	return root
+}
+
+func leafHash(message string) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write([]byte(message))
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
@@ -0,0 +1,279 @@
+package records
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const fileID = "export-2024-03.csv"
+
+/*
+In-memory signed dataset
+*/
+type dataset struct {
+	records    [][]byte
+	signatures []*schnorr.Signature
+}
+
+func (d *dataset) Len() uint64 {
+	return uint64(len(d.records))
+}
+
+func (d *dataset) Record(index uint64) ([]byte, *schnorr.Signature, error) {
+	return d.records[index], d.signatures[index], nil
+}
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk
+}
+
+/*
+Dataset of n CSV rows signed by sk, and its manifest
+*/
+func sign(t *testing.T, sk *schnorr.SignatureKey, n int) (*dataset, *Manifest) {
+	t.Helper()
+	var csvData strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&csvData, "%d,customer-%d,\"1,%02d\"\n", i, i, i)
+	}
+	s := NewSigner(fileID, sk)
+	d := &dataset{}
+	err := s.SignCSV(csv.NewReader(strings.NewReader(csvData.String())), func(row []string, signed *SignedRecord) error {
+		if signed.Index != d.Len() {
+			return fmt.Errorf("row %d signed as %d", d.Len(), signed.Index)
+		}
+		d.records = append(d.records, EncodeRow(row))
+		d.signatures = append(d.signatures, signed.Signature)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err = ParseManifest(m.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return d, m
+}
+
+func TestSignVerify(t *testing.T) {
+	sk, pk := keys(t)
+	d, m := sign(t, sk, 7)
+	if m.Count != 7 || m.FileID != fileID {
+		t.Fatalf("manifest of %d records of %s", m.Count, m.FileID)
+	}
+
+	report, err := VerifySampleManifest(d, m, pk, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || len(report.Checked) != 7 {
+		t.Errorf("report %+v", report)
+	}
+	if err := VerifyDataset(d, m, pk); err != nil {
+		t.Error(err)
+	}
+
+	// records moved to another position or another file
+	if Verify(fileID, 1, d.records[0], d.signatures[0], pk) {
+		t.Error("record verified at another index")
+	}
+	if Verify("other.csv", 0, d.records[0], d.signatures[0], pk) {
+		t.Error("record verified in another file")
+	}
+	_, otherPK := keys(t)
+	if Verify(fileID, 0, d.records[0], d.signatures[0], otherPK) {
+		t.Error("record verified with another key")
+	}
+}
+
+func TestTamperedDataset(t *testing.T) {
+	sk, pk := keys(t)
+	d, m := sign(t, sk, 5)
+
+	d.records[3] = EncodeRow([]string{"3", "customer-3", "9,99"})
+	report, err := VerifySample(fileID, d, pk, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || len(report.Failed) != 1 || report.Failed[0] != 3 {
+		t.Errorf("report of a changed record %+v", report)
+	}
+	if err := VerifyDataset(d, m, pk); err != ErrRoot {
+		t.Errorf("changed record: %v", err)
+	}
+
+	// records dropped from the end pass the sample but not the manifest
+	d, m = sign(t, sk, 5)
+	truncated := &dataset{d.records[:4], d.signatures[:4]}
+	if report, err := VerifySample(fileID, truncated, pk, 4); err != nil || !report.OK() {
+		t.Fatalf("sample of a truncated dataset: %v", err)
+	}
+	if _, err := VerifySampleManifest(truncated, m, pk, 4); err != ErrCount {
+		t.Errorf("truncated dataset: %v", err)
+	}
+	if err := VerifyDataset(truncated, m, pk); err != ErrCount {
+		t.Errorf("truncated dataset: %v", err)
+	}
+
+	// swapped records with their signatures
+	d.records[0], d.records[1] = d.records[1], d.records[0]
+	d.signatures[0], d.signatures[1] = d.signatures[1], d.signatures[0]
+	if err := VerifyDataset(d, m, pk); err != ErrRoot {
+		t.Errorf("reordered records: %v", err)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	sk, pk := keys(t)
+	d, m := sign(t, sk, 3)
+
+	changed := *m
+	changed.Count = 2
+	if err := changed.Verify(pk); err != ErrBadManifest {
+		t.Errorf("changed count: %v", err)
+	}
+	changed = *m
+	changed.FileID = "other.csv"
+	if _, err := VerifySampleManifest(d, &changed, pk, 3); err != ErrBadManifest {
+		t.Errorf("changed file ID: %v", err)
+	}
+	_, otherPK := keys(t)
+	if err := m.Verify(otherPK); err != ErrBadManifest {
+		t.Errorf("another key: %v", err)
+	}
+	changed = *m
+	changed.Root = changed.Root[:16]
+	if err := changed.Verify(pk); err != ErrInvalidManifest {
+		t.Errorf("short root: %v", err)
+	}
+	if err := (*Manifest)(nil).Verify(pk); err != ErrInvalidManifest {
+		t.Errorf("nil manifest: %v", err)
+	}
+
+	b := m.Bytes()
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"file ID":   append([]byte{0xff, 0xff, 0xff, 0xff}, b[4:]...),
+		"root":      b[:4+len(fileID)+8+16],
+		"signature": b[:len(b)-1],
+		"trailing":  append(append([]byte(nil), b...), 0),
+	} {
+		if _, err := ParseManifest(bad); err != ErrInvalidManifest {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// an empty dataset has a manifest too
+	s := NewSigner(fileID, sk)
+	empty, err := s.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDataset(&dataset{}, empty, pk); err != nil {
+		t.Errorf("empty dataset: %v", err)
+	}
+}
+
+/*
+Records signed concurrently give the manifest of the records in index order
+*/
+func TestConcurrentSigning(t *testing.T) {
+	sk, pk := keys(t)
+	s := NewSigner(fileID, sk)
+	const n = 20
+	d := &dataset{records: make([][]byte, n), signatures: make([]*schnorr.Signature, n)}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record := []byte("record")
+			signed, err := s.Sign(record)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			d.records[signed.Index], d.signatures[signed.Index] = record, signed.Signature
+		}()
+	}
+	wg.Wait()
+	m, err := s.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Count() != n {
+		t.Errorf("%d records signed", s.Count())
+	}
+	if err := VerifyDataset(d, m, pk); err != nil {
+		t.Error(err)
+	}
+}
+
+/*
+Streaming root against the recursive MTH definition of RFC 6962
+*/
+func TestTree(t *testing.T) {
+	var mth func(leaves [][]byte) []byte
+	mth = func(leaves [][]byte) []byte {
+		if len(leaves) == 1 {
+			return leaves[0]
+		}
+		k := 1
+		for k*2 < len(leaves) {
+			k *= 2
+		}
+		return nodeHash(mth(leaves[:k]), mth(leaves[k:]))
+	}
+
+	var tr tree
+	var leaves [][]byte
+	for i := 0; i < 33; i++ {
+		leaf := leafHash(fmt.Sprint(i))
+		tr.add(leaf)
+		leaves = append(leaves, leaf)
+		if !bytes.Equal(tr.root(), mth(leaves)) {
+			t.Fatalf("root of %d leaves", len(leaves))
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	indexes, err := sample(1000, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[uint64]bool{}
+	for _, i := range indexes {
+		if i >= 1000 || seen[i] {
+			t.Fatalf("index %d in %v", i, indexes)
+		}
+		seen[i] = true
+	}
+	if len(indexes) != 50 {
+		t.Errorf("%d indexes sampled", len(indexes))
+	}
+}
+
+func TestEncodeRow(t *testing.T) {
+	if bytes.Equal(EncodeRow([]string{"a,b", "c"}), EncodeRow([]string{"a", "b,c"})) {
+		t.Error("rows with different fields encoded alike")
+	}
+	if bytes.Equal(EncodeRow([]string{"a", ""}), EncodeRow([]string{"a"})) {
+		t.Error("trailing empty field dropped")
+	}
+}
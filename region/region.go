@@ -0,0 +1,90 @@
+/*
+Per-request memory regions for verification services.
+
+A Region hands out temporary buffers and values for a single request from
+memory reused across requests, and all of it is returned at once by Release.
+Under sustained load this keeps verification of a request from producing
+garbage, reducing GC work and pauses.
+
+Nothing obtained from a Region may be used after Release.
+*/
+package region
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Initial size of the region memory, it grows to the largest request seen
+*/
+const initialSize = 4096
+
+type Region struct {
+	mem       []byte
+	signature schnorr.Signature
+}
+
+var pool = sync.Pool{New: func() interface{} { return &Region{mem: make([]byte, 0, initialSize)} }}
+
+/*
+Region for a new request
+*/
+func Get() *Region {
+	return pool.Get().(*Region)
+}
+
+/*
+Release all memory of the region
+*/
+func (r *Region) Release() {
+	r.mem = r.mem[:0]
+	pool.Put(r)
+}
+
+/*
+Temporary buffer of n bytes
+*/
+func (r *Region) Bytes(n int) []byte {
+	if len(r.mem)+n > cap(r.mem) {
+		// buffers handed out so far keep the old memory,
+		// the new one is reused from the next request on
+		size := 2 * cap(r.mem)
+		for size < n {
+			size *= 2
+		}
+		r.mem = make([]byte, 0, size)
+	}
+	start := len(r.mem)
+	r.mem = r.mem[:start+n]
+	return r.mem[start : start+n : start+n]
+}
+
+/*
+Empty buffer with capacity for at least n bytes, to be filled with append
+*/
+func (r *Region) Buffer(n int) []byte {
+	return r.Bytes(n)[:0]
+}
+
+/*
+String sharing the memory of b, valid until Release
+*/
+func (r *Region) String(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+/*
+Signature parsed into the region
+*/
+func (r *Region) ParseSignature(b []byte) (*schnorr.Signature, error) {
+	if err := schnorr.ParseSignatureTo(&r.signature, b); err != nil {
+		return nil, err
+	}
+	return &r.signature, nil
+}
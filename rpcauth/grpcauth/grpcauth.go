@@ -0,0 +1,145 @@
+/*
+gRPC interceptors authenticating calls with rpcauth.
+
+The package is a module of its own, so rpcauth and the rest of the module
+don't depend on grpc-go. Clients add the interceptors of a Signer, servers
+those of a Verifier:
+
+	conn, err := grpc.NewClient(target,
+		grpc.WithUnaryInterceptor(grpcauth.UnaryClientInterceptor(signer)),
+		grpc.WithStreamInterceptor(grpcauth.StreamClientInterceptor(signer)))
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcauth.UnaryServerInterceptor(verifier)),
+		grpc.StreamInterceptor(grpcauth.StreamServerInterceptor(verifier)))
+
+Unary calls sign the method and the deterministic protobuf encoding of the
+request. Streaming calls sign only the method when the stream is opened, the
+messages of the stream aren't covered. Handlers read the ID of the key which
+signed the call with KeyID.
+*/
+package grpcauth
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/miki799/schnorr-signature/rpcauth"
+)
+
+type keyIDContextKey struct{}
+
+/*
+ID of the key which signed the call, set by the server interceptors
+*/
+func KeyID(ctx context.Context) (string, bool) {
+	keyID, ok := ctx.Value(keyIDContextKey{}).(string)
+	return keyID, ok
+}
+
+/*
+Signs every unary call with the method and the request
+*/
+func UnaryClientInterceptor(signer *rpcauth.Signer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		body, err := marshal(req)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if ctx, err = sign(ctx, signer, method, body); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+/*
+Signs the method of every stream when it is opened
+*/
+func StreamClientInterceptor(signer *rpcauth.Signer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := sign(ctx, signer, method, nil)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+/*
+Rejects unary calls without a valid signature with codes.Unauthenticated
+*/
+func UnaryServerInterceptor(verifier *rpcauth.Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		body, err := marshal(req)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if ctx, err = verify(ctx, verifier, info.FullMethod, body); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+/*
+Rejects streams opened without a valid signature with codes.Unauthenticated
+*/
+func StreamServerInterceptor(verifier *rpcauth.Verifier) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := verify(ss.Context(), verifier, info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ss, ctx})
+	}
+}
+
+func sign(ctx context.Context, signer *rpcauth.Signer, method string, body []byte) (context.Context, error) {
+	md, err := signer.Sign(method, body)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	for k, v := range md {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+	return ctx, nil
+}
+
+func verify(ctx context.Context, verifier *rpcauth.Verifier, method string, body []byte) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	keyID, err := verifier.Verify(method, body, rpcauth.FromGRPC(md))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, keyIDContextKey{}, keyID), nil
+}
+
+/*
+Deterministic encoding, the same on the client and the server
+*/
+func marshal(m interface{}) ([]byte, error) {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("grpcauth: %T isn't a protobuf message", m)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+/*
+Server stream carrying the context with the key ID
+*/
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,152 @@
+package grpcauth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/rpcauth"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Health service recording the key ID seen by its handlers
+*/
+type healthServer struct {
+	*health.Server
+	keyIDs chan string
+}
+
+func (h *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	keyID, _ := KeyID(ctx)
+	h.keyIDs <- keyID
+	return h.Server.Check(ctx, req)
+}
+
+func (h *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	keyID, _ := KeyID(stream.Context())
+	h.keyIDs <- keyID
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+/*
+Server with the verifier of the registered key and a client dialing it with
+the interceptors of signer, or none if signer is nil
+*/
+func setup(t *testing.T, registered *schnorr.PublicKey, signer *rpcauth.Signer) (healthpb.HealthClient, chan string) {
+	t.Helper()
+	keys := envelope.KeyMap{}
+	keys.Add(registered)
+	verifier := rpcauth.NewVerifier(keys, time.Minute)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(verifier)),
+		grpc.StreamInterceptor(StreamServerInterceptor(verifier)))
+	h := &healthServer{health.NewServer(), make(chan string, 1)}
+	healthpb.RegisterHealthServer(server, h)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+	}
+	if signer != nil {
+		opts = append(opts,
+			grpc.WithUnaryInterceptor(UnaryClientInterceptor(signer)),
+			grpc.WithStreamInterceptor(StreamClientInterceptor(signer)))
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn), h.keyIDs
+}
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk
+}
+
+func TestSignedCalls(t *testing.T) {
+	sk, pk := keys(t)
+	client, keyIDs := setup(t, pk, rpcauth.NewSigner(sk, pk))
+	ctx := context.Background()
+
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: ""}); err != nil {
+		t.Fatalf("unary call: %v", err)
+	}
+	if keyID := <-keyIDs; keyID != pk.KeyID() {
+		t.Errorf("unary handler saw key %q", keyID)
+	}
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if keyID := <-keyIDs; keyID != pk.KeyID() {
+		t.Errorf("stream handler saw key %q", keyID)
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	sk, pk := keys(t)
+	ctx := context.Background()
+
+	unsigned, _ := setup(t, pk, nil)
+	if _, err := unsigned.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("unsigned unary call: %v", err)
+	}
+	stream, err := unsigned.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("unsigned stream: %v", err)
+	}
+
+	// signed by a key the server doesn't know
+	otherSK, otherPK := keys(t)
+	unknown, _ := setup(t, pk, rpcauth.NewSigner(otherSK, otherPK))
+	if _, err := unknown.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call signed by an unknown key: %v", err)
+	}
+
+	// signature of another request body
+	client, _ := setup(t, pk, nil)
+	signer := rpcauth.NewSigner(sk, pk)
+	signed, err := sign(ctx, signer, healthpb.Health_Check_FullMethodName, []byte("other body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Check(signed, &healthpb.HealthCheckRequest{Service: "x"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("signature of another body: %v", err)
+	}
+}
+
+func TestNotProtobuf(t *testing.T) {
+	if _, err := marshal("request"); err == nil {
+		t.Error("string marshaled as a protobuf message")
+	}
+}
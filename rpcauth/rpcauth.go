@@ -0,0 +1,219 @@
+/*
+Application layer authentication of RPC calls.
+
+Package does not depend on grpc-go, it only builds and checks call metadata.
+The gRPC unary and stream interceptors are in rpcauth/grpcauth, a module of
+its own so only programs using gRPC depend on grpc-go.
+*/
+package rpcauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/internal/expiry"
+	"github.com/miki799/schnorr-signature/region"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Metadata keys used by the package
+*/
+const (
+	KeyIDKey     = "x-schnorr-key-id"
+	TimestampKey = "x-schnorr-timestamp"
+	NonceKey     = "x-schnorr-nonce"
+	SignatureKey = "x-schnorr-signature"
+)
+
+var (
+	ErrMissingMetadata = errors.New("rpcauth: missing authentication metadata")
+	ErrStale           = errors.New("rpcauth: timestamp outside of the allowed window")
+	ErrReplay          = errors.New("rpcauth: call replayed")
+	ErrBadSignature    = errors.New("rpcauth: invalid call signature")
+)
+
+/*
+Single valued call metadata
+*/
+type Metadata map[string]string
+
+/*
+Convert multi valued metadata (grpc metadata.MD) keeping the first value of every key
+*/
+func FromGRPC(md map[string][]string) Metadata {
+	m := make(Metadata, len(md))
+	for k, v := range md {
+		if len(v) > 0 {
+			m[k] = v[0]
+		}
+	}
+	return m
+}
+
+/*
+Client side call signer
+*/
+type Signer struct {
+	keyID string
+	sk    *schnorr.SignatureKey
+	now   func() time.Time
+}
+
+func NewSigner(sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Signer {
+	return &Signer{pk.KeyID(), sk, schnorr.Now}
+}
+
+/*
+Returns metadata which has to be attached to the call of method with
+deterministically serialized request body
+*/
+func (s *Signer) Sign(method string, body []byte) (Metadata, error) {
+	var nonce [16]byte
+	if _, err := io.ReadFull(entropy.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	md := Metadata{
+		KeyIDKey:     s.keyID,
+		TimestampKey: strconv.FormatInt(s.now().Unix(), 10),
+		NonceKey:     hex.EncodeToString(nonce[:]),
+	}
+	signature, err := schnorr.TrySign(digest(method, body, md), s.sk)
+	if err != nil {
+		return nil, err
+	}
+	md[SignatureKey] = base64.RawURLEncoding.EncodeToString(signature.Bytes())
+
+	return md, nil
+}
+
+/*
+Server side call verifier with replay protection.
+Calls are accepted if their timestamp is within window (plus the clock skew
+of schnorr.SetFreshnessPolicy) from the server time
+and their nonce wasn't seen during that time.
+*/
+type Verifier struct {
+	Regions bool // take temporary values of every call from a region.Region
+
+	keys   envelope.KeyResolver
+	window time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	seen  map[string]time.Time // nonce -> time after which it can be forgotten
+	queue expiry.Queue         // seen nonces by expiry
+}
+
+func NewVerifier(keys envelope.KeyResolver, window time.Duration) *Verifier {
+	return &Verifier{keys: keys, window: window, now: schnorr.Now, seen: make(map[string]time.Time)}
+}
+
+/*
+Verifies call metadata. Returns ID of the key which signed the call.
+*/
+func (v *Verifier) Verify(method string, body []byte, md Metadata) (string, error) {
+	keyID, ts, nonce, rawSignature := md[KeyIDKey], md[TimestampKey], md[NonceKey], md[SignatureKey]
+	if keyID == "" || ts == "" || nonce == "" || rawSignature == "" {
+		return "", ErrMissingMetadata
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", ErrMissingMetadata
+	}
+	now := v.now()
+	window := v.window + schnorr.CurrentFreshnessPolicy().MaxSkew
+	if d := now.Sub(time.Unix(unix, 0)); d > window || d < -window {
+		return "", ErrStale
+	}
+
+	pk, err := v.keys.PublicKey(keyID)
+	if err != nil {
+		return "", err
+	}
+	if !v.verifySignature(method, body, md, rawSignature, pk) {
+		return "", ErrBadSignature
+	}
+
+	// nonce is remembered only after the signature is checked,
+	// so unauthenticated callers can't fill the cache
+	if err := v.remember(keyID+"/"+nonce, now); err != nil {
+		return "", err
+	}
+
+	return keyID, nil
+}
+
+func (v *Verifier) verifySignature(method string, body []byte, md Metadata, rawSignature string, pk *schnorr.PublicKey) bool {
+	if !v.Regions {
+		b, err := base64.RawURLEncoding.DecodeString(rawSignature)
+		if err != nil {
+			return false
+		}
+		signature, err := schnorr.ParseSignature(b)
+		return err == nil && schnorr.VerifySignature(digest(method, body, md), signature, pk)
+	}
+
+	rg := region.Get()
+	defer rg.Release()
+
+	b := rg.Bytes(base64.RawURLEncoding.DecodedLen(len(rawSignature)))
+	n, err := base64.RawURLEncoding.Decode(b, []byte(rawSignature))
+	if err != nil {
+		return false
+	}
+	signature, err := rg.ParseSignature(b[:n])
+	if err != nil {
+		return false
+	}
+	d := appendDigest(rg.Buffer(sha256.Size), method, body, md)
+	return schnorr.VerifySignature(rg.String(d), signature, pk)
+}
+
+func (v *Verifier) remember(nonce string, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.queue.Expire(now, func(n string) {
+		if now.After(v.seen[n]) {
+			delete(v.seen, n)
+		}
+	})
+
+	if _, ok := v.seen[nonce]; ok {
+		return ErrReplay
+	}
+	expires := now.Add(2 * (v.window + schnorr.CurrentFreshnessPolicy().MaxSkew))
+	v.seen[nonce] = expires
+	v.queue.Push(nonce, expires)
+	return nil
+}
+
+/*
+H(method||keyID||timestamp||nonce||body) with every field length prefixed
+*/
+func digest(method string, body []byte, md Metadata) string {
+	return string(appendDigest(nil, method, body, md))
+}
+
+func appendDigest(b []byte, method string, body []byte, md Metadata) []byte {
+	h := sha256.New()
+	for _, field := range [][]byte{[]byte(method), []byte(md[KeyIDKey]), []byte(md[TimestampKey]), []byte(md[NonceKey]), body} {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(field)))
+		h.Write(l[:])
+		h.Write(field)
+	}
+	return h.Sum(b)
+}
@@ -0,0 +1,137 @@
+package rpcauth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const method = "/orders.Orders/Create"
+
+func setup(t *testing.T) (*Signer, *Verifier) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := envelope.KeyMap{}
+	keys.Add(pk)
+	return NewSigner(sk, pk), NewVerifier(keys, time.Minute)
+}
+
+func sign(t *testing.T, s *Signer, body string) Metadata {
+	t.Helper()
+	md, err := s.Sign(method, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, regions := range []bool{false, true} {
+		s, v := setup(t)
+		v.Regions = regions
+		md := sign(t, s, "request")
+		keyID, err := v.Verify(method, []byte("request"), md)
+		if err != nil || keyID != s.keyID {
+			t.Fatalf("regions %v: %q, %v", regions, keyID, err)
+		}
+		if _, err := v.Verify(method, []byte("request"), md); err != ErrReplay {
+			t.Errorf("regions %v: replayed call: %v", regions, err)
+		}
+	}
+
+	// metadata of grpc, first value of every key
+	s, v := setup(t)
+	grpc := make(map[string][]string)
+	for k, value := range sign(t, s, "request") {
+		grpc[k] = []string{value, "second"}
+	}
+	if _, err := v.Verify(method, []byte("request"), FromGRPC(grpc)); err != nil {
+		t.Errorf("grpc metadata: %v", err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	for _, regions := range []bool{false, true} {
+		s, v := setup(t)
+		v.Regions = regions
+		if _, err := v.Verify("/orders.Orders/Delete", []byte("request"), sign(t, s, "request")); err != ErrBadSignature {
+			t.Errorf("regions %v: other method: %v", regions, err)
+		}
+		if _, err := v.Verify(method, []byte("other"), sign(t, s, "request")); err != ErrBadSignature {
+			t.Errorf("regions %v: other body: %v", regions, err)
+		}
+		md := sign(t, s, "request")
+		md[NonceKey] = sign(t, s, "request")[NonceKey]
+		if _, err := v.Verify(method, []byte("request"), md); err != ErrBadSignature {
+			t.Errorf("regions %v: other nonce: %v", regions, err)
+		}
+		md = sign(t, s, "request")
+		md[SignatureKey] = sign(t, s, "other")[SignatureKey]
+		if _, err := v.Verify(method, []byte("request"), md); err != ErrBadSignature {
+			t.Errorf("regions %v: signature of another call: %v", regions, err)
+		}
+	}
+
+	// the rejected calls weren't remembered, the signed one still goes through
+	s, v := setup(t)
+	md := sign(t, s, "request")
+	if _, err := v.Verify(method, []byte("other"), md); err != ErrBadSignature {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(method, []byte("request"), md); err != nil {
+		t.Errorf("call after a rejected forgery of it: %v", err)
+	}
+}
+
+func TestStale(t *testing.T) {
+	s, v := setup(t)
+	now := time.Unix(1700000000, 0)
+	v.now = func() time.Time { return now }
+	for _, offset := range []time.Duration{-2 * time.Minute, 2 * time.Minute} {
+		s.now = func() time.Time { return now.Add(offset) }
+		if _, err := v.Verify(method, nil, sign(t, s, "")); err != ErrStale {
+			t.Errorf("call signed %v from now: %v", offset, err)
+		}
+	}
+	s.now = func() time.Time { return now.Add(-30 * time.Second) }
+	if _, err := v.Verify(method, nil, sign(t, s, "")); err != nil {
+		t.Errorf("call within the window: %v", err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	s, v := setup(t)
+	for _, key := range []string{KeyIDKey, TimestampKey, NonceKey, SignatureKey} {
+		md := sign(t, s, "")
+		delete(md, key)
+		if _, err := v.Verify(method, nil, md); err != ErrMissingMetadata {
+			t.Errorf("without %s: %v", key, err)
+		}
+	}
+
+	md := sign(t, s, "")
+	md[TimestampKey] = "yesterday"
+	if _, err := v.Verify(method, nil, md); err != ErrMissingMetadata {
+		t.Errorf("malformed timestamp: %v", err)
+	}
+	for _, signature := range []string{"not base64!", "AAAA"} {
+		for _, regions := range []bool{false, true} {
+			v.Regions = regions
+			md := sign(t, s, "")
+			md[SignatureKey] = signature
+			if _, err := v.Verify(method, nil, md); err != ErrBadSignature {
+				t.Errorf("regions %v: signature %q: %v", regions, signature, err)
+			}
+		}
+	}
+	md = sign(t, s, "")
+	md[KeyIDKey] = "unknown"
+	if _, err := v.Verify(method, nil, md); err != envelope.ErrUnknownKey {
+		t.Errorf("unknown key: %v", err)
+	}
+}
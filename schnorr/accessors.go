@@ -0,0 +1,146 @@
+package schnorr
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Read access to keys and signatures
+
+Accessors return copies, so the values of a key or signature can't be changed
+through them. NewSignature, NewPublicKey and NewSignatureKey build the values
+back from their components, e.g. keys generated by an HSM or another
+implementation, checking the ranges the rest of the package relies on.
+Keys are accepted in registered groups and mod p groups passing
+GroupParams.Validate.
+*/
+
+var (
+	ErrInvalidSignature = errors.New("schnorr: invalid signature components")
+	ErrInvalidPublicKey = errors.New("schnorr: invalid public key")
+	ErrInvalidKey       = errors.New("schnorr: invalid private key")
+
+	// the multi-party protocols (cluster, cross-input and two-party signing)
+	// return it for shares that don't combine
+	ErrInvalidPartialSignature = errors.New("schnorr: partial signatures don't combine into valid signature")
+)
+
+/*
+Response s of the signature
+*/
+func (S Signature) S() *big.Int {
+	return new(big.Int).Set(S.s)
+}
+
+/*
+Signature from the encoded commitment R and the response s >= 0
+*/
+func NewSignature(R []byte, s *big.Int) (*Signature, error) {
+	if len(R) == 0 || s == nil || s.Sign() < 0 {
+		return nil, ErrInvalidSignature
+	}
+	return &Signature{append([]byte(nil), R...), new(big.Int).Set(s)}, nil
+}
+
+/*
+Public key X in the group, X has to be an element other than the identity.
+X is checked as Decode checks encoded keys, for the mod p groups that
+includes the membership in the subgroup of order q.
+*/
+func NewPublicKey(g Group, X Element) (*PublicKey, error) {
+	if err := checkGroup(g); err != nil {
+		return nil, err
+	}
+	if X == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	b, err := g.Encode(X)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	if _, err := g.Decode(b); err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return &PublicKey{group: g, X: X}, nil
+}
+
+/*
+Signature key with the private scalar x, 0 < x < q, and its public key
+*/
+func NewSignatureKey(g Group, x *big.Int) (*SignatureKey, *PublicKey, error) {
+	if err := checkGroup(g); err != nil {
+		return nil, nil, err
+	}
+	if x == nil || x.Sign() <= 0 || x.Cmp(g.Order()) >= 0 {
+		return nil, nil, ErrInvalidKey
+	}
+	return newKeys(g, new(big.Int).Set(x))
+}
+
+/*
+Registered groups are trusted, other mod p groups have to pass GroupParams.Validate
+*/
+func checkGroup(g Group) error {
+	if g == nil {
+		return ErrInvalidParams
+	}
+	if _, ok := groupID(g); ok {
+		return nil
+	}
+	if m, ok := g.(*group.ModP); ok {
+		return (&GroupParams{m}).Validate()
+	}
+	return nil
+}
+
+/*
+Private scalar x. Anybody who learns it can sign with the key, prefer the
+encodings of serialize.go (e.g. MarshalPEM) for storing the key.
+*/
+func (sk *SignatureKey) Secret() *big.Int {
+	return new(big.Int).Set(sk.x)
+}
+
+/*
+Public key derived from the private key, X = g^x, for keys stored without
+their public key. The key is checked first: a group and 0 < x < q.
+The group itself isn't validated, see GroupParams.Validate.
+*/
+func (sk *SignatureKey) PublicKey() (*PublicKey, error) {
+	if sk == nil || sk.group == nil || sk.x == nil {
+		return nil, ErrInvalidKey
+	}
+	if sk.x.Sign() <= 0 || sk.x.Cmp(sk.group.Order()) >= 0 {
+		return nil, fmt.Errorf("%w: x out of range", ErrInvalidKey)
+	}
+	return sk.Public().(*PublicKey), nil
+}
+
+/*
+Check the key, X has to be an element of its group other than the identity.
+The group itself is checked by GroupParams.Validate.
+*/
+func (pk *PublicKey) Validate() error {
+	if pk.verifier().Validate() != nil {
+		return ErrInvalidPublicKey
+	}
+	return nil
+}
+
+/*
+Check the signature for the key, R an element of the key's group other than
+the identity and 0 <= s < q. VerifySignature rejects signatures failing the check.
+*/
+func (S *Signature) Validate(pk *PublicKey) error {
+	if err := pk.Validate(); err != nil {
+		return err
+	}
+	if _, err := S.verifier().Validate(pk.verifier()); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
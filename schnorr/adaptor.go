@@ -0,0 +1,143 @@
+//go:build !schnorr_minimal || schnorr_adaptor
+
+package schnorr
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+/*
+Adaptor signatures (verifiably encrypted signatures)
+
+A pre-signature for the adaptor point T = t*G is a signature that becomes
+valid only when completed with the secret t, and publishing the completed
+signature reveals t to whoever holds the pre-signature:
+
+	R' = r*G,  R = R' + T,  c = H(R || m),  s' = r + c*x mod n
+	AdaptorVerify:  s'*G + T == R + c*X
+	Adapt:          s = s' + t,  (R, s) verifies with VerifySignature
+	ExtractSecret:  t = s - s'
+
+c is the challenge of Sign (environment tags included), R and T are encoded
+like Signature.R. In an atomic swap Alice gives Bob a pre-signature of her
+payment for Bob's T, Bob claims the payment by adapting and publishing the
+signature, and Alice extracts t from it to claim Bob's payment locked by T.
+*/
+
+var ErrInvalidAdaptor = errors.New("schnorr: invalid adaptor point or pre-signature")
+
+type PreSignature struct {
+	R []byte   // encoding of the nonce of the completed signature, R = r*G + T
+	T []byte   // encoding of the adaptor point
+	S *big.Int // s' = (r + H(R||m)x) mod n
+}
+
+/*
+Pre-signature of m for the encoded adaptor point T
+*/
+func AdaptorSign(m string, sk *SignatureKey, T []byte) (*PreSignature, error) {
+	if err := sk.checkExpiry(Now()); err != nil {
+		return nil, err
+	}
+	if sk.x.Sign() == 0 {
+		return nil, ErrKeyZeroized
+	}
+	g := sk.group
+	q := g.Order()
+	adaptor, err := g.Decode(T)
+	if err != nil {
+		return nil, ErrInvalidAdaptor
+	}
+
+	for {
+		r, err := randomScalar(q)
+		if err != nil {
+			return nil, err
+		}
+		R, err := g.Encode(g.Add(g.ScalarBaseMult(r), adaptor))
+		// R' = -T gives the identity, try another nonce
+		if err != nil {
+			continue
+		}
+
+		// s' = (r + cx) mod n
+		s := new(big.Int)
+		sc := modp.Get()
+		sc.Response(s, r, sk.challenge(R, m), sk.x, q)
+		modp.Put(sc)
+		modp.Wipe(r)
+		return &PreSignature{R, append([]byte(nil), T...), s}, nil
+	}
+}
+
+/*
+Check s'*G + T == R + c*X, i.e. that adapting with the discrete logarithm
+of T gives a valid signature of m
+*/
+func AdaptorVerify(m string, pre *PreSignature, pk *PublicKey) bool {
+	if pk.Validate() != nil {
+		return false
+	}
+	g := pk.group
+	R, T, ok := pre.decode(g)
+	if !ok {
+		return false
+	}
+
+	c := pk.challenge(pre.R, m)
+	return g.Equal(g.Add(g.ScalarBaseMult(pre.S), T), g.Add(R, g.ScalarMult(pk.X, c)))
+}
+
+/*
+Complete the pre-signature for the key with t, the discrete logarithm of T:
+s = s' + t
+*/
+func Adapt(pre *PreSignature, t *big.Int, pk *PublicKey) (*Signature, error) {
+	g := pk.group
+	_, T, ok := pre.decode(g)
+	if !ok || t == nil || !g.Equal(g.ScalarBaseMult(t), T) {
+		return nil, ErrInvalidAdaptor
+	}
+	s := new(big.Int).Add(pre.S, t)
+	return &Signature{append([]byte(nil), pre.R...), s.Mod(s, g.Order())}, nil
+}
+
+/*
+Secret t = s - s' from the pre-signature and the signature adapted from it
+*/
+func ExtractSecret(pre *PreSignature, signature *Signature, pk *PublicKey) (*big.Int, error) {
+	g := pk.group
+	_, T, ok := pre.decode(g)
+	if !ok || signature == nil || signature.s == nil || string(signature.R) != string(pre.R) {
+		return nil, ErrInvalidAdaptor
+	}
+
+	t := new(big.Int).Sub(signature.s, pre.S)
+	t.Mod(t, g.Order())
+	if !g.Equal(g.ScalarBaseMult(t), T) {
+		return nil, ErrInvalidAdaptor
+	}
+	return t, nil
+}
+
+/*
+R and T of the pre-signature in the group, false if either isn't an element
+other than the identity or s' is out of range
+*/
+func (pre *PreSignature) decode(g Group) (Element, Element, bool) {
+	if pre == nil || pre.S == nil || !inRange(pre.S, g.Order()) {
+		return nil, nil, false
+	}
+	R, err := g.Decode(pre.R)
+	if err != nil {
+		return nil, nil, false
+	}
+	T, err := g.Decode(pre.T)
+	if err != nil {
+		return nil, nil, false
+	}
+	return R, T, true
+}
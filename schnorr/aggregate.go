@@ -0,0 +1,246 @@
+//go:build !schnorr_minimal || schnorr_aggregate
+
+package schnorr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+/*
+Half-aggregation of signatures made by the same key
+
+n signatures {R_i, s_i} are compressed into {R_1, ..., R_n, s} where
+
+	s   = sum(z_i * s_i) mod q
+	z_1 = 1, z_i = H(X, (R_1, m_1), ..., (R_n, m_n), i) for i > 1
+
+Verification checks g^s = prod((R_i * X^c_i)^z_i), so the aggregate is roughly
+half the size of n separate signatures. Random-looking z_i make it impossible
+to combine invalid signatures into a valid aggregate.
+*/
+
+var ErrAggregateSize = errors.New("schnorr: number of messages and signatures differ")
+
+func init() {
+	describers = append(describers, describeAggregate)
+	RegisterSelfTest("aggregate", selfTestAggregate)
+}
+
+type AggregateSignature struct {
+	R [][]byte // encoded commitments of the signatures
+	s *big.Int
+}
+
+/*
+Aggregate signatures of messages made with the key of pk. nil or malformed
+signatures (see Signature.Validate) are rejected with ErrInvalidSignature,
+the signatures aren't verified.
+*/
+func HalfAggregate(messages []string, signatures []*Signature, pk *PublicKey) (*AggregateSignature, error) {
+	if len(messages) != len(signatures) || len(messages) == 0 {
+		return nil, ErrAggregateSize
+	}
+
+	R := make([][]byte, len(signatures))
+	for i, signature := range signatures {
+		if err := signature.Validate(pk); err != nil {
+			return nil, err
+		}
+		R[i] = signature.R
+	}
+	z := aggregationCoefficients(messages, R, pk)
+
+	s := new(big.Int)
+	for i, signature := range signatures {
+		s.Add(s, new(big.Int).Mul(z[i], signature.s))
+	}
+	s.Mod(s, pk.group.Order())
+
+	return &AggregateSignature{R, s}, nil
+}
+
+/*
+Check the aggregate of messages signed with the key of pk. Every R_i has to be
+an element of the key's group other than the identity and 0 <= s < q, nil or
+malformed aggregates are rejected before anything is computed.
+*/
+func VerifyAggregate(messages []string, aggregate *AggregateSignature, pk *PublicKey) bool {
+	if aggregate == nil || len(messages) != len(aggregate.R) || len(messages) == 0 || pk.Validate() != nil {
+		return false
+	}
+	g := pk.group
+	if !inRange(aggregate.s, g.Order()) {
+		return false
+	}
+	R := make([]Element, len(aggregate.R))
+	for i, encoded := range aggregate.R {
+		var err error
+		if R[i], err = g.Decode(encoded); err != nil {
+			return false
+		}
+	}
+
+	z := aggregationCoefficients(messages, aggregate.R, pk)
+
+	// right side: prod((R_i * X^c_i)^z_i)
+	var right Element
+	for i, encoded := range aggregate.R {
+		c := pk.challenge(encoded, messages[i])
+		term := g.ScalarMult(g.Add(R[i], g.ScalarMult(pk.X, c)), z[i])
+		if right == nil {
+			right = term
+		} else {
+			right = g.Add(right, term)
+		}
+	}
+
+	// left side: g^s
+	return g.Equal(g.ScalarBaseMult(aggregate.s), right)
+}
+
+/*
+Encoding: count (4 bytes)||len(R_1)||R_1||...||len(s)||s
+*/
+func (a *AggregateSignature) Bytes() []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(len(a.R)))
+	for _, R := range a.R {
+		buf = appendElement(buf, R)
+	}
+	return appendInts(buf, a.s)
+}
+
+func ParseAggregateSignature(b []byte) (*AggregateSignature, error) {
+	if len(b) < 4 {
+		return nil, ErrInvalidEncoding
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n == 0 || uint64(n) > uint64(len(b)) {
+		return nil, ErrInvalidEncoding
+	}
+	// the count is untrusted, every R takes at least its 2 byte length
+	b = b[4:]
+	if uint64(n)*2 > uint64(len(b)) {
+		return nil, ErrInvalidEncoding
+	}
+	R := make([][]byte, n)
+	for i := range R {
+		var err error
+		if R[i], b, err = splitElement(b); err != nil {
+			return nil, err
+		}
+	}
+	ints, err := readInts(b, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &AggregateSignature{R, ints[0]}, nil
+}
+
+func aggregationCoefficients(messages []string, R [][]byte, pk *PublicKey) []*big.Int {
+	h := sha256.New()
+	h.Write([]byte("schnorr/halfagg"))
+	h.Write(pk.Bytes())
+	for i := range R {
+		h.Write(appendElement(nil, R[i]))
+		h.Write(appendBytes(nil, []byte(messages[i])))
+	}
+	transcript := h.Sum(nil)
+
+	z := make([]*big.Int, len(R))
+	z[0] = big.NewInt(1)
+	for i := 1; i < len(R); i++ {
+		index := binary.BigEndian.AppendUint32(nil, uint32(i))
+		z[i] = challenge(transcript, string(index), pk.group.Order())
+	}
+	return z
+}
+
+/*
+Log segment signing
+
+Every log entry is signed on append, so entries can be verified while the
+segment is open. When the segment is closed its signatures are compressed
+into a single AggregateSignature which is archived with the segment.
+*/
+type LogSegment struct {
+	mu         sync.Mutex
+	sk         *SignatureKey
+	pk         *PublicKey
+	entries    []string
+	signatures []*Signature
+}
+
+func NewLogSegment(sk *SignatureKey, pk *PublicKey) *LogSegment {
+	return &LogSegment{sk: sk, pk: pk}
+}
+
+/*
+Append entry to the segment and return its individual signature. The entry
+isn't appended if the key can't sign (e.g. it has expired).
+*/
+func (l *LogSegment) Append(entry string) (*Signature, error) {
+	signature, err := TrySign(entry, l.sk)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+	l.signatures = append(l.signatures, signature)
+	return signature, nil
+}
+
+/*
+Close the segment, returning its entries and their aggregated signature
+*/
+func (l *LogSegment) Seal() ([]string, *AggregateSignature, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	aggregate, err := HalfAggregate(l.entries, l.signatures, l.pk)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := l.entries
+	l.entries, l.signatures = nil, nil
+	return entries, aggregate, nil
+}
+
+func describeAggregate(b []byte) *Description {
+	aggregate, err := ParseAggregateSignature(b)
+	if err != nil {
+		return nil
+	}
+	d := &Description{Kind: "aggregate signature"}
+	d.Add("algorithm", algorithmName+", half-aggregated")
+	d.Add("signatures", len(aggregate.R))
+	d.Add("canonical", bytes.Equal(aggregate.Bytes(), b))
+	return d
+}
+
+func selfTestAggregate() error {
+	sk, pk, err := GenerateKeysWithParamsID(selfTestParams())
+	if err != nil {
+		return err
+	}
+	messages := []string{selfTestMessage + "/1", selfTestMessage + "/2", selfTestMessage + "/3"}
+	signatures := make([]*Signature, len(messages))
+	for i, m := range messages {
+		if signatures[i], err = TrySign(m, sk); err != nil {
+			return err
+		}
+	}
+	aggregate, err := HalfAggregate(messages, signatures, pk)
+	if err != nil {
+		return err
+	}
+	return checkVerify(
+		VerifyAggregate(messages, aggregate, pk),
+		VerifyAggregate([]string{messages[0], messages[2], messages[1]}, aggregate, pk))
+}
@@ -0,0 +1,40 @@
+//go:build !schnorr_minimal || schnorr_aggregate
+
+package schnorr
+
+import "testing"
+
+func TestHalfAggregate(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []string{"first", "second", "third"}
+	signatures := make([]*Signature, len(messages))
+	for i, m := range messages {
+		signatures[i] = Sign(m, sk)
+	}
+
+	aggregate, err := HalfAggregate(messages, signatures, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyAggregate(messages, aggregate, pk) {
+		t.Fatal("aggregate doesn't verify")
+	}
+	if VerifyAggregate([]string{"first", "second", "other"}, aggregate, pk) {
+		t.Error("aggregate verifies for another message")
+	}
+
+	if _, err := HalfAggregate(messages[:2], signatures, pk); err != ErrAggregateSize {
+		t.Errorf("fewer messages than signatures: %v", err)
+	}
+	signatures[1] = nil
+	if _, err := HalfAggregate(messages, signatures, pk); err != ErrInvalidSignature {
+		t.Errorf("nil signature: %v", err)
+	}
+	signatures[1] = &Signature{R: []byte{1, 2, 3}, s: Sign("second", sk).s}
+	if _, err := HalfAggregate(messages, signatures, pk); err != ErrInvalidSignature {
+		t.Errorf("malformed signature: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+//go:build !schnorr_minimal || schnorr_aggregate
+
+package schnorr
+
+import (
+	"context"
+	"time"
+)
+
+/*
+Streaming aggregation of signed events
+
+Aggregator consumes signed messages from a channel, keeps them grouped by
+signer and periodically compacts every group into a Checkpoint carrying a single
+half-aggregated signature instead of one signature per message. Signatures are
+batch verified before compaction, invalid ones are dropped and only counted.
+*/
+
+/*
+Compacted messages of a single signer
+*/
+type Checkpoint struct {
+	PublicKey *PublicKey
+	Messages  []string
+	Aggregate *AggregateSignature
+	Rejected  int // number of dropped messages with invalid signatures
+}
+
+type Aggregator struct {
+	maxItems int
+	interval time.Duration
+	verifier *BatchVerifier
+
+	pending map[string][]BatchItem // key ID -> signed messages waiting for the checkpoint
+}
+
+/*
+Checkpoints are emitted when a signer has maxItems pending messages
+and every interval for all signers with pending messages
+*/
+func NewAggregator(maxItems int, interval time.Duration) *Aggregator {
+	return &Aggregator{
+		maxItems: maxItems,
+		interval: interval,
+		verifier: NewBatchVerifier(nil),
+		pending:  make(map[string][]BatchItem),
+	}
+}
+
+/*
+Consume in until it's closed or ctx is done and emit checkpoints to out.
+Pending messages are flushed when in is closed, but not when ctx is done.
+*/
+func (a *Aggregator) Run(ctx context.Context, in <-chan BatchItem, out chan<- *Checkpoint) error {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	emit := func(checkpoint *Checkpoint) error {
+		select {
+		case out <- checkpoint:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		select {
+		case item, ok := <-in:
+			if !ok {
+				for keyID := range a.pending {
+					if err := emit(a.checkpoint(keyID)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			keyID := item.PublicKey.KeyID()
+			a.pending[keyID] = append(a.pending[keyID], item)
+			if len(a.pending[keyID]) >= a.maxItems {
+				if err := emit(a.checkpoint(keyID)); err != nil {
+					return err
+				}
+			}
+
+		case <-ticker.C:
+			for keyID := range a.pending {
+				if err := emit(a.checkpoint(keyID)); err != nil {
+					return err
+				}
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+/*
+Verify and compact pending messages of the signer. Aggregate is nil
+if all of them were rejected.
+*/
+func (a *Aggregator) checkpoint(keyID string) *Checkpoint {
+	items := a.pending[keyID]
+	delete(a.pending, keyID)
+
+	invalid := a.verifier.Verify(items)
+	checkpoint := &Checkpoint{PublicKey: items[0].PublicKey, Rejected: len(invalid)}
+
+	var signatures []*Signature
+	for i, item := range items {
+		if len(invalid) > 0 && invalid[0] == i {
+			invalid = invalid[1:]
+			continue
+		}
+		checkpoint.Messages = append(checkpoint.Messages, item.Message)
+		signatures = append(signatures, item.Signature)
+	}
+	if len(signatures) == 0 {
+		return checkpoint
+	}
+
+	// can't fail, the number of messages and signatures is the same
+	checkpoint.Aggregate, _ = HalfAggregate(checkpoint.Messages, signatures, checkpoint.PublicKey)
+	return checkpoint
+}
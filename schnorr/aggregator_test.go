@@ -0,0 +1,59 @@
+//go:build !schnorr_minimal || schnorr_aggregate
+
+package schnorr
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogSegmentExpiredKey(t *testing.T) {
+	sk, pk, c := expiringKeys(t)
+	c.Advance(2 * time.Hour)
+
+	segment := NewLogSegment(sk, pk)
+	if _, err := segment.Append("entry"); err != ErrKeyExpired {
+		t.Fatalf("LogSegment.Append with an expired key: %v", err)
+	}
+	if entries, _, _ := segment.Seal(); len(entries) != 0 {
+		t.Fatal("entry appended without a signature")
+	}
+}
+
+func TestConcurrentLogSegment(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment := NewLogSegment(sk, pk)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 4; j++ {
+				entry := fmt.Sprintf("entry %d/%d", i, j)
+				signature, err := segment.Append(entry)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !VerifySignature(entry, signature, pk) {
+					t.Errorf("signature of %q doesn't verify", entry)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	entries, aggregate, err := segment.Seal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 32 || !VerifyAggregate(entries, aggregate, pk) {
+		t.Fatalf("aggregate of %d entries doesn't verify", len(entries))
+	}
+}
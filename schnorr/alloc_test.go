@@ -0,0 +1,127 @@
+package schnorr
+
+import (
+	"math/big"
+	"testing"
+)
+
+/*
+SignTo (with a reused destination signature) and VerifySignature don't
+allocate in steady state in any built-in group: the scalar arithmetic runs in
+the pooled scratch space of internal/modp and the group elements are computed
+and encoded into reused buffers (internal/group.Appender). A change that
+makes either allocate fails the test.
+*/
+var allocGroups = []struct {
+	name   string
+	params uint16
+}{
+	{"modp-2048", ParamsMODP2048},
+	{"secp256k1", ParamsSecp256k1},
+	{"p256", ParamsP256},
+}
+
+func TestAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("pool drops values under the race detector")
+	}
+	for _, params := range allocGroups {
+		sk, pk, err := GenerateKeysWithParamsID(params.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := "schnorr allocation test"
+		signature := &Signature{}
+		if err := SignTo(signature, message, sk); err != nil {
+			t.Fatal(err)
+		}
+
+		if allocs := testing.AllocsPerRun(10, func() { SignTo(signature, message, sk) }); allocs != 0 {
+			t.Errorf("%s: SignTo %v allocations", params.name, allocs)
+		}
+		if allocs := testing.AllocsPerRun(10, func() { VerifySignature(message, signature, pk) }); allocs != 0 {
+			t.Errorf("%s: VerifySignature %v allocations", params.name, allocs)
+		}
+	}
+}
+
+func BenchmarkSignTo(b *testing.B) {
+	for _, params := range allocGroups {
+		sk, _, err := GenerateKeysWithParamsID(params.params)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(params.name, func(b *testing.B) {
+			signature := &Signature{}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := SignTo(signature, "schnorr benchmark", sk); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVerifySignature(b *testing.B) {
+	for _, params := range allocGroups {
+		sk, pk, err := GenerateKeysWithParamsID(params.params)
+		if err != nil {
+			b.Fatal(err)
+		}
+		signature := Sign("schnorr benchmark", sk)
+		b.Run(params.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !VerifySignature("schnorr benchmark", signature, pk) {
+					b.Fatalf("%s: signature doesn't verify", params.name)
+				}
+			}
+		})
+	}
+}
+
+/*
+Group without the Appender methods, verified on the decoding path
+*/
+type decodingGroup struct {
+	Group
+}
+
+/*
+The allocation-free verification (encoded comparison) accepts exactly the
+signatures the decoding path accepts
+*/
+func TestAppendVerification(t *testing.T) {
+	for _, params := range allocGroups {
+		sk, pk, err := GenerateKeysWithParamsID(params.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoding := &PublicKey{group: decodingGroup{pk.group}, X: pk.X}
+		message := "schnorr verification test"
+		signature := Sign(message, sk)
+		other := Sign(message+"!", sk)
+
+		R := append([]byte(nil), signature.R...)
+		R[len(R)-1] ^= 1
+		flipped := append([]byte(nil), signature.R...)
+		flipped[0] ^= 1
+		cases := map[string]*Signature{
+			"valid":       signature,
+			"other R":     {other.R, signature.s},
+			"tampered R":  {R, signature.s},
+			"first byte":  {flipped, signature.s},
+			"truncated R": {signature.R[:len(signature.R)-1], signature.s},
+			"tampered s":  {signature.R, new(big.Int).Add(signature.s, big.NewInt(1))},
+			"s + q":       {signature.R, new(big.Int).Add(signature.s, pk.group.Order())},
+			"zero s":      {signature.R, new(big.Int)},
+		}
+		for name, sig := range cases {
+			got, want := VerifySignature(message, sig, pk), VerifySignature(message, sig, decoding)
+			if got != want || got != (name == "valid") {
+				t.Errorf("%s %s: appending %v, decoding %v", params.name, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package schnorr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Linting of group parameters and keys
+
+Analyze* functions report weaknesses instead of failing on the first one, so
+integrators can log all of them and gate key acceptance on the worst severity:
+
+	report, err := schnorr.AnalyzePublicKeyBytes(b)
+	if err != nil || report.Check(schnorr.SeverityWarning) != nil {
+		// reject the key
+	}
+
+Short private scalars can only be detected from signature keys, public keys
+don't reveal the size of the discrete logarithm.
+*/
+
+var ErrWeakKey = errors.New("schnorr: key or parameters failed analysis")
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+/*
+Finding codes
+*/
+const (
+	FindingSmallModulus   = "small-modulus"
+	FindingCompositeOrder = "composite-order"
+	FindingLowOrderGen    = "low-order-generator"
+	FindingShortScalar    = "short-private-scalar"
+	FindingIdentityKey    = "identity-public-key"
+	FindingNonCanonical   = "non-canonical-encoding"
+	FindingUnknownParams  = "unregistered-params"
+	FindingExpired        = "expired-key"
+)
+
+/*
+Private scalars shorter than the group order by more than this many bits are reported
+*/
+const shortScalarSlack = 64
+
+type Finding struct {
+	Severity Severity
+	Code     string
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Code, f.Message)
+}
+
+/*
+Result of the analysis, empty if nothing was found
+*/
+type Report struct {
+	Findings []Finding
+}
+
+func (r *Report) add(severity Severity, code, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, Finding{severity, code, fmt.Sprintf(format, args...)})
+}
+
+/*
+Highest severity of the findings, -1 if there are none
+*/
+func (r *Report) Worst() Severity {
+	worst := Severity(-1)
+	for _, f := range r.Findings {
+		if f.Severity > worst {
+			worst = f.Severity
+		}
+	}
+	return worst
+}
+
+/*
+Returns error wrapping ErrWeakKey if any finding is at least as severe as threshold
+*/
+func (r *Report) Check(threshold Severity) error {
+	var failed []string
+	for _, f := range r.Findings {
+		if f.Severity >= threshold {
+			failed = append(failed, f.Code)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %s", ErrWeakKey, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	for _, f := range r.Findings {
+		sb.WriteString(f.String() + "\n")
+	}
+	return sb.String()
+}
+
+/*
+Analyze group parameters
+*/
+func AnalyzeParams(params *GroupParams) *Report {
+	r := &Report{}
+	if params == nil || params.modp == nil {
+		r.add(SeverityCritical, FindingCompositeOrder, "parameters are missing")
+		return r
+	}
+	analyzeGroup(r, params.modp)
+	return r
+}
+
+/*
+Analyze public key and its group parameters
+*/
+func AnalyzePublicKey(pk *PublicKey) *Report {
+	r := &Report{}
+	analyzePublicKey(r, pk)
+	return r
+}
+
+/*
+Analyze signature key and its group parameters
+*/
+func AnalyzeSignatureKey(sk *SignatureKey) *Report {
+	r := &Report{}
+	if analyzeGroup(r, sk.group) {
+		analyzeScalar(r, sk.x, sk.group.Order())
+	}
+	if !sk.notAfter.IsZero() && Now().After(sk.notAfter) {
+		r.add(SeverityWarning, FindingExpired, "key expired at %s", sk.notAfter.Format(time.RFC3339))
+	}
+	return r
+}
+
+/*
+Analyze public key encoded with PublicKey.Bytes, including the encoding itself.
+Returns ErrInvalidEncoding if the key can't be parsed at all.
+*/
+func AnalyzePublicKeyBytes(b []byte) (*Report, error) {
+	pk, err := ParsePublicKey(b)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{}
+	if !bytes.Equal(pk.Bytes(), b) {
+		r.add(SeverityWarning, FindingNonCanonical, "encoding differs from the canonical one")
+	}
+	analyzePublicKey(r, pk)
+	return r, nil
+}
+
+func analyzePublicKey(r *Report, pk *PublicKey) {
+	if !analyzeGroup(r, pk.group) {
+		return
+	}
+	if _, err := pk.group.Encode(pk.X); err != nil {
+		r.add(SeverityCritical, FindingIdentityKey, "X is the identity or not a group element")
+		return
+	}
+	if pk.Expired(Now()) {
+		r.add(SeverityWarning, FindingExpired, "key expired at %s", pk.notAfter.Format(time.RFC3339))
+	}
+}
+
+/*
+Checks of the group, returns false if the group is unusable for further key checks
+*/
+func analyzeGroup(r *Report, g Group) bool {
+	if g == nil {
+		r.add(SeverityCritical, FindingCompositeOrder, "group is missing")
+		return false
+	}
+
+	usable := true
+	if m, ok := g.(*group.ModP); ok {
+		p, q := m.P(), m.Q()
+		if bits := p.BitLen(); bits < minParamsBits {
+			r.add(SeverityCritical, FindingSmallModulus, "p has %d bits, at least %d required", bits, minParamsBits)
+		}
+		if !p.ProbablyPrime(64) {
+			r.add(SeverityCritical, FindingCompositeOrder, "p is not prime")
+			usable = false
+		} else if !q.ProbablyPrime(64) {
+			r.add(SeverityCritical, FindingCompositeOrder, "p is not a safe prime, (p - 1) / 2 is composite")
+			usable = false
+		}
+		if !m.Contains(m.G()) {
+			r.add(SeverityCritical, FindingLowOrderGen, "g doesn't generate the subgroup of order (p - 1) / 2")
+			usable = false
+		}
+	}
+
+	if _, ok := groupID(g); !ok {
+		r.add(SeverityInfo, FindingUnknownParams, "parameters are not registered")
+	}
+	return usable
+}
+
+func analyzeScalar(r *Report, x, q *big.Int) {
+	switch bits := x.BitLen(); {
+	case bits == 0:
+		r.add(SeverityCritical, FindingShortScalar, "private key is zero")
+	case bits < 128:
+		r.add(SeverityCritical, FindingShortScalar, "private key has only %d bits", bits)
+	case bits < q.BitLen()-shortScalarSlack:
+		r.add(SeverityWarning, FindingShortScalar, "private key has %d bits, group order %d", bits, q.BitLen())
+	}
+}
@@ -0,0 +1,143 @@
+package schnorr
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Batch of n signatures of the group, key and message differ per signature
+*/
+func batchItems(t testing.TB, params uint16, n int) []BatchItem {
+	items := make([]BatchItem, n)
+	for i := range items {
+		sk, pk, err := GenerateKeysWithParamsID(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := fmt.Sprintf("batch message %d", i)
+		items[i] = BatchItem{m, Sign(m, sk), pk}
+	}
+	return items
+}
+
+func TestMultiScalarMult(t *testing.T) {
+	for _, params := range []uint16{ParamsSecp256k1, ParamsP256, ParamsMODP2048} {
+		sk, pk, err := GenerateKeysWithParamsID(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := sk.group
+		q := g.Order()
+		elements := []Element{pk.X, g.ScalarBaseMult(big.NewInt(5)), pk.X}
+		scalars := []*big.Int{new(big.Int).Sub(q, big.NewInt(3)), big.NewInt(1 << 40), big.NewInt(-2)}
+
+		var want Element
+		for i, e := range elements {
+			term := g.ScalarMult(e, scalars[i])
+			if want == nil {
+				want = term
+			} else {
+				want = g.Add(want, term)
+			}
+		}
+		if got := group.MultiScalarMult(g, elements, scalars); !g.Equal(got, want) {
+			t.Errorf("%s: MultiScalarMult differs from the sum of ScalarMults", g.Name())
+		}
+
+		// x*X - x*X is the identity
+		zero := group.MultiScalarMult(g, []Element{pk.X, g.ScalarBaseMult(big.NewInt(1))}, []*big.Int{big.NewInt(1), new(big.Int).Neg(sk.x)})
+		if !g.Equal(zero, g.ScalarBaseMult(new(big.Int))) {
+			t.Errorf("%s: MultiScalarMult doesn't reach the identity", g.Name())
+		}
+	}
+}
+
+func TestBatchVerifier(t *testing.T) {
+	var items []BatchItem
+	for _, params := range []uint16{ParamsSecp256k1, ParamsP256, ParamsMODP2048} {
+		items = append(items, batchItems(t, params, 4)...)
+	}
+	verifier := NewBatchVerifier(CPUBatchBackend{})
+	if invalid := verifier.Verify(items); invalid != nil {
+		t.Fatalf("valid batch: invalid %v", invalid)
+	}
+
+	// wrong message, signature of another key and a response out of range
+	items[1].Message += "!"
+	items[6].Signature = items[7].Signature
+	items[9].Signature = &Signature{items[9].Signature.R, new(big.Int).Add(items[9].Signature.s, items[9].PublicKey.group.Order())}
+	if invalid := verifier.Verify(items); !reflect.DeepEqual(invalid, []int{1, 6, 9}) {
+		t.Errorf("invalid %v, want [1 6 9]", invalid)
+	}
+	if ok, err := (CPUBatchBackend{}).VerifyBatch(nil); !ok || err != nil {
+		t.Errorf("empty batch: %v, %v", ok, err)
+	}
+}
+
+/*
+Batch verification as before the multi-scalar multiplication: two scalar
+multiplications per signature
+*/
+type separateBackend struct{}
+
+func (separateBackend) Name() string {
+	return "separate"
+}
+
+func (separateBackend) VerifyBatch(entries []BatchEntry) (bool, error) {
+	bound := new(big.Int).Lsh(big.NewInt(1), 128)
+	left, right := new(big.Int), Element(nil)
+	for _, e := range entries {
+		g := e.Group
+		a, err := randomScalar(bound)
+		if err != nil {
+			return false, err
+		}
+		left.Add(left, new(big.Int).Mul(a, e.S))
+		term := g.ScalarMult(g.Add(e.R, g.ScalarMult(e.X, e.C)), a)
+		if right == nil {
+			right = term
+		} else {
+			right = g.Add(right, term)
+		}
+	}
+	g := entries[0].Group
+	return g.Equal(g.ScalarBaseMult(left), right), nil
+}
+
+/*
+64 signatures per batch, CPUBatchBackend against two scalar multiplications
+per signature and against verifying one by one
+*/
+func BenchmarkBatchVerify(b *testing.B) {
+	for _, params := range []struct {
+		name string
+		id   uint16
+	}{{"secp256k1", ParamsSecp256k1}, {"P-256", ParamsP256}, {"modp-2048", ParamsMODP2048}} {
+		items := batchItems(b, params.id, 64)
+		for _, backend := range []BatchVerifierBackend{CPUBatchBackend{}, separateBackend{}} {
+			verifier := NewBatchVerifier(backend)
+			b.Run(params.name+"/"+backend.Name(), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if verifier.Verify(items) != nil {
+						b.Fatal("batch doesn't verify")
+					}
+				}
+			})
+		}
+		b.Run(params.name+"/one-by-one", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, item := range items {
+					if !VerifySignature(item.Message, item.Signature, item.PublicKey) {
+						b.Fatal("signature doesn't verify")
+					}
+				}
+			}
+		})
+	}
+}
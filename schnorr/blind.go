@@ -0,0 +1,292 @@
+//go:build !schnorr_minimal || schnorr_blind
+
+package schnorr
+
+import (
+	"errors"
+	"math/big"
+)
+
+/*
+Blind Schnorr signature protocol
+
+The Signer signs a message it never sees, the User (requester) ends up with an
+ordinary Signature the Signer can't link to the session it was issued in:
+
+	Signer:  R = SignerCommit()          R = rG
+	User:    c = RequesterChallenge(R)   R' = R + aG + bX, c' = H(R'||m), c = (c' + b)modq
+	Signer:  s = SignerRespond(c)        s = (r + cx)modq
+	User:    RequesterFinalize(s)        checks sG == R + cX, signature is {R', (s + a)modq}
+
+written additively (in the mod p groups R = g^r, R' = R * g^a * X^b and so on).
+
+BlindSigner and BlindRequester hold the state of a single session on either
+side, BlindCommitment, BlindChallenge and BlindResponse are the messages passed
+between them. Each session answers exactly one challenge, answering two with the
+same r reveals the private key. Signers which keep many sessions open at once are
+exposed to the ROS attack (see package attacks), limit the number of concurrent
+sessions or use StatelessBlindSigner with short token lifetimes.
+*/
+
+var (
+	ErrBlindState           = errors.New("schnorr: blind signing step called out of order")
+	ErrInvalidBlindMessage  = errors.New("schnorr: invalid blind signing message")
+	ErrInvalidBlindResponse = errors.New("schnorr: signer's response doesn't verify")
+)
+
+/*
+Signer -> User: nonce commitment R
+*/
+type BlindCommitment struct {
+	R []byte // encoding of R
+}
+
+/*
+User -> Signer: blinded challenge c
+*/
+type BlindChallenge struct {
+	C *big.Int
+}
+
+/*
+Signer -> User: response s
+*/
+type BlindResponse struct {
+	S *big.Int
+}
+
+/*
+Signer side of a single session
+*/
+type BlindSigner struct {
+	sk *SignatureKey
+	r  *big.Int // session nonce, nil before SignerCommit and after SignerRespond
+	R  []byte   // encoded nonce commitment, set once by SignerCommit
+}
+
+/*
+User side of a single session
+*/
+type BlindRequester struct {
+	pk      *PublicKey
+	message string
+	a       *big.Int // blinding factor of the nonce, nil after RequesterFinalize
+	R       Element  // signer's commitment
+	RP      []byte   // encoded blinded commitment R'
+	c       *big.Int // challenge sent to the signer
+
+	seed      []byte // blinding factor seed, nil for random factors (see NewSeededBlindRequester)
+	sessionID string
+}
+
+func NewBlindSigner(sk *SignatureKey) *BlindSigner {
+	return &BlindSigner{sk: sk}
+}
+
+func NewBlindRequester(pk *PublicKey) *BlindRequester {
+	return &BlindRequester{pk: pk}
+}
+
+/*
+Step 1 - generate the session nonce r and commit to it with R = rG.
+Repeated calls return the same commitment.
+*/
+func (s *BlindSigner) SignerCommit() (*BlindCommitment, error) {
+	if s.R != nil {
+		return &BlindCommitment{s.R}, nil
+	}
+	g := s.sk.group
+	r, err := randomScalar(g.Order())
+	if err != nil {
+		return nil, err
+	}
+	R, err := g.Encode(g.ScalarBaseMult(r))
+	if err != nil {
+		return nil, err
+	}
+	s.r, s.R = r, R
+	report("blind/commit", "R", s.R)
+	return &BlindCommitment{s.R}, nil
+}
+
+/*
+Step 2 - blind the commitment and compute the challenge for the message
+*/
+func (u *BlindRequester) RequesterChallenge(commitment *BlindCommitment, m string) (*BlindChallenge, error) {
+	if u.R != nil {
+		return nil, ErrBlindState
+	}
+	g := u.pk.group
+	if commitment == nil {
+		return nil, ErrInvalidBlindMessage
+	}
+	R, err := g.Decode(commitment.R)
+	if err != nil {
+		return nil, ErrInvalidBlindMessage
+	}
+
+	a, b, err := u.blindingFactors(commitment.R, m)
+	if err != nil {
+		return nil, err
+	}
+
+	// R' = R + aG + bX
+	RP, err := g.Encode(g.Add(R, g.Add(g.ScalarBaseMult(a), g.ScalarMult(u.pk.X, b))))
+	if err != nil {
+		return nil, ErrInvalidBlindMessage
+	}
+
+	// c = (H(R'||m) + b)modq
+	q := g.Order()
+	c := u.pk.challenge(RP, m)
+	c.Add(c, b)
+	c.Mod(c, q)
+
+	u.message, u.a, u.R, u.RP, u.c = m, a, R, RP, c
+	report("blind/challenge", "c", c)
+	return &BlindChallenge{c}, nil
+}
+
+/*
+Step 3 - answer the challenge with s = (r + cx)modq, only once per session
+*/
+func (s *BlindSigner) SignerRespond(challenge *BlindChallenge) (*BlindResponse, error) {
+	if s.r == nil {
+		return nil, ErrBlindState
+	}
+	if challenge == nil || challenge.C == nil || challenge.C.Sign() < 0 || challenge.C.Cmp(s.sk.group.Order()) >= 0 {
+		return nil, ErrInvalidBlindMessage
+	}
+	if err := s.sk.checkExpiry(Now()); err != nil {
+		return nil, err
+	}
+	if s.sk.x.Sign() == 0 {
+		return nil, ErrKeyZeroized
+	}
+
+	r := s.r
+	s.r = nil
+	sig := new(big.Int).Mul(challenge.C, s.sk.x)
+	sig.Add(sig, r).Mod(sig, s.sk.group.Order())
+	report("blind/respond", "s", sig)
+	return &BlindResponse{sig}, nil
+}
+
+/*
+Step 4 - check the response (sG == R + cX) and unblind it into the signature {R', (s + a)modq}
+*/
+func (u *BlindRequester) RequesterFinalize(response *BlindResponse) (*Signature, error) {
+	if u.a == nil {
+		return nil, ErrBlindState
+	}
+	g := u.pk.group
+	q := g.Order()
+	if response == nil || response.S == nil || response.S.Sign() < 0 || response.S.Cmp(q) >= 0 {
+		return nil, ErrInvalidBlindMessage
+	}
+
+	if !g.Equal(g.ScalarBaseMult(response.S), g.Add(u.R, g.ScalarMult(u.pk.X, u.c))) {
+		report("blind/finalize", "error", ErrInvalidBlindResponse)
+		return nil, ErrInvalidBlindResponse
+	}
+
+	sp := new(big.Int).Add(response.S, u.a)
+	u.a = nil
+	signature := &Signature{u.RP, sp.Mod(sp, q)}
+	if !VerifySignature(u.message, signature, u.pk) {
+		report("blind/finalize", "error", ErrInvalidBlindResponse)
+		return nil, ErrInvalidBlindResponse
+	}
+	report("blind/finalize", "R'", signature.R, "s'", signature.s)
+	return signature, nil
+}
+
+/*
+Encoding of the messages: len(v)||v, see appendInts and appendElement
+*/
+func (m *BlindCommitment) Bytes() []byte {
+	return appendElement(nil, m.R)
+}
+
+func (m *BlindChallenge) Bytes() []byte {
+	return appendInts(nil, m.C)
+}
+
+func (m *BlindResponse) Bytes() []byte {
+	return appendInts(nil, m.S)
+}
+
+func ParseBlindCommitment(b []byte) (*BlindCommitment, error) {
+	R, rest, err := splitElement(b)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrInvalidBlindMessage
+	}
+	return &BlindCommitment{R}, nil
+}
+
+func ParseBlindChallenge(b []byte) (*BlindChallenge, error) {
+	v, err := readBlindMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	return &BlindChallenge{v}, nil
+}
+
+func ParseBlindResponse(b []byte) (*BlindResponse, error) {
+	v, err := readBlindMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	return &BlindResponse{v}, nil
+}
+
+func readBlindMessage(b []byte) (*big.Int, error) {
+	ints, err := readInts(b, 1)
+	if err != nil {
+		return nil, err
+	}
+	return ints[0], nil
+}
+
+/*
+Run both sides of the blind signature protocol in one process, e.g. for
+demonstrations. The steps are reported to the package Reporter.
+*/
+func BlindSignatureProcess(message string, signerSignatureKey *SignatureKey, publicKey *PublicKey) (*Signature, error) {
+	signer, requester := NewBlindSigner(signerSignatureKey), NewBlindRequester(publicKey)
+
+	commitment, err := signer.SignerCommit()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := requester.RequesterChallenge(commitment, message)
+	if err != nil {
+		return nil, err
+	}
+	response, err := signer.SignerRespond(challenge)
+	if err != nil {
+		return nil, err
+	}
+	return requester.RequesterFinalize(response)
+}
+
+func init() {
+	RegisterSelfTest("blind", selfTestBlind)
+}
+
+/*
+Pairwise self-test of the protocol, the blind signature has to verify like any other
+*/
+func selfTestBlind() error {
+	sk, pk, err := GenerateKeysWithParamsID(selfTestParams())
+	if err != nil {
+		return err
+	}
+	signature, err := BlindSignatureProcess(selfTestMessage, sk, pk)
+	if err != nil {
+		return err
+	}
+	return checkVerify(
+		VerifySignature(selfTestMessage, signature, pk),
+		VerifySignature(selfTestMessage+"!", signature, pk))
+}
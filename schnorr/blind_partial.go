@@ -0,0 +1,357 @@
+//go:build !schnorr_minimal || schnorr_blind
+
+package schnorr
+
+import (
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Partially blind Schnorr signatures (Abe-Okamoto)
+
+The message stays hidden from the Signer as in the blind protocol, but both
+parties also agree on a public info string (expiry date, denomination, ...)
+which the Signer sees and which is bound into the signature. The signature
+only verifies for that info, so a Signer issuing tokens of several
+denominations can't be tricked into signing a different one, and verifiers
+read the info from the token instead of trusting the User.
+
+With Z = F(info) the Signer proves knowledge of x (X = xG) or of log Z,
+split the challenge between the two:
+
+	Signer:  A, B = SignerCommit()      A = uG, B = sG + dZ
+	User:    e = RequesterChallenge()   A' = A + t1G + t2X, B' = B + t3G + t4Z,
+	                                    e' = H(A'||B'||Z||m), e = (e' - t2 - t4)modq
+	Signer:  r, c, s, d = Respond(e)    c = (e - d)modq, r = (u - cx)modq
+	User:    RequesterFinalize()        signature {r + t1, c + t2, s + t3, d + t4}
+
+and a signature {rho, omega, sigma, delta} is valid if
+
+	omega + delta = H(rho G + omega X || sigma G + delta Z || Z || m)  (mod q)
+
+Nobody knows log Z, it's hashed into the group (see group.HashToElement).
+Info is not hidden: signatures with the same info are linkable to the
+sessions with that info, so the info should take few distinct values. As with
+BlindSigner, each session answers one challenge, and many concurrent sessions
+expose the Signer to the ROS attack.
+*/
+
+/*
+Signer -> User: encoded commitments A, B
+*/
+type PartiallyBlindCommitment struct {
+	A, B []byte
+}
+
+/*
+Signer -> User: response r, c, s, d
+*/
+type PartiallyBlindResponse struct {
+	R, C, S, D *big.Int
+}
+
+/*
+Partially blind signature of a message and info
+*/
+type PartiallyBlindSignature struct {
+	Rho, Omega, Sigma, Delta *big.Int
+}
+
+/*
+Signer side of a single session
+*/
+type PartiallyBlindSigner struct {
+	sk      *SignatureKey
+	info    []byte
+	z       Element  // F(info)
+	u, s, d *big.Int // session secrets, nil before SignerCommit and after SignerRespond
+	A, B    []byte   // encoded commitments, set once by SignerCommit
+}
+
+/*
+User side of a single session
+*/
+type PartiallyBlindRequester struct {
+	pk             *PublicKey
+	info           []byte
+	z              Element // F(info)
+	message        string
+	t1, t2, t3, t4 *big.Int // blinding factors, nil after RequesterFinalize
+	A, B           Element  // signer's commitments
+	e              *big.Int // challenge sent to the signer
+}
+
+/*
+Signer of a session for info, which the User has to request with the same info
+*/
+func NewPartiallyBlindSigner(sk *SignatureKey, info []byte) *PartiallyBlindSigner {
+	return &PartiallyBlindSigner{sk: sk, info: append([]byte(nil), info...), z: infoElement(info, sk.group)}
+}
+
+func NewPartiallyBlindRequester(pk *PublicKey, info []byte) *PartiallyBlindRequester {
+	return &PartiallyBlindRequester{pk: pk, info: append([]byte(nil), info...), z: infoElement(info, pk.group)}
+}
+
+/*
+Info the session signs
+*/
+func (s *PartiallyBlindSigner) Info() []byte {
+	return append([]byte(nil), s.info...)
+}
+
+/*
+Step 1 - pick the session secrets u, s, d and commit to them.
+Repeated calls return the same commitment.
+*/
+func (s *PartiallyBlindSigner) SignerCommit() (*PartiallyBlindCommitment, error) {
+	if s.A != nil {
+		return &PartiallyBlindCommitment{s.A, s.B}, nil
+	}
+	g := s.sk.group
+	secrets, err := randomScalars(g.Order(), 3)
+	if err != nil {
+		return nil, err
+	}
+	u, sv, d := secrets[0], secrets[1], secrets[2]
+	A, err := g.Encode(g.ScalarBaseMult(u))
+	if err != nil {
+		return nil, err
+	}
+	B, err := g.Encode(g.Add(g.ScalarBaseMult(sv), g.ScalarMult(s.z, d)))
+	if err != nil {
+		return nil, err
+	}
+	s.u, s.s, s.d, s.A, s.B = u, sv, d, A, B
+	report("partially-blind/commit", "A", s.A, "B", s.B)
+	return &PartiallyBlindCommitment{s.A, s.B}, nil
+}
+
+/*
+Step 2 - blind the commitments and compute the challenge for the message
+*/
+func (u *PartiallyBlindRequester) RequesterChallenge(commitment *PartiallyBlindCommitment, m string) (*BlindChallenge, error) {
+	if u.A != nil {
+		return nil, ErrBlindState
+	}
+	g := u.pk.group
+	q := g.Order()
+	if commitment == nil {
+		return nil, ErrInvalidBlindMessage
+	}
+	A, errA := g.Decode(commitment.A)
+	B, errB := g.Decode(commitment.B)
+	if errA != nil || errB != nil {
+		return nil, ErrInvalidBlindMessage
+	}
+
+	t, err := randomScalars(q, 4)
+	if err != nil {
+		return nil, err
+	}
+	t1, t2, t3, t4 := t[0], t[1], t[2], t[3]
+
+	// A' = A + t1G + t2X, B' = B + t3G + t4Z
+	AP := g.Add(A, g.Add(g.ScalarBaseMult(t1), g.ScalarMult(u.pk.X, t2)))
+	BP := g.Add(B, g.Add(g.ScalarBaseMult(t3), g.ScalarMult(u.z, t4)))
+
+	// e = (H(A'||B'||Z||m) - t2 - t4)modq
+	e, err := partiallyBlindChallenge(g, AP, BP, u.z, m)
+	if err != nil {
+		return nil, ErrInvalidBlindMessage
+	}
+	e.Sub(e, t2).Sub(e, t4).Mod(e, q)
+
+	u.message, u.A, u.B, u.e = m, A, B, e
+	u.t1, u.t2, u.t3, u.t4 = t1, t2, t3, t4
+	report("partially-blind/challenge", "e", e)
+	return &BlindChallenge{e}, nil
+}
+
+/*
+Step 3 - split the challenge into c = (e - d)modq and answer it with
+r = (u - cx)modq, only once per session
+*/
+func (s *PartiallyBlindSigner) SignerRespond(challenge *BlindChallenge) (*PartiallyBlindResponse, error) {
+	if s.u == nil {
+		return nil, ErrBlindState
+	}
+	q := s.sk.group.Order()
+	if challenge == nil || !inRange(challenge.C, q) {
+		return nil, ErrInvalidBlindMessage
+	}
+	if err := s.sk.checkExpiry(Now()); err != nil {
+		return nil, err
+	}
+
+	u, sv, d := s.u, s.s, s.d
+	s.u, s.s, s.d = nil, nil, nil
+	c := new(big.Int).Sub(challenge.C, d)
+	c.Mod(c, q)
+	r := new(big.Int).Mul(c, s.sk.x)
+	r.Sub(u, r).Mod(r, q)
+	report("partially-blind/respond", "r", r, "c", c)
+	return &PartiallyBlindResponse{r, c, sv, d}, nil
+}
+
+/*
+Step 4 - check the response and unblind it into the signature
+{(r + t1)modq, (c + t2)modq, (s + t3)modq, (d + t4)modq}
+*/
+func (u *PartiallyBlindRequester) RequesterFinalize(response *PartiallyBlindResponse) (*PartiallyBlindSignature, error) {
+	if u.t1 == nil {
+		return nil, ErrBlindState
+	}
+	g := u.pk.group
+	q := g.Order()
+	if response == nil || !inRange(response.R, q) || !inRange(response.C, q) || !inRange(response.S, q) || !inRange(response.D, q) {
+		return nil, ErrInvalidBlindMessage
+	}
+
+	// c + d = e, rG + cX = A, sG + dZ = B
+	e := new(big.Int).Add(response.C, response.D)
+	A := g.Add(g.ScalarBaseMult(response.R), g.ScalarMult(u.pk.X, response.C))
+	B := g.Add(g.ScalarBaseMult(response.S), g.ScalarMult(u.z, response.D))
+	if e.Mod(e, q).Cmp(u.e) != 0 || !g.Equal(A, u.A) || !g.Equal(B, u.B) {
+		report("partially-blind/finalize", "error", ErrInvalidBlindResponse)
+		return nil, ErrInvalidBlindResponse
+	}
+
+	unblind := func(v, t *big.Int) *big.Int {
+		sum := new(big.Int).Add(v, t)
+		return sum.Mod(sum, q)
+	}
+	signature := &PartiallyBlindSignature{
+		Rho:   unblind(response.R, u.t1),
+		Omega: unblind(response.C, u.t2),
+		Sigma: unblind(response.S, u.t3),
+		Delta: unblind(response.D, u.t4),
+	}
+	u.t1, u.t2, u.t3, u.t4 = nil, nil, nil, nil
+	if !VerifyPartiallyBlind(u.message, u.info, signature, u.pk) {
+		report("partially-blind/finalize", "error", ErrInvalidBlindResponse)
+		return nil, ErrInvalidBlindResponse
+	}
+	report("partially-blind/finalize", "omega", signature.Omega, "delta", signature.Delta)
+	return signature, nil
+}
+
+/*
+Verify partially blind signature of message m and info:
+omega + delta = H(rho G + omega X || sigma G + delta Z || Z || m)
+*/
+func VerifyPartiallyBlind(m string, info []byte, signature *PartiallyBlindSignature, pk *PublicKey) bool {
+	if pk.Validate() != nil || signature == nil {
+		return false
+	}
+	g := pk.group
+	q := g.Order()
+	if !inRange(signature.Rho, q) || !inRange(signature.Omega, q) || !inRange(signature.Sigma, q) || !inRange(signature.Delta, q) {
+		return false
+	}
+
+	z := infoElement(info, g)
+	if z == nil {
+		return false
+	}
+	A := g.Add(g.ScalarBaseMult(signature.Rho), g.ScalarMult(pk.X, signature.Omega))
+	B := g.Add(g.ScalarBaseMult(signature.Sigma), g.ScalarMult(z, signature.Delta))
+	e, err := partiallyBlindChallenge(g, A, B, z, m)
+	if err != nil {
+		return false
+	}
+	sum := new(big.Int).Add(signature.Omega, signature.Delta)
+	return sum.Mod(sum, q).Cmp(e) == 0
+}
+
+/*
+Run both sides of the partially blind signature protocol in one process
+*/
+func PartiallyBlindSignatureProcess(message string, info []byte, signerSignatureKey *SignatureKey, publicKey *PublicKey) (*PartiallyBlindSignature, error) {
+	signer, requester := NewPartiallyBlindSigner(signerSignatureKey, info), NewPartiallyBlindRequester(publicKey, info)
+
+	commitment, err := signer.SignerCommit()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := requester.RequesterChallenge(commitment, message)
+	if err != nil {
+		return nil, err
+	}
+	response, err := signer.SignerRespond(challenge)
+	if err != nil {
+		return nil, err
+	}
+	return requester.RequesterFinalize(response)
+}
+
+/*
+Encoding of the messages and the signature: len(v)||v..., see appendInts and appendElement
+*/
+func (m *PartiallyBlindCommitment) Bytes() []byte {
+	return appendElement(appendElement(nil, m.A), m.B)
+}
+
+func (m *PartiallyBlindResponse) Bytes() []byte {
+	return appendInts(nil, m.R, m.C, m.S, m.D)
+}
+
+func (s *PartiallyBlindSignature) Bytes() []byte {
+	return appendInts(nil, s.Rho, s.Omega, s.Sigma, s.Delta)
+}
+
+func ParsePartiallyBlindCommitment(b []byte) (*PartiallyBlindCommitment, error) {
+	A, rest, err := splitElement(b)
+	if err != nil {
+		return nil, err
+	}
+	B, rest, err := splitElement(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return &PartiallyBlindCommitment{A, B}, nil
+}
+
+func ParsePartiallyBlindResponse(b []byte) (*PartiallyBlindResponse, error) {
+	ints, err := readInts(b, 4)
+	if err != nil {
+		return nil, err
+	}
+	return &PartiallyBlindResponse{ints[0], ints[1], ints[2], ints[3]}, nil
+}
+
+func ParsePartiallyBlindSignature(b []byte) (*PartiallyBlindSignature, error) {
+	ints, err := readInts(b, 4)
+	if err != nil {
+		return nil, err
+	}
+	return &PartiallyBlindSignature{ints[0], ints[1], ints[2], ints[3]}, nil
+}
+
+/*
+Z = F(info), an element of the group with unknown discrete logarithm
+*/
+func infoElement(info []byte, g Group) Element {
+	return group.HashToElement(g, []byte("schnorr/partially-blind/info"), info)
+}
+
+/*
+e = H(A||B||Z||m) reduced modulo group order
+*/
+func partiallyBlindChallenge(g Group, A, B, z Element, m string) (*big.Int, error) {
+	h := sha256.New()
+	h.Write([]byte("schnorr/partially-blind"))
+	for _, e := range []Element{A, B, z} {
+		b, err := g.Encode(e)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(appendElement(nil, b))
+	}
+	return challenge(h.Sum(nil), m, g.Order()), nil
+}
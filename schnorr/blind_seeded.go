@@ -0,0 +1,86 @@
+//go:build !schnorr_minimal || schnorr_blind
+
+package schnorr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+/*
+Seeded blinding factors
+
+By default the User picks the blinding factors a and b at random, so a client
+which crashes between RequesterChallenge and RequesterFinalize can't finish
+the session, and nobody can later reproduce how a token was blinded.
+NewSeededBlindRequester derives them from a secret seed instead:
+
+	a = OS2IP(HMAC(seed, "a" || ctx || 0) || HMAC(seed, "a" || ctx || 1) || ...) mod q
+	b = the same with "b"
+	ctx = len||session ID || len||Bytes(pk) || len||R || len||m
+
+The same seed, session ID, key, commitment and message always give the same
+challenge, so a restarted client recovers the session by replaying its steps,
+and an auditor holding the seed reproduces the signature from the transcript.
+
+Reuse across sessions is ruled out by the derivation itself: a different
+session ID, signer commitment R or message gives unrelated factors, so two
+signatures never share blinding (which would let the signer link them). The
+seed has to be kept as secret as the unlinkability it protects, anyone who
+knows it links every token blinded with it.
+*/
+
+const minBlindSeedLen = 32
+
+var ErrBlindSeed = errors.New("schnorr: blinding seed shorter than 32 bytes or empty session ID")
+
+/*
+Requester deriving its blinding factors from the seed (at least 32 bytes) and a
+session ID unique for the seed, e.g. a counter or the token serial number
+*/
+func NewSeededBlindRequester(pk *PublicKey, seed []byte, sessionID string) (*BlindRequester, error) {
+	if len(seed) < minBlindSeedLen || sessionID == "" {
+		return nil, ErrBlindSeed
+	}
+	return &BlindRequester{pk: pk, seed: append([]byte(nil), seed...), sessionID: sessionID}, nil
+}
+
+/*
+Blinding factors a, b of the session, random unless the requester is seeded
+*/
+func (u *BlindRequester) blindingFactors(R []byte, m string) (*big.Int, *big.Int, error) {
+	q := u.pk.group.Order()
+	if u.seed == nil {
+		ab, err := randomScalars(q, 2)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ab[0], ab[1], nil
+	}
+
+	ctx := appendBytes(nil, []byte(u.sessionID))
+	ctx = appendBytes(ctx, u.pk.Bytes())
+	ctx = appendBytes(ctx, R)
+	ctx = appendBytes(ctx, []byte(m))
+
+	factor := func(label byte) *big.Int {
+		for counter := uint32(0); ; {
+			var wide []byte
+			for len(wide)*8 < q.BitLen()+128 {
+				mac := hmac.New(sha256.New, u.seed)
+				mac.Write([]byte{label})
+				mac.Write(ctx)
+				mac.Write(binary.BigEndian.AppendUint32(nil, counter))
+				counter++
+				wide = mac.Sum(wide)
+			}
+			if k := new(big.Int).SetBytes(wide); k.Mod(k, q).Sign() != 0 {
+				return k
+			}
+		}
+	}
+	return factor('a'), factor('b'), nil
+}
@@ -0,0 +1,190 @@
+//go:build !schnorr_minimal || schnorr_blind
+
+package schnorr
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/expiry"
+)
+
+/*
+Stateless blind signer
+
+Instead of keeping the per-session nonce r between Step 1 and Step 3 of the
+blind signature process, the signer encrypts it (AES-256-GCM) to itself and
+hands it to the User inside an opaque token, which the User returns together
+with the challenge c:
+
+	Step 1: R, token = Commit()         token = AEAD(tokenKey, r || expiry || id)
+	Step 3: s = Respond(c, token)       s = (r + cx)modq
+
+Answering two different challenges with the same r reveals the private key
+(x = (s1 - s2) / (c1 - c2)), so every token is accepted only once. Only IDs of
+spent tokens have to be remembered, and only until the token expires, which is
+much less than full session storage and can live in a shared cache (SpentTokens).
+*/
+
+var (
+	ErrInvalidBlindToken = errors.New("schnorr: invalid blind session token")
+	ErrBlindTokenExpired = errors.New("schnorr: blind session token expired")
+	ErrBlindTokenSpent   = errors.New("schnorr: blind session token already used")
+)
+
+/*
+Registry of used token IDs, e.g. backed by Redis SETNX with expiry
+*/
+type SpentTokens interface {
+	// Marks token as spent, returns false if it already was
+	MarkSpent(id [16]byte, expires time.Time) bool
+}
+
+type StatelessBlindSigner struct {
+	sk    *SignatureKey
+	pk    *PublicKey
+	aead  cipher.AEAD
+	ttl   time.Duration
+	spent SpentTokens
+	now   func() time.Time
+}
+
+/*
+tokenKey is a 32 byte secret shared by all instances of the signer service.
+spent may be nil, then in-memory registry is used (valid for a single instance only).
+*/
+func NewStatelessBlindSigner(sk *SignatureKey, pk *PublicKey, tokenKey []byte, ttl time.Duration, spent SpentTokens) (*StatelessBlindSigner, error) {
+	block, err := aes.NewCipher(tokenKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if spent == nil {
+		spent = NewMemorySpentTokens()
+	}
+
+	return &StatelessBlindSigner{sk, pk, aead, ttl, spent, Now}, nil
+}
+
+/*
+Step 1 - generate the encoded R = rG and the token carrying encrypted r
+*/
+func (s *StatelessBlindSigner) Commit() ([]byte, []byte, error) {
+	g := s.sk.group
+	r, err := randomScalar(g.Order())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	R, err := g.Encode(g.ScalarBaseMult(r))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var id [16]byte
+	if _, err := io.ReadFull(random(), id[:]); err != nil {
+		return nil, nil, err
+	}
+	plaintext := appendInts(nil, r)
+	plaintext = binary.BigEndian.AppendUint64(plaintext, uint64(s.now().Add(s.ttl).Unix()))
+	plaintext = append(plaintext, id[:]...)
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(random(), nonce); err != nil {
+		return nil, nil, err
+	}
+	token := append([]byte{blindTokenVersion}, nonce...)
+
+	return R, s.aead.Seal(token, nonce, plaintext, []byte(s.pk.KeyID())), nil
+}
+
+/*
+Step 3 - sign blinded challenge c with r recovered from the token
+*/
+func (s *StatelessBlindSigner) Respond(c *big.Int, token []byte) (*big.Int, error) {
+	n := s.aead.NonceSize()
+	if len(token) < 1+n || token[0] != blindTokenVersion {
+		return nil, ErrInvalidBlindToken
+	}
+
+	plaintext, err := s.aead.Open(nil, token[1:1+n], token[1+n:], []byte(s.pk.KeyID()))
+	if err != nil || len(plaintext) < 24 {
+		return nil, ErrInvalidBlindToken
+	}
+
+	tail := plaintext[len(plaintext)-24:]
+	ints, err := readInts(plaintext[:len(plaintext)-24], 1)
+	if err != nil {
+		return nil, ErrInvalidBlindToken
+	}
+	r := ints[0]
+	q := s.sk.group.Order()
+	if !inRange(c, q) || !inRange(r, q) {
+		return nil, ErrInvalidBlindToken
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(tail)), 0)
+	var id [16]byte
+	copy(id[:], tail[8:])
+
+	if s.now().After(expires) {
+		return nil, ErrBlindTokenExpired
+	}
+	// checked before the token is spent, so it can be answered once the key is usable
+	if err := s.sk.checkExpiry(s.now()); err != nil {
+		return nil, err
+	}
+	if s.sk.x.Sign() == 0 {
+		return nil, ErrKeyZeroized
+	}
+	if !s.spent.MarkSpent(id, expires) {
+		return nil, ErrBlindTokenSpent
+	}
+
+	// s = (r + cx)modq
+	sig := new(big.Int).Mul(c, s.sk.x)
+	sig.Add(sig, r)
+	return sig.Mod(sig, q), nil
+}
+
+/*
+In-memory SpentTokens
+*/
+type MemorySpentTokens struct {
+	mu    sync.Mutex
+	spent map[[16]byte]time.Time
+	queue expiry.Queue // spent IDs by expiry
+}
+
+func NewMemorySpentTokens() *MemorySpentTokens {
+	return &MemorySpentTokens{spent: make(map[[16]byte]time.Time)}
+}
+
+func (m *MemorySpentTokens) MarkSpent(id [16]byte, expires time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := Now()
+	m.queue.Expire(now, func(key string) {
+		var spentID [16]byte
+		copy(spentID[:], key)
+		if now.After(m.spent[spentID]) {
+			delete(m.spent, spentID)
+		}
+	})
+
+	if _, ok := m.spent[id]; ok {
+		return false
+	}
+	m.spent[id] = expires
+	m.queue.Push(string(id[:]), expires)
+	return true
+}
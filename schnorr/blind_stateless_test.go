@@ -0,0 +1,69 @@
+//go:build !schnorr_minimal || schnorr_blind
+
+package schnorr
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+/*
+A token presented while the key can't sign isn't spent
+*/
+func TestStatelessBlindSignerKeyState(t *testing.T) {
+	sk, pk, c := expiringKeys(t)
+	signer, err := NewStatelessBlindSigner(sk, pk, bytes.Repeat([]byte{1}, 32), 24*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := signer.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := big.NewInt(5)
+
+	c.Advance(2 * time.Hour)
+	if _, err := signer.Respond(challenge, token); err != ErrKeyExpired {
+		t.Fatalf("Respond with an expired key: %v", err)
+	}
+	sk.OverrideExpiry(true)
+	if _, err := signer.Respond(challenge, token); err != nil {
+		t.Fatalf("Respond with the override: %v", err)
+	}
+	if _, err := signer.Respond(challenge, token); err != ErrBlindTokenSpent {
+		t.Fatalf("second Respond: %v", err)
+	}
+
+	if _, token, err = signer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	sk.Zeroize()
+	if _, err := signer.Respond(challenge, token); err != ErrKeyZeroized {
+		t.Fatalf("Respond with a zeroized key: %v", err)
+	}
+}
+
+func TestBlindSignersEntropyFailure(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateless, err := NewStatelessBlindSigner(sk, pk, bytes.Repeat([]byte{1}, 32), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failEntropy(t)
+
+	if _, err := NewBlindSigner(sk).SignerCommit(); !errors.Is(err, ErrEntropyHealth) {
+		t.Errorf("SignerCommit: %v", err)
+	}
+	if _, err := NewPartiallyBlindSigner(sk, []byte("info")).SignerCommit(); !errors.Is(err, ErrEntropyHealth) {
+		t.Errorf("partially blind SignerCommit: %v", err)
+	}
+	if _, _, err := stateless.Commit(); !errors.Is(err, ErrEntropyHealth) {
+		t.Errorf("stateless Commit: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package schnorr
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+/*
+Pluggable challenge hash with domain separation
+
+The default challenge H(R||m) (see verifier.Challenge) hashes the encoded R
+followed by the message. ChallengeHash is an unambiguous alternative which
+binds the public key too and can use any hash function:
+
+	input = len(tag) || tag || Enc(R) || Enc(X) || len(m) || m [|| keyTag]
+	c     = OS2IP(H(0x00000000 || input) || H(0x00000001 || input) || ...) mod q
+
+with 2 byte len(tag), 8 byte len(m), the fixed length encodings of the group
+and at least bitlen(q) + 128 bits of hash output. keyTag is the tag of keys
+with an environment (see verifier.Tag), absent for other keys. Signatures made with a
+ChallengeHash verify only with the same hash and tag, pass it in SignOptions
+to both SignWithOptions and VerifyWithOptions:
+
+	h, err := schnorr.NewChallengeHash(crypto.SHA512, "myapp/v1")
+	signature, err := schnorr.SignWithOptions(m, sk, &schnorr.SignOptions{Challenge: h})
+	ok := schnorr.VerifyWithOptions(m, signature, pk, &schnorr.SignOptions{Challenge: h})
+*/
+
+const DefaultChallengeTag = "schnorr/challenge"
+
+var ErrChallengeHash = errors.New("schnorr: unavailable or invalid challenge hash function")
+
+type ChallengeHash struct {
+	tag  string
+	hash func([]byte) []byte
+	id   string // fingerprint of the hash function, bound into the nonces
+}
+
+/*
+Options of SignWithOptions and VerifyWithOptions, nil fields select the defaults
+*/
+type SignOptions struct {
+	Challenge *ChallengeHash // nil for the default challenge H(R||m)
+	Aux       []byte         // auxiliary nonce randomness, see SignWithAux
+}
+
+/*
+Challenge hash using the hash function from the standard library, empty tag
+means DefaultChallengeTag
+*/
+func NewChallengeHash(h crypto.Hash, tag string) (*ChallengeHash, error) {
+	if !h.Available() {
+		return nil, ErrChallengeHash
+	}
+	return CustomChallengeHash(func(b []byte) []byte {
+		hash := h.New()
+		hash.Write(b)
+		return hash.Sum(nil)
+	}, tag)
+}
+
+/*
+Challenge hash using a custom hash function, which has to return a non-empty
+digest depending only on its input
+*/
+func CustomChallengeHash(f func([]byte) []byte, tag string) (*ChallengeHash, error) {
+	if f == nil || len(f(nil)) == 0 || len(tag) > 0xffff {
+		return nil, ErrChallengeHash
+	}
+	if tag == "" {
+		tag = DefaultChallengeTag
+	}
+	// hash functions are told apart by their digest of a fixed input, so the
+	// same message signed with two of them under one tag gets two nonces
+	id := sha256.Sum256(f([]byte("schnorr/challenge/hash-id")))
+	return &ChallengeHash{tag, f, string(id[:])}, nil
+}
+
+func (h *ChallengeHash) Tag() string {
+	return h.tag
+}
+
+/*
+Challenge c of the encoded nonce commitment R and public key X for the message
+m in the group of order q
+*/
+func (h *ChallengeHash) Challenge(R, X []byte, m string, q *big.Int) *big.Int {
+	return h.challenge("", R, X, m, q)
+}
+
+/*
+Challenge of a key with the tag keyTag, "" for keys without
+*/
+func (h *ChallengeHash) challenge(keyTag string, R, X []byte, m string, q *big.Int) *big.Int {
+	input := make([]byte, 4, 4+2+len(h.tag)+len(R)+len(X)+8+len(m)+len(keyTag))
+	input = binary.BigEndian.AppendUint16(input, uint16(len(h.tag)))
+	input = append(input, h.tag...)
+	input = append(input, R...)
+	input = append(input, X...)
+	input = binary.BigEndian.AppendUint64(input, uint64(len(m)))
+	input = append(input, m...)
+	input = append(input, keyTag...)
+
+	var wide []byte
+	for i := uint32(0); len(wide)*8 < q.BitLen()+128; i++ {
+		binary.BigEndian.PutUint32(input, i)
+		wide = append(wide, h.hash(input)...)
+	}
+	c := new(big.Int).SetBytes(wide)
+	return c.Mod(c, q)
+}
+
+/*
+Sign with the options, nil options are the same as TrySign
+*/
+func SignWithOptions(m string, sk *SignatureKey, opts *SignOptions) (*Signature, error) {
+	if opts == nil || opts.Challenge == nil {
+		var aux []byte
+		if opts != nil {
+			aux = opts.Aux
+		}
+		return signWithAux(m, sk, aux)
+	}
+	if err := sk.checkExpiry(Now()); err != nil {
+		return nil, err
+	}
+	if sk.x.Sign() == 0 {
+		return nil, ErrKeyZeroized
+	}
+	if err := checkEntropy(); err != nil {
+		return nil, err
+	}
+	g := sk.group
+	q := g.Order()
+	X, err := g.Encode(sk.Public().(*PublicKey).X)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := modp.Get()
+	defer modp.Put(sc)
+	r := &sc.A
+	tag := sk.tag("")
+	sc.Input = appendNonceEncoding(sc.Input[:0], "schnorr/nonce/challenge-hash", m, opts.Challenge.id, opts.Challenge.tag, tag)
+	sc.NonceTo(r, sk.x, opts.Aux, sc.Input, q)
+	defer modp.Wipe(r)
+
+	// s = (r + cx)modq, c = H(tag, R, X, m)
+	R, err := g.Encode(g.ScalarBaseMult(r))
+	if err != nil {
+		return nil, err
+	}
+	c := opts.Challenge.challenge(tag, R, X, m, q)
+	s := new(big.Int)
+	sc.Response(s, r, c, sk.x, q)
+	return &Signature{R, s}, nil
+}
+
+/*
+Verify signature made by SignWithOptions with the same options
+*/
+func VerifyWithOptions(m string, signature *Signature, pk *PublicKey, opts *SignOptions) bool {
+	if opts == nil || opts.Challenge == nil {
+		return VerifySignature(m, signature, pk)
+	}
+	if pk.Validate() != nil || signature == nil {
+		return false
+	}
+	R, err := signature.verifier().Validate(pk.verifier())
+	if err != nil {
+		return false
+	}
+	g := pk.group
+	X, err := g.Encode(pk.X)
+	if err != nil {
+		return false
+	}
+
+	// sG == R + cX
+	c := opts.Challenge.challenge(pk.tag(), signature.R, X, m, g.Order())
+	return g.Equal(g.ScalarBaseMult(signature.s), g.Add(R, g.ScalarMult(pk.X, c)))
+}
@@ -0,0 +1,105 @@
+package schnorr
+
+import (
+	"crypto"
+	_ "crypto/sha512"
+	"math/big"
+	"testing"
+)
+
+func TestChallengeHashOptions(t *testing.T) {
+	for _, id := range []uint16{ParamsSecp256k1, ParamsMODP2048} {
+		sk, pk, err := GenerateKeysWithParamsID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := NewChallengeHash(crypto.SHA512, "test/v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := NewChallengeHash(crypto.SHA512, "test/v2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := &SignOptions{Challenge: h}
+
+		signature, err := SignWithOptions("message", sk, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := SignWithOptions("message", sk, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(again.Bytes()) != string(signature.Bytes()) {
+			t.Error("signatures of the same message differ")
+		}
+		if !VerifyWithOptions("message", signature, pk, opts) {
+			t.Fatalf("%d: signature doesn't verify", id)
+		}
+		if VerifyWithOptions("message", signature, pk, &SignOptions{Challenge: other}) || VerifySignature("message", signature, pk) {
+			t.Error("signature verifies with another challenge")
+		}
+
+		q := pk.group.Order()
+		for name, s := range map[string]*Signature{
+			"nil":           nil,
+			"nil s":         {R: signature.R},
+			"s = q":         {R: signature.R, s: new(big.Int).Set(q)},
+			"s + q":         {R: signature.R, s: new(big.Int).Add(signature.s, q)},
+			"negative s":    {R: signature.R, s: big.NewInt(-1)},
+			"malformed R":   {R: signature.R[1:], s: signature.s},
+			"R at infinity": {R: nil, s: signature.s},
+		} {
+			if VerifyWithOptions("message", s, pk, opts) {
+				t.Errorf("%s signature verifies", name)
+			}
+		}
+		if VerifyWithOptions("message", signature, nil, opts) || VerifyWithOptions("message", signature, &PublicKey{}, opts) {
+			t.Error("signature verifies with an invalid key")
+		}
+
+		sk.Zeroize()
+		if _, err := SignWithOptions("message", sk, opts); err != ErrKeyZeroized {
+			t.Fatalf("SignWithOptions with a zeroized key: %v", err)
+		}
+	}
+}
+
+/*
+The nonce depends on the hash function and the mode: the same message signed
+with SHA-256 and SHA-512 under one tag, or with Sign, never shares R
+*/
+func TestChallengeHashNonces(t *testing.T) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256Hash, err := NewChallengeHash(crypto.SHA256, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha512Hash, err := NewChallengeHash(crypto.SHA512, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := SignWithOptions("message", sk, &SignOptions{Challenge: sha256Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := SignWithOptions("message", sk, &SignOptions{Challenge: sha512Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := TrySign(DefaultChallengeTag+"\x00message", sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first.R) == string(second.R) {
+		t.Error("same nonce with SHA-256 and SHA-512 challenges")
+	}
+	if string(first.R) == string(plain.R) || string(second.R) == string(plain.R) {
+		t.Error("same nonce as a plain signature")
+	}
+}
@@ -0,0 +1,165 @@
+package schnorr
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+Pluggable clock and clock skew policy
+
+Every time-dependent check of the module (key expiry, envelope verification,
+token epochs, replay windows of rpcauth and httpsig, audit log and beacon
+timestamps) reads the time from the process-wide Clock, the system clock
+unless replaced with SetClock. Tests simulate time with a ManualClock,
+deployments can plug in a clock disciplined by NTP or Roughtime and check it
+against a reference with CheckClock.
+
+The FreshnessPolicy set with SetFreshnessPolicy says how far clocks of
+different machines may drift apart: keys are accepted by verifiers until
+MaxSkew after their expiry and timestamps may be MaxSkew older than the
+window of the check. Signing never uses the tolerance, an expired key can't
+sign. The default policy tolerates no skew.
+*/
+
+var (
+	ErrClockSkew = errors.New("schnorr: clock is off by more than the allowed skew")
+	ErrStale     = errors.New("schnorr: timestamp too old")
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+/*
+Clock calling the function, e.g. ClockFunc(time.Now)
+*/
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+/*
+Clock which moves only when told to
+*/
+type ManualClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{t: t}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+/*
+Tolerances of the time-dependent checks
+*/
+type FreshnessPolicy struct {
+	MaxSkew time.Duration // tolerated difference between the clocks of signer and verifier
+}
+
+/*
+Returns true if a key expiring at notAfter is expired at now, more than
+MaxSkew after the expiry. The zero notAfter never expires.
+*/
+func (p FreshnessPolicy) Expired(notAfter, now time.Time) bool {
+	return !notAfter.IsZero() && now.After(notAfter.Add(p.MaxSkew))
+}
+
+/*
+Check a timestamp which has to be at most maxAge old at now (any age for
+maxAge <= 0) and not in the future, both up to MaxSkew
+*/
+func (p FreshnessPolicy) Check(ts, now time.Time, maxAge time.Duration) error {
+	if ts.After(now.Add(p.MaxSkew)) {
+		return fmt.Errorf("%w: timestamp %s is in the future", ErrClockSkew, ts.Format(time.RFC3339))
+	}
+	if maxAge > 0 && now.Sub(ts) > maxAge+p.MaxSkew {
+		return ErrStale
+	}
+	return nil
+}
+
+var clock = struct {
+	sync.RWMutex
+	clock  Clock
+	policy FreshnessPolicy
+}{clock: ClockFunc(time.Now)}
+
+/*
+Replace the clock of the process, nil restores the system clock
+*/
+func SetClock(c Clock) {
+	if c == nil {
+		c = ClockFunc(time.Now)
+	}
+	clock.Lock()
+	defer clock.Unlock()
+	clock.clock = c
+}
+
+/*
+Current time of the process clock. Types with a now function default to
+Now, so they follow later SetClock calls.
+*/
+func Now() time.Time {
+	clock.RLock()
+	c := clock.clock
+	clock.RUnlock()
+	return c.Now()
+}
+
+func SetFreshnessPolicy(p FreshnessPolicy) {
+	clock.Lock()
+	defer clock.Unlock()
+	clock.policy = p
+}
+
+func CurrentFreshnessPolicy() FreshnessPolicy {
+	clock.RLock()
+	defer clock.RUnlock()
+	return clock.policy
+}
+
+/*
+Returns true if the key is expired at the process clock under the freshness policy
+*/
+func (pk *PublicKey) ExpiredNow() bool {
+	return CurrentFreshnessPolicy().Expired(pk.notAfter, Now())
+}
+
+/*
+Compare the process clock with a reference time, e.g. from an NTP query,
+fails if they differ by more than MaxSkew of the policy
+*/
+func CheckClock(reference time.Time) error {
+	offset := Now().Sub(reference)
+	if offset < 0 {
+		offset = -offset
+	}
+	if offset > CurrentFreshnessPolicy().MaxSkew {
+		return fmt.Errorf("%w: offset %s", ErrClockSkew, offset)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+//go:build !schnorr_minimal || schnorr_threshold || schnorr_crossinput || schnorr_frost
+
+package schnorr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+/*
+Distributed nonces for HA signing clusters
+
+The signature key is split among n cluster members (SplitKey, threshold t) and
+any t members can sign together. Every member contributes its own nonce r_i,
+so the full nonce r = sum(r_i) is never known to any single member and a single
+compromised node can't extract the key from the signatures it takes part in:
+
+	Round 1: every member commits to R_i = r_i G with H(R_i)
+	Round 2: after all commitments are received, members reveal R_i
+	Round 3: R = sum(R_i), c = H(R||m),  s_i = (r_i + c * l_i * x_i)modq
+	Combine: s = sum(s_i)modq, the result is an ordinary Signature
+
+l_i is the Lagrange coefficient of the member within the signing set.
+The commit-reveal round prevents a member from choosing its R_i after seeing
+the others. If a member fails during the session, the session is abandoned
+and started again with another signing set.
+*/
+
+var (
+	ErrUnknownSession  = errors.New("schnorr: unknown cluster signing session")
+	ErrSigningSet      = errors.New("schnorr: invalid cluster signing set")
+	ErrNonceCommitment = errors.New("schnorr: revealed nonce doesn't match its commitment")
+)
+
+type NonceCommitment struct {
+	Index      int64
+	Commitment []byte // H(R_i)
+}
+
+type NonceReveal struct {
+	Index int64
+	R     []byte // encoding of R_i
+}
+
+type PartialSignature struct {
+	Index int64
+	s     *big.Int
+}
+
+/*
+Cluster member holding one share of the signature key
+*/
+type ClusterMember struct {
+	share *RecoveryShare
+	pk    *PublicKey
+
+	mu       sync.Mutex
+	sessions map[string]*clusterSession
+}
+
+type clusterSession struct {
+	r           *big.Int
+	R           []byte
+	commitments map[int64][]byte
+}
+
+func NewClusterMember(share *RecoveryShare, pk *PublicKey) *ClusterMember {
+	return &ClusterMember{share: share, pk: pk, sessions: make(map[string]*clusterSession)}
+}
+
+func (m *ClusterMember) Index() int64 {
+	return m.share.Index
+}
+
+/*
+Round 1 - generate nonce share for the session and commit to it
+*/
+func (m *ClusterMember) Commit(sessionID string) (*NonceCommitment, error) {
+	g := m.share.group
+	r, err := randomScalar(g.Order())
+	if err != nil {
+		return nil, err
+	}
+	R, err := g.Encode(g.ScalarBaseMult(r))
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[sessionID] = &clusterSession{r: r, R: R}
+
+	return &NonceCommitment{m.share.Index, nonceCommitment(sessionID, m.share.Index, R)}, nil
+}
+
+/*
+Round 2 - reveal nonce share after receiving commitments of the whole signing set
+*/
+func (m *ClusterMember) Reveal(sessionID string, commitments []*NonceCommitment) (*NonceReveal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, ErrUnknownSession
+	}
+
+	session.commitments = make(map[int64][]byte)
+	for _, c := range commitments {
+		session.commitments[c.Index] = c.Commitment
+	}
+	own, ok := session.commitments[m.share.Index]
+	if len(session.commitments) != len(commitments) || len(commitments) < m.share.Threshold ||
+		!ok || !bytes.Equal(own, nonceCommitment(sessionID, m.share.Index, session.R)) {
+		delete(m.sessions, sessionID)
+		return nil, ErrSigningSet
+	}
+
+	return &NonceReveal{m.share.Index, append([]byte(nil), session.R...)}, nil
+}
+
+/*
+Round 3 - produce partial signature of m. The nonce share is destroyed,
+the session can't be used again.
+*/
+func (m *ClusterMember) SignShare(sessionID string, message string, reveals []*NonceReveal) (*PartialSignature, error) {
+	m.mu.Lock()
+	session, ok := m.sessions[sessionID]
+	delete(m.sessions, sessionID)
+	m.mu.Unlock()
+
+	if !ok || session.commitments == nil {
+		return nil, ErrUnknownSession
+	}
+	if len(reveals) != len(session.commitments) {
+		return nil, ErrSigningSet
+	}
+
+	indexes := make([]int64, 0, len(reveals))
+	for _, reveal := range reveals {
+		commitment, ok := session.commitments[reveal.Index]
+		if !ok || !bytes.Equal(commitment, nonceCommitment(sessionID, reveal.Index, reveal.R)) {
+			return nil, ErrNonceCommitment
+		}
+		indexes = append(indexes, reveal.Index)
+	}
+
+	g := m.share.group
+	q := g.Order()
+	R, err := combineNonces(g, reveals)
+	if err != nil {
+		return nil, err
+	}
+	c := challenge(R, message, q)
+
+	// s_i = (r_i + c * l_i * x_i)modq
+	s := lagrangeAtZero(m.share.Index, indexes, q)
+	s.Mul(s, m.share.y)
+	s.Mul(s, c)
+	s.Add(s, session.r)
+	s.Mod(s, q)
+
+	return &PartialSignature{m.share.Index, s}, nil
+}
+
+/*
+Combine partial signatures of the signing set into the signature of the cluster key
+*/
+func CombineClusterSignature(message string, reveals []*NonceReveal, partials []*PartialSignature, pk *PublicKey) (*Signature, error) {
+	if len(partials) != len(reveals) {
+		return nil, ErrSigningSet
+	}
+
+	if pk.Validate() != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	R, err := combineNonces(pk.group, reveals)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(big.Int)
+	for _, partial := range partials {
+		s.Add(s, partial.s)
+	}
+	s.Mod(s, pk.group.Order())
+
+	signature := &Signature{R: R, s: s}
+	if !VerifySignature(message, signature, pk) {
+		return nil, ErrInvalidPartialSignature
+	}
+	return signature, nil
+}
+
+/*
+Encoded R = sum(R_i)
+*/
+func combineNonces(g Group, reveals []*NonceReveal) ([]byte, error) {
+	nonces := make([][]byte, len(reveals))
+	for i, reveal := range reveals {
+		nonces[i] = reveal.R
+	}
+	return sumNonces(g, nonces)
+}
+
+/*
+Encoded sum of the encoded nonce commitments
+*/
+func sumNonces(g Group, nonces [][]byte) ([]byte, error) {
+	var R Element
+	for _, encoded := range nonces {
+		Ri, err := g.Decode(encoded)
+		if err != nil {
+			return nil, ErrNonceCommitment
+		}
+		if R == nil {
+			R = Ri
+		} else {
+			R = g.Add(R, Ri)
+		}
+	}
+	if R == nil {
+		return nil, ErrSigningSet
+	}
+	encoded, err := g.Encode(R)
+	if err != nil {
+		return nil, ErrInvalidPartialSignature
+	}
+	return encoded, nil
+}
+
+func nonceCommitment(sessionID string, index int64, R []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("schnorr/cluster/nonce"))
+	h.Write(appendBytes(nil, []byte(sessionID)))
+	h.Write(appendInts(nil, big.NewInt(index)))
+	h.Write(appendElement(nil, R))
+	return h.Sum(nil)
+}
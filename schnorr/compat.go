@@ -0,0 +1,49 @@
+package schnorr
+
+/*
+Stable API and deprecations
+
+GenerateKeys, Sign and Verify with the Signature and PublicKey types, their
+Bytes methods and ParseSignature / ParsePublicKey are the stable facade of the
+package: their signatures and behaviour are kept across releases while new
+subsystems are added alongside, so code written against them keeps building
+and its signatures keep verifying.
+
+Other functions may be superseded. A superseded function keeps working for at
+least two releases, is marked with the standard "Deprecated:" paragraph (shown
+by gopls and reported by staticcheck) and is listed by Deprecations together
+with the replacement. `schnorr migrate` rewrites the call sites:
+
+	schnorr migrate ./...       list the call sites and their replacements
+	schnorr migrate -w ./...    rewrite them in place
+*/
+
+/*
+Deprecated identifier of the package and its replacement
+*/
+type Deprecation struct {
+	Name string // deprecated identifier, e.g. "SignWithAux"
+	// Replacement expression, arguments of the deprecated call are written
+	// as _1, _2, ... and exported names of the package are unqualified, e.g.
+	// "SignWithOptions(_1, _2, &SignOptions{Aux: _3})". An identifier without
+	// a call replaces every reference, a call only replaces calls.
+	Replacement string
+}
+
+var deprecations = []Deprecation{
+	{"SignWithAux", "SignWithOptions(_1, _2, &SignOptions{Aux: _3})"},
+}
+
+/*
+Deprecated identifiers of the package, oldest first
+*/
+func Deprecations() []Deprecation {
+	return append([]Deprecation(nil), deprecations...)
+}
+
+/*
+Verify signature of the message, the stable name of VerifySignature
+*/
+func Verify(m string, signature *Signature, pk *PublicKey) bool {
+	return VerifySignature(m, signature, pk)
+}
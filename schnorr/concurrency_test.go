@@ -0,0 +1,118 @@
+package schnorr
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+/*
+Run with -race: goroutines share one key pair, signing and verifying with it
+while another goroutine toggles the expiry override
+*/
+func TestConcurrentSignVerify(t *testing.T) {
+	// few rounds in the slow MODP group
+	for _, params := range []struct {
+		id     uint16
+		rounds int
+	}{{ParamsSecp256k1, 8}, {ParamsMODP2048, 1}} {
+		sk, pk, err := GenerateKeysWithParamsID(params.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shared := Sign("shared message", sk)
+
+		const goroutines = 8
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*goroutines*params.rounds)
+		stop := make(chan struct{})
+		go func() {
+			for allow := true; ; allow = !allow {
+				select {
+				case <-stop:
+					return
+				default:
+					sk.OverrideExpiry(allow)
+				}
+			}
+		}()
+
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				dst := &Signature{}
+				for j := 0; j < params.rounds; j++ {
+					m := fmt.Sprintf("message %d/%d", i, j)
+					signature, err := TrySign(m, sk)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if err := SignTo(dst, m, sk); err != nil {
+						errs <- err
+						return
+					}
+					if !VerifySignature(m, signature, pk) || !VerifySignature(m, dst, pk) {
+						errs <- fmt.Errorf("signature of %q doesn't verify", m)
+					}
+					if !VerifySignature("shared message", shared, pk) || VerifySignature(m, shared, pk) {
+						errs <- fmt.Errorf("shared signature verification")
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(stop)
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestConcurrentSigningService(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewSigningService(sk, SigningServiceOptions{PoolSize: 16, Workers: 2})
+
+	const goroutines, rounds = 8, 8
+	var mu sync.Mutex
+	nonces := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				m := fmt.Sprintf("message %d/%d", i, j)
+				signature, err := service.Sign(m)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !VerifySignature(m, signature, pk) {
+					t.Errorf("signature of %q doesn't verify", m)
+				}
+				mu.Lock()
+				if nonces[string(signature.R)] {
+					t.Errorf("nonce reused for %q", m)
+				}
+				nonces[string(signature.R)] = true
+				mu.Unlock()
+				service.Stats()
+			}
+		}(i)
+	}
+	wg.Wait()
+	service.Close()
+
+	if served := service.Stats().Served; served != goroutines*rounds {
+		t.Errorf("%d signatures served, want %d", served, goroutines*rounds)
+	}
+	if _, err := service.Sign("closed"); err != ErrServiceClosed {
+		t.Errorf("Sign after Close: %v", err)
+	}
+}
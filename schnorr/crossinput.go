@@ -0,0 +1,263 @@
+//go:build !schnorr_minimal || schnorr_crossinput
+
+package schnorr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Cross-input signature aggregation (experimental)
+
+All signers of a block (every input has its own key X_i and message m_i)
+interactively produce a single signature over the whole block
+(Bellare-Neven multi-signature):
+
+	L   = H((X_1, m_1), ..., (X_n, m_n))
+	R   = sum(R_i),  R_i = r_i G
+	c_i = H(L || R || i)
+	s   = sum(s_i),  s_i = (r_i + c_i * x_i)modq
+
+and the block verifier checks
+
+	sG = R + sum(c_i X_i)
+
+Nonces are committed to before they are revealed (see ClusterMember), so no
+signer can choose its R_i depending on the others. All inputs have to use the
+same group.
+*/
+
+var (
+	ErrCrossInputGroup = errors.New("schnorr: cross-input signers use different groups")
+	ErrBlockSignature  = errors.New("schnorr: invalid block signature")
+)
+
+/*
+Single input of the block: signer's key and the signed message
+*/
+type CrossInput struct {
+	PublicKey *PublicKey
+	Message   string
+}
+
+/*
+Aggregate signature of all inputs of the block
+*/
+type CrossInputSignature struct {
+	R []byte // encoding of R
+	s *big.Int
+}
+
+/*
+Signer of one input of the block
+*/
+type CrossInputSigner struct {
+	inputs  []CrossInput
+	index   int
+	sk      *SignatureKey
+	session string
+
+	r           *big.Int
+	R           []byte
+	commitments [][]byte
+}
+
+/*
+Signer of inputs[index]. Every signer gets the same list of inputs.
+*/
+func NewCrossInputSigner(inputs []CrossInput, index int, sk *SignatureKey) (*CrossInputSigner, error) {
+	if err := checkCrossInputs(inputs); err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(inputs) {
+		return nil, ErrSigningSet
+	}
+	return &CrossInputSigner{inputs: inputs, index: index, sk: sk, session: string(inputsHash(inputs))}, nil
+}
+
+/*
+Round 1 - commit to the nonce
+*/
+func (s *CrossInputSigner) Commit() ([]byte, error) {
+	g := s.sk.group
+	r, err := randomScalar(g.Order())
+	if err != nil {
+		return nil, err
+	}
+	R, err := g.Encode(g.ScalarBaseMult(r))
+	if err != nil {
+		return nil, err
+	}
+	s.r, s.R = r, R
+	return nonceCommitment(s.session, int64(s.index), s.R), nil
+}
+
+/*
+Round 2 - reveal the encoded nonce after receiving commitments of all signers, in input order
+*/
+func (s *CrossInputSigner) Reveal(commitments [][]byte) ([]byte, error) {
+	if s.R == nil {
+		return nil, ErrUnknownSession
+	}
+	if len(commitments) != len(s.inputs) ||
+		!bytes.Equal(commitments[s.index], nonceCommitment(s.session, int64(s.index), s.R)) {
+		return nil, ErrSigningSet
+	}
+	s.commitments = commitments
+	return append([]byte(nil), s.R...), nil
+}
+
+/*
+Round 3 - partial signature s_i. The nonce is destroyed, the signer can't be used again.
+*/
+func (s *CrossInputSigner) Sign(nonces [][]byte) (*big.Int, error) {
+	r := s.r
+	s.r, s.R = nil, nil
+	if r == nil || s.commitments == nil {
+		return nil, ErrUnknownSession
+	}
+	if len(nonces) != len(s.inputs) {
+		return nil, ErrSigningSet
+	}
+	for i, R := range nonces {
+		if !bytes.Equal(s.commitments[i], nonceCommitment(s.session, int64(i), R)) {
+			return nil, ErrNonceCommitment
+		}
+	}
+
+	q := s.sk.group.Order()
+	R, err := sumNonces(s.sk.group, nonces)
+	if err != nil {
+		return nil, err
+	}
+	c := crossInputChallenge([]byte(s.session), R, s.index, q)
+
+	// s_i = (r_i + c_i * x_i)modq
+	partial := c.Mul(c, s.sk.x)
+	partial.Add(partial, r)
+	return partial.Mod(partial, q), nil
+}
+
+/*
+Combine revealed nonces and partial signatures of all inputs
+*/
+func CombineCrossInput(inputs []CrossInput, nonces [][]byte, partials []*big.Int) (*CrossInputSignature, error) {
+	if len(nonces) != len(inputs) || len(partials) != len(inputs) {
+		return nil, ErrSigningSet
+	}
+	if err := checkCrossInputs(inputs); err != nil {
+		return nil, err
+	}
+	g := inputs[0].PublicKey.group
+	R, err := sumNonces(g, nonces)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := &CrossInputSignature{R, sumMod(partials, g.Order())}
+	if err := VerifyBlock(inputs, signature); err != nil {
+		return nil, ErrInvalidPartialSignature
+	}
+	return signature, nil
+}
+
+/*
+Block verifier: check the aggregate signature of all inputs
+*/
+func VerifyBlock(inputs []CrossInput, signature *CrossInputSignature) error {
+	if err := checkCrossInputs(inputs); err != nil {
+		return err
+	}
+	g := inputs[0].PublicKey.group
+	q := g.Order()
+	if signature == nil || !inRange(signature.s, q) {
+		return ErrBlockSignature
+	}
+	R, err := g.Decode(signature.R)
+	if err != nil {
+		return ErrBlockSignature
+	}
+
+	// right side: R + sum(c_i X_i)
+	L := inputsHash(inputs)
+	right := R
+	for i, input := range inputs {
+		c := crossInputChallenge(L, signature.R, i, q)
+		right = g.Add(right, g.ScalarMult(input.PublicKey.X, c))
+	}
+
+	// left side: sG
+	if !g.Equal(g.ScalarBaseMult(signature.s), right) {
+		return ErrBlockSignature
+	}
+	return nil
+}
+
+/*
+Encoding: len(R)||R||len(s)||s
+*/
+func (s *CrossInputSignature) Bytes() []byte {
+	return appendInts(appendElement(nil, s.R), s.s)
+}
+
+func ParseCrossInputSignature(b []byte) (*CrossInputSignature, error) {
+	R, rest, err := splitElement(b)
+	if err != nil {
+		return nil, err
+	}
+	ints, err := readInts(rest, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &CrossInputSignature{R, ints[0]}, nil
+}
+
+func checkCrossInputs(inputs []CrossInput) error {
+	if len(inputs) == 0 {
+		return ErrSigningSet
+	}
+	for _, input := range inputs {
+		if input.PublicKey.Validate() != nil {
+			return ErrInvalidPublicKey
+		}
+		if !group.Same(input.PublicKey.group, inputs[0].PublicKey.group) {
+			return ErrCrossInputGroup
+		}
+	}
+	return nil
+}
+
+/*
+L = H((X_1, m_1), ..., (X_n, m_n))
+*/
+func inputsHash(inputs []CrossInput) []byte {
+	h := sha256.New()
+	h.Write([]byte("schnorr/cross-input"))
+	for _, input := range inputs {
+		h.Write(appendBytes(nil, input.PublicKey.Bytes()))
+		h.Write(appendBytes(nil, []byte(input.Message)))
+	}
+	return h.Sum(nil)
+}
+
+/*
+c_i = H(L || R || i) reduced modulo group order
+*/
+func crossInputChallenge(L []byte, R []byte, i int, q *big.Int) *big.Int {
+	m := binary.BigEndian.AppendUint32(append([]byte(nil), L...), uint32(i))
+	return challenge(R, string(m), q)
+}
+
+func sumMod(values []*big.Int, q *big.Int) *big.Int {
+	sum := new(big.Int)
+	for _, v := range values {
+		sum.Add(sum, v)
+	}
+	return sum.Mod(sum, q)
+}
@@ -0,0 +1,10 @@
+//go:build !schnorr_minimal || schnorr_secp256k1 || schnorr_p256
+
+package schnorr
+
+import "github.com/miki799/schnorr-signature/internal/ec"
+
+/*
+Elliptic curve point, the identity has nil coordinates
+*/
+type Point = ec.Point
@@ -0,0 +1,9 @@
+//go:build !schnorr_minimal || schnorr_p256
+
+package schnorr
+
+import "github.com/miki799/schnorr-signature/internal/group"
+
+func P256() Group {
+	return group.P256()
+}
@@ -0,0 +1,9 @@
+//go:build !schnorr_minimal || schnorr_secp256k1
+
+package schnorr
+
+import "github.com/miki799/schnorr-signature/internal/group"
+
+func Secp256k1() Group {
+	return group.Secp256k1()
+}
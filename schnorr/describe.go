@@ -0,0 +1,141 @@
+package schnorr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Human-readable description of serialized artifacts, used for debugging and support
+*/
+
+var ErrUnknownArtifact = errors.New("schnorr: unrecognized artifact")
+
+// Leading byte of the stateless blind session tokens (blind_stateless.go)
+const blindTokenVersion = 1
+
+/*
+Describers of the optional subsystems, registered by their files in init so
+builds without them don't link their parsers. A describer returns nil if b
+isn't its artifact.
+*/
+var describers []func(b []byte) *Description
+
+/*
+Decoded artifact: its kind and ordered list of details
+*/
+type Description struct {
+	Kind   string
+	Fields []Field
+}
+
+type Field struct {
+	Name  string
+	Value string
+}
+
+/*
+Append detail to the description
+*/
+func (d *Description) Add(name string, value interface{}) {
+	d.Fields = append(d.Fields, Field{name, fmt.Sprint(value)})
+}
+
+func (d *Description) String() string {
+	var sb strings.Builder
+	sb.WriteString(d.Kind + "\n")
+	for _, field := range d.Fields {
+		fmt.Fprintf(&sb, "  %-16s %s\n", field.Name+":", field.Value)
+	}
+	return sb.String()
+}
+
+/*
+Decode any artifact of the package (public keys, signatures, aggregate signatures,
+recovery shares, tweak proofs, blind session tokens) and describe it.
+Encodings carry no type tag, so the artifact kind is guessed by strict parsing.
+*/
+func Describe(b []byte) (*Description, error) {
+	if pk, err := ParsePublicKey(b); err == nil {
+		return describePublicKey("public key", pk, bytes.Equal(pk.Bytes(), b)), nil
+	}
+	if pk, err := ParseCompactPublicKey(b); err == nil {
+		compact, _ := pk.CompactBytes()
+		return describePublicKey("compact public key", pk, bytes.Equal(compact, b)), nil
+	}
+	if signature, err := ParseSignature(b); err == nil {
+		d := &Description{Kind: "signature"}
+		d.Add("algorithm", algorithmName)
+		d.Add("R", fmt.Sprintf("%d bytes", len(signature.R)))
+		d.Add("s", fmt.Sprintf("%d bits", signature.s.BitLen()))
+		d.Add("canonical", bytes.Equal(signature.Bytes(), b))
+		return d, nil
+	}
+	for _, describe := range describers {
+		if d := describe(b); d != nil {
+			return d, nil
+		}
+	}
+	if proof, err := ParseTweakProof(b); err == nil {
+		d := &Description{Kind: "tweak proof"}
+		d.Add("master key", proof.Master.KeyID())
+		d.Add("group", groupName(proof.Master.group))
+		d.Add("commitment", fmt.Sprintf("%x", proof.Commitment))
+		d.Add("canonical", bytes.Equal(proof.Bytes(), b))
+		return d, nil
+	}
+	if len(b) > 1 && b[0] == blindTokenVersion {
+		// AES-GCM nonce, encrypted r || expiry || id and the tag
+		d := &Description{Kind: "blind session token (encrypted)"}
+		d.Add("version", b[0])
+		d.Add("size", fmt.Sprintf("%d bytes", len(b)))
+		return d, nil
+	}
+
+	return nil, ErrUnknownArtifact
+}
+
+const algorithmName = "schnorr, prime order group, SHA-256 challenge"
+
+func describePublicKey(kind string, pk *PublicKey, canonical bool) *Description {
+	d := &Description{Kind: kind}
+	d.Add("algorithm", algorithmName)
+	d.Add("group", groupName(pk.group))
+	d.Add("key ID", pk.KeyID())
+	if pk.environment != "" {
+		d.Add("environment", pk.environment)
+	}
+	if pk.notAfter.IsZero() {
+		d.Add("expires", "never")
+	} else {
+		d.Add("expires", pk.notAfter.UTC().Format(time.RFC3339))
+		d.Add("expired", pk.Expired(Now()))
+	}
+	d.Add("valid", pk.Validate() == nil)
+	d.Add("canonical", canonical)
+	return d
+}
+
+func groupName(g Group) string {
+	names := map[uint16]string{
+		ParamsMODP2048:  "MODP2048",
+		ParamsSecp256k1: "secp256k1",
+		ParamsP256:      "P-256",
+	}
+	if group.Same(g, toyParams.Group()) {
+		return "Toy (insecure)"
+	}
+	id, ok := groupID(g)
+	if !ok {
+		return fmt.Sprintf("unregistered, order has %d bits", g.Order().BitLen())
+	}
+	if name, ok := names[id]; ok {
+		return fmt.Sprintf("%s (0x%04x)", name, id)
+	}
+	return fmt.Sprintf("0x%04x, order has %d bits", id, g.Order().BitLen())
+}
@@ -0,0 +1,142 @@
+package schnorr
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Verification diagnostics
+
+VerifySignature answers with a bool only. VerifySignatureDetailed runs the
+same checks and tells which one failed. With SetVerifyDebug(true) the report
+also carries the values of the verification equation s*G == R + c*X and the
+results of checking it against common integration mistakes (message encoded
+differently, challenge sign flipped, signature of another key), so a failing
+integration can be compared with its counterpart value by value:
+
+	schnorr.SetVerifyDebug(true)
+	report := schnorr.VerifySignatureDetailed(m, signature, pk)
+	if !report.Valid {
+		log.Print(report)
+	}
+
+All values in the report are public, the debug flag only controls the cost
+of computing them.
+*/
+
+var ErrEquationMismatch = errors.New("schnorr: verification equation doesn't hold")
+
+var verifyDebug atomic.Bool
+
+/*
+Enable the equation values in the reports of VerifySignatureDetailed
+*/
+func SetVerifyDebug(on bool) {
+	verifyDebug.Store(on)
+}
+
+type VerificationReport struct {
+	Valid     bool  // same result as VerifySignature
+	Err       error // first failed check: ErrInvalidPublicKey, ErrInvalidSignature or ErrEquationMismatch
+	Canonical bool  // R is an encoded group element and s < q, see Signature.Validate
+
+	// debug only, nil otherwise
+	Challenge *big.Int // c = H(R||m)
+	Left      []byte   // encoding of s*G
+	Right     []byte   // encoding of R + c*X
+	Hints     []string // likely causes of a mismatch
+}
+
+/*
+Verify the signature and report the details of the result
+*/
+func VerifySignatureDetailed(message string, signature *Signature, pk *PublicKey) *VerificationReport {
+	report := &VerificationReport{}
+	if err := pk.Validate(); err != nil {
+		report.Err = err
+		return report
+	}
+	if signature == nil || signature.R == nil || signature.s == nil {
+		report.Err = ErrInvalidSignature
+		return report
+	}
+	report.Canonical = signature.Validate(pk) == nil
+	report.Valid = VerifySignature(message, signature, pk)
+
+	switch {
+	case !report.Canonical:
+		report.Err = ErrInvalidSignature
+	case !report.Valid:
+		report.Err = ErrEquationMismatch
+	}
+	if verifyDebug.Load() && report.Canonical {
+		report.debug(message, signature, pk)
+	}
+	return report
+}
+
+func (r *VerificationReport) debug(message string, signature *Signature, pk *PublicKey) {
+	g := pk.group
+	R, err := g.Decode(signature.R)
+	if err != nil {
+		return
+	}
+	left := g.ScalarBaseMult(signature.s)
+	r.Challenge = pk.challenge(signature.R, message)
+	r.Left, _ = g.Encode(left)
+	r.Right, _ = g.Encode(equationRight(g, R, r.Challenge, pk.X))
+	if r.Valid {
+		return
+	}
+
+	// s = r - c*x convention (e.g. RFC 8235): s*G == R - c*X
+	if g.Equal(left, group.Sub(g, R, g.ScalarMult(pk.X, r.Challenge))) {
+		r.Hints = append(r.Hints, "s*G == R - c*X, the signer subtracts the challenge term")
+	}
+	if g.Equal(left, R) {
+		r.Hints = append(r.Hints, "s*G == R, the signer leaves out the challenge term")
+	}
+	trimmed := strings.TrimRight(message, "\r\n")
+	for _, variant := range []struct{ m, hint string }{
+		{trimmed, "valid without the trailing newline of the message"},
+		{trimmed + "\n", "valid with a trailing newline, the signer signed the message with it"},
+		{trimmed + "\r\n", "valid with a trailing CRLF, the signer signed the message with it"},
+	} {
+		if variant.m != message && g.Equal(left, equationRight(g, R, pk.challenge(signature.R, variant.m), pk.X)) {
+			r.Hints = append(r.Hints, variant.hint)
+		}
+	}
+	if len(r.Hints) == 0 {
+		r.Hints = append(r.Hints, "signature of a different message or key, compare the challenge with the signer's")
+	}
+}
+
+/*
+R + c*X
+*/
+func equationRight(g Group, R Element, c *big.Int, X Element) Element {
+	return g.Add(R, g.ScalarMult(X, c))
+}
+
+func (r *VerificationReport) String() string {
+	var b strings.Builder
+	if r.Valid {
+		b.WriteString("signature valid")
+	} else {
+		fmt.Fprintf(&b, "signature invalid: %v", r.Err)
+	}
+	fmt.Fprintf(&b, "\n  canonical: %v", r.Canonical)
+	if r.Challenge != nil {
+		fmt.Fprintf(&b, "\n  c:         %s\n  s*G:       %x\n  R+c*X:     %x", r.Challenge, r.Left, r.Right)
+	}
+	for _, hint := range r.Hints {
+		fmt.Fprintf(&b, "\n  hint:      %s", hint)
+	}
+	return b.String()
+}
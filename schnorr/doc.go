@@ -0,0 +1,76 @@
+/*
+Schnorr signatures, blind signatures and protocols built on them.
+
+# Concurrency
+
+Keys, signatures and other values produced by the package are immutable after
+creation (up to the two key methods below) and can be shared between
+goroutines without synchronization:
+SignatureKey, PublicKey, Signature, AggregateSignature, GroupParams, OPRFKey,
+NonceRule, RecoveryShare, TweakProof, PreSignature and the built-in groups.
+Sign, TrySign, VerifySignature and the other package functions may be called
+concurrently with the same key.
+Two methods change a key after creation. The expiry override
+(OverrideExpiry) is safe to change while other goroutines sign. Zeroize
+overwrites the private key in place and isn't: it ends the key's life and must
+only be called once no other goroutine uses the key.
+
+Exported fields (e.g. PublicKey.X, Signature.R) must not be modified
+by callers, the package never modifies them either.
+
+Stateful types lock internally and are safe for concurrent use:
+NonceBatch, LogSegment, ClusterMember, StatelessBlindSigner, MemorySpentTokens,
+HealthTestedReader, SigningService, as well as the parameter registry,
+SetRandomSource and SetReporter.
+
+Single-party session state (PasswordSession, TwoPartySession, BlindSigner,
+BlindRequester, PartiallyBlindSigner, PartiallyBlindRequester) belongs to one
+protocol run and must not be shared.
+
+The Concurrent tests exercise these guarantees and run with -race in CI.
+
+# Allocations
+
+SignTo (with a reused destination signature) and VerifySignature don't
+allocate in steady state in the built-in groups: temporary values come from a
+pool, the reductions avoid the allocating big.Int division, and the group
+elements are computed in fixed-size field arithmetic and encoded into reused
+buffers (internal/group.Appender). TestAllocations fails on any allocation.
+Keys with an environment or a signing context allocate their tag, and groups
+of other packages take the allocating path of the Group interface.
+
+# Build tags
+
+The default build includes everything. Binaries that need only part of the
+package (e.g. on embedded targets) can build with the schnorr_minimal tag,
+which leaves out the optional backends and subsystems, and add back the ones
+they use with their own tags:
+
+	schnorr_secp256k1   Secp256k1 group (and ImportSecp256k1)
+	schnorr_p256        P256 group
+	schnorr_blind       blind, seeded, stateless and partially blind signatures
+	schnorr_threshold   key splitting, social recovery, escrow, cluster signing,
+	                    threshold decryption and share conversion
+	schnorr_crossinput  cross-input signing sessions (includes schnorr_threshold)
+	schnorr_frost       FROST encodings of threshold key material (includes
+	                    schnorr_threshold)
+	schnorr_aggregate   half-aggregation and aggregated log segments
+	schnorr_noncebatch  precomputed nonce batches
+	schnorr_adaptor     adaptor signatures
+	schnorr_pake        password protected key storage (OPRF, key envelopes)
+	schnorr_handshake   SIGMA handshake and session channels
+	schnorr_timelock    time-locked signatures
+	schnorr_twoparty    two-party signing
+
+For example
+
+	go build -tags schnorr_minimal,schnorr_secp256k1,schnorr_blind
+
+The core scheme in MODP-2048, the Group interface, parameters and encodings
+are always built. Without the curve tags internal/group leaves the curves out
+of its built-in groups and the binary doesn't link the curve arithmetic
+(internal/ec); CI checks this and the size of a minimal program. The tags are
+read by internal/group too, so they apply to every package of the build. The other packages of the module (frost, musig, tokens, ...) are only
+linked into binaries that import them and need the subsystems they use.
+*/
+package schnorr
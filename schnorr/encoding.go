@@ -0,0 +1,224 @@
+package schnorr
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+var ErrInvalidEncoding = errors.New("schnorr: invalid encoding")
+
+/*
+Binary encoding of the signature: len(R)||R||len(s)||s
+where lengths are 2 byte big endian integers and R is encoded by the group.
+*/
+func (S Signature) Bytes() []byte {
+	return appendInts(appendElement(nil, S.R), S.s)
+}
+
+/*
+Parse signature encoded with Signature.Bytes. R is decoded when the signature
+is verified with a key of its group.
+*/
+func ParseSignature(b []byte) (*Signature, error) {
+	signature, err := verifier.ParseSignature(b)
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return &Signature{signature.R, signature.S}, nil
+}
+
+/*
+Same as ParseSignature, but stores the signature into dst, reusing its memory
+*/
+func ParseSignatureTo(dst *Signature, b []byte) error {
+	var fields [2][]byte
+	for i := range fields {
+		if len(b) < 2 {
+			return ErrInvalidEncoding
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+n {
+			return ErrInvalidEncoding
+		}
+		fields[i], b = b[2:2+n], b[2+n:]
+	}
+	if len(b) != 0 {
+		return ErrInvalidEncoding
+	}
+
+	if dst.s == nil {
+		dst.s = new(big.Int)
+	}
+	dst.R = append(dst.R[:0], fields[0]...)
+	dst.s.SetBytes(fields[1])
+	return nil
+}
+
+/*
+Binary encoding of the public key: group||len(X)||X||notAfter[||len(env)||env]
+where group is the 2 byte ID of a built-in group (ParamsMODP2048,
+ParamsSecp256k1, ParamsP256) or 0 followed by len(p)||p||len(g)||g of any
+other mod p group, X is encoded by the group, notAfter is 8 byte big endian
+unix time of the key expiry (0 if the key never expires) and the environment
+tag follows for tagged keys only.
+*/
+func (pk *PublicKey) Bytes() []byte {
+	buf, err := group.AppendGroup(nil, pk.group)
+	if err != nil {
+		return nil
+	}
+	X, err := pk.group.Encode(pk.X)
+	if err != nil {
+		return nil
+	}
+	buf = binary.BigEndian.AppendUint64(appendElement(buf, X), uint64(unixOrZero(pk.notAfter)))
+	return appendEnvironment(buf, pk.environment)
+}
+
+/*
+Parse public key encoded with PublicKey.Bytes
+*/
+func ParsePublicKey(b []byte) (*PublicKey, error) {
+	pk, err := verifier.ParsePublicKey(b)
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return &PublicKey{group: pk.Group, X: pk.X, notAfter: pk.NotAfter, environment: pk.Environment}, nil
+}
+
+func (S *Signature) verifier() *verifier.Signature {
+	if S == nil {
+		return nil
+	}
+	return &verifier.Signature{R: S.R, S: S.s}
+}
+
+func (pk *PublicKey) verifier() *verifier.PublicKey {
+	if pk == nil {
+		return nil
+	}
+	return &verifier.PublicKey{Group: pk.group, X: pk.X, NotAfter: pk.notAfter, Environment: pk.environment, Context: pk.context}
+}
+
+/*
+Short identifier of the public key: hex encoded first 8 bytes of H(Bytes)
+*/
+func (pk *PublicKey) KeyID() string {
+	sum := sha256.Sum256(pk.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
+
+func appendInts(buf []byte, ints ...*big.Int) []byte {
+	for _, n := range ints {
+		b := n.Bytes()
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(b)))
+		buf = append(buf, b...)
+	}
+	return buf
+}
+
+/*
+len(e)||e with a 2 byte length, for encoded group elements
+*/
+func appendElement(buf, e []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(e)))
+	return append(buf, e...)
+}
+
+/*
+Read and decode an element written by appendElement, returns the remaining bytes
+*/
+func readElement(g Group, b []byte) (Element, []byte, error) {
+	encoded, rest, err := splitElement(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	e, err := g.Decode(encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e, rest, nil
+}
+
+/*
+Read an encoded element written by appendElement without decoding it
+*/
+func splitElement(b []byte) ([]byte, []byte, error) {
+	if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+		return nil, nil, ErrInvalidEncoding
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	return append([]byte(nil), b[2:2+n]...), b[2+n:], nil
+}
+
+func readInts(b []byte, count int) ([]*big.Int, error) {
+	ints, rest, err := splitInts(b, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return ints, nil
+}
+
+/*
+Read count integers from the beginning of b, returns the remaining bytes
+*/
+func splitInts(b []byte, count int) ([]*big.Int, []byte, error) {
+	ints := make([]*big.Int, 0, count)
+	for i := 0; i < count; i++ {
+		if len(b) < 2 {
+			return nil, nil, ErrInvalidEncoding
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) < n {
+			return nil, nil, ErrInvalidEncoding
+		}
+		ints = append(ints, new(big.Int).SetBytes(b[:n]))
+		b = b[n:]
+	}
+	return ints, b, nil
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+	return append(buf, b...)
+}
+
+/*
+Read count byte strings encoded with appendBytes, b has to contain nothing else
+*/
+func readBytes(b []byte, count int) ([][]byte, error) {
+	fields := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if len(b) < 4 {
+			return nil, ErrInvalidEncoding
+		}
+		n := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if uint64(len(b)) < uint64(n) {
+			return nil, ErrInvalidEncoding
+		}
+		fields = append(fields, append([]byte(nil), b[:n]...))
+		b = b[n:]
+	}
+	if len(b) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return fields, nil
+}
+
+/*
+0 <= v < q
+*/
+func inRange(v, q *big.Int) bool {
+	return v != nil && v.Sign() >= 0 && v.Cmp(q) < 0
+}
@@ -0,0 +1,85 @@
+package schnorr
+
+import (
+	"io"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/entropy"
+)
+
+/*
+Entropy source and its health tests
+
+All randomness used by the package (keys, nonces, blinding factors, salts)
+is read from the source of package entropy, crypto/rand.Reader by default,
+which the other packages of the module share. On machines with questionable
+entropy the source can be wrapped in HealthTestedReader, which runs
+continuous health tests from NIST SP 800-90B (section 4.4) on every output
+byte:
+
+  - repetition count test - detects a source stuck on a single value,
+  - adaptive proportion test - detects a single value becoming too frequent.
+
+After the first failure the reader stays failed and every read returns
+ErrEntropyHealth, so no key or nonce is ever generated from a bad source:
+functions drawing randomness return the error (GenerateKeys panics with it).
+Sign doesn't read the source, its nonces are derived from the key and the
+message, but it refuses to sign with ErrEntropyHealth too while the source
+is failed (see entropy.Health): a machine whose entropy is broken isn't fit
+to sign.
+*/
+
+var ErrEntropyHealth = entropy.ErrHealth
+
+/*
+Reader running continuous health tests on the wrapped source, see package entropy
+*/
+type HealthTestedReader = entropy.HealthTestedReader
+
+/*
+Wrap the source and run the startup tests on it
+*/
+func NewHealthTestedReader(src io.Reader) (*HealthTestedReader, error) {
+	return entropy.NewHealthTestedReader(src)
+}
+
+/*
+Set the source of randomness used by the package and the rest of the module,
+see entropy.SetSource
+*/
+func SetRandomSource(r io.Reader) {
+	entropy.SetSource(r)
+}
+
+func random() io.Reader {
+	return entropy.Reader
+}
+
+/*
+ErrEntropyHealth (wrapped) while the health tested source is failed, checked
+by the signing functions which don't read the source
+*/
+func checkEntropy() error {
+	return entropy.Health()
+}
+
+/*
+Random number from [1, n), the error of the random source if it fails
+*/
+func randomScalar(n *big.Int) (*big.Int, error) {
+	return entropy.Scalar(n)
+}
+
+/*
+Random scalars from [1, n), the error of the random source if it fails
+*/
+func randomScalars(n *big.Int, count int) ([]*big.Int, error) {
+	scalars := make([]*big.Int, count)
+	for i := range scalars {
+		var err error
+		if scalars[i], err = randomScalar(n); err != nil {
+			return nil, err
+		}
+	}
+	return scalars, nil
+}
@@ -0,0 +1,138 @@
+package schnorr
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+/*
+Environment separation of keys
+
+A key can carry an environment tag ("prod", "staging", ...) as metadata, like
+its expiry. The tag is part of the key encodings and is bound into the
+challenge hash of every signature made or checked with the key (see
+verifier.Tag), so a signature by the staging key never verifies against the
+production public key, even if both were created from the same key material:
+
+	sk, pk, err := schnorr.TagEnvironment(sk, "staging")
+
+Keys without a tag sign and verify as before.
+
+The signing context is bound the same way: signatures of stream digests
+(SignReader, SignDigest) and of crypto.Signer digests are made in their own
+contexts and never verify as signatures of plain messages. Protocols which
+sign a message in a context, e.g. blind signing of a file, use the public key
+view returned by WithContext.
+*/
+
+var (
+	ErrInvalidEnvironment = verifier.ErrInvalidEnvironment
+	ErrInvalidContext     = verifier.ErrInvalidContext
+)
+
+/*
+Context of the signatures of SignReader and SignDigest, the message is the
+SHA-256 digest of the content
+*/
+const StreamContext = verifier.StreamContext
+
+/*
+Copy of the key pair of sk tagged with the environment, "" removes the tag.
+Tags are 1 to 64 characters out of a-z, 0-9, '.', '_' and '-'.
+*/
+func TagEnvironment(sk *SignatureKey, environment string) (*SignatureKey, *PublicKey, error) {
+	if environment != "" && verifier.ValidateEnvironment(environment) != nil {
+		return nil, nil, ErrInvalidEnvironment
+	}
+	tagged := &SignatureKey{group: sk.group, x: new(big.Int).Set(sk.x), pub: sk.pub, notAfter: sk.notAfter, environment: environment}
+	pk, err := tagged.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	return tagged, pk, nil
+}
+
+/*
+Environment tag of the key, "" if the key has none
+*/
+func (sk *SignatureKey) Environment() string {
+	return sk.environment
+}
+
+/*
+Environment tag of the key, "" if the key has none
+*/
+func (pk *PublicKey) Environment() string {
+	return pk.environment
+}
+
+/*
+Copy of the public key whose signatures are made in the signing context,
+"" is the context of plain messages. Protocols computing the challenge with
+the key (blind signing, Challenge, VerifySignature, ...) then sign and verify
+in the context: a blind signature requested with
+pk.WithContext(StreamContext) for the message string(digest[:]) verifies with
+VerifyDigest. The context isn't part of the key encodings. Contexts are at
+most 255 bytes, longer contexts make every signature invalid.
+*/
+func (pk *PublicKey) WithContext(context string) *PublicKey {
+	if pk == nil {
+		return nil
+	}
+	return &PublicKey{group: pk.group, X: pk.X, notAfter: pk.notAfter, environment: pk.environment, context: context}
+}
+
+/*
+Signing context of the key, see WithContext
+*/
+func (pk *PublicKey) Context() string {
+	return pk.context
+}
+
+/*
+Tag bound into the challenge of the key's signatures in the context
+*/
+func (sk *SignatureKey) tag(context string) string {
+	return verifier.Tag(sk.environment, context)
+}
+
+func (pk *PublicKey) tag() string {
+	return verifier.Tag(pk.environment, pk.context)
+}
+
+/*
+Append the input of the deterministic nonce for m in the tag (see
+appendNonceEncoding) to dst. The domain and the length of the tag are always
+present, so the inputs of different tags never collide, "" included: m signed
+without tag never shares its nonce with a suffix of m signed under a tag.
+*/
+func appendNonceInput(dst []byte, tag, m string) []byte {
+	return appendNonceEncoding(dst, "schnorr/nonce", m, tag)
+}
+
+/*
+Unambiguous nonce input len(domain)||domain||len(f_1)||f_1||...||m with 2 byte
+lengths, every signing mode derives its nonces in its own domain
+*/
+func appendNonceEncoding(dst []byte, domain, m string, fields ...string) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(domain)))
+	dst = append(dst, domain...)
+	for _, f := range fields {
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(f)))
+		dst = append(dst, f...)
+	}
+	return append(dst, m...)
+}
+
+/*
+Optional trailing environment field of the binary key encodings
+*/
+func appendEnvironment(buf []byte, environment string) []byte {
+	if environment == "" {
+		return buf
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(environment)))
+	return append(buf, environment...)
+}
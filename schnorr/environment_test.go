@@ -0,0 +1,107 @@
+package schnorr
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"testing"
+)
+
+/*
+Environment and context are part of the challenge hash: a signature made
+under one tag never verifies under another, for the same key material
+*/
+func TestChallengeTags(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staging, stagingPK, err := TagEnvironment(sk, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, prodPK, err := TagEnvironment(sk, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := TrySign("deploy", staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature("deploy", signature, stagingPK) || VerifySignature("deploy", signature, prodPK) || VerifySignature("deploy", signature, pk) {
+		t.Error("environment signature verification")
+	}
+
+	digest := sha256.Sum256([]byte("content"))
+	m := string(digest[:])
+	signature, err = SignDigest(digest, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := TrySign(m, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(signature.R) == string(plain.R) {
+		t.Error("same nonce for the message in two contexts")
+	}
+	switch {
+	case !VerifyDigest(digest, signature, pk), !VerifySignature(m, signature, pk.WithContext(StreamContext)):
+		t.Error("digest signature doesn't verify")
+	case VerifySignature(m, signature, pk), VerifyDigest(digest, plain, pk), VerifyDigest(digest, signature, stagingPK):
+		t.Error("digest signature verifies outside of its context")
+	}
+	if Challenge(signature.R, m, pk.WithContext(StreamContext)).Cmp(Challenge(signature.R, m, pk)) == 0 {
+		t.Error("context doesn't change the challenge")
+	}
+
+	// crypto.Signer: SHA-256 without tag is the stream context
+	signed, err := sk.Sign(nil, digest[:], &SignerOpts{Hash: crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err := ParseSignature(signed); err != nil || !VerifyDigest(digest, parsed, pk) {
+		t.Error("crypto.Signer signature of a SHA-256 digest doesn't verify with VerifyDigest")
+	}
+	tagged, err := sk.Sign(nil, digest[:], &SignerOpts{Hash: crypto.SHA256, Tag: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySigned(pk, digest[:], tagged, &SignerOpts{Hash: crypto.SHA256, Tag: "app"}) ||
+		VerifySigned(pk, digest[:], tagged, &SignerOpts{Hash: crypto.SHA256}) ||
+		VerifySigned(pk, digest[:], tagged, &SignerOpts{Hash: crypto.SHA256, Tag: "other"}) {
+		t.Error("tagged crypto.Signer signature verification")
+	}
+	if _, err := sk.Sign(nil, digest[:], &SignerOpts{Hash: crypto.SHA256, Tag: string(make([]byte, 256))}); err != ErrInvalidContext {
+		t.Errorf("tag over the context length: %v", err)
+	}
+}
+
+/*
+An untagged message equal to the nonce input of a tagged one doesn't get its
+nonce: otherwise two challenges with the same nonce give away the key
+*/
+func TestNonceDomainSeparation(t *testing.T) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("content"))
+	tag := sk.tag(StreamContext)
+	colliding := string([]byte{byte(len(tag) >> 8), byte(len(tag))}) + tag + string(digest[:])
+
+	tagged, err := SignDigest(digest, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untagged, err := TrySign(colliding, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tagged.R) == string(untagged.R) {
+		t.Error("same nonce for the tagged digest and its untagged encoding")
+	}
+	if string(appendNonceInput(nil, "", colliding)) == string(appendNonceInput(nil, tag, string(digest[:]))) {
+		t.Error("nonce inputs collide")
+	}
+}
@@ -0,0 +1,476 @@
+//go:build !schnorr_minimal || schnorr_threshold || schnorr_crossinput || schnorr_frost
+
+package schnorr
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+/*
+Verifiable encrypted escrow of key shares
+
+SplitKeyVerifiable publishes Feldman commitments A_j = a_j G to the
+coefficients of the sharing polynomial, so the public share of every index
+can be computed as C_i = sum(i^j A_j) and checked against y_i G.
+
+A shareholder backs its share up to an escrow key Y = x_e G. The discrete
+logarithm of y_i G can't be computed, so every bit b_k of y_i is encrypted
+separately with ElGamal "in the exponent":
+
+	encrypt:  U_k = r_k G,  V_k = b_k G + r_k Y
+	proofs:   (U_k, V_k) encrypts 0 or 1             (Chaum-Pedersen OR proof)
+	          log_G(U) == log_Y(V - C_i)              U = sum(2^k U_k), V = sum(2^k V_k)
+
+so the ciphertexts hold exactly the committed share. All proofs share one
+Fiat-Shamir challenge c and are sent in compact form (challenges and
+responses, the verifier recomputes the commitments). Auditors verify the
+proofs with the commitments and the escrow public key only. The escrow
+decrypts b_k G = V_k - x_e U_k, which is either the identity or G.
+
+The backup holds two group elements and four scalars per bit of the group
+order: about 50 KB on the curves, about 2 MB and a few thousand
+exponentiations to create and to audit in the 2048-bit mod p groups.
+*/
+
+var (
+	ErrEscrowProof      = errors.New("schnorr: escrowed share doesn't match the commitments")
+	ErrShareCommitment  = errors.New("schnorr: share doesn't match the commitments")
+	ErrEscrowMismatched = errors.New("schnorr: escrow key, share and commitments use different groups")
+)
+
+/*
+Feldman commitments A_j = a_j G to the sharing polynomial, A_0 is the public key
+*/
+type ShareCommitments struct {
+	OwnerKeyID   string
+	Coefficients []Element
+	group        Group
+}
+
+type EscrowedShare struct {
+	OwnerKeyID string
+	Threshold  int
+	Index      int64
+	U, V       [][]byte   // encoded ElGamal ciphertexts of the bits of y_i
+	C0, C1     []*big.Int // challenges of the OR proofs, C0[k] + C1[k] = C
+	Z0, Z1     []*big.Int // responses of the OR proofs
+	C          *big.Int   // common challenge
+	Z          *big.Int   // response of the proof for the sums
+}
+
+/*
+SplitKey which also returns commitments to the sharing polynomial
+*/
+func SplitKeyVerifiable(sk *SignatureKey, pk *PublicKey, t, n int) ([]*RecoveryShare, *ShareCommitments, error) {
+	shares, coefficients, err := splitKey(sk, pk, t, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	commitments := &ShareCommitments{OwnerKeyID: pk.KeyID(), group: sk.group}
+	for _, a := range coefficients {
+		commitments.Coefficients = append(commitments.Coefficients, sk.group.ScalarBaseMult(a))
+	}
+	return shares, commitments, nil
+}
+
+/*
+C_i = sum(i^j A_j)
+*/
+func (c *ShareCommitments) PublicShare(index int64) Element {
+	g := c.group
+	i, power := big.NewInt(index), big.NewInt(1)
+	var C Element
+	for _, A := range c.Coefficients {
+		term := g.ScalarMult(A, power)
+		if C == nil {
+			C = term
+		} else {
+			C = g.Add(C, term)
+		}
+		power.Mul(power, i).Mod(power, g.Order())
+	}
+	return C
+}
+
+/*
+Check that the share lies on the committed polynomial
+*/
+func (c *ShareCommitments) Verify(share *RecoveryShare) error {
+	if share.OwnerKeyID != c.OwnerKeyID || !group.Same(share.group, c.group) {
+		return ErrEscrowMismatched
+	}
+	if len(c.Coefficients) == 0 || !c.group.Equal(c.group.ScalarBaseMult(share.y), c.PublicShare(share.Index)) {
+		return ErrShareCommitment
+	}
+	return nil
+}
+
+/*
+Encoding: len(keyID)||keyID||count||group||len(A_0)||A_0||..., nil if an
+element or the group can't be encoded
+*/
+func (c *ShareCommitments) Bytes() []byte {
+	buf := appendBytes(nil, []byte(c.OwnerKeyID))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(c.Coefficients)))
+	buf, err := group.AppendGroup(buf, c.group)
+	if err != nil {
+		return nil
+	}
+	for _, A := range c.Coefficients {
+		encoded, err := c.group.Encode(A)
+		if err != nil {
+			return nil
+		}
+		buf = appendElement(buf, encoded)
+	}
+	return buf
+}
+
+func ParseShareCommitments(b []byte) (*ShareCommitments, error) {
+	fields, rest, err := readPrefix(b)
+	if err != nil || len(rest) < 4 {
+		return nil, ErrInvalidEncoding
+	}
+	count := int(binary.BigEndian.Uint32(rest))
+	if count < 1 || count > len(rest)/2 {
+		return nil, ErrInvalidEncoding
+	}
+	g, rest, err := group.ReadGroup(rest[4:])
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	commitments := &ShareCommitments{OwnerKeyID: string(fields), group: g}
+	for i := 0; i < count; i++ {
+		var A Element
+		if A, rest, err = readElement(g, rest); err != nil {
+			return nil, ErrInvalidEncoding
+		}
+		commitments.Coefficients = append(commitments.Coefficients, A)
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return commitments, nil
+}
+
+/*
+Encrypt the share to the escrow key with the proof of consistency with the commitments
+*/
+func EscrowShare(share *RecoveryShare, commitments *ShareCommitments, escrow *PublicKey) (*EscrowedShare, error) {
+	if err := commitments.Verify(share); err != nil {
+		return nil, err
+	}
+	if escrow.Validate() != nil || !group.Same(escrow.group, share.group) {
+		return nil, ErrEscrowMismatched
+	}
+	g, Y := share.group, escrow.X
+	q := g.Order()
+	bits := q.BitLen()
+
+	e := &EscrowedShare{
+		OwnerKeyID: share.OwnerKeyID,
+		Threshold:  share.Threshold,
+		Index:      share.Index,
+	}
+	U, V := make([]Element, bits), make([]Element, bits)
+	nonces := make([]*big.Int, bits)
+	rk := make([]*big.Int, bits)
+	r := new(big.Int)
+	var T []Element
+	for k := 0; k < bits; k++ {
+		// U_k = r_k G, V_k = b_k G + r_k Y
+		b := share.y.Bit(k)
+		draws, err := randomScalars(q, 4)
+		if err != nil {
+			return nil, err
+		}
+		rk[k] = draws[0]
+		U[k], V[k] = g.ScalarBaseMult(rk[k]), g.ScalarMult(Y, rk[k])
+		if b == 1 {
+			V[k] = g.Add(V[k], g.ScalarBaseMult(big.NewInt(1)))
+		}
+		r.Add(r, new(big.Int).Lsh(rk[k], uint(k)))
+
+		// branch 1 - b is simulated with a random challenge and response,
+		// branch b is committed to with a nonce
+		c, z := [2]*big.Int{new(big.Int), new(big.Int)}, [2]*big.Int{new(big.Int), new(big.Int)}
+		c[1-b], z[1-b] = draws[1], draws[2]
+		nonces[k] = draws[3]
+		var branches [2][2]Element
+		branches[1-b][0], branches[1-b][1] = escrowBranch(g, Y, U[k], V[k], 1-b, c[1-b], z[1-b])
+		branches[b][0], branches[b][1] = g.ScalarBaseMult(nonces[k]), g.ScalarMult(Y, nonces[k])
+		T = append(T, branches[0][0], branches[0][1], branches[1][0], branches[1][1])
+		e.C0, e.C1 = append(e.C0, c[0]), append(e.C1, c[1])
+		e.Z0, e.Z1 = append(e.Z0, z[0]), append(e.Z1, z[1])
+	}
+	r.Mod(r, q)
+
+	// proof for the sums: T1 = k G, T2 = k Y
+	k, err := randomScalar(q)
+	if err != nil {
+		return nil, err
+	}
+	T = append(T, g.ScalarBaseMult(k), g.ScalarMult(Y, k))
+
+	for i := range U {
+		Ui, err := g.Encode(U[i])
+		if err != nil {
+			return nil, err
+		}
+		Vi, err := g.Encode(V[i])
+		if err != nil {
+			return nil, err
+		}
+		e.U, e.V = append(e.U, Ui), append(e.V, Vi)
+	}
+	c, err := e.challenge(commitments, escrow, T)
+	if err != nil {
+		return nil, err
+	}
+	e.C = c
+
+	// c_b = c - c_(1-b), z_b = nonce + c_b r_k for the real branches, z = k + c r for the sums
+	for i := 0; i < bits; i++ {
+		cs, zs := [2]*big.Int{e.C0[i], e.C1[i]}, [2]*big.Int{e.Z0[i], e.Z1[i]}
+		b := share.y.Bit(i)
+		cs[b].Sub(c, cs[1-b]).Mod(cs[b], q)
+		zs[b].Mul(cs[b], rk[i]).Add(zs[b], nonces[i]).Mod(zs[b], q)
+	}
+	e.Z = new(big.Int).Mul(c, r)
+	e.Z.Add(e.Z, k).Mod(e.Z, q)
+	return e, nil
+}
+
+/*
+Audit the backup without decrypting it: the OR proof of every bit and the
+proof for the sums, see the package documentation of the escrow above
+*/
+func (e *EscrowedShare) Verify(commitments *ShareCommitments, escrow *PublicKey) error {
+	g := commitments.group
+	if e.OwnerKeyID != commitments.OwnerKeyID || escrow.Validate() != nil || !group.Same(escrow.group, g) {
+		return ErrEscrowMismatched
+	}
+	if e.Threshold != len(commitments.Coefficients) || e.Index <= 0 {
+		return ErrEscrowProof
+	}
+	q := g.Order()
+	bits := q.BitLen()
+	if len(e.U) != bits || len(e.V) != bits || len(e.C0) != bits || len(e.C1) != bits ||
+		len(e.Z0) != bits || len(e.Z1) != bits {
+		return ErrEscrowProof
+	}
+	for _, v := range append(append(append(append([]*big.Int{e.C, e.Z}, e.C0...), e.C1...), e.Z0...), e.Z1...) {
+		if v == nil || v.Sign() < 0 || v.Cmp(q) >= 0 {
+			return ErrEscrowProof
+		}
+	}
+
+	Y := escrow.X
+	Us, Vs, err := e.decode(g)
+	if err != nil {
+		return ErrEscrowProof
+	}
+	U, V := escrowSums(g, Us, Vs)
+	var T []Element
+	for k := 0; k < bits; k++ {
+		sum := new(big.Int).Add(e.C0[k], e.C1[k])
+		if sum.Mod(sum, q).Cmp(e.C) != 0 {
+			return ErrEscrowProof
+		}
+		T0, T1 := escrowBranch(g, Y, Us[k], Vs[k], 0, e.C0[k], e.Z0[k])
+		T2, T3 := escrowBranch(g, Y, Us[k], Vs[k], 1, e.C1[k], e.Z1[k])
+		T = append(T, T0, T1, T2, T3)
+	}
+
+	// T1 = z G - c U, T2 = z Y - c (V - C_i)
+	minusC := new(big.Int).Sub(q, e.C)
+	masked := group.Sub(g, V, commitments.PublicShare(e.Index))
+	T = append(T,
+		g.Add(g.ScalarBaseMult(e.Z), g.ScalarMult(U, minusC)),
+		g.Add(g.ScalarMult(Y, e.Z), g.ScalarMult(masked, minusC)))
+
+	c, err := e.challenge(commitments, escrow, T)
+	if err != nil || c.Cmp(e.C) != 0 {
+		return ErrEscrowProof
+	}
+	return nil
+}
+
+/*
+Escrow side - decrypt the bits b_k G = V_k - x_e U_k of the backup and check
+the recovered share against the commitments
+*/
+func RecoverEscrowedShare(e *EscrowedShare, commitments *ShareCommitments, escrow *SignatureKey) (*RecoveryShare, error) {
+	g := escrow.group
+	if !group.Same(g, commitments.group) || len(e.U) != len(e.V) {
+		return nil, ErrEscrowMismatched
+	}
+	if escrow.x.Sign() == 0 {
+		return nil, ErrKeyZeroized
+	}
+	zero, one := g.ScalarBaseMult(new(big.Int)), g.ScalarBaseMult(big.NewInt(1))
+	minusX := new(big.Int).Sub(g.Order(), escrow.x)
+	defer modp.Wipe(minusX)
+
+	y := new(big.Int)
+	for k := range e.U {
+		U, err := g.Decode(e.U[k])
+		if err != nil {
+			return nil, ErrEscrowProof
+		}
+		V, err := g.Decode(e.V[k])
+		if err != nil {
+			return nil, ErrEscrowProof
+		}
+		switch bit := g.Add(V, g.ScalarMult(U, minusX)); {
+		case g.Equal(bit, one):
+			y.SetBit(y, k, 1)
+		case !g.Equal(bit, zero):
+			return nil, ErrEscrowProof
+		}
+	}
+
+	share := &RecoveryShare{e.OwnerKeyID, e.Threshold, e.Index, y.Mod(y, g.Order()), g}
+	if err := commitments.Verify(share); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+/*
+Commitments of a branch of the OR proof recomputed from its challenge and
+response: z G - c U and z Y - c (V - b G)
+*/
+func escrowBranch(g Group, Y, U, V Element, b uint, c, z *big.Int) (Element, Element) {
+	minusC := new(big.Int).Sub(g.Order(), c)
+	if b == 1 {
+		V = group.Sub(g, V, g.ScalarBaseMult(big.NewInt(1)))
+	}
+	return g.Add(g.ScalarBaseMult(z), g.ScalarMult(U, minusC)), g.Add(g.ScalarMult(Y, z), g.ScalarMult(V, minusC))
+}
+
+/*
+Ciphertexts U_k and V_k of the bits, decoded
+*/
+func (e *EscrowedShare) decode(g Group) ([]Element, []Element, error) {
+	Us, Vs := make([]Element, len(e.U)), make([]Element, len(e.V))
+	for k := range e.U {
+		var err error
+		if Us[k], err = g.Decode(e.U[k]); err != nil {
+			return nil, nil, err
+		}
+		if Vs[k], err = g.Decode(e.V[k]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return Us, Vs, nil
+}
+
+/*
+U = sum(2^k U_k) and V = sum(2^k V_k) of the decoded ciphertexts
+*/
+func escrowSums(g Group, Us, Vs []Element) (Element, Element) {
+	two := big.NewInt(2)
+	U, V := Us[len(Us)-1], Vs[len(Vs)-1]
+	for k := len(Us) - 2; k >= 0; k-- {
+		// Horner: U = 2 U + U_k
+		U, V = g.Add(g.ScalarMult(U, two), Us[k]), g.Add(g.ScalarMult(V, two), Vs[k])
+	}
+	return U, V
+}
+
+/*
+c = H(Y || C_i || keyID || index || U_k, V_k... || T...) mod q
+*/
+func (e *EscrowedShare) challenge(commitments *ShareCommitments, escrow *PublicKey, T []Element) (*big.Int, error) {
+	g := commitments.group
+	h := sha256.New()
+	h.Write([]byte("schnorr/escrow/bits"))
+	h.Write(appendBytes(nil, []byte(e.OwnerKeyID)))
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(e.Index)))
+	for _, X := range append([]Element{escrow.X, commitments.PublicShare(e.Index)}, T...) {
+		encoded, err := g.Encode(X)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(appendElement(nil, encoded))
+	}
+	for k := range e.U {
+		h.Write(appendElement(nil, e.U[k]))
+		h.Write(appendElement(nil, e.V[k]))
+	}
+	return wideScalar(h.Sum(nil), g.Order()), nil
+}
+
+/*
+Encoding: len(keyID)||keyID||threshold||index||bits||(len(U_k)||U_k||len(V_k)||V_k)...||
+len(C0_k)||C0_k||...||C1...||Z0...||Z1...||len(C)||C||len(Z)||Z
+*/
+func (e *EscrowedShare) Bytes() []byte {
+	buf := appendBytes(nil, []byte(e.OwnerKeyID))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(e.Threshold))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.Index))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(e.U)))
+	for k := range e.U {
+		buf = appendElement(appendElement(buf, e.U[k]), e.V[k])
+	}
+	for _, scalars := range [][]*big.Int{e.C0, e.C1, e.Z0, e.Z1} {
+		buf = appendInts(buf, scalars...)
+	}
+	return appendInts(buf, e.C, e.Z)
+}
+
+func ParseEscrowedShare(b []byte) (*EscrowedShare, error) {
+	keyID, rest, err := readPrefix(b)
+	if err != nil || len(rest) < 16 {
+		return nil, ErrInvalidEncoding
+	}
+	e := &EscrowedShare{
+		OwnerKeyID: string(keyID),
+		Threshold:  int(binary.BigEndian.Uint32(rest)),
+		Index:      int64(binary.BigEndian.Uint64(rest[4:])),
+	}
+	bits := int(binary.BigEndian.Uint32(rest[12:]))
+	rest = rest[16:]
+	// every bit takes at least 2 * 2 bytes of lengths and 4 * 2 bytes of scalars
+	if bits > len(rest)/12 {
+		return nil, ErrInvalidEncoding
+	}
+	for k := 0; k < bits; k++ {
+		var U, V []byte
+		if U, rest, err = splitElement(rest); err != nil {
+			return nil, err
+		}
+		if V, rest, err = splitElement(rest); err != nil {
+			return nil, err
+		}
+		e.U, e.V = append(e.U, U), append(e.V, V)
+	}
+	ints, err := readInts(rest, 4*bits+2)
+	if err != nil {
+		return nil, err
+	}
+	e.C0, e.C1, e.Z0, e.Z1 = ints[:bits], ints[bits:2*bits], ints[2*bits:3*bits], ints[3*bits:4*bits]
+	e.C, e.Z = ints[4*bits], ints[4*bits+1]
+	return e, nil
+}
+
+/*
+Split a field encoded with appendBytes from the rest of b
+*/
+func readPrefix(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, ErrInvalidEncoding
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, ErrInvalidEncoding
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
@@ -0,0 +1,40 @@
+//go:build !schnorr_minimal || schnorr_threshold || schnorr_crossinput || schnorr_frost
+
+package schnorr
+
+import "testing"
+
+func TestEscrowedShare(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	escrowSK, escrowPK, err := GenerateKeysWithParamsID(ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, commitments, err := SplitKeyVerifiable(sk, pk, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := EscrowShare(shares[0], commitments, escrowPK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Verify(commitments, escrowPK); err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	recovered, err := RecoverEscrowedShare(e, commitments, escrowSK)
+	if err != nil || recovered.y.Cmp(shares[0].y) != 0 {
+		t.Fatalf("recovery: %v", err)
+	}
+
+	// a ciphertext which isn't a point fails both, and doesn't panic
+	e.U[3] = make([]byte, len(e.U[3]))
+	if err := e.Verify(commitments, escrowPK); err != ErrEscrowProof {
+		t.Errorf("audit of a malformed ciphertext: %v", err)
+	}
+	if _, err := RecoverEscrowedShare(e, commitments, escrowSK); err != ErrEscrowProof {
+		t.Errorf("recovery of a malformed ciphertext: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build !schnorr_minimal || schnorr_blind
+
+package schnorr_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Blind signature with the signer and the user exchanging serialized messages
+*/
+func Example_blindSignature() {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signer := schnorr.NewBlindSigner(sk)
+	user := schnorr.NewBlindRequester(pk)
+
+	// signer -> user
+	commitment, err := signer.SignerCommit()
+	if err != nil {
+		log.Fatal(err)
+	}
+	commitment, err = schnorr.ParseBlindCommitment(commitment.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// user -> signer, the message never leaves the user
+	challenge, err := user.RequesterChallenge(commitment, "vote: yes")
+	if err != nil {
+		log.Fatal(err)
+	}
+	challenge, err = schnorr.ParseBlindChallenge(challenge.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// signer -> user
+	response, err := signer.SignerRespond(challenge)
+	if err != nil {
+		log.Fatal(err)
+	}
+	response, err = schnorr.ParseBlindResponse(response.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signature, err := user.RequesterFinalize(response)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("valid:", schnorr.VerifySignature("vote: yes", signature, pk))
+	fmt.Println("signer's commitment reused in signature:", bytes.Equal(signature.R, commitment.R))
+
+	// a session answers only once
+	_, err = signer.SignerRespond(challenge)
+	fmt.Println("second response:", err)
+	// Output:
+	// valid: true
+	// signer's commitment reused in signature: false
+	// second response: schnorr: blind signing step called out of order
+}
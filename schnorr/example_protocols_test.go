@@ -0,0 +1,98 @@
+//go:build !schnorr_minimal
+
+package schnorr_test
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/frost"
+	"github.com/miki799/schnorr-signature/musig"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Three co-signers produce one MuSig2 signature on secp256k1
+*/
+func Example_muSig() {
+	keys := make([]*schnorr.SignatureKey, 3)
+	pubs := make([]*schnorr.PublicKey, len(keys))
+	for i := range keys {
+		var err error
+		if keys[i], pubs[i], err = schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1); err != nil {
+			log.Fatal(err)
+		}
+	}
+	agg, err := musig.AggregateKeys(pubs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// round 1: every co-signer publishes its nonces
+	m := "pay 1 coin to bob"
+	sessions := make([]*musig.Session, len(keys))
+	nonces := make([]*musig.PublicNonce, len(keys))
+	for i, key := range keys {
+		if sessions[i], err = musig.NewSession(agg, key, m); err != nil {
+			log.Fatal(err)
+		}
+		nonces[i] = sessions[i].Nonce
+	}
+
+	// round 2: partial signatures, combined by anyone
+	partials := make([]*big.Int, len(keys))
+	for i, session := range sessions {
+		if partials[i], err = session.PartialSign(nonces); err != nil {
+			log.Fatal(err)
+		}
+	}
+	signature, err := agg.CombinePartials(m, nonces, partials)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("valid under the aggregated key:", schnorr.VerifySignature(m, signature, agg.Public))
+	// Output:
+	// valid under the aggregated key: true
+}
+
+/*
+2-of-3 threshold signature with FROST on secp256k1
+*/
+func Example_threshold() {
+	cs := frost.Secp256k1SHA256
+	packages, groupKey, commitment, err := cs.TrustedDealerKeygen(nil, 3, 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, kp := range packages {
+		if !cs.VerifyKeyPackage(kp, commitment) {
+			log.Fatal("key package doesn't match the dealer's commitment")
+		}
+	}
+
+	// participants 1 and 3 sign
+	signers := []*frost.KeyPackage{packages[0], packages[2]}
+	msg := []byte("release the funds")
+
+	nonces := make([]*frost.Nonces, len(signers))
+	commitments := make([]*frost.Commitment, len(signers))
+	for i, kp := range signers {
+		if nonces[i], commitments[i], err = cs.Commit(kp); err != nil {
+			log.Fatal(err)
+		}
+	}
+	shares := make([]*big.Int, len(signers))
+	for i, kp := range signers {
+		if shares[i], err = cs.Sign(kp, nonces[i], msg, commitments); err != nil {
+			log.Fatal(err)
+		}
+	}
+	signature, err := cs.Aggregate(commitments, msg, shares, groupKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("valid under the group key:", cs.Verify(msg, signature, groupKey))
+	// Output:
+	// valid under the group key: true
+}
@@ -0,0 +1,28 @@
+package schnorr_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Key generation, signing and verification. Uses the insecure toy group so the
+output is the same on every run.
+*/
+func ExampleSign() {
+	sk, pk := schnorr.GenerateToyKeys(1)
+
+	signature, err := schnorr.TrySign("hello", sk)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("signature:", signature)
+	fmt.Println("valid:", schnorr.VerifySignature("hello", signature, pk))
+	fmt.Println("valid for another message:", schnorr.VerifySignature("hello!", signature, pk))
+	// Output:
+	// signature: (R=1ac0e31d8ef1795c, s=136899635492951555)
+	// valid: true
+	// valid for another message: false
+}
@@ -0,0 +1,81 @@
+package schnorr
+
+import (
+	"errors"
+	"time"
+
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+var ErrKeyExpired = errors.New("schnorr: key has expired")
+
+/*
+Generate keys valid until notAfter. Expiry is carried by both keys
+and is part of the public key encoding. Signing keys refuse to sign after the
+expiry (see OverrideExpiry), VerifySignature doesn't check it, verifiers
+enforce it with VerifySignatureAt or FastVerifier.
+Panics if the random source fails, see TryGenerateKeysWithExpiry.
+*/
+func GenerateKeysWithExpiry(notAfter time.Time) (*SignatureKey, *PublicKey) {
+	sk, pk, err := TryGenerateKeysWithExpiry(notAfter)
+	if err != nil {
+		panic(err)
+	}
+	return sk, pk
+}
+
+/*
+Same as GenerateKeysWithExpiry, but returns error instead of panicking
+*/
+func TryGenerateKeysWithExpiry(notAfter time.Time) (*SignatureKey, *PublicKey, error) {
+	sk, pk, err := TryGenerateKeys()
+	if err != nil {
+		return nil, nil, err
+	}
+	sk.notAfter = notAfter
+	pk.notAfter = notAfter
+	return sk, pk, nil
+}
+
+/*
+Key expiry, zero time if the key never expires
+*/
+func (sk *SignatureKey) NotAfter() time.Time {
+	return sk.notAfter
+}
+
+/*
+Allow (or forbid again) signing with the key after its expiry
+*/
+func (sk *SignatureKey) OverrideExpiry(allow bool) {
+	sk.allowExpired.Store(allow)
+}
+
+/*
+Key expiry, zero time if the key never expires
+*/
+func (pk *PublicKey) NotAfter() time.Time {
+	return pk.notAfter
+}
+
+/*
+Returns true if the key is expired at the given time
+*/
+func (pk *PublicKey) Expired(at time.Time) bool {
+	return !pk.notAfter.IsZero() && at.After(pk.notAfter)
+}
+
+/*
+VerifySignature which additionally rejects signatures checked (or claimed
+to be created) after the key expiry
+*/
+func VerifySignatureAt(message string, signature *Signature, publicKey *PublicKey, at time.Time) bool {
+	return verifier.VerifyAt(message, signature.verifier(), publicKey.verifier(), at)
+}
+
+func (sk *SignatureKey) checkExpiry(now time.Time) error {
+	if sk.allowExpired.Load() || sk.notAfter.IsZero() || !now.After(sk.notAfter) {
+		return nil
+	}
+	return ErrKeyExpired
+}
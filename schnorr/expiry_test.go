@@ -0,0 +1,98 @@
+package schnorr
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+Key of secp256k1 expiring in an hour, on a manual clock which is restored
+when the test ends
+*/
+func expiringKeys(t *testing.T) (*SignatureKey, *PublicKey, *ManualClock) {
+	t.Helper()
+	start := time.Unix(1700000000, 0)
+	c := NewManualClock(start)
+	SetClock(c)
+	t.Cleanup(func() { SetClock(nil) })
+
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk.notAfter = start.Add(time.Hour)
+	pk.notAfter = sk.notAfter
+	return sk, pk, c
+}
+
+func TestExpiredKeyRefusesToSign(t *testing.T) {
+	sk, pk, c := expiringKeys(t)
+	signature := Sign("message", sk)
+
+	c.Advance(2 * time.Hour)
+	if _, err := TrySign("message", sk); err != ErrKeyExpired {
+		t.Fatalf("TrySign with an expired key: %v", err)
+	}
+	if _, err := SignWithOptions("message", sk, &SignOptions{Aux: []byte("aux")}); err != ErrKeyExpired {
+		t.Fatalf("SignWithOptions with an expired key: %v", err)
+	}
+	rule, err := NewNonceRule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignVerifiableNonce("message", sk, rule); err != ErrKeyExpired {
+		t.Fatalf("SignVerifiableNonce with an expired key: %v", err)
+	}
+	if VerifySignatureAt("message", signature, pk, Now()) {
+		t.Fatal("signature accepted after the key expiry")
+	}
+
+	sk.OverrideExpiry(true)
+	if _, err := TrySign("message", sk); err != nil {
+		t.Fatalf("TrySign with the override: %v", err)
+	}
+	if _, err := SignVerifiableNonce("message", sk, rule); err != nil {
+		t.Fatalf("SignVerifiableNonce with the override: %v", err)
+	}
+}
+
+/*
+VerifySignature ignores the expiry, VerifySignatureAt and FastVerifier
+enforce it, also on a key parsed from its encoding
+*/
+func TestGenerateKeysWithExpiry(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	c := NewManualClock(start)
+	SetClock(c)
+	t.Cleanup(func() { SetClock(nil) })
+
+	sk, pk, err := TryGenerateKeysWithExpiry(start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sk.NotAfter().Equal(start.Add(time.Hour)) || !pk.NotAfter().Equal(sk.NotAfter()) {
+		t.Fatalf("expiry %v, %v", sk.NotAfter(), pk.NotAfter())
+	}
+	parsed, err := ParsePublicKey(pk.Bytes())
+	if err != nil || !parsed.NotAfter().Equal(pk.NotAfter()) {
+		t.Fatalf("parsed expiry: %v", err)
+	}
+	signature := Sign("message", sk)
+	fast, err := NewFastVerifier(parsed, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Advance(2 * time.Hour)
+	if !VerifySignature("message", signature, parsed) {
+		t.Error("VerifySignature checked the expiry")
+	}
+	if VerifySignatureAt("message", signature, parsed, Now()) || fast.Verify("message", signature) {
+		t.Error("signature accepted after the key expiry")
+	}
+
+	failEntropy(t)
+	if _, _, err := TryGenerateKeysWithExpiry(start); err == nil {
+		t.Error("keys generated without randomness")
+	}
+}
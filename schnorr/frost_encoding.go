@@ -0,0 +1,167 @@
+//go:build !schnorr_minimal || schnorr_frost
+
+package schnorr
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+FROST (RFC 9591) style encodings of threshold key material
+
+Scalars and group elements are serialized as in the RFC: scalars as fixed
+width big-endian integers of Ns = ceil(bitlen(q)/8) bytes, elements in the
+fixed width encoding of the group (Ne bytes, compressed points on the curves),
+participant identifiers are serialized as scalars. The ciphersuite (group and
+hash) isn't part of the encoding, it has to be agreed on out of band, so
+parsing takes the public key of the group.
+
+	signing share:     identifier || sk_i
+	verifying share:   identifier || PK_i,  PK_i = g^sk_i
+	commitment list:   identifier_1 || R_1 || identifier_2 || R_2 || ...  (sorted by identifier)
+
+The encodings interoperate only with participants using the same group and
+challenge hash, not with the ciphersuites of the RFC (the challenge of this
+package differs, see verifier.Challenge).
+*/
+
+var ErrFROSTEncoding = errors.New("schnorr: invalid FROST encoding")
+
+/*
+SerializeScalar from RFC 9591 section 4 for the group
+*/
+func frostSerializeScalar(buf []byte, n *big.Int, g Group) []byte {
+	return append(buf, new(big.Int).Mod(n, g.Order()).FillBytes(make([]byte, group.ScalarLen(g)))...)
+}
+
+/*
+Fixed width Ne of the element encoding of the group
+*/
+func frostElementLen(g Group) int {
+	encoded, _ := g.Encode(g.ScalarBaseMult(big.NewInt(1)))
+	return len(encoded)
+}
+
+/*
+Read identifier || element pairs, identifiers have to be canonical (< q) and
+non-zero, elements valid encodings other than the identity
+*/
+func frostDeserializePairs(b []byte, g Group) ([]int64, [][]byte, error) {
+	ns, ne := group.ScalarLen(g), frostElementLen(g)
+	if len(b) == 0 || len(b)%(ns+ne) != 0 {
+		return nil, nil, ErrFROSTEncoding
+	}
+	var indexes []int64
+	var elements [][]byte
+	for ; len(b) > 0; b = b[ns+ne:] {
+		id := new(big.Int).SetBytes(b[:ns])
+		if id.Sign() == 0 || id.Cmp(g.Order()) >= 0 || !id.IsInt64() {
+			return nil, nil, ErrFROSTEncoding
+		}
+		encoded := append([]byte(nil), b[ns:ns+ne]...)
+		if _, err := g.Decode(encoded); err != nil {
+			return nil, nil, ErrFROSTEncoding
+		}
+		indexes, elements = append(indexes, id.Int64()), append(elements, encoded)
+	}
+	return indexes, elements, nil
+}
+
+/*
+Signing share in the RFC encoding: identifier || sk_i
+*/
+func (s *RecoveryShare) FROSTSigningShare() []byte {
+	return frostSerializeScalar(frostSerializeScalar(nil, big.NewInt(s.Index), s.group), s.y, s.group)
+}
+
+/*
+Verifying share in the RFC encoding: identifier || PK_i, nil if PK_i is the identity
+*/
+func (s *RecoveryShare) FROSTVerifyingShare() []byte {
+	Y, err := s.group.Encode(s.group.ScalarBaseMult(s.y))
+	if err != nil {
+		return nil
+	}
+	return append(frostSerializeScalar(nil, big.NewInt(s.Index), s.group), Y...)
+}
+
+/*
+Parse signing share of the key pk split with the given threshold
+*/
+func ParseFROSTSigningShare(b []byte, pk *PublicKey, threshold int) (*RecoveryShare, error) {
+	g := pk.group
+	ns := group.ScalarLen(g)
+	if len(b) != 2*ns {
+		return nil, ErrFROSTEncoding
+	}
+	id, y := new(big.Int).SetBytes(b[:ns]), new(big.Int).SetBytes(b[ns:])
+	if id.Sign() == 0 || id.Cmp(g.Order()) >= 0 || !id.IsInt64() || y.Cmp(g.Order()) >= 0 {
+		return nil, ErrFROSTEncoding
+	}
+	return &RecoveryShare{pk.KeyID(), threshold, id.Int64(), y, g}, nil
+}
+
+/*
+Parse verifying share, returns the identifier and PK_i
+*/
+func ParseFROSTVerifyingShare(b []byte, pk *PublicKey) (int64, Element, error) {
+	indexes, elements, err := frostDeserializePairs(b, pk.group)
+	if err != nil || len(indexes) != 1 {
+		return 0, nil, ErrFROSTEncoding
+	}
+	Y, err := pk.group.Decode(elements[0])
+	if err != nil {
+		return 0, nil, ErrFROSTEncoding
+	}
+	return indexes[0], Y, nil
+}
+
+/*
+Group verifying key in the RFC encoding: SerializeElement(X)
+*/
+func (pk *PublicKey) FROSTVerifyingKey() []byte {
+	X, _ := pk.group.Encode(pk.X)
+	return X
+}
+
+/*
+Commitment list (encode_group_commitment_list) of revealed nonces, sorted by identifier.
+The cluster protocol uses a single nonce per participant, so there is no binding nonce.
+*/
+func EncodeFROSTCommitments(reveals []*NonceReveal, pk *PublicKey) ([]byte, error) {
+	sorted := append([]*NonceReveal(nil), reveals...)
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j-1].Index > sorted[j].Index; j-- {
+			sorted[j-1], sorted[j] = sorted[j], sorted[j-1]
+		}
+	}
+
+	ne := frostElementLen(pk.group)
+	var buf []byte
+	for i, reveal := range sorted {
+		if reveal.Index <= 0 || (i > 0 && sorted[i-1].Index == reveal.Index) || len(reveal.R) != ne {
+			return nil, ErrSigningSet
+		}
+		buf = append(frostSerializeScalar(buf, big.NewInt(reveal.Index), pk.group), reveal.R...)
+	}
+	return buf, nil
+}
+
+func ParseFROSTCommitments(b []byte, pk *PublicKey) ([]*NonceReveal, error) {
+	indexes, elements, err := frostDeserializePairs(b, pk.group)
+	if err != nil {
+		return nil, err
+	}
+
+	reveals := make([]*NonceReveal, 0, len(indexes))
+	for i, index := range indexes {
+		if len(reveals) > 0 && reveals[len(reveals)-1].Index >= index {
+			return nil, ErrFROSTEncoding
+		}
+		reveals = append(reveals, &NonceReveal{index, elements[i]})
+	}
+	return reveals, nil
+}
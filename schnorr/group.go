@@ -0,0 +1,55 @@
+package schnorr
+
+import (
+	"errors"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Pluggable prime order groups
+
+SignatureKey and PublicKey work in a prime order group, the Group interface
+abstracts it. The built-in groups are the elliptic curves Secp256k1 and P256
+and the subgroup of order q of the integers modulo a safe prime p = 2q + 1
+(GroupParams, e.g. ParamsMODP2048). Groups are written additively, in the mod
+p groups Add is multiplication and ScalarMult exponentiation modulo p.
+
+Keys of any group sign and verify with the same functions:
+
+	sk, pk, err := schnorr.GenerateKeysInGroup(schnorr.Secp256k1())
+	signature, err := schnorr.TrySign(message, sk)
+	ok := schnorr.VerifySignature(message, signature, pk)
+
+Keys and signatures of different groups never verify against each other.
+Scalar multiplication (exponentiation in the mod p groups) is constant time
+with respect to the scalar, see internal/ec and internal/modp.
+*/
+
+var (
+	ErrGroupMismatch = errors.New("schnorr: key and signature belong to different groups")
+	ErrInvalidGroup  = group.ErrInvalidElement
+)
+
+/*
+Element of a Group, the concrete type is chosen by the group (*Point for the
+curves, *big.Int for the mod p groups)
+*/
+type Element = group.Element
+
+/*
+Prime order group. Decode rejects the identity and everything Encode doesn't
+produce, Encode fails for the identity.
+*/
+type Group = group.Group
+
+/*
+Generate keys in the group, which has to be registered or pass
+GroupParams.Validate (see NewSignatureKey)
+*/
+func GenerateKeysInGroup(g Group) (*SignatureKey, *PublicKey, error) {
+	if err := checkGroup(g); err != nil {
+		return nil, nil, err
+	}
+	return generateKeys(g)
+}
@@ -0,0 +1,320 @@
+//go:build !schnorr_minimal || schnorr_handshake
+
+package schnorr
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+/*
+SIGMA mutual authentication handshake
+
+Two parties holding Schnorr keys agree on session keys over an untrusted channel:
+
+	initiator -> responder:  g^x
+	responder -> initiator:  g^y, pk_R, Sign_R("responder", g^x, g^y), MAC_km("responder", pk_R)
+	initiator -> responder:  pk_I, Sign_I("initiator", g^y, g^x), MAC_km("initiator", pk_I)
+
+Signatures bind the identities to the ephemeral exchange, MACs under the key
+derived from g^xy confirm that both sides computed the same secret. Identities
+are sent in the clear (basic SIGMA, not SIGMA-I), a party which has to hide its
+identity should use an already encrypted channel.
+
+The ephemeral Diffie-Hellman always runs in the prime order subgroup of the
+2048-bit MODP group used by the OPRF (RFC 3526, group 14), whatever group the
+identity keys were generated in.
+
+The handshake authenticates keys, not names: after it completes the caller has
+to check that Session.Peer is a key it trusts.
+
+	initiator: h := NewInitiator(sk, pk); msg1, _ := h.Start()
+	responder: h := NewResponder(sk, pk); msg2, _ := h.Respond(msg1)
+	initiator: msg3, session, _ := h.Finish(msg2)
+	responder: session, _ := h.Complete(msg3)
+*/
+
+var (
+	ErrHandshake        = errors.New("schnorr: handshake authentication failed")
+	ErrHandshakeState   = errors.New("schnorr: handshake message out of order")
+	ErrSessionMessage   = errors.New("schnorr: can't open session message")
+	ErrSessionExhausted = errors.New("schnorr: session sequence numbers exhausted")
+)
+
+type Handshake struct {
+	sk        *SignatureKey
+	pk        *PublicKey
+	initiator bool
+
+	x      *big.Int // own ephemeral secret, nil after the handshake
+	gx, gy *big.Int // initiator's and responder's ephemeral values
+	keys   *sessionKeys
+	done   bool
+}
+
+/*
+Established channel between the parties
+*/
+type Session struct {
+	Peer *PublicKey // authenticated key of the other party
+	ID   []byte     // same on both sides, can be used for channel binding
+
+	send, receive  cipher.AEAD
+	sent, received uint64 // sequence numbers used as nonces
+}
+
+type sessionKeys struct {
+	mac, initiator, responder, id []byte
+}
+
+func NewInitiator(sk *SignatureKey, pk *PublicKey) *Handshake {
+	return &Handshake{sk: sk, pk: pk, initiator: true}
+}
+
+func NewResponder(sk *SignatureKey, pk *PublicKey) *Handshake {
+	return &Handshake{sk: sk, pk: pk}
+}
+
+/*
+Initiator: first message, the ephemeral value g^x
+*/
+func (h *Handshake) Start() ([]byte, error) {
+	if !h.initiator || h.x != nil || h.done {
+		return nil, ErrHandshakeState
+	}
+	x, err := randomScalar(oprfQ)
+	if err != nil {
+		return nil, err
+	}
+	h.x = x
+	h.gx = new(big.Int).Exp(big.NewInt(2), h.x, oprfP)
+	return appendInts(nil, h.gx), nil
+}
+
+/*
+Responder: process the first message and authenticate to the initiator
+*/
+func (h *Handshake) Respond(msg []byte) ([]byte, error) {
+	if h.initiator || h.x != nil || h.done {
+		return nil, ErrHandshakeState
+	}
+	ints, err := readInts(msg, 1)
+	if err != nil {
+		return nil, err
+	}
+	if !inOPRFGroup(ints[0]) {
+		return nil, ErrInvalidOPRFElement
+	}
+	h.gx = ints[0]
+
+	if h.x, err = randomScalar(oprfQ); err != nil {
+		return nil, err
+	}
+	h.gy = new(big.Int).Exp(big.NewInt(2), h.x, oprfP)
+	h.keys = deriveSessionKeys(new(big.Int).Exp(h.gx, h.x, oprfP), h.gx, h.gy)
+
+	signature, mac, err := h.authenticate("responder", h.gx, h.gy)
+	if err != nil {
+		return nil, err
+	}
+	msg = appendBytes(nil, appendInts(nil, h.gy))
+	msg = appendBytes(msg, h.pk.Bytes())
+	return appendBytes(msg, append(signature.Bytes(), mac...)), nil
+}
+
+/*
+Initiator: check the responder and authenticate to it. The session is ready
+to use, but the responder accepts it only after receiving the returned message.
+*/
+func (h *Handshake) Finish(msg []byte) ([]byte, *Session, error) {
+	if !h.initiator || h.x == nil || h.done {
+		return nil, nil, ErrHandshakeState
+	}
+	fields, err := readBytes(msg, 3)
+	if err != nil {
+		return nil, nil, err
+	}
+	ints, err := readInts(fields[0], 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !inOPRFGroup(ints[0]) {
+		return nil, nil, ErrInvalidOPRFElement
+	}
+	h.gy = ints[0]
+	h.keys = deriveSessionKeys(new(big.Int).Exp(h.gy, h.x, oprfP), h.gx, h.gy)
+
+	peer, err := h.check("responder", h.gx, h.gy, fields[1], fields[2])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signature, mac, err := h.authenticate("initiator", h.gy, h.gx)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := h.session(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return appendBytes(appendBytes(nil, h.pk.Bytes()), append(signature.Bytes(), mac...)), session, nil
+}
+
+/*
+Responder: check the initiator, the handshake is complete
+*/
+func (h *Handshake) Complete(msg []byte) (*Session, error) {
+	if h.initiator || h.keys == nil || h.done {
+		return nil, ErrHandshakeState
+	}
+	fields, err := readBytes(msg, 2)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := h.check("initiator", h.gy, h.gx, fields[0], fields[1])
+	if err != nil {
+		return nil, err
+	}
+	return h.session(peer)
+}
+
+/*
+Signature over the ephemeral values and MAC of the own identity
+*/
+func (h *Handshake) authenticate(role string, first, second *big.Int) (*Signature, []byte, error) {
+	signature, err := TrySign(handshakeTranscript(role, first, second), h.sk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signature, handshakeMAC(h.keys.mac, role, h.pk.Bytes()), nil
+}
+
+/*
+Verify the peer's signature and MAC, returns the peer's key
+*/
+func (h *Handshake) check(role string, first, second *big.Int, rawKey, rawAuth []byte) (*PublicKey, error) {
+	peer, err := ParsePublicKey(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rawAuth) < sha256.Size {
+		return nil, ErrHandshake
+	}
+	rawSignature, mac := rawAuth[:len(rawAuth)-sha256.Size], rawAuth[len(rawAuth)-sha256.Size:]
+
+	signature, err := ParseSignature(rawSignature)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	if !VerifySignature(handshakeTranscript(role, first, second), signature, peer) {
+		return nil, ErrHandshake
+	}
+	if !hmac.Equal(mac, handshakeMAC(h.keys.mac, role, rawKey)) {
+		return nil, ErrHandshake
+	}
+	return peer, nil
+}
+
+/*
+Finish the handshake, the ephemeral secret is dropped
+*/
+func (h *Handshake) session(peer *PublicKey) (*Session, error) {
+	h.x, h.done = nil, true
+
+	send, receive := h.keys.initiator, h.keys.responder
+	if !h.initiator {
+		send, receive = receive, send
+	}
+	session := &Session{Peer: peer, ID: h.keys.id}
+
+	var err error
+	if session.send, err = newSessionCipher(send); err != nil {
+		return nil, err
+	}
+	if session.receive, err = newSessionCipher(receive); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+/*
+Encrypt message for the peer. Messages have to be opened in the order they were sealed.
+*/
+func (s *Session) Seal(plaintext, aad []byte) ([]byte, error) {
+	if s.sent == ^uint64(0) {
+		return nil, ErrSessionExhausted
+	}
+	nonce := sequenceNonce(s.sent, s.send.NonceSize())
+	s.sent++
+	return s.send.Seal(nil, nonce, plaintext, aad), nil
+}
+
+/*
+Decrypt the next message from the peer
+*/
+func (s *Session) Open(ciphertext, aad []byte) ([]byte, error) {
+	if s.received == ^uint64(0) {
+		return nil, ErrSessionExhausted
+	}
+	plaintext, err := s.receive.Open(nil, sequenceNonce(s.received, s.receive.NonceSize()), ciphertext, aad)
+	if err != nil {
+		return nil, ErrSessionMessage
+	}
+	s.received++
+	return plaintext, nil
+}
+
+/*
+HKDF (RFC 5869) with the transcript of ephemeral values as salt
+*/
+func deriveSessionKeys(secret, gx, gy *big.Int) *sessionKeys {
+	size := (oprfP.BitLen() + 7) / 8
+	salt := sha256.Sum256(append(gx.FillBytes(make([]byte, size)), gy.FillBytes(make([]byte, size))...))
+
+	extract := hmac.New(sha256.New, salt[:])
+	extract.Write(secret.FillBytes(make([]byte, size)))
+	prk := extract.Sum(nil)
+
+	expand := func(label string) []byte {
+		mac := hmac.New(sha256.New, prk)
+		mac.Write([]byte("schnorr/sigma/" + label))
+		mac.Write([]byte{1})
+		return mac.Sum(nil)
+	}
+	return &sessionKeys{
+		mac:       expand("mac"),
+		initiator: expand("initiator"),
+		responder: expand("responder"),
+		id:        expand("session"),
+	}
+}
+
+func handshakeTranscript(role string, first, second *big.Int) string {
+	return string(appendInts([]byte("schnorr/sigma/"+role), first, second))
+}
+
+func handshakeMAC(key []byte, role string, identity []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("schnorr/sigma/" + role))
+	mac.Write(identity)
+	return mac.Sum(nil)
+}
+
+func newSessionCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sequenceNonce(seq uint64, size int) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-8:], seq)
+	return nonce
+}
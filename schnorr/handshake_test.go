@@ -0,0 +1,22 @@
+//go:build !schnorr_minimal || schnorr_handshake
+
+package schnorr
+
+import "testing"
+
+func TestHandshakeStartTwice(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewInitiator(sk, pk)
+	if _, err := h.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Start(); err != ErrHandshakeState {
+		t.Fatalf("second Start: %v", err)
+	}
+	if _, err := NewResponder(sk, pk).Start(); err != ErrHandshakeState {
+		t.Fatalf("Start by the responder: %v", err)
+	}
+}
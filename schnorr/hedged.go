@@ -0,0 +1,52 @@
+package schnorr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/big"
+)
+
+/*
+Hedged nonces
+
+The nonce is derived from the private key, the message, fresh randomness and
+optional additional entropy (e.g. a public randomness beacon output):
+
+	r = OS2IP(HMAC(rand, 0x00000000 || len(x) || x || len(extra) || extra || m) || ...) mod p
+
+A broken random source alone doesn't lead to nonce reuse, since r still depends
+on the key and the message, and a beacon output mixed in gives ceremonies
+publicly auditable freshness.
+*/
+
+/*
+Sign with a hedged nonce, extra is mixed into the nonce derivation
+*/
+func SignHedged(m string, sk *SignatureKey, extra []byte) (*Signature, error) {
+	if err := sk.checkExpiry(Now()); err != nil {
+		return nil, err
+	}
+	if sk.x.Sign() == 0 {
+		return nil, ErrKeyZeroized
+	}
+
+	fresh := make([]byte, 32)
+	if _, err := io.ReadFull(random(), fresh); err != nil {
+		return nil, err
+	}
+
+	var wide []byte
+	for i := uint32(0); len(wide)*8 < sk.group.Order().BitLen()+128; i++ {
+		mac := hmac.New(sha256.New, fresh)
+		mac.Write(binary.BigEndian.AppendUint32(nil, i))
+		mac.Write(appendBytes(nil, sk.x.Bytes()))
+		mac.Write(appendBytes(nil, extra))
+		mac.Write([]byte(m))
+		wide = mac.Sum(wide)
+	}
+
+	r := new(big.Int).SetBytes(wide)
+	return signWithNonce(m, sk, r.Mod(r, sk.group.Order()))
+}
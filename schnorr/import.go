@@ -0,0 +1,181 @@
+//go:build !schnorr_minimal || schnorr_secp256k1
+
+package schnorr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Import of private keys from other ecosystems
+
+ImportPrivateKey accepts the secret scalar in the formats used by Bitcoin and
+other secp256k1 tooling:
+
+  - raw 32-byte scalar, hex encoded,
+  - Bitcoin WIF (Base58Check, mainnet or testnet, compressed or not),
+  - PEM "EC PRIVATE KEY" (SEC 1) or "PRIVATE KEY" (PKCS #8) on secp256k1.
+
+The key is imported into the Secp256k1 group, its public key is the
+secp256k1 public key of the imported key.
+*/
+
+var ErrInvalidPrivateKey = errors.New("schnorr: invalid private key")
+
+var (
+	oidECPublicKey = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1   = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+/*
+Import private key in any of the supported formats, the format is detected automatically
+*/
+func ImportPrivateKey(encoded string) (*SignatureKey, *PublicKey, error) {
+	encoded = strings.TrimSpace(encoded)
+
+	var scalar []byte
+	var err error
+	switch {
+	case strings.HasPrefix(encoded, "-----BEGIN"):
+		scalar, err = parsePEMScalar([]byte(encoded))
+	case len(encoded) == 64:
+		scalar, err = hex.DecodeString(encoded)
+	default:
+		scalar, err = parseWIF(encoded)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	x := new(big.Int).SetBytes(scalar)
+	if len(scalar) != 32 || x.Sign() == 0 || x.Cmp(group.Secp256k1().Order()) >= 0 {
+		return nil, nil, fmt.Errorf("%w: scalar out of range", ErrInvalidPrivateKey)
+	}
+	return newKeys(group.Secp256k1(), x)
+}
+
+/*
+WIF: Base58Check(version || scalar [|| 0x01])
+*/
+func parseWIF(encoded string) ([]byte, error) {
+	raw, err := base58Decode(encoded)
+	if err != nil || len(raw) < 4 {
+		return nil, fmt.Errorf("%w: not hex, WIF or PEM", ErrInvalidPrivateKey)
+	}
+
+	payload, checksum := raw[:len(raw)-4], raw[len(raw)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return nil, fmt.Errorf("%w: WIF checksum mismatch", ErrInvalidPrivateKey)
+	}
+
+	// 0x80 - mainnet, 0xef - testnet
+	if len(payload) == 0 || (payload[0] != 0x80 && payload[0] != 0xef) {
+		return nil, fmt.Errorf("%w: unknown WIF version", ErrInvalidPrivateKey)
+	}
+	switch {
+	case len(payload) == 33:
+		return payload[1:], nil
+	case len(payload) == 34 && payload[33] == 0x01:
+		return payload[1:33], nil
+	}
+	return nil, fmt.Errorf("%w: invalid WIF length", ErrInvalidPrivateKey)
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, ErrInvalidEncoding
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	// leading '1's encode leading zero bytes
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+/*
+SEC 1 ECPrivateKey
+*/
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+/*
+PKCS #8 PrivateKeyInfo
+*/
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkcs8Algorithm
+	PrivateKey []byte
+}
+
+type pkcs8Algorithm struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.ObjectIdentifier `asn1:"optional"`
+}
+
+func parsePEMScalar(data []byte) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: invalid PEM", ErrInvalidPrivateKey)
+	}
+
+	var curve asn1.ObjectIdentifier
+	der := block.Bytes
+	switch block.Type {
+	case "PRIVATE KEY":
+		var info pkcs8PrivateKey
+		if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) != 0 {
+			return nil, fmt.Errorf("%w: invalid PKCS #8 structure", ErrInvalidPrivateKey)
+		}
+		if !info.Algorithm.Algorithm.Equal(oidECPublicKey) {
+			return nil, fmt.Errorf("%w: not an EC key", ErrInvalidPrivateKey)
+		}
+		curve, der = info.Algorithm.Parameters, info.PrivateKey
+	case "EC PRIVATE KEY":
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM type %q", ErrInvalidPrivateKey, block.Type)
+	}
+
+	var key ecPrivateKey
+	if rest, err := asn1.Unmarshal(der, &key); err != nil || len(rest) != 0 || key.Version != 1 {
+		return nil, fmt.Errorf("%w: invalid SEC 1 structure", ErrInvalidPrivateKey)
+	}
+	if len(key.NamedCurveOID) != 0 {
+		curve = key.NamedCurveOID
+	}
+	if !curve.Equal(oidSecp256k1) {
+		return nil, fmt.Errorf("%w: curve %v is not secp256k1", ErrInvalidPrivateKey, curve)
+	}
+
+	// the scalar may be encoded without leading zeros
+	if len(key.PrivateKey) > 32 {
+		return nil, fmt.Errorf("%w: scalar too long", ErrInvalidPrivateKey)
+	}
+	return append(make([]byte, 32-len(key.PrivateKey)), key.PrivateKey...), nil
+}
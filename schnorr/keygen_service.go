@@ -0,0 +1,214 @@
+package schnorr
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+/*
+Key generation service with a pool of pregenerated groups
+
+GenerateKeys works in the shared RFC 3526 group. Deployments which want a
+group per key, e.g. a key per device on a manufacturing line, need a fresh
+safe prime for every key, and generating it is nearly all of the time of key
+generation (minutes for 2048 bits). KeygenService keeps a pool of groups
+filled by worker goroutines ahead of the requests, so Generate takes a
+validated group from the pool and only draws the private key.
+
+Every group is received from the pool exactly once and used for a single key,
+keys issued by the service don't share parameters (GenerateKeysWithParams is
+the shared-parameters alternative). Groups are generated by GenerateParams,
+which validates them, before they enter the pool. When the pool runs dry
+Generate creates a group on demand instead of waiting, counted as a miss in
+KeygenStats.
+
+The pool holds public parameters only, no key material is generated ahead of
+the request.
+Keys in their own group are encoded with explicit parameters, parsing them
+requires AllowExplicitGroups.
+*/
+
+/*
+Options of NewKeygenService, zero values select the defaults
+*/
+type KeygenServiceOptions struct {
+	Bits     int // size of the safe prime p, default 2048 (as GenerateKeys)
+	PoolSize int // number of pregenerated groups, default 256
+	Workers  int // refilling goroutines, default 1
+
+	Environment string        // environment tag of the issued keys, see TagEnvironment
+	Validity    time.Duration // lifetime of the issued keys, 0 for keys which never expire
+
+	// Called by Generate whenever it leaves LowWater groups (default
+	// PoolSize / 4) or less in the pool; called concurrently and must not block
+	LowWater   int
+	OnLowWater func(KeygenStats)
+}
+
+/*
+Pool metrics
+*/
+type KeygenStats struct {
+	PoolSize   int           // capacity of the pool
+	Available  int           // pregenerated groups in the pool
+	Generated  uint64        // groups generated by the workers
+	Issued     uint64        // key pairs generated
+	Misses     uint64        // key pairs generated in an on-demand group because the pool was empty
+	Failures   uint64        // failed group generations of the workers (random source errors)
+	Uptime     time.Duration // time since the service was started
+	RefillRate float64       // groups generated per second, averaged over the uptime
+}
+
+type KeygenService struct {
+	opts    KeygenServiceOptions
+	pool    chan *GroupParams
+	started time.Time
+
+	generated atomic.Uint64
+	issued    atomic.Uint64
+	misses    atomic.Uint64
+	failures  atomic.Uint64
+
+	stop   chan struct{}
+	closed atomic.Bool
+	wg     sync.WaitGroup
+}
+
+/*
+Start the service and its workers, the pool fills in the background.
+The options are checked here, so Generate fails only for random source errors.
+*/
+func NewKeygenService(opts KeygenServiceOptions) (*KeygenService, error) {
+	if opts.Bits == 0 {
+		opts.Bits = minParamsBits
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 256
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.LowWater <= 0 {
+		opts.LowWater = opts.PoolSize / 4
+	}
+	if opts.Bits < minParamsBits || opts.Bits > maxParamsBits {
+		return nil, fmt.Errorf("%w: p has %d bits, %d to %d required", ErrInvalidParams, opts.Bits, minParamsBits, maxParamsBits)
+	}
+	if opts.Environment != "" && verifier.ValidateEnvironment(opts.Environment) != nil {
+		return nil, ErrInvalidEnvironment
+	}
+
+	s := &KeygenService{
+		opts:    opts,
+		pool:    make(chan *GroupParams, opts.PoolSize),
+		started: Now(),
+		stop:    make(chan struct{}),
+	}
+	s.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go s.refill()
+	}
+	return s, nil
+}
+
+/*
+Generate a key pair in a group from the pool, safe for concurrent use
+*/
+func (s *KeygenService) Generate() (*SignatureKey, *PublicKey, error) {
+	if s.closed.Load() {
+		return nil, nil, ErrServiceClosed
+	}
+
+	var params *GroupParams
+	select {
+	case params = <-s.pool:
+	default:
+		s.misses.Add(1)
+		var err error
+		if params, err = s.params(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if s.opts.OnLowWater != nil && len(s.pool) <= s.opts.LowWater {
+		s.opts.OnLowWater(s.Stats())
+	}
+
+	sk, pk, err := generateKeys(params.modp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.opts.Validity > 0 {
+		notAfter := Now().Add(s.opts.Validity)
+		sk.notAfter, pk.notAfter = notAfter, notAfter
+	}
+	sk.environment, pk.environment = s.opts.Environment, s.opts.Environment
+	s.issued.Add(1)
+	return sk, pk, nil
+}
+
+func (s *KeygenService) Stats() KeygenStats {
+	uptime := time.Since(s.started)
+	generated := s.generated.Load()
+	return KeygenStats{
+		PoolSize:   s.opts.PoolSize,
+		Available:  len(s.pool),
+		Generated:  generated,
+		Issued:     s.issued.Load(),
+		Misses:     s.misses.Load(),
+		Failures:   s.failures.Load(),
+		Uptime:     uptime,
+		RefillRate: float64(generated) / uptime.Seconds(),
+	}
+}
+
+/*
+Stop the workers and drop the pool. Generate fails after Close.
+*/
+func (s *KeygenService) Close() {
+	if s.closed.Swap(true) {
+		return
+	}
+	close(s.stop)
+	s.wg.Wait()
+	for {
+		select {
+		case <-s.pool:
+		default:
+			return
+		}
+	}
+}
+
+func (s *KeygenService) refill() {
+	defer s.wg.Done()
+	for {
+		params, err := s.params()
+		if err != nil {
+			// the random source failed, back off instead of spinning
+			s.failures.Add(1)
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-s.stop:
+				return
+			}
+		}
+		select {
+		case s.pool <- params:
+			s.generated.Add(1)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+/*
+Validated group of the configured size
+*/
+func (s *KeygenService) params() (*GroupParams, error) {
+	return GenerateParams(s.opts.Bits)
+}
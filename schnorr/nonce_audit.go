@@ -0,0 +1,126 @@
+package schnorr
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+/*
+Subliminal-channel-free signing
+
+A randomly chosen nonce can carry hidden information (subliminal channel) and
+nobody can tell. In this mode the nonce is derived deterministically from a
+secret rule key committed in advance:
+
+	commitment = SHA256("schnorr/nonce-rule" || ruleKey)
+	r          = OS2IP(HMAC(ruleKey, 0x00000000 || len(x) || x || m) || HMAC(ruleKey, 0x00000001 || ...) || ...) mod q
+
+An auditor given the signature key and the rule key can check that every
+signature used exactly this nonce, so the signer had no freedom to choose it.
+*/
+
+var (
+	ErrRuleCommitment = errors.New("schnorr: nonce rule key doesn't match the commitment")
+	ErrNonceMismatch  = errors.New("schnorr: signature nonce wasn't derived with the committed rule")
+)
+
+/*
+Secret key of the nonce derivation rule
+*/
+type NonceRule struct {
+	key []byte
+}
+
+func NewNonceRule() (*NonceRule, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(random(), key); err != nil {
+		return nil, err
+	}
+	return &NonceRule{key}, nil
+}
+
+/*
+Rule created from the key revealed to the auditor
+*/
+func NonceRuleFromKey(key []byte) *NonceRule {
+	return &NonceRule{append([]byte(nil), key...)}
+}
+
+/*
+Rule key, to be revealed only to the auditor
+*/
+func (n *NonceRule) Key() []byte {
+	return append([]byte(nil), n.key...)
+}
+
+/*
+Public commitment to the rule, published before any signature is made
+*/
+func (n *NonceRule) Commitment() [32]byte {
+	return sha256.Sum256(append([]byte("schnorr/nonce-rule"), n.key...))
+}
+
+/*
+Sign with the nonce derived from the rule, fails like TrySign for expired and
+zeroized keys
+*/
+func SignVerifiableNonce(m string, sk *SignatureKey, rule *NonceRule) (*Signature, error) {
+	if err := sk.checkExpiry(Now()); err != nil {
+		return nil, err
+	}
+	if sk.x.Sign() == 0 {
+		return nil, ErrKeyZeroized
+	}
+	if err := checkEntropy(); err != nil {
+		return nil, err
+	}
+	r := rule.nonce(m, sk)
+	defer modp.Wipe(r)
+	return signWithNonce(m, sk, r)
+}
+
+/*
+Auditor side - check that the signature of m was made with the nonce derived from the committed rule
+*/
+func AuditNonce(m string, signature *Signature, sk *SignatureKey, rule *NonceRule, commitment [32]byte) error {
+	if rule.Commitment() != commitment {
+		return ErrRuleCommitment
+	}
+
+	expected, err := signWithNonce(m, sk, rule.nonce(m, sk))
+	if err != nil {
+		return err
+	}
+	if signature == nil || !bytes.Equal(expected.R, signature.R) || signature.s == nil || expected.s.Cmp(signature.s) != 0 {
+		return ErrNonceMismatch
+	}
+	return nil
+}
+
+func (n *NonceRule) nonce(m string, sk *SignatureKey) *big.Int {
+	x := sk.x.Bytes()
+
+	var wide []byte
+	for i := uint32(0); len(wide)*8 < sk.group.Order().BitLen()+128; i++ {
+		mac := hmac.New(sha256.New, n.key)
+		mac.Write(binary.BigEndian.AppendUint32(nil, i))
+		mac.Write(appendBytes(nil, x))
+		mac.Write([]byte(m))
+		wide = mac.Sum(wide)
+	}
+
+	r := new(big.Int).SetBytes(wide)
+	r.Mod(r, sk.group.Order())
+	if r.Sign() == 0 {
+		// probability 1/q, practically unreachable
+		panic("schnorr: derived zero nonce")
+	}
+	return r
+}
@@ -0,0 +1,230 @@
+//go:build !schnorr_minimal || schnorr_noncebatch
+
+package schnorr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Pre-generated MuSig2 nonce pairs
+
+MuSig2 nonces don't depend on the message, so a signer can publish a batch of
+public nonce pairs (R1, R2) to its co-signers ahead of time and later sign in
+a single round. The batch keeps constant size regardless of the number of
+nonces: secret nonces are derived on demand from the batch seed,
+
+	r_j = OS2IP(HMAC(seed, j || index) || ...) mod q,  j = 1, 2
+
+and only a bitmap of already used indexes is stored next to the seed.
+musig.NewSessionWithNonces signs with a pair taken from the batch.
+
+Every nonce can be taken only once. The batch has to be persisted (Marshal)
+after Take and before the secret nonce is used, and must never be restored
+from an older copy - that would allow a nonce to be used twice and leak the key.
+*/
+
+var (
+	ErrNonceUsed        = errors.New("schnorr: nonce pair was already used")
+	ErrNonceOutOfBatch  = errors.New("schnorr: nonce index out of the batch")
+	ErrNonceBatchFormat = errors.New("schnorr: invalid nonce batch encoding")
+)
+
+/*
+Public part of the nonce pair, shared with co-signers, R_j = g^r_j encoded by the group
+*/
+type PublicNoncePair struct {
+	Index  uint64
+	R1, R2 []byte
+}
+
+/*
+Secret nonce pair, to be used for a single signing session
+*/
+type SecretNoncePair struct {
+	Index  uint64
+	mu     sync.Mutex
+	r1, r2 *big.Int // nil after Nonces
+	group  Group
+}
+
+type NonceBatch struct {
+	mu    sync.Mutex
+	seed  []byte
+	size  uint64
+	used  []byte // bitmap of used indexes
+	group Group
+}
+
+/*
+Create batch of size nonce pairs for the signature key
+*/
+func NewNonceBatch(sk *SignatureKey, size uint64) (*NonceBatch, error) {
+	seed := make([]byte, 32)
+	if _, err := io.ReadFull(random(), seed); err != nil {
+		return nil, err
+	}
+	return &NonceBatch{seed: seed, size: size, used: make([]byte, (size+7)/8), group: sk.group}, nil
+}
+
+func (b *NonceBatch) Size() uint64 {
+	return b.size
+}
+
+/*
+Number of nonce pairs which weren't used yet
+*/
+func (b *NonceBatch) Remaining() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var n uint64
+	for i := uint64(0); i < b.size; i++ {
+		if !b.isUsed(i) {
+			n++
+		}
+	}
+	return n
+}
+
+/*
+Public nonces of all unused pairs, to be sent to co-signers
+*/
+func (b *NonceBatch) PublicNonces() []PublicNoncePair {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var nonces []PublicNoncePair
+	for i := uint64(0); i < b.size; i++ {
+		if b.isUsed(i) {
+			continue
+		}
+		r1, r2 := b.derive(i)
+		nonces = append(nonces, PublicNoncePair{i, b.commit(r1), b.commit(r2)})
+	}
+	return nonces
+}
+
+/*
+Take secret nonce pair with the given index and mark it as used
+*/
+func (b *NonceBatch) Take(index uint64) (*SecretNoncePair, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if index >= b.size {
+		return nil, ErrNonceOutOfBatch
+	}
+	if b.isUsed(index) {
+		return nil, ErrNonceUsed
+	}
+
+	b.used[index/8] |= 1 << (index % 8)
+	r1, r2 := b.derive(index)
+	return &SecretNoncePair{Index: index, r1: r1, r2: r2, group: b.group}, nil
+}
+
+func (p *SecretNoncePair) Group() Group {
+	return p.group
+}
+
+/*
+Secret nonces r_1, r_2 of the pair, e.g. for musig.NewSessionWithNonces.
+They are handed out once, later calls fail with ErrNonceUsed.
+*/
+func (p *SecretNoncePair) Nonces() (*big.Int, *big.Int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r1, r2 := p.r1, p.r2
+	p.r1, p.r2 = nil, nil
+	if r1 == nil {
+		return nil, nil, ErrNonceUsed
+	}
+	return r1, r2, nil
+}
+
+/*
+Encoding: len(seed)||seed||size||bitmap||group, the group as in PublicKey.Bytes
+*/
+func (b *NonceBatch) Marshal() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	buf := appendBytes(nil, b.seed)
+	buf = binary.BigEndian.AppendUint64(buf, b.size)
+	buf = append(buf, b.used...)
+	buf, err := group.AppendGroup(buf, b.group)
+	if err != nil {
+		return nil
+	}
+	return buf
+}
+
+func UnmarshalNonceBatch(data []byte) (*NonceBatch, error) {
+	if len(data) < 4 {
+		return nil, ErrNonceBatchFormat
+	}
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(len(data)) < uint64(n)+8 {
+		return nil, ErrNonceBatchFormat
+	}
+	seed := append([]byte(nil), data[:n]...)
+	data = data[n:]
+
+	size := binary.BigEndian.Uint64(data)
+	data = data[8:]
+	// (size+7)/8 would overflow for sizes close to 2^64
+	bitmap := size / 8
+	if size%8 != 0 {
+		bitmap++
+	}
+	if uint64(len(data)) < bitmap {
+		return nil, ErrNonceBatchFormat
+	}
+	used := append([]byte(nil), data[:bitmap]...)
+
+	g, rest, err := group.ReadGroup(data[bitmap:])
+	if err != nil || len(rest) != 0 {
+		return nil, ErrNonceBatchFormat
+	}
+
+	return &NonceBatch{seed: seed, size: size, used: used, group: g}, nil
+}
+
+func (b *NonceBatch) isUsed(index uint64) bool {
+	return b.used[index/8]&(1<<(index%8)) != 0
+}
+
+func (b *NonceBatch) derive(index uint64) (*big.Int, *big.Int) {
+	nonce := func(j byte) *big.Int {
+		var wide []byte
+		for i := uint32(0); len(wide)*8 < b.group.Order().BitLen()+128; i++ {
+			mac := hmac.New(sha256.New, b.seed)
+			mac.Write([]byte{j})
+			mac.Write(binary.BigEndian.AppendUint64(nil, index))
+			mac.Write(binary.BigEndian.AppendUint32(nil, i))
+			wide = mac.Sum(wide)
+		}
+		r := new(big.Int).SetBytes(wide)
+		return r.Mod(r, b.group.Order())
+	}
+	return nonce(1), nonce(2)
+}
+
+/*
+Encoded g^k, nil for k = 0 (probability 1/q)
+*/
+func (b *NonceBatch) commit(k *big.Int) []byte {
+	R, _ := b.group.Encode(b.group.ScalarBaseMult(k))
+	return R
+}
@@ -0,0 +1,132 @@
+//go:build !schnorr_minimal || schnorr_noncebatch
+
+package schnorr
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestNonceBatchEntropyFailure(t *testing.T) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failEntropy(t)
+
+	if _, err := NewNonceBatch(sk, 8); !errors.Is(err, ErrEntropyHealth) {
+		t.Errorf("NewNonceBatch: %v", err)
+	}
+}
+
+func TestNonceBatchEncoding(t *testing.T) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := NewNonceBatch(sk, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := batch.Take(3); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := UnmarshalNonceBatch(batch.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Size() != 12 || restored.Remaining() != 11 {
+		t.Errorf("restored size %d, remaining %d", restored.Size(), restored.Remaining())
+	}
+	if _, err := restored.Take(3); err != ErrNonceUsed {
+		t.Errorf("restored batch hands out a used nonce: %v", err)
+	}
+
+	encoded := batch.Marshal()
+	for _, size := range []uint64{1<<64 - 1, 1<<64 - 7, 1 << 63} {
+		// size field after len(seed)||seed
+		malformed := append([]byte(nil), encoded...)
+		binary.BigEndian.PutUint64(malformed[4+32:], size)
+		if _, err := UnmarshalNonceBatch(malformed); err != ErrNonceBatchFormat {
+			t.Errorf("size %d: %v", size, err)
+		}
+	}
+	for n := 0; n < len(encoded); n++ {
+		if _, err := UnmarshalNonceBatch(encoded[:n]); err != ErrNonceBatchFormat {
+			t.Errorf("truncated to %d bytes: %v", n, err)
+		}
+	}
+}
+
+func TestSecretNoncePairOnce(t *testing.T) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := NewNonceBatch(sk, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := batch.Take(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Group().Name() != sk.group.Name() {
+		t.Errorf("pair of group %s", pair.Group().Name())
+	}
+	if _, _, err := pair.Nonces(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pair.Nonces(); err != ErrNonceUsed {
+		t.Errorf("second Nonces: %v", err)
+	}
+}
+
+func TestConcurrentNonceBatch(t *testing.T) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size, goroutines = 64, 8
+	batch, err := NewNonceBatch(sk, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	taken := make(map[uint64]int)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := uint64(0); index < size; index++ {
+				nonce, err := batch.Take(index)
+				if err == ErrNonceUsed {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				taken[nonce.Index]++
+				mu.Unlock()
+				batch.Remaining()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for index := uint64(0); index < size; index++ {
+		if taken[index] != 1 {
+			t.Errorf("nonce %d taken %d times", index, taken[index])
+		}
+	}
+	if batch.Remaining() != 0 {
+		t.Errorf("%d nonces remaining", batch.Remaining())
+	}
+}
@@ -0,0 +1,148 @@
+package schnorr
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("random source failed")
+}
+
+/*
+The same key and message always give the same signature, without touching
+the random source
+*/
+func TestDeterministicSignatures(t *testing.T) {
+	for _, id := range []uint16{ParamsSecp256k1, ParamsP256, ParamsMODP2048} {
+		sk, pk, err := GenerateKeysWithParamsID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, _, err := GenerateKeysWithParamsID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		SetRandomSource(failingReader{})
+		first, err := TrySign("message", sk)
+		dst := &Signature{}
+		if err == nil {
+			err = SignTo(dst, "message", sk)
+		}
+		SetRandomSource(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second := Sign("message", sk)
+
+		if !bytes.Equal(first.Bytes(), second.Bytes()) || !bytes.Equal(first.Bytes(), dst.Bytes()) {
+			t.Errorf("%d: signatures of the same message differ", id)
+		}
+		if !VerifySignature("message", first, pk) {
+			t.Errorf("%d: signature doesn't verify", id)
+		}
+		if bytes.Equal(Sign("another message", sk).R, first.R) || bytes.Equal(Sign("message", other).R, first.R) {
+			t.Errorf("%d: nonce doesn't depend on the message and the key", id)
+		}
+	}
+}
+
+/*
+Auxiliary randomness changes the nonce, the same aux gives the same signature
+*/
+func TestAuxRandomness(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deterministic := Sign("message", sk)
+	aux := bytes.Repeat([]byte{7}, 32)
+
+	withAux, err := SignWithOptions("message", sk, &SignOptions{Aux: aux})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := SignWithAux("message", sk, aux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(withAux.Bytes(), again.Bytes()) {
+		t.Error("signatures with the same aux differ")
+	}
+	if bytes.Equal(withAux.R, deterministic.R) {
+		t.Error("aux doesn't change the nonce")
+	}
+	if !VerifySignature("message", withAux, pk) {
+		t.Error("signature with aux doesn't verify")
+	}
+
+	nilAux, err := SignWithAux("message", sk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nilAux.Bytes(), deterministic.Bytes()) {
+		t.Error("nil aux differs from Sign")
+	}
+}
+
+/*
+Source passing the startup tests, stuck on zero bytes afterwards
+*/
+type stuckReader struct {
+	healthy int
+}
+
+func (s *stuckReader) Read(p []byte) (int, error) {
+	n := len(p)
+	if s.healthy > 0 {
+		if n > s.healthy {
+			n = s.healthy
+		}
+		s.healthy -= n
+		return rand.Read(p[:n])
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	return n, nil
+}
+
+/*
+Health tested source failed by the end of the test
+*/
+func failEntropy(t *testing.T) {
+	t.Helper()
+	h, err := NewHealthTestedReader(&stuckReader{healthy: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRandomSource(h)
+	t.Cleanup(func() { SetRandomSource(rand.Reader) })
+	// drain the healthy part so the source fails its health test
+	io.ReadFull(h, make([]byte, 2048))
+}
+
+/*
+A failed health test makes every function drawing randomness return the
+error instead of panicking, and blocks deterministic signing too
+*/
+func TestEntropyFailure(t *testing.T) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failEntropy(t)
+
+	if _, err := TrySign("message", sk); !errors.Is(err, ErrEntropyHealth) {
+		t.Errorf("TrySign: %v", err)
+	}
+	if _, err := SignWithOptions("message", sk, &SignOptions{Aux: []byte("aux")}); !errors.Is(err, ErrEntropyHealth) {
+		t.Errorf("SignWithOptions: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+//go:build !schnorr_minimal || schnorr_pake
+
+package schnorr
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+)
+
+/*
+OPAQUE-like password protected key storage
+
+The server stores the user's signature key encrypted under a key derived from
+the password through an oblivious PRF (OPRF), so:
+  - the server never learns the password nor the signature key,
+  - the envelope is useless without an online exchange with the server,
+    which can rate limit guesses.
+
+Registration
+
+	client: session, blinded, err := StartPasswordSession(password)
+	server: oprfKey, err := NewOPRFKey(); evaluated, err := oprfKey.Evaluate(blinded)
+	client: envelope, err := session.WrapKey(evaluated, sk, pk)
+	server: stores oprfKey, envelope and pk
+
+Retrieval
+
+	client: session, blinded, err := StartPasswordSession(password)
+	server: evaluated, err := oprfKey.Evaluate(blinded), sends evaluated, envelope and pk
+	client: sk, err := session.UnwrapKey(evaluated, envelope, pk)
+
+OPRF is computed in the prime order subgroup of the 2048-bit MODP group (RFC 3526, group 14):
+F(k, pw) = H(pw, H'(pw)^k)
+*/
+
+const envelopeVersion = 1
+
+var ErrEnvelope = errors.New("schnorr: can't open key envelope (wrong password?)")
+
+/*
+Server side OPRF key, one per registered user
+*/
+type OPRFKey struct {
+	k *big.Int
+}
+
+func NewOPRFKey() (*OPRFKey, error) {
+	k, err := randomScalar(oprfQ)
+	if err != nil {
+		return nil, err
+	}
+	return &OPRFKey{k}, nil
+}
+
+/*
+Evaluate OPRF on the blinded element received from the client
+*/
+func (o *OPRFKey) Evaluate(blinded *big.Int) (*big.Int, error) {
+	if !inOPRFGroup(blinded) {
+		return nil, ErrInvalidOPRFElement
+	}
+	return new(big.Int).Exp(blinded, o.k, oprfP), nil
+}
+
+/*
+Client side state of a single registration or retrieval
+*/
+type PasswordSession struct {
+	password []byte
+	r        *big.Int // blinding factor
+}
+
+/*
+Start session for the given password. Returned blinded element has to be sent to the server.
+*/
+func StartPasswordSession(password []byte) (*PasswordSession, *big.Int, error) {
+	r, err := randomScalar(oprfQ)
+	if err != nil {
+		return nil, nil, err
+	}
+	blinded := new(big.Int).Exp(hashToOPRFGroup(password), r, oprfP)
+
+	return &PasswordSession{password, r}, blinded, nil
+}
+
+/*
+Encrypt the signature key under the password derived key.
+Returned envelope can be stored by the server.
+*/
+func (s *PasswordSession) WrapKey(evaluated *big.Int, sk *SignatureKey, pk *PublicKey) ([]byte, error) {
+	aead, err := s.envelopeCipher(evaluated)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(random(), nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := append([]byte{envelopeVersion}, nonce...)
+	return aead.Seal(envelope, nonce, sk.Bytes(), pk.Bytes()), nil
+}
+
+/*
+Decrypt signature key from the envelope. Fails if the password is wrong,
+the server used other OPRF key or the envelope belongs to other public key.
+*/
+func (s *PasswordSession) UnwrapKey(evaluated *big.Int, envelope []byte, pk *PublicKey) (*SignatureKey, error) {
+	aead, err := s.envelopeCipher(evaluated)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(envelope) < 1+aead.NonceSize() || envelope[0] != envelopeVersion {
+		return nil, ErrEnvelope
+	}
+	nonce, ciphertext := envelope[1:1+aead.NonceSize()], envelope[1+aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, pk.Bytes())
+	if err != nil {
+		return nil, ErrEnvelope
+	}
+
+	sk, unwrapped, err := ParseSignatureKey(plaintext)
+	if err != nil || !unwrapped.Equal(pk) {
+		return nil, ErrEnvelope
+	}
+	return sk, nil
+}
+
+/*
+Unblind OPRF output and derive AES-256-GCM key from it
+*/
+func (s *PasswordSession) envelopeCipher(evaluated *big.Int) (cipher.AEAD, error) {
+	if !inOPRFGroup(evaluated) {
+		return nil, ErrInvalidOPRFElement
+	}
+
+	rInv := new(big.Int).ModInverse(s.r, oprfQ)
+	y := new(big.Int).Exp(evaluated, rInv, oprfP)
+
+	h := sha256.New()
+	h.Write([]byte("schnorr/pake/envelope"))
+	h.Write(appendBytes(nil, s.password))
+	h.Write(y.FillBytes(make([]byte, (oprfP.BitLen()+7)/8)))
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/*
+Map password to the element of order q: (H'(pw) mod p)^2
+*/
+func hashToOPRFGroup(password []byte) *big.Int {
+	// expand hash to more bits than p has, so reduction bias is negligible
+	var wide []byte
+	for i := uint32(0); len(wide)*8 < oprfP.BitLen()+128; i++ {
+		var counter [4]byte
+		binary.BigEndian.PutUint32(counter[:], i)
+		sum := sha256.Sum256(append(append([]byte("schnorr/pake/h2g"), counter[:]...), password...))
+		wide = append(wide, sum[:]...)
+	}
+
+	e := new(big.Int).SetBytes(wide)
+	e.Mod(e, oprfP)
+	return e.Exp(e, big.NewInt(2), oprfP)
+}
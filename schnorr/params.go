@@ -0,0 +1,278 @@
+package schnorr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+/*
+Registry of groups
+
+Groups are referenced by 2-byte IDs, so serialized keys don't have to carry
+the full parameters (see PublicKey.CompactBytes). IDs below 0x8000 are
+reserved for the built-in groups, applications can register their own mod p
+parameters under 0x8000 and above.
+*/
+
+/*
+Built-in group IDs. 0x0001 named parameters of the withdrawn additive scheme
+(2^256 - 189), the ID is never reused.
+*/
+const (
+	ParamsMODP2048  uint16 = group.IDMODP2048  // p from RFC 3526 group 14, g = 2 of order q
+	ParamsSecp256k1 uint16 = group.IDSecp256k1 // secp256k1 curve
+	ParamsP256      uint16 = group.IDP256      // NIST P-256 curve
+
+	firstUserParamsID uint16 = 0x8000
+)
+
+var (
+	ErrUnknownParams      = errors.New("schnorr: unknown group parameters ID")
+	ErrReservedID         = errors.New("schnorr: parameters ID is reserved for built-in parameters")
+	ErrDuplicateParams    = errors.New("schnorr: parameters or ID already registered")
+	ErrInvalidParams      = errors.New("schnorr: invalid group parameters")
+	ErrInvalidOPRFElement = errors.New("schnorr: OPRF element is not a member of the group")
+)
+
+/*
+Minimum size of p accepted for mod p groups, the discrete logarithm modulo
+smaller primes is within reach. Larger primes than maxParamsBits aren't
+accepted either, every membership test is an exponentiation modulo p.
+*/
+const (
+	minParamsBits = 2048
+	maxParamsBits = group.MaxExplicitBits
+)
+
+/*
+Parameters of a mod p group: safe prime p = 2q + 1 and generator g of the
+subgroup of prime order q, which the keys and signatures work in
+*/
+type GroupParams struct {
+	modp *group.ModP
+}
+
+func NewGroupParams(p, g *big.Int) *GroupParams {
+	return &GroupParams{group.NewModP(p, g)}
+}
+
+func (gp *GroupParams) P() *big.Int {
+	return gp.modp.P()
+}
+
+func (gp *GroupParams) G() *big.Int {
+	return gp.modp.G()
+}
+
+/*
+q = (p - 1) / 2, the order of the subgroup generated by g
+*/
+func (gp *GroupParams) Q() *big.Int {
+	return gp.modp.Q()
+}
+
+/*
+The group of the parameters, check them with Validate before using it
+*/
+func (gp *GroupParams) Group() Group {
+	return gp.modp
+}
+
+/*
+Strict validation: p = 2q + 1 has to be a safe prime of at least
+minParamsBits bits and g a generator of the subgroup of order q
+(g != 1, g^q = 1 mod p)
+*/
+func (gp *GroupParams) Validate() error {
+	if gp == nil || gp.modp == nil {
+		return ErrInvalidParams
+	}
+	p, q := gp.modp.P(), gp.modp.Q()
+	if p.BitLen() < minParamsBits || p.BitLen() > maxParamsBits {
+		return fmt.Errorf("%w: p has %d bits, %d to %d required", ErrInvalidParams, p.BitLen(), minParamsBits, maxParamsBits)
+	}
+	if !p.ProbablyPrime(64) {
+		return fmt.Errorf("%w: p is not prime", ErrInvalidParams)
+	}
+	if !q.ProbablyPrime(64) || !gp.modp.Contains(gp.modp.G()) {
+		return ErrNotSafePrime
+	}
+	return nil
+}
+
+/*
+RFC 3526 group 14 used by the OPRF (pake.go) and the ephemeral Diffie-Hellman (handshake.go)
+*/
+var (
+	oprfP = group.MODP2048().P()
+	oprfQ = group.MODP2048().Q()
+)
+
+/*
+Membership in the order q subgroup of the MODP group (pake.go, handshake.go)
+*/
+func inOPRFGroup(e *big.Int) bool {
+	return group.MODP2048().Contains(e)
+}
+
+var registry = struct {
+	sync.RWMutex
+	groups map[uint16]Group
+}{groups: make(map[uint16]Group)}
+
+func init() {
+	for _, id := range []uint16{ParamsMODP2048, ParamsSecp256k1, ParamsP256} {
+		// the curves are missing from schnorr_minimal builds without their tags
+		if g, ok := group.Builtin(id); ok {
+			registry.groups[id] = g
+		}
+	}
+}
+
+/*
+Accept keys and values encoded with explicit group parameters (keys of
+GenerateKeysWithParams, KeygenService, toy keys) in the Parse functions of the
+module. Off by default: parsing an explicit group costs exponentiations
+modulo an attacker-chosen p, so input from untrusted sources has to name a
+built-in group, or a registered one with ParseCompactPublicKey. Explicit
+groups are limited to 4096-bit p either way.
+*/
+func AllowExplicitGroups(allow bool) {
+	group.AllowExplicit(allow)
+}
+
+/*
+Register application specific parameters under id >= 0x8000
+*/
+func RegisterParams(id uint16, params *GroupParams) error {
+	if id < firstUserParamsID {
+		return ErrReservedID
+	}
+	if err := params.Validate(); err != nil {
+		return err
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	for existingID, existing := range registry.groups {
+		if existingID == id || group.Same(existing, params.modp) {
+			return ErrDuplicateParams
+		}
+	}
+	registry.groups[id] = params.modp
+	return nil
+}
+
+/*
+Registered mod p parameters, ErrUnknownParams for unknown IDs and the curves
+(see LookupGroup)
+*/
+func LookupParams(id uint16) (*GroupParams, error) {
+	g, err := LookupGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := g.(*group.ModP)
+	if !ok {
+		return nil, ErrUnknownParams
+	}
+	return &GroupParams{m}, nil
+}
+
+/*
+Registered group of any kind
+*/
+func LookupGroup(id uint16) (Group, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	g, ok := registry.groups[id]
+	if !ok {
+		return nil, ErrUnknownParams
+	}
+	return g, nil
+}
+
+/*
+ID of the registered group
+*/
+func groupID(g Group) (uint16, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for id, registered := range registry.groups {
+		if group.Same(registered, g) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+/*
+Generate keys in a registered group
+*/
+func GenerateKeysWithParamsID(id uint16) (*SignatureKey, *PublicKey, error) {
+	g, err := LookupGroup(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return generateKeys(g)
+}
+
+/*
+ID of the group of the public key, false if it isn't registered
+*/
+func (pk *PublicKey) ParamsID() (uint16, bool) {
+	return groupID(pk.group)
+}
+
+/*
+Public key encoding referencing the registered group by ID: id||len(X)||X||notAfter[||len(env)||env]
+*/
+func (pk *PublicKey) CompactBytes() ([]byte, error) {
+	id, ok := pk.ParamsID()
+	if !ok {
+		return nil, ErrUnknownParams
+	}
+	X, err := pk.group.Encode(pk.X)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := binary.BigEndian.AppendUint16(nil, id)
+	buf = appendElement(buf, X)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(unixOrZero(pk.notAfter)))
+	return appendEnvironment(buf, pk.environment), nil
+}
+
+/*
+Parse public key encoded with PublicKey.CompactBytes
+*/
+func ParseCompactPublicKey(b []byte) (*PublicKey, error) {
+	if len(b) < 2+8 {
+		return nil, ErrInvalidEncoding
+	}
+	g, err := LookupGroup(binary.BigEndian.Uint16(b))
+	if err != nil {
+		return nil, err
+	}
+	X, rest, err := readElement(g, b[2:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < 8 {
+		return nil, ErrInvalidEncoding
+	}
+	environment, err := verifier.ParseEnvironment(rest[8:])
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return &PublicKey{group: g, X: X, notAfter: timeOrZero(int64(binary.BigEndian.Uint64(rest))), environment: environment}, nil
+}
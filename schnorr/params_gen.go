@@ -0,0 +1,235 @@
+package schnorr
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+/*
+Generation of group parameters
+
+GenerateParams produces the parameters of a mod p group:
+
+	p = 2q + 1       safe prime, q prime
+	g = h^2 mod p    g != 1, generates the subgroup of Z_p^* of prime order q
+
+Keys and signatures in the group work in the subgroup of order q (X = g^x mod p).
+Generating a safe prime takes seconds for 256 bits and much longer for 2048, so
+parameters are generated once and shared by many keys through
+GenerateKeysWithParams, the registry (RegisterParams) or their encoding (Bytes).
+ParamsMODP2048 is the standard alternative (RFC 3526 group 14, g = 2 of order q).
+*/
+
+var ErrNotSafePrime = errors.New("schnorr: p is not a safe prime or g doesn't generate the subgroup of order q")
+
+/*
+Generate parameters with a safe prime p of the given size, at least minParamsBits
+*/
+func GenerateParams(bits int) (*GroupParams, error) {
+	if bits < minParamsBits || bits > maxParamsBits {
+		return nil, fmt.Errorf("%w: p has %d bits, %d to %d required", ErrInvalidParams, bits, minParamsBits, maxParamsBits)
+	}
+
+	one := big.NewInt(1)
+	for {
+		q, err := rand.Prime(random(), bits-1)
+		if err != nil {
+			return nil, err
+		}
+		p := new(big.Int).Lsh(q, 1)
+		p.Add(p, one)
+		if p.BitLen() != bits || !p.ProbablyPrime(64) {
+			continue
+		}
+
+		// squares form the subgroup of order q, any square other than 1 generates it
+		for {
+			h, err := rand.Int(random(), new(big.Int).Sub(p, big.NewInt(3)))
+			if err != nil {
+				return nil, err
+			}
+			h.Add(h, big.NewInt(2))
+			if g := h.Exp(h, big.NewInt(2), p); g.Cmp(one) != 0 {
+				params := NewGroupParams(p, g)
+				if err := params.Validate(); err != nil {
+					return nil, err
+				}
+				return params, nil
+			}
+		}
+	}
+}
+
+/*
+Same as Validate, which checks the safe prime structure of every group
+
+Deprecated: use Validate.
+*/
+func (gp *GroupParams) ValidateSafePrime() error {
+	return gp.Validate()
+}
+
+/*
+Encoding: len(p)||p||len(g)||g, see appendInts
+*/
+func (gp *GroupParams) Bytes() []byte {
+	return appendInts(nil, gp.modp.P(), gp.modp.G())
+}
+
+/*
+Parse parameters encoded with GroupParams.Bytes. Call Validate before trusting them.
+*/
+func ParseGroupParams(b []byte) (*GroupParams, error) {
+	ints, err := readInts(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	if ints[0].Sign() <= 0 || ints[1].Sign() <= 0 {
+		return nil, ErrInvalidParams
+	}
+	return NewGroupParams(ints[0], ints[1]), nil
+}
+
+/*
+Generate keys in the given group, the parameters have to pass Validate
+*/
+func GenerateKeysWithParams(params *GroupParams) (*SignatureKey, *PublicKey, error) {
+	if params == nil {
+		return nil, nil, ErrInvalidParams
+	}
+	if err := params.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return generateKeys(params.modp)
+}
+
+/*
+Record of a seeded parameter generation, replayed by Verify
+*/
+type ParamsTranscript struct {
+	Seed     []byte // public seed, e.g. a description of its origin and a beacon output
+	Bits     int    // size of p
+	QCounter uint32 // index of the candidate q which gave a safe prime
+	GCounter uint32 // index of the candidate h, g = h^2 mod p
+}
+
+/*
+Verifiable ("nothing up my sleeve") parameters: candidates are derived from
+the seed with SHA-256 instead of read from the random source,
+
+	q_i = OS2IP(H("q" || i || 0 || seed) || H("q" || i || 1 || seed) || ...) cut to bits-1 bits, top and lowest bit set
+	h_j = 2 + OS2IP(H("g" || j || 0 || seed) || ...) mod (p - 3)
+
+and the first q_i with p = 2q_i + 1 prime and the first h_j with g = h_j^2 != 1
+are taken. Anyone can check with the transcript that the parameters come from
+the seed, so a seed nobody controls (e.g. a randomness beacon round) rules out
+parameters chosen with a trapdoor. Generation takes as long as GenerateParams.
+*/
+func GenerateParamsFromSeed(bits int, seed []byte) (*GroupParams, *ParamsTranscript, error) {
+	if bits < minParamsBits || bits > maxParamsBits {
+		return nil, nil, fmt.Errorf("%w: p has %d bits, %d to %d required", ErrInvalidParams, bits, minParamsBits, maxParamsBits)
+	}
+	t := &ParamsTranscript{Seed: append([]byte(nil), seed...), Bits: bits}
+	var p *big.Int
+	for ; ; t.QCounter++ {
+		q := seededInt("q", seed, t.QCounter, bits-1)
+		q.SetBit(q, bits-2, 1).SetBit(q, 0, 1)
+		if !q.ProbablyPrime(20) {
+			continue
+		}
+		p = new(big.Int).Lsh(q, 1)
+		if p.Add(p, big.NewInt(1)).ProbablyPrime(20) {
+			break
+		}
+	}
+	for ; ; t.GCounter++ {
+		if seededGenerator(seed, t.GCounter, p).Cmp(big.NewInt(1)) != 0 {
+			break
+		}
+	}
+
+	params, err := t.Verify()
+	if err != nil {
+		return nil, nil, err
+	}
+	return params, t, nil
+}
+
+/*
+Parameters generated from the transcript, fails unless they are a safe prime
+group. Only the recorded candidates are checked, not that no earlier candidate
+succeeded.
+*/
+func (t *ParamsTranscript) Verify() (*GroupParams, error) {
+	if t.Bits < minParamsBits {
+		return nil, fmt.Errorf("%w: p has %d bits, at least %d required", ErrInvalidParams, t.Bits, minParamsBits)
+	}
+	q := seededInt("q", t.Seed, t.QCounter, t.Bits-1)
+	q.SetBit(q, t.Bits-2, 1).SetBit(q, 0, 1)
+	p := q.Lsh(q, 1)
+	p.Add(p, big.NewInt(1))
+
+	params := NewGroupParams(p, seededGenerator(t.Seed, t.GCounter, p))
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+/*
+Encoding: len(seed) || seed || bits (2 bytes) || QCounter (4 bytes) || GCounter (4 bytes)
+*/
+func (t *ParamsTranscript) Bytes() []byte {
+	b := appendBytes(nil, t.Seed)
+	b = binary.BigEndian.AppendUint16(b, uint16(t.Bits))
+	b = binary.BigEndian.AppendUint32(b, t.QCounter)
+	return binary.BigEndian.AppendUint32(b, t.GCounter)
+}
+
+func ParseParamsTranscript(b []byte) (*ParamsTranscript, error) {
+	if len(b) < 10 {
+		return nil, ErrInvalidEncoding
+	}
+	counters := b[len(b)-10:]
+	fields, err := readBytes(b[:len(b)-10], 1)
+	if err != nil {
+		return nil, err
+	}
+	return &ParamsTranscript{
+		Seed:     fields[0],
+		Bits:     int(binary.BigEndian.Uint16(counters)),
+		QCounter: binary.BigEndian.Uint32(counters[2:]),
+		GCounter: binary.BigEndian.Uint32(counters[6:]),
+	}, nil
+}
+
+/*
+g = h_j^2 mod p
+*/
+func seededGenerator(seed []byte, j uint32, p *big.Int) *big.Int {
+	h := seededInt("g", seed, j, p.BitLen()+128)
+	h.Mod(h, new(big.Int).Sub(p, big.NewInt(3)))
+	h.Add(h, big.NewInt(2))
+	return h.Exp(h, big.NewInt(2), p)
+}
+
+/*
+bits-bit integer expanded from the seed with SHA-256
+*/
+func seededInt(label string, seed []byte, counter uint32, bits int) *big.Int {
+	var wide []byte
+	for block := uint32(0); len(wide)*8 < bits; block++ {
+		h := sha256.New()
+		h.Write([]byte(label))
+		h.Write(binary.BigEndian.AppendUint32(nil, counter))
+		h.Write(binary.BigEndian.AppendUint32(nil, block))
+		h.Write(seed)
+		wide = h.Sum(wide)
+	}
+	n := new(big.Int).SetBytes(wide)
+	return n.Rsh(n, uint(len(wide)*8-bits))
+}
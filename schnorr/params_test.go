@@ -0,0 +1,50 @@
+package schnorr
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Keys of explicit groups parse only after AllowExplicitGroups, moduli above
+4096 bits never: each membership test would cost an exponentiation modulo p
+*/
+func TestExplicitGroups(t *testing.T) {
+	sk, pk := GenerateToyKeys(1)
+	if _, err := ParsePublicKey(pk.Bytes()); err == nil {
+		t.Fatal("explicit group accepted by default")
+	}
+	if _, _, err := ParseSignatureKey(sk.Bytes()); err == nil {
+		t.Fatal("explicit group of a private key accepted by default")
+	}
+
+	AllowExplicitGroups(true)
+	t.Cleanup(func() { AllowExplicitGroups(false) })
+	parsed, err := ParsePublicKey(pk.Bytes())
+	if err != nil || !VerifySignature("message", Sign("message", sk), parsed) {
+		t.Fatalf("explicit group after AllowExplicitGroups: %v", err)
+	}
+
+	// 8192-bit odd p, g = 2, X = 4
+	p := new(big.Int).Lsh(big.NewInt(1), 8191)
+	p.SetBit(p, 0, 1)
+	b := binary.BigEndian.AppendUint16(nil, group.Explicit)
+	for _, n := range []*big.Int{p, big.NewInt(2)} {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(n.Bytes())))
+		b = append(b, n.Bytes()...)
+	}
+	b = appendElement(b, new(big.Int).SetInt64(4).FillBytes(make([]byte, 1024)))
+	b = binary.BigEndian.AppendUint64(b, 0)
+
+	start := time.Now()
+	if _, err := ParsePublicKey(b); err == nil {
+		t.Error("8192-bit explicit group accepted")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("rejecting the 8192-bit group took %v", elapsed)
+	}
+}
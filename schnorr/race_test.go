@@ -0,0 +1,6 @@
+//go:build race
+
+package schnorr
+
+// the race detector drops pooled values at random, pooled paths allocate
+const raceEnabled = true
@@ -0,0 +1,267 @@
+//go:build !schnorr_minimal || schnorr_threshold || schnorr_crossinput || schnorr_frost
+
+package schnorr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Social recovery of the signature key
+
+The owner splits the private key x into n Shamir shares (threshold t) and hands
+one share to every guardian. To recover the key, t guardians have to approve the
+recovery request by signing an attestation with their own keys. Recovery checks
+the attestations, interpolates x and makes sure it matches the owner's public key.
+
+Shares have to be delivered to the guardians (and back to the recovering owner)
+over an encrypted channel, they are not encrypted by this package.
+*/
+
+var (
+	ErrInvalidThreshold     = errors.New("schnorr: threshold must satisfy 1 <= t <= n")
+	ErrNotEnoughApprovals   = errors.New("schnorr: not enough valid guardian approvals")
+	ErrRecoveredKeyMismatch = errors.New("schnorr: recovered key doesn't match the public key")
+)
+
+/*
+Single Shamir share of the owner's private key
+*/
+type RecoveryShare struct {
+	OwnerKeyID string
+	Threshold  int
+	Index      int64    // x coordinate of the share, 1..n
+	y          *big.Int // f(Index) mod q
+	group      Group    // group of the owner's key
+}
+
+/*
+Encoding: len(keyID)||keyID||threshold||index||group||len(y)||y, nil if the
+group can't be encoded
+*/
+func (s *RecoveryShare) Bytes() []byte {
+	buf := appendBytes(nil, []byte(s.OwnerKeyID))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(s.Threshold))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(s.Index))
+	buf, err := group.AppendGroup(buf, s.group)
+	if err != nil {
+		return nil
+	}
+	return appendInts(buf, s.y)
+}
+
+func ParseRecoveryShare(b []byte) (*RecoveryShare, error) {
+	if len(b) < 4 {
+		return nil, ErrInvalidEncoding
+	}
+	n := int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if len(b) < n+12 {
+		return nil, ErrInvalidEncoding
+	}
+	keyID := string(b[:n])
+	b = b[n:]
+	threshold := int(binary.BigEndian.Uint32(b))
+	index := int64(binary.BigEndian.Uint64(b[4:]))
+
+	g, rest, err := group.ReadGroup(b[12:])
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	ints, err := readInts(rest, 1)
+	if err != nil {
+		return nil, err
+	}
+	if ints[0].Cmp(g.Order()) >= 0 {
+		return nil, ErrInvalidEncoding
+	}
+
+	return &RecoveryShare{keyID, threshold, index, ints[0], g}, nil
+}
+
+/*
+Split private key into n shares, any t of them recover the key
+*/
+func SplitKey(sk *SignatureKey, pk *PublicKey, t, n int) ([]*RecoveryShare, error) {
+	shares, _, err := splitKey(sk, pk, t, n)
+	return shares, err
+}
+
+/*
+Shares together with the coefficients of the sharing polynomial
+*/
+func splitKey(sk *SignatureKey, pk *PublicKey, t, n int) ([]*RecoveryShare, []*big.Int, error) {
+	if t < 1 || t > n {
+		return nil, nil, ErrInvalidThreshold
+	}
+
+	// f(z) = x + a_1*z + ... + a_(t-1)*z^(t-1) mod q
+	q := sk.group.Order()
+	coefficients, err := randomScalars(q, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	coefficients[0] = sk.x
+
+	keyID := pk.KeyID()
+	shares := make([]*RecoveryShare, n)
+	for i := range shares {
+		index := int64(i + 1)
+		shares[i] = &RecoveryShare{keyID, t, index, evalPolynomial(coefficients, big.NewInt(index), q), sk.group}
+	}
+
+	return shares, coefficients, nil
+}
+
+/*
+Guardian's signed consent to the recovery request
+*/
+type RecoveryApproval struct {
+	RequestID     string
+	GuardianKeyID string
+	Share         *RecoveryShare
+	Signature     *Signature
+}
+
+/*
+Guardian approves recovery request with the share it holds, fails if the
+guardian's key can't sign (e.g. it has expired)
+*/
+func ApproveRecovery(requestID string, share *RecoveryShare, guardianSK *SignatureKey, guardianPK *PublicKey) (*RecoveryApproval, error) {
+	keyID := guardianPK.KeyID()
+	signature, err := TrySign(approvalMessage(requestID, keyID, share), guardianSK)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryApproval{
+		RequestID:     requestID,
+		GuardianKeyID: keyID,
+		Share:         share,
+		Signature:     signature,
+	}, nil
+}
+
+/*
+Recover the owner's key from guardian approvals.
+Approvals which aren't signed by one of the guardians, belong to other request
+or other key, or repeat a guardian or share index are ignored.
+*/
+func RecoverKey(requestID string, owner *PublicKey, guardians map[string]*PublicKey, approvals []*RecoveryApproval) (*SignatureKey, error) {
+	ownerKeyID := owner.KeyID()
+
+	usedGuardians := make(map[string]bool)
+	usedIndexes := make(map[int64]bool)
+	var shares []*RecoveryShare
+
+	for _, a := range approvals {
+		guardian, ok := guardians[a.GuardianKeyID]
+		if !ok || usedGuardians[a.GuardianKeyID] || a.RequestID != requestID {
+			continue
+		}
+		s := a.Share
+		if s.OwnerKeyID != ownerKeyID || usedIndexes[s.Index] || !group.Same(s.group, owner.group) {
+			continue
+		}
+		if !VerifySignature(approvalMessage(requestID, a.GuardianKeyID, s), a.Signature, guardian) {
+			continue
+		}
+
+		usedGuardians[a.GuardianKeyID] = true
+		usedIndexes[s.Index] = true
+		shares = append(shares, s)
+	}
+
+	if len(shares) == 0 || len(shares) < shares[0].Threshold {
+		return nil, ErrNotEnoughApprovals
+	}
+
+	g := owner.group
+	x := interpolateAtZero(shares, g.Order())
+	if x.Sign() == 0 || !g.Equal(g.ScalarBaseMult(x), owner.X) {
+		return nil, ErrRecoveredKeyMismatch
+	}
+
+	return &SignatureKey{group: g, x: x, pub: owner.X, notAfter: owner.notAfter, environment: owner.environment}, nil
+}
+
+func approvalMessage(requestID, guardianKeyID string, share *RecoveryShare) string {
+	h := sha256.New()
+	h.Write([]byte("schnorr/recovery/approval"))
+	h.Write(appendBytes(nil, []byte(requestID)))
+	h.Write(appendBytes(nil, []byte(guardianKeyID)))
+	h.Write(share.Bytes())
+	return string(h.Sum(nil))
+}
+
+/*
+f(z) mod q, Horner's method
+*/
+func evalPolynomial(coefficients []*big.Int, z, p *big.Int) *big.Int {
+	y := new(big.Int)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y.Mul(y, z)
+		y.Add(y, coefficients[i])
+		y.Mod(y, p)
+	}
+	return y
+}
+
+/*
+f(0) = sum(y_i * l_i(0))
+*/
+func interpolateAtZero(shares []*RecoveryShare, p *big.Int) *big.Int {
+	indexes := make([]int64, len(shares))
+	for i, share := range shares {
+		indexes[i] = share.Index
+	}
+
+	secret := new(big.Int)
+	for _, share := range shares {
+		l := lagrangeAtZero(share.Index, indexes, p)
+		secret.Add(secret, l.Mul(l, share.y))
+		secret.Mod(secret, p)
+	}
+	return secret
+}
+
+/*
+Lagrange coefficient l_i(0) = prod(x_j / (x_j - x_i)) for j != i
+*/
+func lagrangeAtZero(index int64, indexes []int64, p *big.Int) *big.Int {
+	num, den := big.NewInt(1), big.NewInt(1)
+	for _, j := range indexes {
+		if j == index {
+			continue
+		}
+		xj := big.NewInt(j)
+		num.Mul(num, xj)
+		num.Mod(num, p)
+		den.Mul(den, new(big.Int).Sub(xj, big.NewInt(index)))
+		den.Mod(den, p)
+	}
+	return num.Mul(num, den.ModInverse(den, p)).Mod(num, p)
+}
+
+func init() {
+	describers = append(describers, describeRecoveryShare)
+}
+
+func describeRecoveryShare(b []byte) *Description {
+	share, err := ParseRecoveryShare(b)
+	if err != nil {
+		return nil
+	}
+	d := &Description{Kind: "recovery share"}
+	d.Add("owner key", share.OwnerKeyID)
+	d.Add("share", fmt.Sprintf("%d (threshold %d)", share.Index, share.Threshold))
+	d.Add("group", groupName(share.group))
+	d.Add("canonical", bytes.Equal(share.Bytes(), b))
+	return d
+}
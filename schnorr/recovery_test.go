@@ -0,0 +1,34 @@
+//go:build !schnorr_minimal || schnorr_threshold || schnorr_crossinput || schnorr_frost
+
+package schnorr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApproveRecoveryExpiredGuardian(t *testing.T) {
+	owner, ownerPK, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := SplitKey(owner, ownerPK, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardian, guardianPK, c := expiringKeys(t)
+
+	approval, err := ApproveRecovery("request", shares[0], guardian, guardianPK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := RecoverKey("request", ownerPK, map[string]*PublicKey{guardianPK.KeyID(): guardianPK}, []*RecoveryApproval{approval})
+	if err != nil || !recovered.Equal(owner) {
+		t.Fatalf("recovery: %v", err)
+	}
+
+	c.Advance(2 * time.Hour)
+	if _, err := ApproveRecovery("request", shares[0], guardian, guardianPK); err != ErrKeyExpired {
+		t.Fatalf("approval with an expired key: %v", err)
+	}
+}
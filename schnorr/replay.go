@@ -0,0 +1,230 @@
+package schnorr
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+/*
+Recorded signing with replay proofs
+
+In hardened deployments RecordingSigner stores a record of every signature:
+the message hash, the inputs of the nonce derivation and the signature. Records
+are hash chained, so deleting or reordering them is detected. The nonce is
+derived from the committed NonceRule and the record itself:
+
+	r = OS2IP(HMAC(ruleKey, 0x00000000 || len(x) || x || record inputs) || ...) mod q
+
+After an incident the signer hands the records and the rule key over as a
+ReplayProof and the auditor, who also holds the signature key, replays the
+signing of every record and checks that it produced exactly the stored
+signature, i.e. nothing was signed outside of the policy.
+*/
+
+var (
+	ErrRecordChain = errors.New("schnorr: signing records are not a consistent chain")
+	ErrReplay      = errors.New("schnorr: signature doesn't match its replayed record")
+)
+
+/*
+Single signature made by RecordingSigner
+*/
+type SigningRecord struct {
+	Seq         uint64
+	Policy      string    // policy the signer operated under
+	Time        time.Time // signing time, second precision
+	MessageHash [32]byte  // SHA256(m)
+	Signature   *Signature
+	Prev        [32]byte // hash of the previous record, zero for the first one
+}
+
+/*
+Hash of the record, referenced by Prev of the next record
+*/
+func (r *SigningRecord) Hash() [32]byte {
+	return sha256.Sum256(append(r.inputs(), r.Signature.Bytes()...))
+}
+
+/*
+Nonce derivation inputs: seq || len(policy) || policy || time || H(m) || prev
+*/
+func (r *SigningRecord) inputs() []byte {
+	b := binary.BigEndian.AppendUint64(nil, r.Seq)
+	b = appendBytes(b, []byte(r.Policy))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Time.Unix()))
+	b = append(b, r.MessageHash[:]...)
+	return append(b, r.Prev[:]...)
+}
+
+/*
+Persistence of signing records, records are appended in order
+*/
+type RecordStore interface {
+	Append(record *SigningRecord) error
+	Records() ([]*SigningRecord, error)
+}
+
+type MemoryRecordStore struct {
+	mu      sync.Mutex
+	records []*SigningRecord
+}
+
+func (s *MemoryRecordStore) Append(record *SigningRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *MemoryRecordStore) Records() ([]*SigningRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*SigningRecord(nil), s.records...), nil
+}
+
+/*
+Signer storing a record of every signature
+*/
+type RecordingSigner struct {
+	sk     *SignatureKey
+	rule   *NonceRule
+	policy string
+	store  RecordStore
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seq  uint64
+	prev [32]byte
+}
+
+/*
+Signer recording to store. Signing continues the chain of records already in the store.
+*/
+func NewRecordingSigner(sk *SignatureKey, rule *NonceRule, policy string, store RecordStore) (*RecordingSigner, error) {
+	records, err := store.Records()
+	if err != nil {
+		return nil, err
+	}
+	s := &RecordingSigner{sk: sk, rule: rule, policy: policy, store: store, now: Now}
+	if n := len(records); n > 0 {
+		s.seq, s.prev = records[n-1].Seq+1, records[n-1].Hash()
+	}
+	return s, nil
+}
+
+/*
+Sign m, the signature is returned only after its record is stored
+*/
+func (s *RecordingSigner) Sign(m string) (*Signature, error) {
+	now := s.now()
+	if err := s.sk.checkExpiry(now); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := &SigningRecord{
+		Seq:         s.seq,
+		Policy:      s.policy,
+		Time:        time.Unix(now.Unix(), 0),
+		MessageHash: sha256.Sum256([]byte(m)),
+		Prev:        s.prev,
+	}
+	signature, err := signWithNonce(m, s.sk, replayNonce(s.rule, s.sk, record))
+	if err != nil {
+		return nil, err
+	}
+	record.Signature = signature
+
+	if err := s.store.Append(record); err != nil {
+		return nil, err
+	}
+	s.seq, s.prev = s.seq+1, record.Hash()
+	return record.Signature, nil
+}
+
+/*
+Records with the rule key needed to replay them
+*/
+type ReplayProof struct {
+	Records []*SigningRecord
+	RuleKey []byte
+}
+
+/*
+Collect all records of the store into a replay proof
+*/
+func (s *RecordingSigner) ReplayProof() (*ReplayProof, error) {
+	records, err := s.store.Records()
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayProof{records, s.rule.Key()}, nil
+}
+
+/*
+Auditor side - replay every record and check the chain. The rule key has to
+match the commitment published before signing and every signature has to be
+exactly the one computed from its record. If messages contains the message of a
+record (keyed by its SHA256), the signature is additionally verified against it.
+*/
+func (p *ReplayProof) Verify(sk *SignatureKey, pk *PublicKey, commitment [32]byte, messages map[[32]byte]string) error {
+	rule := NonceRuleFromKey(p.RuleKey)
+	if rule.Commitment() != commitment {
+		return ErrRuleCommitment
+	}
+
+	var prev [32]byte
+	for i, record := range p.Records {
+		if record.Seq != uint64(i) || record.Prev != prev {
+			return fmt.Errorf("%w: record %d", ErrRecordChain, i)
+		}
+		prev = record.Hash()
+
+		// s = r + c * x, so c * x = s - r and R has to be g^r
+		r := replayNonce(rule, sk, record)
+		R, err := sk.group.Encode(sk.group.ScalarBaseMult(r))
+		if err != nil || record.Signature == nil || !bytes.Equal(R, record.Signature.R) {
+			return fmt.Errorf("%w: record %d", ErrReplay, record.Seq)
+		}
+
+		m, ok := messages[record.MessageHash]
+		if !ok {
+			continue
+		}
+		expected, err := signWithNonce(m, sk, r)
+		if err != nil || !VerifySignature(m, record.Signature, pk) || record.Signature.s.Cmp(expected.s) != 0 {
+			return fmt.Errorf("%w: record %d", ErrReplay, record.Seq)
+		}
+	}
+	return nil
+}
+
+func replayNonce(rule *NonceRule, sk *SignatureKey, record *SigningRecord) *big.Int {
+	x, inputs := sk.x.Bytes(), record.inputs()
+
+	var wide []byte
+	for i := uint32(0); len(wide)*8 < sk.group.Order().BitLen()+128; i++ {
+		mac := hmac.New(sha256.New, rule.key)
+		mac.Write(binary.BigEndian.AppendUint32(nil, i))
+		mac.Write(appendBytes(nil, x))
+		mac.Write(inputs)
+		wide = mac.Sum(wide)
+	}
+
+	r := new(big.Int).SetBytes(wide)
+	r.Mod(r, sk.group.Order())
+	if r.Sign() == 0 {
+		// probability 1/q, practically unreachable
+		panic("schnorr: derived zero nonce")
+	}
+	return r
+}
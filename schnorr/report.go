@@ -0,0 +1,55 @@
+package schnorr
+
+import "sync"
+
+/*
+Protocol progress reporting
+
+The package never prints. Protocols whose progress is worth following (the
+blind signature steps) describe the messages they produce to a Reporter,
+which is silent by default. Values reported are the public protocol messages
+only, never keys, nonces or blinding factors.
+
+	schnorr.SetReporter(schnorr.ReporterFunc(func(event string, kv ...interface{}) {
+		log.Println(append([]interface{}{event}, kv...)...)
+	}))
+*/
+
+type Reporter interface {
+	// event names the protocol step (e.g. "blind/commit"), kv are alternating names and values
+	Report(event string, kv ...interface{})
+}
+
+type ReporterFunc func(event string, kv ...interface{})
+
+func (f ReporterFunc) Report(event string, kv ...interface{}) {
+	f(event, kv...)
+}
+
+type silentReporter struct{}
+
+func (silentReporter) Report(string, ...interface{}) {}
+
+var reporting = struct {
+	sync.RWMutex
+	r Reporter
+}{r: silentReporter{}}
+
+/*
+Set the reporter of the package, nil makes it silent again
+*/
+func SetReporter(r Reporter) {
+	if r == nil {
+		r = silentReporter{}
+	}
+	reporting.Lock()
+	defer reporting.Unlock()
+	reporting.r = r
+}
+
+func report(event string, kv ...interface{}) {
+	reporting.RLock()
+	r := reporting.r
+	reporting.RUnlock()
+	r.Report(event, kv...)
+}
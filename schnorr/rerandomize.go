@@ -0,0 +1,137 @@
+package schnorr
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Re-randomized keys (RedDSA style)
+
+As with RedDSA spend authorization in Zcash, a key pair can be shifted by a
+randomizer alpha to a fresh-looking key pair which still signs and verifies
+as usual:
+
+	rk  = X + alpha*G
+	rsk = x + alpha mod n
+
+A signature under rk verifies with VerifySignature against rk and reveals
+nothing linking rk to X to anyone who doesn't know alpha, so protocols can
+use a new key per transaction while the signer keeps a single private key.
+The party holding alpha can check that rk was derived from X (RandomizedFrom).
+
+Randomized keys carry the environment tag "rk-" followed by 60 hex digits of
+SHA256(environment of X || rk), which binds rk into the challenge (see
+TagEnvironment): signatures under X don't verify against rk and a signature
+under one randomization can't be shifted to another by adding the difference
+of the randomizers, the property the key-prefixed challenge gives RedDSA.
+
+Randomizers have to be fresh and uniform (NewRandomizer), a randomizer reused
+for two transactions links them. Keys and signatures keep the encodings of
+the package and aren't byte compatible with Zcash RedJubjub, which works on
+the Jubjub curve with BLAKE2b challenges.
+*/
+
+var ErrInvalidRandomizer = errors.New("schnorr: invalid key randomizer")
+
+/*
+Random randomizer alpha from [1, n)
+*/
+func NewRandomizer(g Group) (*big.Int, error) {
+	return randomScalar(g.Order())
+}
+
+/*
+Public key rk = X + alpha*G
+*/
+func (pk *PublicKey) Randomize(alpha *big.Int) (*PublicKey, error) {
+	g := pk.group
+	if !validRandomizer(g, alpha) {
+		return nil, ErrInvalidRandomizer
+	}
+	X := g.Add(pk.X, g.ScalarBaseMult(alpha))
+	encoded, err := g.Encode(X)
+	if err != nil {
+		// X = -alpha*G, only for alpha = n - x
+		return nil, ErrInvalidRandomizer
+	}
+	return &PublicKey{group: g, X: X, notAfter: pk.notAfter, environment: randomizedEnvironment(pk.environment, encoded)}, nil
+}
+
+/*
+Signature key rsk = x + alpha mod n matching pk.Randomize(alpha)
+*/
+func (sk *SignatureKey) Randomize(alpha *big.Int) (*SignatureKey, *PublicKey, error) {
+	pk, err := sk.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	rk, err := pk.Randomize(alpha)
+	if err != nil {
+		return nil, nil, err
+	}
+	x := new(big.Int).Add(sk.x, alpha)
+	x.Mod(x, sk.group.Order())
+	return &SignatureKey{group: sk.group, x: x, pub: rk.X, notAfter: sk.notAfter, environment: rk.environment}, rk, nil
+}
+
+/*
+Sign m under the randomized key X + alpha*G
+*/
+func SignRandomized(m string, sk *SignatureKey, alpha *big.Int) (*Signature, error) {
+	rsk, _, err := sk.Randomize(alpha)
+	if err != nil {
+		return nil, err
+	}
+	defer rsk.Zeroize()
+	return TrySign(m, rsk)
+}
+
+/*
+Check that rk = pk + alpha*G
+*/
+func (rk *PublicKey) RandomizedFrom(pk *PublicKey, alpha *big.Int) bool {
+	if !group.Same(rk.group, pk.group) {
+		return false
+	}
+	expected, err := pk.Randomize(alpha)
+	return err == nil && expected.Equal(rk) && expected.environment == rk.environment
+}
+
+/*
+"rk-" || hex(SHA256(len(environment) || environment || rk))[:60]
+*/
+func randomizedEnvironment(environment string, rk []byte) string {
+	h := sha256.New()
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(environment))))
+	h.Write([]byte(environment))
+	h.Write(rk)
+	return "rk-" + hex.EncodeToString(h.Sum(nil))[:60]
+}
+
+/*
+Randomizer encoded as a big-endian scalar of the byte length of the group order
+*/
+func RandomizerBytes(g Group, alpha *big.Int) []byte {
+	return alpha.FillBytes(make([]byte, group.ScalarLen(g)))
+}
+
+func ParseRandomizer(g Group, b []byte) (*big.Int, error) {
+	if len(b) != group.ScalarLen(g) {
+		return nil, ErrInvalidEncoding
+	}
+	alpha := new(big.Int).SetBytes(b)
+	if !validRandomizer(g, alpha) {
+		return nil, ErrInvalidRandomizer
+	}
+	return alpha, nil
+}
+
+func validRandomizer(g Group, alpha *big.Int) bool {
+	return alpha != nil && alpha.Sign() > 0 && alpha.Cmp(g.Order()) < 0
+}
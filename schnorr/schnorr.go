@@ -2,242 +2,285 @@ package schnorr
 
 import (
 	"crypto/rand"
-	"crypto/sha256"
 	"fmt"
 	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/internal/modp"
+	"github.com/miki799/schnorr-signature/verifier"
 )
 
 type SignatureKey struct {
-	p *big.Int // group order (large prime number)
-	g *big.Int // generator
-	x *big.Int // private key
+	group Group    // prime order group
+	x     *big.Int // private key, 0 < x < q
+	pub   Element  // public key, X = g^x
+
+	notAfter     time.Time   // key expiry, zero if the key never expires
+	allowExpired atomic.Bool // override of the expiry check in Sign
+	environment  string      // environment tag bound into the challenge, see TagEnvironment
 }
 
 type PublicKey struct {
-	p *big.Int // group order (large prime number)
-	g *big.Int // generator
-	X *big.Int // public key, X = x * g
+	group Group   // prime order group
+	X     Element // public key, X = g^x (x*G on curves)
+
+	notAfter    time.Time // key expiry, zero if the key never expires
+	environment string    // environment tag bound into the challenge, see TagEnvironment
+	context     string    // signing context bound into the challenge, see WithContext
 }
 
 type Signature struct {
-	R *big.Int // R = r * g
-	s *big.Int // (r + H(R||m)x)modp
+	R []byte   // encoding of R = g^r (r*G on curves)
+	s *big.Int // (r + H(R||m)x) mod q
 }
 
 func (S Signature) String() string {
-	return fmt.Sprintf("(r=%s, s=%s)", S.R, S.s)
+	return fmt.Sprintf("(R=%x, s=%s)", S.R, S.s)
 }
 
 /*
 Generate signature key and public key of the signer.
+Panics if the random source fails, see TryGenerateKeys.
 */
 func GenerateKeys() (*SignatureKey, *PublicKey) {
-	// prime number p (group order), generator g
-	p, g := generateMultiplicativeGroup(256)
-
-	// Generate random number x which belongs to generated group
-	// it will be a private signing key
-	x, err := rand.Int(rand.Reader, p)
+	sk, pk, err := TryGenerateKeys()
 	if err != nil {
 		panic(err)
 	}
+	return sk, pk
+}
 
-	// public key, X = x * g
-	X := new(big.Int).Mul(x, g)
-
-	return &SignatureKey{p, g, x}, &PublicKey{p, g, X}
+/*
+Same as GenerateKeys, but returns error instead of panicking
+*/
+func TryGenerateKeys() (*SignatureKey, *PublicKey, error) {
+	return generateKeys(group.MODP2048())
 }
 
 /*
-Applies Schnorr signature to the given message
+Generate keys in the group: x random in [1, q), X = g^x
 */
-func Sign(m string, sk *SignatureKey) *Signature {
-	// Generate random number x which belongs to generated group
-	r, err := rand.Int(rand.Reader, sk.p)
+func generateKeys(g Group) (*SignatureKey, *PublicKey, error) {
+	// x = 0 would give the identity as public key
+	x, err := rand.Int(random(), new(big.Int).Sub(g.Order(), big.NewInt(1)))
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
-
-	// R = r * g
-	R := new(big.Int).Mul(r, sk.g)
-
-	// Apply SHA256 hasing function to R and m concatenation H(R||m)
-	c := hash(R.String() + m)
-	cInt := new(big.Int).SetBytes(c[:])
-
-	// Create signature s = (r + cx)modp
-	s := new(big.Int).Mul(cInt, sk.x)
-	s.Add(r, s)
-	s.Mod(s, sk.p)
-
-	return &Signature{R, s}
+	return newKeys(g, x.Add(x, big.NewInt(1)))
 }
 
 /*
-Use to verify signature correctness. Following condition needs to be checked:
-sg = R + cX
-where:
-s - signature
-g - group generator
-R - r * g
-c - H(R||m) - SHA256 checksum of R||m
-X - public key
+Key pair of the private scalar 0 < x < q
 */
-func VerifySignature(message string, signature *Signature, publicKey *PublicKey) bool {
-	/*
-		left side
-	*/
-	sg := new(big.Int).Mul(signature.s, publicKey.g)
-	sg.Mod(sg, publicKey.p)
-
-	/*
-		right side
-	*/
-
-	// Apply SHA256 hasing function to R and m concatenation H(R||m)
-	c := hash(signature.R.String() + message)
-	cInt := new(big.Int).SetBytes(c[:])
-
-	cx := new(big.Int).Mul(cInt, publicKey.X)
-	rcx := new(big.Int).Add(signature.R, cx)
-	rcx.Mod(rcx, publicKey.p)
-
-	// verify
-	return sg.Cmp(rcx) == 0
+func newKeys(g Group, x *big.Int) (*SignatureKey, *PublicKey, error) {
+	X := g.ScalarBaseMult(x)
+	if _, err := g.Encode(X); err != nil {
+		return nil, nil, ErrInvalidKey
+	}
+	return &SignatureKey{group: g, x: x, pub: X}, &PublicKey{group: g, X: X}, nil
 }
 
 /*
-Shortened Blind Schnorr signature process
+Group of the key
+*/
+func (sk *SignatureKey) Group() Group {
+	return sk.group
+}
 
-Step 1
+/*
+Group of the key
+*/
+func (pk *PublicKey) Group() Group {
+	return pk.group
+}
 
-	Signer generates R and sends it to the User
+/*
+Applies Schnorr signature to the given message.
+
+The nonce is derived deterministically from the private key and the message
+(see SignWithAux), so signing the same message with the same key always gives
+the same signature and a broken random number generator can't leak the key.
+Panics if the key can't sign (expired or zeroized, or the health tested
+random source failed, see NewHealthTestedReader), code which signs with
+such keys uses TrySign.
+*/
+func Sign(m string, sk *SignatureKey) *Signature {
+	signature, err := TrySign(m, sk)
+	if err != nil {
+		panic(err)
+	}
+	return signature
+}
 
-Step 2
+/*
+Same as Sign, but returns error instead of panicking,
+e.g. when the key has expired
+*/
+func TrySign(m string, sk *SignatureKey) (*Signature, error) {
+	return signWithAux(m, sk, nil)
+}
 
-	User generates a (alfa) and b (beta), which belongs to the generated group
-	User calculates:
-		R' = R + ag + bX
-		c' = H(R'||m)
-		c = (c' + b)modp
-	User sends c to the Signer
+/*
+Same as TrySign, but stores the signature into dst, reusing its memory
+*/
+func SignTo(dst *Signature, m string, sk *SignatureKey) error {
+	return signToWithAux(dst, "", m, sk, nil)
+}
 
-Step 3
+/*
+Sign with auxiliary randomness mixed into the nonce derivation (as in BIP-340):
 
-	Signer receives c from the User and sends back signature s = (r + cx)modp
+	K = SHA256(x),  r = OS2IP(HMAC(K, counter || SHA256(aux) || m) || ...) mod q
 
-Step 4
+Fresh aux (e.g. 32 random bytes) makes signatures randomized, which hides
+repeated messages and hardens against fault and side-channel attacks, while a
+bad aux still can't lead to nonce reuse. nil aux gives the deterministic nonce
+of Sign.
 
-	User receives signature s from the Signer and checks this condition: sg == R + cX.
-	If it is true, he can proceed with creating his own signature {R', s'}, where s' = (s + a)modp
+Deprecated: use SignWithOptions with SignOptions.Aux, which also takes the
+other signing options.
 */
-func BlindSignatureProcess(message string, signerSignatureKey *SignatureKey, publicKey *PublicKey) {
-	fmt.Println("### Blind Schnorr Signature ###")
+func SignWithAux(m string, sk *SignatureKey, aux []byte) (*Signature, error) {
+	return signWithAux(m, sk, aux)
+}
 
-	/*
-		Step 1
-	*/
+func signWithAux(m string, sk *SignatureKey, aux []byte) (*Signature, error) {
+	return signInContext("", m, sk, aux)
+}
 
-	r, err := rand.Int(rand.Reader, publicKey.p)
-	if err != nil {
-		panic(err)
+/*
+Signature of m in the signing context, see WithContext
+*/
+func signInContext(context, m string, sk *SignatureKey, aux []byte) (*Signature, error) {
+	signature := &Signature{}
+	if err := signToWithAux(signature, context, m, sk, aux); err != nil {
+		return nil, err
 	}
-	R := new(big.Int).Mul(r, publicKey.g)
-
-	/*
-		Step 2
-	*/
+	return signature, nil
+}
 
-	a, err := rand.Int(rand.Reader, publicKey.p)
-	if err != nil {
-		panic(err)
+func signToWithAux(dst *Signature, context, m string, sk *SignatureKey, aux []byte) error {
+	if err := sk.checkExpiry(Now()); err != nil {
+		return err
 	}
-
-	b, err := rand.Int(rand.Reader, publicKey.p)
-	if err != nil {
-		panic(err)
+	if sk.x.Sign() == 0 {
+		return ErrKeyZeroized
 	}
+	if err := checkEntropy(); err != nil {
+		return err
+	}
+	if err := verifier.ValidateContext(context); err != nil {
+		return err
+	}
+	tag := sk.tag(context)
 
-	// R' = R + ag + bX
-	RP := new(big.Int).Add(R, new(big.Int).Mul(a, publicKey.g))
-	RP.Add(RP, new(big.Int).Mul(b, publicKey.X))
-
-	// c' = H(R'||m)
-	cp := hash(RP.String() + message)
-	cpInt := new(big.Int).SetBytes(cp[:])
+	sc := modp.Get()
+	defer modp.Put(sc)
 
-	// c = (c' + b)modp
-	c := new(big.Int).Add(cpInt, b)
-	c.Mod(c, publicKey.p)
+	r := &sc.A
+	sc.Input = appendNonceInput(sc.Input[:0], tag, m)
+	sc.NonceTo(r, sk.x, aux, sc.Input, sk.group.Order())
+	err := signWithNonceTo(dst, tag, m, sk, r, sc)
+	modp.Wipe(r)
+	return err
+}
 
-	/*
-		Step 3
-	*/
+/*
+Schnorr signature with the given nonce 0 < r < q
+*/
+func signWithNonce(m string, sk *SignatureKey, r *big.Int) (*Signature, error) {
+	sc := modp.Get()
+	defer modp.Put(sc)
 
-	// s = (r + cx)modp
-	s := new(big.Int).Mul(c, signerSignatureKey.x)
-	s.Add(s, r)
-	s.Mod(s, signerSignatureKey.p)
+	signature := &Signature{}
+	if err := signWithNonceTo(signature, sk.tag(""), m, sk, r, sc); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
 
-	/*
-		Step 4
-	*/
+/*
+R = g^r, s = r + c*x mod q for the message m and the tag of the key (see tag)
+*/
+func signWithNonceTo(dst *Signature, tag, m string, sk *SignatureKey, r *big.Int, sc *modp.Scratch) error {
+	var R []byte
+	var err error
+	if a, ok := sk.group.(group.Appender); ok {
+		// encoded into the buffer of dst, see internal/group.Appender
+		R, err = a.AppendScalarBaseMult(dst.R[:0], r)
+	} else {
+		R, err = sk.group.Encode(sk.group.ScalarBaseMult(r))
+	}
+	if err != nil {
+		return err
+	}
+	signWithCommitmentTo(dst, tag, m, sk, r, R, sc)
+	return nil
+}
 
-	sg := new(big.Int).Mul(s, publicKey.g)
-	sg.Mod(sg, publicKey.p)
+/*
+s = r + c*x mod q for the nonce r with the encoded commitment R = g^r computed ahead of time
+*/
+func signWithCommitmentTo(dst *Signature, tag, m string, sk *SignatureKey, r *big.Int, R []byte, sc *modp.Scratch) {
+	q := sk.group.Order()
 
-	cx := new(big.Int).Mul(c, publicKey.X)
-	rcx := new(big.Int).Add(R, cx)
-	rcx.Mod(rcx, publicKey.p)
+	// c = H(tag||R||m) reduced modulo group order
+	c := sc.Challenge(tag, R, m, q)
 
-	// sg == R + cX
-	if sg.Cmp(rcx) == 0 {
-		fmt.Println("Signature received from Signer by User is valid!")
-	} else {
-		fmt.Println("Signature received from Signer by User is invalid!")
-		return
+	if dst.s == nil {
+		dst.s = new(big.Int)
 	}
+	dst.R = append(dst.R[:0], R...)
+	sc.Response(dst.s, r, c, sk.x, q)
+}
 
-	// s' = (s + a)modp
-	sp := new(big.Int).Add(s, a)
-	sp.Mod(sp, publicKey.p)
+/*
+Use to verify signature correctness. Following condition needs to be checked:
+g^s = R * X^c  (s*G = R + c*X on curves)
+where:
+s - signature
+g - group generator
+R - g^r
+c - H(R||m) - challenge, see verifier.Challenge()
+X - public key
 
-	// User signature {R', s'}
-	userSignature := &Signature{RP, sp}
+Verification itself is implemented by the verifier package. nil or malformed
+keys and signatures with components out of range (see Signature.Validate) are
+rejected, never computed on.
 
-	if VerifySignature(message, userSignature, publicKey) {
-		fmt.Println("Signature created by User is valid!")
-	} else {
-		fmt.Println("Signature created by User is invalid!")
-	}
+The key expiry (NotAfter) is NOT checked: a signature carries no creation
+time, so signatures of an expired key keep verifying. Verifiers enforcing
+expiry use VerifySignatureAt or FastVerifier.
+*/
+func VerifySignature(message string, signature *Signature, publicKey *PublicKey) bool {
+	return verifier.Verify(message, signature.verifier(), publicKey.verifier())
 }
 
 /*
-Return the SHA256 checksum of the given string
+Challenge c of a signature of m by the key with the encoded nonce R, the c
+of VerifySignature (environment tag and context included), for protocols and
+analysis tools built on the verification equation
 */
-func hash(s string) [32]byte {
-	return sha256.Sum256([]byte(s))
+func Challenge(R []byte, m string, pk *PublicKey) *big.Int {
+	return pk.challenge(R, m)
 }
 
 /*
-Generate multipliactive group G of order p with generator g.
-Definitely could be done better.
+Challenge c = H(tag||R||m) of the key's signatures, see verifier.TaggedChallenge()
 */
-func generateMultiplicativeGroup(bits int) (*big.Int, *big.Int) {
-	// Generate random 256bit prime number p
-	p, err := rand.Prime(rand.Reader, bits)
-	if err != nil {
-		panic(err)
-	}
+func (pk *PublicKey) challenge(R []byte, m string) *big.Int {
+	return verifier.TaggedChallenge(pk.tag(), R, m, pk.group.Order())
+}
 
-	// Select group generator
-	g := big.NewInt(2)
-	for {
-		if g.Exp(g, p, p).Cmp(g) == 0 {
-			break
-		}
-		g.Add(g, big.NewInt(1))
-	}
+func (sk *SignatureKey) challenge(R []byte, m string) *big.Int {
+	return verifier.TaggedChallenge(sk.tag(""), R, m, sk.group.Order())
+}
 
-	return p, g
+/*
+Fiat-Shamir challenge c = H(R||m) reduced modulo group order, see verifier.Challenge()
+*/
+func challenge(R []byte, m string, q *big.Int) *big.Int {
+	return verifier.Challenge(R, m, q)
 }
@@ -0,0 +1,245 @@
+package schnorr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Power-on self-tests
+
+RunSelfTests runs known-answer tests of deterministic signing in every built-in
+group of the build, pairwise tests of the protocols (half-aggregation, blind
+signing when built in) and batch verification with every configured backend,
+and returns a report. A service calls it at startup and refuses to serve if anything failed:
+
+	if report := schnorr.RunSelfTests(); !report.Passed() {
+		log.Fatal(report.Err())
+	}
+
+Other packages and plugged-in backends add their tests with RegisterSelfTest.
+*/
+
+var ErrSelfTest = errors.New("schnorr: self-test failed")
+
+type SelfTestResult struct {
+	Name     string
+	Err      error // nil if the test passed
+	Duration time.Duration
+}
+
+type SelfTestReport struct {
+	Started  time.Time
+	Duration time.Duration
+	Results  []SelfTestResult
+}
+
+func (r *SelfTestReport) Passed() bool {
+	return r.Err() == nil
+}
+
+/*
+Failures wrapped in ErrSelfTest, nil if all tests passed
+*/
+func (r *SelfTestReport) Err() error {
+	var errs []error
+	for _, result := range r.Results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrSelfTest, result.Name, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *SelfTestReport) String() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		status := "ok"
+		if result.Err != nil {
+			status = "FAIL: " + result.Err.Error()
+		}
+		fmt.Fprintf(&b, "%-24s %-10s %s\n", result.Name, result.Duration.Round(time.Microsecond), status)
+	}
+	return b.String()
+}
+
+var selfTests = struct {
+	sync.RWMutex
+	tests map[string]func() error
+}{tests: make(map[string]func() error)}
+
+/*
+Add a test to RunSelfTests, e.g. a known-answer test of a batch backend;
+a test registered under an existing name replaces it
+*/
+func RegisterSelfTest(name string, test func() error) {
+	selfTests.Lock()
+	defer selfTests.Unlock()
+	selfTests.tests[name] = test
+}
+
+func RunSelfTests() *SelfTestReport {
+	report := &SelfTestReport{Started: Now()}
+	run := func(name string, test func() error) {
+		start := time.Now()
+		err := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			return test()
+		}()
+		report.Results = append(report.Results, SelfTestResult{name, err, time.Since(start)})
+	}
+
+	for _, kat := range signKATs {
+		kat := kat
+		if _, ok := group.Builtin(kat.params); ok {
+			run("sign/"+kat.name, kat.run)
+		}
+	}
+	backends := []BatchVerifierBackend{CPUBatchBackend{}}
+	if backend := defaultBatchBackend(); backend.Name() != backends[0].Name() {
+		backends = append(backends, backend)
+	}
+	for _, backend := range backends {
+		backend := backend
+		run("batch/"+backend.Name(), func() error { return selfTestBatch(backend) })
+	}
+
+	selfTests.RLock()
+	names := make([]string, 0, len(selfTests.tests))
+	for name := range selfTests.tests {
+		names = append(names, name)
+	}
+	tests := make([]func() error, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		tests[i] = selfTests.tests[name]
+	}
+	selfTests.RUnlock()
+	for i, name := range names {
+		run(name, tests[i])
+	}
+
+	report.Duration = Now().Sub(report.Started)
+	return report
+}
+
+const selfTestMessage = "schnorr/selftest"
+
+/*
+Scalar of the known-answer tests, reduced modulo the order
+*/
+func selfTestScalar(label string, order *big.Int) *big.Int {
+	sum := sha256.Sum256([]byte(selfTestMessage + "/" + label))
+	x := new(big.Int).SetBytes(sum[:])
+	x.Mod(x, new(big.Int).Sub(order, big.NewInt(1)))
+	return x.Add(x, big.NewInt(1))
+}
+
+var errKnownAnswer = errors.New("result differs from the known answer")
+
+/*
+Deterministic signature with the built-in groups, SHA-256 of Signature.Bytes
+*/
+type signKAT struct {
+	name     string
+	params   uint16
+	expected string
+}
+
+var signKATs = []signKAT{
+	{"modp-2048", ParamsMODP2048, "e90684a9443949032ce56a684c7e34aeeb1eca15084e5e186c0d9ad0b30b5dcc"},
+	{"secp256k1", ParamsSecp256k1, "c132fbfe55db696ae99227150d6be1e443f572d80984acd627e58fa71070a5c3"},
+	{"p-256", ParamsP256, "73d4ecaaa82e29ea2ca3aca04c94340f420d4e4cf3406fe2561589266f43d2d7"},
+}
+
+func (kat signKAT) run() error {
+	g, err := LookupGroup(kat.params)
+	if err != nil {
+		return err
+	}
+	sk, pk, err := newKeyPairIn(g, selfTestScalar(kat.name, g.Order()), 0, "")
+	if err != nil {
+		return err
+	}
+	signature, err := TrySign(selfTestMessage, sk)
+	if err != nil {
+		return err
+	}
+	if err := checkKnownAnswer(signature.Bytes(), kat.expected); err != nil {
+		return err
+	}
+	return checkVerify(
+		VerifySignature(selfTestMessage, signature, pk),
+		VerifySignature(selfTestMessage+"!", signature, pk))
+}
+
+/*
+The backend has to accept a valid batch and reject a batch with one wrong signature
+*/
+func selfTestBatch(backend BatchVerifierBackend) error {
+	sk, pk, err := GenerateKeysWithParamsID(selfTestParams())
+	if err != nil {
+		return err
+	}
+	entries := make([]BatchEntry, 4)
+	for i := range entries {
+		m := fmt.Sprintf("%s/%d", selfTestMessage, i)
+		signature, err := TrySign(m, sk)
+		if err != nil {
+			return err
+		}
+		R, err := pk.group.Decode(signature.R)
+		if err != nil {
+			return err
+		}
+		entries[i] = BatchEntry{Group: pk.group, X: pk.X, R: R, S: signature.s, C: challenge(signature.R, m, pk.group.Order())}
+	}
+	valid, err := backend.VerifyBatch(entries)
+	if err != nil {
+		return err
+	}
+	entries[2].S = new(big.Int).Add(entries[2].S, big.NewInt(1))
+	forged, _ := backend.VerifyBatch(entries)
+	return checkVerify(valid, forged)
+}
+
+/*
+Group of the pairwise tests, P256 unless a minimal build left it out
+*/
+func selfTestParams() uint16 {
+	if _, ok := group.Builtin(ParamsP256); ok {
+		return ParamsP256
+	}
+	return ParamsMODP2048
+}
+
+func checkKnownAnswer(result []byte, expected string) error {
+	digest := sha256.Sum256(result)
+	if got := hex.EncodeToString(digest[:]); got != expected {
+		return fmt.Errorf("%w: SHA-256 %s", errKnownAnswer, got)
+	}
+	return nil
+}
+
+func checkVerify(valid, forged bool) error {
+	switch {
+	case !valid:
+		return errors.New("valid signature rejected")
+	case forged:
+		return errors.New("invalid signature accepted")
+	}
+	return nil
+}
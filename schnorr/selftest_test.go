@@ -0,0 +1,37 @@
+package schnorr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+/*
+The known answers follow the nonce derivation and the challenge, a change to
+either has to update them
+*/
+func TestSelfTests(t *testing.T) {
+	report := RunSelfTests()
+	if !report.Passed() {
+		t.Fatalf("self-tests failed:\n%s", report)
+	}
+	for _, kat := range signKATs {
+		if _, err := LookupGroup(kat.params); err == nil && !strings.Contains(report.String(), "sign/"+kat.name) {
+			t.Errorf("known-answer test %s didn't run", kat.name)
+		}
+	}
+}
+
+func TestSelfTestFailure(t *testing.T) {
+	RegisterSelfTest("test/failing", func() error { return errors.New("broken") })
+	t.Cleanup(func() {
+		selfTests.Lock()
+		delete(selfTests.tests, "test/failing")
+		selfTests.Unlock()
+	})
+
+	report := RunSelfTests()
+	if report.Passed() || !errors.Is(report.Err(), ErrSelfTest) {
+		t.Fatalf("failing test passed: %v", report.Err())
+	}
+}
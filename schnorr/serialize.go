@@ -0,0 +1,301 @@
+package schnorr
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+/*
+Serialization of keys and signatures
+
+Every artifact has three interchangeable encodings:
+
+  - binary (Bytes / Parse*), the compact format used by the rest of the package,
+  - DER (MarshalDER / Parse*DER), ASN.1 structures for tooling which expects them,
+  - PEM (MarshalPEM / Parse*PEM) wrapping the DER for files,
+
+and hex of the binary encoding (Hex / Parse*Hex) for logs and config values.
+
+	SchnorrPublicKey  ::= SEQUENCE { group OCTET STRING, X OCTET STRING, notAfter INTEGER, environment UTF8String OPTIONAL }
+	SchnorrPrivateKey ::= SEQUENCE { version INTEGER (2), group OCTET STRING, x INTEGER, notAfter INTEGER, environment UTF8String OPTIONAL }
+	SchnorrSignature  ::= SEQUENCE { R OCTET STRING, s INTEGER }
+
+group is the group as in the binary public key encoding (the ID of a built-in
+group or the parameters of a mod p group, see PublicKey.Bytes), X and R are
+elements encoded by the group. notAfter is the unix time of the key expiry, 0
+if the key never expires.
+environment is the tag of the key (see TagEnvironment), absent for untagged keys.
+Private keys are written unencrypted, files holding them have to be protected.
+*/
+
+/*
+PEM block types
+*/
+const (
+	PEMPublicKey  = "SCHNORR PUBLIC KEY"
+	PEMPrivateKey = "SCHNORR PRIVATE KEY"
+	PEMSignature  = "SCHNORR SIGNATURE"
+)
+
+/*
+Version byte of the binary private key encoding, it keeps private keys
+from being parsed as public keys. Version 1 keys of the withdrawn additive
+scheme are rejected.
+*/
+const privateKeyVersion = 2
+
+type derPublicKey struct {
+	Group       []byte
+	X           []byte
+	NotAfter    int64
+	Environment string `asn1:"optional,utf8"`
+}
+
+type derPrivateKey struct {
+	Version     int
+	Group       []byte
+	X           *big.Int
+	NotAfter    int64
+	Environment string `asn1:"optional,utf8"`
+}
+
+type derSignature struct {
+	R []byte
+	S *big.Int
+}
+
+/*
+Binary encoding of the private key: version||group||len(x)||x||notAfter[||len(env)||env]
+with the group as in PublicKey.Bytes
+*/
+func (sk *SignatureKey) Bytes() []byte {
+	buf, err := group.AppendGroup([]byte{privateKeyVersion}, sk.group)
+	if err != nil {
+		return nil
+	}
+	buf = appendInts(buf, sk.x)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(unixOrZero(sk.notAfter)))
+	return appendEnvironment(buf, sk.environment)
+}
+
+/*
+Parse private key encoded with SignatureKey.Bytes, the public key is derived from it
+*/
+func ParseSignatureKey(b []byte) (*SignatureKey, *PublicKey, error) {
+	if len(b) < 1+8 || b[0] != privateKeyVersion {
+		return nil, nil, ErrInvalidEncoding
+	}
+	g, rest, err := group.ReadGroup(b[1:])
+	if err != nil {
+		return nil, nil, ErrInvalidEncoding
+	}
+	ints, rest, err := splitInts(rest, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) < 8 {
+		return nil, nil, ErrInvalidEncoding
+	}
+	environment, err := verifier.ParseEnvironment(rest[8:])
+	if err != nil {
+		return nil, nil, ErrInvalidEncoding
+	}
+	return newKeyPairIn(g, ints[0], int64(binary.BigEndian.Uint64(rest)), environment)
+}
+
+func (sk *SignatureKey) MarshalDER() ([]byte, error) {
+	g, err := group.AppendGroup(nil, sk.group)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(derPrivateKey{privateKeyVersion, g, sk.x, unixOrZero(sk.notAfter), sk.environment})
+}
+
+func ParseSignatureKeyDER(der []byte) (*SignatureKey, *PublicKey, error) {
+	var key derPrivateKey
+	if rest, err := asn1.Unmarshal(der, &key); err != nil || len(rest) != 0 || key.Version != privateKeyVersion {
+		return nil, nil, ErrInvalidEncoding
+	}
+	if key.Environment != "" && verifier.ValidateEnvironment(key.Environment) != nil {
+		return nil, nil, ErrInvalidEncoding
+	}
+	g, rest, err := group.ReadGroup(key.Group)
+	if err != nil || len(rest) != 0 {
+		return nil, nil, ErrInvalidEncoding
+	}
+	return newKeyPairIn(g, key.X, key.NotAfter, key.Environment)
+}
+
+func (sk *SignatureKey) MarshalPEM() ([]byte, error) {
+	der, err := sk.MarshalDER()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMPrivateKey, Bytes: der}), nil
+}
+
+func ParseSignatureKeyPEM(data []byte) (*SignatureKey, *PublicKey, error) {
+	der, err := pemBlock(data, PEMPrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ParseSignatureKeyDER(der)
+}
+
+func (sk *SignatureKey) Hex() string {
+	return hex.EncodeToString(sk.Bytes())
+}
+
+func ParseSignatureKeyHex(s string) (*SignatureKey, *PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, nil, ErrInvalidEncoding
+	}
+	return ParseSignatureKey(b)
+}
+
+func (pk *PublicKey) MarshalDER() ([]byte, error) {
+	g, err := group.AppendGroup(nil, pk.group)
+	if err != nil {
+		return nil, err
+	}
+	X, err := pk.group.Encode(pk.X)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(derPublicKey{g, X, unixOrZero(pk.notAfter), pk.environment})
+}
+
+func ParsePublicKeyDER(der []byte) (*PublicKey, error) {
+	var key derPublicKey
+	if rest, err := asn1.Unmarshal(der, &key); err != nil || len(rest) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	if key.Environment != "" && verifier.ValidateEnvironment(key.Environment) != nil {
+		return nil, ErrInvalidEncoding
+	}
+	g, rest, err := group.ReadGroup(key.Group)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	X, err := g.Decode(key.X)
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return &PublicKey{group: g, X: X, notAfter: timeOrZero(key.NotAfter), environment: key.Environment}, nil
+}
+
+func (pk *PublicKey) MarshalPEM() ([]byte, error) {
+	der, err := pk.MarshalDER()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMPublicKey, Bytes: der}), nil
+}
+
+func ParsePublicKeyPEM(data []byte) (*PublicKey, error) {
+	der, err := pemBlock(data, PEMPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKeyDER(der)
+}
+
+func (pk *PublicKey) Hex() string {
+	return hex.EncodeToString(pk.Bytes())
+}
+
+func ParsePublicKeyHex(s string) (*PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return ParsePublicKey(b)
+}
+
+func (S Signature) MarshalDER() ([]byte, error) {
+	return asn1.Marshal(derSignature{S.R, S.s})
+}
+
+func ParseSignatureDER(der []byte) (*Signature, error) {
+	var signature derSignature
+	if rest, err := asn1.Unmarshal(der, &signature); err != nil || len(rest) != 0 ||
+		len(signature.R) == 0 || signature.S.Sign() < 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return &Signature{signature.R, signature.S}, nil
+}
+
+func (S Signature) MarshalPEM() ([]byte, error) {
+	der, err := S.MarshalDER()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMSignature, Bytes: der}), nil
+}
+
+func ParseSignaturePEM(data []byte) (*Signature, error) {
+	der, err := pemBlock(data, PEMSignature)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSignatureDER(der)
+}
+
+func (S Signature) Hex() string {
+	return hex.EncodeToString(S.Bytes())
+}
+
+func ParseSignatureHex(s string) (*Signature, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return ParseSignature(b)
+}
+
+/*
+Check the decoded private key and derive its public key, tagged with the environment
+*/
+func newKeyPairIn(g Group, x *big.Int, notAfter int64, environment string) (*SignatureKey, *PublicKey, error) {
+	if x.Sign() <= 0 || x.Cmp(g.Order()) >= 0 {
+		return nil, nil, ErrInvalidEncoding
+	}
+	sk, pk, err := newKeys(g, x)
+	if err != nil {
+		return nil, nil, ErrInvalidEncoding
+	}
+	sk.notAfter, pk.notAfter = timeOrZero(notAfter), timeOrZero(notAfter)
+	sk.environment, pk.environment = environment, environment
+	return sk, pk, nil
+}
+
+func pemBlock(data []byte, blockType string) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, ErrInvalidEncoding
+	}
+	return block.Bytes, nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func timeOrZero(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0)
+}
@@ -0,0 +1,262 @@
+//go:build !schnorr_minimal || schnorr_threshold || schnorr_crossinput || schnorr_frost
+
+package schnorr
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+)
+
+/*
+Conversion between Shamir and additive sharing
+
+Shamir shares (RecoveryShare) need Lagrange interpolation within the chosen
+set of shareholders, MPC tooling usually expects additive shares z_i with
+sum(z_i) = x instead. Any t shareholders convert locally, without interaction:
+
+	z_i = l_i(0) * y_i mod q
+
+where l_i is the Lagrange coefficient of the shareholder within the set. The
+additive shares are only valid for exactly that set.
+
+The way back is a resharing: every additive shareholder deals a fresh Shamir
+sharing of its z_i (Reshare) and every recipient sums the sub-shares it
+receives (CombineSubShares). The new Shamir shares are of the same key x, with
+a new polynomial and possibly a new threshold and number of shareholders.
+*/
+
+var (
+	ErrShareSet      = errors.New("schnorr: invalid set of shareholders for share conversion")
+	ErrSubShares     = errors.New("schnorr: sub-shares don't belong to the same resharing")
+	ErrPublicShares  = errors.New("schnorr: public shares don't sum to the public key")
+	ErrShareMismatch = errors.New("schnorr: shares belong to different keys or groups")
+)
+
+/*
+Additive share of the private key: sum of the shares of all Parties is x
+*/
+type AdditiveShare struct {
+	OwnerKeyID string
+	Index      int64   // index of the Shamir share it was converted from
+	Parties    []int64 // indexes of all holders of the sharing, sorted
+	z          *big.Int
+	group      Group
+}
+
+/*
+Shamir share of an additive share, dealt by From to the recipient To
+*/
+type SubShare struct {
+	OwnerKeyID string
+	From       int64
+	To         int64
+	Threshold  int
+	Dealers    []int64 // all additive shareholders taking part in the resharing, sorted
+	y          *big.Int
+	group      Group
+}
+
+/*
+Convert the Shamir share into an additive share for the set of shareholders
+given by their indexes, the set has to contain the share and at least t indexes
+*/
+func (s *RecoveryShare) ToAdditive(indexes []int64) (*AdditiveShare, error) {
+	parties, err := shareSet(indexes)
+	if err != nil {
+		return nil, err
+	}
+	member := false
+	for _, index := range parties {
+		member = member || index == s.Index
+	}
+	if !member || len(parties) < s.Threshold {
+		return nil, ErrShareSet
+	}
+
+	q := s.group.Order()
+	z := lagrangeAtZero(s.Index, parties, q)
+	z.Mul(z, s.y)
+	return &AdditiveShare{s.OwnerKeyID, s.Index, parties, z.Mod(z, q), s.group}, nil
+}
+
+/*
+Value of the share, sum of the values of all parties modulo the group order is the private key
+*/
+func (a *AdditiveShare) Scalar() *big.Int {
+	return new(big.Int).Set(a.z)
+}
+
+/*
+Group order the share values are reduced modulo
+*/
+func (a *AdditiveShare) Modulus() *big.Int {
+	return new(big.Int).Set(a.group.Order())
+}
+
+/*
+Z_i = g^z_i, the public shares of all parties combine to the public key
+*/
+func (a *AdditiveShare) PublicShare() Element {
+	return a.group.ScalarBaseMult(a.z)
+}
+
+/*
+Check that the public shares of an additive sharing combine to the public key
+*/
+func CheckPublicShares(pk *PublicKey, publicShares []Element) error {
+	if len(publicShares) == 0 {
+		return ErrPublicShares
+	}
+	X := publicShares[0]
+	for _, Z := range publicShares[1:] {
+		X = pk.group.Add(X, Z)
+	}
+	if !pk.group.Equal(X, pk.X) {
+		return ErrPublicShares
+	}
+	return nil
+}
+
+/*
+Deal Shamir sharing (threshold t) of the additive share to recipients 1..n
+*/
+func (a *AdditiveShare) Reshare(t, n int) ([]*SubShare, error) {
+	if t < 1 || t > n {
+		return nil, ErrInvalidThreshold
+	}
+
+	coefficients, err := randomScalars(a.group.Order(), t)
+	if err != nil {
+		return nil, err
+	}
+	coefficients[0] = a.z
+
+	subShares := make([]*SubShare, n)
+	for i := range subShares {
+		to := int64(i + 1)
+		subShares[i] = &SubShare{a.OwnerKeyID, a.Index, to, t, a.Parties, evalPolynomial(coefficients, big.NewInt(to), a.group.Order()), a.group}
+	}
+	return subShares, nil
+}
+
+/*
+Sum the sub-shares dealt to one recipient by all additive shareholders
+into its new Shamir share
+*/
+func CombineSubShares(subShares []*SubShare) (*RecoveryShare, error) {
+	if len(subShares) == 0 {
+		return nil, ErrSubShares
+	}
+	first := subShares[0]
+	if len(subShares) != len(first.Dealers) {
+		return nil, ErrSubShares
+	}
+
+	dealt := make(map[int64]bool, len(subShares))
+	y := new(big.Int)
+	for _, sub := range subShares {
+		if sub.OwnerKeyID != first.OwnerKeyID || sub.To != first.To || sub.Threshold != first.Threshold ||
+			!equalIndexes(sub.Dealers, first.Dealers) || dealt[sub.From] {
+			return nil, ErrSubShares
+		}
+		if !group.Same(sub.group, first.group) {
+			return nil, ErrShareMismatch
+		}
+		dealt[sub.From] = true
+		y.Add(y, sub.y)
+	}
+	for _, dealer := range first.Dealers {
+		if !dealt[dealer] {
+			return nil, ErrSubShares
+		}
+	}
+
+	return &RecoveryShare{first.OwnerKeyID, first.Threshold, first.To, y.Mod(y, first.group.Order()), first.group}, nil
+}
+
+/*
+Encoding: len(keyID)||keyID||index||count||parties...||group||len(z)||z
+*/
+func (a *AdditiveShare) Bytes() []byte {
+	buf := appendBytes(nil, []byte(a.OwnerKeyID))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(a.Index))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(a.Parties)))
+	for _, party := range a.Parties {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(party))
+	}
+	buf, err := group.AppendGroup(buf, a.group)
+	if err != nil {
+		return nil
+	}
+	return appendInts(buf, a.z)
+}
+
+func ParseAdditiveShare(b []byte) (*AdditiveShare, error) {
+	if len(b) < 4 {
+		return nil, ErrInvalidEncoding
+	}
+	n := int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if len(b) < n+12 {
+		return nil, ErrInvalidEncoding
+	}
+	keyID := string(b[:n])
+	b = b[n:]
+	index := int64(binary.BigEndian.Uint64(b))
+	count := int(binary.BigEndian.Uint32(b[8:]))
+	b = b[12:]
+	if count < 1 || len(b)/8 < count {
+		return nil, ErrInvalidEncoding
+	}
+	parties := make([]int64, count)
+	for i := range parties {
+		parties[i] = int64(binary.BigEndian.Uint64(b))
+		b = b[8:]
+	}
+	if sorted, err := shareSet(parties); err != nil || !equalIndexes(sorted, parties) {
+		return nil, ErrInvalidEncoding
+	}
+
+	g, rest, err := group.ReadGroup(b)
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	ints, err := readInts(rest, 1)
+	if err != nil {
+		return nil, err
+	}
+	if ints[0].Cmp(g.Order()) >= 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return &AdditiveShare{keyID, index, parties, ints[0], g}, nil
+}
+
+/*
+Sorted copy of the indexes, which have to be positive and distinct
+*/
+func shareSet(indexes []int64) ([]int64, error) {
+	set := append([]int64(nil), indexes...)
+	sort.Slice(set, func(i, j int) bool { return set[i] < set[j] })
+	for i, index := range set {
+		if index <= 0 || (i > 0 && set[i-1] == index) {
+			return nil, ErrShareSet
+		}
+	}
+	return set, nil
+}
+
+func equalIndexes(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
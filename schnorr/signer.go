@@ -0,0 +1,139 @@
+package schnorr
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/verifier"
+)
+
+/*
+crypto.Signer interoperability
+
+SignatureKey implements crypto.Signer, so it can be used by code written
+against the standard library interfaces:
+
+	var signer crypto.Signer = sk
+	digest := sha256.Sum256(data)
+	signature, err := signer.Sign(rand.Reader, digest[:], &schnorr.SignerOpts{Hash: crypto.SHA256})
+	ok := schnorr.VerifySigned(pk, digest[:], signature, &schnorr.SignerOpts{Hash: crypto.SHA256})
+
+The digest is signed in a context naming the hash and the optional tag
+("schnorr/digest/" || hash || ":" || tag, at most 255 bytes), so a signature
+made for one hash function or application never verifies for another.
+SHA-256 digests without a tag are signed in StreamContext, signatures are
+interchangeable with SignReader/VerifyReader. crypto.Hash(0) signs the input
+as is, like SignBytes (as ed25519 does).
+
+rand is used as the auxiliary randomness of the nonce (SignWithAux), nil rand
+gives the deterministic signature. The result is encoded with Signature.Bytes.
+*/
+
+var ErrDigestLength = errors.New("schnorr: digest length doesn't match the hash function")
+
+/*
+Options of SignatureKey.Sign, implements crypto.SignerOpts
+*/
+type SignerOpts struct {
+	Hash crypto.Hash // hash function the digest was computed with, 0 for unhashed messages
+	Tag  string      // application tag, separates signatures of different uses of the key
+}
+
+func (o *SignerOpts) HashFunc() crypto.Hash {
+	return o.Hash
+}
+
+/*
+Public key of the signature key, *PublicKey (see PublicKey for the checked variant)
+*/
+func (sk *SignatureKey) Public() crypto.PublicKey {
+	X := sk.pub
+	if X == nil {
+		X = sk.group.ScalarBaseMult(sk.x)
+	}
+	return &PublicKey{group: sk.group, X: X, notAfter: sk.notAfter, environment: sk.environment}
+}
+
+/*
+Sign the digest, see the crypto.Signer notes above. opts may be a *SignerOpts
+or any other crypto.SignerOpts (then without a tag).
+*/
+func (sk *SignatureKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	context, err := signerContext(digest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var aux []byte
+	if rand != nil {
+		aux = make([]byte, 32)
+		if _, err := io.ReadFull(rand, aux); err != nil {
+			return nil, err
+		}
+	}
+	signature, err := signInContext(context, string(digest), sk, aux)
+	if err != nil {
+		return nil, err
+	}
+	return signature.Bytes(), nil
+}
+
+/*
+Verify signature made by SignatureKey.Sign
+*/
+func VerifySigned(pk *PublicKey, digest, signature []byte, opts crypto.SignerOpts) bool {
+	context, err := signerContext(digest, opts)
+	if err != nil {
+		return false
+	}
+	sig, err := ParseSignature(signature)
+	if err != nil {
+		return false
+	}
+	return VerifySignature(string(digest), sig, pk.WithContext(context))
+}
+
+/*
+Keys are equal if they have the same group and value (expiry isn't compared),
+as the Equal methods of the standard library keys
+*/
+func (pk *PublicKey) Equal(x crypto.PublicKey) bool {
+	other, ok := x.(*PublicKey)
+	return ok && group.Same(pk.group, other.group) && pk.group.Equal(pk.X, other.X)
+}
+
+/*
+Signing context of the digest, see the crypto.Signer notes above
+*/
+func signerContext(digest []byte, opts crypto.SignerOpts) (string, error) {
+	var hash crypto.Hash
+	var tag string
+	if opts != nil {
+		hash = opts.HashFunc()
+	}
+	if o, ok := opts.(*SignerOpts); ok && o != nil {
+		tag = o.Tag
+	}
+
+	if hash == 0 && tag == "" {
+		return "", nil
+	}
+	name := "none"
+	if hash != 0 {
+		// String of hash values unknown to the crypto package, whose Size panics
+		if name = strings.ToLower(hash.String()); strings.HasPrefix(name, "unknown") || len(digest) != hash.Size() {
+			return "", ErrDigestLength
+		}
+	}
+	if hash == crypto.SHA256 && tag == "" {
+		return StreamContext, nil
+	}
+	context := "schnorr/digest/" + name + ":" + tag
+	if len(context) > verifier.MaxContextLength {
+		return "", ErrInvalidContext
+	}
+	return context, nil
+}
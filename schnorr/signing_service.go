@@ -0,0 +1,228 @@
+package schnorr
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+/*
+Signing service with a precomputed nonce pool
+
+The nonce commitment R = g^r doesn't depend on the message, so a server can
+compute nonce pairs (r, R) in the background and spend only the challenge and
+s = (r + cx)modq on the request path. SigningService keeps a pool of such pairs
+filled by worker goroutines and serves Sign from any number of goroutines.
+
+Every pair is received from the pool exactly once (a channel hands each value
+to a single receiver) and wiped after use, so a nonce is never reused. Pool
+nonces are random, not derived from the message as in Sign, so signatures by
+the service are randomized. When the pool runs dry Sign computes a fresh nonce
+on demand instead of waiting, counted as a miss in ServiceStats.
+
+Pooled nonces are secret key material held in memory ahead of time: anyone
+who reads the pool and one signature made with a pooled nonce learns the
+private key. Close wipes the pool.
+*/
+
+var ErrServiceClosed = errors.New("schnorr: signing service closed")
+
+/*
+Options of NewSigningService, zero values select the defaults
+*/
+type SigningServiceOptions struct {
+	PoolSize int // number of precomputed nonces, default 1024
+	Workers  int // refilling goroutines, default 1
+
+	// Called by Sign whenever it leaves LowWater nonces (default PoolSize / 4)
+	// or less in the pool, e.g. to alert or add capacity; called concurrently
+	// and must not block
+	LowWater   int
+	OnLowWater func(ServiceStats)
+}
+
+/*
+Pool metrics
+*/
+type ServiceStats struct {
+	PoolSize   int           // capacity of the pool
+	Available  int           // precomputed nonces in the pool
+	Generated  uint64        // nonces generated by the workers
+	Served     uint64        // signatures made
+	Misses     uint64        // signatures made with an on-demand nonce because the pool was empty
+	Uptime     time.Duration // time since the service was started
+	RefillRate float64       // nonces generated per second, averaged over the uptime
+}
+
+type pooledNonce struct {
+	r *big.Int
+	R []byte // encoded commitment g^r
+}
+
+type SigningService struct {
+	sk      *SignatureKey
+	opts    SigningServiceOptions
+	pool    chan pooledNonce
+	started time.Time
+
+	generated atomic.Uint64
+	served    atomic.Uint64
+	misses    atomic.Uint64
+
+	stop   chan struct{}
+	closed atomic.Bool
+	wg     sync.WaitGroup
+}
+
+/*
+Start the service and its workers, the pool fills in the background
+*/
+func NewSigningService(sk *SignatureKey, opts SigningServiceOptions) *SigningService {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 1024
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.LowWater <= 0 {
+		opts.LowWater = opts.PoolSize / 4
+	}
+
+	s := &SigningService{
+		sk:      sk,
+		opts:    opts,
+		pool:    make(chan pooledNonce, opts.PoolSize),
+		started: Now(),
+		stop:    make(chan struct{}),
+	}
+	s.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go s.refill()
+	}
+	return s
+}
+
+/*
+Sign m with a nonce from the pool, safe for concurrent use
+*/
+func (s *SigningService) Sign(m string) (*Signature, error) {
+	if s.closed.Load() {
+		return nil, ErrServiceClosed
+	}
+	if err := s.sk.checkExpiry(Now()); err != nil {
+		return nil, err
+	}
+	if s.sk.x.Sign() == 0 {
+		return nil, ErrKeyZeroized
+	}
+	if err := checkEntropy(); err != nil {
+		return nil, err
+	}
+
+	var nonce pooledNonce
+	select {
+	case nonce = <-s.pool:
+	default:
+		s.misses.Add(1)
+		var err error
+		if nonce, err = s.nonce(); err != nil {
+			return nil, err
+		}
+	}
+	if s.opts.OnLowWater != nil && len(s.pool) <= s.opts.LowWater {
+		s.opts.OnLowWater(s.Stats())
+	}
+
+	signature := signWithCommitment(m, s.sk, nonce.r, nonce.R)
+	modp.Wipe(nonce.r)
+	if signature == nil {
+		return nil, ErrInvalidKey
+	}
+	s.served.Add(1)
+	return signature, nil
+}
+
+func (s *SigningService) Stats() ServiceStats {
+	uptime := time.Since(s.started)
+	generated := s.generated.Load()
+	return ServiceStats{
+		PoolSize:   s.opts.PoolSize,
+		Available:  len(s.pool),
+		Generated:  generated,
+		Served:     s.served.Load(),
+		Misses:     s.misses.Load(),
+		Uptime:     uptime,
+		RefillRate: float64(generated) / uptime.Seconds(),
+	}
+}
+
+/*
+Stop the workers and wipe the pooled nonces. Sign fails after Close.
+*/
+func (s *SigningService) Close() {
+	if s.closed.Swap(true) {
+		return
+	}
+	close(s.stop)
+	s.wg.Wait()
+	for {
+		select {
+		case nonce := <-s.pool:
+			modp.Wipe(nonce.r)
+		default:
+			return
+		}
+	}
+}
+
+func (s *SigningService) refill() {
+	defer s.wg.Done()
+	for {
+		nonce, err := s.nonce()
+		if err != nil {
+			// the health tested source stays failed, Sign returns its error
+			// once the pool runs dry
+			return
+		}
+		select {
+		case s.pool <- nonce:
+			s.generated.Add(1)
+		case <-s.stop:
+			modp.Wipe(nonce.r)
+			return
+		}
+	}
+}
+
+/*
+Random nonce r in [1, q) and R = g^r
+*/
+func (s *SigningService) nonce() (pooledNonce, error) {
+	g := s.sk.group
+	r, err := randomScalar(g.Order())
+	if err != nil {
+		return pooledNonce{}, err
+	}
+	R, _ := g.Encode(g.ScalarBaseMult(r))
+	return pooledNonce{r, R}, nil
+}
+
+/*
+Signature {R, (r + cx)modq} with the precomputed commitment R = g^r,
+nil if R couldn't be encoded
+*/
+func signWithCommitment(m string, sk *SignatureKey, r *big.Int, R []byte) *Signature {
+	if R == nil {
+		return nil
+	}
+	sc := modp.Get()
+	defer modp.Put(sc)
+
+	signature := &Signature{}
+	signWithCommitmentTo(signature, sk.tag(""), m, sk, r, R, sc)
+	return signature
+}
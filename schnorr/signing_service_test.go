@@ -0,0 +1,111 @@
+package schnorr
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSigningServiceStats(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lowWater atomic.Int32
+	service := NewSigningService(sk, SigningServiceOptions{
+		PoolSize:   8,
+		LowWater:   8, // every Sign leaves at most a full pool
+		OnLowWater: func(ServiceStats) { lowWater.Add(1) },
+	})
+	defer service.Close()
+	waitForPool(t, service)
+
+	signature, err := service.Sign("message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature("message", signature, pk) {
+		t.Fatal("signature doesn't verify")
+	}
+	stats := service.Stats()
+	if stats.PoolSize != 8 || stats.Served != 1 || stats.Misses != 0 || stats.Generated < 8 || stats.RefillRate <= 0 {
+		t.Errorf("stats %+v", stats)
+	}
+	if lowWater.Load() != 1 {
+		t.Errorf("low water hook called %d times", lowWater.Load())
+	}
+
+	// pool nonces are random, the same message gets another nonce
+	again, err := service.Sign("message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again.R) == string(signature.R) {
+		t.Error("nonce reused")
+	}
+}
+
+func TestSigningServiceZeroizedKey(t *testing.T) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewSigningService(sk, SigningServiceOptions{PoolSize: 4})
+	defer service.Close()
+	sk.Zeroize()
+	if _, err := service.Sign("message"); err != ErrKeyZeroized {
+		t.Fatalf("Sign with a zeroized key: %v", err)
+	}
+}
+
+/*
+Pooled against on-demand nonces with parallel signers, the pool is full at
+the start as on a server after warm-up. Run with -cpu to vary the number of
+signing goroutines.
+*/
+func BenchmarkSigningService(b *testing.B) {
+	sk, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("on-demand", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := TrySign("schnorr benchmark", sk); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		service := NewSigningService(sk, SigningServiceOptions{Workers: 2})
+		defer service.Close()
+		waitForPool(b, service)
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := service.Sign("schnorr benchmark"); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+		b.StopTimer()
+		stats := service.Stats()
+		b.ReportMetric(float64(stats.Misses)/float64(b.N), "misses/op")
+	})
+}
+
+func waitForPool(tb testing.TB, service *SigningService) {
+	tb.Helper()
+	for deadline := time.Now().Add(10 * time.Second); service.Stats().Available < service.Stats().PoolSize; {
+		if time.Now().After(deadline) {
+			tb.Fatalf("pool not filled: %+v", service.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
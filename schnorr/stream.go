@@ -0,0 +1,80 @@
+package schnorr
+
+import (
+	"crypto/sha256"
+	"io"
+)
+
+/*
+Signing binary payloads and streams
+
+SignBytes and VerifyBytes are Sign and VerifySignature for []byte messages,
+signatures of both are interchangeable.
+
+SignReader hashes its input incrementally, so files of any size can be signed
+without loading them into memory. The signed message is the SHA-256 digest
+of the stream, signed in StreamContext: the context is part of the challenge
+hash, so signatures made with SignReader have to be verified with VerifyReader
+(or VerifyDigest), neither with VerifySignature over the whole content nor
+over the digest.
+*/
+
+func SignBytes(m []byte, sk *SignatureKey) (*Signature, error) {
+	return TrySign(string(m), sk)
+}
+
+func VerifyBytes(m []byte, signature *Signature, pk *PublicKey) bool {
+	return VerifySignature(string(m), signature, pk)
+}
+
+/*
+Sign the content read from r until EOF
+*/
+func SignReader(r io.Reader, sk *SignatureKey) (*Signature, error) {
+	digest, err := streamDigest(r)
+	if err != nil {
+		return nil, err
+	}
+	return SignDigest(digest, sk)
+}
+
+/*
+Verify signature made with SignReader of the content read from r until EOF
+*/
+func VerifyReader(r io.Reader, signature *Signature, pk *PublicKey) (bool, error) {
+	digest, err := streamDigest(r)
+	if err != nil {
+		return false, err
+	}
+	return VerifyDigest(digest, signature, pk), nil
+}
+
+/*
+Sign the SHA-256 digest of the content computed by the caller, e.g. while
+the content is being uploaded. Equivalent to SignReader over the content.
+*/
+func SignDigest(digest [sha256.Size]byte, sk *SignatureKey) (*Signature, error) {
+	return signInContext(StreamContext, string(digest[:]), sk, nil)
+}
+
+func VerifyDigest(digest [sha256.Size]byte, signature *Signature, pk *PublicKey) bool {
+	return VerifySignature(string(digest[:]), signature, pk.WithContext(StreamContext))
+}
+
+/*
+SHA-256 digest of the content read from r, for protocols which sign the
+content in StreamContext (e.g. blind signing of a file, see WithContext)
+*/
+func StreamDigest(r io.Reader) ([sha256.Size]byte, error) {
+	return streamDigest(r)
+}
+
+func streamDigest(r io.Reader) ([sha256.Size]byte, error) {
+	var digest [sha256.Size]byte
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return digest, err
+	}
+	h.Sum(digest[:0])
+	return digest, nil
+}
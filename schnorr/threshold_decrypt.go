@@ -0,0 +1,191 @@
+//go:build !schnorr_minimal || schnorr_threshold || schnorr_crossinput || schnorr_frost
+
+package schnorr
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+/*
+Threshold decryption with the shares of a signature key
+
+Material escrowed to a cluster key is encrypted with hybrid ElGamal to the
+public key X = g^x and can only be decrypted by t members holding shares of x
+(SplitKey), the same members and shares which sign for the key:
+
+	Encrypt:  k random, C = g^k, K = X^k, AES-256-GCM under H(group||X||C||K)
+	Share:    D_i = C^x_i
+	Combine:  K = prod(D_i^l_i) = C^x
+
+l_i is the Lagrange coefficient of the member within the decrypting set. The
+shared secret is never computed by a single member and the private key is never
+reconstructed. Decryption with wrong or too few shares fails authentication.
+
+Decryption shares are not accompanied by proofs of correctness, a cheating
+member can make the decryption fail but not change the plaintext. Security
+rests on the Diffie-Hellman problem in the group of the key.
+*/
+
+var (
+	ErrDecryption       = errors.New("schnorr: threshold decryption failed")
+	ErrDecryptionShares = errors.New("schnorr: duplicate or missing decryption shares")
+)
+
+type ThresholdCiphertext struct {
+	C      []byte // encoding of C = g^k
+	Sealed []byte // nonce || AES-GCM ciphertext
+}
+
+type DecryptionShare struct {
+	Index int64
+	D     []byte // encoding of D_i = C^x_i
+}
+
+/*
+Encrypt plaintext to the (cluster) public key, aad is authenticated but not encrypted
+*/
+func EncryptToKey(pk *PublicKey, plaintext, aad []byte) (*ThresholdCiphertext, error) {
+	k, err := randomScalar(pk.group.Order())
+	if err != nil {
+		return nil, err
+	}
+	C, err := pk.group.Encode(pk.group.ScalarBaseMult(k))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := thresholdCipher(pk, C, pk.group.ScalarMult(pk.X, k))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(random(), nonce); err != nil {
+		return nil, err
+	}
+	return &ThresholdCiphertext{C, aead.Seal(nonce, nonce, plaintext, aad)}, nil
+}
+
+/*
+Decryption share of the shareholder, nil if C isn't an element of the group of the share
+*/
+func (s *RecoveryShare) DecryptionShare(ct *ThresholdCiphertext) *DecryptionShare {
+	C, err := s.group.Decode(ct.C)
+	if err != nil {
+		return nil
+	}
+	D, err := s.group.Encode(s.group.ScalarMult(C, s.y))
+	if err != nil {
+		return nil
+	}
+	return &DecryptionShare{s.Index, D}
+}
+
+/*
+Decryption share of the cluster member
+*/
+func (m *ClusterMember) DecryptionShare(ct *ThresholdCiphertext) *DecryptionShare {
+	return m.share.DecryptionShare(ct)
+}
+
+/*
+Combine decryption shares of at least t members and decrypt the ciphertext
+*/
+func CombineDecryptionShares(ct *ThresholdCiphertext, shares []*DecryptionShare, pk *PublicKey, aad []byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrDecryption
+	}
+	if _, err := pk.group.Decode(ct.C); err != nil {
+		return nil, ErrDecryption
+	}
+	indexes := make([]int64, len(shares))
+	seen := make(map[int64]bool, len(shares))
+	for i, share := range shares {
+		if share == nil || seen[share.Index] || share.Index <= 0 {
+			return nil, ErrDecryptionShares
+		}
+		seen[share.Index] = true
+		indexes[i] = share.Index
+	}
+
+	// K = prod(D_i^l_i)
+	var K Element
+	for _, share := range shares {
+		D, err := pk.group.Decode(share.D)
+		if err != nil {
+			return nil, ErrDecryption
+		}
+		term := pk.group.ScalarMult(D, lagrangeAtZero(share.Index, indexes, pk.group.Order()))
+		if K == nil {
+			K = term
+		} else {
+			K = pk.group.Add(K, term)
+		}
+	}
+
+	return openThreshold(ct, pk, K, aad)
+}
+
+/*
+Decrypt with the whole private key, for ciphertexts to a key which isn't split
+*/
+func DecryptWithKey(ct *ThresholdCiphertext, sk *SignatureKey, aad []byte) ([]byte, error) {
+	C, err := sk.group.Decode(ct.C)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	pk := &PublicKey{group: sk.group, X: sk.pub}
+	return openThreshold(ct, pk, sk.group.ScalarMult(C, sk.x), aad)
+}
+
+func openThreshold(ct *ThresholdCiphertext, pk *PublicKey, K Element, aad []byte) ([]byte, error) {
+	aead, err := thresholdCipher(pk, ct.C, K)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	if len(ct.Sealed) < aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+	plaintext, err := aead.Open(nil, ct.Sealed[:aead.NonceSize()], ct.Sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+/*
+Encoding: len(C)||C||len(sealed)||sealed
+*/
+func (ct *ThresholdCiphertext) Bytes() []byte {
+	return appendBytes(appendBytes(nil, ct.C), ct.Sealed)
+}
+
+func ParseThresholdCiphertext(b []byte) (*ThresholdCiphertext, error) {
+	fields, err := readBytes(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	return &ThresholdCiphertext{fields[0], fields[1]}, nil
+}
+
+/*
+AES-256-GCM keyed with H("schnorr/threshold-elgamal"||group||X||C||K)
+*/
+func thresholdCipher(pk *PublicKey, C []byte, K Element) (cipher.AEAD, error) {
+	encodedK, err := pk.group.Encode(K)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	h := sha256.New()
+	h.Write([]byte("schnorr/threshold-elgamal"))
+	h.Write(pk.Bytes())
+	h.Write(appendBytes(appendBytes(nil, C), encodedK))
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,392 @@
+//go:build !schnorr_minimal || schnorr_timelock
+
+package schnorr
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+/*
+Time-locked signatures (experimental)
+
+The s component of a signature is locked in Rivest-Shamir-Wagner time-lock
+puzzles: the key of a puzzle is derived only from u^(2^T) mod N, which takes T
+sequential squarings modulo the RSA modulus N to compute for anybody who
+doesn't know the factorization of N. Before the puzzles are solved anyone can
+check that they will reveal a valid signature (verifiable timed signatures,
+Thyagarajan et al. 2020):
+
+	s_i = f(i), i = 1..n      f of degree t-1 over Z_q with f(0) = s
+	S_i = g^s_i               commitments, g^f(0) = R * X^c
+	u_i = G^r_i mod N         puzzle of share i
+	c_i = (s_i + H(H^r_i mod N)) mod q,  H = G^(2^T) mod N, so H^r_i = u_i^(2^T)
+
+A Fiat-Shamir challenge over all of it picks t-1 of the puzzles to be opened
+by revealing r_i. The verifier checks the opened puzzles against S_i and that
+all S_i lie on one polynomial through g^s; t-1 shares reveal nothing about s,
+and a signer with no valid unopened puzzle has to guess the challenged set,
+one in C(64, 32) > 2^60. Whoever solves one of the unopened puzzles gets the
+t-th share and interpolates s.
+
+The puzzle parameters (TimelockParams) are made once by a setup which discards
+the factors of N. Whoever knows them can compute H for any G and T without
+squaring and can therefore publish puzzles that never open, so a party that
+doesn't trust the setup runs TimelockParams.Check once, which repeats the T
+squarings, before accepting time-locked signatures under the parameters.
+*/
+
+var (
+	ErrTimelockMismatch = errors.New("schnorr: time-lock puzzles don't reveal the committed share")
+	ErrTimelockParams   = errors.New("schnorr: invalid time-lock parameters")
+)
+
+const (
+	timelockModulusBits = 2048
+	timelockExponentLen = 32 // bytes of the puzzle exponents r_i
+	timelockShares      = 64 // n
+	timelockThreshold   = 33 // t, t-1 puzzles are opened
+)
+
+/*
+Public time-lock parameters: H = G^(2^T) mod N
+*/
+type TimelockParams struct {
+	N *big.Int
+	G *big.Int
+	H *big.Int
+	T uint64 // number of sequential squarings
+}
+
+type TimelockedSignature struct {
+	R           []byte // encoding of R of the locked signature
+	Params      *TimelockParams
+	Shares      [][]byte   // encodings of S_i = g^s_i, i = 1..n
+	Puzzles     []*big.Int // u_i = G^r_i mod N
+	Ciphertexts []*big.Int // c_i = (s_i + k_i) mod q
+
+	Openings map[int]*big.Int // r_i of the challenged puzzles by index i
+}
+
+/*
+Parameters for T sequential squarings. N is a fresh RSA modulus whose factors
+are used to compute H and then discarded.
+*/
+func NewTimelockParams(T uint64) (*TimelockParams, error) {
+	p1, p2, err := timelockPrimes()
+	if err != nil {
+		return nil, err
+	}
+	N := new(big.Int).Mul(p1, p2)
+	phi := new(big.Int).Mul(p1.Sub(p1, big.NewInt(1)), p2.Sub(p2, big.NewInt(1)))
+
+	// G is a square, so it lies in the subgroup of quadratic residues
+	G, err := randomScalar(N)
+	if err != nil {
+		return nil, err
+	}
+	G.Mul(G, G).Mod(G, N)
+
+	e := new(big.Int).Exp(big.NewInt(2), new(big.Int).SetUint64(T), phi)
+	H := new(big.Int).Exp(G, e, N)
+	for _, x := range []*big.Int{p1, p2, phi, e} {
+		modp.Wipe(x)
+	}
+	return &TimelockParams{N, G, H, T}, nil
+}
+
+/*
+Check H = G^(2^T) mod N by T sequential squarings
+*/
+func (params *TimelockParams) Check() error {
+	if !params.valid() {
+		return ErrTimelockParams
+	}
+	if params.square(params.G).Cmp(params.H) != 0 {
+		return ErrTimelockParams
+	}
+	return nil
+}
+
+/*
+Sign m and lock the signature under the parameters
+*/
+func TimelockSign(m string, sk *SignatureKey, params *TimelockParams) (*TimelockedSignature, error) {
+	if !params.valid() {
+		return nil, ErrTimelockParams
+	}
+	signature, err := TrySign(m, sk)
+	if err != nil {
+		return nil, err
+	}
+	g := sk.group
+	q := g.Order()
+
+	// f(z) = s + a_1*z + ... + a_(t-1)*z^(t-1)
+	coefficients := []*big.Int{signature.s}
+	for i := 1; i < timelockThreshold; i++ {
+		a, err := randomScalar(q)
+		if err != nil {
+			return nil, err
+		}
+		coefficients = append(coefficients, a)
+	}
+	defer func() {
+		for _, a := range coefficients[1:] {
+			modp.Wipe(a)
+		}
+	}()
+
+	tl := &TimelockedSignature{R: signature.R, Params: params, Openings: make(map[int]*big.Int)}
+	exponents := make([]*big.Int, timelockShares)
+	for i := 1; i <= timelockShares; i++ {
+		share := evaluate(coefficients, i, q)
+		S, err := g.Encode(g.ScalarBaseMult(share))
+		if err != nil {
+			return nil, err
+		}
+		r, err := randomScalar(new(big.Int).Lsh(big.NewInt(1), 8*timelockExponentLen))
+		if err != nil {
+			return nil, err
+		}
+		c := share.Add(share, params.key(i, new(big.Int).Exp(params.H, r, params.N), q))
+		tl.Shares = append(tl.Shares, S)
+		tl.Puzzles = append(tl.Puzzles, new(big.Int).Exp(params.G, r, params.N))
+		tl.Ciphertexts = append(tl.Ciphertexts, c.Mod(c, q))
+		exponents[i-1] = r
+	}
+
+	for _, i := range tl.challenge(m, g) {
+		tl.Openings[i] = exponents[i-1]
+	}
+	return tl, nil
+}
+
+/*
+Check, without solving a puzzle, that the locked value is a valid signature of m
+under parameters the caller trusts (or checked with TimelockParams.Check)
+*/
+func VerifyTimelocked(m string, tl *TimelockedSignature, pk *PublicKey) bool {
+	if pk.Validate() != nil || tl == nil || !tl.Params.valid() || len(tl.Shares) != timelockShares ||
+		len(tl.Puzzles) != timelockShares || len(tl.Ciphertexts) != timelockShares {
+		return false
+	}
+	g, q := pk.group, pk.group.Order()
+	params := tl.Params
+	R, err := g.Decode(tl.R)
+	if err != nil {
+		return false
+	}
+	S := make([]Element, timelockShares)
+	for i := range S {
+		if S[i], err = g.Decode(tl.Shares[i]); err != nil {
+			return false
+		}
+		u, c := tl.Puzzles[i], tl.Ciphertexts[i]
+		if u == nil || c == nil || u.Sign() <= 0 || u.Cmp(params.N) >= 0 || !inRange(c, q) {
+			return false
+		}
+	}
+
+	opened := tl.challenge(m, g)
+	if len(tl.Openings) != len(opened) {
+		return false
+	}
+	shares := make(map[int]*big.Int, len(opened))
+	for _, i := range opened {
+		r := tl.Openings[i]
+		if r == nil || r.Sign() < 0 || r.BitLen() > 8*timelockExponentLen ||
+			new(big.Int).Exp(params.G, r, params.N).Cmp(tl.Puzzles[i-1]) != 0 {
+			return false
+		}
+		share, err := tl.open(i, new(big.Int).Exp(params.H, r, params.N), g)
+		if err != nil || !g.Equal(g.ScalarBaseMult(share), S[i-1]) {
+			return false
+		}
+		shares[i] = share
+	}
+
+	// every other S_j interpolated from g^s = R * X^c and the opened shares
+	gs := g.Add(R, g.ScalarMult(pk.X, pk.challenge(tl.R, m)))
+	points := append([]int{0}, opened...)
+	for j := 1; j <= timelockShares; j++ {
+		if shares[j] != nil {
+			continue
+		}
+		e := new(big.Int)
+		for _, i := range opened {
+			l := lagrangeAt(i, j, points, q)
+			e.Add(e, l.Mul(l, shares[i]))
+		}
+		expected := g.Add(g.ScalarMult(gs, lagrangeAt(0, j, points, q)), g.ScalarBaseMult(e.Mod(e, q)))
+		if !g.Equal(expected, S[j-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Solve an unopened puzzle by T sequential squarings and unlock the signature.
+tl has to pass VerifyTimelocked first, puzzles which don't reveal their
+committed share are skipped.
+*/
+func (tl *TimelockedSignature) Solve(pk *PublicKey) (*Signature, error) {
+	g, q := pk.group, pk.group.Order()
+	for j := 1; j <= len(tl.Puzzles); j++ {
+		if tl.Openings[j] != nil {
+			continue
+		}
+		share, err := tl.open(j, tl.Params.square(tl.Puzzles[j-1]), g)
+		if err != nil {
+			return nil, err
+		}
+		S, err := g.Decode(tl.Shares[j-1])
+		if err != nil || !g.Equal(g.ScalarBaseMult(share), S) {
+			continue
+		}
+
+		shares := map[int]*big.Int{j: share}
+		for i, r := range tl.Openings {
+			if shares[i], err = tl.open(i, new(big.Int).Exp(tl.Params.H, r, tl.Params.N), g); err != nil {
+				return nil, err
+			}
+		}
+		points := make([]int, 0, len(shares))
+		for i := range shares {
+			points = append(points, i)
+		}
+		s := new(big.Int)
+		for _, i := range points {
+			l := lagrangeAt(i, 0, points, q)
+			s.Add(s, l.Mul(l, shares[i]))
+		}
+		return &Signature{R: tl.R, s: s.Mod(s, q)}, nil
+	}
+	return nil, ErrTimelockMismatch
+}
+
+/*
+s_i = c_i - H(H^r_i) mod q of puzzle i from its solution
+*/
+func (tl *TimelockedSignature) open(i int, solution *big.Int, g Group) (*big.Int, error) {
+	if i < 1 || i > len(tl.Ciphertexts) {
+		return nil, ErrTimelockMismatch
+	}
+	q := g.Order()
+	share := new(big.Int).Sub(tl.Ciphertexts[i-1], tl.Params.key(i, solution, q))
+	return share.Mod(share, q), nil
+}
+
+/*
+Sorted indexes of the t-1 puzzles to open, drawn without replacement by
+H("schnorr/timelock/challenge" || params || R || S_i, u_i, c_i... || m)
+*/
+func (tl *TimelockedSignature) challenge(m string, g Group) []int {
+	h := sha256.New()
+	h.Write([]byte("schnorr/timelock/challenge"))
+	h.Write(appendInts(nil, tl.Params.N, tl.Params.G, tl.Params.H, new(big.Int).SetUint64(tl.Params.T)))
+	h.Write(appendBytes(nil, tl.R))
+	for i := range tl.Shares {
+		h.Write(appendBytes(nil, tl.Shares[i]))
+		h.Write(appendInts(nil, tl.Puzzles[i], tl.Ciphertexts[i]))
+	}
+	h.Write(appendBytes(nil, []byte(m)))
+	seed := h.Sum(nil)
+
+	// partial Fisher-Yates shuffle of 1..n
+	indexes := make([]int, timelockShares)
+	for i := range indexes {
+		indexes[i] = i + 1
+	}
+	for k := 0; k < timelockThreshold-1; k++ {
+		digest := sha256.Sum256(binary.BigEndian.AppendUint32(append([]byte(nil), seed...), uint32(k)))
+		j := k + int(wideScalar(digest[:], big.NewInt(int64(timelockShares-k))).Int64())
+		indexes[k], indexes[j] = indexes[j], indexes[k]
+	}
+	opened := indexes[:timelockThreshold-1]
+	sort.Ints(opened)
+	return opened
+}
+
+/*
+k_i = H("schnorr/timelock" || N || G || H || T || i || solution) reduced modulo q
+*/
+func (params *TimelockParams) key(i int, solution, q *big.Int) *big.Int {
+	h := sha256.New()
+	h.Write([]byte("schnorr/timelock"))
+	h.Write(appendInts(nil, params.N, params.G, params.H, new(big.Int).SetUint64(params.T), big.NewInt(int64(i)), solution))
+	return wideScalar(h.Sum(nil), q)
+}
+
+/*
+u^(2^T) mod N by T sequential squarings
+*/
+func (params *TimelockParams) square(u *big.Int) *big.Int {
+	solution := new(big.Int).Set(u)
+	for i := uint64(0); i < params.T; i++ {
+		solution.Mul(solution, solution)
+		solution.Mod(solution, params.N)
+	}
+	return solution
+}
+
+func (params *TimelockParams) valid() bool {
+	return params != nil && params.N != nil && params.G != nil && params.H != nil &&
+		params.N.BitLen() >= timelockModulusBits && params.N.Bit(0) == 1 &&
+		params.G.Cmp(big.NewInt(1)) > 0 && params.G.Cmp(params.N) < 0 &&
+		params.H.Sign() > 0 && params.H.Cmp(params.N) < 0
+}
+
+func timelockPrimes() (*big.Int, *big.Int, error) {
+	for {
+		p1, err := rand.Prime(random(), timelockModulusBits/2)
+		if err != nil {
+			return nil, nil, err
+		}
+		p2, err := rand.Prime(random(), timelockModulusBits/2)
+		if err != nil {
+			return nil, nil, err
+		}
+		if p1.Cmp(p2) != 0 {
+			return p1, p2, nil
+		}
+	}
+}
+
+/*
+f(index) mod q, coefficients from the constant term up
+*/
+func evaluate(coefficients []*big.Int, index int, q *big.Int) *big.Int {
+	y := new(big.Int)
+	for j := len(coefficients) - 1; j >= 0; j-- {
+		y.Mul(y, big.NewInt(int64(index)))
+		y.Add(y, coefficients[j])
+		y.Mod(y, q)
+	}
+	return y
+}
+
+/*
+Lagrange coefficient at the point at of the index within the points,
+prod((at - j) / (index - j)) over the other points j
+*/
+func lagrangeAt(index, at int, points []int, q *big.Int) *big.Int {
+	num, den := big.NewInt(1), big.NewInt(1)
+	for _, j := range points {
+		if j == index {
+			continue
+		}
+		num.Mul(num, big.NewInt(int64(at-j)))
+		num.Mod(num, q)
+		den.Mul(den, big.NewInt(int64(index-j)))
+		den.Mod(den, q)
+	}
+	return num.Mul(num, den.ModInverse(den, q)).Mod(num, q)
+}
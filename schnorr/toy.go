@@ -0,0 +1,81 @@
+package schnorr
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/big"
+)
+
+/*
+Toy mode - INSECURE, for examples, documentation and tests only
+
+The toy group is the subgroup of order q = (p - 1) / 2 modulo the 62-bit safe
+prime p = 2305843009213699919 with g = 4, small enough to read its numbers and
+to skip prime generation. Toy keys
+are derived from a seed and ToyRandom is a seedable deterministic random
+source, so examples print the same values on every run, e.g. on the Go
+Playground:
+
+	sk, pk := schnorr.GenerateToyKeys(1)
+	signature := schnorr.Sign("hello", sk)   // deterministic nonce, same every run
+
+Protocols which draw randomness from the package source (blind signing,
+escrow, ...) become deterministic with SetRandomSource(ToyRandom(seed)).
+Neither the group nor the predictable randomness gives any security.
+*/
+
+var toyParams = NewGroupParams(big.NewInt(2305843009213699919), big.NewInt(4))
+
+/*
+Parameters of the toy group, not registered and rejected by GroupParams.Validate
+*/
+func ToyParams() *GroupParams {
+	return toyParams
+}
+
+/*
+Key pair in the toy group derived from the seed
+*/
+func GenerateToyKeys(seed int64) (*SignatureKey, *PublicKey) {
+	g := toyParams.Group()
+	x, err := rand.Int(ToyRandom(seed), new(big.Int).Sub(g.Order(), big.NewInt(1)))
+	if err != nil {
+		panic(err)
+	}
+	sk, pk, err := newKeys(g, x.Add(x, big.NewInt(1)))
+	if err != nil {
+		panic(err)
+	}
+	return sk, pk
+}
+
+/*
+Deterministic byte stream SHA256("schnorr/toy" || seed || counter) || ...
+*/
+func ToyRandom(seed int64) io.Reader {
+	return &toyRandom{seed: seed}
+}
+
+type toyRandom struct {
+	seed    int64
+	counter uint64
+	block   []byte
+}
+
+func (t *toyRandom) Read(b []byte) (int, error) {
+	for n := 0; n < len(b); {
+		if len(t.block) == 0 {
+			input := binary.BigEndian.AppendUint64([]byte("schnorr/toy"), uint64(t.seed))
+			input = binary.BigEndian.AppendUint64(input, t.counter)
+			t.counter++
+			sum := sha256.Sum256(input)
+			t.block = sum[:]
+		}
+		c := copy(b[n:], t.block)
+		t.block = t.block[c:]
+		n += c
+	}
+	return len(b), nil
+}
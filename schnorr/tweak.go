@@ -0,0 +1,111 @@
+package schnorr
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+)
+
+/*
+Taproot-style key tweaking
+
+A derived key commits to arbitrary data c (e.g. a script tree root):
+
+	t  = H(X || c)
+	X' = X * g^t,   x' = (x + t) mod q
+
+Anyone holding the master public key X and the commitment c can recompute X',
+so TweakProof lets auditors link derived keys to the registered master key
+without access to any secret.
+*/
+
+/*
+Proof that a public key was derived from Master with Commitment
+*/
+type TweakProof struct {
+	Master     *PublicKey
+	Commitment []byte
+}
+
+/*
+Derive tweaked public key and the proof linking it to pk
+*/
+func TweakPublicKey(pk *PublicKey, commitment []byte) (*PublicKey, *TweakProof) {
+	t := tweak(pk, commitment)
+
+	X := pk.group.Add(pk.X, pk.group.ScalarBaseMult(t))
+
+	proof := &TweakProof{pk, append([]byte(nil), commitment...)}
+	return &PublicKey{group: pk.group, X: X, notAfter: pk.notAfter, environment: pk.environment}, proof
+}
+
+/*
+Derive signature key matching TweakPublicKey(pk, commitment)
+*/
+func TweakSignatureKey(sk *SignatureKey, pk *PublicKey, commitment []byte) *SignatureKey {
+	x := new(big.Int).Add(sk.x, tweak(pk, commitment))
+	x.Mod(x, sk.group.Order())
+	tweaked := &SignatureKey{group: sk.group, x: x, pub: sk.group.ScalarBaseMult(x), notAfter: sk.notAfter, environment: sk.environment}
+	tweaked.allowExpired.Store(sk.allowExpired.Load())
+	return tweaked
+}
+
+/*
+Check that derived was obtained from the master key of the proof
+*/
+func (proof *TweakProof) Verify(derived *PublicKey) bool {
+	// the tweak hashes the encoding of the master key, a key which can't be
+	// encoded has no tweak
+	if proof == nil || proof.Master == nil || derived == nil || proof.Master.Bytes() == nil {
+		return false
+	}
+	expected, _ := TweakPublicKey(proof.Master, proof.Commitment) // the proof of expected is proof itself
+	return expected.Equal(derived)
+}
+
+/*
+Encoding: len(master)||master||len(commitment)||commitment
+*/
+func (proof *TweakProof) Bytes() []byte {
+	buf := appendBytes(nil, proof.Master.Bytes())
+	return appendBytes(buf, proof.Commitment)
+}
+
+func ParseTweakProof(b []byte) (*TweakProof, error) {
+	fields, err := readBytes(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	master, err := ParsePublicKey(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	return &TweakProof{master, fields[1]}, nil
+}
+
+/*
+t = H(X || c) reduced modulo group order
+*/
+func tweak(pk *PublicKey, commitment []byte) *big.Int {
+	h := sha256.New()
+	h.Write([]byte("schnorr/tweak"))
+	h.Write(pk.Bytes())
+	h.Write(commitment)
+	return wideScalar(h.Sum(nil), pk.group.Order())
+}
+
+/*
+Digest expanded to at least bitlen(q) + 128 bits and reduced modulo q, for
+proof challenges with negligible bias
+*/
+func wideScalar(digest []byte, q *big.Int) *big.Int {
+	wide := append([]byte(nil), digest...)
+	for i := uint32(0); len(wide)*8 < q.BitLen()+128; i++ {
+		h := sha256.New()
+		h.Write(binary.BigEndian.AppendUint32(nil, i))
+		h.Write(digest)
+		wide = h.Sum(wide)
+	}
+	c := new(big.Int).SetBytes(wide)
+	return c.Mod(c, q)
+}
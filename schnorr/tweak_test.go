@@ -0,0 +1,26 @@
+package schnorr
+
+import "testing"
+
+func TestTweakProof(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived, proof := TweakPublicKey(pk, []byte("commitment"))
+	if !VerifySignature("message", Sign("message", TweakSignatureKey(sk, pk, []byte("commitment"))), derived) {
+		t.Fatal("tweaked key doesn't sign for the tweaked public key")
+	}
+	parsed, err := ParseTweakProof(proof.Bytes())
+	if err != nil || !parsed.Verify(derived) {
+		t.Fatalf("proof: %v", err)
+	}
+	if parsed.Verify(pk) {
+		t.Error("proof accepted for the master key")
+	}
+	for _, broken := range []*TweakProof{nil, {Commitment: []byte("commitment")}, {Master: &PublicKey{}}} {
+		if broken.Verify(derived) {
+			t.Errorf("proof %+v accepted", broken)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+//go:build !schnorr_minimal || schnorr_twoparty
+
+package schnorr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+/*
+Two-party signing (2P-Schnorr)
+
+Client and server each hold an additive share of the private key, x = x_c + x_s,
+and sign together in two message flows without ever reconstructing x:
+
+	client -> server:  m, D_c = g^d_c, E_c = g^e_c
+	server -> client:  D_s, E_s, s_s = d_s + b*e_s + c*x_s
+	client:            s = s_c + s_s, with s_c = d_c + b*e_c + c*x_c
+
+where b = H(X || m || D_c || E_c || D_s || E_s), R = D_c * D_s * (E_c * E_s)^b
+and c = H(R||m), all scalars modulo the group order q. The result is an ordinary Signature of the joint public key.
+
+Every party contributes two nonces bound together by b (as in MuSig2), so a
+client running many sessions in parallel can't steer R and mount the ROS
+attack against the server. The server keeps no per-session state, its nonces
+are used in the same response they're created for.
+
+Key generation is distributed too: each party generates its share and publishes
+X_i with a proof of possession, which prevents choosing X_i as a function of
+the peer's share (rogue key attack).
+*/
+
+var (
+	ErrTwoPartyProof   = errors.New("schnorr: invalid proof of possession of the peer's key share")
+	ErrTwoPartyState   = errors.New("schnorr: two-party key isn't joined or session was already finished")
+	ErrTwoPartyMessage = errors.New("schnorr: invalid two-party signing message")
+)
+
+/*
+Key share of one of the parties
+*/
+type TwoPartyKey struct {
+	share *SignatureKey // x_i in the group of the joint key
+	X     []byte        // encoding of the own public share X_i = g^x_i
+	pk    *PublicKey    // joint public key, nil until Join
+}
+
+/*
+Public share of a party with the proof of possession of its private share
+*/
+type TwoPartyPublicShare struct {
+	X     []byte
+	Proof *Signature
+}
+
+/*
+First flow: message and the client's nonces (group element encodings)
+*/
+type TwoPartyRequest struct {
+	Message string
+	D, E    []byte
+}
+
+/*
+Second flow: the server's nonces and its partial signature
+*/
+type TwoPartyResponse struct {
+	D, E []byte
+	S    *big.Int
+}
+
+/*
+Client side of a single signing session
+*/
+type TwoPartySession struct {
+	key     *TwoPartyKey
+	request *TwoPartyRequest
+	d, e    *big.Int
+}
+
+/*
+Generate the share of a party in the group with the registered parameters
+*/
+func NewTwoPartyKey(paramsID uint16) (*TwoPartyKey, *TwoPartyPublicShare, error) {
+	share, pub, err := GenerateKeysWithParamsID(paramsID)
+	if err != nil {
+		return nil, nil, err
+	}
+	X, err := share.group.Encode(pub.X)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof, err := TrySign(possessionMessage(pub), share)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &TwoPartyKey{share: share, X: X}, &TwoPartyPublicShare{X, proof}, nil
+}
+
+/*
+Check the peer's public share and compute the joint public key X = X_c * X_s
+*/
+func (k *TwoPartyKey) Join(peer *TwoPartyPublicShare) (*PublicKey, error) {
+	g := k.share.group
+	if peer == nil || peer.Proof == nil || bytes.Equal(peer.X, k.X) {
+		return nil, ErrTwoPartyProof
+	}
+	peerX, err := g.Decode(peer.X)
+	if err != nil {
+		return nil, ErrTwoPartyProof
+	}
+	peerPK := &PublicKey{group: g, X: peerX}
+	if !VerifySignature(possessionMessage(peerPK), peer.Proof, peerPK) {
+		return nil, ErrTwoPartyProof
+	}
+
+	X := g.Add(k.share.pub, peerX)
+	if _, err := g.Encode(X); err != nil {
+		return nil, ErrTwoPartyProof
+	}
+	k.pk = &PublicKey{group: g, X: X}
+	return k.pk, nil
+}
+
+func (k *TwoPartyKey) PublicKey() *PublicKey {
+	return k.pk
+}
+
+/*
+Client - start signing m, send the request to the server
+*/
+func (k *TwoPartyKey) StartSign(m string) (*TwoPartySession, *TwoPartyRequest, error) {
+	if k.pk == nil {
+		return nil, nil, ErrTwoPartyState
+	}
+	d, D, err := k.nonce()
+	if err != nil {
+		return nil, nil, err
+	}
+	e, E, err := k.nonce()
+	if err != nil {
+		return nil, nil, err
+	}
+	request := &TwoPartyRequest{m, D, E}
+	return &TwoPartySession{k, request, d, e}, request, nil
+}
+
+/*
+Server - answer the client's request with the partial signature.
+Deciding whether the message may be signed at all is up to the caller.
+*/
+func (k *TwoPartyKey) Respond(request *TwoPartyRequest) (*TwoPartyResponse, error) {
+	if k.pk == nil {
+		return nil, ErrTwoPartyState
+	}
+	d, D, err := k.nonce()
+	if err != nil {
+		return nil, err
+	}
+	e, E, err := k.nonce()
+	if err != nil {
+		return nil, err
+	}
+	response := &TwoPartyResponse{D: D, E: E}
+	R, err := k.commitment(request, response)
+	if err != nil {
+		return nil, err
+	}
+	response.S = k.partial(request, response, R, d, e)
+	return response, nil
+}
+
+/*
+Client - combine the server's partial signature with its own. The session
+nonces are destroyed, the session can't be used again.
+*/
+func (s *TwoPartySession) Finish(response *TwoPartyResponse) (*Signature, error) {
+	if s.d == nil {
+		return nil, ErrTwoPartyState
+	}
+	k := s.key
+	q := k.share.group.Order()
+	if response == nil || response.S == nil || response.S.Sign() < 0 || response.S.Cmp(q) >= 0 {
+		return nil, ErrTwoPartyMessage
+	}
+	R, err := k.commitment(s.request, response)
+	if err != nil {
+		return nil, err
+	}
+	own := k.partial(s.request, response, R, s.d, s.e)
+	s.d, s.e = nil, nil
+
+	sum := own.Add(own, response.S)
+	signature := &Signature{R: R, s: sum.Mod(sum, q)}
+	if !VerifySignature(s.request.Message, signature, k.pk) {
+		return nil, ErrInvalidPartialSignature
+	}
+	return signature, nil
+}
+
+/*
+s_i = d_i + b*e_i + c*x_i mod q
+*/
+func (k *TwoPartyKey) partial(request *TwoPartyRequest, response *TwoPartyResponse, R []byte, d, e *big.Int) *big.Int {
+	q := k.share.group.Order()
+	b := k.binding(request, response)
+	c := challenge(R, request.Message, q)
+
+	s := c.Mul(c, k.share.x)
+	s.Add(s, d)
+	s.Add(s, b.Mul(b, e))
+	return s.Mod(s, q)
+}
+
+/*
+R = D_c * D_s * (E_c * E_s)^b, fails if any of the nonces isn't an element of the group
+*/
+func (k *TwoPartyKey) commitment(request *TwoPartyRequest, response *TwoPartyResponse) ([]byte, error) {
+	g := k.share.group
+	if request == nil {
+		return nil, ErrTwoPartyMessage
+	}
+	var elements [4]Element
+	for i, encoded := range [][]byte{request.D, request.E, response.D, response.E} {
+		var err error
+		if elements[i], err = g.Decode(encoded); err != nil {
+			return nil, ErrTwoPartyMessage
+		}
+	}
+	E := g.ScalarMult(g.Add(elements[1], elements[3]), k.binding(request, response))
+	R, err := g.Encode(g.Add(g.Add(elements[0], elements[2]), E))
+	if err != nil {
+		return nil, ErrTwoPartyMessage
+	}
+	return R, nil
+}
+
+/*
+b = H(X || m || D_c || E_c || D_s || E_s) mod q
+*/
+func (k *TwoPartyKey) binding(request *TwoPartyRequest, response *TwoPartyResponse) *big.Int {
+	h := sha256.New()
+	h.Write([]byte("schnorr/2p/binding"))
+	h.Write(k.pk.Bytes())
+	h.Write(appendBytes(nil, []byte(request.Message)))
+	for _, encoded := range [][]byte{request.D, request.E, response.D, response.E} {
+		h.Write(appendBytes(nil, encoded))
+	}
+	return wideScalar(h.Sum(nil), k.share.group.Order())
+}
+
+/*
+Fresh nonce d and its encoded commitment g^d
+*/
+func (k *TwoPartyKey) nonce() (*big.Int, []byte, error) {
+	d, err := randomScalar(k.share.group.Order())
+	if err != nil {
+		return nil, nil, err
+	}
+	D, err := k.share.group.Encode(k.share.group.ScalarBaseMult(d))
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, D, nil
+}
+
+func possessionMessage(pk *PublicKey) string {
+	h := sha256.New()
+	h.Write([]byte("schnorr/2p/possession"))
+	h.Write(pk.Bytes())
+	return string(h.Sum(nil))
+}
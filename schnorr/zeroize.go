@@ -0,0 +1,73 @@
+package schnorr
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"errors"
+	"math/big"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+/*
+Side-channel hardening
+
+Sign, TrySign, SignTo, SignWithAux and the signing of crypto.Signer compute
+the nonce derivation and s = r + c*x in constant-time fixed-width arithmetic
+(internal/modp), the time and memory accesses depend on the size of q only,
+not on the private key or the nonce. Nonces and the key-derived HMAC state are
+wiped from the scratch memory after every signature. Comparisons of private
+keys use crypto/subtle.
+
+R = g^r is computed by the group in constant time as well (modp.Scratch.Exp
+for the mod p groups, see internal/ec for the curves). Not covered: key
+generation and parsing and the protocols of the package (blind, threshold,
+MuSig, ...) compute on secrets with math/big, which isn't constant time.
+BenchmarkSignHammingWeight and `schnorr bench -hamming` measure the signing
+time for keys of different Hamming weight.
+
+Go can't guarantee that no copy of a secret survives in memory (the garbage
+collector moves and copies values, math/big reallocates), Zeroize scrubs the
+copy held by the key.
+*/
+
+var ErrKeyZeroized = errors.New("schnorr: signature key has been zeroized")
+
+/*
+Overwrite the private key in memory, the key can't sign afterwards. Must not
+be called while other goroutines use the key.
+*/
+func (sk *SignatureKey) Zeroize() {
+	modp.Wipe(sk.x)
+}
+
+/*
+Constant-time comparison of the private keys (the groups are public)
+*/
+func (sk *SignatureKey) Equal(x crypto.PrivateKey) bool {
+	other, ok := x.(*SignatureKey)
+	if !ok || !group.Same(sk.group, other.group) {
+		return false
+	}
+	if sk.x.Sign() != other.x.Sign() && (sk.x.Sign() < 0 || other.x.Sign() < 0) {
+		return false
+	}
+	// the byte length of q, unless a key is out of range anyway
+	n := group.ScalarLen(sk.group)
+	for _, x := range []*big.Int{sk.x, other.x} {
+		if l := (x.BitLen() + 7) / 8; l > n {
+			n = l
+		}
+	}
+	a, b := sk.x.FillBytes(make([]byte, n)), other.x.FillBytes(make([]byte, n))
+	defer clearBytes(a)
+	defer clearBytes(b)
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+func clearBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
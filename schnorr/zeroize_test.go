@@ -0,0 +1,78 @@
+package schnorr
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestZeroize(t *testing.T) {
+	sk, pk, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, _, err := NewSignatureKey(sk.Group(), sk.x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := GenerateKeysWithParamsID(ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sk.Equal(copied) || sk.Equal(other) || sk.Equal(pk) {
+		t.Fatal("key comparison")
+	}
+
+	signature := Sign("message", sk)
+	sk.Zeroize()
+	if sk.x.Sign() != 0 {
+		t.Fatal("private key not wiped")
+	}
+	if _, err := TrySign("message", sk); err != ErrKeyZeroized {
+		t.Fatalf("TrySign with a zeroized key: %v", err)
+	}
+	if err := SignTo(&Signature{}, "message", sk); err != ErrKeyZeroized {
+		t.Fatalf("SignTo with a zeroized key: %v", err)
+	}
+	if _, err := SignHedged("message", sk, nil); err != ErrKeyZeroized {
+		t.Fatalf("SignHedged with a zeroized key: %v", err)
+	}
+	if sk.Equal(copied) {
+		t.Fatal("zeroized key equals the original")
+	}
+	// signatures made before stay valid
+	if !VerifySignature("message", signature, pk) {
+		t.Fatal("signature doesn't verify")
+	}
+}
+
+/*
+Signing time for secp256k1 keys of Hamming weight 1 to 255 (the lowest bit
+and the top weight-1 bits of 255 set). With constant-time signing the
+sub-benchmarks differ by noise only; compare them with benchstat over
+several -count runs.
+*/
+func BenchmarkSignHammingWeight(b *testing.B) {
+	g, err := LookupGroup(ParamsSecp256k1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, weight := range []int{1, 32, 64, 128, 192, 255} {
+		x := big.NewInt(1)
+		for bit := 254; bit > 254-(weight-1); bit-- {
+			x.SetBit(x, bit, 1)
+		}
+		sk, _, err := NewSignatureKey(g, x)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("weight=%d", weight), func(b *testing.B) {
+			signature := &Signature{}
+			for i := 0; i < b.N; i++ {
+				if err := SignTo(signature, "schnorr benchmark", sk); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
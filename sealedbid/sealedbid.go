@@ -0,0 +1,517 @@
+/*
+Sealed-bid auctions with Pedersen commitments.
+
+Bidders commit to their amounts while bidding is open and open the commitments
+after it closes, so nobody, the auctioneer included, learns a bid before all
+bids are fixed:
+
+	commitment   C = v*G + r*H          (v amount, r random blinding)
+	sealed bid   auction ID, bidder key, C, bidder signature over them
+	opening      (v, r), sent by the bidder after the auction closed
+
+H is a second generator of the group derived by hashing, nobody knows its
+discrete logarithm to the base G, so C hides v and binds the bidder to it.
+The Auction collects sealed bids (Submit), stops accepting them (Close),
+checks openings (Reveal) and signs a Result transcript with all bids,
+openings and the winner: the highest revealed amount, ties going to the
+earlier bid. Bids that are never revealed are listed without opening and
+don't win. Anyone can re-check a transcript with the auctioneer key
+(Result.Verify).
+
+All keys and signatures are in a prime order group of the schnorr package,
+e.g. schnorr.Secp256k1().
+*/
+package sealedbid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/internal/xmd"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrBadSignature    = errors.New("sealedbid: invalid signature")
+	ErrWrongAuction    = errors.New("sealedbid: bid belongs to another auction or group")
+	ErrDuplicateBid    = errors.New("sealedbid: bidder has already bid")
+	ErrUnknownBidder   = errors.New("sealedbid: no bid of the bidder")
+	ErrBadOpening      = errors.New("sealedbid: opening doesn't match the commitment")
+	ErrClosed          = errors.New("sealedbid: bidding is closed")
+	ErrNotClosed       = errors.New("sealedbid: bidding is still open")
+	ErrInvalidEncoding = errors.New("sealedbid: invalid encoding")
+	ErrNoGenerator     = errors.New("sealedbid: can't derive a second generator of the group")
+)
+
+/*
+Commitment to a bid, signed by the bidder
+*/
+type SealedBid struct {
+	Auction    string
+	Bidder     *schnorr.PublicKey
+	Commitment schnorr.Element // v*G + r*H
+	Signature  *schnorr.Signature
+}
+
+/*
+Opening of a commitment, kept secret by the bidder until bidding is closed
+*/
+type Opening struct {
+	Amount   uint64
+	Blinding *big.Int
+}
+
+/*
+Commit to the amount and sign the commitment for the auction
+*/
+func Seal(auction string, amount uint64, sk *schnorr.SignatureKey) (*SealedBid, *Opening, error) {
+	group := sk.Group()
+	pk, err := sk.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := randomScalar(group)
+	if err != nil {
+		return nil, nil, err
+	}
+	opening := &Opening{amount, r}
+	C, err := commit(group, opening)
+	if err != nil {
+		return nil, nil, err
+	}
+	bid := &SealedBid{Auction: auction, Bidder: pk, Commitment: C}
+	m, err := bid.message()
+	if err != nil {
+		return nil, nil, err
+	}
+	if bid.Signature, err = schnorr.TrySign(m, sk); err != nil {
+		return nil, nil, err
+	}
+	return bid, opening, nil
+}
+
+/*
+Signed message: "schnorr/sealedbid/bid" || len(auction) || auction || len(key) || key || len(C) || C
+*/
+func (b *SealedBid) message() (string, error) {
+	C, err := b.Bidder.Group().Encode(b.Commitment)
+	if err != nil {
+		return "", err
+	}
+	m := appendField([]byte("schnorr/sealedbid/bid"), []byte(b.Auction))
+	m = appendField(m, b.Bidder.Bytes())
+	return string(appendField(m, C)), nil
+}
+
+/*
+Check the bidder signature
+*/
+func (b *SealedBid) Verify() error {
+	if b.Bidder == nil || b.Signature == nil {
+		return ErrBadSignature
+	}
+	m, err := b.message()
+	if err != nil || !schnorr.VerifySignature(m, b.Signature, b.Bidder) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+/*
+Check that the opening matches the commitment of the bid
+*/
+func (b *SealedBid) Open(o *Opening) error {
+	group := b.Bidder.Group()
+	if o == nil || o.Blinding == nil || o.Blinding.Sign() <= 0 || o.Blinding.Cmp(group.Order()) >= 0 {
+		return ErrBadOpening
+	}
+	C, err := commit(group, o)
+	if err != nil || !group.Equal(C, b.Commitment) {
+		return ErrBadOpening
+	}
+	return nil
+}
+
+/*
+Encoding: len(auction) || auction || len(key) || key || len(C) || C || signature
+*/
+func (b *SealedBid) Bytes() ([]byte, error) {
+	m, err := b.message()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(m[len("schnorr/sealedbid/bid"):]), b.Signature.Bytes()...), nil
+}
+
+func ParseSealedBid(group schnorr.Group, b []byte) (*SealedBid, error) {
+	auction, b, ok := readField(b)
+	if !ok {
+		return nil, ErrInvalidEncoding
+	}
+	key, b, ok := readField(b)
+	if !ok {
+		return nil, ErrInvalidEncoding
+	}
+	C, b, ok := readField(b)
+	if !ok {
+		return nil, ErrInvalidEncoding
+	}
+	bidder, err := schnorr.ParsePublicKey(key)
+	if err != nil || bidder.Group().Name() != group.Name() {
+		return nil, ErrInvalidEncoding
+	}
+	commitment, err := group.Decode(C)
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	signature, err := schnorr.ParseSignature(b)
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return &SealedBid{string(auction), bidder, commitment, signature}, nil
+}
+
+/*
+Encoding: amount (8 bytes) || blinding of the byte length of the group order
+*/
+func (o *Opening) Bytes(group schnorr.Group) []byte {
+	b := binary.BigEndian.AppendUint64(nil, o.Amount)
+	return append(b, o.Blinding.FillBytes(make([]byte, scalarLen(group)))...)
+}
+
+func ParseOpening(group schnorr.Group, b []byte) (*Opening, error) {
+	if len(b) != 8+scalarLen(group) {
+		return nil, ErrInvalidEncoding
+	}
+	return &Opening{binary.BigEndian.Uint64(b), new(big.Int).SetBytes(b[8:])}, nil
+}
+
+/*
+Auction run by the holder of the auctioneer key
+*/
+type Auction struct {
+	id string
+	sk *schnorr.SignatureKey
+
+	mu       sync.Mutex
+	closed   bool
+	bids     []*SealedBid
+	openings []*Opening
+	bidders  map[string]int // encoded bidder key -> index in bids
+}
+
+func NewAuction(id string, sk *schnorr.SignatureKey) *Auction {
+	return &Auction{id: id, sk: sk, bidders: make(map[string]int)}
+}
+
+func (a *Auction) ID() string {
+	return a.id
+}
+
+/*
+Accept a sealed bid, one per bidder, while bidding is open
+*/
+func (a *Auction) Submit(bid *SealedBid) error {
+	if bid.Auction != a.id || bid.Bidder == nil || bid.Bidder.Group().Name() != a.sk.Group().Name() {
+		return ErrWrongAuction
+	}
+	if err := bid.Verify(); err != nil {
+		return err
+	}
+	key := bid.Bidder.Bytes()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrClosed
+	}
+	if _, ok := a.bidders[string(key)]; ok {
+		return ErrDuplicateBid
+	}
+	a.bidders[string(key)] = len(a.bids)
+	a.bids = append(a.bids, bid)
+	a.openings = append(a.openings, nil)
+	return nil
+}
+
+/*
+Stop accepting bids, openings are accepted from now on
+*/
+func (a *Auction) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = true
+}
+
+/*
+Accept the opening of the bidder's commitment
+*/
+func (a *Auction) Reveal(bidder *schnorr.PublicKey, o *Opening) error {
+	key := bidder.Bytes()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.closed {
+		return ErrNotClosed
+	}
+	i, ok := a.bidders[string(key)]
+	if !ok {
+		return ErrUnknownBidder
+	}
+	if err := a.bids[i].Open(o); err != nil {
+		return err
+	}
+	a.openings[i] = &Opening{o.Amount, new(big.Int).Set(o.Blinding)}
+	return nil
+}
+
+/*
+Signed transcript of the auction with the openings received so far
+*/
+func (a *Auction) Result() (*Result, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.closed {
+		return nil, ErrNotClosed
+	}
+	r := &Result{
+		Auction:  a.id,
+		Bids:     append([]*SealedBid(nil), a.bids...),
+		Openings: append([]*Opening(nil), a.openings...),
+	}
+	r.Winner = winner(r.Openings)
+	m, err := r.message(a.sk.Group())
+	if err != nil {
+		return nil, err
+	}
+	if r.Signature, err = schnorr.TrySign(m, a.sk); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+/*
+Transcript of a closed auction, signed by the auctioneer
+*/
+type Result struct {
+	Auction   string
+	Bids      []*SealedBid // in the order of submission
+	Openings  []*Opening   // Openings[i] opens Bids[i], nil if it wasn't revealed
+	Winner    int          // index of the winning bid, -1 without revealed bids
+	Signature *schnorr.Signature
+}
+
+/*
+Winning amount, false without a winner
+*/
+func (r *Result) Price() (uint64, bool) {
+	if r.Winner < 0 {
+		return 0, false
+	}
+	return r.Openings[r.Winner].Amount, true
+}
+
+/*
+Signed message: "schnorr/sealedbid/result" || len(auction) || auction ||
+number of bids (4 bytes) || for every bid: len(bid) || bid || len(opening) || opening ||
+winner (4 bytes, 0xffffffff for none)
+*/
+func (r *Result) message(group schnorr.Group) (string, error) {
+	if len(r.Openings) != len(r.Bids) {
+		return "", ErrInvalidEncoding
+	}
+	m := appendField([]byte("schnorr/sealedbid/result"), []byte(r.Auction))
+	m = binary.BigEndian.AppendUint32(m, uint32(len(r.Bids)))
+	for i, bid := range r.Bids {
+		b, err := bid.Bytes()
+		if err != nil {
+			return "", err
+		}
+		m = appendField(m, b)
+		var o []byte
+		if r.Openings[i] != nil {
+			o = r.Openings[i].Bytes(group)
+		}
+		m = appendField(m, o)
+	}
+	return string(binary.BigEndian.AppendUint32(m, uint32(r.Winner))), nil
+}
+
+/*
+Check the auctioneer signature, every bid signature and opening, and that the
+winner is the highest revealed bid
+*/
+func (r *Result) Verify(auctioneer *schnorr.PublicKey) error {
+	if r.Signature == nil {
+		return ErrBadSignature
+	}
+	m, err := r.message(auctioneer.Group())
+	if err != nil {
+		return err
+	}
+	if !schnorr.VerifySignature(m, r.Signature, auctioneer) {
+		return ErrBadSignature
+	}
+
+	seen := make(map[string]bool, len(r.Bids))
+	for i, bid := range r.Bids {
+		if bid.Auction != r.Auction || bid.Bidder.Group().Name() != auctioneer.Group().Name() {
+			return fmt.Errorf("bid %d: %w", i, ErrWrongAuction)
+		}
+		if err := bid.Verify(); err != nil {
+			return fmt.Errorf("bid %d: %w", i, err)
+		}
+		key := bid.Bidder.Bytes()
+		if seen[string(key)] {
+			return fmt.Errorf("bid %d: %w", i, ErrDuplicateBid)
+		}
+		seen[string(key)] = true
+		if r.Openings[i] != nil {
+			if err := bid.Open(r.Openings[i]); err != nil {
+				return fmt.Errorf("bid %d: %w", i, err)
+			}
+		}
+	}
+	if winner(r.Openings) != r.Winner {
+		return fmt.Errorf("sealedbid: bid %d isn't the winner", r.Winner)
+	}
+	return nil
+}
+
+/*
+Encoding: the signed message without the domain tag, then the signature
+*/
+func (r *Result) Bytes(group schnorr.Group) ([]byte, error) {
+	m, err := r.message(group)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(m[len("schnorr/sealedbid/result"):]), r.Signature.Bytes()...), nil
+}
+
+func ParseResult(group schnorr.Group, b []byte) (*Result, error) {
+	auction, b, ok := readField(b)
+	if !ok || len(b) < 4 {
+		return nil, ErrInvalidEncoding
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	if uint64(n) > uint64(len(b)/8) {
+		return nil, ErrInvalidEncoding
+	}
+	r := &Result{Auction: string(auction), Bids: make([]*SealedBid, n), Openings: make([]*Opening, n)}
+	for i := range r.Bids {
+		var field []byte
+		if field, b, ok = readField(b); !ok {
+			return nil, ErrInvalidEncoding
+		}
+		bid, err := ParseSealedBid(group, field)
+		if err != nil {
+			return nil, err
+		}
+		r.Bids[i] = bid
+		if field, b, ok = readField(b); !ok {
+			return nil, ErrInvalidEncoding
+		}
+		if len(field) > 0 {
+			if r.Openings[i], err = ParseOpening(group, field); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(b) < 4 {
+		return nil, ErrInvalidEncoding
+	}
+	r.Winner = int(int32(binary.BigEndian.Uint32(b)))
+	if r.Winner < -1 || r.Winner >= len(r.Bids) {
+		return nil, ErrInvalidEncoding
+	}
+	signature, err := schnorr.ParseSignature(b[4:])
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	r.Signature = signature
+	return r, nil
+}
+
+/*
+Index of the highest revealed amount, the earliest bid wins ties
+*/
+func winner(openings []*Opening) int {
+	w := -1
+	for i, o := range openings {
+		if o != nil && (w < 0 || o.Amount > openings[w].Amount) {
+			w = i
+		}
+	}
+	return w
+}
+
+/*
+C = v*G + r*H
+*/
+func commit(group schnorr.Group, o *Opening) (schnorr.Element, error) {
+	H, err := generatorH(group)
+	if err != nil {
+		return nil, err
+	}
+	C := group.Add(group.ScalarBaseMult(new(big.Int).SetUint64(o.Amount)), group.ScalarMult(H, o.Blinding))
+	if _, err := group.Encode(C); err != nil {
+		return nil, ErrBadOpening
+	}
+	return C, nil
+}
+
+var generators sync.Map // group name -> H
+
+/*
+Second generator H: the first point decoding from 0x02 || expand_message_xmd(name || counter),
+as long as the encoding of G. Groups whose encodings don't work this way are
+rejected with ErrNoGenerator.
+*/
+func generatorH(group schnorr.Group) (schnorr.Element, error) {
+	if H, ok := generators.Load(group.Name()); ok {
+		return H, nil
+	}
+	G, err := group.Encode(group.ScalarBaseMult(big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	for counter := uint32(0); counter < 256; counter++ {
+		msg := binary.BigEndian.AppendUint32([]byte(group.Name()), counter)
+		candidate := append([]byte{2}, xmd.Expand(msg, []byte("schnorr/sealedbid/H"), len(G)-1)...)
+		if H, err := group.Decode(candidate); err == nil {
+			generators.Store(group.Name(), H)
+			return H, nil
+		}
+	}
+	return nil, ErrNoGenerator
+}
+
+func randomScalar(group schnorr.Group) (*big.Int, error) {
+	return entropy.Scalar(group.Order())
+}
+
+func scalarLen(group schnorr.Group) int {
+	return (group.Order().BitLen() + 7) / 8
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
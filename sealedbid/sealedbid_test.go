@@ -0,0 +1,320 @@
+package sealedbid
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func key(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk
+}
+
+type bidder struct {
+	sk      *schnorr.SignatureKey
+	pk      *schnorr.PublicKey
+	bid     *SealedBid
+	opening *Opening
+}
+
+func bid(t *testing.T, auction string, amount uint64) *bidder {
+	t.Helper()
+	sk, pk := key(t)
+	b, o, err := Seal(auction, amount, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &bidder{sk, pk, b, o}
+}
+
+/*
+Closed auction with bids of 300, 500 (unrevealed), 400 and 400
+*/
+func run(t *testing.T) (*Auction, *schnorr.PublicKey, []*bidder) {
+	t.Helper()
+	sk, pk := key(t)
+	a := NewAuction("lot-7", sk)
+	bidders := []*bidder{bid(t, "lot-7", 300), bid(t, "lot-7", 500), bid(t, "lot-7", 400), bid(t, "lot-7", 400)}
+	for _, b := range bidders {
+		if err := a.Submit(b.bid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Reveal(bidders[0].pk, bidders[0].opening); err != ErrNotClosed {
+		t.Errorf("opening while bidding is open: %v", err)
+	}
+	a.Close()
+	for _, i := range []int{3, 2, 0} {
+		if err := a.Reveal(bidders[i].pk, bidders[i].opening); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return a, pk, bidders
+}
+
+func TestAuction(t *testing.T) {
+	a, pk, _ := run(t)
+	r, err := a.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unrevealed 500 doesn't win, the earlier of the tied bids does
+	if price, ok := r.Price(); r.Winner != 2 || !ok || price != 400 || r.Openings[1] != nil {
+		t.Fatalf("winner %d at %d", r.Winner, price)
+	}
+	if err := r.Verify(pk); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := r.Bytes(pk.Group())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseResult(pk.Group(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Verify(pk); err != nil {
+		t.Errorf("parsed transcript: %v", err)
+	}
+
+	empty := NewAuction("lot-8", a.sk)
+	empty.Close()
+	r, err = empty.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Price(); ok || r.Winner != -1 || r.Verify(pk) != nil {
+		t.Errorf("auction without bids: winner %d", r.Winner)
+	}
+}
+
+func TestBidding(t *testing.T) {
+	sk, _ := key(t)
+	a := NewAuction("lot-7", sk)
+	if _, err := a.Result(); err != ErrNotClosed {
+		t.Errorf("result while bidding is open: %v", err)
+	}
+
+	b := bid(t, "lot-7", 100)
+	if err := a.Submit(b.bid); err != nil {
+		t.Fatal(err)
+	}
+	again, _, err := Seal("lot-7", 200, b.sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Submit(again); err != ErrDuplicateBid {
+		t.Errorf("second bid of a bidder: %v", err)
+	}
+	if err := a.Submit(bid(t, "lot-8", 100).bid); err != ErrWrongAuction {
+		t.Errorf("bid for another auction: %v", err)
+	}
+
+	forged := *bid(t, "lot-7", 100).bid
+	forged.Commitment = b.bid.Commitment
+	if err := a.Submit(&forged); err != ErrBadSignature {
+		t.Errorf("bid with another commitment: %v", err)
+	}
+
+	late := bid(t, "lot-7", 900)
+	a.Close()
+	if err := a.Submit(late.bid); err != ErrClosed {
+		t.Errorf("bid after closing: %v", err)
+	}
+	if err := a.Reveal(late.pk, late.opening); err != ErrUnknownBidder {
+		t.Errorf("opening of a late bid: %v", err)
+	}
+
+	// the bidder can't claim another amount
+	q := sk.Group().Order()
+	for name, o := range map[string]*Opening{
+		"other amount":   {200, b.opening.Blinding},
+		"other blinding": {100, new(big.Int).Mod(new(big.Int).Add(b.opening.Blinding, big.NewInt(1)), q)},
+		"zero blinding":  {100, new(big.Int)},
+		"large blinding": {100, q},
+		"nil":            nil,
+	} {
+		if err := a.Reveal(b.pk, o); err != ErrBadOpening {
+			t.Errorf("%s opening: %v", name, err)
+		}
+	}
+	if err := a.Reveal(b.pk, b.opening); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTamperedResult(t *testing.T) {
+	a, pk, bidders := run(t)
+	r, err := a.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := pk.Group()
+	resign := func(r *Result) *Result {
+		m, err := r.message(group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Signature, err = schnorr.TrySign(m, a.sk); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	copyResult := func() *Result {
+		c := *r
+		c.Bids = append([]*SealedBid(nil), r.Bids...)
+		c.Openings = append([]*Opening(nil), r.Openings...)
+		return &c
+	}
+
+	winner := copyResult()
+	winner.Winner = 3
+	if err := winner.Verify(pk); err != ErrBadSignature {
+		t.Errorf("changed winner: %v", err)
+	}
+	// even the auctioneer can't sign a wrong outcome
+	if err := resign(winner).Verify(pk); err == nil {
+		t.Error("signed transcript with the wrong winner")
+	}
+	hidden := copyResult()
+	hidden.Openings[2], hidden.Winner = nil, 3
+	if err := resign(hidden).Verify(pk); err != nil {
+		t.Errorf("transcript without the winner's opening: %v", err)
+	}
+	opening := copyResult()
+	opening.Openings[1] = &Opening{500, bidders[2].opening.Blinding}
+	opening.Winner = 1
+	if err := resign(opening).Verify(pk); !errors.Is(err, ErrBadOpening) {
+		t.Errorf("forged opening: %v", err)
+	}
+	duplicate := copyResult()
+	duplicate.Bids[1], duplicate.Openings[1] = duplicate.Bids[0], duplicate.Openings[0]
+	if err := resign(duplicate).Verify(pk); !errors.Is(err, ErrDuplicateBid) {
+		t.Errorf("duplicated bid: %v", err)
+	}
+	other := bid(t, "lot-8", 1000)
+	foreign := copyResult()
+	foreign.Bids[1] = other.bid
+	if err := resign(foreign).Verify(pk); !errors.Is(err, ErrWrongAuction) {
+		t.Errorf("bid of another auction: %v", err)
+	}
+	short := copyResult()
+	short.Openings = short.Openings[:3]
+	if err := short.Verify(pk); err != ErrInvalidEncoding {
+		t.Errorf("openings missing: %v", err)
+	}
+
+	_, otherPK := key(t)
+	if err := r.Verify(otherPK); err != ErrBadSignature {
+		t.Errorf("transcript checked with another key: %v", err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	a, pk, bidders := run(t)
+	group := pk.Group()
+	b, err := bidders[0].bid.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSealedBid(group, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Open(bidders[0].opening); err != nil {
+		t.Error(err)
+	}
+	opening, err := ParseOpening(group, bidders[0].opening.Bytes(group))
+	if err != nil || opening.Amount != 300 || parsed.Open(opening) != nil {
+		t.Errorf("parsed opening: %v", err)
+	}
+
+	C, err := group.Encode(parsed.Commitment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badKey := appendField(appendField(appendField(nil, []byte("lot-7")), []byte{0}), C)
+	badKey = append(badKey, parsed.Signature.Bytes()...)
+	badCommitment := appendField(appendField(appendField(nil, []byte("lot-7")), pk.Bytes()), []byte{2, 0})
+	badCommitment = append(badCommitment, parsed.Signature.Bytes()...)
+	for name, bad := range map[string][]byte{
+		"empty":      nil,
+		"truncated":  b[:len(b)-1],
+		"key":        badKey,
+		"commitment": badCommitment,
+	} {
+		if _, err := ParseSealedBid(group, bad); err != ErrInvalidEncoding {
+			t.Errorf("%s bid: %v", name, err)
+		}
+	}
+	if _, err := ParseOpening(group, bidders[0].opening.Bytes(group)[1:]); err != ErrInvalidEncoding {
+		t.Errorf("truncated opening: %v", err)
+	}
+	secp, _, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseSealedBid(secp.Group(), b); err != ErrInvalidEncoding {
+		t.Errorf("bid parsed in another group: %v", err)
+	}
+
+	r, err := a.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb, err := r.Bytes(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 4 + len("lot-7")
+	for name, bad := range map[string][]byte{
+		"truncated": rb[:len(rb)-1],
+		"count":     append(append(append([]byte(nil), rb[:count]...), 0xff, 0xff, 0xff, 0xff), rb[count+4:]...),
+		"no winner": rb[:count+4],
+	} {
+		if _, err := ParseResult(group, bad); err != ErrInvalidEncoding {
+			t.Errorf("%s transcript: %v", name, err)
+		}
+	}
+	r.Winner = 9
+	if _, err := ParseResult(group, mustBytes(t, r, group)); err != ErrInvalidEncoding {
+		t.Errorf("winner out of range: %v", err)
+	}
+}
+
+func mustBytes(t *testing.T, r *Result, group schnorr.Group) []byte {
+	t.Helper()
+	b, err := r.Bytes(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestGenerator(t *testing.T) {
+	for _, id := range []uint16{schnorr.ParamsP256, schnorr.ParamsSecp256k1} {
+		sk, _, err := schnorr.GenerateKeysWithParamsID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		group := sk.Group()
+		H, err := generatorH(group)
+		if err != nil {
+			t.Fatalf("%s: %v", group.Name(), err)
+		}
+		if group.Equal(H, group.ScalarBaseMult(big.NewInt(1))) {
+			t.Errorf("%s: H is G", group.Name())
+		}
+	}
+}
@@ -0,0 +1,460 @@
+/*
+Sender-keys signature layer for end-to-end encrypted group messaging.
+
+Every member of a group signs its group messages with its own sender chain
+instead of signing for every recipient. The chain starts with a random chain
+key ck_0 and a fresh key pair (x_0, X_0) and ratchets after every message:
+
+	t_i    = HMAC(ck_i, 0x01)
+	X_i+1  = TweakPublicKey(X_i, t_i),  x_i+1 = TweakSignatureKey(x_i, X_i, t_i)
+	ck_i+1 = HMAC(ck_i, 0x02)
+
+Message i is signed with x_i, the sender keeps only the current (x, ck). The
+sender announces the chain with a Distribution signed by its identity key,
+which the encryption layer delivers pairwise to the other members. Receivers
+derive X_i themselves from the Distribution, so messages carry no keys.
+Someone who steals the current state can sign later messages but not forge
+earlier ones, HMAC can't be run backwards to the earlier tweaks.
+
+Receivers accept messages out of order: keys of skipped iterations are kept
+(up to MaxSkip per sender) until their message arrives, every iteration is
+accepted once.
+
+Membership changes advance the epoch of the Group. A removed member knows the
+chains of the others, so after RemoveMember the remaining members start new
+chains (NewSender with Group.Epoch) and distribute them; distributions and
+messages of earlier epochs are rejected from then on. Added members only need
+the current distributions of the others.
+
+The payload is opaque: typically the ciphertext of the encryption layer, so
+members can drop forged messages before decrypting them.
+*/
+package senderkeys
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrNotMember       = errors.New("senderkeys: sender isn't a member of the group")
+	ErrUnknownSender   = errors.New("senderkeys: no distribution of the sender's chain")
+	ErrStaleEpoch      = errors.New("senderkeys: chain of an epoch before a membership removal")
+	ErrTooFarAhead     = errors.New("senderkeys: message skips more than MaxSkip iterations")
+	ErrDuplicate       = errors.New("senderkeys: iteration already received or its key expired")
+	ErrBadSignature    = errors.New("senderkeys: invalid signature")
+	ErrWrongGroup      = errors.New("senderkeys: message of another group")
+	ErrInvalidEncoding = errors.New("senderkeys: invalid encoding")
+)
+
+/*
+Keys of skipped iterations kept per sender, messages further ahead are rejected
+*/
+const MaxSkip = 2000
+
+const chainKeyLen = 32
+
+/*
+Start of a sender chain, signed by the identity key of the sender
+*/
+type Distribution struct {
+	Group     string
+	Sender    string // member ID
+	Epoch     uint64
+	Iteration uint32 // first iteration the chain key is valid for
+	ChainKey  []byte
+	PublicKey *schnorr.PublicKey // X of Iteration
+	Signature *schnorr.Signature // by the identity key of Sender
+}
+
+/*
+Signed group message
+*/
+type Message struct {
+	Group     string
+	Sender    string
+	Epoch     uint64
+	Iteration uint32
+	Payload   []byte
+	Signature *schnorr.Signature // by x of Iteration
+}
+
+/*
+Own sender chain of a member
+*/
+type Sender struct {
+	mu        sync.Mutex
+	group     string
+	member    string
+	epoch     uint64
+	iteration uint32
+	chainKey  []byte
+	sk        *schnorr.SignatureKey
+	pk        *schnorr.PublicKey
+	identity  *schnorr.SignatureKey
+}
+
+/*
+Start a new chain of member in the epoch, identity signs the distribution
+*/
+func NewSender(group, member string, epoch uint64, identity *schnorr.SignatureKey) (*Sender, error) {
+	chainKey := make([]byte, chainKeyLen)
+	if _, err := io.ReadFull(entropy.Reader, chainKey); err != nil {
+		return nil, err
+	}
+	sk, pk := schnorr.GenerateKeys()
+	return &Sender{group: group, member: member, epoch: epoch, chainKey: chainKey, sk: sk, pk: pk, identity: identity}, nil
+}
+
+func (s *Sender) Epoch() uint64 {
+	return s.epoch
+}
+
+/*
+Distribution of the current state of the chain, for new members or members
+which lost the earlier one
+*/
+func (s *Sender) Distribution() (*Distribution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := &Distribution{
+		Group:     s.group,
+		Sender:    s.member,
+		Epoch:     s.epoch,
+		Iteration: s.iteration,
+		ChainKey:  append([]byte(nil), s.chainKey...),
+		PublicKey: s.pk,
+	}
+	var err error
+	if d.Signature, err = schnorr.SignBytes(d.signed(), s.identity); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+/*
+Sign the payload with the key of the current iteration and ratchet the chain
+*/
+func (s *Sender) Sign(payload []byte) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := &Message{Group: s.group, Sender: s.member, Epoch: s.epoch, Iteration: s.iteration, Payload: payload}
+	var err error
+	if m.Signature, err = schnorr.SignBytes(m.signed(), s.sk); err != nil {
+		return nil, err
+	}
+	next := ratchetSigningKey(s.sk, s.pk, s.chainKey)
+	s.sk.Zeroize()
+	s.sk = next
+	s.pk, s.chainKey = ratchet(s.pk, s.chainKey)
+	s.iteration++
+	return m, nil
+}
+
+/*
+Group state of a receiving member: identity keys of the members and the
+chains of the senders
+*/
+type Group struct {
+	mu       sync.Mutex
+	id       string
+	epoch    uint64
+	minEpoch uint64 // epoch of the last removal, older chains are rejected
+	members  map[string]*schnorr.PublicKey
+	chains   map[string]*chain
+}
+
+type chain struct {
+	epoch     uint64
+	iteration uint32 // next iteration to derive
+	chainKey  []byte
+	pk        *schnorr.PublicKey            // X of iteration
+	skipped   map[uint32]*schnorr.PublicKey // keys of skipped iterations
+}
+
+/*
+Group with the identity keys of its members by member ID, in epoch 0
+*/
+func NewGroup(id string, members map[string]*schnorr.PublicKey) *Group {
+	g := &Group{id: id, members: make(map[string]*schnorr.PublicKey), chains: make(map[string]*chain)}
+	for member, pk := range members {
+		g.members[member] = pk
+	}
+	return g
+}
+
+func (g *Group) Epoch() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.epoch
+}
+
+/*
+Add a member (or replace its identity key), returns the new epoch
+*/
+func (g *Group) AddMember(member string, identity *schnorr.PublicKey) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.members[member]; ok {
+		// a new identity key invalidates the chain signed with the old one
+		delete(g.chains, member)
+	}
+	g.members[member] = identity
+	g.epoch++
+	return g.epoch
+}
+
+/*
+Remove a member and drop all chains, the remaining members have to start new
+chains in the returned epoch
+*/
+func (g *Group) RemoveMember(member string) (uint64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.members[member]; !ok {
+		return g.epoch, ErrNotMember
+	}
+	delete(g.members, member)
+	g.epoch++
+	g.minEpoch = g.epoch
+	g.chains = make(map[string]*chain)
+	return g.epoch, nil
+}
+
+/*
+Accept the chain of a sender, replaces an earlier chain of the sender
+*/
+func (g *Group) Process(d *Distribution) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	identity, ok := g.members[d.Sender]
+	switch {
+	case d.Group != g.id:
+		return ErrWrongGroup
+	case !ok:
+		return ErrNotMember
+	case d.Epoch < g.minEpoch:
+		return ErrStaleEpoch
+	case len(d.ChainKey) != chainKeyLen || d.PublicKey == nil || d.Signature == nil:
+		return ErrInvalidEncoding
+	case !schnorr.VerifyBytes(d.signed(), d.Signature, identity):
+		return ErrBadSignature
+	}
+	if old, ok := g.chains[d.Sender]; ok && old.epoch == d.Epoch && old.continues(d) {
+		// redistribution of the same chain, keep the keys derived and skipped
+		return nil
+	}
+	g.chains[d.Sender] = &chain{
+		epoch:     d.Epoch,
+		iteration: d.Iteration,
+		chainKey:  append([]byte(nil), d.ChainKey...),
+		pk:        d.PublicKey,
+		skipped:   make(map[uint32]*schnorr.PublicKey),
+	}
+	return nil
+}
+
+/*
+Verify a message of a member, every iteration of a chain is accepted once
+*/
+func (g *Group) Verify(m *Message) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if m.Group != g.id {
+		return ErrWrongGroup
+	}
+	if _, ok := g.members[m.Sender]; !ok {
+		return ErrNotMember
+	}
+	if m.Epoch < g.minEpoch {
+		return ErrStaleEpoch
+	}
+	c, ok := g.chains[m.Sender]
+	if !ok || c.epoch != m.Epoch {
+		return ErrUnknownSender
+	}
+	if m.Signature == nil {
+		return ErrInvalidEncoding
+	}
+
+	if m.Iteration < c.iteration {
+		pk, ok := c.skipped[m.Iteration]
+		if !ok {
+			return ErrDuplicate
+		}
+		if !schnorr.VerifyBytes(m.signed(), m.Signature, pk) {
+			return ErrBadSignature
+		}
+		delete(c.skipped, m.Iteration)
+		return nil
+	}
+	if m.Iteration-c.iteration > MaxSkip || len(c.skipped)+int(m.Iteration-c.iteration) > MaxSkip {
+		return fmt.Errorf("%w: iteration %d, expected %d", ErrTooFarAhead, m.Iteration, c.iteration)
+	}
+
+	// derive up to the iteration of the message, committed only if it verifies
+	pk, chainKey := c.pk, c.chainKey
+	var skipped []*schnorr.PublicKey
+	for i := c.iteration; i < m.Iteration; i++ {
+		skipped = append(skipped, pk)
+		pk, chainKey = ratchet(pk, chainKey)
+	}
+	if !schnorr.VerifyBytes(m.signed(), m.Signature, pk) {
+		return ErrBadSignature
+	}
+	for i, skippedPK := range skipped {
+		c.skipped[c.iteration+uint32(i)] = skippedPK
+	}
+	c.pk, c.chainKey = ratchet(pk, chainKey)
+	c.iteration = m.Iteration + 1
+	return nil
+}
+
+/*
+Returns true if the distribution is of the same chain, its chain key ratchets
+to the chain key of c or the other way around
+*/
+func (c *chain) continues(d *Distribution) bool {
+	from, to, steps := d.ChainKey, c.chainKey, int64(c.iteration)-int64(d.Iteration)
+	if steps < 0 {
+		from, to, steps = c.chainKey, d.ChainKey, -steps
+	}
+	if steps > MaxSkip {
+		return false
+	}
+	for ; steps > 0; steps-- {
+		from = chainMAC(from, 0x02)
+	}
+	return hmac.Equal(from, to)
+}
+
+/*
+Public key and chain key of the next iteration
+*/
+func ratchet(pk *schnorr.PublicKey, chainKey []byte) (*schnorr.PublicKey, []byte) {
+	next, _ := schnorr.TweakPublicKey(pk, chainMAC(chainKey, 0x01))
+	return next, chainMAC(chainKey, 0x02)
+}
+
+func ratchetSigningKey(sk *schnorr.SignatureKey, pk *schnorr.PublicKey, chainKey []byte) *schnorr.SignatureKey {
+	return schnorr.TweakSignatureKey(sk, pk, chainMAC(chainKey, 0x01))
+}
+
+func chainMAC(chainKey []byte, label byte) []byte {
+	mac := hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{label})
+	return mac.Sum(nil)
+}
+
+func (d *Distribution) signed() []byte {
+	return d.fields([]byte("schnorr/senderkeys/distribution"))
+}
+
+func (d *Distribution) fields(b []byte) []byte {
+	b = appendField(b, []byte(d.Group))
+	b = appendField(b, []byte(d.Sender))
+	b = binary.BigEndian.AppendUint64(b, d.Epoch)
+	b = binary.BigEndian.AppendUint32(b, d.Iteration)
+	b = appendField(b, d.ChainKey)
+	return appendField(b, d.PublicKey.Bytes())
+}
+
+func (m *Message) signed() []byte {
+	return m.fields([]byte("schnorr/senderkeys/message"))
+}
+
+func (m *Message) fields(b []byte) []byte {
+	b = appendField(b, []byte(m.Group))
+	b = appendField(b, []byte(m.Sender))
+	b = binary.BigEndian.AppendUint64(b, m.Epoch)
+	b = binary.BigEndian.AppendUint32(b, m.Iteration)
+	return appendField(b, m.Payload)
+}
+
+/*
+Encoding: len(group)||group || len(sender)||sender || epoch (8 bytes) || iteration (4 bytes) ||
+len(chain key)||chain key || len(public key)||public key || len(signature)||signature
+*/
+func (d *Distribution) Bytes() []byte {
+	return appendField(d.fields(nil), d.Signature.Bytes())
+}
+
+func ParseDistribution(b []byte) (*Distribution, error) {
+	d := &Distribution{}
+	group, b, ok := readField(b)
+	sender, b, ok2 := readField(b)
+	if !ok || !ok2 || len(b) < 12 {
+		return nil, ErrInvalidEncoding
+	}
+	d.Group, d.Sender = string(group), string(sender)
+	d.Epoch, d.Iteration = binary.BigEndian.Uint64(b), binary.BigEndian.Uint32(b[8:])
+	chainKey, b, ok := readField(b[12:])
+	pk, b, ok2 := readField(b)
+	signature, rest, ok3 := readField(b)
+	if !ok || !ok2 || !ok3 || len(rest) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	d.ChainKey = chainKey
+	var err error
+	if d.PublicKey, err = schnorr.ParsePublicKey(pk); err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	if d.Signature, err = schnorr.ParseSignature(signature); err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return d, nil
+}
+
+/*
+Encoding: len(group)||group || len(sender)||sender || epoch (8 bytes) || iteration (4 bytes) ||
+len(payload)||payload || len(signature)||signature
+*/
+func (m *Message) Bytes() []byte {
+	return appendField(m.fields(nil), m.Signature.Bytes())
+}
+
+func ParseMessage(b []byte) (*Message, error) {
+	m := &Message{}
+	group, b, ok := readField(b)
+	sender, b, ok2 := readField(b)
+	if !ok || !ok2 || len(b) < 12 {
+		return nil, ErrInvalidEncoding
+	}
+	m.Group, m.Sender = string(group), string(sender)
+	m.Epoch, m.Iteration = binary.BigEndian.Uint64(b), binary.BigEndian.Uint32(b[8:])
+	payload, b, ok := readField(b[12:])
+	signature, rest, ok2 := readField(b)
+	if !ok || !ok2 || len(rest) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	m.Payload = payload
+	var err error
+	if m.Signature, err = schnorr.ParseSignature(signature); err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return m, nil
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
@@ -0,0 +1,260 @@
+package senderkeys
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const groupID = "group-1"
+
+/*
+Group of alice and bob as seen by bob, and the chain of alice distributed to it
+*/
+func setup(t *testing.T) (*Group, *Sender, map[string]*schnorr.SignatureKey) {
+	t.Helper()
+	identities := map[string]*schnorr.SignatureKey{}
+	members := map[string]*schnorr.PublicKey{}
+	for _, member := range []string{"alice", "bob", "carol"} {
+		sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identities[member], members[member] = sk, pk
+	}
+	g := NewGroup(groupID, members)
+	alice, err := NewSender(groupID, "alice", 0, identities["alice"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	distribute(t, g, alice)
+	return g, alice, identities
+}
+
+func distribute(t *testing.T, g *Group, s *Sender) {
+	t.Helper()
+	d, err := s.Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err = ParseDistribution(d.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Process(d); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sign(t *testing.T, s *Sender, n int) []*Message {
+	t.Helper()
+	messages := make([]*Message, n)
+	for i := range messages {
+		m, err := s.Sign([]byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messages[i], err = ParseMessage(m.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return messages
+}
+
+func TestChain(t *testing.T) {
+	g, alice, _ := setup(t)
+	messages := sign(t, alice, 5)
+
+	// in order, then out of order with a gap, every iteration once
+	for _, i := range []int{0, 1, 4, 2} {
+		if err := g.Verify(messages[i]); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	for _, i := range []int{0, 4, 2} {
+		if err := g.Verify(messages[i]); err != ErrDuplicate {
+			t.Errorf("message %d again: %v", i, err)
+		}
+	}
+
+	// a redistribution of the chain keeps the skipped keys
+	distribute(t, g, alice)
+	if err := g.Verify(messages[3]); err != nil {
+		t.Errorf("skipped message after a redistribution: %v", err)
+	}
+
+	// members joining later start at the current iteration
+	late := NewGroup(groupID, g.members)
+	distribute(t, late, alice)
+	if err := late.Verify(messages[4]); err != ErrDuplicate {
+		t.Errorf("message before the distribution: %v", err)
+	}
+	next := sign(t, alice, 1)[0]
+	if err := late.Verify(next); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestForgery(t *testing.T) {
+	g, alice, identities := setup(t)
+	m := sign(t, alice, 1)[0]
+
+	changed := *m
+	changed.Payload = []byte("other")
+	if err := g.Verify(&changed); err != ErrBadSignature {
+		t.Errorf("changed payload: %v", err)
+	}
+	changed = *m
+	changed.Sender = "bob"
+	if err := g.Verify(&changed); err != ErrUnknownSender {
+		t.Errorf("message claiming another sender: %v", err)
+	}
+	changed = *m
+	changed.Group = "group-2"
+	if err := g.Verify(&changed); err != ErrWrongGroup {
+		t.Errorf("message of another group: %v", err)
+	}
+	changed = *m
+	changed.Sender = "mallory"
+	if err := g.Verify(&changed); err != ErrNotMember {
+		t.Errorf("message of a non member: %v", err)
+	}
+
+	// a chain of alice distributed under the identity of carol
+	forged, err := NewSender(groupID, "alice", 0, identities["carol"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := forged.Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Process(d); err != ErrBadSignature {
+		t.Errorf("distribution signed by another member: %v", err)
+	}
+	d, err = alice.Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Iteration--
+	if err := g.Process(d); err != ErrBadSignature {
+		t.Errorf("changed distribution: %v", err)
+	}
+	if err := g.Verify(m); err != nil {
+		t.Errorf("message after rejected distributions: %v", err)
+	}
+
+	// the signature stays valid for its message only
+	skip := sign(t, alice, 3)
+	skip[2].Signature = skip[1].Signature
+	if err := g.Verify(skip[2]); err != ErrBadSignature {
+		t.Errorf("signature of another iteration: %v", err)
+	}
+	if err := g.Verify(skip[1]); err != nil {
+		t.Errorf("message after a forged one: %v", err)
+	}
+}
+
+func TestMaxSkip(t *testing.T) {
+	g, alice, _ := setup(t)
+	m := sign(t, alice, 1)[0]
+	far := *m
+	far.Iteration = MaxSkip + 1
+	if err := g.Verify(&far); !errors.Is(err, ErrTooFarAhead) {
+		t.Errorf("message too far ahead: %v", err)
+	}
+	if err := g.Verify(m); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	g, alice, identities := setup(t)
+	before := sign(t, alice, 2)
+	if err := g.Verify(before[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	epoch, err := g.RemoveMember("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Verify(before[1]); err != ErrStaleEpoch {
+		t.Errorf("message of the chain known to the removed member: %v", err)
+	}
+	d, err := alice.Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Process(d); err != ErrStaleEpoch {
+		t.Errorf("distribution of the old chain: %v", err)
+	}
+	if _, err := g.RemoveMember("carol"); err != ErrNotMember {
+		t.Errorf("removing a removed member: %v", err)
+	}
+
+	alice, err = NewSender(groupID, "alice", epoch, identities["alice"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := sign(t, alice, 1)[0]
+	if err := g.Verify(m); err != ErrUnknownSender {
+		t.Errorf("message before the distribution: %v", err)
+	}
+	distribute(t, g, alice)
+	if err := g.Verify(sign(t, alice, 1)[0]); err != nil {
+		t.Errorf("message of the new chain: %v", err)
+	}
+
+	// a new identity key drops the chain signed with the old one
+	_, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.AddMember("alice", pk) != epoch+1 {
+		t.Errorf("epoch %d after adding a member", g.Epoch())
+	}
+	if err := g.Verify(sign(t, alice, 1)[0]); err != ErrUnknownSender {
+		t.Errorf("chain of the replaced identity key: %v", err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	g, alice, _ := setup(t)
+	d, err := alice.Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := sign(t, alice, 1)[0]
+	fields := d.fields(nil)
+	withoutKey := fields[:len(fields)-4-len(d.PublicKey.Bytes())]
+
+	for name, b := range map[string][]byte{
+		"empty":     nil,
+		"truncated": d.Bytes()[:len(d.Bytes())-1],
+		"trailing":  append(d.Bytes(), 0),
+		"sender":    appendField(nil, []byte(groupID)),
+		"key":       appendField(appendField(withoutKey, []byte{1, 2, 3}), d.Signature.Bytes()),
+	} {
+		if _, err := ParseDistribution(b); err != ErrInvalidEncoding {
+			t.Errorf("%s distribution: %v", name, err)
+		}
+	}
+	for name, b := range map[string][]byte{
+		"empty":     nil,
+		"truncated": m.Bytes()[:len(m.Bytes())-1],
+		"trailing":  append(m.Bytes(), 0),
+		"iteration": appendField(appendField(nil, []byte(groupID)), []byte("alice")),
+		"length":    append(m.fields(nil), 0xff, 0xff, 0xff, 0xff),
+		"signature": appendField(m.fields(nil), []byte{1}),
+	} {
+		if _, err := ParseMessage(b); err != ErrInvalidEncoding {
+			t.Errorf("%s message: %v", name, err)
+		}
+	}
+
+	d.ChainKey = d.ChainKey[:16]
+	if err := g.Process(d); err != ErrInvalidEncoding {
+		t.Errorf("short chain key: %v", err)
+	}
+}
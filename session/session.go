@@ -0,0 +1,514 @@
+/*
+Revocable session tokens signed with epoch keys.
+
+A session token is a set of claims (subject, audience, lifetime, attributes)
+signed by the issuer's key of the current epoch. Verifiers hold only the
+published key set, the public keys of the epochs still accepted, and check
+tokens without asking the issuer or keeping a session database:
+
+	issuer, err := session.NewIssuer(session.IssuerOptions{TTL: time.Hour})
+	token, err := issuer.Issue(session.Claims{Subject: "user-42", Audience: "api"})
+
+	http.Handle("/.well-known/session-keys", issuer.KeySetHandler())
+
+	v, err := session.NewVerifier(keySet)   // fetched from the endpoint
+	v.Audience = "api"
+	claims, err := v.Verify(token)
+
+Epochs replace the shared HMAC secret of JWT setups and make revocation a key
+operation instead of a blocklist:
+
+  - Rotate starts a new epoch. Tokens of the previous epochs stay valid until
+    they expire, their keys are published until then (MaxTTL after the rotation).
+  - Revoke starts a new epoch and revokes all earlier ones: their keys leave the
+    key set and the set's MinEpoch rises, so every token issued before is
+    rejected as soon as the verifiers load the new set.
+
+Revocation takes effect within the refresh interval of the verifiers (the
+key set is served with max-age KeySetMaxAge). Verifiers refuse key sets with a
+lower MinEpoch than the one they have, so an old cached set can't bring revoked
+epochs back, but the key set itself isn't signed: serve it over an
+authenticated channel.
+
+Tokens are "v1." || base64url(claims) || "." || base64url(signature) and the
+signature is over "schnorr/session" || claims, see Claims.Bytes.
+*/
+package session
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const (
+	version = 1
+	prefix  = "v1."
+	domain  = "schnorr/session"
+)
+
+var (
+	ErrNoToken          = errors.New("session: request has no bearer token")
+	ErrMalformed        = errors.New("session: malformed token")
+	ErrInvalidSignature = errors.New("session: invalid token signature")
+	ErrExpired          = errors.New("session: token has expired")
+	ErrNotYetValid      = errors.New("session: token is issued in the future")
+	ErrLifetime         = errors.New("session: token lifetime exceeds the maximum of the key set")
+	ErrAudience         = errors.New("session: token is issued for another audience")
+	ErrRevoked          = errors.New("session: token epoch has been revoked")
+	ErrUnknownEpoch     = errors.New("session: no key for the token epoch")
+	ErrInvalidKeySet    = errors.New("session: invalid key set")
+	ErrKeySetRollback   = errors.New("session: key set would restore revoked epochs")
+)
+
+/*
+Claims of a session token. Epoch, Issued and Expires are set by the issuer.
+*/
+type Claims struct {
+	Epoch      uint64
+	Subject    string
+	Audience   string // "" for tokens accepted by every verifier
+	Issued     time.Time
+	Expires    time.Time
+	Attributes map[string]string // application claims, e.g. roles
+}
+
+/*
+Encoding: version || epoch || issued || expires || field(subject) ||
+field(audience) || count || (field(name) || field(value))... with unix times of
+8 bytes, fields with 4 byte lengths, a 2 byte count and attributes sorted by name
+*/
+func (c *Claims) Bytes() []byte {
+	buf := []byte{version}
+	buf = binary.BigEndian.AppendUint64(buf, c.Epoch)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(c.Issued.Unix()))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(c.Expires.Unix()))
+	buf = appendField(buf, []byte(c.Subject))
+	buf = appendField(buf, []byte(c.Audience))
+
+	names := make([]string, 0, len(c.Attributes))
+	for name := range c.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(names)))
+	for _, name := range names {
+		buf = appendField(appendField(buf, []byte(name)), []byte(c.Attributes[name]))
+	}
+	return buf
+}
+
+func ParseClaims(b []byte) (*Claims, error) {
+	if len(b) < 1+3*8 || b[0] != version {
+		return nil, ErrMalformed
+	}
+	c := &Claims{
+		Epoch:   binary.BigEndian.Uint64(b[1:]),
+		Issued:  time.Unix(int64(binary.BigEndian.Uint64(b[9:])), 0),
+		Expires: time.Unix(int64(binary.BigEndian.Uint64(b[17:])), 0),
+	}
+	b = b[25:]
+
+	var subject, audience []byte
+	var err error
+	if subject, b, err = readField(b); err != nil {
+		return nil, err
+	}
+	if audience, b, err = readField(b); err != nil {
+		return nil, err
+	}
+	c.Subject, c.Audience = string(subject), string(audience)
+
+	if len(b) < 2 {
+		return nil, ErrMalformed
+	}
+	count := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if count > 0 {
+		c.Attributes = make(map[string]string, count)
+	}
+	last := ""
+	for i := 0; i < count; i++ {
+		var name, value []byte
+		if name, b, err = readField(b); err != nil {
+			return nil, err
+		}
+		if value, b, err = readField(b); err != nil {
+			return nil, err
+		}
+		// sorted and unique, so every claim set has a single encoding
+		if i > 0 && string(name) <= last {
+			return nil, ErrMalformed
+		}
+		last = string(name)
+		c.Attributes[last] = string(value)
+	}
+	if len(b) != 0 {
+		return nil, ErrMalformed
+	}
+	return c, nil
+}
+
+func message(claims []byte) string {
+	return domain + string(claims)
+}
+
+/*
+Options of NewIssuer, zero values select the defaults
+*/
+type IssuerOptions struct {
+	ParamsID     uint16        // registered parameters of the epoch keys, default schnorr.ParamsP256
+	TTL          time.Duration // lifetime of tokens issued without Expires, default 1 hour
+	MaxTTL       time.Duration // longest token lifetime, default 24 hours
+	KeySetMaxAge time.Duration // caching of the key set by verifiers, bounds the revocation delay; default 1 minute
+}
+
+type epochKey struct {
+	sk      *schnorr.SignatureKey // nil once the epoch has ended
+	pk      *schnorr.PublicKey
+	retires time.Time // end of publication, zero for the current epoch
+}
+
+/*
+Issuer of session tokens, safe for concurrent use
+*/
+type Issuer struct {
+	opts IssuerOptions
+	now  func() time.Time
+
+	mu       sync.Mutex
+	current  uint64
+	minEpoch uint64
+	keys     map[uint64]*epochKey
+}
+
+/*
+Issuer starting in epoch 1 with a freshly generated key
+*/
+func NewIssuer(opts IssuerOptions) (*Issuer, error) {
+	if opts.ParamsID == 0 {
+		opts.ParamsID = schnorr.ParamsP256
+	}
+	if opts.MaxTTL <= 0 {
+		opts.MaxTTL = 24 * time.Hour
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = time.Hour
+		if opts.MaxTTL < opts.TTL {
+			opts.TTL = opts.MaxTTL
+		}
+	}
+	if opts.KeySetMaxAge <= 0 {
+		opts.KeySetMaxAge = time.Minute
+	}
+	if opts.TTL > opts.MaxTTL {
+		return nil, ErrLifetime
+	}
+	if _, err := schnorr.LookupGroup(opts.ParamsID); err != nil {
+		return nil, err
+	}
+
+	i := &Issuer{opts: opts, now: schnorr.Now, keys: make(map[uint64]*epochKey)}
+	if _, err := i.advance(false); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+/*
+Signed token of the claims in the current epoch. Issued is set to now and a
+zero Expires to now + TTL.
+*/
+func (i *Issuer) Issue(c Claims) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	c.Epoch, c.Issued = i.current, now.Truncate(time.Second)
+	if c.Expires.IsZero() {
+		c.Expires = c.Issued.Add(i.opts.TTL)
+	}
+	if !c.Expires.After(c.Issued) || c.Expires.Sub(c.Issued) > i.opts.MaxTTL {
+		return "", ErrLifetime
+	}
+
+	claims := c.Bytes()
+	signature, err := schnorr.TrySign(message(claims), i.keys[i.current].sk)
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(claims) + "." +
+		base64.RawURLEncoding.EncodeToString(signature.Bytes()), nil
+}
+
+/*
+Start a new epoch, tokens of the earlier epochs stay valid until they expire.
+Returns the new epoch.
+*/
+func (i *Issuer) Rotate() (uint64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.advance(false)
+}
+
+/*
+Start a new epoch and revoke all earlier ones, every token issued so far is
+rejected by verifiers with the new key set. Returns the new epoch.
+*/
+func (i *Issuer) Revoke() (uint64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.advance(true)
+}
+
+/*
+Generate the key of the next epoch, i.mu has to be held
+*/
+func (i *Issuer) advance(revoke bool) (uint64, error) {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(i.opts.ParamsID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := i.now()
+	epoch := i.current + 1
+	for old, key := range i.keys {
+		if revoke {
+			delete(i.keys, old)
+		} else if key.sk != nil {
+			key.sk, key.retires = nil, now.Add(i.opts.MaxTTL)
+		}
+	}
+	if revoke {
+		i.minEpoch = epoch
+	}
+	i.keys[epoch] = &epochKey{sk: sk, pk: pk}
+	i.current = epoch
+	return epoch, nil
+}
+
+/*
+Published key set, the JSON served by KeySetHandler
+*/
+type KeySet struct {
+	Current  uint64     `json:"current"`
+	MinEpoch uint64     `json:"min_epoch"` // tokens of earlier epochs are revoked
+	MaxTTL   int64      `json:"max_ttl"`   // longest token lifetime, seconds
+	Epochs   []EpochKey `json:"epochs"`    // accepted epochs, oldest first
+}
+
+type EpochKey struct {
+	Epoch     uint64 `json:"epoch"`
+	PublicKey string `json:"public_key"`        // hex of schnorr.PublicKey.Bytes
+	Retires   int64  `json:"retires,omitempty"` // unix time the key leaves the set, 0 for the current epoch
+}
+
+/*
+Current key set. Keys of rotated epochs are dropped once all their tokens have
+expired.
+*/
+func (i *Issuer) KeySet() *KeySet {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	ks := &KeySet{Current: i.current, MinEpoch: i.minEpoch, MaxTTL: int64(i.opts.MaxTTL / time.Second)}
+	for epoch, key := range i.keys {
+		if !key.retires.IsZero() && now.After(key.retires) {
+			delete(i.keys, epoch)
+			continue
+		}
+		info := EpochKey{Epoch: epoch, PublicKey: hex.EncodeToString(key.pk.Bytes())}
+		if !key.retires.IsZero() {
+			info.Retires = key.retires.Unix()
+		}
+		ks.Epochs = append(ks.Epochs, info)
+	}
+	sort.Slice(ks.Epochs, func(a, b int) bool { return ks.Epochs[a].Epoch < ks.Epochs[b].Epoch })
+	return ks
+}
+
+/*
+GET endpoint serving the key set, cacheable for KeySetMaxAge
+*/
+func (i *Issuer) KeySetHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(i.opts.KeySetMaxAge/time.Second)))
+		json.NewEncoder(w).Encode(i.KeySet())
+	})
+}
+
+/*
+Stateless token verifier, safe for concurrent use. Load a new key set with
+SetKeySet whenever the published one may have changed.
+*/
+type Verifier struct {
+	Audience string        // required audience, "" accepts tokens of any audience
+	Leeway   time.Duration // tolerated clock skew of the issuer
+
+	now func() time.Time
+
+	mu       sync.RWMutex
+	current  uint64
+	minEpoch uint64
+	maxTTL   time.Duration
+	keys     map[uint64]*schnorr.FastVerifier
+}
+
+func NewVerifier(ks *KeySet) (*Verifier, error) {
+	v := &Verifier{Leeway: time.Minute, now: schnorr.Now}
+	if err := v.SetKeySet(ks); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+/*
+Replace the accepted keys with the key set. Sets with a lower MinEpoch than
+the loaded one are refused with ErrKeySetRollback.
+*/
+func (v *Verifier) SetKeySet(ks *KeySet) error {
+	if ks == nil || ks.MaxTTL <= 0 || ks.MinEpoch > ks.Current {
+		return ErrInvalidKeySet
+	}
+	keys := make(map[uint64]*schnorr.FastVerifier, len(ks.Epochs))
+	for _, info := range ks.Epochs {
+		if info.Epoch < ks.MinEpoch || info.Epoch > ks.Current {
+			return ErrInvalidKeySet
+		}
+		b, err := hex.DecodeString(info.PublicKey)
+		if err != nil {
+			return ErrInvalidKeySet
+		}
+		pk, err := schnorr.ParsePublicKey(b)
+		if err != nil {
+			return ErrInvalidKeySet
+		}
+		if keys[info.Epoch], err = schnorr.NewFastVerifier(pk, 0); err != nil {
+			return ErrInvalidKeySet
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if ks.MinEpoch < v.minEpoch {
+		return ErrKeySetRollback
+	}
+	v.current, v.minEpoch, v.maxTTL, v.keys = ks.Current, ks.MinEpoch, time.Duration(ks.MaxTTL)*time.Second, keys
+	return nil
+}
+
+/*
+Verify the token, returns its claims. ErrUnknownEpoch for tokens of an epoch
+newer than the key set, which should be reloaded then.
+*/
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	encoded, ok := strings.CutPrefix(token, prefix)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	encodedClaims, encodedSignature, ok := strings.Cut(encoded, ".")
+	if !ok {
+		return nil, ErrMalformed
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encodedClaims)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	c, err := ParseClaims(b)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	signature, err := schnorr.ParseSignature(sig)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	v.mu.RLock()
+	key, ok := v.keys[c.Epoch]
+	current, minEpoch, maxTTL := v.current, v.minEpoch, v.maxTTL
+	v.mu.RUnlock()
+	switch {
+	case c.Epoch < minEpoch:
+		return nil, ErrRevoked
+	case !ok && c.Epoch > current:
+		return nil, ErrUnknownEpoch
+	case !ok:
+		// keys of rotated epochs leave the set after all their tokens expired
+		return nil, ErrExpired
+	case !key.Verify(message(b), signature):
+		return nil, ErrInvalidSignature
+	}
+
+	now := v.now()
+	switch {
+	case !now.Before(c.Expires):
+		return nil, ErrExpired
+	case c.Issued.After(now.Add(v.Leeway)):
+		return nil, ErrNotYetValid
+	case c.Expires.Sub(c.Issued) > maxTTL:
+		return nil, ErrLifetime
+	case v.Audience != "" && c.Audience != v.Audience:
+		return nil, ErrAudience
+	}
+	return c, nil
+}
+
+/*
+Verify the bearer token of the Authorization header
+*/
+func (v *Verifier) VerifyRequest(r *http.Request) (*Claims, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(token, prefix) {
+		return nil, ErrNoToken
+	}
+	return v.Verify(token)
+}
+
+/*
+ID of the key of the epoch, "" if the key set has none
+*/
+func (v *Verifier) KeyID(epoch uint64) string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[epoch]; ok {
+		return key.PublicKey().KeyID()
+	}
+	return ""
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, ErrMalformed
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, ErrMalformed
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
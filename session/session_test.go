@@ -0,0 +1,226 @@
+package session
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+Issuer and verifier on a manual clock, the verifier loading the key set from
+the issuer's endpoint
+*/
+func setup(t *testing.T) (*Issuer, *Verifier, *time.Time, func()) {
+	t.Helper()
+	now := time.Unix(1700000000, 0)
+	i, err := NewIssuer(IssuerOptions{TTL: time.Hour, MaxTTL: 2 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.now = func() time.Time { return now }
+	server := httptest.NewServer(i.KeySetHandler())
+	t.Cleanup(server.Close)
+
+	fetch := func() *KeySet {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var ks KeySet
+		if err := json.NewDecoder(resp.Body).Decode(&ks); err != nil {
+			t.Fatal(err)
+		}
+		return &ks
+	}
+	v, err := NewVerifier(fetch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = i.now
+	reload := func() {
+		if err := v.SetKeySet(fetch()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return i, v, &now, reload
+}
+
+func issue(t *testing.T, i *Issuer, c Claims) string {
+	t.Helper()
+	token, err := i.Issue(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRoundTrip(t *testing.T) {
+	i, v, _, _ := setup(t)
+	token := issue(t, i, Claims{Subject: "user-42", Audience: "api", Attributes: map[string]string{"role": "admin", "org": "acme"}})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	c, err := v.VerifyRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != "user-42" || c.Attributes["role"] != "admin" || c.Epoch != 1 || c.Expires.Sub(c.Issued) != time.Hour {
+		t.Fatalf("claims %+v", c)
+	}
+	if v.KeyID(1) == "" || v.KeyID(2) != "" {
+		t.Errorf("key IDs %q, %q", v.KeyID(1), v.KeyID(2))
+	}
+
+	v.Audience = "billing"
+	if _, err := v.Verify(token); err != ErrAudience {
+		t.Errorf("other audience: %v", err)
+	}
+}
+
+func TestRotateAndRevoke(t *testing.T) {
+	i, v, now, reload := setup(t)
+	first := issue(t, i, Claims{Subject: "user-42"})
+
+	if _, err := i.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	second := issue(t, i, Claims{Subject: "user-42"})
+	if _, err := v.Verify(second); err != ErrUnknownEpoch {
+		t.Errorf("token of an epoch the verifier hasn't loaded: %v", err)
+	}
+	reload()
+	for _, token := range []string{first, second} {
+		if _, err := v.Verify(token); err != nil {
+			t.Errorf("after the rotation: %v", err)
+		}
+	}
+
+	*now = now.Add(90 * time.Minute)
+	if _, err := v.Verify(first); err != ErrExpired {
+		t.Errorf("expired token: %v", err)
+	}
+
+	stale := i.KeySet()
+	if _, err := i.Revoke(); err != nil {
+		t.Fatal(err)
+	}
+	reload()
+	if _, err := v.Verify(second); err != ErrRevoked {
+		t.Errorf("token of a revoked epoch: %v", err)
+	}
+	if _, err := v.Verify(issue(t, i, Claims{Subject: "user-42"})); err != nil {
+		t.Errorf("token of the new epoch: %v", err)
+	}
+	if err := v.SetKeySet(stale); err != ErrKeySetRollback {
+		t.Errorf("key set from before the revocation: %v", err)
+	}
+}
+
+func TestLifetime(t *testing.T) {
+	i, v, now, _ := setup(t)
+	if _, err := i.Issue(Claims{Expires: now.Add(3 * time.Hour)}); err != ErrLifetime {
+		t.Errorf("lifetime over MaxTTL: %v", err)
+	}
+	if _, err := i.Issue(Claims{Expires: now.Add(-time.Minute)}); err != ErrLifetime {
+		t.Errorf("expired at issuance: %v", err)
+	}
+
+	// issued by a clock ahead of the verifier's
+	i.now = func() time.Time { return now.Add(10 * time.Minute) }
+	token := issue(t, i, Claims{})
+	if _, err := v.Verify(token); err != ErrNotYetValid {
+		t.Errorf("token from the future: %v", err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	i, v, _, _ := setup(t)
+	token := issue(t, i, Claims{Subject: "user-42", Attributes: map[string]string{"role": "user"}})
+	claims, signature, _ := strings.Cut(strings.TrimPrefix(token, prefix), ".")
+
+	b, _ := base64.RawURLEncoding.DecodeString(claims)
+	c, err := ParseClaims(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Attributes["role"] = "admin"
+	forged := prefix + base64.RawURLEncoding.EncodeToString(c.Bytes()) + "." + signature
+	if _, err := v.Verify(forged); err != ErrInvalidSignature {
+		t.Errorf("changed claims: %v", err)
+	}
+
+	other := issue(t, i, Claims{Subject: "user-43"})
+	_, otherSignature, _ := strings.Cut(other, ".")
+	_, otherSignature, _ = strings.Cut(otherSignature, ".")
+	if _, err := v.Verify(prefix + claims + "." + otherSignature); err != ErrInvalidSignature {
+		t.Errorf("signature of another token: %v", err)
+	}
+
+	// a key set of another issuer
+	stranger, err := NewIssuer(IssuerOptions{MaxTTL: 2 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger.now = i.now
+	if _, err := v.Verify(issue(t, stranger, Claims{Subject: "user-42"})); err != ErrInvalidSignature {
+		t.Errorf("token of another issuer: %v", err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	i, v, _, _ := setup(t)
+	token := issue(t, i, Claims{Subject: "user-42"})
+	claims, signature, _ := strings.Cut(strings.TrimPrefix(token, prefix), ".")
+	for _, bad := range []string{
+		"",
+		strings.TrimPrefix(token, prefix),
+		"v2." + claims + "." + signature,
+		prefix + claims,
+		prefix + "!!." + signature,
+		prefix + claims + ".!!",
+		prefix + claims + ".AAAA",
+		prefix + claims[:len(claims)-4] + "." + signature,
+	} {
+		if _, err := v.Verify(bad); err != ErrMalformed {
+			t.Errorf("token %q: %v", bad, err)
+		}
+	}
+
+	c := Claims{Subject: "user-42", Attributes: map[string]string{"a": "1", "b": "2"}}
+	b := c.Bytes()
+	if _, err := ParseClaims(append(b, 0)); err != ErrMalformed {
+		t.Errorf("trailing byte: %v", err)
+	}
+	// attributes out of order
+	swapped := strings.Replace(string(b), "\x00\x00\x00\x01a\x00\x00\x00\x011\x00\x00\x00\x01b\x00\x00\x00\x012",
+		"\x00\x00\x00\x01b\x00\x00\x00\x012\x00\x00\x00\x01a\x00\x00\x00\x011", 1)
+	if _, err := ParseClaims([]byte(swapped)); err != ErrMalformed {
+		t.Errorf("unsorted attributes: %v", err)
+	}
+
+	for _, header := range []string{"", "Basic dXNlcjpwYXNz", "Bearer", "Bearer eyJ.x.y"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", header)
+		if _, err := v.VerifyRequest(r); err != ErrNoToken {
+			t.Errorf("authorization %q: %v", header, err)
+		}
+	}
+
+	for _, ks := range []*KeySet{
+		nil,
+		{Current: 1, MaxTTL: 0},
+		{Current: 1, MinEpoch: 2, MaxTTL: 60},
+		{Current: 1, MaxTTL: 60, Epochs: []EpochKey{{Epoch: 2, PublicKey: "00"}}},
+		{Current: 1, MaxTTL: 60, Epochs: []EpochKey{{Epoch: 1, PublicKey: "zz"}}},
+		{Current: 1, MaxTTL: 60, Epochs: []EpochKey{{Epoch: 1, PublicKey: "0001"}}},
+	} {
+		if _, err := NewVerifier(ks); err != ErrInvalidKeySet {
+			t.Errorf("key set %+v: %v", ks, err)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Expiring capability URLs signed with Schnorr keys.
+
+A signed URL grants whoever holds it one kind of request to one resource until
+it expires, e.g. a temporary download link of object storage. Unlike links
+signed with an HMAC secret, verifying services only need the public key of
+the issuer:
+
+	link, err := signedurl.Sign("https://files.example.com/reports/q3.pdf?download=1", sk, pk,
+		signedurl.Options{TTL: 15 * time.Minute})
+
+	v := signedurl.NewVerifier(keys)
+	capability, err := v.VerifyRequest(r)
+
+Sign adds the query parameters
+
+	X-Schnorr-Key        key ID of the issuer
+	X-Schnorr-Date       unix time of issuance
+	X-Schnorr-Expires    unix time of expiry
+	X-Schnorr-IP         client IP the link is bound to, only with Options.IP
+	X-Schnorr-Signature  base64url signature
+
+and signs
+
+	"schnorr/signed-url" || len(method)||method || len(host)||host || len(path)||path || len(query)||query
+
+with 4 byte lengths, the lowercase host (with port) and the escaped path of
+the URL. The query is canonical: every parameter but the signature,
+percent-encoded (RFC 3986, space as %20), sorted by name and then by value and
+joined with '&', so reordering or re-encoding the query on the way doesn't
+break the link and adding, removing or changing a parameter does. The scheme
+isn't signed, TLS is usually terminated before the service.
+*/
+package signedurl
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Query parameters of signed URLs
+*/
+const (
+	ParamKey       = "X-Schnorr-Key"
+	ParamDate      = "X-Schnorr-Date"
+	ParamExpires   = "X-Schnorr-Expires"
+	ParamIP        = "X-Schnorr-IP"
+	ParamSignature = "X-Schnorr-Signature"
+)
+
+const domain = "schnorr/signed-url"
+
+var (
+	ErrNoSignature      = errors.New("signedurl: URL isn't signed")
+	ErrMalformed        = errors.New("signedurl: malformed signed URL")
+	ErrExpired          = errors.New("signedurl: URL has expired")
+	ErrNotYetValid      = errors.New("signedurl: URL is issued in the future")
+	ErrLifetime         = errors.New("signedurl: URL lifetime exceeds the verifier's maximum")
+	ErrIPMismatch       = errors.New("signedurl: URL is bound to another client IP")
+	ErrInvalidSignature = errors.New("signedurl: invalid signature")
+)
+
+/*
+Options of Sign, zero values select the defaults
+*/
+type Options struct {
+	Method string        // bound HTTP method, default GET
+	TTL    time.Duration // lifetime, default 1 hour
+	IP     net.IP        // client IP the link is bound to, nil for any client
+}
+
+/*
+Sign the URL, returns it with the signature parameters added. The URL must not
+already contain parameters named like the signature parameters.
+*/
+func Sign(rawURL string, sk *schnorr.SignatureKey, pk *schnorr.PublicKey, opts Options) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("%w: URL has no host", ErrMalformed)
+	}
+	if opts.Method == "" {
+		opts.Method = http.MethodGet
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = time.Hour
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{ParamKey, ParamDate, ParamExpires, ParamIP, ParamSignature} {
+		if query.Has(name) {
+			return "", fmt.Errorf("%w: URL already has the %s parameter", ErrMalformed, name)
+		}
+	}
+	now := schnorr.Now()
+	query.Set(ParamKey, pk.KeyID())
+	query.Set(ParamDate, strconv.FormatInt(now.Unix(), 10))
+	query.Set(ParamExpires, strconv.FormatInt(now.Add(opts.TTL).Unix(), 10))
+	if opts.IP != nil {
+		query.Set(ParamIP, opts.IP.String())
+	}
+
+	signature, err := schnorr.TrySign(message(opts.Method, u.Host, u.EscapedPath(), query), sk)
+	if err != nil {
+		return "", err
+	}
+	u.RawQuery = canonicalQuery(query) + "&" + ParamSignature + "=" + base64.RawURLEncoding.EncodeToString(signature.Bytes())
+	return u.String(), nil
+}
+
+/*
+Access granted by a verified URL
+*/
+type Capability struct {
+	KeyID   string // issuer
+	Method  string
+	Host    string
+	Path    string // escaped path
+	Issued  time.Time
+	Expires time.Time
+	IP      net.IP // nil if the link isn't bound to a client
+}
+
+/*
+Checks signed URLs
+*/
+type Verifier struct {
+	Keys        envelope.KeyResolver
+	MaxLifetime time.Duration // longest accepted expiry - issuance, default 7 days
+	Leeway      time.Duration // tolerated clock skew of the issuer, default 1 minute
+
+	// Client IP of the request for IP-bound links, default the host of
+	// RemoteAddr; behind a proxy return the address it forwards instead
+	ClientIP func(r *http.Request) net.IP
+}
+
+func NewVerifier(keys envelope.KeyResolver) *Verifier {
+	return &Verifier{Keys: keys, MaxLifetime: 7 * 24 * time.Hour, Leeway: time.Minute}
+}
+
+/*
+Verify the URL of the request, bound to its method, Host and client IP
+*/
+func (v *Verifier) VerifyRequest(r *http.Request) (*Capability, error) {
+	clientIP := v.ClientIP
+	if clientIP == nil {
+		clientIP = remoteIP
+	}
+	u := *r.URL
+	u.Host = r.Host
+	return v.Verify(r.Method, u.String(), clientIP(r))
+}
+
+/*
+Verify a signed URL used with the method by the client with the IP (nil if unknown)
+*/
+func (v *Verifier) Verify(method, rawURL string, clientIP net.IP) (*Capability, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !query.Has(ParamSignature) {
+		return nil, ErrNoSignature
+	}
+	for _, name := range []string{ParamKey, ParamDate, ParamExpires, ParamIP, ParamSignature} {
+		if len(query[name]) > 1 {
+			return nil, fmt.Errorf("%w: repeated %s parameter", ErrMalformed, name)
+		}
+	}
+	encoded, err := base64.RawURLEncoding.DecodeString(query.Get(ParamSignature))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	signature, err := schnorr.ParseSignature(encoded)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	query.Del(ParamSignature)
+
+	c := &Capability{KeyID: query.Get(ParamKey), Method: method, Host: strings.ToLower(u.Host), Path: u.EscapedPath()}
+	issued, err1 := strconv.ParseInt(query.Get(ParamDate), 10, 64)
+	expires, err2 := strconv.ParseInt(query.Get(ParamExpires), 10, 64)
+	if c.KeyID == "" || err1 != nil || err2 != nil {
+		return nil, ErrMalformed
+	}
+	c.Issued, c.Expires = time.Unix(issued, 0), time.Unix(expires, 0)
+	if query.Has(ParamIP) {
+		if c.IP = net.ParseIP(query.Get(ParamIP)); c.IP == nil {
+			return nil, ErrMalformed
+		}
+	}
+
+	pk, err := v.Keys.PublicKey(c.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if !schnorr.VerifySignature(message(method, u.Host, c.Path, query), signature, pk) {
+		return nil, ErrInvalidSignature
+	}
+
+	now := schnorr.Now()
+	switch {
+	case now.After(c.Expires):
+		return nil, ErrExpired
+	case c.Issued.After(now.Add(v.Leeway)):
+		return nil, ErrNotYetValid
+	case v.MaxLifetime > 0 && c.Expires.Sub(c.Issued) > v.MaxLifetime:
+		return nil, ErrLifetime
+	case c.IP != nil && !c.IP.Equal(clientIP):
+		return nil, ErrIPMismatch
+	}
+	return c, nil
+}
+
+func message(method, host, path string, query url.Values) string {
+	m := appendField([]byte(domain), []byte(method))
+	m = appendField(m, []byte(strings.ToLower(host)))
+	m = appendField(m, []byte(path))
+	return string(appendField(m, []byte(canonicalQuery(query))))
+}
+
+/*
+Parameters percent-encoded, sorted by name and value, joined with '&'
+*/
+func canonicalQuery(query url.Values) string {
+	var pairs [][2]string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{escape(name), escape(value)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	var b strings.Builder
+	for i, pair := range pairs {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(pair[0] + "=" + pair[1])
+	}
+	return b.String()
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
@@ -0,0 +1,168 @@
+package signedurl
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/envelope"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const link = "https://files.example.com/reports/q3%20final.pdf?download=1&lang=en"
+
+func setup(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey, *Verifier, *schnorr.ManualClock) {
+	t.Helper()
+	clock := schnorr.NewManualClock(time.Unix(1700000000, 0))
+	schnorr.SetClock(clock)
+	t.Cleanup(func() { schnorr.SetClock(nil) })
+
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := envelope.KeyMap{}
+	keys.Add(pk)
+	return sk, pk, NewVerifier(keys), clock
+}
+
+func sign(t *testing.T, sk *schnorr.SignatureKey, pk *schnorr.PublicKey, opts Options) string {
+	t.Helper()
+	signed, err := Sign(link, sk, pk, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestRoundTrip(t *testing.T) {
+	sk, pk, v, _ := setup(t)
+	signed := sign(t, sk, pk, Options{TTL: 15 * time.Minute})
+
+	r := httptest.NewRequest("GET", signed, nil)
+	c, err := v.VerifyRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.KeyID != pk.KeyID() || c.Host != "files.example.com" || c.Path != "/reports/q3%20final.pdf" || c.Expires.Sub(c.Issued) != 15*time.Minute {
+		t.Fatalf("capability %+v", c)
+	}
+
+	// the query reordered and re-encoded on the way
+	u, _ := url.Parse(signed)
+	query := u.Query()
+	u.RawQuery = query.Encode()
+	if _, err := v.Verify("GET", strings.Replace(u.String(), "files.example.com", "FILES.example.com", 1), nil); err != nil {
+		t.Errorf("reordered query: %v", err)
+	}
+
+	ip := net.ParseIP("192.0.2.7")
+	bound := sign(t, sk, pk, Options{Method: "PUT", IP: ip})
+	if _, err := v.Verify("PUT", bound, ip); err != nil {
+		t.Errorf("IP bound link: %v", err)
+	}
+	if _, err := v.Verify("PUT", bound, net.ParseIP("192.0.2.8")); err != ErrIPMismatch {
+		t.Errorf("IP bound link used by another client: %v", err)
+	}
+	r = httptest.NewRequest("PUT", bound, nil)
+	r.RemoteAddr = "192.0.2.7:51234"
+	if _, err := v.VerifyRequest(r); err != nil {
+		t.Errorf("IP bound request: %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	sk, pk, v, clock := setup(t)
+	signed := sign(t, sk, pk, Options{TTL: time.Hour})
+	clock.Advance(61 * time.Minute)
+	if _, err := v.Verify("GET", signed, nil); err != ErrExpired {
+		t.Errorf("expired link: %v", err)
+	}
+
+	long := sign(t, sk, pk, Options{TTL: 8 * 24 * time.Hour})
+	if _, err := v.Verify("GET", long, nil); err != ErrLifetime {
+		t.Errorf("lifetime over the maximum: %v", err)
+	}
+
+	clock.Advance(10 * time.Minute)
+	future := sign(t, sk, pk, Options{})
+	clock.Advance(-10 * time.Minute)
+	if _, err := v.Verify("GET", future, nil); err != ErrNotYetValid {
+		t.Errorf("link from the future: %v", err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	sk, pk, v, _ := setup(t)
+	signed := sign(t, sk, pk, Options{})
+
+	for name, changed := range map[string]string{
+		"host":             strings.Replace(signed, "files.example.com", "evil.example.com", 1),
+		"path":             strings.Replace(signed, "q3%20final", "q4%20final", 1),
+		"query":            strings.Replace(signed, "lang=en", "lang=de", 1),
+		"added parameter":  signed + "&admin=1",
+		"removed":          strings.Replace(signed, "download=1&", "", 1),
+		"expiry":           replaceParam(t, signed, ParamExpires, "1900000000"),
+		"key parameter ip": replaceParam(t, signed, ParamIP, "192.0.2.7"),
+	} {
+		if _, err := v.Verify("GET", changed, nil); err != ErrInvalidSignature {
+			t.Errorf("changed %s: %v", name, err)
+		}
+	}
+	if _, err := v.Verify("DELETE", signed, nil); err != ErrInvalidSignature {
+		t.Errorf("other method: %v", err)
+	}
+
+	_, other, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify("GET", replaceParam(t, signed, ParamKey, other.KeyID()), nil); !errors.Is(err, envelope.ErrUnknownKey) {
+		t.Errorf("unknown key: %v", err)
+	}
+}
+
+func replaceParam(t *testing.T, signed, name, value string) string {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set(name, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func TestMalformed(t *testing.T) {
+	sk, pk, v, _ := setup(t)
+	signed := sign(t, sk, pk, Options{})
+
+	if _, err := v.Verify("GET", link, nil); err != ErrNoSignature {
+		t.Errorf("unsigned link: %v", err)
+	}
+	for name, bad := range map[string]string{
+		"signature":          replaceParam(t, signed, ParamSignature, "!!"),
+		"signature encoding": replaceParam(t, signed, ParamSignature, "AAAA"),
+		"date":               replaceParam(t, signed, ParamDate, "yesterday"),
+		"ip":                 replaceParam(t, signed, ParamIP, "localhost"),
+		"key":                replaceParam(t, signed, ParamKey, ""),
+		"repeated parameter": signed + "&" + ParamExpires + "=1900000000",
+		"query":              signed + "&%zz",
+	} {
+		if _, err := v.Verify("GET", bad, nil); !errors.Is(err, ErrMalformed) {
+			t.Errorf("malformed %s: %v", name, err)
+		}
+	}
+
+	if _, err := Sign(link+"&"+ParamKey+"=x", sk, pk, Options{}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("link with a signature parameter: %v", err)
+	}
+	if _, err := Sign("/relative", sk, pk, Options{}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("link without host: %v", err)
+	}
+}
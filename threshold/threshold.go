@@ -0,0 +1,550 @@
+/*
+Threshold Schnorr signatures (t-of-n, FROST-style) for the keys of package schnorr
+
+A trusted Dealer splits a signature key into n Shamir shares, any t of the
+participants can then sign together and produce an ordinary schnorr.Signature,
+verified with schnorr.VerifySignature against the original public key.
+
+Signing follows FROST (RFC 9591) with two rounds, written multiplicatively in
+the prime order group of the key (q its order):
+
+	Round 1: every participant publishes a Commitment to two nonces, D_i = g^d_i, E_i = g^e_i
+	Round 2: the Coordinator picks the signing set and sends the message with its
+	         commitments, every participant answers with the share
+	         z_i = d_i + rho_i*e_i + lambda_i*y_i*c mod q
+	Combine: the Coordinator checks every share against the public share Y_i = g^y_i
+	         and adds them up, s = sum(z_i), R = prod(D_i * E_i^rho_i)
+
+where rho_i = H(X || m || commitments || i) binds every nonce to the whole
+signing set, c = H(R||m) is the challenge of schnorr.Sign (see
+schnorr.Challenge, tagged with the environment and context of the group key)
+and lambda_i the Lagrange coefficient of i within the signing set. The binding factors make
+concurrent sessions safe against the ROS attack, nonces are used once.
+A Participant keeps its unused nonces and must not be shared between goroutines.
+
+Fewer than t shares reveal nothing about the key: the public shares Y_i hide
+y_i behind the discrete logarithm of the group (RFC 3526 MODP-2048 subgroup for
+the default keys, or the curve of the key). Participants don't have to trust
+the dealer's arithmetic: GroupKey.Validate checks that the public shares lie
+on one polynomial through X and GroupKey.CheckShare that a secret share
+matches its public share.
+*/
+package threshold
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrInvalidThreshold = errors.New("threshold: threshold must satisfy 1 <= t <= n")
+	ErrSigningSet       = errors.New("threshold: invalid signing set")
+	ErrNonceReuse       = errors.New("threshold: participant has no unused commitment")
+	ErrInvalidShare     = errors.New("threshold: invalid signature share")
+	ErrInvalidSignature = errors.New("threshold: combined signature doesn't verify")
+	ErrInvalidEncoding  = errors.New("threshold: invalid encoding")
+)
+
+/*
+Public data of the split key, known to everybody
+*/
+type GroupKey struct {
+	PublicKey *schnorr.PublicKey
+	Threshold int
+	Shares    map[int]schnorr.Element // public shares Y_i = g^y_i by index
+}
+
+/*
+Secret share y_i = f(i) of a participant
+*/
+type KeyShare struct {
+	Index     int
+	Threshold int
+	y         *big.Int
+	group     schnorr.Group
+}
+
+/*
+Round 1 message of a participant, encodings of the nonce commitments
+*/
+type Commitment struct {
+	Index int
+	D, E  []byte
+}
+
+/*
+Round 2 message of a participant
+*/
+type SignatureShare struct {
+	Index int
+	Z     *big.Int
+}
+
+/*
+Trusted dealer holding the key to split
+*/
+type Dealer struct {
+	sk *schnorr.SignatureKey
+	pk *schnorr.PublicKey
+}
+
+type Participant struct {
+	share *KeyShare
+	key   *GroupKey
+	// unused nonces by their commitment, every commitment signs once
+	nonces map[string][2]*big.Int
+}
+
+type Coordinator struct {
+	key *GroupKey
+}
+
+func NewDealer(sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Dealer {
+	return &Dealer{sk, pk}
+}
+
+/*
+Split the key into n shares with threshold t, share i belongs to the participant with index i
+*/
+func (d *Dealer) Split(t, n int) ([]*KeyShare, *GroupKey, error) {
+	if t < 1 || t > n {
+		return nil, nil, ErrInvalidThreshold
+	}
+	g := d.sk.Group()
+	q := g.Order()
+
+	// f(z) = x + a_1*z + ... + a_(t-1)*z^(t-1)
+	coefficients := []*big.Int{d.sk.Secret()}
+	for i := 1; i < t; i++ {
+		a, err := randomScalar(q)
+		if err != nil {
+			return nil, nil, err
+		}
+		coefficients = append(coefficients, a)
+	}
+
+	shares := make([]*KeyShare, n)
+	key := &GroupKey{d.pk, t, make(map[int]schnorr.Element, n)}
+	for i := range shares {
+		index := i + 1
+		y := new(big.Int)
+		for j := len(coefficients) - 1; j >= 0; j-- {
+			y.Mul(y, big.NewInt(int64(index)))
+			y.Add(y, coefficients[j])
+			y.Mod(y, q)
+		}
+		shares[i] = &KeyShare{index, t, y, g}
+		key.Shares[index] = g.ScalarBaseMult(y)
+	}
+	return shares, key, nil
+}
+
+/*
+Check the public shares against the public key: all of them lie on one
+polynomial of degree t-1 in the exponent whose value at zero is X, so any t
+participants sign for X. Participants receiving the key from a dealer check
+it before signing, together with their own share (CheckShare).
+*/
+func (key *GroupKey) Validate() error {
+	if key == nil || key.PublicKey == nil || key.PublicKey.Validate() != nil {
+		return ErrSigningSet
+	}
+	if key.Threshold < 1 || len(key.Shares) < key.Threshold {
+		return ErrInvalidThreshold
+	}
+	g := key.PublicKey.Group()
+	q := g.Order()
+	indexes := make([]int, 0, len(key.Shares))
+	for index, Y := range key.Shares {
+		if index < 1 || Y == nil {
+			return ErrSigningSet
+		}
+		if _, err := g.Encode(Y); err != nil {
+			return ErrSigningSet
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	// interpolate X and every share past the first t from the first t shares
+	basis := indexes[:key.Threshold]
+	targets := append([]int{0}, indexes[key.Threshold:]...)
+	for _, at := range targets {
+		var Y schnorr.Element
+		for _, i := range basis {
+			term := g.ScalarMult(key.Shares[i], interpolate(i, at, basis, q))
+			if Y == nil {
+				Y = term
+			} else {
+				Y = g.Add(Y, term)
+			}
+		}
+		expected := key.PublicKey.X
+		if at != 0 {
+			expected = key.Shares[at]
+		}
+		if !g.Equal(Y, expected) {
+			return ErrInvalidShare
+		}
+	}
+	return nil
+}
+
+/*
+Check the secret share against its public share, g^y_i == Y_i
+*/
+func (key *GroupKey) CheckShare(share *KeyShare) error {
+	Y := key.Shares[share.Index]
+	if Y == nil || share.Threshold != key.Threshold || share.group.Name() != key.PublicKey.Group().Name() {
+		return ErrInvalidShare
+	}
+	if !share.group.Equal(share.group.ScalarBaseMult(share.y), Y) {
+		return ErrInvalidShare
+	}
+	return nil
+}
+
+func NewParticipant(share *KeyShare, key *GroupKey) *Participant {
+	return &Participant{share, key, make(map[string][2]*big.Int)}
+}
+
+func (pt *Participant) Index() int {
+	return pt.share.Index
+}
+
+/*
+Round 1 - generate fresh nonces and publish the commitment to them.
+Commitments can be generated in advance, each one is used by one session.
+*/
+func (pt *Participant) Commit() (*Commitment, error) {
+	d, D, err := nonce(pt.share.group)
+	if err != nil {
+		return nil, err
+	}
+	e, E, err := nonce(pt.share.group)
+	if err != nil {
+		return nil, err
+	}
+	commitment := &Commitment{pt.share.Index, D, E}
+	pt.nonces[commitmentKey(commitment)] = [2]*big.Int{d, e}
+	return commitment, nil
+}
+
+/*
+Round 2 - signature share over m for the signing set given by the commitments.
+The participant's nonces are erased, its commitment can't be used again.
+*/
+func (pt *Participant) Sign(m string, commitments []*Commitment) (*SignatureShare, error) {
+	commitments, err := sortCommitments(commitments, pt.key)
+	if err != nil {
+		return nil, err
+	}
+	var own *Commitment
+	for _, c := range commitments {
+		if c.Index == pt.share.Index {
+			own = c
+		}
+	}
+	if own == nil {
+		return nil, ErrSigningSet
+	}
+	nonces, ok := pt.nonces[commitmentKey(own)]
+	if !ok {
+		return nil, ErrNonceReuse
+	}
+	delete(pt.nonces, commitmentKey(own))
+
+	q := pt.share.group.Order()
+	rho := bindingFactors(pt.key, m, commitments)
+	R, err := groupCommitment(pt.key, commitments, rho)
+	if err != nil {
+		return nil, err
+	}
+	c := schnorr.Challenge(R, m, pt.key.PublicKey)
+	lambda := lagrange(pt.share.Index, commitments, q)
+
+	// z_i = d_i + rho_i*e_i + lambda_i*y_i*c
+	z := new(big.Int).Mul(lambda, pt.share.y)
+	z.Mul(z, c)
+	z.Add(z, nonces[0])
+	z.Add(z, new(big.Int).Mul(rho[own.Index], nonces[1]))
+	return &SignatureShare{pt.share.Index, z.Mod(z, q)}, nil
+}
+
+func NewCoordinator(key *GroupKey) *Coordinator {
+	return &Coordinator{key}
+}
+
+/*
+Check the share of a participant: g^z_i == D_i * E_i^rho_i * Y_i^(lambda_i*c)
+*/
+func (co *Coordinator) VerifyShare(m string, commitments []*Commitment, share *SignatureShare) error {
+	commitments, err := sortCommitments(commitments, co.key)
+	if err != nil {
+		return err
+	}
+	g := co.key.PublicKey.Group()
+	q := g.Order()
+	if share == nil || share.Z == nil || share.Z.Sign() < 0 || share.Z.Cmp(q) >= 0 {
+		return ErrInvalidShare
+	}
+	var own *Commitment
+	for _, c := range commitments {
+		if c.Index == share.Index {
+			own = c
+		}
+	}
+	if own == nil {
+		return ErrInvalidShare
+	}
+
+	rho := bindingFactors(co.key, m, commitments)
+	R, err := groupCommitment(co.key, commitments, rho)
+	if err != nil {
+		return err
+	}
+	c := schnorr.Challenge(R, m, co.key.PublicKey)
+	lambda := lagrange(share.Index, commitments, q)
+
+	D, err := g.Decode(own.D)
+	if err != nil {
+		return ErrSigningSet
+	}
+	E, err := g.Decode(own.E)
+	if err != nil {
+		return ErrSigningSet
+	}
+	right := g.Add(D, g.ScalarMult(E, rho[own.Index]))
+	right = g.Add(right, g.ScalarMult(co.key.Shares[share.Index], lambda.Mul(lambda, c)))
+	if !g.Equal(g.ScalarBaseMult(share.Z), right) {
+		return ErrInvalidShare
+	}
+	return nil
+}
+
+/*
+Combine the shares of the signing set into the signature. Every share is
+verified first, a failure names the participant whose share is invalid.
+*/
+func (co *Coordinator) Aggregate(m string, commitments []*Commitment, shares []*SignatureShare) (*schnorr.Signature, error) {
+	sorted, err := sortCommitments(commitments, co.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(shares) != len(sorted) {
+		return nil, ErrSigningSet
+	}
+	q := co.key.PublicKey.Group().Order()
+
+	s := new(big.Int)
+	seen := make(map[int]bool, len(shares))
+	for _, share := range shares {
+		if share == nil || seen[share.Index] {
+			return nil, ErrSigningSet
+		}
+		seen[share.Index] = true
+		if err := co.VerifyShare(m, sorted, share); err != nil {
+			return nil, fmt.Errorf("%w of participant %d", err, share.Index)
+		}
+		s.Add(s, share.Z)
+	}
+
+	R, err := groupCommitment(co.key, sorted, bindingFactors(co.key, m, sorted))
+	if err != nil {
+		return nil, err
+	}
+	signature, err := schnorr.NewSignature(R, s.Mod(s, q))
+	if err != nil {
+		return nil, err
+	}
+	if !schnorr.VerifySignature(m, signature, co.key.PublicKey) {
+		return nil, ErrInvalidSignature
+	}
+	return signature, nil
+}
+
+/*
+Encoding: index (4 bytes) || threshold (4 bytes) || group || len(y)||y
+*/
+func (s *KeyShare) Bytes() []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(s.Index))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(s.Threshold))
+	buf, err := group.AppendGroup(buf, s.group)
+	if err != nil {
+		return nil
+	}
+	y := s.y.Bytes()
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(y)))
+	return append(buf, y...)
+}
+
+func ParseKeyShare(b []byte) (*KeyShare, error) {
+	if len(b) < 8 {
+		return nil, ErrInvalidEncoding
+	}
+	share := &KeyShare{Index: int(binary.BigEndian.Uint32(b)), Threshold: int(binary.BigEndian.Uint32(b[4:]))}
+	g, b, err := group.ReadGroup(b[8:])
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	if len(b) < 2 || len(b) != 2+int(binary.BigEndian.Uint16(b)) {
+		return nil, ErrInvalidEncoding
+	}
+	share.y, share.group = new(big.Int).SetBytes(b[2:]), g
+	if share.Index < 1 || share.Threshold < 1 || share.y.Cmp(g.Order()) >= 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return share, nil
+}
+
+/*
+Commitments sorted by index, checked against the key: no duplicates, at
+least Threshold of them, known indexes and valid element encodings
+*/
+func sortCommitments(commitments []*Commitment, key *GroupKey) ([]*Commitment, error) {
+	g := key.PublicKey.Group()
+	if len(commitments) < key.Threshold {
+		return nil, ErrSigningSet
+	}
+	sorted := append([]*Commitment(nil), commitments...)
+	for _, c := range sorted {
+		if c == nil || key.Shares[c.Index] == nil {
+			return nil, ErrSigningSet
+		}
+		if _, err := g.Decode(c.D); err != nil {
+			return nil, ErrSigningSet
+		}
+		if _, err := g.Decode(c.E); err != nil {
+			return nil, ErrSigningSet
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Index == sorted[i-1].Index {
+			return nil, ErrSigningSet
+		}
+	}
+	return sorted, nil
+}
+
+/*
+rho_i = H("threshold/binding" || X || len(m) || m || (j, D_j, E_j)... || i) mod q
+*/
+func bindingFactors(key *GroupKey, m string, commitments []*Commitment) map[int]*big.Int {
+	q := key.PublicKey.Group().Order()
+	prefix := appendBytes(nil, key.PublicKey.Bytes())
+	prefix = binary.BigEndian.AppendUint64(prefix, uint64(len(m)))
+	prefix = append(prefix, m...)
+	for _, c := range commitments {
+		prefix = binary.BigEndian.AppendUint32(prefix, uint32(c.Index))
+		prefix = appendBytes(appendBytes(prefix, c.D), c.E)
+	}
+
+	factors := make(map[int]*big.Int, len(commitments))
+	for _, c := range commitments {
+		h := sha256.New()
+		h.Write([]byte("threshold/binding"))
+		h.Write(prefix)
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(c.Index)))
+		rho := new(big.Int).SetBytes(h.Sum(nil))
+		factors[c.Index] = rho.Mod(rho, q)
+	}
+	return factors
+}
+
+/*
+Encoded R = prod(D_i * E_i^rho_i) of sorted, checked commitments
+*/
+func groupCommitment(key *GroupKey, commitments []*Commitment, rho map[int]*big.Int) ([]byte, error) {
+	g := key.PublicKey.Group()
+	var R schnorr.Element
+	for _, c := range commitments {
+		D, err := g.Decode(c.D)
+		if err != nil {
+			return nil, ErrSigningSet
+		}
+		E, err := g.Decode(c.E)
+		if err != nil {
+			return nil, ErrSigningSet
+		}
+		term := g.Add(D, g.ScalarMult(E, rho[c.Index]))
+		if R == nil {
+			R = term
+		} else {
+			R = g.Add(R, term)
+		}
+	}
+	encoded, err := g.Encode(R)
+	if err != nil {
+		return nil, ErrSigningSet
+	}
+	return encoded, nil
+}
+
+/*
+Lagrange coefficient at zero of the index within the signing set
+*/
+func lagrange(index int, commitments []*Commitment, q *big.Int) *big.Int {
+	indexes := make([]int, len(commitments))
+	for i, c := range commitments {
+		indexes[i] = c.Index
+	}
+	return interpolate(index, 0, indexes, q)
+}
+
+/*
+Lagrange coefficient at the point at of the index within the set of indexes,
+prod((at - j) / (index - j)) over the other indexes j
+*/
+func interpolate(index, at int, indexes []int, q *big.Int) *big.Int {
+	num, den := big.NewInt(1), big.NewInt(1)
+	for _, j := range indexes {
+		if j == index {
+			continue
+		}
+		num.Mul(num, big.NewInt(int64(at-j)))
+		num.Mod(num, q)
+		den.Mul(den, big.NewInt(int64(index-j)))
+		den.Mod(den, q)
+	}
+	return num.Mul(num, den.ModInverse(den, q)).Mod(num, q)
+}
+
+func commitmentKey(c *Commitment) string {
+	return string(appendBytes(appendBytes(nil, c.D), c.E))
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+	return append(buf, b...)
+}
+
+/*
+Fresh nonce and its encoded commitment g^d
+*/
+func nonce(g schnorr.Group) (*big.Int, []byte, error) {
+	d, err := randomScalar(g.Order())
+	if err != nil {
+		return nil, nil, err
+	}
+	D, err := g.Encode(g.ScalarBaseMult(d))
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, D, nil
+}
+
+/*
+Random number from [1, q)
+*/
+func randomScalar(q *big.Int) (*big.Int, error) {
+	return entropy.Scalar(q)
+}
@@ -0,0 +1,227 @@
+package threshold
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+const message = "transfer 10 to bob"
+
+/*
+2-of-3 split of a fresh P-256 key
+*/
+func split(t *testing.T) (*schnorr.PublicKey, []*Participant, *GroupKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, key, err := NewDealer(sk, pk).Split(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	participants := make([]*Participant, len(shares))
+	for i, share := range shares {
+		participants[i] = NewParticipant(share, key)
+	}
+	return pk, participants, key
+}
+
+func commit(t *testing.T, signers ...*Participant) []*Commitment {
+	t.Helper()
+	commitments := make([]*Commitment, len(signers))
+	for i, pt := range signers {
+		c, err := pt.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitments[i] = c
+	}
+	return commitments
+}
+
+func signShares(t *testing.T, m string, commitments []*Commitment, signers ...*Participant) []*SignatureShare {
+	t.Helper()
+	shares := make([]*SignatureShare, len(signers))
+	for i, pt := range signers {
+		share, err := pt.Sign(m, commitments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shares[i] = share
+	}
+	return shares
+}
+
+func TestSign(t *testing.T) {
+	pk, pts, key := split(t)
+	if err := key.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	co := NewCoordinator(key)
+
+	for _, signers := range [][]*Participant{{pts[0], pts[1]}, {pts[1], pts[2]}, {pts[2], pts[0]}, pts} {
+		commitments := commit(t, signers...)
+		signature, err := co.Aggregate(message, commitments, signShares(t, message, commitments, signers...))
+		if err != nil {
+			t.Fatalf("signers %d, %d: %v", signers[0].Index(), signers[1].Index(), err)
+		}
+		if !schnorr.VerifySignature(message, signature, pk) || schnorr.VerifySignature("other", signature, pk) {
+			t.Errorf("signers %d, %d: signature doesn't verify against the group key", signers[0].Index(), signers[1].Index())
+		}
+	}
+}
+
+func TestNonceReuse(t *testing.T) {
+	_, pts, _ := split(t)
+	commitments := commit(t, pts[0], pts[1])
+	signShares(t, message, commitments, pts[0])
+	if _, err := pts[0].Sign("other", commitments); err != ErrNonceReuse {
+		t.Errorf("second signature with one commitment: %v", err)
+	}
+	if _, err := pts[2].Sign(message, commitments); err != ErrSigningSet {
+		t.Errorf("participant outside the signing set: %v", err)
+	}
+}
+
+func TestTamperedShare(t *testing.T) {
+	_, pts, key := split(t)
+	co := NewCoordinator(key)
+	commitments := commit(t, pts[0], pts[1])
+	shares := signShares(t, message, commitments, pts[0], pts[1])
+
+	if _, err := co.Aggregate("other", commitments, shares); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("shares of another message: %v", err)
+	}
+
+	q := key.PublicKey.Group().Order()
+	changed := &SignatureShare{shares[1].Index, new(big.Int).Add(shares[1].Z, big.NewInt(1))}
+	changed.Z.Mod(changed.Z, q)
+	_, err := co.Aggregate(message, commitments, []*SignatureShare{shares[0], changed})
+	if !errors.Is(err, ErrInvalidShare) || err.Error() != ErrInvalidShare.Error()+" of participant 2" {
+		t.Errorf("changed share: %v", err)
+	}
+	for name, share := range map[string]*SignatureShare{
+		"out of range": {shares[0].Index, q},
+		"negative":     {shares[0].Index, big.NewInt(-1)},
+		"missing":      {shares[0].Index, nil},
+		"other index":  {3, shares[0].Z},
+	} {
+		if err := co.VerifyShare(message, commitments, share); err != ErrInvalidShare {
+			t.Errorf("%s share: %v", name, err)
+		}
+	}
+	if _, err := co.Aggregate(message, commitments, []*SignatureShare{shares[0], shares[0]}); err != ErrSigningSet {
+		t.Errorf("duplicated share: %v", err)
+	}
+	if _, err := co.Aggregate(message, commitments, shares[:1]); err != ErrSigningSet {
+		t.Errorf("missing share: %v", err)
+	}
+}
+
+func TestSigningSet(t *testing.T) {
+	_, pts, key := split(t)
+	co := NewCoordinator(key)
+	commitments := commit(t, pts[0], pts[1])
+	other := commit(t, pts[2])[0]
+
+	for name, set := range map[string][]*Commitment{
+		"too small":     commitments[:1],
+		"duplicate":     {commitments[0], commitments[0]},
+		"unknown index": {commitments[0], {Index: 4, D: other.D, E: other.E}},
+		"bad element":   {commitments[0], {Index: 2, D: []byte{1, 2, 3}, E: commitments[1].E}},
+		"nil":           {commitments[0], nil},
+	} {
+		if _, err := pts[0].Sign(message, set); err != ErrSigningSet {
+			t.Errorf("signing with a %s set: %v", name, err)
+		}
+		if _, err := co.Aggregate(message, set, nil); err != ErrSigningSet {
+			t.Errorf("aggregating a %s set: %v", name, err)
+		}
+	}
+}
+
+func TestDealtKey(t *testing.T) {
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dealer := NewDealer(sk, pk)
+	for _, tn := range [][2]int{{0, 3}, {4, 3}} {
+		if _, _, err := dealer.Split(tn[0], tn[1]); err != ErrInvalidThreshold {
+			t.Errorf("split %d of %d: %v", tn[0], tn[1], err)
+		}
+	}
+
+	shares, key, err := dealer.Split(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, share := range shares {
+		if err := key.CheckShare(share); err != nil {
+			t.Errorf("share %d: %v", share.Index, err)
+		}
+	}
+
+	// a public share off the polynomial
+	g := pk.Group()
+	forged := &GroupKey{pk, 2, map[int]schnorr.Element{1: key.Shares[1], 2: key.Shares[2], 3: g.Add(key.Shares[3], g.ScalarBaseMult(big.NewInt(1)))}}
+	if err := forged.Validate(); err != ErrInvalidShare {
+		t.Errorf("public share off the polynomial: %v", err)
+	}
+	forged.Shares[3] = key.Shares[3]
+	forged.PublicKey = mustKey(t)
+	if err := forged.Validate(); err != ErrInvalidShare {
+		t.Errorf("shares of another key: %v", err)
+	}
+	if err := (&GroupKey{pk, 4, key.Shares}).Validate(); err != ErrInvalidThreshold {
+		t.Errorf("threshold above the share count: %v", err)
+	}
+
+	mismatched := *shares[0]
+	mismatched.Index = 2
+	if err := key.CheckShare(&mismatched); err != ErrInvalidShare {
+		t.Errorf("share under another index: %v", err)
+	}
+}
+
+func mustKey(t *testing.T) *schnorr.PublicKey {
+	t.Helper()
+	_, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pk
+}
+
+func TestKeyShareEncoding(t *testing.T) {
+	_, pts, key := split(t)
+	share := pts[0].share
+	parsed, err := ParseKeyShare(share.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Index != share.Index || parsed.Threshold != share.Threshold || parsed.y.Cmp(share.y) != 0 {
+		t.Fatalf("parsed share %d/%d differs", parsed.Index, parsed.Threshold)
+	}
+	if err := key.CheckShare(parsed); err != nil {
+		t.Errorf("parsed share: %v", err)
+	}
+
+	b := share.Bytes()
+	zeroIndex := append([]byte{0, 0, 0, 0}, b[4:]...)
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"header":    b[:7],
+		"truncated": b[:len(b)-1],
+		"trailing":  append(append([]byte(nil), b...), 0),
+		"index":     zeroIndex,
+	} {
+		if _, err := ParseKeyShare(bad); err != ErrInvalidEncoding {
+			t.Errorf("%s share: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package tokens
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Conditional payments: tokens locked to a key, claimed with adaptor signatures
+
+A locked coin carries its owner's secp256k1 public key in the serial, so it
+is blindly signed like any coin, and it is redeemed only with a Claim: a
+signature by the owner key of the coin and the recipient. A payment made
+contingent on a secret t (pay-for-preimage, with T = t*G as the "hash"):
+
+	Payee:  Invoice{Amount, Recipient, T}
+	Payer:  ConditionalPayment = adaptor pre-signature of the claim for T  (Pay)
+	Payee:  Claim = pre-signature completed with t                       (Complete)
+	Mint:   ClaimVerifier.Redeem(claim), the claim is published
+	Payer:  t = Secret(payment, claim)
+
+The payee can't redeem the coin without t, and redeeming it publishes the
+completed signature, from which the payer (or anyone holding the payment)
+extracts t. The owner key can still claim the coin for itself until the payee
+does, so the payee should claim right after checking the payment (Verify),
+and the parties agree on an expiry after which the payer may take it back.
+
+All messages have Bytes and Parse functions in the length-prefixed encoding
+of the package (see RefreshRequest).
+*/
+
+var (
+	ErrCoinLocked   = errors.New("tokens: locked coin can only be redeemed with a claim")
+	ErrNotLocked    = errors.New("tokens: coin isn't locked")
+	ErrInvalidClaim = errors.New("tokens: invalid claim")
+)
+
+const lockPrefix = "lock:"
+
+/*
+Group of the lock keys and adaptor signatures
+*/
+func LockGroup() schnorr.Group {
+	return schnorr.Secp256k1()
+}
+
+/*
+Serial of a coin locked to the owner key: "lock:"||Encode(X)||32 random bytes
+*/
+func LockedSerial(owner *schnorr.PublicKey) ([]byte, error) {
+	// the owner key is rebuilt from the serial, without environment tag
+	if owner == nil || owner.Group() != LockGroup() || owner.Environment() != "" {
+		return nil, ErrInvalidClaim
+	}
+	key, err := LockGroup().Encode(owner.X)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 32)
+	if _, err := io.ReadFull(entropy.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return append(append([]byte(lockPrefix), key...), nonce...), nil
+}
+
+/*
+Request for a coin of the amount locked to the owner key
+*/
+func NewLockedCoinRequest(ks *Keyset, amount uint64, owner *schnorr.PublicKey) (*CoinRequest, error) {
+	request, err := NewCoinRequest(ks, amount)
+	if err != nil {
+		return nil, err
+	}
+	if request.serial, err = LockedSerial(owner); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (t *Token) Locked() bool {
+	return bytes.HasPrefix(t.Serial, []byte(lockPrefix))
+}
+
+/*
+Owner key of a locked token
+*/
+func (t *Token) Owner() (*schnorr.PublicKey, error) {
+	if !t.Locked() || len(t.Serial) <= len(lockPrefix)+32 {
+		return nil, ErrNotLocked
+	}
+	X, err := LockGroup().Decode(t.Serial[len(lockPrefix) : len(t.Serial)-32])
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.NewPublicKey(LockGroup(), X)
+}
+
+/*
+Message the owner signs to release the coin to the recipient,
+H("schnorr/tokens/claim/v1"||amount||epoch||len(serial)||serial||recipient) in hex
+*/
+func ClaimMessage(coin *Coin, recipient string) string {
+	h := sha256.New()
+	h.Write([]byte("schnorr/tokens/claim/v1"))
+	h.Write(binary.BigEndian.AppendUint64(nil, coin.Amount))
+	h.Write(binary.BigEndian.AppendUint64(nil, coin.Epoch))
+	h.Write(appendField(nil, coin.Serial))
+	h.Write([]byte(recipient))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+/*
+Payee -> payer: request of a payment conditional on the discrete log of T
+*/
+type Invoice struct {
+	Amount    uint64
+	Recipient string // account the claimed coin is credited to
+	T         []byte // encoding of the lock point
+}
+
+/*
+Payee: invoice with a fresh secret t, kept by the payee until it claims
+*/
+func NewInvoice(amount uint64, recipient string) (*Invoice, *big.Int, error) {
+	group := LockGroup()
+	for {
+		t, err := rand.Int(entropy.Reader, group.Order())
+		if err != nil {
+			return nil, nil, err
+		}
+		if t.Sign() != 0 {
+			T, err := group.Encode(group.ScalarBaseMult(t))
+			if err != nil {
+				return nil, nil, err
+			}
+			return &Invoice{amount, recipient, T}, t, nil
+		}
+	}
+}
+
+/*
+Payer -> payee: locked coin and the claim pre-signed for the invoice's T
+*/
+type ConditionalPayment struct {
+	Coin      *Coin
+	Recipient string
+	Pre       *schnorr.PreSignature
+}
+
+/*
+Claim of a locked coin, completed by the payee and published by the mint
+*/
+type Claim struct {
+	Coin      *Coin
+	Recipient string
+	Signature *schnorr.Signature
+}
+
+/*
+Payer: pre-sign the claim of the locked coin owned by sk for the invoice
+*/
+func Pay(coin *Coin, sk *schnorr.SignatureKey, invoice *Invoice) (*ConditionalPayment, error) {
+	owner, err := coin.Owner()
+	if err != nil {
+		return nil, err
+	}
+	if !owner.Equal(sk.Public()) || sk.Environment() != "" || coin.Amount != invoice.Amount {
+		return nil, ErrInvalidClaim
+	}
+	pre, err := schnorr.AdaptorSign(ClaimMessage(coin, invoice.Recipient), sk, invoice.T)
+	if err != nil {
+		return nil, err
+	}
+	return &ConditionalPayment{coin, invoice.Recipient, pre}, nil
+}
+
+/*
+Payee: check the payment against the invoice and the mint's keyset before
+delivering anything, the claim becomes valid once completed with t
+*/
+func (p *ConditionalPayment) Verify(invoice *Invoice, ks *Keyset) error {
+	if p.Coin == nil || p.Coin.Token == nil || p.Pre == nil {
+		return ErrInvalidClaim
+	}
+	if p.Coin.Amount != invoice.Amount || p.Recipient != invoice.Recipient || !bytes.Equal(p.Pre.T, invoice.T) {
+		return ErrInvalidClaim
+	}
+	pk, err := ks.PublicKey(p.Coin.Amount, p.Coin.Epoch)
+	if err != nil {
+		return err
+	}
+	if !schnorr.VerifySignature(Message(p.Coin.Epoch, p.Coin.Serial), p.Coin.Signature, pk) {
+		return ErrInvalidToken
+	}
+	owner, err := p.Coin.Owner()
+	if err != nil {
+		return err
+	}
+	if !schnorr.AdaptorVerify(ClaimMessage(p.Coin, p.Recipient), p.Pre, owner) {
+		return ErrInvalidClaim
+	}
+	return nil
+}
+
+/*
+Payee: complete the pre-signature with t into the claim
+*/
+func (p *ConditionalPayment) Complete(t *big.Int) (*Claim, error) {
+	owner, err := p.Coin.Owner()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := schnorr.Adapt(p.Pre, t, owner)
+	if err != nil {
+		return nil, err
+	}
+	return &Claim{p.Coin, p.Recipient, signature}, nil
+}
+
+/*
+Payer: the invoice secret t from the published claim of the payment
+*/
+func Secret(p *ConditionalPayment, claim *Claim) (*big.Int, error) {
+	if claim == nil || claim.Coin == nil || p.Coin == nil || !bytes.Equal(claim.Coin.Bytes(), p.Coin.Bytes()) {
+		return nil, ErrInvalidClaim
+	}
+	owner, err := p.Coin.Owner()
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.ExtractSecret(p.Pre, claim.Signature, owner)
+}
+
+/*
+Redeems claims of locked coins and publishes them, so payers can extract
+the secrets. Claims are kept while their epoch is accepted.
+*/
+type ClaimVerifier struct {
+	verifier *MintVerifier
+
+	mu     sync.Mutex
+	claims map[string]*Claim // hex of the serial -> claim
+}
+
+func NewClaimVerifier(verifier *MintVerifier) *ClaimVerifier {
+	return &ClaimVerifier{verifier: verifier, claims: make(map[string]*Claim)}
+}
+
+/*
+Verify the claim, redeem the coin and publish the claim. Returns the redeemed value.
+*/
+func (c *ClaimVerifier) Redeem(claim *Claim) (uint64, error) {
+	if claim == nil || claim.Coin == nil || claim.Coin.Token == nil {
+		return 0, ErrInvalidClaim
+	}
+	owner, err := claim.Coin.Owner()
+	if err != nil {
+		return 0, err
+	}
+	if !schnorr.VerifySignature(ClaimMessage(claim.Coin, claim.Recipient), claim.Signature, owner) {
+		return 0, ErrInvalidClaim
+	}
+	value, err := c.verifier.redeem([]*Coin{claim.Coin})
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	oldest := c.verifier.schedule.oldest(c.verifier.now())
+	for serial, published := range c.claims {
+		if published.Coin.Epoch < oldest {
+			delete(c.claims, serial)
+		}
+	}
+	c.claims[hex.EncodeToString(claim.Coin.Serial)] = claim
+	return value, nil
+}
+
+/*
+Published claim of the coin, false if it wasn't claimed (yet)
+*/
+func (c *ClaimVerifier) Lookup(coin *Coin) (*Claim, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	claim, ok := c.claims[hex.EncodeToString(coin.Serial)]
+	return claim, ok
+}
+
+/*
+Encoding: amount||len(recipient)||recipient||T
+*/
+func (i *Invoice) Bytes() []byte {
+	buf := binary.BigEndian.AppendUint64(nil, i.Amount)
+	return append(appendField(buf, []byte(i.Recipient)), i.T...)
+}
+
+func ParseInvoice(b []byte) (*Invoice, error) {
+	if len(b) < 8 {
+		return nil, ErrInvalidClaim
+	}
+	recipient, rest, err := readField(b[8:])
+	if err != nil {
+		return nil, ErrInvalidClaim
+	}
+	if _, err := LockGroup().Decode(rest); err != nil {
+		return nil, ErrInvalidClaim
+	}
+	return &Invoice{binary.BigEndian.Uint64(b), string(recipient), rest}, nil
+}
+
+/*
+Encoding: len(coin)||coin||len(recipient)||recipient||len(R)||R||len(T)||T||s
+*/
+func (p *ConditionalPayment) Bytes() []byte {
+	buf := appendField(nil, p.Coin.Bytes())
+	buf = appendField(buf, []byte(p.Recipient))
+	buf = appendField(buf, p.Pre.R)
+	buf = appendField(buf, p.Pre.T)
+	return append(buf, p.Pre.S.FillBytes(make([]byte, 32))...)
+}
+
+func ParseConditionalPayment(b []byte) (*ConditionalPayment, error) {
+	coin, recipient, b, err := readClaimHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	group := LockGroup()
+	R, b, err := readField(b)
+	if err != nil {
+		return nil, ErrInvalidClaim
+	}
+	T, b, err := readField(b)
+	if err != nil || len(b) != 32 {
+		return nil, ErrInvalidClaim
+	}
+	for _, e := range [][]byte{R, T} {
+		if _, err := group.Decode(e); err != nil {
+			return nil, ErrInvalidClaim
+		}
+	}
+	return &ConditionalPayment{coin, recipient, &schnorr.PreSignature{R: R, T: T, S: new(big.Int).SetBytes(b)}}, nil
+}
+
+/*
+Encoding: len(coin)||coin||len(recipient)||recipient||signature
+*/
+func (c *Claim) Bytes() []byte {
+	buf := appendField(nil, c.Coin.Bytes())
+	buf = appendField(buf, []byte(c.Recipient))
+	return append(buf, c.Signature.Bytes()...)
+}
+
+func ParseClaim(b []byte) (*Claim, error) {
+	coin, recipient, b, err := readClaimHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := schnorr.ParseSignature(b)
+	if err != nil {
+		return nil, ErrInvalidClaim
+	}
+	return &Claim{coin, recipient, signature}, nil
+}
+
+func readClaimHeader(b []byte) (*Coin, string, []byte, error) {
+	field, b, err := readField(b)
+	if err != nil {
+		return nil, "", nil, ErrInvalidClaim
+	}
+	coin, err := ParseCoin(field)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	recipient, b, err := readField(b)
+	if err != nil {
+		return nil, "", nil, ErrInvalidClaim
+	}
+	return coin, string(recipient), b, nil
+}
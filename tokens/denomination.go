@@ -0,0 +1,468 @@
+package tokens
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Denominations
+
+A blind signature can't carry an amount the signer didn't see, so the value of
+a token is given by the key that signed it: a Mint runs one Issuer (with its
+own epoch keys) per denomination and publishes the bindings amount -> keys as a
+Keyset. A Coin is a Token together with its amount, the MintVerifier checks it
+with the key of that amount, so a coin can't claim a higher value.
+
+The Wallet keeps coins of mixed denominations. Payments take coins covering
+the amount, the difference comes back as change (new coins of the amounts
+given by Denominate, see Refresh).
+*/
+
+var (
+	ErrUnknownDenomination = errors.New("tokens: unknown denomination")
+	ErrNotRepresentable    = errors.New("tokens: value can't be made of the denominations")
+	ErrInsufficientFunds   = errors.New("tokens: wallet balance too low")
+)
+
+/*
+Token of the given value
+*/
+type Coin struct {
+	Amount uint64
+	*Token
+}
+
+/*
+Encoding: amount||Token.Bytes
+*/
+func (c *Coin) Bytes() []byte {
+	return append(binary.BigEndian.AppendUint64(nil, c.Amount), c.Token.Bytes()...)
+}
+
+func ParseCoin(b []byte) (*Coin, error) {
+	if len(b) < 8 {
+		return nil, ErrInvalidToken
+	}
+	token, err := ParseToken(b[8:])
+	if err != nil {
+		return nil, err
+	}
+	return &Coin{binary.BigEndian.Uint64(b), token}, nil
+}
+
+/*
+Issuer of coins in several denominations, sharing one schedule
+*/
+type Mint struct {
+	schedule Schedule
+	amounts  []uint64 // denominations in decreasing order
+	issuers  map[uint64]*Issuer
+	now      func() time.Time
+}
+
+/*
+Mint of the given denominations, the epoch keys of every denomination are
+generated with registered parameters paramsID
+*/
+func NewMint(schedule Schedule, paramsID uint16, amounts []uint64) (*Mint, error) {
+	if len(amounts) == 0 {
+		return nil, ErrUnknownDenomination
+	}
+	m := &Mint{schedule: schedule, issuers: make(map[uint64]*Issuer), now: schnorr.Now}
+	for _, amount := range amounts {
+		if _, ok := m.issuers[amount]; ok || amount == 0 {
+			return nil, ErrUnknownDenomination
+		}
+		issuer, err := NewIssuer(schedule, paramsID)
+		if err != nil {
+			return nil, err
+		}
+		m.issuers[amount] = issuer
+		m.amounts = append(m.amounts, amount)
+	}
+	sort.Slice(m.amounts, func(i, j int) bool { return m.amounts[i] > m.amounts[j] })
+	return m, nil
+}
+
+/*
+Denominations of the mint in decreasing order
+*/
+func (m *Mint) Amounts() []uint64 {
+	return append([]uint64(nil), m.amounts...)
+}
+
+/*
+Blind signer for a coin of the amount in the current epoch, one per coin
+*/
+func (m *Mint) Signer(amount uint64) (uint64, *schnorr.BlindSigner, error) {
+	issuer, ok := m.issuers[amount]
+	if !ok {
+		return 0, nil, ErrUnknownDenomination
+	}
+	return issuer.Signer()
+}
+
+/*
+Published bindings of the denominations to their epoch keys
+*/
+type Keyset struct {
+	Start         int64              `json:"start"`  // unix time of epoch 0
+	Period        int64              `json:"period"` // seconds
+	Window        int                `json:"window"`
+	Current       uint64             `json:"current"`
+	Denominations []DenominationKeys `json:"denominations"` // in decreasing order
+}
+
+type DenominationKeys struct {
+	Amount uint64      `json:"amount"`
+	Epochs []EpochInfo `json:"epochs"` // accepted epochs, oldest first
+}
+
+func (m *Mint) Keyset() (*Keyset, error) {
+	ks := &Keyset{
+		Start:   m.schedule.Start.Unix(),
+		Period:  int64(m.schedule.Period / time.Second),
+		Window:  m.schedule.Window,
+		Current: m.schedule.Epoch(m.now()),
+	}
+	for _, amount := range m.amounts {
+		doc, err := m.issuers[amount].Schedule()
+		if err != nil {
+			return nil, err
+		}
+		ks.Denominations = append(ks.Denominations, DenominationKeys{amount, doc.Epochs})
+	}
+	return ks, nil
+}
+
+/*
+GET endpoint serving the keyset, cacheable until the current epoch ends
+*/
+func (m *Mint) KeysetHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ks, err := m.Keyset()
+		serveJSON(w, r, ks, err, m.schedule, m.now())
+	})
+}
+
+/*
+Denominations of the keyset in decreasing order
+*/
+func (ks *Keyset) Amounts() []uint64 {
+	amounts := make([]uint64, len(ks.Denominations))
+	for i, d := range ks.Denominations {
+		amounts[i] = d.Amount
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] > amounts[j] })
+	return amounts
+}
+
+/*
+Key of the denomination in the epoch
+*/
+func (ks *Keyset) PublicKey(amount, epoch uint64) (*schnorr.PublicKey, error) {
+	for _, d := range ks.Denominations {
+		if d.Amount != amount {
+			continue
+		}
+		for _, info := range d.Epochs {
+			if info.Epoch == epoch {
+				return parseEpochKey(info)
+			}
+		}
+		return nil, ErrUnknownEpoch
+	}
+	return nil, ErrUnknownDenomination
+}
+
+/*
+Split value into the denominations (in decreasing order), largest first
+*/
+func Denominate(amounts []uint64, value uint64) ([]uint64, error) {
+	var parts []uint64
+	for _, amount := range amounts {
+		for amount > 0 && value >= amount {
+			parts = append(parts, amount)
+			value -= amount
+		}
+	}
+	if value != 0 {
+		return nil, ErrNotRepresentable
+	}
+	return parts, nil
+}
+
+/*
+Client side of the issuance of a single coin: a random serial blinded for
+the key of the amount in the keyset's current epoch
+*/
+type CoinRequest struct {
+	Amount    uint64
+	Epoch     uint64
+	serial    []byte
+	requester *schnorr.BlindRequester
+}
+
+func NewCoinRequest(ks *Keyset, amount uint64) (*CoinRequest, error) {
+	return newCoinRequest(ks, amount, ks.Current)
+}
+
+/*
+Blinded challenge for the mint's commitment
+*/
+func (c *CoinRequest) Challenge(commitment *schnorr.BlindCommitment) (*schnorr.BlindChallenge, error) {
+	return c.requester.RequesterChallenge(commitment, Message(c.Epoch, c.serial))
+}
+
+/*
+Unblind the mint's response into the coin
+*/
+func (c *CoinRequest) Finalize(response *schnorr.BlindResponse) (*Coin, error) {
+	signature, err := c.requester.RequesterFinalize(response)
+	if err != nil {
+		return nil, err
+	}
+	return &Coin{c.Amount, &Token{c.Epoch, c.serial, signature}}, nil
+}
+
+/*
+Verifier of coins of all denominations of a keyset
+*/
+type MintVerifier struct {
+	schedule Schedule
+	now      func() time.Time
+
+	mu        sync.Mutex
+	verifiers map[uint64]*Verifier
+}
+
+func NewMintVerifier(schedule Schedule) (*MintVerifier, error) {
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	return &MintVerifier{schedule: schedule, now: schnorr.Now, verifiers: make(map[uint64]*Verifier)}, nil
+}
+
+/*
+Load the keys of the published keyset, which has to match the verifier's schedule
+*/
+func (v *MintVerifier) SetKeyset(ks *Keyset) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, d := range ks.Denominations {
+		verifier, ok := v.verifiers[d.Amount]
+		if !ok {
+			var err error
+			if verifier, err = NewVerifier(v.schedule); err != nil {
+				return err
+			}
+		}
+		doc := &EpochSchedule{Start: ks.Start, Period: ks.Period, Window: ks.Window, Current: ks.Current, Epochs: d.Epochs}
+		if err := verifier.SetSchedule(doc); err != nil {
+			return err
+		}
+		v.verifiers[d.Amount] = verifier
+	}
+	return nil
+}
+
+/*
+Verify the coins and mark them as spent, all or none. Returns the redeemed value.
+Locked coins are redeemed only with a Claim, see ClaimVerifier.
+*/
+func (v *MintVerifier) Redeem(coins ...*Coin) (uint64, error) {
+	for _, coin := range coins {
+		if coin != nil && coin.Token != nil && coin.Locked() {
+			return 0, ErrCoinLocked
+		}
+	}
+	return v.redeem(coins)
+}
+
+func (v *MintVerifier) redeem(coins []*Coin) (uint64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// the verifiers are locked in increasing order of amounts, so concurrent
+	// redemptions can't deadlock
+	byAmount := make(map[uint64][]*Token)
+	for _, coin := range coins {
+		if coin == nil || coin.Token == nil {
+			return 0, ErrInvalidToken
+		}
+		if _, ok := v.verifiers[coin.Amount]; !ok {
+			return 0, ErrUnknownDenomination
+		}
+		byAmount[coin.Amount] = append(byAmount[coin.Amount], coin.Token)
+	}
+	amounts := make([]uint64, 0, len(byAmount))
+	for amount := range byAmount {
+		amounts = append(amounts, amount)
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+
+	for _, amount := range amounts {
+		verifier := v.verifiers[amount]
+		verifier.mu.Lock()
+		defer verifier.mu.Unlock()
+	}
+
+	var value uint64
+	for _, amount := range amounts {
+		verifier, now := v.verifiers[amount], v.verifiers[amount].now()
+		verifier.prune(now)
+		type serial struct {
+			epoch uint64
+			id    string
+		}
+		seen := make(map[serial]bool)
+		for _, t := range byAmount[amount] {
+			if err := verifier.check(t, now); err != nil {
+				return 0, err
+			}
+			key := serial{t.Epoch, string(t.Serial)}
+			if seen[key] {
+				return 0, ErrTokenSpent
+			}
+			seen[key] = true
+			value += amount
+		}
+	}
+	for _, amount := range amounts {
+		for _, t := range byAmount[amount] {
+			v.verifiers[amount].spend(t)
+		}
+	}
+	return value, nil
+}
+
+/*
+Coins of mixed denominations
+*/
+type Wallet struct {
+	mu    sync.Mutex
+	coins []*Coin
+}
+
+func NewWallet(coins ...*Coin) *Wallet {
+	return &Wallet{coins: append([]*Coin(nil), coins...)}
+}
+
+func (w *Wallet) Add(coins ...*Coin) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.coins = append(w.coins, coins...)
+}
+
+func (w *Wallet) Balance() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var balance uint64
+	for _, coin := range w.coins {
+		balance += coin.Amount
+	}
+	return balance
+}
+
+func (w *Wallet) Coins() []*Coin {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*Coin(nil), w.coins...)
+}
+
+/*
+Take coins worth at least value out of the wallet. The coins are picked
+largest first without overshooting, and if they don't add up exactly, the
+smallest coin which covers the rest is added (or more coins, largest first)
+and coins which became unnecessary are put back.
+Returns the coins and the change owed back (their total minus value). Put the
+coins back with Add if the payment fails.
+*/
+func (w *Wallet) Take(value uint64) ([]*Coin, uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	coins := append([]*Coin(nil), w.coins...)
+	sort.SliceStable(coins, func(i, j int) bool { return coins[i].Amount > coins[j].Amount })
+
+	taken := make([]bool, len(coins))
+	rest := value
+	for i, coin := range coins {
+		if coin.Amount <= rest {
+			taken[i] = true
+			rest -= coin.Amount
+		}
+	}
+	for i := len(coins) - 1; i >= 0 && rest > 0; i-- {
+		if !taken[i] && coins[i].Amount >= rest {
+			taken[i] = true
+			rest = 0
+		}
+	}
+	for i := range coins {
+		if rest == 0 {
+			break
+		}
+		if !taken[i] {
+			taken[i] = true
+			rest -= min64(rest, coins[i].Amount)
+		}
+	}
+	if rest > 0 {
+		return nil, 0, ErrInsufficientFunds
+	}
+
+	// drop coins the covering coin made unnecessary, smallest first
+	var total uint64
+	for i, coin := range coins {
+		if taken[i] {
+			total += coin.Amount
+		}
+	}
+	for i := len(coins) - 1; i >= 0; i-- {
+		if taken[i] && total-coins[i].Amount >= value {
+			taken[i] = false
+			total -= coins[i].Amount
+		}
+	}
+
+	var selected, kept []*Coin
+	for i, coin := range coins {
+		if taken[i] {
+			selected = append(selected, coin)
+		} else {
+			kept = append(kept, coin)
+		}
+	}
+	w.coins = kept
+	return selected, total - value, nil
+}
+
+func parseEpochKey(info EpochInfo) (*schnorr.PublicKey, error) {
+	b, err := hex.DecodeString(info.PublicKey)
+	if err != nil {
+		return nil, ErrInvalidSchedule
+	}
+	pk, err := schnorr.ParsePublicKey(b)
+	if err != nil || pk.Validate() != nil {
+		return nil, ErrInvalidSchedule
+	}
+	return pk, nil
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,636 @@
+package tokens
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Offline coins with identity-revealing double spending (Chaum-Fiat-Naor)
+
+Merchants accept OfflineCoins without asking the bank, so a coin can be spent
+twice before either payment is deposited. Instead of preventing that, the coin
+makes the second spend reveal the spender's identity ID. Every coin carries
+OfflinePairs commitments, pair i to two shares of ID:
+
+	x_i = H("x" || a_i || c_i),  y_i = H("y" || a_i XOR ID || d_i)
+
+One share alone is a random string. A payment answers the merchant's challenge
+bit z_i with the opening of x_i (z_i = 0) or of y_i (z_i = 1), so two payments
+with different challenges open both shares of some pair, and
+ID = a_i XOR (a_i XOR ID). A Disclosure (the two payments) proves the double
+spend to anyone with the bank's public key, see VerifyDisclosure.
+
+Withdrawal has to make sure a coin really carries the withdrawer's ID while
+the bank signs it blindly. The user prepares WithdrawalCandidates coins, each
+blinded with its own seed (schnorr.NewSeededBlindRequester); the bank picks one
+to sign and the user opens all others (seed and shares). The bank checks that
+the opened ones contain the registered ID and were blinded to the challenges it
+got, so a user smuggling a wrong ID is caught with probability
+1 - 1/WithdrawalCandidates.
+
+	Bank:  commitments = Commit()                  one blind session per candidate
+	User:  challenges = Challenges(commitments)    candidates with the shares of ID
+	Bank:  keep = Choose(challenges)
+	User:  openings = Open(keep)                   seeds and secrets of the others
+	Bank:  response = Respond(openings)            only for the candidate kept
+	User:  coin = Finalize(response)
+
+A single spend reveals one random share per pair, nothing about ID, and the
+blinding keeps the coin unlinkable to its withdrawal.
+*/
+
+const (
+	IdentitySize         = 32 // size of the embedded identity
+	OfflinePairs         = 32 // commitment pairs of a coin, bits of the spend challenge
+	WithdrawalCandidates = 16 // candidates of the withdrawal cut-and-choose
+)
+
+var (
+	ErrInvalidIdentity   = errors.New("tokens: identity must be 32 bytes")
+	ErrInvalidPayment    = errors.New("tokens: invalid offline payment")
+	ErrInvalidOpening    = errors.New("tokens: withdrawal candidate doesn't match its opening")
+	ErrDoubleSpend       = errors.New("tokens: offline coin spent twice")
+	ErrDuplicateDeposit  = errors.New("tokens: payment already deposited")
+	ErrInvalidDisclosure = errors.New("tokens: invalid double spending disclosure")
+)
+
+/*
+Public part of an offline coin, signed blindly by the epoch key
+*/
+type OfflineCoin struct {
+	Epoch     uint64
+	X, Y      [OfflinePairs][32]byte // commitments to the shares of the identity
+	Signature *schnorr.Signature
+}
+
+/*
+Opened commitment of a payment: the share (a_i or a_i XOR ID) and its salt
+*/
+type Opening struct {
+	Share [IdentitySize]byte
+	Salt  [32]byte
+}
+
+/*
+Offline coin spent with the merchant's challenge
+*/
+type Payment struct {
+	Coin      *OfflineCoin
+	Challenge [OfflinePairs / 8]byte
+	Openings  [OfflinePairs]Opening
+}
+
+/*
+Secrets of a pair: share a, salts c of x and d of y
+*/
+type pairSecret struct {
+	a, c, d [32]byte
+}
+
+/*
+Offline coin with the secrets needed to spend it, kept by the wallet
+*/
+type SpendableCoin struct {
+	Coin     *OfflineCoin
+	identity [IdentitySize]byte
+	pairs    [OfflinePairs]pairSecret
+}
+
+/*
+Message signed for the coin, H("schnorr/tokens/offline/v1"||epoch||x_1||y_1||...) in hex.
+It also identifies the coin in the deposit ledger.
+*/
+func (c *OfflineCoin) Message() string {
+	h := sha256.New()
+	h.Write([]byte("schnorr/tokens/offline/v1"))
+	h.Write(binary.BigEndian.AppendUint64(nil, c.Epoch))
+	for i := range c.X {
+		h.Write(c.X[i][:])
+		h.Write(c.Y[i][:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+/*
+Challenge of a merchant for a payment, H(merchant||nonce) truncated to
+OfflinePairs bits. The nonce has to be unique for the merchant (e.g. a counter
+or timestamp), payments of the same coin with equal challenges don't reveal the
+identity.
+*/
+func PaymentChallenge(merchant string, nonce []byte) [OfflinePairs / 8]byte {
+	h := sha256.New()
+	h.Write([]byte("schnorr/tokens/offline/challenge"))
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(merchant))))
+	h.Write([]byte(merchant))
+	h.Write(nonce)
+	var challenge [OfflinePairs / 8]byte
+	copy(challenge[:], h.Sum(nil))
+	return challenge
+}
+
+/*
+Spend the coin: open x_i or y_i of every pair as chosen by the challenge bit.
+Spending a coin twice reveals the identity.
+*/
+func (s *SpendableCoin) Spend(challenge [OfflinePairs / 8]byte) *Payment {
+	payment := &Payment{Coin: s.Coin, Challenge: challenge}
+	for i, pair := range s.pairs {
+		if challengeBit(challenge, i) == 0 {
+			payment.Openings[i] = Opening{pair.a, pair.c}
+		} else {
+			payment.Openings[i] = Opening{xor(pair.a, s.identity), pair.d}
+		}
+	}
+	return payment
+}
+
+/*
+Verify the payment offline with the bank's key of the coin's epoch
+*/
+func VerifyPayment(p *Payment, pk *schnorr.PublicKey) error {
+	if p == nil || p.Coin == nil || p.Coin.Signature == nil {
+		return ErrInvalidPayment
+	}
+	if !schnorr.VerifySignature(p.Coin.Message(), p.Coin.Signature, pk) {
+		return ErrInvalidPayment
+	}
+	for i, opening := range p.Openings {
+		commitment, label := p.Coin.X[i], byte('x')
+		if challengeBit(p.Challenge, i) == 1 {
+			commitment, label = p.Coin.Y[i], 'y'
+		}
+		if shareCommitment(label, opening.Share, opening.Salt) != commitment {
+			return ErrInvalidPayment
+		}
+	}
+	return nil
+}
+
+/*
+Proof of double spending: two payments of the same coin with different challenges
+*/
+type Disclosure struct {
+	First, Second *Payment
+}
+
+/*
+Check the disclosure and return the identity of the double spender
+*/
+func VerifyDisclosure(d *Disclosure, pk *schnorr.PublicKey) ([]byte, error) {
+	if d == nil || VerifyPayment(d.First, pk) != nil || VerifyPayment(d.Second, pk) != nil {
+		return nil, ErrInvalidDisclosure
+	}
+	if d.First.Coin.Message() != d.Second.Coin.Message() {
+		return nil, ErrInvalidDisclosure
+	}
+	for i := 0; i < OfflinePairs; i++ {
+		first, second := challengeBit(d.First.Challenge, i), challengeBit(d.Second.Challenge, i)
+		if first != second {
+			// a_i XOR (a_i XOR ID)
+			identity := xor(d.First.Openings[i].Share, d.Second.Openings[i].Share)
+			return identity[:], nil
+		}
+	}
+	return nil, ErrInvalidDisclosure
+}
+
+/*
+Bank's record of deposited offline payments, detecting double spending.
+Keys and the epoch window come from the Verifier, payments are forgotten with
+their epoch.
+*/
+type DepositLedger struct {
+	verifier *Verifier
+
+	mu       sync.Mutex
+	payments map[uint64]map[string]*Payment // epoch -> coin message -> first payment
+}
+
+func NewDepositLedger(verifier *Verifier) *DepositLedger {
+	return &DepositLedger{verifier: verifier, payments: make(map[uint64]map[string]*Payment)}
+}
+
+/*
+Deposit a payment. A second deposit of the coin with a different challenge
+returns ErrDoubleSpend and the Disclosure revealing the spender, with the same
+challenge ErrDuplicateDeposit (the depositing merchant replays the payment).
+*/
+func (l *DepositLedger) Deposit(p *Payment) (*Disclosure, error) {
+	if p == nil || p.Coin == nil {
+		return nil, ErrInvalidPayment
+	}
+	v := l.verifier
+	v.mu.Lock()
+	now := v.now()
+	v.prune(now)
+	oldest := v.schedule.oldest(now)
+	pk, ok := v.keys[p.Coin.Epoch]
+	v.mu.Unlock()
+
+	switch {
+	case p.Coin.Epoch > v.schedule.Epoch(now):
+		return nil, ErrEpochNotStarted
+	case p.Coin.Epoch < oldest:
+		return nil, ErrEpochExpired
+	case !ok:
+		return nil, ErrUnknownEpoch
+	}
+	if err := VerifyPayment(p, pk); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for epoch := range l.payments {
+		if epoch < oldest {
+			delete(l.payments, epoch)
+		}
+	}
+	payments, ok := l.payments[p.Coin.Epoch]
+	if !ok {
+		payments = make(map[string]*Payment)
+		l.payments[p.Coin.Epoch] = payments
+	}
+	m := p.Coin.Message()
+	first, ok := payments[m]
+	if !ok {
+		payments[m] = p
+		return nil, nil
+	}
+	if first.Challenge == p.Challenge {
+		return nil, ErrDuplicateDeposit
+	}
+	return &Disclosure{first, p}, ErrDoubleSpend
+}
+
+/*
+Bank -> user: one blind commitment per candidate
+*/
+type WithdrawalCommitment struct {
+	Epoch       uint64
+	Commitments []*schnorr.BlindCommitment
+}
+
+/*
+User -> bank: secrets of a candidate the bank didn't keep
+*/
+type CandidateOpening struct {
+	Index int
+	Seed  []byte // blinding seed of the candidate
+	Pairs [OfflinePairs]PairOpening
+}
+
+/*
+Secrets of a commitment pair: share A of x (and A XOR ID of y), salts C of x and D of y
+*/
+type PairOpening struct {
+	A, C, D [32]byte
+}
+
+/*
+Bank side of a withdrawal for the user with the registered identity
+*/
+type WithdrawalSigner struct {
+	identity [IdentitySize]byte
+	pk       *schnorr.PublicKey
+	epoch    uint64
+	signers  []*schnorr.BlindSigner
+	commits  []*schnorr.BlindCommitment
+
+	challenges []*schnorr.BlindChallenge
+	keep       int
+}
+
+/*
+User side of a withdrawal
+*/
+type Withdrawal struct {
+	pk         *schnorr.PublicKey
+	identity   [IdentitySize]byte
+	epoch      uint64
+	candidates []*withdrawalCandidate
+	keep       int
+}
+
+type withdrawalCandidate struct {
+	seed      []byte
+	coin      *SpendableCoin
+	requester *schnorr.BlindRequester
+}
+
+/*
+Withdrawal of an offline coin of the issuer's current epoch by the user with
+the identity, which the bank has to know (e.g. the account ID)
+*/
+func NewWithdrawalSigner(issuer *Issuer, identity []byte) (*WithdrawalSigner, error) {
+	if len(identity) != IdentitySize {
+		return nil, ErrInvalidIdentity
+	}
+	s := &WithdrawalSigner{keep: -1}
+	copy(s.identity[:], identity)
+	for len(s.signers) < WithdrawalCandidates {
+		epoch, signer, err := issuer.Signer()
+		if err != nil {
+			return nil, err
+		}
+		// all candidates belong to one epoch, start over across an epoch change
+		if len(s.signers) > 0 && epoch != s.epoch {
+			s.signers, s.commits = nil, nil
+		}
+		commitment, err := signer.SignerCommit()
+		if err != nil {
+			return nil, err
+		}
+		s.epoch = epoch
+		s.signers = append(s.signers, signer)
+		s.commits = append(s.commits, commitment)
+	}
+	keys, err := issuer.PublicKeys()
+	if err != nil {
+		return nil, err
+	}
+	if s.pk = keys[s.epoch]; s.pk == nil {
+		return nil, ErrUnknownEpoch
+	}
+	return s, nil
+}
+
+/*
+Step 1 - commitments of all candidates
+*/
+func (s *WithdrawalSigner) Commit() *WithdrawalCommitment {
+	return &WithdrawalCommitment{s.epoch, append([]*schnorr.BlindCommitment(nil), s.commits...)}
+}
+
+/*
+Step 3 - pick the candidate to sign at random, the others have to be opened
+*/
+func (s *WithdrawalSigner) Choose(challenges []*schnorr.BlindChallenge) (int, error) {
+	if s.challenges != nil {
+		return 0, schnorr.ErrBlindState
+	}
+	if len(challenges) != WithdrawalCandidates {
+		return 0, ErrInvalidOpening
+	}
+	var b [1]byte
+	if _, err := io.ReadFull(entropy.Reader, b[:]); err != nil {
+		return 0, err
+	}
+	s.challenges = append([]*schnorr.BlindChallenge(nil), challenges...)
+	s.keep = int(b[0]) % WithdrawalCandidates
+	return s.keep, nil
+}
+
+/*
+Step 5 - check the openings of all other candidates and sign the kept one
+*/
+func (s *WithdrawalSigner) Respond(openings []*CandidateOpening) (*schnorr.BlindResponse, error) {
+	if s.keep < 0 {
+		return nil, schnorr.ErrBlindState
+	}
+	keep := s.keep
+	s.keep = -1
+
+	opened := make(map[int]bool)
+	for _, opening := range openings {
+		j := opening.Index
+		if j < 0 || j >= WithdrawalCandidates || j == keep || opened[j] {
+			return nil, ErrInvalidOpening
+		}
+		opened[j] = true
+
+		coin := &OfflineCoin{Epoch: s.epoch}
+		for i, pair := range opening.Pairs {
+			coin.X[i] = shareCommitment('x', pair.A, pair.C)
+			coin.Y[i] = shareCommitment('y', xor(pair.A, s.identity), pair.D)
+		}
+		requester, err := schnorr.NewSeededBlindRequester(s.pk, opening.Seed, strconv.Itoa(j))
+		if err != nil {
+			return nil, ErrInvalidOpening
+		}
+		challenge, err := requester.RequesterChallenge(s.commits[j], coin.Message())
+		if err != nil || s.challenges[j] == nil || s.challenges[j].C == nil || challenge.C.Cmp(s.challenges[j].C) != 0 {
+			return nil, ErrInvalidOpening
+		}
+	}
+	if len(opened) != WithdrawalCandidates-1 {
+		return nil, ErrInvalidOpening
+	}
+	return s.signers[keep].SignerRespond(s.challenges[keep])
+}
+
+/*
+Withdrawal of a coin signed by pk, carrying the identity
+*/
+func NewWithdrawal(pk *schnorr.PublicKey, identity []byte) (*Withdrawal, error) {
+	if len(identity) != IdentitySize {
+		return nil, ErrInvalidIdentity
+	}
+	w := &Withdrawal{pk: pk, keep: -1}
+	copy(w.identity[:], identity)
+	return w, nil
+}
+
+/*
+Step 2 - prepare the candidates and blind them to the bank's commitments
+*/
+func (w *Withdrawal) Challenges(commitment *WithdrawalCommitment) ([]*schnorr.BlindChallenge, error) {
+	if w.candidates != nil {
+		return nil, schnorr.ErrBlindState
+	}
+	if commitment == nil || len(commitment.Commitments) != WithdrawalCandidates {
+		return nil, ErrInvalidOpening
+	}
+
+	w.epoch = commitment.Epoch
+	challenges := make([]*schnorr.BlindChallenge, WithdrawalCandidates)
+	for j := range challenges {
+		candidate := &withdrawalCandidate{seed: make([]byte, 32)}
+		coin := &SpendableCoin{Coin: &OfflineCoin{Epoch: w.epoch}, identity: w.identity}
+		if _, err := io.ReadFull(entropy.Reader, candidate.seed); err != nil {
+			return nil, err
+		}
+		for i := range coin.pairs {
+			pair := &coin.pairs[i]
+			for _, secret := range [][]byte{pair.a[:], pair.c[:], pair.d[:]} {
+				if _, err := io.ReadFull(entropy.Reader, secret); err != nil {
+					return nil, err
+				}
+			}
+			coin.Coin.X[i] = shareCommitment('x', pair.a, pair.c)
+			coin.Coin.Y[i] = shareCommitment('y', xor(pair.a, w.identity), pair.d)
+		}
+		candidate.coin = coin
+
+		requester, err := schnorr.NewSeededBlindRequester(w.pk, candidate.seed, strconv.Itoa(j))
+		if err != nil {
+			return nil, err
+		}
+		if challenges[j], err = requester.RequesterChallenge(commitment.Commitments[j], coin.Coin.Message()); err != nil {
+			return nil, err
+		}
+		candidate.requester = requester
+		w.candidates = append(w.candidates, candidate)
+	}
+	return challenges, nil
+}
+
+/*
+Step 4 - open all candidates but the kept one
+*/
+func (w *Withdrawal) Open(keep int) ([]*CandidateOpening, error) {
+	if w.candidates == nil || w.keep >= 0 {
+		return nil, schnorr.ErrBlindState
+	}
+	if keep < 0 || keep >= len(w.candidates) {
+		return nil, ErrInvalidOpening
+	}
+	w.keep = keep
+
+	var openings []*CandidateOpening
+	for j, candidate := range w.candidates {
+		if j == keep {
+			continue
+		}
+		opening := &CandidateOpening{Index: j, Seed: candidate.seed}
+		for i, pair := range candidate.coin.pairs {
+			opening.Pairs[i] = PairOpening{pair.a, pair.c, pair.d}
+		}
+		openings = append(openings, opening)
+	}
+	return openings, nil
+}
+
+/*
+Step 6 - unblind the signature of the kept candidate
+*/
+func (w *Withdrawal) Finalize(response *schnorr.BlindResponse) (*SpendableCoin, error) {
+	if w.keep < 0 {
+		return nil, schnorr.ErrBlindState
+	}
+	candidate := w.candidates[w.keep]
+	signature, err := candidate.requester.RequesterFinalize(response)
+	if err != nil {
+		return nil, err
+	}
+	candidate.coin.Coin.Signature = signature
+	return candidate.coin, nil
+}
+
+/*
+Encoding: epoch||x_1||y_1||...||signature
+*/
+func (c *OfflineCoin) Bytes() []byte {
+	buf := binary.BigEndian.AppendUint64(nil, c.Epoch)
+	for i := range c.X {
+		buf = append(buf, c.X[i][:]...)
+		buf = append(buf, c.Y[i][:]...)
+	}
+	return append(buf, c.Signature.Bytes()...)
+}
+
+func ParseOfflineCoin(b []byte) (*OfflineCoin, error) {
+	if len(b) < 8+OfflinePairs*64 {
+		return nil, ErrInvalidPayment
+	}
+	c := &OfflineCoin{Epoch: binary.BigEndian.Uint64(b)}
+	b = b[8:]
+	for i := range c.X {
+		copy(c.X[i][:], b)
+		copy(c.Y[i][:], b[32:])
+		b = b[64:]
+	}
+	signature, err := schnorr.ParseSignature(b)
+	if err != nil {
+		return nil, ErrInvalidPayment
+	}
+	c.Signature = signature
+	return c, nil
+}
+
+/*
+Encoding: challenge||(share||salt)...||coin
+*/
+func (p *Payment) Bytes() []byte {
+	buf := append([]byte(nil), p.Challenge[:]...)
+	for _, opening := range p.Openings {
+		buf = append(buf, opening.Share[:]...)
+		buf = append(buf, opening.Salt[:]...)
+	}
+	return append(buf, p.Coin.Bytes()...)
+}
+
+func ParsePayment(b []byte) (*Payment, error) {
+	if len(b) < OfflinePairs/8+OfflinePairs*(IdentitySize+32) {
+		return nil, ErrInvalidPayment
+	}
+	p := &Payment{}
+	b = b[copy(p.Challenge[:], b):]
+	for i := range p.Openings {
+		b = b[copy(p.Openings[i].Share[:], b):]
+		b = b[copy(p.Openings[i].Salt[:], b):]
+	}
+	coin, err := ParseOfflineCoin(b)
+	if err != nil {
+		return nil, err
+	}
+	p.Coin = coin
+	return p, nil
+}
+
+/*
+Encoding: len(first)||first||len(second)||second
+*/
+func (d *Disclosure) Bytes() []byte {
+	return appendField(appendField(nil, d.First.Bytes()), d.Second.Bytes())
+}
+
+func ParseDisclosure(b []byte) (*Disclosure, error) {
+	first, b, err := readField(b)
+	if err != nil {
+		return nil, ErrInvalidDisclosure
+	}
+	second, b, err := readField(b)
+	if err != nil || len(b) != 0 {
+		return nil, ErrInvalidDisclosure
+	}
+	d := &Disclosure{}
+	if d.First, err = ParsePayment(first); err != nil {
+		return nil, err
+	}
+	if d.Second, err = ParsePayment(second); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func shareCommitment(label byte, share [IdentitySize]byte, salt [32]byte) [32]byte {
+	h := sha256.New()
+	h.Write([]byte{label})
+	h.Write(share[:])
+	h.Write(salt[:])
+	var commitment [32]byte
+	h.Sum(commitment[:0])
+	return commitment
+}
+
+func challengeBit(challenge [OfflinePairs / 8]byte, i int) byte {
+	return challenge[i/8] >> (i % 8) & 1
+}
+
+func xor(a, b [32]byte) [32]byte {
+	var out [32]byte
+	subtle.XORBytes(out[:], a[:], b[:])
+	return out
+}
@@ -0,0 +1,448 @@
+package tokens
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Refresh: swapping coins for new ones
+
+A wallet exchanges spent-to-be coins for fresh coins of the same total value,
+e.g. to receive change, to merge or split denominations, or to move coins of
+an old epoch into the current one before they expire:
+
+	1. Commit(amounts)        mint -> wallet: session, epoch, one commitment per new coin
+	2. Refresh(request)       wallet -> mint: session, input coins, blinded challenges
+	                          mint -> wallet: responses
+
+Step 1 has no effect besides opening the session. Step 2 is the single
+interaction that moves value and it's atomic: the mint answers all challenges
+and spends all inputs, or (if any input is invalid or spent, or the values
+don't match) answers none and spends nothing.
+
+The new coins are blinded with fresh serials, so the mint, which sees the
+input coins, can't link them to the output coins when those are redeemed
+later. What it learns is the amounts on both sides of the swap and the timing.
+*/
+
+var (
+	ErrUnknownSession = errors.New("tokens: unknown or expired refresh session")
+	ErrValueMismatch  = errors.New("tokens: input and output values differ")
+	ErrInvalidRefresh = errors.New("tokens: invalid refresh message")
+)
+
+/*
+Mint -> wallet: commitments of the new coins, in the order of the requested amounts
+*/
+type RefreshCommitment struct {
+	Session     string
+	Epoch       uint64
+	Amounts     []uint64
+	Commitments []*schnorr.BlindCommitment
+}
+
+/*
+Wallet -> mint: coins to redeem and the blinded challenges of the new coins
+*/
+type RefreshRequest struct {
+	Session    string
+	Inputs     []*Coin
+	Challenges []*schnorr.BlindChallenge
+}
+
+type refreshSession struct {
+	amounts []uint64
+	signers []*schnorr.BlindSigner
+	expires time.Time
+}
+
+/*
+Mint side of the refresh protocol, redeeming inputs with its own double-spend
+database
+*/
+type Exchange struct {
+	mint     *Mint
+	verifier *MintVerifier
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*refreshSession
+}
+
+/*
+Exchange of the mint's coins, refresh sessions have to be completed within ttl
+*/
+func NewExchange(mint *Mint, ttl time.Duration) (*Exchange, error) {
+	verifier, err := NewMintVerifier(mint.schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &Exchange{mint: mint, verifier: verifier, ttl: ttl, now: schnorr.Now, sessions: make(map[string]*refreshSession)}, nil
+}
+
+/*
+Step 1 - open a session for new coins of the amounts
+*/
+func (x *Exchange) Commit(amounts []uint64) (*RefreshCommitment, error) {
+	if len(amounts) == 0 {
+		return nil, ErrInvalidRefresh
+	}
+	session := &refreshSession{amounts: append([]uint64(nil), amounts...), expires: x.now().Add(x.ttl)}
+	commitment := &RefreshCommitment{Amounts: session.amounts}
+	for i, amount := range amounts {
+		epoch, signer, err := x.mint.Signer(amount)
+		if err != nil {
+			return nil, err
+		}
+		// all coins of a session belong to one epoch, retry across an epoch change
+		if i > 0 && epoch != commitment.Epoch {
+			return x.Commit(amounts)
+		}
+		signerCommitment, err := signer.SignerCommit()
+		if err != nil {
+			return nil, err
+		}
+		commitment.Epoch = epoch
+		session.signers = append(session.signers, signer)
+		commitment.Commitments = append(commitment.Commitments, signerCommitment)
+	}
+
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(entropy.Reader, id); err != nil {
+		return nil, err
+	}
+	commitment.Session = hex.EncodeToString(id)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.prune()
+	x.sessions[commitment.Session] = session
+	return commitment, nil
+}
+
+/*
+Step 2 - redeem the inputs and answer the challenges, all or nothing.
+The session is closed even if the refresh fails.
+*/
+func (x *Exchange) Refresh(req *RefreshRequest) ([]*schnorr.BlindResponse, error) {
+	if req == nil {
+		return nil, ErrInvalidRefresh
+	}
+
+	x.mu.Lock()
+	x.prune()
+	session, ok := x.sessions[req.Session]
+	delete(x.sessions, req.Session)
+	x.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownSession
+	}
+	if len(req.Challenges) != len(session.signers) {
+		return nil, ErrInvalidRefresh
+	}
+
+	var in, out uint64
+	for _, coin := range req.Inputs {
+		if coin == nil {
+			return nil, ErrInvalidToken
+		}
+		in += coin.Amount
+	}
+	for _, amount := range session.amounts {
+		out += amount
+	}
+	if in != out {
+		return nil, ErrValueMismatch
+	}
+
+	// responses are computed first and released only after the inputs are spent
+	responses := make([]*schnorr.BlindResponse, len(session.signers))
+	for i, signer := range session.signers {
+		response, err := signer.SignerRespond(req.Challenges[i])
+		if err != nil {
+			return nil, err
+		}
+		responses[i] = response
+	}
+
+	ks, err := x.mint.Keyset()
+	if err != nil {
+		return nil, err
+	}
+	if err := x.verifier.SetKeyset(ks); err != nil {
+		return nil, err
+	}
+	if _, err := x.verifier.Redeem(req.Inputs...); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+/*
+Drop expired sessions, x.mu has to be held
+*/
+func (x *Exchange) prune() {
+	now := x.now()
+	for id, session := range x.sessions {
+		if now.After(session.expires) {
+			delete(x.sessions, id)
+		}
+	}
+}
+
+/*
+Wallet side of a refresh
+*/
+type Refresh struct {
+	ks       *Keyset
+	inputs   []*Coin
+	requests []*CoinRequest
+}
+
+/*
+Swap inputs for new coins, whose amounts the wallet asks the mint to Commit to
+(see Denominate)
+*/
+func NewRefresh(ks *Keyset, inputs []*Coin) *Refresh {
+	return &Refresh{ks: ks, inputs: append([]*Coin(nil), inputs...)}
+}
+
+/*
+Value of the inputs
+*/
+func (r *Refresh) Value() uint64 {
+	var value uint64
+	for _, coin := range r.inputs {
+		value += coin.Amount
+	}
+	return value
+}
+
+/*
+Blind fresh serials for the mint's commitments
+*/
+func (r *Refresh) Request(commitment *RefreshCommitment) (*RefreshRequest, error) {
+	if r.requests != nil {
+		return nil, schnorr.ErrBlindState
+	}
+	if commitment == nil || len(commitment.Amounts) != len(commitment.Commitments) {
+		return nil, ErrInvalidRefresh
+	}
+
+	req := &RefreshRequest{Session: commitment.Session, Inputs: r.inputs}
+	var out uint64
+	for i, amount := range commitment.Amounts {
+		coin, err := newCoinRequest(r.ks, amount, commitment.Epoch)
+		if err != nil {
+			return nil, err
+		}
+		challenge, err := coin.Challenge(commitment.Commitments[i])
+		if err != nil {
+			return nil, err
+		}
+		r.requests = append(r.requests, coin)
+		req.Challenges = append(req.Challenges, challenge)
+		out += amount
+	}
+	if out != r.Value() {
+		return nil, ErrValueMismatch
+	}
+	return req, nil
+}
+
+/*
+Unblind the mint's responses into the new coins
+*/
+func (r *Refresh) Finalize(responses []*schnorr.BlindResponse) ([]*Coin, error) {
+	if len(responses) != len(r.requests) {
+		return nil, ErrInvalidRefresh
+	}
+	coins := make([]*Coin, len(responses))
+	for i, response := range responses {
+		coin, err := r.requests[i].Finalize(response)
+		if err != nil {
+			return nil, err
+		}
+		coins[i] = coin
+	}
+	return coins, nil
+}
+
+/*
+Encoding: len(session)||session||epoch||count||(amount||len(R)||R)...,
+counts are 2 bytes
+*/
+func (c *RefreshCommitment) Bytes() []byte {
+	buf := appendField(nil, []byte(c.Session))
+	buf = binary.BigEndian.AppendUint64(buf, c.Epoch)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(c.Commitments)))
+	for i, commitment := range c.Commitments {
+		buf = binary.BigEndian.AppendUint64(buf, c.Amounts[i])
+		buf = appendField(buf, commitment.Bytes())
+	}
+	return buf
+}
+
+func ParseRefreshCommitment(b []byte) (*RefreshCommitment, error) {
+	session, b, err := readField(b)
+	if err != nil || len(b) < 8+2 {
+		return nil, ErrInvalidRefresh
+	}
+	c := &RefreshCommitment{Session: string(session), Epoch: binary.BigEndian.Uint64(b)}
+	count := int(binary.BigEndian.Uint16(b[8:]))
+	b = b[8+2:]
+	for i := 0; i < count; i++ {
+		if len(b) < 8 {
+			return nil, ErrInvalidRefresh
+		}
+		amount := binary.BigEndian.Uint64(b)
+		var field []byte
+		if field, b, err = readField(b[8:]); err != nil {
+			return nil, err
+		}
+		commitment, err := schnorr.ParseBlindCommitment(field)
+		if err != nil {
+			return nil, ErrInvalidRefresh
+		}
+		c.Amounts = append(c.Amounts, amount)
+		c.Commitments = append(c.Commitments, commitment)
+	}
+	if len(b) != 0 {
+		return nil, ErrInvalidRefresh
+	}
+	return c, nil
+}
+
+/*
+Encoding: len(session)||session||count||(len(coin)||coin)...||count||(len(c)||c)...
+*/
+func (r *RefreshRequest) Bytes() []byte {
+	buf := appendField(nil, []byte(r.Session))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(r.Inputs)))
+	for _, coin := range r.Inputs {
+		buf = appendField(buf, coin.Bytes())
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(r.Challenges)))
+	for _, challenge := range r.Challenges {
+		buf = appendField(buf, challenge.Bytes())
+	}
+	return buf
+}
+
+func ParseRefreshRequest(b []byte) (*RefreshRequest, error) {
+	session, b, err := readField(b)
+	if err != nil {
+		return nil, err
+	}
+	r := &RefreshRequest{Session: string(session)}
+
+	fields, b, err := readFields(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		coin, err := ParseCoin(field)
+		if err != nil {
+			return nil, err
+		}
+		r.Inputs = append(r.Inputs, coin)
+	}
+
+	if fields, b, err = readFields(b); err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		challenge, err := schnorr.ParseBlindChallenge(field)
+		if err != nil {
+			return nil, ErrInvalidRefresh
+		}
+		r.Challenges = append(r.Challenges, challenge)
+	}
+	if len(b) != 0 {
+		return nil, ErrInvalidRefresh
+	}
+	return r, nil
+}
+
+/*
+Encoding of the mint's responses: count||(len(s)||s)...
+*/
+func RefreshResponseBytes(responses []*schnorr.BlindResponse) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, uint16(len(responses)))
+	for _, response := range responses {
+		buf = appendField(buf, response.Bytes())
+	}
+	return buf
+}
+
+func ParseRefreshResponse(b []byte) ([]*schnorr.BlindResponse, error) {
+	fields, b, err := readFields(b)
+	if err != nil || len(b) != 0 {
+		return nil, ErrInvalidRefresh
+	}
+	responses := make([]*schnorr.BlindResponse, len(fields))
+	for i, field := range fields {
+		if responses[i], err = schnorr.ParseBlindResponse(field); err != nil {
+			return nil, ErrInvalidRefresh
+		}
+	}
+	return responses, nil
+}
+
+/*
+Request for a coin of the amount in the given epoch of the keyset
+*/
+func newCoinRequest(ks *Keyset, amount, epoch uint64) (*CoinRequest, error) {
+	pk, err := ks.PublicKey(amount, epoch)
+	if err != nil {
+		return nil, err
+	}
+	serial := make([]byte, 32)
+	if _, err := io.ReadFull(entropy.Reader, serial); err != nil {
+		return nil, err
+	}
+	return &CoinRequest{amount, epoch, serial, schnorr.NewBlindRequester(pk)}, nil
+}
+
+func appendField(buf, field []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(field)))
+	return append(buf, field...)
+}
+
+func readField(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 || uint64(len(b)-4) < uint64(binary.BigEndian.Uint32(b)) {
+		return nil, nil, ErrInvalidRefresh
+	}
+	n := binary.BigEndian.Uint32(b)
+	return b[4 : 4+n], b[4+n:], nil
+}
+
+/*
+count||(len(field)||field)..., returns the fields and the rest of b
+*/
+func readFields(b []byte) ([][]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, ErrInvalidRefresh
+	}
+	count := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	fields := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		field, rest, err := readField(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields = append(fields, field)
+		b = rest
+	}
+	return fields, b, nil
+}
@@ -0,0 +1,450 @@
+/*
+Blind-token issuance with key epochs.
+
+An Issuer signs tokens blindly (schnorr.BlindSigner) with a key that changes
+every epoch. A token is valid only for the epoch it was issued in, and a
+Verifier accepts the last Window epochs, so:
+
+  - tokens can't be hoarded: a token unspent for Window epochs expires,
+  - the double-spend database only holds serials of the accepted epochs,
+    older epochs are dropped as a whole.
+
+Epoch n covers [Start + n*Period, Start + (n+1)*Period). The issuer publishes
+its schedule and the public keys of the accepted epochs as JSON
+(Issuer.ScheduleHandler), clients pick the key to request tokens with and
+verifiers load the keys with Verifier.SetSchedule.
+
+A client requests a token for a random serial:
+
+	epoch, signer, err := issuer.Signer()              // issuer side, one session per token
+	requester := schnorr.NewBlindRequester(pk)         // client side, pk of the epoch
+	requester.RequesterChallenge(commitment, tokens.Message(epoch, serial))
+	token := &tokens.Token{Epoch: epoch, Serial: serial, Signature: signature}
+
+The blind signer never sees the serial, so redemptions can't be linked to
+issuance sessions beyond the epoch, which is shared by all tokens of the epoch.
+*/
+package tokens
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrInvalidSchedule = errors.New("tokens: invalid epoch schedule")
+	ErrEpochNotStarted = errors.New("tokens: token epoch hasn't started")
+	ErrEpochExpired    = errors.New("tokens: token epoch is no longer accepted")
+	ErrUnknownEpoch    = errors.New("tokens: no key for the token epoch")
+	ErrInvalidToken    = errors.New("tokens: invalid token")
+	ErrTokenSpent      = errors.New("tokens: token already redeemed")
+)
+
+/*
+Epoch schedule: epoch length and number of epochs accepted at once
+*/
+type Schedule struct {
+	Start  time.Time     // start of epoch 0
+	Period time.Duration // length of an epoch
+	Window int           // accepted epochs including the current one, at least 1
+}
+
+func (s Schedule) Validate() error {
+	if s.Period <= 0 || s.Window < 1 {
+		return ErrInvalidSchedule
+	}
+	return nil
+}
+
+/*
+Epoch of time t, 0 before Start
+*/
+func (s Schedule) Epoch(t time.Time) uint64 {
+	if t.Before(s.Start) {
+		return 0
+	}
+	return uint64(t.Sub(s.Start) / s.Period)
+}
+
+/*
+Time span of the epoch, [notBefore, notAfter)
+*/
+func (s Schedule) Bounds(epoch uint64) (time.Time, time.Time) {
+	notBefore := s.Start.Add(time.Duration(epoch) * s.Period)
+	return notBefore, notBefore.Add(s.Period)
+}
+
+/*
+Oldest epoch accepted at time t
+*/
+func (s Schedule) oldest(t time.Time) uint64 {
+	if current := s.Epoch(t); current >= uint64(s.Window) {
+		return current - uint64(s.Window) + 1
+	}
+	return 0
+}
+
+/*
+Redeemable token: blind signature of Message(Epoch, Serial) by the epoch key
+*/
+type Token struct {
+	Epoch     uint64
+	Serial    []byte
+	Signature *schnorr.Signature
+}
+
+/*
+Message signed for the token, H("schnorr/tokens/v1"||epoch||serial) in hex
+*/
+func Message(epoch uint64, serial []byte) string {
+	h := sha256.New()
+	h.Write([]byte("schnorr/tokens/v1"))
+	h.Write(binary.BigEndian.AppendUint64(nil, epoch))
+	h.Write(serial)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+/*
+Encoding: epoch||len(serial)||serial||signature, lengths are 2 bytes
+*/
+func (t *Token) Bytes() []byte {
+	buf := binary.BigEndian.AppendUint64(nil, t.Epoch)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(t.Serial)))
+	buf = append(buf, t.Serial...)
+	return append(buf, t.Signature.Bytes()...)
+}
+
+func ParseToken(b []byte) (*Token, error) {
+	if len(b) < 8+2 {
+		return nil, ErrInvalidToken
+	}
+	n := int(binary.BigEndian.Uint16(b[8:]))
+	if len(b) < 8+2+n {
+		return nil, ErrInvalidToken
+	}
+	signature, err := schnorr.ParseSignature(b[8+2+n:])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	serial := append([]byte(nil), b[8+2:8+2+n]...)
+	return &Token{binary.BigEndian.Uint64(b), serial, signature}, nil
+}
+
+type epochKey struct {
+	sk *schnorr.SignatureKey // nil once the epoch has ended
+	pk *schnorr.PublicKey
+}
+
+/*
+Token issuer, generates a key for every epoch
+*/
+type Issuer struct {
+	schedule Schedule
+	paramsID uint16
+	now      func() time.Time
+
+	mu   sync.Mutex
+	keys map[uint64]*epochKey
+}
+
+/*
+Issuer generating the epoch keys with registered parameters paramsID
+*/
+func NewIssuer(schedule Schedule, paramsID uint16) (*Issuer, error) {
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := schnorr.LookupGroup(paramsID); err != nil {
+		return nil, err
+	}
+	return &Issuer{schedule: schedule, paramsID: paramsID, now: schnorr.Now, keys: make(map[uint64]*epochKey)}, nil
+}
+
+/*
+Blind signer for a token of the current epoch, one per token
+*/
+func (i *Issuer) Signer() (uint64, *schnorr.BlindSigner, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	epoch := i.schedule.Epoch(i.now())
+	key, err := i.rotate(epoch)
+	if err != nil {
+		return 0, nil, err
+	}
+	return epoch, schnorr.NewBlindSigner(key.sk), nil
+}
+
+/*
+Public keys of the accepted epochs, by epoch
+*/
+func (i *Issuer) PublicKeys() (map[uint64]*schnorr.PublicKey, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, err := i.rotate(i.schedule.Epoch(i.now())); err != nil {
+		return nil, err
+	}
+	keys := make(map[uint64]*schnorr.PublicKey, len(i.keys))
+	for epoch, key := range i.keys {
+		keys[epoch] = key.pk
+	}
+	return keys, nil
+}
+
+/*
+Key of the current epoch, generated on first use. Private keys of ended epochs
+are dropped, public keys are kept while their epoch is accepted.
+*/
+func (i *Issuer) rotate(current uint64) (*epochKey, error) {
+	oldest := i.schedule.oldest(i.now())
+	for epoch, key := range i.keys {
+		if epoch < oldest {
+			delete(i.keys, epoch)
+		} else if epoch < current {
+			key.sk = nil
+		}
+	}
+
+	if key, ok := i.keys[current]; ok {
+		return key, nil
+	}
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(i.paramsID)
+	if err != nil {
+		return nil, err
+	}
+	key := &epochKey{sk, pk}
+	i.keys[current] = key
+	return key, nil
+}
+
+/*
+Published schedule, the JSON served by ScheduleHandler
+*/
+type EpochSchedule struct {
+	Start   int64       `json:"start"`  // unix time of epoch 0
+	Period  int64       `json:"period"` // seconds
+	Window  int         `json:"window"`
+	Current uint64      `json:"current"`
+	Epochs  []EpochInfo `json:"epochs"` // accepted epochs, oldest first
+}
+
+type EpochInfo struct {
+	Epoch     uint64 `json:"epoch"`
+	NotBefore int64  `json:"not_before"`
+	NotAfter  int64  `json:"not_after"`
+	PublicKey string `json:"public_key"` // hex of schnorr.PublicKey.Bytes
+}
+
+/*
+Current schedule with the keys of the accepted epochs
+*/
+func (i *Issuer) Schedule() (*EpochSchedule, error) {
+	keys, err := i.PublicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	now := i.now()
+	doc := &EpochSchedule{
+		Start:   i.schedule.Start.Unix(),
+		Period:  int64(i.schedule.Period / time.Second),
+		Window:  i.schedule.Window,
+		Current: i.schedule.Epoch(now),
+	}
+	for epoch := i.schedule.oldest(now); epoch <= doc.Current; epoch++ {
+		pk, ok := keys[epoch]
+		if !ok {
+			continue
+		}
+		notBefore, notAfter := i.schedule.Bounds(epoch)
+		doc.Epochs = append(doc.Epochs, EpochInfo{epoch, notBefore.Unix(), notAfter.Unix(), hex.EncodeToString(pk.Bytes())})
+	}
+	return doc, nil
+}
+
+/*
+GET endpoint serving the schedule, cacheable until the current epoch ends
+*/
+func (i *Issuer) ScheduleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, err := i.Schedule()
+		serveJSON(w, r, doc, err, i.schedule, i.now())
+	})
+}
+
+/*
+Serve GET and HEAD requests with the JSON of doc, cacheable until the epoch
+current at now ends
+*/
+func serveJSON(w http.ResponseWriter, r *http.Request, doc interface{}, err error, schedule Schedule, now time.Time) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	_, notAfter := schedule.Bounds(schedule.Epoch(now))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(notAfter.Sub(now)/time.Second)))
+	json.NewEncoder(w).Encode(doc)
+}
+
+/*
+Token verifier with double-spend protection. Serials are remembered per epoch
+and forgotten when the epoch leaves the window.
+*/
+type Verifier struct {
+	schedule Schedule
+	now      func() time.Time
+
+	mu    sync.Mutex
+	keys  map[uint64]*schnorr.PublicKey
+	spent map[uint64]map[string]struct{}
+}
+
+func NewVerifier(schedule Schedule) (*Verifier, error) {
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	return &Verifier{
+		schedule: schedule,
+		now:      schnorr.Now,
+		keys:     make(map[uint64]*schnorr.PublicKey),
+		spent:    make(map[uint64]map[string]struct{}),
+	}, nil
+}
+
+/*
+Accept tokens of the epoch signed by pk
+*/
+func (v *Verifier) AddKey(epoch uint64, pk *schnorr.PublicKey) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys[epoch] = pk
+}
+
+/*
+Load the epoch keys of the published schedule, which has to match the
+verifier's schedule
+*/
+func (v *Verifier) SetSchedule(doc *EpochSchedule) error {
+	if doc.Start != v.schedule.Start.Unix() || doc.Period != int64(v.schedule.Period/time.Second) {
+		return ErrInvalidSchedule
+	}
+	keys := make(map[uint64]*schnorr.PublicKey, len(doc.Epochs))
+	for _, info := range doc.Epochs {
+		pk, err := parseEpochKey(info)
+		if err != nil {
+			return err
+		}
+		keys[info.Epoch] = pk
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for epoch, pk := range keys {
+		v.keys[epoch] = pk
+	}
+	return nil
+}
+
+/*
+Verify the token and mark its serial as spent. Locked tokens are redeemed only
+with a Claim, see ClaimVerifier.
+*/
+func (v *Verifier) Redeem(t *Token) error {
+	if t != nil && t.Locked() {
+		return ErrCoinLocked
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.prune(v.now())
+	if err := v.check(t, v.now()); err != nil {
+		return err
+	}
+	v.spend(t)
+	return nil
+}
+
+/*
+Check the token without spending it, v.mu has to be held
+*/
+func (v *Verifier) check(t *Token, now time.Time) error {
+	if t == nil || t.Signature == nil {
+		return ErrInvalidToken
+	}
+	if t.Epoch > v.schedule.Epoch(now) {
+		return ErrEpochNotStarted
+	}
+	if t.Epoch < v.schedule.oldest(now) {
+		return ErrEpochExpired
+	}
+	pk, ok := v.keys[t.Epoch]
+	if !ok {
+		return ErrUnknownEpoch
+	}
+	if !schnorr.VerifySignature(Message(t.Epoch, t.Serial), t.Signature, pk) {
+		return ErrInvalidToken
+	}
+	if _, ok := v.spent[t.Epoch][string(t.Serial)]; ok {
+		return ErrTokenSpent
+	}
+	return nil
+}
+
+/*
+Mark the checked token as spent, v.mu has to be held. Only serials of valid
+tokens are stored, forgers can't fill the database.
+*/
+func (v *Verifier) spend(t *Token) {
+	spent, ok := v.spent[t.Epoch]
+	if !ok {
+		spent = make(map[string]struct{})
+		v.spent[t.Epoch] = spent
+	}
+	spent[string(t.Serial)] = struct{}{}
+}
+
+/*
+Number of remembered serials of the accepted epochs
+*/
+func (v *Verifier) Spent() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.prune(v.now())
+	n := 0
+	for _, spent := range v.spent {
+		n += len(spent)
+	}
+	return n
+}
+
+func (v *Verifier) prune(now time.Time) {
+	oldest := v.schedule.oldest(now)
+	for epoch := range v.spent {
+		if epoch < oldest {
+			delete(v.spent, epoch)
+		}
+	}
+	for epoch := range v.keys {
+		if epoch < oldest {
+			delete(v.keys, epoch)
+		}
+	}
+}
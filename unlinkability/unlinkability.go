@@ -0,0 +1,356 @@
+/*
+Statistical unlinkability check of blind signature implementations
+
+A blind signature scheme is unlinkable if the signer, holding the transcripts
+of all issuance sessions, can't tell which session produced a signature it
+later sees redeemed better than by guessing. Check runs many rounds of n
+issuances, shuffles the redeemed signatures and lets every Linker pick, for
+each signature, the transcript it believes the signature came from:
+
+	correct guesses ~ Binomial(rounds * n, 1/n)   for an unlinkable implementation
+
+A linker is reported as successful when its correct guesses exceed the chance
+level by more than Config.Threshold standard deviations. The built-in linkers
+look for the usual implementation mistakes: values passed through unblinded
+(a or b zero) and blinding factors too short to hide anything. Redemptions
+are shuffled, deployments which redeem tokens in issuance order link them
+regardless of the implementation. The blind Schnorr algebra itself
+makes every transcript consistent with every signature, the Consistency
+linker demonstrates it.
+
+The result is evidence, not a proof: a passing check shows that none of the
+linkers found a correlation in the sample, other correlations may exist.
+Implementations other than schnorr.BlindRequester are checked through Protocol.
+*/
+package unlinkability
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	mrand "math/rand"
+	"strings"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var ErrConfig = errors.New("unlinkability: at least 2 sessions per round and 1 round required")
+
+/*
+Signer's view of an issuance session
+*/
+type Transcript struct {
+	R []byte   // encoded commitment
+	C *big.Int // blinded challenge received
+	S *big.Int // response sent
+}
+
+/*
+Signature as the signer sees it when it's redeemed
+*/
+type Redemption struct {
+	Message   string
+	Signature *schnorr.Signature
+}
+
+/*
+Signer of one session as seen by the user, the check records the messages
+*/
+type Signer interface {
+	Commit() (*schnorr.BlindCommitment, error)
+	Respond(challenge *schnorr.BlindChallenge) (*schnorr.BlindResponse, error)
+}
+
+/*
+Blind signature implementation under test. Issue runs one complete session of
+the user against the signer and returns the signature the user ends up with.
+*/
+type Protocol interface {
+	Issue(signer Signer, pk *schnorr.PublicKey, m string) (*schnorr.Signature, error)
+}
+
+/*
+Protocol of schnorr.BlindRequester, NewRequester (nil for schnorr.NewBlindRequester)
+creates the requester of every session, e.g. a seeded one
+*/
+type RequesterProtocol struct {
+	NewRequester func(pk *schnorr.PublicKey) (*schnorr.BlindRequester, error)
+}
+
+func (rp RequesterProtocol) Issue(signer Signer, pk *schnorr.PublicKey, m string) (*schnorr.Signature, error) {
+	requester := schnorr.NewBlindRequester(pk)
+	if rp.NewRequester != nil {
+		var err error
+		if requester, err = rp.NewRequester(pk); err != nil {
+			return nil, err
+		}
+	}
+	commitment, err := signer.Commit()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := requester.RequesterChallenge(commitment, m)
+	if err != nil {
+		return nil, err
+	}
+	response, err := signer.Respond(challenge)
+	if err != nil {
+		return nil, err
+	}
+	return requester.RequesterFinalize(response)
+}
+
+/*
+Strategy of the signer: the higher the score, the more likely the redemption
+comes from the transcript
+*/
+type Linker interface {
+	Name() string
+	Score(pk *schnorr.PublicKey, t Transcript, r Redemption) float64
+}
+
+type Config struct {
+	Sessions  int      // sessions per round, the signer picks among them
+	Rounds    int      // independent rounds
+	Threshold float64  // standard deviations above chance counted as linkable, default 4
+	Linkers   []Linker // default Linkers()
+	Protocol  Protocol // default RequesterProtocol{}
+	Messages  func(round, session int) string
+}
+
+/*
+Result of one linker over all rounds
+*/
+type LinkerResult struct {
+	Name     string
+	Guesses  int
+	Correct  int
+	Expected float64 // correct guesses expected by chance
+	Z        float64 // standard deviations above chance
+	Linkable bool
+}
+
+type Result struct {
+	Linkers []LinkerResult
+}
+
+/*
+True if no linker did better than chance
+*/
+func (r *Result) Unlinkable() bool {
+	for _, l := range r.Linkers {
+		if l.Linkable {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Result) String() string {
+	var b strings.Builder
+	for _, l := range r.Linkers {
+		verdict := "no better than chance"
+		if l.Linkable {
+			verdict = "LINKS SESSIONS"
+		}
+		fmt.Fprintf(&b, "%-14s %5d/%-5d correct (chance %.1f, z = %5.2f)  %s\n",
+			l.Name, l.Correct, l.Guesses, l.Expected, l.Z, verdict)
+	}
+	return b.String()
+}
+
+/*
+Built-in linkers
+*/
+func Linkers() []Linker {
+	return []Linker{EqualValues{}, ShortFactors{}, Consistency{}}
+}
+
+/*
+Run the check with fresh keys
+*/
+func Check(cfg Config) (*Result, error) {
+	if cfg.Sessions < 2 || cfg.Rounds < 1 {
+		return nil, ErrConfig
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = 4
+	}
+	if cfg.Linkers == nil {
+		cfg.Linkers = Linkers()
+	}
+	if cfg.Protocol == nil {
+		cfg.Protocol = RequesterProtocol{}
+	}
+	if cfg.Messages == nil {
+		cfg.Messages = func(round, session int) string { return fmt.Sprintf("token %d/%d", round, session) }
+	}
+
+	sk, pk := schnorr.GenerateKeys()
+	results := make([]LinkerResult, len(cfg.Linkers))
+	for round := 0; round < cfg.Rounds; round++ {
+		transcripts := make([]Transcript, cfg.Sessions)
+		redemptions := make([]Redemption, cfg.Sessions)
+		for i := range transcripts {
+			m := cfg.Messages(round, i)
+			signer := &recordingSigner{schnorr.NewBlindSigner(sk), &transcripts[i]}
+			signature, err := cfg.Protocol.Issue(signer, pk, m)
+			if err != nil {
+				return nil, err
+			}
+			if transcripts[i].S == nil || signature == nil || !schnorr.VerifySignature(m, signature, pk) {
+				return nil, fmt.Errorf("unlinkability: session %d/%d issued an invalid signature", round, i)
+			}
+			redemptions[i] = Redemption{m, signature}
+		}
+
+		// redemptions arrive in random order, origin[j] is the session of redemption j
+		origin := mrand.Perm(cfg.Sessions)
+		for li, linker := range cfg.Linkers {
+			for _, session := range origin {
+				guess := bestTranscript(linker, pk, transcripts, redemptions[session])
+				results[li].Guesses++
+				if guess == session {
+					results[li].Correct++
+				}
+			}
+		}
+	}
+
+	p := 1 / float64(cfg.Sessions)
+	for i, linker := range cfg.Linkers {
+		r := &results[i]
+		r.Name = linker.Name()
+		r.Expected = float64(r.Guesses) * p
+		r.Z = (float64(r.Correct) - r.Expected) / math.Sqrt(r.Expected*(1-p))
+		r.Linkable = r.Z > cfg.Threshold
+	}
+	return &Result{results}, nil
+}
+
+/*
+Transcript with the highest score, ties broken at random
+*/
+func bestTranscript(linker Linker, pk *schnorr.PublicKey, transcripts []Transcript, r Redemption) int {
+	best, bestScore, ties := 0, math.Inf(-1), 0
+	for i, t := range transcripts {
+		score := linker.Score(pk, t, r)
+		switch {
+		case score > bestScore:
+			best, bestScore, ties = i, score, 1
+		case score == bestScore:
+			// reservoir sampling over the tied transcripts
+			ties++
+			if mrand.Intn(ties) == 0 {
+				best = i
+			}
+		}
+	}
+	return best
+}
+
+/*
+Blinding factors a = s' - s and b = c - H(R'||m) relating a transcript to a signature
+*/
+func factors(pk *schnorr.PublicKey, t Transcript, r Redemption) (*big.Int, *big.Int) {
+	q := pk.Group().Order()
+	a := new(big.Int).Sub(r.Signature.S(), t.S)
+	b := new(big.Int).Sub(t.C, schnorr.Challenge(r.Signature.R, r.Message, pk))
+	return a.Mod(a, q), b.Mod(b, q)
+}
+
+/*
+Counts values shared between the transcript and the signature (R = R', s = s',
+c = H(R'||m)), which unblinded implementations pass through
+*/
+type EqualValues struct{}
+
+func (EqualValues) Name() string { return "equal-values" }
+
+func (EqualValues) Score(pk *schnorr.PublicKey, t Transcript, r Redemption) float64 {
+	a, b := factors(pk, t, r)
+	score := 0.0
+	if bytes.Equal(t.R, r.Signature.R) {
+		score++
+	}
+	if a.Sign() == 0 {
+		score++
+	}
+	if b.Sign() == 0 {
+		score++
+	}
+	return score
+}
+
+/*
+Prefers pairs whose blinding factors are short, e.g. taken from a small
+counter or a weak random number generator
+*/
+type ShortFactors struct{}
+
+func (ShortFactors) Name() string { return "short-factors" }
+
+func (ShortFactors) Score(pk *schnorr.PublicKey, t Transcript, r Redemption) float64 {
+	a, b := factors(pk, t, r)
+	q := pk.Group().Order()
+	short := func(v *big.Int) int {
+		// distance to zero either way, so small negative factors count too
+		neg := new(big.Int).Sub(q, v)
+		if neg.Cmp(v) < 0 {
+			v = neg
+		}
+		return v.BitLen()
+	}
+	return -float64(short(a) + short(b))
+}
+
+/*
+Checks R' == R * g^a * X^b for the factors of the pair. For blind Schnorr
+signatures it holds for every pair, so it can't link: every transcript
+explains every signature.
+*/
+type Consistency struct{}
+
+func (Consistency) Name() string { return "consistency" }
+
+func (Consistency) Score(pk *schnorr.PublicKey, t Transcript, r Redemption) float64 {
+	a, b := factors(pk, t, r)
+	g := pk.Group()
+	R, err := g.Decode(t.R)
+	if err != nil {
+		return 0
+	}
+	RP, err := g.Encode(g.Add(g.Add(R, g.ScalarBaseMult(a)), g.ScalarMult(pk.X, b)))
+	if err == nil && bytes.Equal(RP, r.Signature.R) {
+		return 1
+	}
+	return 0
+}
+
+/*
+BlindSigner recording the messages of its session
+*/
+type recordingSigner struct {
+	signer     *schnorr.BlindSigner
+	transcript *Transcript
+}
+
+func (rs *recordingSigner) Commit() (*schnorr.BlindCommitment, error) {
+	commitment, err := rs.signer.SignerCommit()
+	if err != nil {
+		return nil, err
+	}
+	rs.transcript.R = commitment.R
+	return commitment, nil
+}
+
+func (rs *recordingSigner) Respond(challenge *schnorr.BlindChallenge) (*schnorr.BlindResponse, error) {
+	response, err := rs.signer.SignerRespond(challenge)
+	if err != nil {
+		return nil, err
+	}
+	rs.transcript.C, rs.transcript.S = challenge.C, response.S
+	return response, nil
+}
@@ -0,0 +1,321 @@
+/*
+Verification-only subset of the schnorr package.
+
+The package depends only on the standard library (and internal helpers of
+this module) and contains no key generation, signing or protocol code,
+so applications which only check signatures can import it instead of the
+full schnorr package.
+The schnorr package delegates its verification to this package, so both
+always accept exactly the same signatures.
+*/
+package verifier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/miki799/schnorr-signature/internal/group"
+	"github.com/miki799/schnorr-signature/internal/modp"
+)
+
+var (
+	ErrInvalidEncoding  = errors.New("verifier: invalid encoding")
+	ErrInvalidPublicKey = errors.New("verifier: invalid public key")
+	ErrInvalidSignature = errors.New("verifier: signature components out of range")
+
+	ErrInvalidEnvironment = errors.New("verifier: invalid environment tag")
+	ErrInvalidContext     = errors.New("verifier: signing context too long")
+)
+
+const (
+	MaxContextLength = 255
+
+	// context of signatures of SHA-256 digests of streams (schnorr.SignReader
+	// and the CLI's sign command), the message is the digest
+	StreamContext = "schnorr/stream/sha256"
+)
+
+/*
+Prime order group of a key, see schnorr.Group
+*/
+type Group = group.Group
+
+type PublicKey struct {
+	Group    Group
+	X        group.Element // public key, X = g^x (x*G on curves)
+	NotAfter time.Time     // key expiry, zero if the key never expires
+
+	Environment string // environment tag bound into the challenge, see Tag
+	Context     string // signing context bound into the challenge, see Tag
+}
+
+type Signature struct {
+	R []byte   // encoding of R = g^r (r*G on curves)
+	S *big.Int // (r + H(R||m)x) mod q
+}
+
+/*
+Parse public key encoded with schnorr.PublicKey.Bytes. Elements of the mod p
+groups are checked to be members of the subgroup of order q. Explicit groups
+are rejected unless allowed with schnorr.AllowExplicitGroups, their structure
+(primality of p and q) is not checked.
+*/
+func ParsePublicKey(b []byte) (*PublicKey, error) {
+	g, rest, err := group.ReadGroup(b)
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	if len(rest) < 2 || len(rest) < 2+int(binary.BigEndian.Uint16(rest))+8 {
+		return nil, ErrInvalidEncoding
+	}
+	n := int(binary.BigEndian.Uint16(rest))
+	X, err := g.Decode(rest[2 : 2+n])
+	if err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	rest = rest[2+n:]
+
+	pk := &PublicKey{Group: g, X: X}
+	if notAfter := binary.BigEndian.Uint64(rest); notAfter != 0 {
+		pk.NotAfter = time.Unix(int64(notAfter), 0)
+	}
+	if pk.Environment, err = ParseEnvironment(rest[8:]); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+/*
+Optional trailing environment field of the key encodings: nothing for keys
+without environment, len(environment)||environment otherwise (2 byte length)
+*/
+func ParseEnvironment(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", nil
+	}
+	if len(b) < 2 || int(binary.BigEndian.Uint16(b)) != len(b)-2 || ValidateEnvironment(string(b[2:])) != nil {
+		return "", ErrInvalidEncoding
+	}
+	return string(b[2:]), nil
+}
+
+/*
+Environment tags are 1 to 64 characters out of a-z, 0-9, '.', '_' and '-'
+*/
+func ValidateEnvironment(environment string) error {
+	if len(environment) == 0 || len(environment) > 64 {
+		return ErrInvalidEnvironment
+	}
+	for _, c := range []byte(environment) {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return ErrInvalidEnvironment
+		}
+	}
+	return nil
+}
+
+/*
+Tag bound into the challenge of a key with the given environment and signing
+context (see TaggedChallenge):
+
+	"schnorr/tag" || len(environment) || environment || context
+
+with a 2 byte length, "" for keys without environment signing plain messages.
+A signature made by a key tagged "staging" never verifies with the same key
+material tagged "prod", and a signature made in one context (e.g. of a stream
+digest, see StreamContext) never verifies in another, the challenges differ.
+*/
+func Tag(environment, context string) string {
+	if environment == "" && context == "" {
+		return ""
+	}
+	b := make([]byte, 0, len("schnorr/tag")+2+len(environment)+len(context))
+	b = append(b, "schnorr/tag"...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(environment)))
+	b = append(append(b, environment...), context...)
+	return string(b)
+}
+
+/*
+Signing contexts are at most MaxContextLength bytes
+*/
+func ValidateContext(context string) error {
+	if len(context) > MaxContextLength {
+		return ErrInvalidContext
+	}
+	return nil
+}
+
+/*
+Parse signature encoded with schnorr.Signature.Bytes. R stays encoded until
+the signature is checked with a key of its group.
+*/
+func ParseSignature(b []byte) (*Signature, error) {
+	var fields [2][]byte
+	for i := range fields {
+		if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+			return nil, ErrInvalidEncoding
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		fields[i], b = b[2:2+n], b[2+n:]
+	}
+	if len(b) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return &Signature{append([]byte(nil), fields[0]...), new(big.Int).SetBytes(fields[1])}, nil
+}
+
+/*
+Check the key: a group, a public key which can be encoded in it (the identity
+is rejected), a valid environment tag and context. The structure of the group isn't
+checked, it's up to the application to trust the group of the key.
+*/
+func (pk *PublicKey) Validate() error {
+	if !pk.validFields() {
+		return ErrInvalidPublicKey
+	}
+	if _, err := pk.Group.Encode(pk.X); err != nil {
+		return ErrInvalidPublicKey
+	}
+	return nil
+}
+
+/*
+Every check of Validate but the encoding of X
+*/
+func (pk *PublicKey) validFields() bool {
+	return pk != nil && pk.Group != nil && pk.X != nil &&
+		(pk.Environment == "" || ValidateEnvironment(pk.Environment) == nil) && ValidateContext(pk.Context) == nil
+}
+
+/*
+Check the signature for the (valid) key: R is an element of the key's group
+other than the identity and 0 <= s < q. Every signature has a single encoding
+accepted by Verify, s + q is rejected. Returns the decoded R.
+*/
+func (s *Signature) Validate(pk *PublicKey) (group.Element, error) {
+	if s == nil || s.S == nil || s.S.Sign() < 0 || s.S.Cmp(pk.Group.Order()) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+	R, err := pk.Group.Decode(s.R)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	return R, nil
+}
+
+/*
+Use to verify signature correctness. Following condition needs to be checked:
+g^s = R * X^c  (s*G = R + c*X on curves)
+where:
+s - signature
+g - group generator
+R - g^r
+c - H(R||m) - challenge, see Challenge()
+X - public key
+
+Malformed keys and out-of-range components (see Validate) are rejected
+before any computation. The challenge of keys with an environment or a
+context is tagged with Tag(Environment, Context).
+
+NotAfter is NOT checked, see VerifyAt for verification enforcing the key
+expiry.
+*/
+func Verify(message string, signature *Signature, publicKey *PublicKey) bool {
+	if publicKey != nil {
+		if a, ok := publicKey.Group.(group.Appender); ok {
+			return verifyAppend(a, message, signature, publicKey)
+		}
+	}
+	if publicKey.Validate() != nil {
+		return false
+	}
+	R, err := signature.Validate(publicKey)
+	if err != nil {
+		return false
+	}
+	g := publicKey.Group
+
+	// c = H(R||m) reduced modulo group order
+	c := TaggedChallenge(Tag(publicKey.Environment, publicKey.Context), signature.R, message, g.Order())
+
+	left := g.ScalarBaseMult(signature.S)
+	right := g.Add(R, g.ScalarMult(publicKey.X, c))
+	return g.Equal(left, right)
+}
+
+/*
+Verify in the buffers of a modp.Scratch, without allocating for keys without
+environment and context: the commitment g^s * X^-c a valid signature has is
+computed and encoded, and compared with the encoding R. Decode accepts only
+the encoding Encode produces, so this accepts exactly the signatures whose R
+decodes to g^s * X^-c. X has to be in the group of prime order, as Decode and
+key generation make sure.
+*/
+func verifyAppend(a group.Appender, message string, signature *Signature, publicKey *PublicKey) bool {
+	if !publicKey.validFields() {
+		return false
+	}
+	g := publicKey.Group
+	q := g.Order()
+	if signature == nil || signature.S == nil || signature.S.Sign() < 0 || signature.S.Cmp(q) >= 0 {
+		return false
+	}
+
+	sc := modp.Get()
+	defer modp.Put(sc)
+	var err error
+	if sc.Buf, err = a.AppendEncode(sc.Buf[:0], publicKey.X); err != nil {
+		return false
+	}
+
+	c := sc.Challenge(Tag(publicKey.Environment, publicKey.Context), signature.R, message, q)
+	minus := sc.A.Sub(q, c)
+	sc.Buf, err = a.AppendDoubleScalarMult(sc.Buf[:0], signature.S, publicKey.X, minus)
+	return err == nil && bytes.Equal(sc.Buf, signature.R)
+}
+
+/*
+Verify which additionally rejects signatures checked after the key expiry
+*/
+func VerifyAt(message string, signature *Signature, publicKey *PublicKey, at time.Time) bool {
+	if publicKey != nil && !publicKey.NotAfter.IsZero() && at.After(publicKey.NotAfter) {
+		return false
+	}
+	return Verify(message, signature, publicKey)
+}
+
+/*
+Fiat-Shamir challenge c = H(R||m) as an element of the scalar field Z_q,
+where q is the order of the group and R is the encoding of the commitment.
+
+Construction:
+
+	input = R || m
+	wide  = SHA256(0x00000000 || input) || SHA256(0x00000001 || input) || ...
+	c     = OS2IP(wide) mod q
+
+wide has at least bitlen(q) + 128 bits, so the bias of the modular reduction
+is below 2^-128 and c is (computationally) uniform in [0, q).
+*/
+func Challenge(R []byte, m string, q *big.Int) *big.Int {
+	return TaggedChallenge("", R, m, q)
+}
+
+/*
+Challenge c = H(tag||R||m) of a key with a tag (see Tag), the same
+construction as Challenge with the input
+
+	input = len(tag) || tag || R || m
+
+with a 2 byte length. The empty tag is Challenge.
+*/
+func TaggedChallenge(tag string, R []byte, m string, q *big.Int) *big.Int {
+	sc := modp.Get()
+	defer modp.Put(sc)
+
+	return new(big.Int).Set(sc.Challenge(tag, R, m, q))
+}
@@ -0,0 +1,263 @@
+/*
+Delayed verification queue for out-of-order gossip.
+
+Signatures may arrive before the public key of their signer or before the
+message they sign. The queue persists such signatures as pending items,
+retries their verification whenever a missing key or message arrives and
+reports the final outcome (accepted or rejected) exactly once per item.
+
+Pending items are persisted in Storage and survive restarts. Keys and messages
+are kept in memory only, after a restart they are expected to be gossiped again.
+*/
+package watchtower
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+var (
+	ErrBadSignature = errors.New("watchtower: invalid signature")
+	ErrTimeout      = errors.New("watchtower: key or message didn't arrive in time")
+	ErrUnknownItem  = errors.New("watchtower: unknown item")
+)
+
+/*
+Signature waiting for verification
+*/
+type Item struct {
+	ID        string
+	KeyID     string
+	MessageID string
+	Signature []byte // schnorr.Signature.Bytes()
+	Received  time.Time
+}
+
+/*
+Pluggable persistence of pending items
+*/
+type Storage interface {
+	Save(item *Item) error
+	Delete(id string) error
+	List() ([]*Item, error)
+}
+
+/*
+Final outcome of an item, Err is nil for accepted items
+*/
+type Event struct {
+	Item *Item
+	Err  error
+}
+
+func (e Event) Accepted() bool {
+	return e.Err == nil
+}
+
+type Queue struct {
+	storage Storage
+	emit    func(Event)
+	maxWait time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	keys     map[string]*schnorr.PublicKey
+	messages map[string]message
+	pending  map[string]*Item
+}
+
+type message struct {
+	body     string
+	received time.Time
+}
+
+/*
+Create queue and load pending items from storage. Items wait at most maxWait
+for their dependencies, emit is called for every accepted or rejected item.
+*/
+func NewQueue(storage Storage, emit func(Event), maxWait time.Duration) (*Queue, error) {
+	q := &Queue{
+		storage:  storage,
+		emit:     emit,
+		maxWait:  maxWait,
+		now:      schnorr.Now,
+		keys:     make(map[string]*schnorr.PublicKey),
+		messages: make(map[string]message),
+		pending:  make(map[string]*Item),
+	}
+
+	items, err := storage.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		q.pending[item.ID] = item
+	}
+	return q, nil
+}
+
+/*
+Accept signature, it's verified immediately if the key and the message are already known
+*/
+func (q *Queue) Submit(item *Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if item.Received.IsZero() {
+		item.Received = q.now()
+	}
+	if event, ok := q.try(item); ok {
+		q.emit(event)
+		return nil
+	}
+	if err := q.storage.Save(item); err != nil {
+		return err
+	}
+	q.pending[item.ID] = item
+	return nil
+}
+
+/*
+Public key arrived, retry items waiting for it
+*/
+func (q *Queue) AddKey(pk *schnorr.PublicKey) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.keys[pk.KeyID()] = pk
+	return q.retry(func(item *Item) bool { return item.KeyID == pk.KeyID() })
+}
+
+/*
+Message arrived, retry items waiting for it
+*/
+func (q *Queue) AddMessage(id, body string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.messages[id] = message{body, q.now()}
+	return q.retry(func(item *Item) bool { return item.MessageID == id })
+}
+
+/*
+Reject items waiting longer than maxWait and forget old messages.
+Should be called periodically, e.g. from a time.Ticker loop.
+*/
+func (q *Queue) Expire() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	for id, m := range q.messages {
+		if now.Sub(m.received) > q.maxWait {
+			delete(q.messages, id)
+		}
+	}
+
+	for id, item := range q.pending {
+		if now.Sub(item.Received) <= q.maxWait {
+			continue
+		}
+		if err := q.storage.Delete(id); err != nil {
+			return err
+		}
+		delete(q.pending, id)
+		q.emit(Event{item, ErrTimeout})
+	}
+	return nil
+}
+
+/*
+Number of items waiting for their key or message
+*/
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+func (q *Queue) retry(match func(*Item) bool) error {
+	for id, item := range q.pending {
+		if !match(item) {
+			continue
+		}
+		event, ok := q.try(item)
+		if !ok {
+			continue
+		}
+		// item is removed from storage before the event is emitted,
+		// so it can't be reported again after a restart
+		if err := q.storage.Delete(id); err != nil {
+			return err
+		}
+		delete(q.pending, id)
+		q.emit(event)
+	}
+	return nil
+}
+
+/*
+Verify item if its dependencies are known, returns false if it has to wait
+*/
+func (q *Queue) try(item *Item) (Event, bool) {
+	pk, ok := q.keys[item.KeyID]
+	if !ok {
+		return Event{}, false
+	}
+	m, ok := q.messages[item.MessageID]
+	if !ok {
+		return Event{}, false
+	}
+
+	signature, err := schnorr.ParseSignature(item.Signature)
+	if err == nil && !schnorr.VerifySignature(m.body, signature, pk) {
+		err = ErrBadSignature
+	}
+	return Event{item, err}, true
+}
+
+/*
+In-memory Storage
+*/
+type MemoryStorage struct {
+	mu    sync.Mutex
+	items map[string]Item
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{items: make(map[string]Item)}
+}
+
+func (m *MemoryStorage) Save(item *Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items[item.ID] = *item
+	return nil
+}
+
+func (m *MemoryStorage) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.items[id]; !ok {
+		return ErrUnknownItem
+	}
+	delete(m.items, id)
+	return nil
+}
+
+func (m *MemoryStorage) List() ([]*Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := make([]*Item, 0, len(m.items))
+	for _, item := range m.items {
+		item := item
+		items = append(items, &item)
+	}
+	return items, nil
+}
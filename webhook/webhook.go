@@ -0,0 +1,314 @@
+/*
+Signing and verification of webhook deliveries.
+
+The sender puts a timestamped signature header on every delivery:
+
+	Webhook-Signature: t=1700000000,id=5f2c...,s=<key ID>:<base64 signature>[,s=...]
+
+The signature covers the timestamp, the delivery ID and the raw body. Receivers
+reject deliveries older than the tolerance and delivery IDs they have already
+seen, so a captured delivery can't be replayed.
+
+Keys can be rotated without coordinating sender and receivers: after
+Signer.Rotate the sender signs with both the new and the previous key until
+the overlap ends, after Verifier.Rotate the receiver accepts the previous key
+until the grace period ends.
+*/
+package webhook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miki799/schnorr-signature/entropy"
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+/*
+Name of the signature header
+*/
+const Header = "Webhook-Signature"
+
+/*
+Default limit of delivery bodies read by VerifyRequest
+*/
+const DefaultMaxBody = 1 << 20
+
+var (
+	ErrMissingHeader = errors.New("webhook: missing signature header")
+	ErrMalformed     = errors.New("webhook: malformed signature header")
+	ErrStale         = errors.New("webhook: timestamp outside of the tolerance")
+	ErrReplay        = errors.New("webhook: delivery replayed")
+	ErrNoValidKey    = errors.New("webhook: no signature by an accepted key")
+	ErrBodyTooLarge  = errors.New("webhook: body is too large")
+)
+
+type signingKey struct {
+	keyID string
+	sk    *schnorr.SignatureKey
+	until time.Time // zero for the current key
+}
+
+/*
+Sender side of webhook deliveries
+*/
+type Signer struct {
+	mu   sync.Mutex
+	keys []signingKey // current key first
+	now  func() time.Time
+}
+
+func NewSigner(sk *schnorr.SignatureKey, pk *schnorr.PublicKey) *Signer {
+	return &Signer{keys: []signingKey{{keyID: pk.KeyID(), sk: sk}}, now: schnorr.Now}
+}
+
+/*
+Make the key current. Deliveries are signed with the previous keys as well
+until overlap passes, so receivers have time to switch.
+*/
+func (s *Signer) Rotate(sk *schnorr.SignatureKey, pk *schnorr.PublicKey, overlap time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until := s.now().Add(overlap)
+	keys := []signingKey{{keyID: pk.KeyID(), sk: sk}}
+	for _, k := range s.prune() {
+		if k.until.IsZero() {
+			k.until = until
+		}
+		keys = append(keys, k)
+	}
+	s.keys = keys
+}
+
+/*
+Value of the signature header for the delivery of payload
+*/
+func (s *Signer) Sign(payload []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var id [16]byte
+	if _, err := io.ReadFull(entropy.Reader, id[:]); err != nil {
+		return "", err
+	}
+	ts := strconv.FormatInt(s.now().Unix(), 10)
+	deliveryID := hex.EncodeToString(id[:])
+	m := digest(ts, deliveryID, payload)
+
+	var b strings.Builder
+	b.WriteString("t=" + ts + ",id=" + deliveryID)
+	for _, k := range s.prune() {
+		signature, err := schnorr.TrySign(m, k.sk)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(",s=" + k.keyID + ":" + base64.StdEncoding.EncodeToString(signature.Bytes()))
+	}
+	return b.String(), nil
+}
+
+/*
+POST request delivering payload to url with the signature header set
+*/
+func (s *Signer) NewRequest(url string, payload []byte) (*http.Request, error) {
+	header, err := s.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(Header, header)
+	return r, nil
+}
+
+/*
+Drop previous keys whose overlap has passed
+*/
+func (s *Signer) prune() []signingKey {
+	now := s.now()
+	keys := s.keys[:0]
+	for _, k := range s.keys {
+		if k.until.IsZero() || now.Before(k.until) {
+			keys = append(keys, k)
+		}
+	}
+	s.keys = keys
+	return keys
+}
+
+type acceptedKey struct {
+	pk    *schnorr.PublicKey
+	until time.Time // zero for the current key
+}
+
+/*
+Receiver side of webhook deliveries with replay protection.
+Deliveries are accepted if their timestamp is within tolerance from the
+receiver time and their ID wasn't seen during that time.
+*/
+type Verifier struct {
+	tolerance time.Duration
+	now       func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]acceptedKey // key ID -> key
+	seen map[string]time.Time   // delivery ID -> time after which it can be forgotten
+}
+
+func NewVerifier(pk *schnorr.PublicKey, tolerance time.Duration) *Verifier {
+	return &Verifier{
+		tolerance: tolerance,
+		now:       schnorr.Now,
+		keys:      map[string]acceptedKey{pk.KeyID(): {pk: pk}},
+		seen:      make(map[string]time.Time),
+	}
+}
+
+/*
+Accept the new key, the previous keys stay accepted until grace passes
+*/
+func (v *Verifier) Rotate(pk *schnorr.PublicKey, grace time.Duration) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	until := v.now().Add(grace)
+	for keyID, k := range v.keys {
+		if k.until.IsZero() {
+			k.until = until
+			v.keys[keyID] = k
+		}
+	}
+	v.keys[pk.KeyID()] = acceptedKey{pk: pk}
+}
+
+/*
+Verify the delivery of payload with the signature header value.
+Returns ID of the accepted key which signed the delivery.
+*/
+func (v *Verifier) Verify(payload []byte, header string) (string, error) {
+	if header == "" {
+		return "", ErrMissingHeader
+	}
+	var ts, deliveryID string
+	var signatures [][2]string // key ID, signature
+	for _, field := range strings.Split(header, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return "", ErrMalformed
+		}
+		switch name {
+		case "t":
+			ts = value
+		case "id":
+			deliveryID = value
+		case "s":
+			keyID, signature, ok := strings.Cut(value, ":")
+			if !ok {
+				return "", ErrMalformed
+			}
+			signatures = append(signatures, [2]string{keyID, signature})
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || deliveryID == "" || len(signatures) == 0 {
+		return "", ErrMalformed
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	if d := now.Sub(time.Unix(unix, 0)); d > v.tolerance || d < -v.tolerance {
+		return "", ErrStale
+	}
+
+	m := digest(ts, deliveryID, payload)
+	for _, s := range signatures {
+		k, ok := v.keys[s[0]]
+		if !ok || (!k.until.IsZero() && !now.Before(k.until)) {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(s[1])
+		if err != nil {
+			continue
+		}
+		signature, err := schnorr.ParseSignature(b)
+		if err != nil || !schnorr.VerifySignature(m, signature, k.pk) {
+			continue
+		}
+
+		// delivery ID is remembered only after the signature is checked,
+		// so unauthenticated senders can't fill the cache
+		if err := v.remember(deliveryID, now); err != nil {
+			return "", err
+		}
+		return s[0], nil
+	}
+	return "", ErrNoValidKey
+}
+
+/*
+Read the body of an inbound delivery (up to DefaultMaxBody bytes) and verify it.
+Returns the body and ID of the key which signed it.
+*/
+func (v *Verifier) VerifyRequest(r *http.Request) ([]byte, string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, DefaultMaxBody+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) > DefaultMaxBody {
+		return nil, "", ErrBodyTooLarge
+	}
+	keyID, err := v.Verify(body, r.Header.Get(Header))
+	if err != nil {
+		return nil, "", err
+	}
+	return body, keyID, nil
+}
+
+func (v *Verifier) remember(deliveryID string, now time.Time) error {
+	for id, expiry := range v.seen {
+		if now.After(expiry) {
+			delete(v.seen, id)
+		}
+	}
+	for keyID, k := range v.keys {
+		if !k.until.IsZero() && !now.Before(k.until) {
+			delete(v.keys, keyID)
+		}
+	}
+
+	if _, ok := v.seen[deliveryID]; ok {
+		return ErrReplay
+	}
+	v.seen[deliveryID] = now.Add(2 * v.tolerance)
+	return nil
+}
+
+/*
+H("schnorr/webhook/v1"||timestamp||delivery ID||payload) with every field length prefixed
+*/
+func digest(ts, deliveryID string, payload []byte) string {
+	h := sha256.New()
+	for _, field := range [][]byte{[]byte("schnorr/webhook/v1"), []byte(ts), []byte(deliveryID), payload} {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(field)))
+		h.Write(l[:])
+		h.Write(field)
+	}
+	return string(h.Sum(nil))
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miki799/schnorr-signature/schnorr"
+)
+
+func keys(t *testing.T) (*schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk, err := schnorr.GenerateKeysWithParamsID(schnorr.ParamsP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk
+}
+
+/*
+Signer and verifier on the same manual clock
+*/
+func setup(t *testing.T) (*Signer, *Verifier, *time.Time, *schnorr.SignatureKey, *schnorr.PublicKey) {
+	t.Helper()
+	sk, pk := keys(t)
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	s, v := NewSigner(sk, pk), NewVerifier(pk, 5*time.Minute)
+	s.now, v.now = clock, clock
+	return s, v, &now, sk, pk
+}
+
+func sign(t *testing.T, s *Signer, payload string) string {
+	t.Helper()
+	header, err := s.Sign([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestRoundTrip(t *testing.T) {
+	s, v, _, _, pk := setup(t)
+	r, err := s.NewRequest("https://example.com/hook", []byte(`{"event":"paid"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, keyID, err := v.VerifyRequest(r)
+	if err != nil || keyID != pk.KeyID() || string(body) != `{"event":"paid"}` {
+		t.Fatalf("%q by %q: %v", body, keyID, err)
+	}
+
+	header := sign(t, s, "event")
+	if _, err := v.Verify([]byte("event"), header); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify([]byte("event"), header); err != ErrReplay {
+		t.Errorf("replayed delivery: %v", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	s, v, now, oldSK, oldPK := setup(t)
+	newSK, newPK := keys(t)
+
+	// the sender rotates first and signs with both keys during the overlap
+	s.Rotate(newSK, newPK, time.Hour)
+	if keyID, err := v.Verify([]byte("event"), sign(t, s, "event")); err != nil || keyID != oldPK.KeyID() {
+		t.Fatalf("receiver before its rotation: %q, %v", keyID, err)
+	}
+	v.Rotate(newPK, 2*time.Hour)
+	if keyID, err := v.Verify([]byte("event"), sign(t, s, "event")); err != nil || keyID != newPK.KeyID() {
+		t.Fatalf("after both rotations: %q, %v", keyID, err)
+	}
+
+	*now = now.Add(90 * time.Minute)
+	if header := sign(t, s, "event"); strings.Count(header, ",s=") != 1 {
+		t.Errorf("signed with the old key after the overlap: %s", header)
+	}
+
+	// a delivery signed with the old key only is rejected after the grace period
+	old := NewSigner(oldSK, oldPK)
+	*now = now.Add(time.Hour)
+	old.now = s.now
+	if _, err := v.Verify([]byte("event"), sign(t, old, "event")); err != ErrNoValidKey {
+		t.Errorf("old key after the grace period: %v", err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	s, v, now, _, _ := setup(t)
+	if _, err := v.Verify([]byte("other"), sign(t, s, "event")); err != ErrNoValidKey {
+		t.Errorf("other payload: %v", err)
+	}
+
+	header := sign(t, s, "event")
+	ts := strings.TrimPrefix(strings.Split(header, ",")[0], "t=")
+	later := strings.Replace(header, "t="+ts, "t="+strconv.FormatInt(now.Unix()+1, 10), 1)
+	if _, err := v.Verify([]byte("event"), later); err != ErrNoValidKey {
+		t.Errorf("changed timestamp: %v", err)
+	}
+	otherID := strings.Replace(header, ",id=", ",id=00", 1)
+	if _, err := v.Verify([]byte("event"), otherID); err != ErrNoValidKey {
+		t.Errorf("changed delivery ID: %v", err)
+	}
+
+	// a signature by a key the receiver doesn't accept
+	otherSK, otherPK := keys(t)
+	stranger := NewSigner(otherSK, otherPK)
+	stranger.now = s.now
+	if _, err := v.Verify([]byte("event"), sign(t, stranger, "event")); err != ErrNoValidKey {
+		t.Errorf("unknown key: %v", err)
+	}
+}
+
+func TestStale(t *testing.T) {
+	s, v, now, _, _ := setup(t)
+	for _, offset := range []time.Duration{-10 * time.Minute, 10 * time.Minute} {
+		header := sign(t, s, "event")
+		v.now = func() time.Time { return now.Add(offset) }
+		if _, err := v.Verify([]byte("event"), header); err != ErrStale {
+			t.Errorf("delivery %v off: %v", offset, err)
+		}
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	s, v, _, _, _ := setup(t)
+	valid := sign(t, s, "event")
+	if _, err := v.Verify([]byte("event"), ""); err != ErrMissingHeader {
+		t.Errorf("missing header: %v", err)
+	}
+	for _, header := range []string{
+		"garbage",
+		"t=1700000000,id=1",
+		"t=yesterday,id=1,s=key:AAAA",
+		"t=1700000000,s=key:AAAA",
+		"t=1700000000,id=1,s=AAAA",
+		strings.Split(valid, ",s=")[0],
+	} {
+		if _, err := v.Verify([]byte("event"), header); err != ErrMalformed {
+			t.Errorf("header %q: %v", header, err)
+		}
+	}
+	broken := strings.SplitN(valid, ":", 2)[0] + ":not base64"
+	if _, err := v.Verify([]byte("event"), broken); err != ErrNoValidKey {
+		t.Errorf("malformed signature: %v", err)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, "https://example.com/hook", bytes.NewReader(make([]byte, DefaultMaxBody+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set(Header, valid)
+	if _, _, err := v.VerifyRequest(r); err != ErrBodyTooLarge {
+		t.Errorf("large body: %v", err)
+	}
+}